@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/catalog"
+	"github.com/iostate/back-it-up/internal/retention"
+	"github.com/iostate/back-it-up/internal/throughput"
+	"github.com/iostate/back-it-up/internal/usage"
+)
+
+// allDatabasesRun carries the per-artifact settings of backup --all-databases
+type allDatabasesRun struct {
+	tags       []string
+	note       string
+	meta       map[string]string
+	mirrorDirs []string
+	inventory  inventoryConfig
+	// scanRows, if set, samples each dump with --scan-sensitive
+	scanRows int
+	// run is the registration `job cancel` stops the backup through
+	run *trackedRun
+	// retention prunes each database's older backups after it is backed up
+	retention retention.Policy
+}
+
+// backupAllDatabases dumps every non-template database of cfg.ContainerName
+// to its own artifact, all with the same timestamp. A failing database
+// doesn't stop the others; the run fails at the end if any did.
+func backupAllDatabases(backupSvc *backup.Service, cat *catalog.Catalog, cfg backup.Config, run allDatabasesRun) error {
+	databases, err := backupSvc.ListDatabases(cfg.ContainerName, cfg.DatabaseUser)
+	if err != nil {
+		return err
+	}
+	if len(databases) == 0 {
+		return fmt.Errorf("container '%s' has no databases to back up", cfg.ContainerName)
+	}
+	fmt.Printf("Backing up %d database(s)...\n", len(databases))
+
+	cfg.Timestamp = backupSvc.Now()
+	destination := cfg.OutputDir
+	if cfg.Destination != "" {
+		destination = remoteHost(cfg.Destination)
+	}
+	var failed []string
+	for _, db := range databases {
+		cfg.DatabaseName = db
+		fmt.Printf("Dumping database '%s'...\n", db)
+		started := time.Now()
+		duplicate := false
+		cfg.OnDuplicate = func(string) { duplicate = true }
+		outputPath, err := backupSvc.Backup(cfg)
+		if err != nil {
+			failure := catalog.Entry{
+				ContainerName: cfg.ContainerName,
+				DatabaseName:  db,
+				CreatedAt:     cfg.Timestamp,
+				Duration:      time.Since(started),
+				Tags:          run.tags,
+				Meta:          run.meta,
+			}
+			// The rest of the databases aren't attempted once cancelled
+			if c, ok := run.run.cancellation(); ok {
+				recordCancellation(cat, failure, c)
+				return fmt.Errorf("backup cancelled by %s while dumping '%s'", c.By, db)
+			}
+			fmt.Fprintf(os.Stderr, "✗ %s: %v\n", db, err)
+			failed = append(failed, db)
+			recordFailure(cat, failure, err)
+			continue
+		}
+		if size, err := backup.BackupSize(outputPath); err == nil {
+			recordThroughput(throughput.OpBackup, cfg.ContainerName, destination, size, started)
+			recordUsage(usage.OpBackup, size, duplicate)
+		}
+
+		record := catalog.Entry{
+			Path:          outputPath,
+			ContainerName: cfg.ContainerName,
+			DatabaseName:  db,
+			CreatedAt:     cfg.Timestamp,
+			Duration:      time.Since(started),
+			Tags:          run.tags,
+			Note:          run.note,
+			Meta:          run.meta,
+		}
+		if run.scanRows > 0 {
+			if record.SensitiveScan, err = scanSensitive(outputPath, run.scanRows); err != nil {
+				fmt.Fprintf(os.Stderr, "✗ %s: %v\n", db, err)
+				failed = append(failed, db)
+				continue
+			}
+		}
+		entry, err := recordBackup(cat, record)
+		if err != nil {
+			return fmt.Errorf("failed to record backup in catalog: %w", err)
+		}
+		fmt.Printf("✓ %s (catalog ID: %s)\n", outputPath, entry.ID)
+		reportInventory(run.inventory, entry)
+
+		if len(run.mirrorDirs) > 0 {
+			err := backupSvc.Mirror(outputPath, run.mirrorDirs)
+			if err == nil && cfg.Globals {
+				err = backupSvc.Mirror(backup.GlobalsPath(outputPath), run.mirrorDirs)
+			}
+			if err == nil && cfg.Dictionary != "" {
+				err = mirrorDictionary(backupSvc, cfg.Dictionary, run.mirrorDirs)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "✗ %s: replication failed: %v\n", db, err)
+				failed = append(failed, db)
+				continue
+			}
+		}
+		pruneAfterBackup(cat, run.retention, entry)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d database(s) failed to back up: %s", len(failed), len(databases), strings.Join(failed, ", "))
+	}
+	fmt.Printf("All %d database(s) backed up successfully\n", len(databases))
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/schedule"
+)
+
+// Blackout actions for commands that start inside a blackout window
+const (
+	blackoutSkip  = "skip"
+	blackoutDefer = "defer"
+)
+
+// handleBlackout decides what to do when a backup starts inside a blackout
+// window. With "defer" it sleeps until the window ends; with "skip" it
+// returns a reason the backup was skipped. An empty reason means proceed.
+func handleBlackout(windows schedule.Blackouts, action string) (string, error) {
+	if action != blackoutSkip && action != blackoutDefer {
+		return "", fmt.Errorf("invalid --blackout-action %q (expected skip or defer)", action)
+	}
+
+	for {
+		window, until, active := windows.ActiveAt(time.Now())
+		if !active {
+			return "", nil
+		}
+
+		if action == blackoutSkip {
+			return fmt.Sprintf("blackout window %q active until %s", window.String(), until.Format(time.RFC3339)), nil
+		}
+
+		fmt.Printf("Blackout window %q active, deferring until %s...\n", window.String(), until.Format(time.RFC3339))
+		time.Sleep(time.Until(until))
+	}
+}
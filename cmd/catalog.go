@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/catalog"
+	"github.com/iostate/back-it-up/internal/control"
+	"github.com/iostate/back-it-up/internal/storage"
+)
+
+// recordBackup adds a finished backup to the catalog
+func recordBackup(cat *catalog.Catalog, entry catalog.Entry) (catalog.Entry, error) {
+	// Pushed backups arrive with the size and digest reported by the registry
+	if entry.Checksum == "" {
+		if size, err := backup.BackupSize(entry.Path); err == nil {
+			entry.Size = size
+		}
+		checksum, err := backup.RecordedChecksum(entry.Path)
+		if err != nil {
+			return catalog.Entry{}, fmt.Errorf("failed to checksum backup: %w", err)
+		}
+		entry.Checksum = checksum
+	}
+	if entry.Kind == "" {
+		entry.Kind = catalog.KindBackup
+	}
+	if entry.Kind == catalog.KindBackup && entry.Content == "" {
+		entry.Content = backup.DumpContent(entry.Path)
+	}
+	return cat.Add(entry)
+}
+
+// recordFailure adds a backup that ran but failed to the catalog, so its
+// history shows the gap. A failure to record it is only reported, since the
+// backup's own error is the one that matters.
+func recordFailure(cat *catalog.Catalog, entry catalog.Entry, cause error) {
+	entry.Kind = catalog.KindFailed
+	// Tool output after the first line would break up list's table
+	entry.Note, _, _ = strings.Cut(cause.Error(), "\n")
+	if _, err := cat.Add(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record failed backup in catalog: %v\n", err)
+	}
+}
+
+// recordCancellation adds a backup cancelled while it ran to the catalog,
+// under its run ID
+func recordCancellation(cat *catalog.Catalog, entry catalog.Entry, c control.Cancellation) {
+	entry.Kind = catalog.KindCancelled
+	entry.Note = "cancelled by " + c.By
+	if _, err := cat.Add(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record cancelled backup in catalog: %v\n", err)
+	}
+}
+
+// entryStatus summarizes how the run behind e went
+func entryStatus(e catalog.Entry) string {
+	switch e.Kind {
+	case catalog.KindFailed, catalog.KindSkipped, catalog.KindCancelled:
+		return e.Kind
+	case catalog.KindVerify:
+		return e.Status
+	}
+	return "ok"
+}
+
+// resolveCatalogBackup finds a backup by catalog ID, or the newest backup carrying tag
+func resolveCatalogBackup(cat *catalog.Catalog, id, tag string) (catalog.Entry, error) {
+	if id != "" {
+		return cat.Get(id)
+	}
+
+	entry, ok, err := cat.Latest(catalog.Filter{Kind: catalog.KindBackup, Tag: tag}.Match)
+	if err != nil {
+		return catalog.Entry{}, err
+	}
+	if !ok {
+		return catalog.Entry{}, fmt.Errorf("no backup tagged %q in the catalog", tag)
+	}
+	return entry, nil
+}
+
+// verifyCatalogChecksum makes sure the artifact on disk is the one the catalog recorded
+func verifyCatalogChecksum(entry catalog.Entry) error {
+	if entry.Checksum == "" {
+		fmt.Println("Warning: catalog entry has no checksum, skipping integrity check")
+		return nil
+	}
+
+	// A stored backup is checked against its checksum file as it streams,
+	// so only that file needs to agree with the catalog
+	checksum := backup.FileChecksum
+	if storage.IsLocation(entry.Path) {
+		checksum = backup.RecordedChecksum
+	}
+	actual, err := checksum(entry.Path)
+	if err != nil {
+		return fmt.Errorf("failed to checksum %s: %w", entry.Path, err)
+	}
+	if actual != entry.Checksum {
+		return fmt.Errorf("checksum mismatch for %s: catalog has %s, file has %s", entry.Path, entry.Checksum, actual)
+	}
+
+	fmt.Println("✓ Checksum verified")
+	return nil
+}
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	dbName := fs.String("database", "", "Only list backups of this database")
+	fs.StringVar(dbName, "d", "", "Only list backups of this database (shorthand)")
+	tag := fs.String("tag", "", "Only list backups with this tag")
+	kind := fs.String("kind", catalog.KindBackup, "Entry kind to list: backup, failed, undo, skipped, verify, volume, inspect, or all")
+	group := fs.String("group", "", "Only list the artifacts of this group, of every kind unless --kind is set")
+	var meta metaFlag
+	fs.Var(&meta, "meta", "Only list artifacts annotated with this key=value by --run-meta (repeatable)")
+	since := fs.String("since", "", "Only list entries created at or after this time (RFC 3339 or YYYY-MM-DD)")
+	until := fs.String("until", "", "Only list entries created before this time (RFC 3339 or YYYY-MM-DD)")
+	catalogPath := fs.String("catalog", catalog.DefaultPath, "Backup catalog file")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *kind == "all" || (*group != "" && !flagWasSet(fs, "kind")) {
+		*kind = ""
+	}
+	from, err := parseTimeBound(*since)
+	if err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+	to, err := parseTimeBound(*until)
+	if err != nil {
+		return fmt.Errorf("invalid --until: %w", err)
+	}
+
+	entries, err := catalog.Open(*catalogPath).Find(catalog.Filter{
+		Kind:         *kind,
+		DatabaseName: *dbName,
+		Tag:          *tag,
+		Group:        *group,
+		Meta:         meta,
+		Since:        from,
+		Until:        to,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read catalog: %w", err)
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No backups found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDATABASE\tCREATED\tDURATION\tSIZE\tSTATUS\tTAGS\tNOTE\tMETA\tPATH")
+	for _, e := range entries {
+		name := entryName(e)
+		duration := "-"
+		if e.Duration > 0 {
+			duration = e.Duration.Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			e.ID, name, e.CreatedAt.Format(time.DateTime), duration, e.Size, entryStatus(e),
+			strings.Join(e.Tags, ","), e.Note, formatMeta(e.Meta), e.Path)
+	}
+	return w.Flush()
+}
+
+// entryName names what an entry backs up: its database, volume, or container
+func entryName(e catalog.Entry) string {
+	name := e.DatabaseName
+	switch e.Kind {
+	case catalog.KindVolume:
+		name = "volume:" + e.Volume
+	case catalog.KindInspect:
+		name = "container:" + e.ContainerName
+	}
+	if e.Content != "" {
+		name += " (" + e.Content + " only)"
+	}
+	return name
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/catalog"
+)
+
+// Nagios plugin exit codes
+const (
+	nagiosOK       = 0
+	nagiosWarning  = 1
+	nagiosCritical = 2
+	nagiosUnknown  = 3
+)
+
+var nagiosStates = [...]string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// runCheck is a Nagios/Icinga plugin: it prints a single status line and
+// returns the plugin exit code instead of an error
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	job := fs.String("job", "", "Database, container, or tag whose backups are checked (required)")
+	warn := fs.Duration("warn", 26*time.Hour, "Backup age that raises a warning")
+	crit := fs.Duration("crit", 50*time.Hour, "Backup age that is critical")
+	catalogPath := fs.String("catalog", catalog.DefaultPath, "Backup catalog file")
+
+	if err := parseFlags(fs, args); err != nil {
+		return nagiosResult(nagiosUnknown, err.Error(), "")
+	}
+	if *job == "" {
+		return nagiosResult(nagiosUnknown, "--job is required", "")
+	}
+	if *warn > *crit {
+		return nagiosResult(nagiosUnknown, "--warn must not exceed --crit", "")
+	}
+
+	cat := catalog.Open(*catalogPath)
+	matchJob := func(kind string) func(catalog.Entry) bool {
+		return func(e catalog.Entry) bool {
+			return e.Kind == kind && (e.DatabaseName == *job || e.ContainerName == *job || e.HasTag(*job))
+		}
+	}
+
+	last, ok, err := cat.Latest(matchJob(catalog.KindBackup))
+	if err != nil {
+		return nagiosResult(nagiosUnknown, err.Error(), "")
+	}
+	if !ok {
+		return nagiosResult(nagiosCritical, fmt.Sprintf("no backups of %s in the catalog", *job), "")
+	}
+
+	age := time.Since(last.CreatedAt)
+	state := nagiosOK
+	switch {
+	case age >= *crit:
+		state = nagiosCritical
+	case age >= *warn:
+		state = nagiosWarning
+	}
+	messages := []string{fmt.Sprintf("last backup of %s %s ago (%s)", *job, formatAge(age), last.ID)}
+
+	verification, ok, err := cat.Latest(matchJob(catalog.KindVerify))
+	if err != nil {
+		return nagiosResult(nagiosUnknown, err.Error(), "")
+	}
+	if ok {
+		messages = append(messages, fmt.Sprintf("verification %s %s ago", verification.Status, formatAge(time.Since(verification.CreatedAt))))
+		switch verification.Status {
+		case catalog.StatusDivergent:
+			state = nagiosCritical
+		case catalog.StatusError:
+			state = max(state, nagiosWarning)
+		}
+	}
+
+	perfdata := fmt.Sprintf("age=%.0fs;%.0f;%.0f;0 size=%dB", age.Seconds(), warn.Seconds(), crit.Seconds(), last.Size)
+	return nagiosResult(state, strings.Join(messages, ", "), perfdata)
+}
+
+// nagiosResult prints the plugin output line and returns its exit code
+func nagiosResult(state int, message, perfdata string) int {
+	line := fmt.Sprintf("BACKUP %s - %s", nagiosStates[state], message)
+	if perfdata != "" {
+		line += " | " + perfdata
+	}
+	fmt.Println(line)
+	return state
+}
+
+// formatAge renders a duration to the minute, e.g. 3h12m
+func formatAge(d time.Duration) string {
+	if d < time.Minute {
+		return "<1m"
+	}
+	s := d.Round(time.Minute).String()
+	return strings.TrimSuffix(s, "0s")
+}
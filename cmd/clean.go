@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/backup"
+)
+
+// scratchDirEnvVar overrides where runs keep their scratch directories
+const scratchDirEnvVar = "BACKITUP_SCRATCH_DIR"
+
+// leftover is scratch or staging data a run didn't clean up after itself
+type leftover struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func runClean(args []string) error {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	olderThan := fs.Duration("older-than", 24*time.Hour, "Only remove leftovers untouched for this long")
+	outputDir := fs.String("output", "./backups", "Backup directory to remove partial files from")
+	fs.StringVar(outputDir, "o", "./backups", "Backup directory to remove partial files from (shorthand)")
+	dryRun := fs.Bool("dry-run", false, "List what would be removed without removing it")
+	assumeYes := fs.Bool("yes", false, "Skip confirmation prompts")
+	fs.BoolVar(assumeYes, "y", false, "Skip confirmation prompts (shorthand)")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *olderThan < 0 {
+		return fmt.Errorf("--older-than can't be negative")
+	}
+	cutoff := time.Now().Add(-*olderThan)
+
+	runs, err := backup.ScratchRuns()
+	if err != nil {
+		return err
+	}
+	var stale []leftover
+	for _, run := range runs {
+		if !run.ModTime.Before(cutoff) {
+			continue
+		}
+		if run.Running {
+			fmt.Printf("Keeping %s: run %s is still going\n", run.Path, run.ID)
+			continue
+		}
+		stale = append(stale, leftover{path: run.Path, size: run.Size, modTime: run.ModTime})
+	}
+	partials, err := partialFiles(*outputDir, cutoff)
+	if err != nil {
+		return err
+	}
+	stale = append(stale, partials...)
+
+	if len(stale) == 0 {
+		fmt.Printf("Nothing to clean up older than %s\n", formatAge(*olderThan))
+		return nil
+	}
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+	} else {
+		descriptions := make([]string, len(stale))
+		for i, l := range stale {
+			descriptions[i] = fmt.Sprintf("%s (%s)", l.path, formatBytes(l.size))
+		}
+		if err := confirmDestructive(*assumeYes, descriptions...); err != nil {
+			return err
+		}
+	}
+	var freed int64
+	for _, l := range stale {
+		if !*dryRun {
+			if err := os.RemoveAll(l.path); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", l.path, err)
+			}
+		}
+		freed += l.size
+		fmt.Printf("%s %s (%s, untouched for %s)\n", verb, l.path, formatBytes(l.size), formatAge(time.Since(l.modTime)))
+	}
+	fmt.Printf("%s %d leftover(s), %s\n", verb, len(stale), formatBytes(freed))
+	return nil
+}
+
+// partialFiles finds the files under dir that interrupted runs left half
+// written, untouched since before cutoff
+func partialFiles(dir string, cutoff time.Time) ([]leftover, error) {
+	var found []leftover
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == dir {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || !isPartial(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().Before(cutoff) {
+			found = append(found, leftover{path: path, size: info.Size(), modTime: info.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", dir, err)
+	}
+	return found, nil
+}
+
+// isPartial reports whether name is a file still being written: a dump or
+// mirror copy (.partial), or a catalog or manifest being replaced (.tmp)
+func isPartial(name string) bool {
+	return strings.HasSuffix(name, ".partial") || strings.HasSuffix(name, ".tmp") || strings.Contains(name, ".tmp-")
+}
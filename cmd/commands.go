@@ -4,36 +4,317 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/iostate/back-it-up/internal/alert"
+	"github.com/iostate/back-it-up/internal/audit"
 	"github.com/iostate/back-it-up/internal/backup"
-	"github.com/iostate/back-it-up/internal/docker"
+	"github.com/iostate/back-it-up/internal/catalog"
+	"github.com/iostate/back-it-up/internal/clock"
+	"github.com/iostate/back-it-up/internal/config"
+	"github.com/iostate/back-it-up/internal/control"
+	"github.com/iostate/back-it-up/internal/notify"
+	"github.com/iostate/back-it-up/internal/oci"
+	"github.com/iostate/back-it-up/internal/runlog"
+	"github.com/iostate/back-it-up/internal/schedule"
+	"github.com/iostate/back-it-up/internal/storage"
+	"github.com/iostate/back-it-up/internal/subset"
+	"github.com/iostate/back-it-up/internal/throughput"
+	"github.com/iostate/back-it-up/internal/usage"
 )
 
-func runBackup(args []string) error {
+func runBackup(args []string) (runErr error) {
 	fs := flag.NewFlagSet("backup", flag.ExitOnError)
-	containerName := fs.String("container", "", "Docker container name (required)")
+	containerName := fs.String("container", "", "Docker container name (required unless --host is set)")
 	fs.StringVar(containerName, "c", "", "Docker container name (shorthand)")
-	outputDir := fs.String("output", "./backups", "Output directory for backup file")
-	fs.StringVar(outputDir, "o", "./backups", "Output directory for backup file (shorthand)")
+	host := fs.String("host", "", hostFlagUsage)
+	noDockerSocket := fs.Bool("no-docker-socket", false, noDockerSocketUsage)
+	outputDir := fs.String("output", "./backups", "Output directory for backup file, or an oci:// registry reference")
+	fs.StringVar(outputDir, "o", "./backups", "Output directory for backup file, or an oci:// registry reference (shorthand)")
 	dbName := fs.String("database", "postgres", "Database name")
 	fs.StringVar(dbName, "d", "postgres", "Database name (shorthand)")
+	allDatabases := fs.Bool("all-databases", false, "Back up every database in the container, one artifact each")
 	dbUser := fs.String("user", "postgres", "Database user")
 	fs.StringVar(dbUser, "u", "postgres", "Database user (shorthand)")
+	format := fs.String("format", backup.FormatPlain, "Dump format: plain (SQL compressed per --compression), custom (pg_dump -Fc, .dump), or directory (pg_dump -Fd, .dir.tar.gz)")
+	jobs := fs.Int("jobs", 1, "Dump this many tables in parallel; implies --format directory")
+	schemaOnly := fs.Bool("schema-only", false, "Dump only the schema (pg_dump --schema-only)")
+	dataOnly := fs.Bool("data-only", false, "Dump only the data (pg_dump --data-only)")
+	var tables stringList
+	fs.Var(&tables, "table", "Dump only tables matching this pg_dump pattern, e.g. 'events_*' (repeatable)")
+	var excludeTables stringList
+	fs.Var(&excludeTables, "exclude-table", "Leave out tables matching this pg_dump pattern (repeatable)")
+	var excludeColumns stringList
+	fs.Var(&excludeColumns, "exclude-column", "Leave this column's values out of the dump, as table.column or schema.table.column (repeatable)")
+	compression := fs.String("compression", backup.CompressionGzip, "Compression of plain dumps: gzip, zstd, lz4, xz, or none")
+	compressionLevel := fs.Int("compression-level", 0, "Compression level, trading CPU for size: 1-9 for gzip, xz and custom/directory dumps, 1-19 for zstd, 1-12 for lz4 (default: the algorithm's own)")
+	compressThreads := fs.Int("compress-threads", 0, "Threads compressing a plain dump with gzip, zstd or xz (default: one per CPU)")
+	dictionary := fs.String("dictionary", "", "Compress with zstd and this trained dictionary (see `dictionary train`); implies --compression zstd")
+	var recipients stringList
+	fs.Var(&recipients, "encrypt-recipient", "Encrypt the backup with age for this recipient: an age or SSH public key, or a file of them (repeatable)")
+	var gpgRecipients stringList
+	fs.Var(&gpgRecipients, "gpg-recipient", "Encrypt the backup with GPG for this key ID, fingerprint, or user ID in the keyring (repeatable)")
+	signKey := fs.String("sign-key", "", "GPG key to write a detached signature of the backup with, stored next to it as <backup>.sig")
+	sensitive := fs.Bool("scan-sensitive", false, "Sample the finished dump for unencrypted card numbers and social security numbers, and record the findings")
+	scanRows := fs.Int("scan-rows", 1000, "Rows sampled per table by --scan-sensitive")
+	globals := fs.Bool("globals", false, "Also take the server's roles and tablespaces (pg_dumpall --globals-only), stored next to the dump")
+	tableDigests := fs.Bool("table-digests", false, "Record each table's row count and digest in the manifest while the plain dump is compressed")
+	dest := fs.String("dest", "", "Stream the backup to this object store location, e.g. s3://bucket/prefix or sftp://user@host/path, instead of writing it to --output")
+	var mirrorDirs stringList
+	fs.Var(&mirrorDirs, "mirror", "Secondary directory or s3:// or sftp:// location to replicate the backup to (repeatable)")
+	var teeLocations stringList
+	fs.Var(&teeLocations, "tee", "Also stream the backup to this http(s) URL, s3:// or sftp:// location, or oci:// reference while it is written (repeatable)")
+	var teeHeaders stringList
+	fs.Var(&teeHeaders, "tee-header", "HTTP header sent with --tee uploads, as \"Name: value\" (repeatable)")
+	var plan backupPlan
+	fs.Var((*stringList)(&plan.volumes), "with-volume", "Also archive this docker volume, grouped with the dump (repeatable)")
+	fs.Var((*stringList)(&plan.inspect), "with-inspect", "Also snapshot this container's docker inspect config, grouped with the dump (repeatable)")
+	fs.Var((*stringList)(&plan.quiesce), "quiesce", "Pause this app container while the dump and volumes are taken (repeatable)")
+	var tags stringList
+	fs.Var(&tags, "tag", "Tag to attach to the backup (repeatable)")
+	note := fs.String("note", "", "Free-form note to attach to the backup")
+	var meta metaFlag
+	fs.Var(&meta, "run-meta", "Annotate the backup with key=value, e.g. a CI run's git_sha or pipeline_url (repeatable)")
+	catalogPath := fs.String("catalog", catalog.DefaultPath, "Backup catalog file")
+	controlDir := fs.String("control-dir", control.DefaultDir, "Directory the run is registered in, for job cancel")
+	logDir := fs.String("log-dir", runlog.DefaultDir, "Directory the run's log is kept in, for logs")
+	nameByHash := fs.Bool("name-by-hash", false, "Name the backup file after its SHA-256 content hash")
+	var blackoutSpecs stringList
+	fs.Var(&blackoutSpecs, "blackout", "Blackout window as \"<cron> <duration>\" (repeatable)")
+	blackoutAction := fs.String("blackout-action", blackoutSkip, "What to do inside a blackout window: skip or defer")
+	var inventory inventoryConfig
+	fs.StringVar(&inventory.url, "inventory-url", "", "Endpoint to POST the catalog entry to after the run (default $"+inventoryEnvVar+")")
+	fs.StringVar(&inventory.template, "inventory-template", "json", "Inventory payload: json, servicenow, backstage, or a template file")
+	fs.Var((*stringList)(&inventory.headers), "inventory-header", "HTTP header sent to the inventory endpoint, as \"Name: value\" (repeatable)")
+	notifyOpts := addNotifyFlags(fs)
+	keep := addRetentionFlags(fs)
+	jobName := fs.String("job", "", "Take the backup the named job in --config describes; flags given here override it")
+	configPath := fs.String("config", config.DefaultPath, "Config file of named jobs, for --job")
+	tlsOpts := addTLSFlags(fs)
 
-	if err := fs.Parse(args); err != nil {
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *jobName != "" {
+		if err := applyJob(fs, *configPath, *jobName); err != nil {
+			return err
+		}
+	}
+	if err := tlsOpts.apply(); err != nil {
 		return err
 	}
+	if err := notifyOpts.validate(); err != nil {
+		return err
+	}
+	notifyOpts.track(filepath.Join(*controlDir, "alerts"))
+	// Every outcome from here on is posted, so a failing cron job is heard
+	var outcome notify.Event
+	runStarted := time.Now()
+	defer func() {
+		outcome.Name, outcome.Container, outcome.Database = *jobName, *containerName, *dbName
+		outcome.Duration, outcome.Err = time.Since(runStarted), runErr
+		notifyOpts.send(outcome)
+	}()
 
-	if *containerName == "" {
-		fmt.Fprintln(os.Stderr, "Error: --container flag is required")
+	if *containerName == "" && *host == "" {
+		fmt.Fprintln(os.Stderr, "Error: --container or --host flag is required")
 		fs.Usage()
 		return fmt.Errorf("missing required flag: --container")
 	}
+	if *containerName == "" {
+		// Catalog entries are labelled with the server they came from
+		*containerName = *host
+	}
+
+	if err := plan.validate(*containerName, *host, *noDockerSocket); err != nil {
+		return err
+	}
+	policy, err := keep.policy()
+	if err != nil {
+		return err
+	}
+	var excluded []string
+	for _, spec := range excludeColumns {
+		column, err := backup.ParseColumnExclusion(spec)
+		if err != nil {
+			return err
+		}
+		excluded = append(excluded, column)
+	}
+	if *jobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1")
+	}
+	if *jobs > 1 && !flagWasSet(fs, "format") {
+		*format = backup.FormatDirectory
+	}
+	if *jobs > 1 && *format != backup.FormatDirectory {
+		return fmt.Errorf("--jobs needs --format directory")
+	}
+	if len(excluded) > 0 && *format != backup.FormatPlain {
+		return fmt.Errorf("--exclude-column needs --format plain")
+	}
+	if *compressThreads < 0 {
+		return fmt.Errorf("--compress-threads must not be negative")
+	}
+	if *format != backup.FormatPlain {
+		if flagWasSet(fs, "compress-threads") {
+			return fmt.Errorf("--compress-threads needs --format plain; %s dumps are compressed by pg_dump", *format)
+		}
+		if flagWasSet(fs, "compression") {
+			return fmt.Errorf("--compression needs --format plain; %s dumps are compressed by pg_dump", *format)
+		}
+		if *dictionary != "" {
+			return fmt.Errorf("--dictionary needs --format plain")
+		}
+		*compression = ""
+	}
+	if *dictionary != "" {
+		if !flagWasSet(fs, "compression") {
+			*compression = backup.CompressionZstd
+		}
+		if *compression != backup.CompressionZstd {
+			return fmt.Errorf("--dictionary needs --compression zstd")
+		}
+	}
+	content := ""
+	switch {
+	case *schemaOnly && *dataOnly:
+		return fmt.Errorf("--schema-only and --data-only can't be combined")
+	case *schemaOnly:
+		content = backup.ContentSchema
+	case *dataOnly:
+		content = backup.ContentData
+	}
+	if len(excluded) > 0 && content != "" {
+		return fmt.Errorf("--exclude-column needs a full dump, not --schema-only or --data-only")
+	}
+	if len(excluded) > 0 && (len(tables) > 0 || len(excludeTables) > 0) {
+		return fmt.Errorf("--exclude-column can't be combined with --table or --exclude-table")
+	}
+	if *tableDigests && *format != backup.FormatPlain {
+		return fmt.Errorf("--table-digests needs --format plain")
+	}
+	if *dest != "" {
+		if !storage.IsLocation(*dest) {
+			return fmt.Errorf("invalid --dest %q: expected s3://bucket/prefix or sftp://user@host/path", *dest)
+		}
+		if _, _, err := storage.Open(*dest); err != nil {
+			return err
+		}
+		if len(mirrorDirs) > 0 || !plan.empty() || oci.IsReference(*outputDir) {
+			return fmt.Errorf("--dest can't be combined with --mirror, --with-volume, --with-inspect, --quiesce, or an oci:// output")
+		}
+		if *nameByHash || *signKey != "" || *dictionary != "" {
+			return fmt.Errorf("--name-by-hash, --sign-key, and --dictionary need a local --output directory")
+		}
+	}
+	for _, mirror := range mirrorDirs {
+		if storage.IsLocation(mirror) {
+			if _, _, err := storage.Open(mirror); err != nil {
+				return fmt.Errorf("invalid --mirror %q: %w", mirror, err)
+			}
+		}
+	}
+	if *sensitive {
+		if *format != backup.FormatPlain {
+			return fmt.Errorf("--scan-sensitive needs --format plain")
+		}
+		if content == backup.ContentSchema {
+			return fmt.Errorf("--scan-sensitive has no data to scan in a --schema-only dump")
+		}
+		if *scanRows < 1 {
+			return fmt.Errorf("--scan-rows must be at least 1")
+		}
+		if len(recipients) > 0 && os.Getenv(identityEnvVar) == "" {
+			return fmt.Errorf("--scan-sensitive reads the dump back, which needs $%s to decrypt it with --encrypt-recipient", identityEnvVar)
+		}
+	} else {
+		*scanRows = 0
+	}
+	if *allDatabases {
+		if flagWasSet(fs, "database", "d") {
+			return fmt.Errorf("--all-databases can't be combined with --database")
+		}
+		if len(excluded) > 0 || len(tables) > 0 || len(teeLocations) > 0 || !plan.empty() || oci.IsReference(*outputDir) {
+			return fmt.Errorf("--all-databases can't be combined with --exclude-column, --table, --tee, --with-volume, --with-inspect, --quiesce, or an oci:// output")
+		}
+		// Skipped runs are recorded without a database
+		*dbName = ""
+	}
+
+	blackouts, err := schedule.ParseBlackouts(blackoutSpecs)
+	if err != nil {
+		return err
+	}
+	cat := catalog.Open(*catalogPath)
+
+	reason, err := handleBlackout(blackouts, *blackoutAction)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		fmt.Printf("Skipping backup: %s\n", reason)
+		outcome.Skipped = reason
+		skipped, err := cat.Add(catalog.Entry{
+			Kind:          catalog.KindSkipped,
+			ContainerName: *containerName,
+			DatabaseName:  *dbName,
+			Tags:          tags,
+			Note:          reason,
+			Meta:          meta,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record skipped backup in catalog: %w", err)
+		}
+		reportInventory(inventory, skipped)
+		return nil
+	}
+
+	headers, err := parseHeaders("--tee-header", teeHeaders)
+	if err != nil {
+		return err
+	}
+	var tees []backup.Tee
+	for _, location := range teeLocations {
+		tee, err := newTee(location, headers, *dbName)
+		if err != nil {
+			return err
+		}
+		tees = append(tees, tee)
+	}
 
 	// Initialize services
-	dockerSvc := docker.NewService()
+	dockerSvc, err := newDatabaseService(*host, *noDockerSocket)
+	if err != nil {
+		return err
+	}
+	run, err := trackRun(control.Open(*controlDir), control.Run{
+		ID:        clock.UUIDv7Generator{}.NewID(),
+		Container: *containerName,
+		Database:  *dbName,
+		Tags:      tags,
+	})
+	if err != nil {
+		return err
+	}
+	defer run.finish()
+	outcome.RunID = run.id
+	runLog, err := runlog.Open(*logDir).Create(run.id)
+	if err != nil {
+		return err
+	}
+	defer func() { runLog.Close(runErr) }()
+	if err := runLog.Capture(); err != nil {
+		return err
+	}
+	fmt.Printf("Run ID: %s\n", run.id)
+	backup.SetRunID(run.id)
+	notifyOpts.send(notify.Event{Starting: true, Name: *jobName, Container: *containerName, Database: *dbName, RunID: run.id})
+	dockerSvc = withContext(dockerSvc, run.ctx)
 	backupSvc := backup.NewService(dockerSvc)
+	backupSvc.SetEvents(logEvents{log: runLog})
 
 	// Verify container exists
 	fmt.Printf("Verifying container '%s' exists...\n", *containerName)
@@ -41,62 +322,631 @@ func runBackup(args []string) error {
 		return fmt.Errorf("container verification failed: %w", err)
 	}
 
+	if *allDatabases {
+		return backupAllDatabases(backupSvc, cat, backup.Config{
+			ContainerName:     *containerName,
+			DatabaseUser:      *dbUser,
+			OutputDir:         *outputDir,
+			Destination:       *dest,
+			Format:            *format,
+			Jobs:              *jobs,
+			Content:           content,
+			ExcludeTables:     excludeTables,
+			NameByHash:        *nameByHash,
+			Compression:       *compression,
+			CompressionLevel:  *compressionLevel,
+			CompressThreads:   *compressThreads,
+			EncryptRecipients: recipients,
+			GPGRecipients:     gpgRecipients,
+			SignKey:           *signKey,
+			Dictionary:        *dictionary,
+			Globals:           *globals,
+			TableDigests:      *tableDigests,
+		}, allDatabasesRun{tags: tags, note: *note, meta: meta, mirrorDirs: mirrorDirs, inventory: inventory, scanRows: *scanRows, run: run, retention: policy})
+	}
+
+	// Registry pushes dump to a scratch directory first
+	destination := *outputDir
+	pushRef := ""
+	if oci.IsReference(*outputDir) {
+		ref, err := oci.ParseReference(*outputDir)
+		if err != nil {
+			return err
+		}
+		if !plan.empty() {
+			return fmt.Errorf("--with-volume, --with-inspect, and --quiesce need a local --output directory")
+		}
+		if *format != backup.FormatPlain {
+			return fmt.Errorf("--format %s backups can't be pushed to a registry", *format)
+		}
+		if content != "" {
+			return fmt.Errorf("--schema-only and --data-only backups can't be pushed to a registry")
+		}
+		if *globals || *dictionary != "" {
+			return fmt.Errorf("--globals and --dictionary need a local --output directory")
+		}
+		if *compression != backup.CompressionGzip {
+			return fmt.Errorf("--compression %s backups can't be pushed to a registry", *compression)
+		}
+		if len(recipients) > 0 || len(gpgRecipients) > 0 {
+			return fmt.Errorf("--encrypt-recipient and --gpg-recipient backups can't be pushed to a registry")
+		}
+		if *signKey != "" {
+			return fmt.Errorf("--sign-key needs a local --output directory to store the signature in")
+		}
+		pushRef = *outputDir
+		destination = registryHost(ref)
+		scratch, err := backup.MkdirScratch("oci-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(scratch)
+		*outputDir = scratch
+	}
+	if *dest != "" {
+		destination = remoteHost(*dest)
+	}
+
 	// Perform backup
+	if last, ok, err := cat.Latest(catalog.Filter{Kind: catalog.KindBackup, DatabaseName: *dbName}.Match); err == nil && ok {
+		printEstimate(throughput.OpBackup, *containerName, destination, last.Size)
+	}
+	resume := func() {}
+	if len(plan.quiesce) > 0 {
+		if resume, err = plan.pause(); err != nil {
+			return err
+		}
+	}
 	fmt.Println("Starting backup...")
+	timestamp := backupSvc.Now()
+	started := time.Now()
+	var teeResults []backup.TeeResult
+	duplicate := false
 	outputPath, err := backupSvc.Backup(backup.Config{
-		ContainerName: *containerName,
-		DatabaseName:  *dbName,
-		DatabaseUser:  *dbUser,
-		OutputDir:     *outputDir,
-		Timestamp:     time.Now(),
+		ContainerName:     *containerName,
+		DatabaseName:      *dbName,
+		DatabaseUser:      *dbUser,
+		OutputDir:         *outputDir,
+		Destination:       *dest,
+		Timestamp:         timestamp,
+		Format:            *format,
+		Jobs:              *jobs,
+		Content:           content,
+		Tables:            tables,
+		ExcludeTables:     excludeTables,
+		ExcludeColumns:    excluded,
+		NameByHash:        *nameByHash,
+		Compression:       *compression,
+		CompressionLevel:  *compressionLevel,
+		CompressThreads:   *compressThreads,
+		EncryptRecipients: recipients,
+		GPGRecipients:     gpgRecipients,
+		SignKey:           *signKey,
+		Dictionary:        *dictionary,
+		Globals:           *globals,
+		TableDigests:      *tableDigests,
+		Tees:              tees,
+		OnTee:             func(r backup.TeeResult) { teeResults = append(teeResults, r) },
+		OnDuplicate:       func(string) { duplicate = true },
 	})
+	if err == nil {
+		// An identical backup already stored keeps its files
+		if err = plan.take(*outputDir, timestamp, tags, *note, meta); err != nil && !duplicate {
+			backup.RemoveBackup(outputPath)
+			if *globals {
+				backup.RemoveBackup(backup.GlobalsPath(outputPath))
+			}
+		}
+	}
+	resume()
 	if err != nil {
+		failure := catalog.Entry{
+			ID:            run.id,
+			ContainerName: *containerName,
+			DatabaseName:  *dbName,
+			CreatedAt:     timestamp,
+			Duration:      time.Since(started),
+			Tags:          tags,
+			Meta:          meta,
+		}
+		if c, ok := run.cancellation(); ok {
+			recordCancellation(cat, failure, c)
+			return fmt.Errorf("backup cancelled by %s", c.By)
+		}
+		recordFailure(cat, failure, err)
 		return fmt.Errorf("backup failed: %w", err)
 	}
 
 	fmt.Printf("Backup completed successfully: %s\n", outputPath)
+	outcome.Backup = outputPath
+	if *globals {
+		fmt.Printf("Globals: %s\n", backup.GlobalsPath(outputPath))
+	}
+	if size, err := backup.BackupSize(outputPath); err == nil {
+		outcome.Size = size
+		recordThroughput(throughput.OpBackup, *containerName, destination, size, started)
+		recordUsage(usage.OpBackup, size, duplicate)
+	}
+	for _, r := range teeResults {
+		if r.Err == nil {
+			recordThroughput(throughput.OpUpload, localHost(), remoteHost(r.Location), r.Size, started)
+		}
+	}
+
+	record := catalog.Entry{
+		ID:            run.id,
+		Path:          outputPath,
+		ContainerName: *containerName,
+		DatabaseName:  *dbName,
+		CreatedAt:     timestamp,
+		Duration:      time.Since(started),
+		Tags:          tags,
+		Note:          *note,
+		Meta:          meta,
+	}
+	if *sensitive {
+		if record.SensitiveScan, err = scanSensitive(outputPath, *scanRows); err != nil {
+			return err
+		}
+	}
+	if !plan.empty() {
+		record.Group = clock.UUIDv7Generator{}.NewID()
+	}
+	if pushRef != "" {
+		pinned, layer, err := pushBackup(pushRef, outputPath, *dbName)
+		if err != nil {
+			return err
+		}
+		record.Path = pinned.String()
+		record.Size = layer.Size
+		record.Checksum = strings.TrimPrefix(layer.Digest, "sha256:")
+	}
+
+	entry, err := recordBackup(cat, record)
+	if err != nil {
+		return fmt.Errorf("failed to record backup in catalog: %w", err)
+	}
+	fmt.Printf("Catalog ID: %s\n", entry.ID)
+	if entry.Group != "" {
+		if err := plan.record(cat, entry.Group); err != nil {
+			return err
+		}
+		fmt.Printf("Group ID: %s\n", entry.Group)
+	}
+	reportInventory(inventory, entry)
+
+	teeErr := recordTees(cat, entry, teeResults)
+
+	if len(mirrorDirs) > 0 {
+		fmt.Printf("Replicating backup to %d mirror(s)...\n", len(mirrorDirs))
+		if err := backupSvc.Mirror(outputPath, mirrorDirs); err != nil {
+			return fmt.Errorf("replication failed: %w", err)
+		}
+		if *globals {
+			if err := backupSvc.Mirror(backup.GlobalsPath(outputPath), mirrorDirs); err != nil {
+				return fmt.Errorf("replication of globals failed: %w", err)
+			}
+		}
+		if *dictionary != "" {
+			if err := mirrorDictionary(backupSvc, *dictionary, mirrorDirs); err != nil {
+				return err
+			}
+		}
+		fmt.Println("✓ Mirror copies verified")
+	}
+	if teeErr == nil {
+		pruneAfterBackup(cat, policy, entry)
+	}
+	return teeErr
+}
+
+// recordTees reports each tee's outcome and catalogs the copies that
+// landed. The local backup stands either way; a failed copy only makes the
+// run exit non-zero.
+func recordTees(cat *catalog.Catalog, local catalog.Entry, results []backup.TeeResult) error {
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(os.Stderr, "✗ Copy to %s failed: %v\n", r.Location, r.Err)
+			failed++
+			continue
+		}
+		copyEntry := local
+		copyEntry.ID = ""
+		copyEntry.Path = r.Path
+		copyEntry.Size = r.Size
+		copyEntry.Checksum = r.SHA256
+		recorded, err := cat.Add(copyEntry)
+		if err != nil {
+			return fmt.Errorf("failed to record copy in catalog: %w", err)
+		}
+		fmt.Printf("✓ Streamed copy to %s (catalog ID: %s)\n", r.Path, recorded.ID)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d streamed copies failed", failed, len(results))
+	}
 	return nil
 }
 
 func runRestore(args []string) error {
+	if len(args) > 0 && args[0] == "plan" {
+		return runRestorePlan(args[1:])
+	}
 	fs := flag.NewFlagSet("restore", flag.ExitOnError)
-	containerName := fs.String("container", "", "Docker container name (required)")
+	containerName := fs.String("container", "", "Docker container name (required unless --host is set)")
 	fs.StringVar(containerName, "c", "", "Docker container name (shorthand)")
-	backupPath := fs.String("file", "", "Backup file path (required)")
-	fs.StringVar(backupPath, "f", "", "Backup file path (shorthand)")
+	host := fs.String("host", "", hostFlagUsage)
+	noDockerSocket := fs.Bool("no-docker-socket", false, noDockerSocketUsage)
+	backupPath := fs.String("file", "", "Backup file path, http(s) URL, s3:// or sftp:// location, or oci:// reference")
+	fs.StringVar(backupPath, "f", "", "Backup file path, http(s) URL, s3:// or sftp:// location, or oci:// reference (shorthand)")
+	var headers stringList
+	fs.Var(&headers, "header", "HTTP header sent when --file is a URL, as \"Name: value\" (repeatable)")
+	headerFile := fs.String("header-file", "", "File of --header lines, kept off the command line")
+	expectedSHA := fs.String("sha256", "", "Expected SHA-256 of a downloaded backup (default: read \"<url>.sha256\")")
 	dbName := fs.String("database", "postgres", "Database name")
 	fs.StringVar(dbName, "d", "postgres", "Database name (shorthand)")
 	dbUser := fs.String("user", "postgres", "Database user")
 	fs.StringVar(dbUser, "u", "postgres", "Database user (shorthand)")
 	dropExisting := fs.Bool("drop", false, "Drop existing database before restore")
+	merge := fs.Bool("merge", false, "Restore into a database that already holds tables or rows, without --drop")
+	var protect stringList
+	fs.Var(&protect, "protect", "Container name pattern to protect from restores (repeatable)")
+	override := fs.Bool("i-know-what-im-doing", false, "Allow restoring into a protected container")
+	assumeYes := fs.Bool("yes", false, "Skip confirmation prompts")
+	fs.BoolVar(assumeYes, "y", false, "Skip confirmation prompts (shorthand)")
+	noUndo := fs.Bool("no-undo", false, "Don't take an undo backup before --drop")
+	undoLast := fs.Bool("undo-last", false, "Roll back the last --drop restore using its undo point")
+	undoDir := fs.String("undo-dir", "./backups/undo", "Directory for undo backups")
+	catalogPath := fs.String("catalog", catalog.DefaultPath, "Backup catalog file")
+	backupID := fs.String("id", "", "Restore the backup with this catalog ID (or unique prefix)")
+	backupTag := fs.String("tag", "", "Restore the newest backup with this tag")
+	group := fs.String("group", "", "Restore the database backup and volume archives taken together under this group ID")
+	createImage := fs.String("create-container", "", "Create a fresh container from this PostgreSQL image (e.g. postgres:16) and restore into it")
+	newName := fs.String("name", "", "Name of the container --create-container creates (default \"restored-<database>\")")
+	var publish stringList
+	fs.Var(&publish, "publish", "Port mapping for --create-container as [ip:]host:container, e.g. 5433:5432 (repeatable)")
+	startupTimeout := fs.Duration("startup-timeout", 2*time.Minute, "How long to wait for a --create-container server to accept connections")
+	synthesize := fs.Bool("synthesize", false, "Restore only the schema, then fill every table with generated rows")
+	synthRows := fs.Int("rows", 1000, "Rows generated per table with --synthesize")
+	jobs := fs.Int("jobs", 1, "Restore a custom or directory-format dump with this many parallel pg_restore jobs")
+	maxConnections := fs.Int("max-restore-connections", 0, "Open at most this many connections, and cut --jobs to the slots the server has free (default 0, no limit)")
+	var rate byteSize
+	fs.Var(&rate, "restore-rate", "Feed the dump to psql or pg_restore at most this fast per second, e.g. 20MB (default no limit)")
+	withGlobals := fs.Bool("globals", false, "Replay the roles and tablespaces taken with the backup (backup --globals) first; on by default with --create-container when they exist")
+	var identities stringList
+	fs.Var(&identities, "identity-file", "age identity file to decrypt an encrypted backup with (repeatable; default $"+identityEnvVar+")")
+	requireSignature := fs.Bool("require-signature", false, "Refuse to restore a backup without a valid detached GPG signature (signed backups are always checked)")
+	var verifyKeys stringList
+	fs.Var(&verifyKeys, "verify-key", "GPG key signatures must be made by: a fingerprint, key ID, or user ID (repeatable; required with --require-signature)")
+	validateOnly := fs.Bool("validate-only", false, "Only check the backup loads, in a scratch database dropped afterwards, leaving --database untouched")
+	fixSequences := fs.Bool("fix-sequences", false, "Move sequences the restore left at or below their column's largest value past it")
+	refreshViews := fs.Bool("refresh-matviews", false, "Refresh every materialized view after the restore, in dependency order")
+	refreshConcurrently := fs.Bool("refresh-concurrently", false, "Refresh materialized views with a unique index CONCURRENTLY, not locking out readers; implies --refresh-matviews")
+	updateExtensions := fs.Bool("update-extensions", false, "Run ALTER EXTENSION ... UPDATE on extensions the server ships a newer version of")
+	tlsOpts := addTLSFlags(fs)
 
-	if err := fs.Parse(args); err != nil {
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := tlsOpts.apply(); err != nil {
 		return err
 	}
+	useIdentityFiles(identities)
 
-	if *containerName == "" || *backupPath == "" {
-		fmt.Fprintln(os.Stderr, "Error: --container and --file flags are required")
+	sources := 0
+	for _, set := range []bool{*backupPath != "", *backupID != "", *backupTag != "", *group != "", *undoLast} {
+		if set {
+			sources++
+		}
+	}
+	if (*containerName == "" && *host == "" && *createImage == "") || sources == 0 {
+		fmt.Fprintln(os.Stderr, "Error: --container, --host, or --create-container, and one of --file, --id, --tag, --group, or --undo-last are required")
 		fs.Usage()
 		return fmt.Errorf("missing required flags")
 	}
+	if *validateOnly && (*dropExisting || *undoLast || *group != "" || *createImage != "" || *synthesize || *withGlobals) {
+		return fmt.Errorf("--validate-only can't be combined with --drop, --undo-last, --group, --create-container, --synthesize, or --globals")
+	}
+	if *merge && (*dropExisting || *undoLast || *validateOnly || *createImage != "") {
+		return fmt.Errorf("--merge can't be combined with --drop, --undo-last, --validate-only, or --create-container")
+	}
+	if *createImage != "" {
+		if *containerName != "" || *host != "" || *undoLast {
+			return fmt.Errorf("--create-container can't be combined with --container, --host, or --undo-last")
+		}
+		if dockerSocketDisabled(*noDockerSocket) {
+			return fmt.Errorf("--create-container needs docker, which --no-docker-socket disables")
+		}
+		*containerName = *newName
+		if *containerName == "" {
+			*containerName = "restored-" + *dbName
+		}
+		// A brand-new server has nothing to drop or undo
+		*dropExisting = false
+	} else if *newName != "" || len(publish) > 0 {
+		return fmt.Errorf("--name and --publish are only used with --create-container")
+	}
+	if *containerName == "" {
+		*containerName = *host
+	}
+	if sources > 1 {
+		return fmt.Errorf("--file, --id, --tag, --group, and --undo-last are mutually exclusive")
+	}
+	if *synthesize && (*group != "" || *undoLast) {
+		return fmt.Errorf("--synthesize can't be combined with --group or --undo-last")
+	}
+	if *maxConnections < 0 {
+		return fmt.Errorf("--max-restore-connections can't be negative")
+	}
+	if *requireSignature && len(verifyKeys) == 0 {
+		return fmt.Errorf("--require-signature needs --verify-key to say whose signatures to trust")
+	}
+
+	cat := catalog.Open(*catalogPath)
+	var resolved *catalog.Entry
+	catalogID := ""
+	if *undoLast {
+		point, err := latestUndoPoint(cat, *containerName, *dbName)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rolling back to undo point %s taken at %s\n", point.ID, point.CreatedAt.Format(time.RFC3339))
+		if err := verifyCatalogChecksum(point); err != nil {
+			return err
+		}
+		*backupPath = point.Path
+		catalogID = point.ID
+		*dropExisting = true
+	}
+	if *backupID != "" || *backupTag != "" {
+		entry, err := resolveCatalogBackup(cat, *backupID, *backupTag)
+		if err != nil {
+			return err
+		}
+		if !flagWasSet(fs, "database", "d") {
+			*dbName = entry.DatabaseName
+		}
+		fmt.Printf("Resolved catalog entry %s: %s\n", entry.ID, entry.Path)
+		resolved = &entry
+		catalogID = entry.ID
+		*backupPath = entry.Path
+	}
+	var members []catalog.Entry
+	if *group != "" {
+		entry, rest, err := groupMembers(cat, *group)
+		if err != nil {
+			return err
+		}
+		if len(rest) > 0 && dockerSocketDisabled(*noDockerSocket) {
+			return fmt.Errorf("group %s has volume archives, which need docker; --no-docker-socket disables it", *group)
+		}
+		if !flagWasSet(fs, "database", "d") {
+			*dbName = entry.DatabaseName
+		}
+		fmt.Printf("Resolved group %s: %s and %d other artifact(s)\n", *group, entry.Path, len(rest))
+		resolved = &entry
+		catalogID = entry.ID
+		*backupPath = entry.Path
+		members = rest
+	}
+
+	if backup.IsVolumeArchive(*backupPath) {
+		return fmt.Errorf("%s is a volume archive; restore it with `volume restore`", *backupPath)
+	}
+
+	globalsPath := ""
+	if *withGlobals || *createImage != "" {
+		path := backup.GlobalsPath(*backupPath)
+		if backup.BackupExists(path) && !isRemoteBackup(*backupPath) {
+			globalsPath = path
+		} else if *withGlobals {
+			return fmt.Errorf("--globals: no globals file next to %s (expected %s)", *backupPath, path)
+		}
+	}
+
+	// A data-only dump needs the target's schema. Its name says so, here
+	// for a file or URL and after the pull for a registry artifact.
+	contentConflict := func(path string) error {
+		if backup.DumpContent(path) == backup.ContentData && (*dropExisting || *createImage != "" || *synthesize) {
+			return fmt.Errorf("%s is a data-only dump; it loads into an existing database's schema, so it can't be combined with --drop, --create-container, or --synthesize", path)
+		}
+		return nil
+	}
+	if err := contentConflict(*backupPath); err != nil {
+		return err
+	}
+
+	// Asked before a remote backup is fetched, so a declined restore
+	// doesn't download it first
+	if err := guardProtectedTarget(*containerName, *dbName, protectedPatterns(protect), *override); err != nil {
+		return err
+	}
+	source := *backupPath
+	if *dropExisting {
+		descriptions := []string{
+			fmt.Sprintf("database '%s' in container '%s' will be dropped", *dbName, *containerName),
+			fmt.Sprintf("it will be replaced with the contents of %s", source),
+		}
+		for _, m := range members {
+			if m.Kind == catalog.KindVolume {
+				descriptions = append(descriptions, fmt.Sprintf("every file in volume '%s' will be replaced with %s", m.Volume, m.Path))
+			}
+		}
+		if err := confirmDestructive(*assumeYes, descriptions...); err != nil {
+			return err
+		}
+	}
+
+	if isRemoteBackup(*backupPath) {
+		specs, err := withHeaderFile(headers, *headerFile)
+		if err != nil {
+			return err
+		}
+		localPath, cleanup, err := fetchRemoteBackup(*backupPath, specs, *expectedSHA)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		*backupPath = localPath
+	}
+	if resolved != nil {
+		resolved.Path = *backupPath
+		if err := verifyCatalogChecksum(*resolved); err != nil {
+			return err
+		}
+	}
+
+	if hashed, err := backup.VerifyContentAddress(*backupPath); err != nil {
+		return fmt.Errorf("integrity check failed: %w", err)
+	} else if hashed {
+		fmt.Println("✓ Content hash matches file name")
+	}
+	if err := checkSignatures(*backupPath, globalsPath, *requireSignature, verifyKeys); err != nil {
+		return fmt.Errorf("refusing to restore: %w", err)
+	}
+	if err := contentConflict(*backupPath); err != nil {
+		return err
+	}
+
+	dataOnly := false
+	switch backup.DumpContent(*backupPath) {
+	case backup.ContentData:
+		dataOnly = true
+		fmt.Println("Backup holds data only; loading it into the existing schema")
+	case backup.ContentSchema:
+		if !*synthesize {
+			fmt.Println("Backup holds the schema only; the restored tables will be empty")
+		}
+	}
+
+	var created *restoreContainer
+	if *createImage != "" {
+		c, err := createRestoreContainer(*createImage, *containerName, *dbUser, publish, *startupTimeout)
+		if err != nil {
+			return err
+		}
+		created = c
+	}
 
 	// Initialize services
-	dockerSvc := docker.NewService()
+	dockerSvc, err := newDatabaseService(*host, *noDockerSocket)
+	if err != nil {
+		return err
+	}
 	backupSvc := backup.NewService(dockerSvc)
 
+	// Without --drop the dump loads on top of whatever is there
+	if !*dropExisting && !*validateOnly && created == nil {
+		if err := guardNonEmptyTarget(backupSvc, *containerName, *dbName, *dbUser, dataOnly, *merge); err != nil {
+			return err
+		}
+	}
+
+	// Take an undo point before dropping anything
+	if *dropExisting && !*noUndo && !*undoLast {
+		if err := takeUndoPoint(backupSvc, cat, *containerName, *dbName, *dbUser, *undoDir); err != nil {
+			return fmt.Errorf("failed to take undo backup (use --no-undo to skip): %w", err)
+		}
+	}
+
 	// Perform restore
-	fmt.Printf("Restoring backup to container '%s'...\n", *containerName)
-	if err := backupSvc.Restore(backup.RestoreConfig{
-		ContainerName: *containerName,
-		DatabaseName:  *dbName,
-		DatabaseUser:  *dbUser,
-		BackupPath:    *backupPath,
-		DropExisting:  *dropExisting,
-	}); err != nil {
+	restoreSize, _ := backup.BackupSize(*backupPath)
+	printEstimate(throughput.OpRestore, localHost(), *containerName, restoreSize)
+	if globalsPath != "" {
+		fmt.Printf("Replaying roles and tablespaces from %s\n", globalsPath)
+	}
+	if *validateOnly {
+		fmt.Printf("Validating backup in container '%s'...\n", *containerName)
+	} else {
+		fmt.Printf("Restoring backup to container '%s'...\n", *containerName)
+	}
+	started := time.Now()
+	err = backupSvc.Restore(backup.RestoreConfig{
+		ContainerName:  *containerName,
+		DatabaseName:   *dbName,
+		DatabaseUser:   *dbUser,
+		BackupPath:     *backupPath,
+		DropExisting:   *dropExisting,
+		Jobs:           *jobs,
+		SchemaOnly:     *synthesize,
+		Globals:        globalsPath,
+		MaxConnections: *maxConnections,
+		BytesPerSecond: int64(rate),
+		ValidateOnly:   *validateOnly,
+	})
+	if *validateOnly {
+		// Nothing was loaded anywhere that stays
+		recordAccess(audit.ActionRead, source, catalogID, "", err)
+		if err != nil {
+			return fmt.Errorf("validation failed: %w", err)
+		}
+		fmt.Printf("✓ %s loads cleanly; nothing was restored\n", source)
+		return nil
+	}
+	recordAccess(audit.ActionRestore, source, catalogID, restoreTarget(*containerName, *dbName), err)
+	if err != nil {
+		if created != nil {
+			fmt.Printf("Removing container '%s'...\n", *containerName)
+			created.remove()
+		}
 		return fmt.Errorf("restore failed: %w", err)
 	}
+	recordThroughput(throughput.OpRestore, localHost(), *containerName, restoreSize, started)
+	recordUsage(usage.OpRestore, restoreSize, false)
 
+	if err := restoreGroupVolumes(members, *dropExisting); err != nil {
+		return err
+	}
+	var synthErr error
+	if *synthesize {
+		synthErr = synthesizeData(backupSvc, *containerName, *dbName, *dbUser, *synthRows)
+	}
+	var recorded map[string]string
+	if m, err := backup.ReadManifest(*backupPath); err == nil && m != nil {
+		recorded = m.Extensions
+	}
+	if err := checkExtensions(backupSvc, *containerName, *dbName, *dbUser, recorded, *updateExtensions); err != nil {
+		return err
+	}
+	if err := checkSequences(backupSvc, *containerName, *dbName, *dbUser, *fixSequences); err != nil {
+		return err
+	}
+	if err := refreshMaterializedViews(backupSvc, *containerName, *dbName, *dbUser, *refreshViews || *refreshConcurrently, *refreshConcurrently); err != nil {
+		return err
+	}
 	fmt.Println("Restore completed successfully")
+	if created != nil {
+		created.printConnection(*dbName)
+	}
+	return synthErr
+}
+
+// synthesizeData fills a schema-only restore with generated rows and
+// reports each table. Tables that rejected their rows make it return an
+// error once the rest are filled.
+func synthesizeData(backupSvc *backup.Service, containerName, dbName, dbUser string, rows int) error {
+	fmt.Printf("Generating %d rows per table...\n", rows)
+	result, err := backupSvc.Synthesize(backup.SynthesizeConfig{
+		ContainerName: containerName,
+		DatabaseName:  dbName,
+		DatabaseUser:  dbUser,
+		Rows:          rows,
+	})
+	if err != nil {
+		return fmt.Errorf("data generation failed: %w", err)
+	}
+	for _, t := range result.Tables {
+		fmt.Printf("  %s: %d rows\n", t.Table, t.Rows)
+	}
+	for _, s := range result.Skipped {
+		fmt.Printf("  skipped %s\n", s)
+	}
+	for _, f := range result.Failed {
+		fmt.Fprintf(os.Stderr, "✗ %s\n", f)
+	}
+	if len(result.Failed) > 0 {
+		return fmt.Errorf("%d table(s) rejected their generated rows", len(result.Failed))
+	}
 	return nil
 }
 
@@ -110,8 +960,29 @@ func runVerify(args []string) error {
 	fs.StringVar(dbName, "d", "postgres", "Database name (shorthand)")
 	dbUser := fs.String("user", "postgres", "Database user")
 	fs.StringVar(dbUser, "u", "postgres", "Database user (shorthand)")
+	allDatabases := fs.Bool("all-databases", false, "Verify every database present in both containers")
+	parallel := fs.Int("parallel", 4, "Number of databases to verify concurrently with --all-databases")
+	mode := fs.String("mode", backup.VerifyModeChecksum, "Comparison mode: checksum, rowcount, or sampled")
+	samplePercent := fs.Int("sample-percent", 10, "Percentage of rows compared in sampled mode")
+	var ignoreTables stringList
+	fs.Var(&ignoreTables, "ignore-table", "Leave this table out of the comparison, as table or schema.table (repeatable)")
+	diffFile := fs.String("diff-file", "", "Write the differing tables, row counts, and sample divergent keys to this JSON file")
+	failThreshold := fs.Int64("fail-threshold", 0, "Pass as long as at most this many rows differ (rowcount and sampled modes)")
+	maxDuration := fs.Duration("max-duration", 0, "Stop comparing tables after this long; the next run resumes where this one stopped")
+	progressFile := fs.String("progress-file", "", "File recording per-table progress with --max-duration (default ./backups/.verify/<source>_<target>_<database>.json)")
+	watch := fs.Bool("watch", false, "Keep verifying on an interval instead of running once")
+	interval := fs.Duration("interval", 10*time.Minute, "How often to verify with --watch")
+	metricsAddr := fs.String("metrics-addr", "", "Address to serve Prometheus metrics on with --watch (e.g. :9188)")
+	jobName := fs.String("job-name", "", "Name used to pause/resume --watch (default \"verify-<target>\")")
+	controlDir := fs.String("control-dir", control.DefaultDir, "Directory holding job pause markers")
+	var blackoutSpecs stringList
+	fs.Var(&blackoutSpecs, "blackout", "Blackout window for --watch as \"<cron> <duration>\" (repeatable)")
+	alertCooldown := fs.Duration("alert-cooldown", 0, "With --watch, suppress an alert identical to the last one for this long")
+	escalateAfter := fs.Int("escalate-after", 0, "With --watch, run --escalate-command after this many failed runs in a row")
+	escalateCommand := fs.String("escalate-command", "", "Shell command alerting a second channel, e.g. a pager")
+	catalogPath := fs.String("catalog", catalog.DefaultPath, "Catalog file verification results are recorded in")
 
-	if err := fs.Parse(args); err != nil {
+	if err := parseFlags(fs, args); err != nil {
 		return err
 	}
 
@@ -121,26 +992,128 @@ func runVerify(args []string) error {
 		return fmt.Errorf("missing required flags")
 	}
 
+	blackouts, err := schedule.ParseBlackouts(blackoutSpecs)
+	if err != nil {
+		return err
+	}
+	if *alertCooldown < 0 || *escalateAfter < 0 {
+		return fmt.Errorf("--alert-cooldown and --escalate-after can't be negative")
+	}
+	if (*escalateAfter > 0) != (*escalateCommand != "") {
+		return fmt.Errorf("--escalate-after and --escalate-command must be used together")
+	}
+
 	// Initialize services
-	dockerSvc := docker.NewService()
+	dockerSvc, err := newDatabaseService("", false)
+	if err != nil {
+		return err
+	}
 	backupSvc := backup.NewService(dockerSvc)
 
-	// Perform verification
-	fmt.Printf("Verifying databases match between '%s' and '%s'...\n", *sourceContainer, *targetContainer)
-	match, err := backupSvc.Verify(backup.VerifyConfig{
+	if *failThreshold < 0 {
+		return fmt.Errorf("--fail-threshold can't be negative")
+	}
+	var ignored []string
+	for _, name := range ignoreTables {
+		ignored = append(ignored, subset.QualifiedName(name))
+	}
+	if (*diffFile != "" || *failThreshold > 0) && (*mode == "" || *mode == backup.VerifyModeChecksum) {
+		return fmt.Errorf("--diff-file and --fail-threshold need --mode rowcount or sampled")
+	}
+
+	if *maxDuration < 0 {
+		return fmt.Errorf("--max-duration can't be negative")
+	}
+	if *maxDuration > 0 {
+		if *mode == "" || *mode == backup.VerifyModeChecksum {
+			return fmt.Errorf("--max-duration needs --mode rowcount or sampled")
+		}
+		if *watch || *allDatabases {
+			return fmt.Errorf("--max-duration can't be combined with --watch or --all-databases")
+		}
+		if *progressFile == "" {
+			*progressFile = filepath.Join("backups", ".verify", fmt.Sprintf("%s_%s_%s.json", *sourceContainer, *targetContainer, *dbName))
+		}
+	}
+
+	if *allDatabases {
+		if *diffFile != "" || *failThreshold > 0 {
+			return fmt.Errorf("--diff-file and --fail-threshold can't be combined with --all-databases")
+		}
+		return runVerifyAll(backupSvc, backup.VerifyAllConfig{
+			SourceContainer: *sourceContainer,
+			TargetContainer: *targetContainer,
+			DatabaseUser:    *dbUser,
+			Parallelism:     *parallel,
+			Mode:            *mode,
+			SamplePercent:   *samplePercent,
+			IgnoreTables:    ignored,
+		})
+	}
+
+	cfg := backup.VerifyConfig{
 		SourceContainer: *sourceContainer,
 		TargetContainer: *targetContainer,
 		DatabaseName:    *dbName,
 		DatabaseUser:    *dbUser,
-	})
+		Mode:            *mode,
+		SamplePercent:   *samplePercent,
+		IgnoreTables:    ignored,
+		DiffRows:        *diffFile != "",
+		FailThreshold:   *failThreshold,
+		MaxDuration:     *maxDuration,
+		ProgressFile:    *progressFile,
+	}
+
+	if *watch {
+		if *jobName == "" {
+			*jobName = "verify-" + *targetContainer
+		}
+		return runVerifyWatch(backupSvc, cfg, verifyWatchOptions{
+			interval:        *interval,
+			metricsAddr:     *metricsAddr,
+			jobName:         *jobName,
+			control:         control.Open(*controlDir),
+			blackouts:       blackouts,
+			catalog:         catalog.Open(*catalogPath),
+			diffFile:        *diffFile,
+			alerts:          alert.NewTracker(alert.Policy{Cooldown: *alertCooldown, EscalateAfter: *escalateAfter}),
+			escalateCommand: *escalateCommand,
+		})
+	}
+
+	// Perform verification
+	fmt.Printf("Verifying databases match between '%s' and '%s'...\n", *sourceContainer, *targetContainer)
+	result, err := backupSvc.VerifyReport(cfg)
+	if err == nil && result.Incomplete {
+		// Only finished comparisons are recorded
+		fmt.Printf("Stopped after %s with %d table(s) left; run again to resume (progress in %s)\n", *maxDuration, result.RemainingTables, *progressFile)
+		if len(result.Tables) > 0 {
+			fmt.Println("✗ Tables compared so far differ")
+			printTableMismatches(result.Tables)
+			return fmt.Errorf("database verification failed")
+		}
+		return nil
+	}
+	recordVerification(catalog.Open(*catalogPath), cfg, result, err)
 	if err != nil {
 		return fmt.Errorf("verification failed: %w", err)
 	}
+	if *diffFile != "" {
+		if err := writeVerifyDiff(*diffFile, cfg, result); err != nil {
+			return err
+		}
+		fmt.Printf("Diff written to %s\n", *diffFile)
+	}
 
-	if match {
+	if result.Match && len(result.Tables) > 0 {
+		fmt.Printf("✓ Databases differ by %d row(s), within --fail-threshold %d\n", result.DifferingRows, *failThreshold)
+		printTableMismatches(result.Tables)
+	} else if result.Match {
 		fmt.Println("✓ Databases match - verification successful")
 	} else {
 		fmt.Println("✗ Databases do not match")
+		printTableMismatches(result.Tables)
 		return fmt.Errorf("database verification failed")
 	}
 
@@ -159,8 +1132,13 @@ func runTest(args []string) error {
 	fs.StringVar(dbUser, "u", "postgres", "Database user (shorthand)")
 	outputDir := fs.String("output", "./backups", "Output directory for backup file")
 	fs.StringVar(outputDir, "o", "./backups", "Output directory for backup file (shorthand)")
+	var protect stringList
+	fs.Var(&protect, "protect", "Container name pattern to protect from restores (repeatable)")
+	override := fs.Bool("i-know-what-im-doing", false, "Allow restoring into a protected container")
+	assumeYes := fs.Bool("yes", false, "Skip confirmation prompts")
+	fs.BoolVar(assumeYes, "y", false, "Skip confirmation prompts (shorthand)")
 
-	if err := fs.Parse(args); err != nil {
+	if err := parseFlags(fs, args); err != nil {
 		return err
 	}
 
@@ -170,8 +1148,22 @@ func runTest(args []string) error {
 		return fmt.Errorf("missing required flags")
 	}
 
+	if err := guardProtectedTarget(*targetContainer, *dbName, protectedPatterns(protect), *override); err != nil {
+		return err
+	}
+
+	if err := confirmDestructive(*assumeYes,
+		fmt.Sprintf("database '%s' in target container '%s' will be dropped", *dbName, *targetContainer),
+		fmt.Sprintf("it will be replaced with a fresh backup of '%s' from '%s'", *dbName, *sourceContainer),
+	); err != nil {
+		return err
+	}
+
 	// Initialize services
-	dockerSvc := docker.NewService()
+	dockerSvc, err := newDatabaseService("", false)
+	if err != nil {
+		return err
+	}
 	backupSvc := backup.NewService(dockerSvc)
 
 	// Step 1: Backup from source
@@ -181,7 +1173,6 @@ func runTest(args []string) error {
 		DatabaseName:  *dbName,
 		DatabaseUser:  *dbUser,
 		OutputDir:     *outputDir,
-		Timestamp:     time.Now(),
 	})
 	if err != nil {
 		return fmt.Errorf("backup failed: %w", err)
@@ -231,29 +1222,194 @@ Usage:
 
 Commands:
   backup      Backup a PostgreSQL database from a Docker container
-  restore     Restore a PostgreSQL database to a Docker container
+  restore     Restore a PostgreSQL database to a Docker container, or plan a restore (restore plan)
   verify      Verify two databases contain the same data
+  verify-file Check a backup file's signature and that it reads back in full
+  info        Show how, when, and from where a backup file was taken
   test        Backup, restore, and verify in one command
+  standby     Continuously restore new backups into a standby container
+  mirrors     Check that mirror directories hold every backup
+  list        List backups recorded in the catalog
+  diff        Compare the schema and data of two backup files
+  drift       Compare a backup's schema to a live database
+  export      Write a reproducible, chunked dump for Git LFS or DVC
+  seed        Create or apply a small, masked sample database for development
+  check       Nagios/Icinga check of backup freshness and verification status
+  guard       Fail a deploy step unless migrations are covered by a tagged backup
+  preflight   Report the privileges the selected mode needs and whether they are met
+  doctor      Check for the client tools --host needs and show how to install them
+  k8s         Generate Kubernetes manifests for scheduled backups
+  serve       Serve the HTTP API with role-based tokens
+  audit       Verify or export the log of artifact reads, downloads, and restores
+  job         Pause, resume, cancel, or show the status of running jobs
+  daemon      Run the jobs of a config file on their cron schedules
+  config      Write a starter config file, or check one before it runs
+  clean       Remove scratch and partial files left behind by crashed runs
+  prune       Delete old backups, keeping the newest of each database
+  logs        List run logs, or print the full log of a backup run
+  volume      Back up or restore a docker volume's files
+  stack       Back up or restore every database and volume of a compose project
+  dictionary  Train a zstd dictionary on prior backups of small, similar databases
+  report      Summarize the opt-in local usage statistics, or chart recovery points (report rpo)
+  self-update Replace this binary with the latest signed release
+  version     Print the version of this binary
   help        Show this help message
 
 Backup Flags:
-  -c, --container string   Docker container name (required)
+  -c, --container string   Docker container name (required unless --host is set)
+  --host string            Connect to host[:port] or a socket directory with local client tools instead of docker exec
+  --no-docker-socket       Refuse to use docker; only connect with --host (default $BACKITUP_NO_DOCKER_SOCKET)
   -d, --database string    Database name (default "postgres")
+  --all-databases          Back up every database in the container, one artifact each
   -u, --user string        Database user (default "postgres")
-  -o, --output string      Output directory for backup file (default "./backups")
+  -o, --output string      Output directory, or an oci:// registry reference (default "./backups")
+  --dest string            Stream the backup to an s3://bucket/prefix or sftp://user@host/path location instead of --output
+  --format string          Dump format: plain (SQL, see --compression), custom (pg_dump -Fc, .dump), or directory (pg_dump -Fd, .dir.tar.gz) (default "plain")
+  --jobs int               Dump this many tables in parallel; implies --format directory (default 1)
+  --schema-only            Dump only the schema (pg_dump --schema-only)
+  --data-only              Dump only the data (pg_dump --data-only)
+  --table string           Dump only tables matching this pg_dump pattern, e.g. 'events_*' (repeatable)
+  --exclude-table string   Leave out tables matching this pg_dump pattern (repeatable)
+  --exclude-column string  Leave a column's values out of the dump, as [schema.]table.column (repeatable)
+  --compression string     Compression of plain dumps: gzip (.sql.gz), zstd (.sql.zst), lz4 (.sql.lz4), xz (.sql.xz), or none (.sql) (default "gzip")
+  --compression-level int  Compression level: 1-9 for gzip, xz and custom/directory dumps, 1-19 for zstd, 1-12 for lz4 (default: the algorithm's own)
+  --compress-threads int   Threads compressing a plain dump with gzip, zstd or xz (default: one per CPU)
+  --dictionary string      Compress with zstd and a trained dictionary; implies --compression zstd
+  --scan-sensitive         Sample the dump for unencrypted card numbers and SSNs, and record the findings
+  --scan-rows int          Rows sampled per table by --scan-sensitive (default 1000)
+  --encrypt-recipient string  Encrypt the backup with age for this recipient, a public key or a file of them (repeatable)
+  --gpg-recipient string   Encrypt the backup with GPG for this key ID, fingerprint, or user ID (repeatable)
+  --sign-key string        GPG key to write a detached signature with, stored as <backup>.sig
+  --globals                Also take the server's roles and tablespaces (pg_dumpall --globals-only)
+  --table-digests          Record each table's row count and digest in the manifest (plain dumps)
+  --mirror string          Secondary directory or s3:// or sftp:// location to replicate the backup to (repeatable)
+  --tee string             Also stream the backup to an http(s) URL, s3:// or sftp:// location, or oci:// reference while it is written (repeatable)
+  --tee-header string      HTTP header sent with --tee uploads (repeatable)
+  --with-volume string     Also archive this docker volume, grouped with the dump (repeatable)
+  --with-inspect string    Also snapshot this container's docker inspect config (repeatable)
+  --quiesce string         Pause this app container while the dump and volumes are taken (repeatable)
+  --tag string             Tag to attach to the backup (repeatable)
+  --note string            Free-form note to attach to the backup
+  --run-meta string        Annotate the backup with key=value, e.g. a CI run's git_sha (repeatable)
+  --catalog string         Backup catalog file (default "./backups/catalog.json")
+  --control-dir string     Directory the run is registered in, for job cancel (default "./backups/.control")
+  --log-dir string         Directory the run's log is kept in, for logs (default "./backups/logs")
+  --name-by-hash           Name the backup file after its SHA-256 content hash
+  --blackout string        Blackout window as "<cron> <duration>" (repeatable)
+  --blackout-action string What to do inside a blackout window: skip or defer (default "skip")
+  --inventory-url string   Endpoint to POST the catalog entry to after the run (default $BACKITUP_INVENTORY_URL)
+  --inventory-template string Inventory payload: json, servicenow, backstage, or a template file (default "json")
+  --inventory-header string HTTP header sent to the inventory endpoint (repeatable)
+  --slack-webhook string   Slack incoming webhook URL to post the outcome of the run to
+  --notify-on string       Which runs to post: always or failure (default "always")
+  --webhook string         URL to POST the run's start or outcome to, rendered by --webhook-template
+  --webhook-template string Webhook payload: json, discord, teams, mattermost, or a template file (default "json")
+  --webhook-header string  HTTP header sent to the webhook (repeatable)
+  --webhook-events string  Events posted to the webhook: start, success, failure, skip (default "success,failure,skip")
+  --healthcheck-url string Dead man's switch to ping as the run starts (/start), succeeds, and fails (/fail)
+  --notify-cooldown duration Don't post a failure identical to the job's last one posted for this long
+  --keep-last, --keep-daily, --keep-weekly, --keep-monthly, --keep-yearly int
+  --keep-within duration, --max-total-size size, --keep-tagged glob
+                           After a successful backup, prune the database's older backups as prune does
+  --job string             Take the backup the named job in --config describes; flags given here override it
+  --config string          Config file of named jobs, for --job (default "back-it-up.yaml")
+  --ca-cert string         PEM file of a CA to trust besides the system's (repeatable; default $BACKITUP_CA_CERT)
+  --insecure-skip-verify   Don't verify TLS certificates at all (warned; for testing only)
 
 Restore Flags:
-  -c, --container string   Docker container name (required)
-  -f, --file string        Backup file path (required)
+  -c, --container string   Docker container name (required unless --host is set)
+  --host string            Connect to host[:port] or a socket directory with local client tools instead of docker exec
+  --no-docker-socket       Refuse to use docker; only connect with --host (default $BACKITUP_NO_DOCKER_SOCKET)
+  -f, --file string        Backup file path, http(s) URL, s3:// or sftp:// location, or oci:// reference
+  --header string          HTTP header sent when --file is a URL, as "Name: value" (repeatable)
+  --header-file string     File of --header lines, kept off the command line
+  --sha256 string          Expected SHA-256 of a downloaded backup (default: read "<url>.sha256")
+  --id string              Restore the backup with this catalog ID (or unique prefix)
+  --tag string             Restore the newest backup with this tag
+  --group string           Restore a database backup and its grouped volume archives
   -d, --database string    Database name (default "postgres")
   -u, --user string        Database user (default "postgres")
   --drop                   Drop existing database before restore
+  --merge                  Restore into a database that already holds tables or rows, without --drop
+  --protect string         Container name pattern to protect from restores (repeatable)
+  --i-know-what-im-doing   Allow restoring into a protected container
+  -y, --yes                Skip confirmation prompts
+  --no-undo                Don't take an undo backup before --drop
+  --undo-last              Roll back the last --drop restore using its undo point
+  --undo-dir string        Directory for undo backups (default "./backups/undo")
+  --catalog string         Backup catalog file (default "./backups/catalog.json")
+  --create-container string Create a fresh container from a PostgreSQL image (e.g. postgres:16) and restore into it
+  --name string            Name of the created container (default "restored-<database>")
+  --publish string         Port mapping for the created container, e.g. 5433:5432 (repeatable)
+  --startup-timeout duration How long to wait for the created server to accept connections (default 2m0s)
+  --synthesize             Restore only the schema, then fill every table with generated rows
+  --rows int               Rows generated per table with --synthesize (default 1000)
+  --jobs int               Restore a custom or directory-format dump with this many parallel pg_restore jobs (default 1)
+  --max-restore-connections int Open at most this many connections, and fit --jobs to the server's free slots
+  --restore-rate size      Feed the dump to psql or pg_restore at most this fast per second, e.g. 20MB
+  --globals                Replay the roles and tablespaces taken with the backup first (default with --create-container)
+  --identity-file string   age identity file to decrypt an encrypted backup with (repeatable; default $BACKITUP_AGE_IDENTITY)
+  --require-signature      Refuse backups without a valid <backup>.sig (signed backups are always checked)
+  --verify-key string      GPG key signatures must be made by (repeatable; required with --require-signature)
+  --validate-only          Only check the backup loads, in a scratch database dropped afterwards
+  --fix-sequences          Move sequences the restore left at or below their column's largest value past it
+  --refresh-matviews       Refresh every materialized view after the restore, in dependency order
+  --refresh-concurrently   Refresh those with a unique index CONCURRENTLY; implies --refresh-matviews
+  --update-extensions      Run ALTER EXTENSION ... UPDATE on extensions the server ships a newer version of
+  --ca-cert string         PEM file of a CA to trust besides the system's (repeatable; default $BACKITUP_CA_CERT)
+  --insecure-skip-verify   Don't verify TLS certificates at all (warned; for testing only)
+
+Restore Plan Flags:
+  --job string             Database, container, or tag to restore (required)
+  --target-time string     Restore the data as it was at this time, as RFC 3339, "YYYY-MM-DD hh:mm", or a date (default: now)
+  -c, --container string   Container the backup would be restored into (default: the one it was taken from)
+  --json                   Print the plan as JSON
+  --catalog string         Backup catalog file (default "./backups/catalog.json")
+
+Verify-File Flags:
+  -f, --file string        Backup file to verify (required)
+  --allow-unsigned         Only check the file's integrity if it has no signature
+  --verify-key string      GPG key the signature must be made by (repeatable)
+  --identity-file string   age identity file to decrypt an encrypted backup with (repeatable; default $BACKITUP_AGE_IDENTITY)
+  --ca-cert string         PEM file of a CA to trust besides the system's (repeatable; default $BACKITUP_CA_CERT)
+  --insecure-skip-verify   Don't verify TLS certificates at all (warned; for testing only)
+
+Info Flags:
+  -f, --file string        Backup file to describe (required)
+  --json                   Print the manifest as JSON
+  --ca-cert string         PEM file of a CA to trust besides the system's (repeatable; default $BACKITUP_CA_CERT)
+  --insecure-skip-verify   Don't verify TLS certificates at all (warned; for testing only)
 
 Verify Flags:
   -s, --source string      Source container name (required)
   -t, --target string      Target container name (required)
   -d, --database string    Database name (default "postgres")
   -u, --user string        Database user (default "postgres")
+  --all-databases          Verify every database present in both containers
+  --parallel int           Databases to verify concurrently with --all-databases (default 4)
+  --mode string            Comparison mode: checksum, rowcount, or sampled (default "checksum")
+  --sample-percent int     Percentage of rows compared in sampled mode (default 10)
+  --ignore-table string    Leave this table out of the comparison, as [schema.]table (repeatable)
+  --max-duration duration  Stop comparing tables after this long; the next run resumes where this one stopped
+  --progress-file string   File recording per-table progress with --max-duration (default "./backups/.verify/<source>_<target>_<database>.json")
+  --diff-file string       Write the differing tables, row counts, and sample divergent keys to this JSON file
+  --fail-threshold int     Pass as long as at most this many rows differ (rowcount and sampled modes)
+  --watch                  Keep verifying on an interval instead of running once
+  --interval duration      How often to verify with --watch (default 10m)
+  --metrics-addr string    Address to serve Prometheus metrics on with --watch (e.g. :9188)
+  --job-name string        Name used to pause/resume --watch (default "verify-<target>")
+  --control-dir string     Directory holding job pause markers (default "./backups/.control")
+  --blackout string        Blackout window for --watch as "<cron> <duration>" (repeatable)
+  --alert-cooldown duration  With --watch, suppress an alert identical to the last one for this long
+  --escalate-after int     With --watch, run --escalate-command after this many failed runs in a row
+  --escalate-command string  Shell command alerting a second channel, e.g. a pager
+  --catalog string         Catalog file verification results are recorded in (default "./backups/catalog.json")
+
+Check Flags:
+  --job string             Database, container, or tag whose backups are checked (required)
+  --warn duration          Backup age that raises a warning (default 26h0m0s)
+  --crit duration          Backup age that is critical (default 50h0m0s)
+  --catalog string         Backup catalog file (default "./backups/catalog.json")
 
 Test Flags:
   -s, --source string      Source container name (required)
@@ -261,17 +1417,555 @@ Test Flags:
   -d, --database string    Database name (default "postgres")
   -u, --user string        Database user (default "postgres")
   -o, --output string      Output directory for backup file (default "./backups")
+  --protect string         Container name pattern to protect from restores (repeatable)
+  --i-know-what-im-doing   Allow restoring into a protected container
+  -y, --yes                Skip confirmation prompts
+
+Standby Flags:
+  -c, --container string   Standby container name (required unless --host is set)
+  --host string            Connect to host[:port] or a socket directory with local client tools instead of docker exec
+  --no-docker-socket       Refuse to use docker; only connect with --host (default $BACKITUP_NO_DOCKER_SOCKET)
+  -b, --backups string     Directory to watch for new backups (default "./backups")
+  -d, --database string    Database name (default "postgres")
+  -u, --user string        Database user (default "postgres")
+  --interval duration      How often to check for new backups (default 1m)
+  --once                   Restore the newest backup if it is new, then exit
+  --metrics-addr string    Address to serve Prometheus metrics on (e.g. :9187)
+  --job-name string        Name used to pause/resume this job (default "standby-<container>")
+  --control-dir string     Directory holding job pause markers (default "./backups/.control")
+  --blackout string        Blackout window as "<cron> <duration>" (repeatable)
+  --protect string         Container name pattern to protect from restores (repeatable)
+  --i-know-what-im-doing   Allow restoring into a protected container
+  -y, --yes                Skip confirmation prompts
+
+Mirrors Flags:
+  -o, --output string      Primary backup directory (default "./backups")
+  --mirror string          Mirror directory or s3:// or sftp:// location to check (repeatable, required)
+  -d, --database string    Database name (default "postgres")
+  --max-lag duration       Maximum allowed lag behind the primary (default 0, disabled)
+
+List Flags:
+  -d, --database string    Only list backups of this database
+  --tag string             Only list backups with this tag
+  --kind string            Entry kind to list: backup, failed, undo, skipped, verify, volume, inspect, or all (default "backup")
+  --group string           Only list the artifacts of this group, of every kind unless --kind is set
+  --meta string            Only list artifacts annotated with this key=value (repeatable)
+  --since string           Only list entries created at or after this time (RFC 3339 or YYYY-MM-DD)
+  --until string           Only list entries created before this time (RFC 3339 or YYYY-MM-DD)
+  --catalog string         Backup catalog file (default "./backups/catalog.json")
+
+Diff Flags:
+  -f, --file string        Backup file to compare (give exactly two: old, then new)
+
+Drift Flags:
+  -f, --file string        Backup file to compare (required)
+  -c, --container string   Container with the live database (required unless --host is set)
+  --host string            Connect to host[:port] or a socket directory with local client tools instead of docker exec
+  --no-docker-socket       Refuse to use docker; only connect with --host (default $BACKITUP_NO_DOCKER_SOCKET)
+  -d, --database string    Database name (default "postgres")
+  -u, --user string        Database user (default "postgres")
+
+Export Flags:
+  -c, --container string   Docker container name (required unless --host is set)
+  --host string            Connect to host[:port] or a socket directory with local client tools instead of docker exec
+  --no-docker-socket       Refuse to use docker; only connect with --host (default $BACKITUP_NO_DOCKER_SOCKET)
+  -d, --database string    Database name (default "postgres")
+  -u, --user string        Database user (default "postgres")
+  -o, --output string      Directory to write the export to (default "./export")
+  --chunk-mb int           Maximum chunk size in MiB (default 50)
+
+Seed Usage:
+  seed create [flags]      Sample a database into ./seeds/<database>.seed.sql.gz
+  seed apply [flags]       Replace a database with a seed
+
+Seed Create Flags:
+  -c, --container string   Docker container name (required unless --host is set)
+  --host string            Connect to host[:port] or a socket directory with local client tools instead of docker exec
+  --no-docker-socket       Refuse to use docker; only connect with --host (default $BACKITUP_NO_DOCKER_SOCKET)
+  -d, --database string    Database name (default "postgres")
+  -u, --user string        Database user (default "postgres")
+  -o, --output string      Seed file to write (default "./seeds/<database>.seed.sql.gz")
+  --rows int               Rows sampled per table before following foreign keys (default 1000)
+  --table-rows string      Per-table row budget as table=N (repeatable)
+  --mask string            Mask a column as table.column=keep|hash|email|null (repeatable)
+  --no-auto-mask           Don't mask columns that look like personal data
+  --root string            Start from "table [WHERE ...] [ORDER BY ...] [LIMIT n]" instead of sampling (repeatable)
+  --no-children            With --root, don't include rows that reference the root rows
+
+Seed Apply Flags:
+  -c, --container string   Docker container name (required unless --host is set)
+  --host string            Connect to host[:port] or a socket directory with local client tools instead of docker exec
+  --no-docker-socket       Refuse to use docker; only connect with --host (default $BACKITUP_NO_DOCKER_SOCKET)
+  -d, --database string    Database name (default "postgres")
+  -u, --user string        Database user (default "postgres")
+  -f, --file string        Seed file, http(s) URL, or oci:// reference (default "./seeds/<database>.seed.sql.gz")
+  --header string          HTTP header sent when --file is a URL (repeatable)
+  --header-file string     File of --header lines, kept off the command line
+  --sha256 string          Expected SHA-256 of a downloaded seed
+  --protect string         Container name pattern to protect (repeatable)
+  --i-know-what-im-doing   Allow applying a seed to a protected container
+  -y, --yes                Skip confirmation prompts
+  --ca-cert string         PEM file of a CA to trust besides the system's (repeatable; default $BACKITUP_CA_CERT)
+  --insecure-skip-verify   Don't verify TLS certificates at all (warned; for testing only)
+
+Guard Flags:
+  --detect-migrations string  Directory of migration files to watch (required)
+  -d, --database string    Database the migrations run against (default "postgres")
+  -c, --container string   Only accept backups taken from this container
+  --tag string             Tag the backup taken before migrating must carry (default "pre-migration")
+  --catalog string         Backup catalog file (default "./backups/catalog.json")
+
+Preflight Flags:
+  -c, --container string   Docker container to check access to
+  --host string            Check the local client tools and the server at host[:port] or a socket directory
+  --no-docker-socket       Refuse to use docker; only connect with --host
+  -d, --database string    Database name (default "postgres")
+  -u, --user string        Database user (default "postgres")
+  -o, --output string      Directory backups will be written to (default "./backups")
+  --restore                Also check the privileges restores need
+
+Doctor Flags:
+  --install-hints          Print commands that install the missing client tools
+  --os string              Print install hints for this platform instead of the detected one: macos, windows, debian, fedora, alpine, arch, suse
+
+K8s Generate Flags:
+  --job string             CronJob name (required)
+  --image string           Image with biu and the PostgreSQL client tools, built from the Dockerfile (required)
+  --host string            PostgreSQL service host[:port] (required)
+  -d, --database string    Database name (default "postgres")
+  -u, --user string        Database user (default "postgres")
+  --namespace string       Namespace to deploy into (default "default")
+  --schedule string        Cron schedule for the backup (default "0 2 * * *")
+  --secret string          Secret holding the database password
+  --secret-key string      Key of the password in --secret (default "password")
+  --pvc string             PersistentVolumeClaim backups are written to (default "<job>-backups")
+  --storage string         Also create the claim with this size (e.g. 20Gi)
+  --tag string             Tag to attach to every backup (repeatable)
+  --env string             Extra environment variable as NAME=value (repeatable)
+  -o, --output string      File to write the manifests to (default stdout)
+
+Job Usage:
+  job pause [--reason string] <name>
+  job resume <name>
+  job cancel <run-id>
+  job status
+  --control-dir string     Directory holding job pause markers (default "./backups/.control")
+
+Config Usage:
+  config init [flags]      Write a starter config file with a backup and a prune job
+  config validate [flags]  Check a config file's keys, schedules, and job values
+  --config string          Config file (default "back-it-up.yaml")
+  -c, --container string   init: container of the starter backup job (default "my-postgres")
+  -d, --database string    init: database of the starter backup job, which it is named after (default "postgres")
+  --force                  init: overwrite an existing config file
+  --check-connectivity     validate: also check each backup's database server and destination can be reached
+
+Daemon Flags:
+  --config string          Config file of the jobs to run (default "back-it-up.yaml")
+  --log-format string      Log format: json or text (default "json")
+  --control-dir string     Directory holding job pause markers (default "./backups/.control")
+  --catalog string         Catalog the jobs' backups are recorded in, for when each last succeeded (default "./backups/catalog.json")
+  --alert-cooldown duration  Suppress an alert identical to the job's last one for this long
+  --alert-command string   Shell command run for each failure alerted
+  --escalate-after int     Run --escalate-command once a job has failed this many times in a row
+  --escalate-command string  Shell command alerting a second channel, e.g. a pager
+  --metrics-addr string    Address to serve Prometheus metrics on (e.g. :9189)
+
+Logs Usage:
+  logs [flags]             List the stored run logs
+  logs [flags] <run-id>    Print a run's log (a unique prefix of the ID will do)
+  --log-dir string         Directory run logs are kept in (default "./backups/logs")
+  --json                   Print the log as stored, one JSON record per line
+
+Clean Flags:
+  --older-than duration    Only remove leftovers untouched for this long (default 24h0m0s)
+  -o, --output string      Backup directory to remove partial files from (default "./backups")
+  --dry-run                List what would be removed without removing it
+  -y, --yes                Skip confirmation prompts
+
+Prune Flags (at least one --keep-* or --max-total-size is required):
+  --keep-last int          Keep the newest N backups of each database
+  --keep-daily int         Keep the newest backup of each of the last N days with one
+  --keep-weekly int        Keep the newest backup of each of the last N weeks with one
+  --keep-monthly int       Keep the newest backup of each of the last N months with one
+  --keep-yearly int        Keep the newest backup of each of the last N years with one
+  --keep-within duration   Keep every backup taken within this long of the newest, e.g. 30d
+  --max-total-size size    Remove the oldest backups until those in each place fit in this size, e.g. 500GB
+  --keep-tagged glob       Always keep backups with a tag matching this glob, e.g. release-* (repeatable)
+  -o, --output string      Only prune backups in this directory
+  --dest string            Only prune backups stored under this s3:// or sftp:// location
+  -d, --database string    Only prune backups of this database
+  --container string       Only prune backups taken from this container
+  --dry-run                List what would be removed without removing it
+  -y, --yes                Skip confirmation prompts
+  --catalog string         Backup catalog file (default "./backups/catalog.json")
+  --ca-cert string         PEM file of a CA to trust besides the system's (repeatable; default $BACKITUP_CA_CERT)
+  --insecure-skip-verify   Don't verify TLS certificates at all (warned; for testing only)
+
+Serve Flags:
+  --addr string            Address to listen on (default ":8080")
+  --access string          Token store created with "serve token add" (default "./backups/access.json")
+  --catalog string         Backup catalog file (default "./backups/catalog.json")
+  --control-dir string     Directory holding job pause markers (default "./backups/.control")
+  --undo-dir string        Directory for undo backups taken before restores (default "./backups/undo")
+  --protect string         Container name pattern only admins may restore into (repeatable)
+  --no-docker-socket       Refuse to use docker; restores must name a host
+  --tls-cert string        Serve HTTPS with this certificate (reloaded when the file changes)
+  --tls-key string         Private key for --tls-cert
+  --client-ca string       Require client certificates signed by this CA bundle (mutual TLS)
+  --oidc-issuer string     OIDC issuer URL; enables SSO for the dashboard and API
+  --oidc-client-id string  OIDC client ID (secret read from $BACKITUP_OIDC_CLIENT_SECRET)
+  --oidc-redirect-url string  Callback URL registered with the provider (e.g. https://biu.example.com/callback)
+  --oidc-groups-claim string  Claim listing the user's groups (default "groups")
+  --oidc-role string       Map a group, email:<address>, or domain:<hd> to a role as group=role[:job,...] (repeatable)
+  --oidc-scope string      Extra scope to request at login (repeatable, default "profile", "email")
+  --ca-cert string         PEM file of a CA to trust besides the system's (repeatable; default $BACKITUP_CA_CERT)
+  --insecure-skip-verify   Don't verify TLS certificates at all (warned; for testing only)
+
+Serve Token Usage:
+  serve token add --name string [--role viewer|operator|admin] [--job pattern]...
+  serve token list
+  serve token revoke --name string
+  --access string          Token store (default "./backups/access.json")
+
+Audit Usage:
+  audit verify [--log string]
+  audit export [flags]
+  --log string             Audit log file (default $BACKITUP_AUDIT_LOG or "./backups/audit.log")
+  --format string          Export format: jsonl or csv (default "jsonl")
+  --since string           Only export events at or after this time (RFC 3339 or YYYY-MM-DD)
+  --until string           Only export events before this time (RFC 3339 or YYYY-MM-DD)
+  --action string          Only export read, download, or restore events
+  -o, --output string      File to export to (default stdout)
+
+Volume Usage:
+  volume backup [flags]    Archive a docker volume to <volume>_<timestamp>.tar.gz
+  volume restore [flags]   Extract an archive into a docker volume
+
+Volume Backup Flags:
+  -v, --volume string      Docker volume to archive (required)
+  -o, --output string      Output directory for the archive (default "./backups")
+  --helper-image string    Image the archiving helper container runs (default "alpine:3")
+  --tag string             Tag to attach to the archive (repeatable)
+  --note string            Free-form note to attach to the archive
+  --run-meta string        Annotate the archive with key=value (repeatable)
+  --catalog string         Backup catalog file (default "./backups/catalog.json")
+
+Volume Restore Flags:
+  -v, --volume string      Docker volume to restore into; created if missing (default: the archived volume)
+  -f, --file string        Volume archive path
+  --id string              Restore the volume archive with this catalog ID (or unique prefix)
+  --clear                  Delete the volume's current contents before extracting
+  --helper-image string    Image the extracting helper container runs (default "alpine:3")
+  -y, --yes                Skip confirmation prompts
+  --protect string         Volume name pattern to protect from restores (repeatable)
+  --i-know-what-im-doing   Allow restoring into a protected volume
+  --catalog string         Backup catalog file (default "./backups/catalog.json")
+
+Dictionary Train Flags:
+  -o, --output string      Backup directory to train on; writes <output>/dictionaries/<database>_<timestamp>.zdict (default "./backups")
+  -d, --database string    Only train on backups of this database (default: every database)
+  --samples int            Train on this many of the newest plain backups (default 20)
+  --size int               Maximum dictionary size in bytes (default 112640)
+
+Stack Usage:
+  stack backup [flags]     Dump the project's databases and archive its named volumes as one group
+  stack restore [flags]    Restore a stack backup into the running project
+
+Stack Backup Flags:
+  -f, --file string        Compose file of the stack (default "docker-compose.yml")
+  -o, --output string      Output directory; artifacts go in <output>/<project> (default "./backups")
+  --quiesce                Pause the stack's other containers while it is backed up
+  --tag string             Tag to attach to every artifact (repeatable)
+  --note string            Free-form note to attach to every artifact
+  --run-meta string        Annotate every artifact with key=value (repeatable)
+  --catalog string         Backup catalog file (default "./backups/catalog.json")
+
+Stack Restore Flags:
+  -f, --file string        Compose file of the stack (default "docker-compose.yml")
+  --group string           Restore the stack backup with this group ID (default: the newest)
+  --i-know-what-im-doing   Allow restoring into a protected container
+  -y, --yes                Skip confirmation prompts
+  --no-undo                Don't take undo backups of the databases before replacing them
+  --undo-dir string        Directory for undo backups (default "./backups/undo")
+  --catalog string         Backup catalog file (default "./backups/catalog.json")
+
+Report Flags:
+  --usage                  Summarize the local usage statistics (required)
+  --file string            Usage statistics file to read (default $BACKITUP_USAGE_STATS)
+  --json                   Print the statistics as JSON
+
+Report RPO Flags:
+  --job string             Database, container, or tag whose recovery points are reported (required)
+  --format string          Output format: svg or json (default "svg")
+  -o, --output string      File to write the report to (default: standard output)
+  --since string           Start of the timeline, as an RFC 3339 time or a date (default: 30 days before --until)
+  --until string           End of the timeline (default: now)
+  --target duration        Recovery point objective; longer windows are flagged (default 24h0m0s)
+  --catalog string         Backup catalog file (default "./backups/catalog.json")
+
+Self-Update Flags:
+  --url string             Release metadata to update from (default "https://github.com/iostate/back-it-up/releases/latest/download/release.json")
+  --public-key string      Ed25519 public key (PEM or base64) to verify the binary with (default: the key built into this binary)
+  --check                  Only report whether an update is available
+  --force                  Install the release even if it isn't newer, or over a development build
+  --ca-cert string         PEM file of a CA to trust besides the system's (repeatable; default $BACKITUP_CA_CERT)
+  --insecure-skip-verify   Don't verify TLS certificates at all (warned; for testing only)
 
 Examples:
   # Backup
   back-it-up backup -c my-postgres-container -d mydb
 
+  # Tagged backup
+  back-it-up backup -c my-postgres-container -d mydb --tag pre-release-2.3 --note "before schema migration 0451"
+  back-it-up backup -c prod-postgres -d mydb --run-meta git_sha=$GITHUB_SHA --run-meta pipeline_url=$CI_PIPELINE_URL
+  back-it-up list --meta git_sha=4f2c9e1
+
+  # Gate a deploy on a backup taken after the last migration change
+  back-it-up guard --detect-migrations ./migrations -c prod-postgres -d mydb
+
   # Restore
   back-it-up restore -c test-postgres -f ./backups/mydb_2025_12_21_14_30_45.sql.gz --drop
 
+  # Check a backup would restore, without restoring it
+  back-it-up restore -c test-postgres -d mydb -f ./backups/mydb_2025_12_21_14_30_45.sql.gz --validate-only
+
+  # Restore by tag
+  back-it-up restore -c test-postgres --tag pre-release-2.3 --drop
+
+  # Push a backup to a container registry and restore it elsewhere
+  back-it-up backup -c prod-postgres -d mydb -o oci://registry.example.com/backups/mydb:nightly
+  back-it-up restore -c test-postgres -d mydb --drop -f oci://registry.example.com/backups/mydb:nightly
+
+  # Spin up a throwaway database from last night's backup
+  back-it-up restore --create-container postgres:16 --name restored-db --publish 5433:5432 -d mydb --tag nightly
+
+  # Restore into a fresh server along with the roles the dump's objects belong to
+  back-it-up backup -c prod-postgres -d mydb --globals
+  back-it-up restore --create-container postgres:16 -d mydb -f backups/mydb_2025_12_21_14_30_45.sql.gz
+
+  # Load-test against the production schema filled with generated data
+  back-it-up restore --create-container postgres:16 -d mydb --tag nightly --synthesize --rows 100000
+
+  # Back up an app's uploads volume next to its database
+  back-it-up volume backup -v myapp_uploads
+
+  # Back up an app's database, uploads, and container config together, then restore them
+  back-it-up backup -c app-db -d app --with-volume app-uploads --with-inspect app-web --quiesce app-web
+  back-it-up restore -c app-db --group 0192f4c8-7a3e-7b2c-9d41-5e6f7a8b9c0d --drop
+
+  # Snapshot a self-hosted compose stack and bring its data back later
+  back-it-up stack backup -f ~/apps/nextcloud/docker-compose.yml --quiesce
+  back-it-up stack restore -f ~/apps/nextcloud/docker-compose.yml
+
+  # Back up every database in a container
+  back-it-up backup -c prod-postgres --all-databases
+
+  # Trade CPU for smaller backups
+  back-it-up backup -c prod-postgres -d mydb --compression xz
+  back-it-up backup -c prod-postgres -d mydb --compression zstd --compression-level 19
+
+  # Encrypt on the way to disk, decrypt when restoring
+  back-it-up backup -c prod-postgres -d mydb --encrypt-recipient age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p
+  back-it-up restore -c test-postgres -d mydb --drop -f backups/mydb_2025_12_21_14_30_45.sql.gz.age --identity-file ~/.config/age/key.txt
+
+  # Encrypt and sign with GPG, and check the signature before trusting the file
+  back-it-up backup -c prod-postgres -d mydb --gpg-recipient backups@example.com --sign-key ops@example.com
+  back-it-up verify-file -f backups/mydb_2025_12_21_14_30_45.sql.gz.gpg
+  back-it-up restore -c test-postgres -d mydb --drop -f backups/mydb_2025_12_21_14_30_45.sql.gz.gpg --require-signature --verify-key ops@example.com
+
+  # Show which container, pg_dump, and settings a backup came from
+  back-it-up info -f backups/mydb_2025_12_21_14_30_45.sql.gz
+
+  # Train a dictionary on past tenant backups and compress new ones with it
+  back-it-up dictionary train -o backups
+  back-it-up backup -c tenants-postgres --all-databases --dictionary backups/dictionaries/all_2025_12_21_14_30_45.zdict
+
+  # Count the work done since usage statistics were turned on
+  BACKITUP_USAGE_STATS=./backups/usage.json back-it-up backup -c prod-postgres -d mydb --name-by-hash
+  back-it-up report --usage
+
+  # Chart which moments of the last month could be recovered
+  back-it-up report rpo --job prod-db --target 6h -o rpo.svg
+
+  # Update a fleet host in place
+  back-it-up self-update --check
+  back-it-up self-update
+
+  # Dump a large database with 8 parallel jobs, and restore it the same way
+  back-it-up backup -c prod-postgres -d mydb --jobs 8
+  back-it-up restore -c staging-postgres -d mydb -f backups/mydb_2025_12_21_14_30_45.dir.tar.gz --drop --jobs 8
+
+  # Back up only the partitions of two large tables
+  back-it-up backup -c prod-postgres -d mydb --table 'events*' --table 'metrics*'
+
+  # Version the schema separately from the data
+  back-it-up backup -c prod-postgres -d mydb --schema-only --tag schema
+
+  # Keep password hashes out of the backup entirely
+  back-it-up backup -c prod-postgres -d mydb --exclude-column users.password_hash
+
+  # Keep a local copy and stream a second one off-site from the same dump
+  back-it-up backup -c prod-postgres -d mydb --tee https://backups.example.com/mydb/
+
+  # Stream the backup straight to S3, and restore it from there
+  back-it-up backup -c prod-postgres -d mydb --dest s3://my-backups/mydb
+  back-it-up restore -c staging-postgres -d mydb -f s3://my-backups/mydb/mydb_2025_01_02_03_00_00.sql.gz
+
+  # Push the backup to a NAS over SSH
+  back-it-up backup -c prod-postgres -d mydb --dest sftp://backup@nas.local/volume1/backups/mydb
+
+  # Sidecar next to Postgres, over a shared socket volume (no docker socket needed)
+  back-it-up backup --host /var/run/postgresql -d mydb -o /backups
+
+  # Check a docker-less deployment has everything it needs
+  BACKITUP_NO_DOCKER_SOCKET=1 back-it-up preflight --host db:5432 -d mydb -u backup
+
+  # Install the client tools --host needs, or run them in a container instead
+  back-it-up doctor --install-hints
+  BACKITUP_CLIENT_IMAGE=postgres:16 back-it-up backup --host localhost:5432 -d mydb
+
+  # Reach a database on a user-defined docker network from the helper container
+  BACKITUP_CLIENT_IMAGE=postgres:16 BACKITUP_HELPER_NETWORK=app_backend back-it-up backup --host app-db -d mydb
+
+  # Run nightly backups in Kubernetes
+  back-it-up k8s generate --job prod-db --image registry.example.com/biu:1.0 \
+    --host prod-db.databases.svc -d mydb --secret prod-db-credentials --storage 20Gi | kubectl apply -f -
+
+  # Nagios/Icinga service check
+  back-it-up check --job prod-db --warn 26h --crit 50h
+
+  # Check whether an old backup still matches the live schema before restoring it
+  back-it-up drift -f ./backups/mydb_2025_06_01_02_00_00.sql.gz -c prod-postgres -d mydb
+
+  # Export a reference database for Git LFS and restore it from the manifest
+  back-it-up export -c dev-postgres -d fixtures -o ./testdata/db
+  back-it-up restore -c test-postgres -d fixtures --drop -f ./testdata/db/fixtures.manifest.json
+
+  # Build a dev seed from production and load it locally
+  back-it-up seed create -c prod-postgres -d mydb --rows 500 --table-rows public.orders=2000
+  back-it-up seed apply -c dev-postgres -d mydb -y
+
+  # Staging data: the 1000 most recent orders with everything they reference
+  back-it-up seed create -c prod-postgres -d mydb -o ./staging.sql.gz \
+    --root "public.orders ORDER BY created_at DESC LIMIT 1000"
+
+  # Restore a CI artifact straight from HTTPS
+  back-it-up restore -c test-postgres -d mydb --drop \
+    -f https://artifacts.example.com/db.sql.gz --header "Authorization: Bearer $TOKEN"
+
+  # Undo the last restore
+  back-it-up restore -c test-postgres -d mydb --undo-last
+
+  # See what restoring yesterday noon's data would take, without restoring
+  back-it-up restore plan --job prod-db --target-time "2025-03-01 12:00"
+
   # Verify
   back-it-up verify -s prod-postgres -t test-postgres -d mydb
 
+  # Continuously check a replica
+  back-it-up verify -s prod-postgres -t replica-postgres -d mydb --mode rowcount --watch --metrics-addr :9188
+
+  # Alert hourly at most, and page after six failed runs in a row
+  back-it-up verify -s prod-postgres -t replica-postgres -d mydb --watch --alert-cooldown 1h --escalate-after 6 --escalate-command ./page-oncall.sh
+
+  # Verify a huge database an hour at a time, resuming each night
+  back-it-up verify -s prod-postgres -t replica-postgres -d mydb --mode rowcount --max-duration 1h
+
+  # Skip tables that change constantly
+  back-it-up verify -s prod-postgres -t replica-postgres -d mydb --ignore-table sessions --ignore-table audit_log
+
+  # Tolerate a little replication lag, and keep a JSON diff for CI
+  back-it-up verify -s prod-postgres -t replica-postgres -d mydb --mode rowcount --fail-threshold 50 --diff-file diff.json
+
   # Full test (backup, restore, verify)
-  back-it-up test -s prod-postgres -t test-postgres -d mydb`)
+  back-it-up test -s prod-postgres -t test-postgres -d mydb
+
+  # Compare two nightly backups
+  back-it-up diff -f ./backups/mydb_2025_12_20_02_00_00.sql.gz -f ./backups/mydb_2025_12_21_02_00_00.sql.gz
+
+  # Serve the API and give the on-call team restore rights for staging jobs only
+  back-it-up serve token add --name oncall --role operator --job "staging-*"
+  back-it-up serve --addr :8080 --protect "prod-*"
+
+  # Log in to the dashboard through Keycloak, mapping groups to roles
+  back-it-up serve --oidc-issuer https://sso.example.com/realms/ops --oidc-client-id biu \
+    --oidc-redirect-url https://biu.example.com/callback --oidc-role dba=admin --oidc-role "oncall=operator:staging-*"
+
+  # Hand last quarter's restores to a compliance review
+  back-it-up audit export --action restore --since 2025-10-01 --until 2026-01-01 --format csv -o restores.csv
+
+  # Pause a job during maintenance
+  back-it-up job pause --reason "storage migration" standby-standby-postgres
+
+  # Stop a backup that's running too long
+  back-it-up job cancel 01943b2e-7c4a-7d21-9a53-8f2e4c1d0a6b
+
+  # Stream to S3 through a corporate proxy that re-signs TLS with its own CA
+  HTTPS_PROXY=http://proxy.corp:3128 back-it-up backup -c prod-postgres -d mydb --dest s3://my-bucket/backups --ca-cert /etc/ssl/corp-ca.pem
+
+  # Configure a CI backup entirely through the environment
+  BACKITUP_CONTAINER=prod-postgres BACKITUP_DATABASE=mydb BACKITUP_DEST=s3://my-bucket/backups back-it-up backup
+
+  # Start a config file, and check it reaches everything before the first night
+  back-it-up config init -c prod-postgres -d mydb
+  back-it-up config validate --check-connectivity
+
+  # Take the backup the prod-db job of back-it-up.yaml describes, into another directory
+  back-it-up backup --job prod-db -o /mnt/adhoc
+
+  # Run the scheduled jobs of back-it-up.yaml, paging after three failures in a row
+  back-it-up daemon --alert-cooldown 6h --escalate-after 3 --escalate-command ./page-oncall.sh
+
+  # Read what last night's failed backup printed
+  back-it-up list --kind failed
+  back-it-up logs 01943b2e
+
+  # Sweep up after runs that crashed more than a week ago
+  back-it-up clean --older-than 168h --yes
+
+  # Keep the last 7 backups of each database in the bucket
+  back-it-up prune --keep-last 7 --dest s3://my-bucket/backups --dry-run
+
+  # Back up nightly and keep 7 dailies, 4 weeklies, and 12 monthlies
+  back-it-up backup -c prod-postgres -d mydb --keep-daily 7 --keep-weekly 4 --keep-monthly 12
+
+  # Keep a month of backups, but never more than 500GB of them
+  back-it-up prune --keep-within 30d --max-total-size 500GB -o /var/backups --yes
+
+  # Warm standby
+  back-it-up standby -c standby-postgres -d mydb --metrics-addr :9187
+
+Environment:
+  BACKITUP_<FLAG>              Any long flag not given, e.g. BACKITUP_DATABASE for --database or BACKITUP_KEEP_DAILY;
+                               repeatable flags take a value per line. Flags win over these, and these over --job
+  BACKITUP_PROTECT             Comma-separated container name patterns protected from restores (e.g. "prod-*")
+  BACKITUP_BLACKOUT            Semicolon-separated blackout windows (e.g. "0 1 * * sun 4h")
+  BACKITUP_INVENTORY_URL       Inventory endpoint backups are reported to (see --inventory-url)
+  BACKITUP_SLACK_WEBHOOK       Slack webhook backups post their outcome to, kept out of the command line (see --slack-webhook)
+  BACKITUP_AUDIT_LOG           Audit log artifact accesses are appended to (default "./backups/audit.log")
+  BACKITUP_ACTOR               Name recorded as the actor in the audit log (default: the OS user)
+  BACKITUP_THROUGHPUT          Throughput history estimates are based on (default "./backups/throughput.json")
+  BACKITUP_USAGE_STATS         File to keep local usage statistics in; unset, none are kept (see report --usage)
+  BACKITUP_OIDC_CLIENT_SECRET  OIDC client secret for serve --oidc-issuer
+  BACKITUP_SESSION_KEY         Key dashboard sessions are signed with (default: random per start)
+  BACKITUP_NO_DOCKER_SOCKET    Set to true to refuse docker access in every command (see --no-docker-socket)
+  BACKITUP_AGE_IDENTITY        age identity files encrypted backups are decrypted with, separated like $PATH (see --identity-file)
+  BACKITUP_CLIENT_IMAGE        Image to run the client tools in with --host when they aren't installed (e.g. "postgres:16")
+  BACKITUP_HELPER_NETWORK      Docker network the client tools' helper container joins instead of the host's
+  BACKITUP_HELPER_NETWORK_ALIAS  Comma-separated aliases of the helper container on BACKITUP_HELPER_NETWORK
+  BACKITUP_HELPER_IP, BACKITUP_HELPER_IPV6  Fixed IPv4 and IPv6 addresses of the helper container on BACKITUP_HELPER_NETWORK
+  BACKITUP_SCRATCH_DIR         Directory each run keeps its scratch files in, under its run ID (default: back-it-up in the system temp directory)
+  AWS_ACCESS_KEY_ID            Credentials for s3:// locations, with AWS_SECRET_ACCESS_KEY and optionally AWS_SESSION_TOKEN
+  AWS_REGION                   Region of s3:// buckets (default: $AWS_DEFAULT_REGION, then "us-east-1")
+  AWS_ENDPOINT_URL_S3          Endpoint of an S3-compatible server such as MinIO (default: $AWS_ENDPOINT_URL)
+  AWS_ROLE_ARN                 Role to assume for s3:// locations, with the credentials above or AWS_WEB_IDENTITY_TOKEN_FILE
+  AWS_ROLE_SESSION_NAME        Session name the role is assumed under (default "back-it-up")
+  AWS_ENDPOINT_URL_STS         STS endpoint the role is assumed through (default: $AWS_ENDPOINT_URL, then the region's)
+  BACKITUP_S3_EXTERNAL_ID      External ID the role's trust policy requires
+  BACKITUP_SFTP_IDENTITY       Private key to log in to sftp:// servers with, besides ssh's defaults and agent
+  BACKITUP_SFTP_PASSWORD       Password to log in to sftp:// servers with when none of the keys is accepted
+  BACKITUP_CA_CERT             CA certificate files HTTPS servers are verified with besides the system's, separated like $PATH (see --ca-cert)
+  BACKITUP_INSECURE_SKIP_VERIFY  Set to true to skip TLS certificate verification in every command (see --insecure-skip-verify)
+  HTTPS_PROXY, HTTP_PROXY      Proxy for S3, URL downloads and uploads, registries, inventory, Slack, webhooks and healthchecks, SSO, and self-update; NO_PROXY lists exceptions`)
 }
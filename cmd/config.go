@@ -0,0 +1,346 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/config"
+	"github.com/iostate/back-it-up/internal/notify"
+	"github.com/iostate/back-it-up/internal/oci"
+	"github.com/iostate/back-it-up/internal/storage"
+)
+
+// applyJob sets fs's flags from the named job in the config file at path.
+// Flags given on the command line or in the environment win over the job's.
+func applyJob(fs *flag.FlagSet, path, name string) error {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	job, err := cfg.Job(name)
+	if err != nil {
+		return err
+	}
+	if !job.RunsBackup() {
+		return fmt.Errorf("job %q runs %s, not %s", name, job.Command, fs.Name())
+	}
+
+	given := givenFlags(fs)
+	fromJob := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	// Parse errors are returned, not printed with the usage
+	fromJob.SetOutput(io.Discard)
+	fs.VisitAll(func(f *flag.Flag) {
+		fromJob.Var(jobFlag{fs: fs, flag: f, given: given[f.Value]}, f.Name, f.Usage)
+	})
+
+	for _, f := range job.BackupFlags() {
+		if err := fromJob.Set(f.Name, f.Value); err != nil {
+			return fmt.Errorf("job %q: invalid %s %q: %w", name, f.Name, f.Value, err)
+		}
+	}
+	if err := fromJob.Parse(job.Args); err != nil {
+		return fmt.Errorf("job %q: invalid args: %w", name, err)
+	}
+	if fromJob.NArg() > 0 {
+		return fmt.Errorf("job %q: unexpected args %q", name, fromJob.Args())
+	}
+	return nil
+}
+
+// jobFlag sets a flag from a job, unless the command line or environment
+// already has
+type jobFlag struct {
+	fs    *flag.FlagSet
+	flag  *flag.Flag
+	given bool
+}
+
+func (j jobFlag) String() string { return "" }
+
+func (j jobFlag) Set(value string) error {
+	if j.given {
+		return nil
+	}
+	return j.fs.Set(j.flag.Name, value)
+}
+
+func (j jobFlag) IsBoolFlag() bool {
+	b, ok := j.flag.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func runConfig(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: config <validate|init> [flags]")
+	}
+
+	switch args[0] {
+	case "validate":
+		return runConfigValidate(args[1:])
+	case "init":
+		return runConfigInit(args[1:])
+	default:
+		return fmt.Errorf("unknown config action %q (expected validate or init)", args[0])
+	}
+}
+
+func runConfigValidate(args []string) error {
+	fs := flag.NewFlagSet("config validate", flag.ExitOnError)
+	configPath := fs.String("config", config.DefaultPath, "Config file to check")
+	connectivity := fs.Bool("check-connectivity", false, "Also check each backup's database server and destination can be reached")
+	tlsOpts := addTLSFlags(fs)
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := tlsOpts.apply(); err != nil {
+		return err
+	}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return err
+	}
+
+	failures := 0
+	for _, name := range cfg.Names() {
+		job := cfg.Jobs[name]
+		when := "run by hand"
+		if job.Schedule != "" {
+			when = "scheduled " + job.Schedule
+		}
+		what := "backup"
+		if !job.RunsBackup() {
+			what = job.Command
+		}
+		fmt.Printf("%s (%s, %s)\n", name, what, when)
+
+		// The file's keys, types, and schedules were checked by Load
+		var report preflightReport
+		if job.Schedule != "" {
+			report.add("schedule", true, "")
+		}
+		if job.RunsBackup() {
+			checkJobValues(&report, job)
+			if *connectivity {
+				checkJobConnectivity(&report, job)
+			}
+		} else {
+			report.add("args", true, "checked by "+job.Command+" when it runs")
+		}
+		for _, c := range report {
+			mark := "✓"
+			switch {
+			case !c.ok && c.advisory:
+				mark = "!"
+			case !c.ok:
+				mark = "✗"
+			}
+			line := fmt.Sprintf("  %s %s", mark, c.requirement)
+			if c.detail != "" {
+				line += " (" + c.detail + ")"
+			}
+			fmt.Println(line)
+		}
+		failures += report.failures()
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%s has %d problem(s)", *configPath, failures)
+	}
+	fmt.Printf("\n✓ %s is valid: %d job(s)\n", *configPath, len(cfg.Jobs))
+	return nil
+}
+
+// checkJobValues checks the values of a backup job as backup would take
+// them, without running anything
+func checkJobValues(report *preflightReport, job config.Job) {
+	var err error
+	if job.Container == "" && job.Host == "" && !argsSet(job.Args, "c", "container", "host") &&
+		os.Getenv(envVarFor("container")) == "" && os.Getenv(envVarFor("host")) == "" {
+		err = fmt.Errorf("set container or host")
+	}
+	report.add("container or host", err == nil, errorDetail(err))
+
+	err = checkJobCompression(job)
+	report.add("format and compression", err == nil, errorDetail(err))
+
+	if job.Destination != "" {
+		err = nil
+		if !storage.IsLocation(job.Destination) {
+			err = fmt.Errorf("expected s3://bucket/prefix or sftp://user@host/path")
+		}
+		report.add("destination", err == nil, errorDetail(err))
+	}
+
+	if !job.Retention.IsZero() {
+		err = checkJobRetention(job.Retention)
+		report.add("retention", err == nil, errorDetail(err))
+	}
+
+	if !job.Notify.IsZero() {
+		hook := job.Notify.Webhook
+		n := notifyConfig{slackWebhook: job.Notify.SlackWebhook, on: job.Notify.On, healthcheck: job.Notify.Healthcheck, webhook: hook.URL,
+			webhookTemplate: hook.Template, webhookHeaders: hook.Headers, webhookEvents: strings.Join(hook.Events, ",")}
+		if n.on == "" {
+			n.on = string(notify.Always)
+		}
+		if n.webhookTemplate == "" {
+			n.webhookTemplate = defaultWebhookTemplate
+		}
+		if n.webhookEvents == "" {
+			n.webhookEvents = defaultWebhookEvents
+		}
+		err = n.validate()
+		if err == nil && hook.URL == "" && (hook.Template != "" || len(hook.Headers) > 0 || len(hook.Events) > 0) {
+			err = fmt.Errorf("webhook needs a url")
+		}
+		report.add("notify", err == nil, errorDetail(err))
+	}
+}
+
+func checkJobCompression(job config.Job) error {
+	switch job.Format {
+	case "", backup.FormatPlain:
+		return backup.CheckCompression(job.Compression, job.CompressionLevel)
+	case backup.FormatCustom, backup.FormatDirectory:
+		if job.Compression != "" {
+			return fmt.Errorf("%s dumps are compressed by pg_dump; remove compression", job.Format)
+		}
+		if job.CompressionLevel < 0 || job.CompressionLevel > 9 {
+			return fmt.Errorf("%s dump compression levels run from 1 to 9", job.Format)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %q (expected plain, custom, or directory)", job.Format)
+}
+
+func checkJobRetention(r config.Retention) error {
+	if r.KeepLast < 0 || r.KeepDaily < 0 || r.KeepWeekly < 0 || r.KeepMonthly < 0 || r.KeepYearly < 0 {
+		return fmt.Errorf("keep counts can't be negative")
+	}
+	if r.KeepWithin != "" {
+		if err := new(longDuration).Set(r.KeepWithin); err != nil {
+			return fmt.Errorf("keep_within: %w", err)
+		}
+	}
+	if r.MaxTotalSize != "" {
+		if err := new(byteSize).Set(r.MaxTotalSize); err != nil {
+			return fmt.Errorf("max_total_size: %w", err)
+		}
+	}
+	for _, pattern := range r.KeepTagged {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("keep_tagged: invalid pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// checkJobConnectivity checks that a backup job's database server and
+// destination answer
+func checkJobConnectivity(report *preflightReport, job config.Job) {
+	container := job.Container
+	if container == "" {
+		container = job.Host
+	}
+	if container != "" {
+		svc, err := newDatabaseService(job.Host, false)
+		if err == nil {
+			err = svc.VerifyContainer(container)
+		}
+		report.add(fmt.Sprintf("database server %s reachable", container), err == nil, errorDetail(err))
+	}
+
+	if job.Destination != "" && storage.IsLocation(job.Destination) {
+		err := checkDestination(job.Destination)
+		report.add(fmt.Sprintf("destination %s reachable", job.Destination), err == nil, errorDetail(err))
+		return
+	}
+	output := job.Output
+	if output == "" {
+		output = "./backups"
+	}
+	if oci.IsReference(output) {
+		return
+	}
+	if info, err := os.Stat(output); err != nil {
+		report.advise(fmt.Sprintf("output directory %s exists", output), false, "created by the first backup")
+	} else {
+		report.add(fmt.Sprintf("output directory %s exists", output), info.IsDir(), "")
+	}
+}
+
+// checkDestination reads a probe object under location, which a missing
+// object answers as well as any, to see that the store takes requests
+func checkDestination(location string) error {
+	store, prefix, err := storage.Open(location)
+	if err != nil {
+		return err
+	}
+	r, err := store.Get(path.Join(prefix, ".back-it-up-connectivity-check"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return r.Close()
+}
+
+// argsSet reports whether args give any of the named flags
+func argsSet(args []string, names ...string) bool {
+	for _, arg := range args {
+		name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if strings.HasPrefix(arg, "-") && slices.Contains(names, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func runConfigInit(args []string) error {
+	fs := flag.NewFlagSet("config init", flag.ExitOnError)
+	configPath := fs.String("config", config.DefaultPath, "Config file to write")
+	containerName := fs.String("container", "my-postgres", "Container of the starter backup job")
+	fs.StringVar(containerName, "c", "my-postgres", "Container of the starter backup job (shorthand)")
+	dbName := fs.String("database", "postgres", "Database of the starter backup job, which the job is named after")
+	fs.StringVar(dbName, "d", "postgres", "Database of the starter backup job (shorthand)")
+	force := fs.Bool("force", false, "Overwrite an existing config file")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	data := config.Starter(*containerName, *dbName)
+	if _, err := config.Parse(data, false); err != nil {
+		return fmt.Errorf("can't write a starter config for database %q: %w", *dbName, err)
+	}
+
+	mode := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if *force {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(*configPath, mode, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists; pass --force to overwrite it", *configPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	fmt.Printf("Wrote %s with jobs %s and %s-prune\n", *configPath, *dbName, *dbName)
+	fmt.Printf("Edit it, then check it with: back-it-up config validate --config %s\n", *configPath)
+	return nil
+}
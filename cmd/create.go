@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/docker"
+)
+
+// restoreContainer is a container created by `restore --create-container`
+type restoreContainer struct {
+	svc  *docker.Service
+	spec docker.PostgresSpec
+}
+
+// createRestoreContainer pulls image, starts a container with a fresh volume,
+// and waits until it accepts connections. The container is removed again if
+// it never becomes ready.
+func createRestoreContainer(image, name, user string, publish []string, timeout time.Duration) (*restoreContainer, error) {
+	password := make([]byte, 16)
+	if _, err := rand.Read(password); err != nil {
+		return nil, fmt.Errorf("failed to generate password: %w", err)
+	}
+	c := &restoreContainer{
+		svc: docker.NewService(),
+		spec: docker.PostgresSpec{
+			Name:     name,
+			Image:    image,
+			User:     user,
+			Password: hex.EncodeToString(password),
+			Publish:  publish,
+			Volume:   name + "-data",
+		},
+	}
+
+	fmt.Printf("Creating container '%s' from %s...\n", name, image)
+	if err := c.svc.CreatePostgres(c.spec); err != nil {
+		c.remove()
+		return nil, err
+	}
+	fmt.Println("Waiting for the server to accept connections...")
+	if err := c.svc.WaitReady(name, user, timeout); err != nil {
+		c.remove()
+		return nil, err
+	}
+	fmt.Printf("✓ Container '%s' ready\n", name)
+	return c, nil
+}
+
+// remove deletes the container and its volume, e.g. after a failed restore
+func (c *restoreContainer) remove() {
+	if err := c.svc.RemoveContainer(c.spec.Name, c.spec.Volume); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// printConnection tells the user how to reach the restored database
+func (c *restoreContainer) printConnection(dbName string) {
+	fmt.Printf("Database '%s' is running in container '%s' (data in volume '%s')\n", dbName, c.spec.Name, c.spec.Volume)
+	for _, p := range c.spec.Publish {
+		host, port, ok := publishedAddress(p)
+		if !ok {
+			fmt.Printf("Port %s is published on a random host port: see `docker port %s`\n", p, c.spec.Name)
+			continue
+		}
+		u := url.URL{
+			Scheme: "postgres",
+			User:   url.UserPassword(c.spec.User, c.spec.Password),
+			Host:   host + ":" + port,
+			Path:   "/" + dbName,
+		}
+		fmt.Printf("Connect with: psql %q\n", u.String())
+	}
+	if len(c.spec.Publish) == 0 {
+		fmt.Printf("Connect with: docker exec -it %s psql -U %s -d %s\n", c.spec.Name, c.spec.User, dbName)
+	}
+}
+
+// publishedAddress returns the host address and port of a -p style
+// "[ip:]hostPort:containerPort" mapping; ok is false when the host port is
+// left for docker to pick
+func publishedAddress(mapping string) (host, port string, ok bool) {
+	parts := strings.Split(mapping, ":")
+	switch {
+	case len(parts) == 3 && parts[1] != "":
+		if parts[0] != "" && parts[0] != "0.0.0.0" {
+			return parts[0], parts[1], true
+		}
+		return "localhost", parts[1], true
+	case len(parts) == 2 && parts[0] != "":
+		return "localhost", parts[0], true
+	}
+	return "", "", false
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/alert"
+	"github.com/iostate/back-it-up/internal/catalog"
+	"github.com/iostate/back-it-up/internal/config"
+	"github.com/iostate/back-it-up/internal/control"
+	"github.com/iostate/back-it-up/internal/schedule"
+)
+
+// daemonOutputLines is how many of a run's last output lines are kept for
+// its error context
+const daemonOutputLines = 20
+
+// daemonJob is a job of the config file the daemon runs on its schedule
+type daemonJob struct {
+	name          string
+	schedule      string
+	cron          *schedule.Cron
+	jitter        time.Duration
+	maxConcurrent int
+	rpo           time.Duration
+	priority      int
+	// blackouts are the file's windows and the job's own, in which runs
+	// aren't started
+	blackouts schedule.Blackouts
+	// database and container find the job's backups in the catalog
+	database, container string
+	// args are the back-it-up command line of a run
+	args []string
+}
+
+// daemonJobs returns the jobs in the config file at path that have a
+// schedule. Backups run as backup --job, so the file is read afresh by
+// each run and flags given there match what --job would take; backupArgs
+// are added to each.
+func daemonJobs(cfg *config.File, path string, backupArgs []string) ([]daemonJob, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []daemonJob
+	for _, name := range cfg.Names() {
+		job := cfg.Jobs[name]
+		if job.Schedule == "" {
+			continue
+		}
+		d := daemonJob{name: name, schedule: job.Schedule, maxConcurrent: job.MaxConcurrent}
+		// Both were checked when the file was loaded
+		d.cron, _ = schedule.ParseCron(job.Schedule)
+		d.jitter, _ = job.JitterDuration()
+		d.rpo, _ = job.RPODuration()
+		d.priority = job.Priority
+		if d.blackouts, err = schedule.ParseBlackouts(slices.Concat(cfg.Blackouts, job.Blackouts)); err != nil {
+			return nil, err
+		}
+		if d.maxConcurrent == 0 {
+			d.maxConcurrent = 1
+		}
+		if job.RunsBackup() {
+			d.database, d.container = job.Database, job.Container
+			if d.container == "" {
+				d.container = job.Host
+			}
+			d.args = append([]string{"backup", "--config", abs, "--job", name}, backupArgs...)
+		} else if job.Command == "standby" {
+			// A scheduled standby syncs once a run, paused and tracked
+			// under the job's own name
+			d.args = append([]string{"standby", "--once", "--job-name", name}, job.Args...)
+		} else {
+			d.args = append([]string{job.Command}, job.Args...)
+		}
+		jobs = append(jobs, d)
+	}
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("no job in %s has a schedule", path)
+	}
+	return jobs, nil
+}
+
+func runDaemon(args []string) error {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	configPath := fs.String("config", config.DefaultPath, "Config file of the jobs to run")
+	logFormat := fs.String("log-format", "json", "Log format: json or text")
+	controlDir := fs.String("control-dir", control.DefaultDir, "Directory holding job pause markers")
+	catalogPath := fs.String("catalog", catalog.DefaultPath, "Catalog the jobs' backups are recorded in, for when each last succeeded")
+	alertCooldown := fs.Duration("alert-cooldown", 0, "Suppress an alert identical to the job's last one for this long")
+	alertCommand := fs.String("alert-command", "", "Shell command run for each failure alerted")
+	escalateAfter := fs.Int("escalate-after", 0, "Run --escalate-command once a job has failed this many times in a row")
+	escalateCommand := fs.String("escalate-command", "", "Shell command alerting a second channel, e.g. a pager")
+	metricsAddr := fs.String("metrics-addr", "", "Address to serve Prometheus metrics on (e.g. :9189)")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *alertCooldown < 0 || *escalateAfter < 0 {
+		return fmt.Errorf("--alert-cooldown and --escalate-after can't be negative")
+	}
+	if (*escalateAfter > 0) != (*escalateCommand != "") {
+		return fmt.Errorf("--escalate-after and --escalate-command must be used together")
+	}
+
+	var handler slog.Handler
+	switch *logFormat {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stdout, nil)
+	case "text":
+		handler = slog.NewTextHandler(os.Stdout, nil)
+	default:
+		return fmt.Errorf("invalid --log-format %q (expected json or text)", *logFormat)
+	}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return err
+	}
+	// Backups register in the daemon's control directory, so job cancel and
+	// pauses see them, and hold back repeated failures from Slack and
+	// webhooks for the daemon's cool-down
+	controlAbs, err := filepath.Abs(*controlDir)
+	if err != nil {
+		return err
+	}
+	backupArgs := []string{"--control-dir", controlAbs}
+	if *alertCooldown > 0 {
+		backupArgs = append(backupArgs, "--notify-cooldown", alertCooldown.String())
+	}
+	jobs, err := daemonJobs(cfg, *configPath, backupArgs)
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the back-it-up binary: %w", err)
+	}
+
+	d := &daemon{
+		exe:             exe,
+		log:             slog.New(handler),
+		control:         control.Open(*controlDir),
+		catalog:         catalog.Open(*catalogPath),
+		alerts:          alert.NewTracker(alert.Policy{Cooldown: *alertCooldown, EscalateAfter: *escalateAfter}),
+		alertCommand:    *alertCommand,
+		escalateCommand: *escalateCommand,
+		running:         make(map[string]int),
+		succeeded:       make(map[string]time.Time),
+		blackoutSkips:   make(map[string]int),
+		free:            cfg.MaxConcurrent,
+		capped:          cfg.MaxConcurrent > 0,
+		waiting:         make(map[string][]chan struct{}),
+	}
+
+	if *metricsAddr != "" {
+		stopMetrics := serveMetrics(*metricsAddr, d.metricsHandler(jobs), func(err error) {
+			d.log.Error("metrics server failed", "error", err.Error())
+		})
+		defer stopMetrics()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	d.log.Info("daemon started", "config", *configPath, "jobs", len(jobs), "max_concurrent", cfg.MaxConcurrent, "metrics_addr", *metricsAddr)
+	var scheduling sync.WaitGroup
+	for _, job := range jobs {
+		scheduling.Add(1)
+		go func() {
+			defer scheduling.Done()
+			d.schedule(ctx, job)
+		}()
+	}
+	scheduling.Wait()
+
+	d.log.Info("daemon stopping, waiting for runs in progress")
+	d.runs.Wait()
+	d.log.Info("daemon stopped")
+	return nil
+}
+
+// daemon runs jobs on their schedules, each run as a child back-it-up
+// process so it keeps its own run log, scratch directory, and catalog
+// entries
+type daemon struct {
+	exe     string
+	log     *slog.Logger
+	control *control.Dir
+	catalog *catalog.Catalog
+	alerts  *alert.Tracker
+	// alertCommand and escalateCommand are run when alerts notifies or
+	// escalates a failure
+	alertCommand    string
+	escalateCommand string
+
+	mu      sync.Mutex
+	running map[string]int
+	// succeeded is when each job last succeeded in this daemon
+	succeeded map[string]time.Time
+	// blackoutSkips counts each job's runs skipped by blackout windows
+	blackoutSkips map[string]int
+	// With capped, free is how many more runs may start, and runs due
+	// past it wait in queue, each woken by closing its channel in waiting
+	capped  bool
+	free    int
+	queue   schedule.Queue
+	waiting map[string][]chan struct{}
+	runs    sync.WaitGroup
+}
+
+// schedule starts job at each time its schedule selects, plus jitter,
+// until ctx is done. A job already past its RPO starts right away, so the
+// backlog of a daemon that was down is caught up, most urgent first.
+func (d *daemon) schedule(ctx context.Context, job daemonJob) {
+	if job.rpo > 0 {
+		if last := d.lastSuccess(job); time.Since(last) > job.rpo {
+			attrs := []any{"job", job.name, "rpo", job.rpo.String()}
+			if !last.IsZero() {
+				attrs = append(attrs, "last_success", last)
+			}
+			d.log.Info("job overdue", attrs...)
+			d.start(ctx, job, time.Now())
+		}
+	}
+	for {
+		next := job.cron.Next(time.Now())
+		if next.IsZero() {
+			d.log.Warn("job never runs", "job", job.name, "schedule", job.schedule)
+			return
+		}
+		at := next
+		if job.jitter > 0 {
+			at = at.Add(rand.N(job.jitter))
+		}
+		d.log.Info("job scheduled", "job", job.name, "at", at)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(at)):
+		}
+		d.start(ctx, job, next)
+	}
+}
+
+// start runs job in the background, unless it's paused, in a blackout
+// window, or already running as often as it may
+func (d *daemon) start(ctx context.Context, job daemonJob, scheduled time.Time) {
+	if pause, ok := d.pause(job.name); ok {
+		d.log.Info("job skipped", "job", job.name, "reason", "paused", "paused_reason", pause.Reason)
+		return
+	}
+	if window, until, ok := job.blackouts.ActiveAt(time.Now()); ok {
+		d.mu.Lock()
+		d.blackoutSkips[job.name]++
+		d.mu.Unlock()
+		d.log.Info("job skipped", "job", job.name, "reason", "blackout", "window", window.String(), "until", until)
+		return
+	}
+	d.mu.Lock()
+	if d.running[job.name] >= job.maxConcurrent {
+		running := d.running[job.name]
+		d.mu.Unlock()
+		d.log.Warn("job skipped", "job", job.name, "reason", "still running", "running", running)
+		return
+	}
+	d.running[job.name]++
+	d.mu.Unlock()
+
+	d.runs.Add(1)
+	go func() {
+		defer d.runs.Done()
+		defer func() {
+			d.mu.Lock()
+			d.running[job.name]--
+			d.mu.Unlock()
+		}()
+		if !d.acquire(ctx, job) {
+			return
+		}
+		defer d.release()
+		d.run(job, scheduled)
+	}()
+}
+
+// acquire waits for a slot for a run of job, and reports false if ctx is
+// done first. Runs that have to wait are queued by deadline, from the
+// job's RPO and last success, then priority.
+func (d *daemon) acquire(ctx context.Context, job daemonJob) bool {
+	if !d.capped {
+		return true
+	}
+	task := schedule.Task{Name: job.name, Priority: job.priority, RPO: job.rpo}
+	if job.rpo > 0 {
+		task.LastSuccess = d.lastSuccess(job)
+	}
+
+	d.mu.Lock()
+	if d.free > 0 && d.queue.Len() == 0 {
+		d.free--
+		d.mu.Unlock()
+		return true
+	}
+	ready := make(chan struct{})
+	d.queue.Push(task)
+	d.waiting[job.name] = append(d.waiting[job.name], ready)
+	queued := d.queue.Len()
+	d.mu.Unlock()
+
+	attrs := []any{"job", job.name, "queued", queued}
+	if deadline := task.Deadline(); !deadline.IsZero() {
+		attrs = append(attrs, "deadline", deadline)
+	}
+	d.log.Info("job waiting for a slot", attrs...)
+	select {
+	case <-ready:
+		return true
+	case <-ctx.Done():
+		// The daemon is stopping, so a slot handed over now isn't missed
+		return false
+	}
+}
+
+// release frees a run's slot, handing it to the most urgent waiting run
+func (d *daemon) release() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	task, ok := d.queue.Pop()
+	if !ok {
+		d.free++
+		return
+	}
+	// Waiting runs of one job are alike, so they go in the order they came
+	waiting := d.waiting[task.Name]
+	close(waiting[0])
+	d.waiting[task.Name] = waiting[1:]
+}
+
+// lastSuccess returns when job last succeeded: its newest backup in the
+// catalog, or its last successful run in this daemon if that's newer
+func (d *daemon) lastSuccess(job daemonJob) time.Time {
+	d.mu.Lock()
+	last := d.succeeded[job.name]
+	d.mu.Unlock()
+	if job.database == "" {
+		return last
+	}
+	e, ok, err := d.catalog.Latest(func(e catalog.Entry) bool {
+		return e.Kind == catalog.KindBackup && e.DatabaseName == job.database && (job.container == "" || e.ContainerName == job.container)
+	})
+	if err != nil {
+		d.log.Warn("failed to read catalog", "job", job.name, "error", err.Error())
+	}
+	if ok && e.CreatedAt.After(last) {
+		last = e.CreatedAt
+	}
+	return last
+}
+
+// pause returns the job's pause marker, if it is paused
+func (d *daemon) pause(job string) (control.Pause, bool) {
+	pauses, err := d.control.List()
+	if err != nil {
+		return control.Pause{}, false
+	}
+	for _, p := range pauses {
+		if p.Job == job {
+			return p, true
+		}
+	}
+	return control.Pause{}, false
+}
+
+// run runs job once and logs how it went, alerting on failure
+func (d *daemon) run(job daemonJob, scheduled time.Time) {
+	cmd := exec.Command(d.exe, job.args...)
+	output := &outputTail{max: daemonOutputLines}
+	cmd.Stdout, cmd.Stderr = output, output
+
+	started := time.Now()
+	d.log.Info("job started", "job", job.name, "scheduled", scheduled)
+	err := cmd.Run()
+	duration := time.Since(started).Round(time.Millisecond)
+	runID := output.runID()
+
+	if err == nil {
+		d.mu.Lock()
+		d.succeeded[job.name] = started
+		d.mu.Unlock()
+		attrs := []any{"job", job.name, "run_id", runID, "duration", duration.String()}
+		if failures := d.alerts.Success(job.name); failures > 0 {
+			attrs = append(attrs, "recovered_after", failures)
+		}
+		d.log.Info("job finished", attrs...)
+		return
+	}
+
+	message := output.errorLine()
+	if message == "" {
+		message = err.Error()
+	}
+	exitCode := -1
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	}
+	decision := d.alerts.Failure(job.name, message)
+	attrs := []any{"job", job.name, "run_id", runID, "duration", duration.String(),
+		"exit_code", exitCode, "error", message, "consecutive_failures", decision.Consecutive,
+		"alerted", decision.Notify}
+	if decision.Suppressed > 0 {
+		attrs = append(attrs, "suppressed_alerts", decision.Suppressed)
+	}
+	d.log.Error("job failed", append(attrs, "output", output.lines())...)
+
+	a := alert.Alert{Job: job.name, Message: message, Consecutive: decision.Consecutive}
+	if decision.Notify && d.alertCommand != "" {
+		if err := alert.Exec(d.alertCommand, a); err != nil {
+			d.log.Warn("alert command failed", "job", job.name, "error", err.Error())
+		}
+	}
+	if decision.Escalate {
+		d.log.Warn("job escalated", "job", job.name, "consecutive_failures", decision.Consecutive)
+		if err := alert.Exec(d.escalateCommand, a); err != nil {
+			d.log.Warn("escalate command failed", "job", job.name, "error", err.Error())
+		}
+	}
+}
+
+// metricsHandler serves, for each of jobs, whether a blackout window is
+// holding it back and how many of its runs were skipped by one
+func (d *daemon) metricsHandler(jobs []daemonJob) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintln(w, "# HELP backitup_daemon_in_blackout Whether a blackout window holds back the job's runs.")
+		fmt.Fprintln(w, "# TYPE backitup_daemon_in_blackout gauge")
+		for _, job := range jobs {
+			blackout := 0
+			if _, _, ok := job.blackouts.ActiveAt(now); ok {
+				blackout = 1
+			}
+			fmt.Fprintf(w, "backitup_daemon_in_blackout{job=%q} %d\n", job.name, blackout)
+		}
+		fmt.Fprintln(w, "# HELP backitup_daemon_blackout_skips_total Scheduled runs skipped by blackout windows.")
+		fmt.Fprintln(w, "# TYPE backitup_daemon_blackout_skips_total counter")
+		for _, job := range jobs {
+			fmt.Fprintf(w, "backitup_daemon_blackout_skips_total{job=%q} %d\n", job.name, d.blackoutSkips[job.name])
+		}
+	}
+}
+
+// outputTail keeps the last lines written to it, and the run ID a backup
+// announces
+type outputTail struct {
+	max int
+
+	mu      sync.Mutex
+	partial []byte
+	tail    []string
+	id      string
+}
+
+func (o *outputTail) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.partial = append(o.partial, p...)
+	for {
+		i := bytes.IndexByte(o.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		o.add(string(o.partial[:i]))
+		o.partial = o.partial[i+1:]
+	}
+}
+
+func (o *outputTail) add(line string) {
+	if id, ok := strings.CutPrefix(line, "Run ID: "); ok && o.id == "" {
+		o.id = id
+	}
+	o.tail = append(o.tail, line)
+	if len(o.tail) > o.max {
+		o.tail = o.tail[1:]
+	}
+}
+
+// lines returns the kept lines, with any unterminated last one
+func (o *outputTail) lines() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.partial) > 0 {
+		o.add(string(o.partial))
+		o.partial = nil
+	}
+	return append([]string(nil), o.tail...)
+}
+
+// runID returns the run ID the run printed, if any
+func (o *outputTail) runID() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.id
+}
+
+// errorLine returns the message of the last "Error: " line written
+func (o *outputTail) errorLine() string {
+	lines := o.lines()
+	for i := len(lines) - 1; i >= 0; i-- {
+		if message, ok := strings.CutPrefix(lines[i], "Error: "); ok {
+			return message
+		}
+	}
+	return ""
+}
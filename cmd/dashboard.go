@@ -0,0 +1,81 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/access"
+	"github.com/iostate/back-it-up/internal/catalog"
+	"github.com/iostate/back-it-up/internal/control"
+)
+
+// dashboardEntries is how many recent catalog entries the dashboard shows
+const dashboardEntries = 50
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"since": func(t time.Time) string { return formatAge(time.Since(t)) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>back-it-up</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2rem; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2rem; }
+th, td { text-align: left; padding: .3rem 1rem .3rem 0; border-bottom: 1px solid #ddd; }
+.muted { color: #777; }
+</style>
+</head>
+<body>
+<p class="muted">Signed in as {{.Token.Name}} ({{.Token.Role}}{{if .Token.Jobs}}, jobs {{range $i, $j := .Token.Jobs}}{{if $i}}, {{end}}{{$j}}{{end}}{{end}}){{if .SSO}} · <a href="/logout">Log out</a>{{end}}</p>
+
+<h2>Paused jobs</h2>
+{{if .Paused}}<table>
+<tr><th>Job</th><th>Since</th><th>Reason</th></tr>
+{{range .Paused}}<tr><td>{{.Job}}</td><td>{{since .PausedAt}} ago</td><td>{{.Reason}}</td></tr>
+{{end}}</table>{{else}}<p class="muted">None</p>{{end}}
+
+<h2>Recent activity</h2>
+{{if .Entries}}<table>
+<tr><th>ID</th><th>Kind</th><th>Database</th><th>Container</th><th>When</th><th>Size</th><th>Status</th><th>Tags</th></tr>
+{{range .Entries}}<tr><td>{{printf "%.8s" .ID}}</td><td>{{.Kind}}</td><td>{{.DatabaseName}}</td><td>{{.ContainerName}}</td><td>{{since .CreatedAt}} ago</td><td>{{if .Size}}{{.Size}}{{end}}</td><td>{{.Status}}</td><td>{{range $i, $t := .Tags}}{{if $i}}, {{end}}{{$t}}{{end}}</td></tr>
+{{end}}</table>{{else}}<p class="muted">No catalog entries visible to you</p>{{end}}
+</body>
+</html>
+`))
+
+// handleDashboard renders a read-only overview of what tok may see
+func (s *server) handleDashboard(w http.ResponseWriter, r *http.Request, tok access.Token) {
+	entries, err := s.catalog.Entries()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pauses, err := s.control.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Token   access.Token
+		SSO     bool
+		Paused  []control.Pause
+		Entries []catalog.Entry
+	}{Token: tok, SSO: s.sso != nil}
+	for _, p := range pauses {
+		if tok.Scoped(p.Job) {
+			data.Paused = append(data.Paused, p)
+		}
+	}
+	// Newest first
+	for i := len(entries) - 1; i >= 0 && len(data.Entries) < dashboardEntries; i-- {
+		if entryScoped(tok, entries[i]) {
+			data.Entries = append(data.Entries, entries[i])
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	dashboardTemplate.Execute(w, data)
+}
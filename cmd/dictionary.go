@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/storage"
+)
+
+func runDictionary(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: dictionary train [flags]")
+	}
+
+	switch args[0] {
+	case "train":
+		return runDictionaryTrain(args[1:])
+	default:
+		return fmt.Errorf("unknown dictionary action %q (expected train)", args[0])
+	}
+}
+
+func runDictionaryTrain(args []string) error {
+	fs := flag.NewFlagSet("dictionary train", flag.ExitOnError)
+	dir := fs.String("output", "./backups", "Backup directory to train on; the dictionary is written to its dictionaries/ subdirectory")
+	fs.StringVar(dir, "o", "./backups", "Backup directory to train on (shorthand)")
+	dbName := fs.String("database", "", "Only train on backups of this database (default: every database)")
+	fs.StringVar(dbName, "d", "", "Only train on backups of this database (shorthand)")
+	samples := fs.Int("samples", 20, "Train on this many of the newest plain backups")
+	size := fs.Int("size", backup.DefaultDictionarySize, "Maximum dictionary size in bytes")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *samples < 1 {
+		return fmt.Errorf("--samples must be at least 1")
+	}
+
+	backups, err := backup.ListBackups(*dir, *dbName)
+	if err != nil {
+		return err
+	}
+	var paths []string
+	for i := len(backups) - 1; i >= 0 && len(paths) < *samples; i-- {
+		if backup.DumpFormat(backups[i].Path) == backup.FormatPlain {
+			paths = append(paths, backups[i].Path)
+		}
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no plain backups to train on in %s", *dir)
+	}
+
+	name := *dbName
+	if name == "" {
+		name = "all"
+	}
+	out := backup.DictionaryPath(*dir, name, time.Now())
+	fmt.Printf("Training a dictionary on %d backup(s)...\n", len(paths))
+	id, err := backup.TrainDictionary(paths, out, *size)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(out)
+	if err != nil {
+		return fmt.Errorf("failed to stat dictionary: %w", err)
+	}
+	fmt.Printf("✓ Dictionary %d written to %s (%d bytes)\n", id, out, info.Size())
+	fmt.Printf("Compress later backups with: back-it-up backup --dictionary %s ...\n", out)
+	return nil
+}
+
+// mirrorDictionary copies a dictionary into the dictionaries directory of
+// each mirror, where its mirrored backups look for it
+func mirrorDictionary(backupSvc *backup.Service, dictionary string, mirrorDirs []string) error {
+	dirs := make([]string, len(mirrorDirs))
+	for i, dir := range mirrorDirs {
+		dirs[i] = filepath.Join(dir, backup.DictionaryDir)
+		if storage.IsLocation(dir) {
+			dirs[i] = strings.TrimSuffix(dir, "/") + "/" + backup.DictionaryDir
+		}
+	}
+	if err := backupSvc.Mirror(dictionary, dirs); err != nil {
+		return fmt.Errorf("replication of dictionary failed: %w", err)
+	}
+	return nil
+}
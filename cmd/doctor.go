@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/iostate/back-it-up/internal/local"
+)
+
+// installHint is how to get the PostgreSQL client tools on one platform
+type installHint struct {
+	name     string
+	label    string
+	commands []string
+	note     string
+}
+
+var installHints = []installHint{
+	{name: "macos", label: "macOS (Homebrew)", commands: []string{"brew install libpq", "brew link --force libpq"},
+		note: "libpq is keg-only, so link it (or add $(brew --prefix libpq)/bin to PATH)"},
+	{name: "windows", label: "Windows (Scoop)", commands: []string{"scoop install postgresql"}},
+	{name: "debian", label: "Debian/Ubuntu", commands: []string{"sudo apt-get update", "sudo apt-get install -y postgresql-client"},
+		note: "for a client matching a newer server, add the PGDG repository and install postgresql-client-<major>"},
+	{name: "fedora", label: "Fedora/RHEL", commands: []string{"sudo dnf install -y postgresql"}},
+	{name: "alpine", label: "Alpine", commands: []string{"apk add --no-cache postgresql16-client"},
+		note: "pick the package for the server's major version, e.g. postgresql15-client"},
+	{name: "arch", label: "Arch Linux", commands: []string{"sudo pacman -S --needed postgresql-libs"}},
+	{name: "suse", label: "openSUSE/SLES", commands: []string{"sudo zypper install -y postgresql"}},
+}
+
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	hints := fs.Bool("install-hints", false, "Print commands that install the missing client tools")
+	osName := fs.String("os", "", "Print install hints for this platform instead of the detected one: "+hintNames())
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *osName != "" {
+		if _, ok := lookupHint(*osName); !ok {
+			return fmt.Errorf("unknown --os %q (expected %s)", *osName, hintNames())
+		}
+	}
+
+	image := os.Getenv(clientImageEnvVar)
+	fmt.Println("PostgreSQL client tools (needed by --host):")
+	for _, tool := range local.RequiredTools {
+		path, err := exec.LookPath(tool)
+		if err != nil {
+			fmt.Printf("  ✗ %s not on PATH\n", tool)
+			continue
+		}
+		detail := path
+		if out, err := exec.Command(path, "--version").Output(); err == nil {
+			detail += ", " + strings.TrimSpace(string(out))
+		}
+		fmt.Printf("  ✓ %s (%s)\n", tool, detail)
+	}
+
+	fmt.Println("\nDocker (needed without --host, and for helper containers):")
+	dockerPath, dockerErr := exec.LookPath("docker")
+	if dockerErr != nil {
+		fmt.Println("  ✗ docker CLI not on PATH")
+	} else {
+		fmt.Printf("  ✓ docker CLI on PATH (%s)\n", dockerPath)
+	}
+	if image != "" {
+		fmt.Printf("  ✓ --host runs the client tools in helper container %s ($%s)\n", image, clientImageEnvVar)
+		if network, err := helperNetwork(); err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+		} else if network.Name != "" {
+			fmt.Printf("  ✓ helper containers join docker network %s ($%s)\n", network.Name, helperNetworkEnvVar)
+		}
+	}
+
+	missing := local.MissingTools()
+	if len(missing) == 0 && !*hints {
+		fmt.Println("\n✓ Client tools found")
+		return nil
+	}
+	if !*hints {
+		fmt.Println("\nRun back-it-up doctor --install-hints for install commands")
+	} else {
+		printInstallHints(*osName, dockerErr == nil)
+	}
+	if len(missing) > 0 && image == "" {
+		return fmt.Errorf("%d client tool(s) missing for --host mode", len(missing))
+	}
+	return nil
+}
+
+// printInstallHints prints the install commands for osName, or for the
+// detected platform, followed by the helper container fallback
+func printInstallHints(osName string, haveDocker bool) {
+	var platforms []installHint
+	if osName == "" {
+		osName = detectPlatform()
+	}
+	if hint, ok := lookupHint(osName); ok {
+		platforms = []installHint{hint}
+	} else {
+		fmt.Println("\nCouldn't tell which platform this is; pick the matching commands:")
+		platforms = installHints
+	}
+
+	for _, hint := range platforms {
+		fmt.Printf("\nInstall the client tools on %s:\n", hint.label)
+		for _, cmd := range hint.commands {
+			fmt.Printf("  %s\n", cmd)
+		}
+		if hint.note != "" {
+			fmt.Printf("  (%s)\n", hint.note)
+		}
+	}
+	fmt.Println("\nThe client's major version must be at least the server's.")
+
+	fmt.Println("\nOr skip the install and run the client tools in a helper container:")
+	fmt.Printf("  export %s=postgres:16\n", clientImageEnvVar)
+	if haveDocker {
+		fmt.Println("  (use the image of the server's major version; the container shares this host's network)")
+	} else {
+		fmt.Println("  (this needs docker, which isn't on PATH here)")
+	}
+}
+
+// detectPlatform names the install hint matching this machine, or "" if
+// none does
+func detectPlatform() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "macos"
+	case "windows":
+		return "windows"
+	case "linux":
+		return linuxDistribution("/etc/os-release")
+	}
+	return ""
+}
+
+// linuxDistribution maps the ID and ID_LIKE of an os-release file to an
+// install hint
+func linuxDistribution(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if ok && (key == "ID" || key == "ID_LIKE") {
+			ids = append(ids, strings.Fields(strings.Trim(value, `"'`))...)
+		}
+	}
+	for _, id := range ids {
+		switch id {
+		case "debian", "ubuntu":
+			return "debian"
+		case "fedora", "rhel", "centos":
+			return "fedora"
+		case "alpine", "arch":
+			return id
+		case "suse", "opensuse", "sles":
+			return "suse"
+		}
+	}
+	return ""
+}
+
+func lookupHint(name string) (installHint, bool) {
+	for _, hint := range installHints {
+		if hint.name == name {
+			return hint, true
+		}
+	}
+	return installHint{}, false
+}
+
+func hintNames() string {
+	names := make([]string, len(installHints))
+	for i, hint := range installHints {
+		names[i] = hint.name
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/dump"
+)
+
+func runDrift(args []string) error {
+	fs := flag.NewFlagSet("drift", flag.ExitOnError)
+	backupPath := fs.String("file", "", "Backup file to compare (required)")
+	fs.StringVar(backupPath, "f", "", "Backup file to compare (shorthand)")
+	containerName := fs.String("container", "", "Container with the live database (required unless --host is set)")
+	fs.StringVar(containerName, "c", "", "Container with the live database (shorthand)")
+	host := fs.String("host", "", hostFlagUsage)
+	noDockerSocket := fs.Bool("no-docker-socket", false, noDockerSocketUsage)
+	dbName := fs.String("database", "postgres", "Database name")
+	fs.StringVar(dbName, "d", "postgres", "Database name (shorthand)")
+	dbUser := fs.String("user", "postgres", "Database user")
+	fs.StringVar(dbUser, "u", "postgres", "Database user (shorthand)")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *backupPath == "" || (*containerName == "" && *host == "") {
+		fmt.Fprintln(os.Stderr, "Error: --file and one of --container or --host are required")
+		fs.Usage()
+		return fmt.Errorf("missing required flags")
+	}
+	if *containerName == "" {
+		*containerName = *host
+	}
+
+	backupSum, err := summarizeBackup(*backupPath)
+	if err != nil {
+		return err
+	}
+
+	dockerSvc, err := newDatabaseService(*host, *noDockerSocket)
+	if err != nil {
+		return err
+	}
+	backupSvc := backup.NewService(dockerSvc)
+	liveSum, err := backupSvc.SchemaSummary(*containerName, *dbName, *dbUser)
+	if err != nil {
+		return err
+	}
+
+	// Only the schema is compared; the live dump carries no data
+	backupSum.Tables, liveSum.Tables = nil, nil
+	d := dump.Compare(backupSum, liveSum)
+	if d.Empty() {
+		fmt.Printf("✓ Schema of '%s' in container '%s' matches the backup\n", *dbName, *containerName)
+		return nil
+	}
+
+	fmt.Printf("Schema drift between the backup and '%s' in container '%s':\n", *dbName, *containerName)
+	fmt.Println("  (+ only in the live database, - only in the backup, ~ changed)")
+	printSchemaChanges(d)
+	return fmt.Errorf("schema has drifted since the backup")
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/iostate/back-it-up/internal/backup"
+)
+
+// identityEnvVar lists age identity files, separated like $PATH, that
+// encrypted backups are decrypted with
+const identityEnvVar = "BACKITUP_AGE_IDENTITY"
+
+// useIdentityFiles decrypts backups with paths, or with the identity files
+// in $BACKITUP_AGE_IDENTITY if there are none
+func useIdentityFiles(paths []string) {
+	if len(paths) == 0 {
+		paths = filepath.SplitList(os.Getenv(identityEnvVar))
+	}
+	backup.SetIdentityFiles(paths)
+}
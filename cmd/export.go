@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/usage"
+)
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	containerName := fs.String("container", "", "Docker container name (required unless --host is set)")
+	fs.StringVar(containerName, "c", "", "Docker container name (shorthand)")
+	host := fs.String("host", "", hostFlagUsage)
+	noDockerSocket := fs.Bool("no-docker-socket", false, noDockerSocketUsage)
+	outputDir := fs.String("output", "./export", "Directory to write the export to")
+	fs.StringVar(outputDir, "o", "./export", "Directory to write the export to (shorthand)")
+	dbName := fs.String("database", "postgres", "Database name")
+	fs.StringVar(dbName, "d", "postgres", "Database name (shorthand)")
+	dbUser := fs.String("user", "postgres", "Database user")
+	fs.StringVar(dbUser, "u", "postgres", "Database user (shorthand)")
+	chunkMB := fs.Int("chunk-mb", backup.DefaultChunkSize>>20, "Maximum chunk size in MiB")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *containerName == "" && *host == "" {
+		fmt.Fprintln(os.Stderr, "Error: --container or --host flag is required")
+		fs.Usage()
+		return fmt.Errorf("missing required flag: --container")
+	}
+	if *containerName == "" {
+		*containerName = *host
+	}
+	if *chunkMB <= 0 {
+		return fmt.Errorf("--chunk-mb must be positive")
+	}
+
+	dockerSvc, err := newDatabaseService(*host, *noDockerSocket)
+	if err != nil {
+		return err
+	}
+	backupSvc := backup.NewService(dockerSvc)
+
+	fmt.Printf("Verifying container '%s' exists...\n", *containerName)
+	if err := dockerSvc.VerifyContainer(*containerName); err != nil {
+		return fmt.Errorf("container verification failed: %w", err)
+	}
+
+	fmt.Println("Starting export...")
+	manifestPath, manifest, err := backupSvc.Export(backup.ExportConfig{
+		ContainerName: *containerName,
+		DatabaseName:  *dbName,
+		DatabaseUser:  *dbUser,
+		OutputDir:     *outputDir,
+		ChunkSize:     int64(*chunkMB) << 20,
+	})
+	if err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+	recordUsage(usage.OpExport, manifest.Size, false)
+
+	fmt.Printf("Export completed successfully: %s (%d chunk(s), %d bytes, sha256 %s)\n",
+		manifestPath, len(manifest.Chunks), manifest.Size, manifest.Checksum)
+	return nil
+}
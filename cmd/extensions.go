@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/iostate/back-it-up/internal/backup"
+)
+
+// checkExtensions compares the extensions a restore left in the database
+// with the versions its backup's manifest recorded, and warns about those
+// the server ships a newer version of, which with update it moves to. A
+// dump creates extensions without a version, so a restore onto a newer
+// server quietly gets the server's, and one into an existing database keeps
+// whatever was there. Recorded is nil for backups without a manifest.
+func checkExtensions(backupSvc *backup.Service, containerName, dbName, dbUser string, recorded map[string]string, update bool) error {
+	extensions, err := backupSvc.Extensions(containerName, dbName, dbUser)
+	if err != nil {
+		if update {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: couldn't check extensions: %v\n", err)
+		return nil
+	}
+
+	var outdated []backup.Extension
+	updated := make(map[string]bool)
+	for _, e := range extensions {
+		if e.Outdated() {
+			outdated = append(outdated, e)
+		}
+	}
+	switch {
+	case len(outdated) == 0:
+	case update:
+		if err := backupSvc.UpdateExtensions(containerName, dbName, dbUser, outdated); err != nil {
+			return err
+		}
+		for _, e := range outdated {
+			fmt.Printf("✓ Updated extension %s from %s to %s\n", e.Name, e.Installed, e.Available)
+			updated[e.Name] = true
+		}
+	default:
+		for _, e := range outdated {
+			fmt.Fprintf(os.Stderr, "Warning: extension %s is at %s, but the server ships %s\n", e.Name, e.Installed, e.Available)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: their functions and types may not match the server's libraries; pass --update-extensions to restores, or update them now with:\n")
+		for _, e := range outdated {
+			fmt.Fprintf(os.Stderr, "  ALTER EXTENSION \"%s\" UPDATE;\n", e.Name)
+		}
+	}
+
+	if len(recorded) == 0 {
+		return nil
+	}
+	installed := make(map[string]string, len(extensions))
+	for _, e := range extensions {
+		installed[e.Name] = e.Installed
+	}
+	names := make([]string, 0, len(recorded))
+	for name := range recorded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	mismatched := 0
+	for _, name := range names {
+		version, ok := installed[name]
+		switch {
+		case !ok:
+			fmt.Fprintf(os.Stderr, "Warning: extension %s (%s in the backup) isn't installed; objects using it weren't restored\n", name, recorded[name])
+			mismatched++
+		case version != recorded[name] && !updated[name]:
+			fmt.Fprintf(os.Stderr, "Warning: extension %s was %s in the backup, but is %s here\n", name, recorded[name], version)
+			mismatched++
+		}
+	}
+	if mismatched == 0 && len(outdated) == 0 {
+		fmt.Printf("✓ %d extension(s) at the versions in the backup\n", len(recorded))
+	}
+	return nil
+}
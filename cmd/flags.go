@@ -0,0 +1,215 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/iostate/back-it-up/internal/schedule"
+)
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// metaFlag is a repeatable key=value flag
+type metaFlag map[string]string
+
+func (m *metaFlag) String() string {
+	return formatMeta(*m)
+}
+
+func (m *metaFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" || strings.ContainsAny(key, " \t,") {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	if *m == nil {
+		*m = metaFlag{}
+	}
+	if _, dup := (*m)[key]; dup {
+		return fmt.Errorf("%s is given twice", key)
+	}
+	(*m)[key] = val
+	return nil
+}
+
+// formatMeta renders annotations as key=value pairs sorted by key
+func formatMeta(meta map[string]string) string {
+	pairs := make([]string, 0, len(meta))
+	for key, value := range meta {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// flagWasSet reports whether any of the named flags was given on the command line
+func flagWasSet(fs *flag.FlagSet, names ...string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		for _, name := range names {
+			if f.Name == name {
+				set = true
+			}
+		}
+	})
+	return set
+}
+
+// envPrefix starts the environment variable every long flag can be set
+// with, as BACKITUP_DATABASE for --database
+const envPrefix = "BACKITUP_"
+
+// noEnvFlags can't be set from the environment: overriding a protected
+// container's guard, skipping a confirmation, and asking for what it
+// confirms have to be asked for on each command line
+var noEnvFlags = map[string]bool{"i-know-what-im-doing": true, "yes": true, "y": true, "drop": true, "clear": true}
+
+// ownEnvVars are read by the commands in syntaxes of their own, such as a
+// comma-separated list, rather than as their flag's value
+var ownEnvVars = map[string]bool{
+	protectEnvVar:           true,
+	schedule.BlackoutEnvVar: true,
+	caCertEnvVar:            true,
+	insecureEnvVar:          true,
+	noDockerSocketEnvVar:    true,
+	inventoryEnvVar:         true,
+}
+
+// parseFlags parses args into fs, then sets each flag they leave out from
+// its environment variable, so the order of precedence is flag, then
+// environment, then a --job's config file
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	given := givenFlags(fs)
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envVarFor(f.Name)
+		value, ok := os.LookupEnv(name)
+		// Shorthands share their long flag's variable
+		if !ok || err != nil || len(f.Name) == 1 || given[f.Value] || noEnvFlags[f.Name] || ownEnvVars[name] {
+			return
+		}
+		values := []string{value}
+		switch f.Value.(type) {
+		case *stringList, *metaFlag:
+			// A repeatable flag takes a value per line
+			values = strings.FieldsFunc(value, func(r rune) bool { return r == '\n' || r == '\r' })
+		}
+		for _, v := range values {
+			if setErr := fs.Set(f.Name, strings.TrimSpace(v)); setErr != nil {
+				err = fmt.Errorf("invalid $%s %q: %w", name, value, setErr)
+				return
+			}
+		}
+		given[f.Value] = true
+	})
+	return err
+}
+
+// envVarFor returns the environment variable of the flag called name
+func envVarFor(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// givenFlags returns the values of the flags set so far. Shorthands share
+// their long flag's value, so -c counts as --container.
+func givenFlags(fs *flag.FlagSet) map[flag.Value]bool {
+	given := make(map[flag.Value]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Value] = true })
+	return given
+}
+
+// parseTimeBound accepts an RFC 3339 timestamp, a local "YYYY-MM-DD hh:mm[:ss]"
+// time, or a date; empty means unbounded
+func parseTimeBound(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{time.DateTime, "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+// longDuration is a duration flag that also takes days and weeks, as 30d
+// or 2w
+type longDuration time.Duration
+
+func (d *longDuration) String() string {
+	if *d == 0 {
+		return "0"
+	}
+	return time.Duration(*d).String()
+}
+
+func (d *longDuration) Set(value string) error {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if number, ok := strings.CutSuffix(value, suffix); ok {
+			n, err := strconv.ParseFloat(number, 64)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid duration %q (expected e.g. 36h, 30d, or 2w)", value)
+			}
+			*d = longDuration(n * float64(unit))
+			return nil
+		}
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		return fmt.Errorf("invalid duration %q (expected e.g. 36h, 30d, or 2w)", value)
+	}
+	*d = longDuration(parsed)
+	return nil
+}
+
+// byteSize is a size flag such as 512K, 20MB, or 1.5GiB. Units are powers
+// of 1024, as formatBytes prints them.
+type byteSize int64
+
+func (b *byteSize) String() string {
+	if *b == 0 {
+		return "0"
+	}
+	return formatBytes(int64(*b))
+}
+
+func (b *byteSize) Set(value string) error {
+	number := strings.TrimRightFunc(value, unicode.IsLetter)
+	unit := strings.ToUpper(strings.TrimSpace(value[len(number):]))
+	n, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q (expected e.g. 512K, 20MB, or 1.5GiB)", value)
+	}
+	unit = strings.TrimSuffix(strings.TrimSuffix(unit, "B"), "I")
+	exp := strings.Index("KMGTPE", unit)
+	if unit != "" && (len(unit) != 1 || exp < 0) {
+		return fmt.Errorf("invalid size %q (expected e.g. 512K, 20MB, or 1.5GiB)", value)
+	}
+	for i := 0; unit != "" && i <= exp; i++ {
+		n *= 1024
+	}
+	*b = byteSize(n)
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestParseFlagsFromEnvironment(t *testing.T) {
+	t.Setenv("BACKITUP_DATABASE", "from-env")
+	t.Setenv("BACKITUP_CONTAINER", "from-env")
+	t.Setenv("BACKITUP_TAG", "a\nb")
+	for _, name := range []string{"BACKITUP_YES", "BACKITUP_Y", "BACKITUP_DROP", "BACKITUP_CLEAR", "BACKITUP_I_KNOW_WHAT_IM_DOING"} {
+		t.Setenv(name, "true")
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	database := fs.String("database", "", "")
+	container := fs.String("container", "", "")
+	fs.StringVar(container, "c", "", "")
+	var tags stringList
+	fs.Var(&tags, "tag", "")
+	yes := fs.Bool("yes", false, "")
+	fs.BoolVar(yes, "y", false, "")
+	drop := fs.Bool("drop", false, "")
+	clearFirst := fs.Bool("clear", false, "")
+	override := fs.Bool("i-know-what-im-doing", false, "")
+	if err := parseFlags(fs, []string{"-c", "from-flag"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if *database != "from-env" {
+		t.Errorf("database = %q, want the environment's", *database)
+	}
+	if *container != "from-flag" {
+		t.Errorf("container = %q, want the shorthand flag's", *container)
+	}
+	if len(tags) != 2 || tags[0] != "a" || tags[1] != "b" {
+		t.Errorf("tags = %q, want a value per line", tags)
+	}
+	if *yes || *drop || *clearFirst || *override {
+		t.Errorf("yes=%v drop=%v clear=%v override=%v; confirmations must not come from the environment", *yes, *drop, *clearFirst, *override)
+	}
+}
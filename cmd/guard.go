@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/catalog"
+)
+
+// defaultGuardTag is the tag guard looks for on pre-migration backups
+const defaultGuardTag = "pre-migration"
+
+// migrationFile is a migration in the working tree and when it last changed
+type migrationFile struct {
+	path    string
+	modTime time.Time
+}
+
+func runGuard(args []string) error {
+	fs := flag.NewFlagSet("guard", flag.ExitOnError)
+	migrationsDir := fs.String("detect-migrations", "", "Directory of migration files to watch (required)")
+	dbName := fs.String("database", "postgres", "Database the migrations run against")
+	fs.StringVar(dbName, "d", "postgres", "Database the migrations run against (shorthand)")
+	containerName := fs.String("container", "", "Only accept backups taken from this container")
+	fs.StringVar(containerName, "c", "", "Only accept backups taken from this container (shorthand)")
+	tag := fs.String("tag", defaultGuardTag, "Tag the backup taken before migrating must carry")
+	catalogPath := fs.String("catalog", catalog.DefaultPath, "Backup catalog file")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *migrationsDir == "" {
+		fmt.Fprintln(os.Stderr, "Error: --detect-migrations is required")
+		fs.Usage()
+		return fmt.Errorf("missing required flags")
+	}
+
+	migrations, err := scanMigrations(*migrationsDir)
+	if err != nil {
+		return err
+	}
+	if len(migrations) == 0 {
+		fmt.Printf("✓ No migration files in %s\n", *migrationsDir)
+		return nil
+	}
+
+	cat := catalog.Open(*catalogPath)
+	last, ok, err := cat.Latest(func(e catalog.Entry) bool {
+		// Only a full backup can undo a migration
+		return catalog.Filter{Kind: catalog.KindBackup, DatabaseName: *dbName, Tag: *tag}.Match(e) &&
+			e.Content == "" && (*containerName == "" || e.ContainerName == *containerName)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read catalog: %w", err)
+	}
+
+	pending := migrations
+	if ok {
+		pending = nil
+		for _, m := range migrations {
+			if m.modTime.After(last.CreatedAt) {
+				pending = append(pending, m)
+			}
+		}
+	}
+	if len(pending) == 0 {
+		if err := verifyCatalogChecksum(last); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Backup %s tagged %q (taken %s) is newer than every migration in %s\n",
+			last.ID, *tag, last.CreatedAt.Format(time.RFC3339), *migrationsDir)
+		return nil
+	}
+
+	if ok {
+		fmt.Printf("%d migration file(s) changed since the last backup of '%s' tagged %q (%s, taken %s):\n",
+			len(pending), *dbName, *tag, last.ID, last.CreatedAt.Format(time.RFC3339))
+	} else {
+		fmt.Printf("%d migration file(s) found, and no backup of '%s' is tagged %q:\n", len(pending), *dbName, *tag)
+	}
+	for _, m := range pending {
+		fmt.Printf("  %s (changed %s)\n", m.path, m.modTime.Format(time.RFC3339))
+	}
+	target := "-c <container>"
+	if *containerName != "" {
+		target = "-c " + *containerName
+	}
+	fmt.Printf("\nTake one before migrating:\n  back-it-up backup %s -d %s --tag %s\n", target, *dbName, *tag)
+	return fmt.Errorf("refusing to proceed: no backup of '%s' tagged %q is newer than the migrations", *dbName, *tag)
+}
+
+// scanMigrations lists the files under dir, oldest change first. Hidden
+// files and directories, such as editor swap files, are skipped.
+func scanMigrations(dir string) ([]migrationFile, error) {
+	var migrations []migrationFile
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		migrations = append(migrations, migrationFile{path: path, modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan migrations: %w", err)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].modTime.Before(migrations[j].modTime)
+	})
+	return migrations, nil
+}
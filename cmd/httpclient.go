@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/iostate/back-it-up/internal/httpclient"
+)
+
+// Environment variables the HTTP clients of every command are configured
+// from, for commands without the flags and the daemon's runs
+const (
+	// caCertEnvVar lists CA certificate files, separated like $PATH
+	caCertEnvVar   = "BACKITUP_CA_CERT"
+	insecureEnvVar = "BACKITUP_INSECURE_SKIP_VERIFY"
+)
+
+// insecureWarned is set once the warning about skipping verification has
+// been printed, so the environment and the flag don't print it twice
+var insecureWarned bool
+
+// tlsFlags are the flags of commands talking to HTTPS servers
+type tlsFlags struct {
+	caCerts  stringList
+	insecure *bool
+}
+
+func addTLSFlags(fs *flag.FlagSet) *tlsFlags {
+	f := &tlsFlags{}
+	fs.Var(&f.caCerts, "ca-cert", "PEM file of a CA to trust besides the system's, e.g. a TLS-intercepting proxy's (repeatable; default $"+caCertEnvVar+")")
+	f.insecure = fs.Bool("insecure-skip-verify", false, "Don't verify TLS certificates at all; anyone on the network path can read and alter what is sent")
+	return f
+}
+
+// apply configures the HTTP clients with the flags
+func (f *tlsFlags) apply() error {
+	return useTLS(f.caCerts, *f.insecure)
+}
+
+// useTLS makes HTTP clients trust caCerts and, if insecure, skip
+// verification, falling back to $BACKITUP_CA_CERT and
+// $BACKITUP_INSECURE_SKIP_VERIFY
+func useTLS(caCerts []string, insecure bool) error {
+	if len(caCerts) == 0 {
+		caCerts = filepath.SplitList(os.Getenv(caCertEnvVar))
+	}
+	if value := os.Getenv(insecureEnvVar); value != "" && !insecure {
+		var err error
+		if insecure, err = strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("invalid $%s %q: expected true or false", insecureEnvVar, value)
+		}
+	}
+	if insecure && !insecureWarned {
+		insecureWarned = true
+		fmt.Fprintln(os.Stderr, "Warning: TLS certificate verification is disabled; anyone on the network path can read and alter backups, credentials, and alerts in transit")
+	}
+	return httpclient.Configure(httpclient.Options{CACerts: caCerts, InsecureSkipVerify: insecure})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/backup"
+)
+
+func runInfo(args []string) error {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	path := fs.String("file", "", "Backup file to describe (required)")
+	fs.StringVar(path, "f", "", "Backup file to describe (shorthand)")
+	asJSON := fs.Bool("json", false, "Print the manifest as JSON")
+	tlsOpts := addTLSFlags(fs)
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := tlsOpts.apply(); err != nil {
+		return err
+	}
+	if *path == "" {
+		fmt.Fprintln(os.Stderr, "Error: --file is required")
+		fs.Usage()
+		return fmt.Errorf("missing required flags")
+	}
+
+	m, err := backup.ReadManifest(*path)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return fmt.Errorf("%s has no manifest (expected %s); it was taken by an older version or copied without it", *path, backup.ManifestPath(*path))
+	}
+	if *asJSON {
+		data, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode manifest: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	format := m.DumpFormat
+	if m.Content != "" {
+		format += ", " + m.Content + " only"
+	}
+	compression := m.Compression
+	if m.CompressionLevel != 0 {
+		compression += fmt.Sprintf(", level %d", m.CompressionLevel)
+	}
+
+	fmt.Printf("Backup:       %s\n", m.Backup)
+	if m.Volume != "" {
+		fmt.Printf("Volume:       %s\n", m.Volume)
+	} else {
+		fmt.Printf("Database:     %s\n", m.DatabaseName)
+		fmt.Printf("Container:    %s\n", m.ContainerName)
+	}
+	fmt.Printf("Format:       %s\n", format)
+	fmt.Printf("Compression:  %s\n", compression)
+	if m.Encryption != "" {
+		fmt.Printf("Encryption:   %s\n", m.Encryption)
+	}
+	if m.PgDumpVersion != "" {
+		fmt.Printf("pg_dump:      %s\n", m.PgDumpVersion)
+	}
+	fmt.Printf("Started:      %s\n", m.StartedAt.Local().Format(time.RFC3339))
+	fmt.Printf("Finished:     %s (took %s)\n", m.FinishedAt.Local().Format(time.RFC3339), m.Duration().Round(time.Second))
+	fmt.Printf("Size:         %s (%s uncompressed)\n", formatBytes(m.Size), formatBytes(m.UncompressedSize))
+	fmt.Printf("SHA-256:      %s\n", m.Checksum)
+	if m.Globals != "" {
+		fmt.Printf("Globals:      %s\n", m.Globals)
+	}
+	fmt.Printf("Taken by:     back-it-up %s\n", m.ToolVersion)
+	if len(m.Extensions) > 0 {
+		names := make([]string, 0, len(m.Extensions))
+		for name := range m.Extensions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		versions := make([]string, len(names))
+		for i, name := range names {
+			versions[i] = name + " " + m.Extensions[name]
+		}
+		fmt.Printf("Extensions:   %s\n", strings.Join(versions, ", "))
+	}
+
+	if len(m.Tables) > 0 {
+		names := make([]string, 0, len(m.Tables))
+		for name := range m.Tables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TABLE\tROWS\tDIGEST")
+		for _, name := range names {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", name, m.Tables[name].Rows, m.Tables[name].Digest)
+		}
+		return w.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/catalog"
+)
+
+// inventoryEnvVar sets the default inventory endpoint for every backup
+const inventoryEnvVar = "BACKITUP_INVENTORY_URL"
+
+// inventoryTemplates are the built-in payload formats. Anything else passed
+// to --inventory-template is read as a text/template file.
+var inventoryTemplates = map[string]string{
+	"json": `{{json .Entry}}`,
+	"servicenow": `{
+  "name": {{json (printf "%s/%s" .Entry.ContainerName .Entry.DatabaseName)}},
+  "short_description": {{json (printf "Backup %s of %s" .Entry.ID .Entry.DatabaseName)}},
+  "u_backup_id": {{json .Entry.ID}},
+  "u_backup_status": {{json .Entry.Kind}},
+  "u_container": {{json .Entry.ContainerName}},
+  "u_database": {{json .Entry.DatabaseName}},
+  "u_location": {{json .Entry.Path}},
+  "u_size_bytes": {{.Entry.Size}},
+  "u_sha256": {{json .Entry.Checksum}},
+  "u_backup_time": {{json (.Entry.CreatedAt.UTC.Format "2006-01-02 15:04:05")}},
+  "u_reported_by": {{json .Host}}
+}`,
+	"backstage": `{
+  "apiVersion": "backstage.io/v1alpha1",
+  "kind": "Resource",
+  "metadata": {
+    "name": {{json (printf "backup-%s" .Entry.DatabaseName)}},
+    "annotations": {
+      "back-it-up/last-backup-id": {{json .Entry.ID}},
+      "back-it-up/last-backup-status": {{json .Entry.Kind}},
+      "back-it-up/last-backup-time": {{json (.Entry.CreatedAt.UTC.Format "2006-01-02T15:04:05Z")}},
+      "back-it-up/location": {{json .Entry.Path}},
+      "back-it-up/sha256": {{json .Entry.Checksum}}{{range $key, $value := .Entry.Meta}},
+      {{json (printf "back-it-up/meta.%s" $key)}}: {{json $value}}{{end}}
+    },
+    "tags": {{json .Entry.Tags}}
+  },
+  "spec": {
+    "type": "database-backup",
+    "owner": "unknown",
+    "dependencyOf": [{{json (printf "resource:default/%s" .Entry.DatabaseName)}}]
+  }
+}`,
+}
+
+// inventoryRecord is the data available to inventory templates
+type inventoryRecord struct {
+	Entry catalog.Entry
+	Host  string
+	// ReportedAt is when the record was sent
+	ReportedAt time.Time
+}
+
+// inventoryConfig describes where and how backup runs are reported
+type inventoryConfig struct {
+	url      string
+	template string
+	headers  []string
+}
+
+// reportInventory sends a catalog entry to the inventory endpoint, if one is
+// configured. Failures are reported as warnings: the backup itself succeeded.
+func reportInventory(cfg inventoryConfig, entry catalog.Entry) {
+	if cfg.url == "" {
+		cfg.url = os.Getenv(inventoryEnvVar)
+	}
+	if cfg.url == "" {
+		return
+	}
+	if err := postInventory(cfg, entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to report backup to inventory: %v\n", err)
+		return
+	}
+	fmt.Println("✓ Reported to inventory")
+}
+
+func postInventory(cfg inventoryConfig, entry catalog.Entry) error {
+	tmpl, err := loadInventoryTemplate(cfg.template)
+	if err != nil {
+		return err
+	}
+
+	host, _ := os.Hostname()
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, inventoryRecord{Entry: entry, Host: host, ReportedAt: time.Now()}); err != nil {
+		return fmt.Errorf("failed to render inventory template: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, cfg.url, &body)
+	if err != nil {
+		return fmt.Errorf("invalid inventory URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for _, spec := range cfg.headers {
+		name, value, ok := strings.Cut(spec, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("invalid --inventory-header %q: expected \"Name: value\"", spec)
+		}
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", cfg.url, resp.Status)
+	}
+	return nil
+}
+
+// loadInventoryTemplate resolves a built-in template name or a template file
+func loadInventoryTemplate(name string) (*template.Template, error) {
+	if name == "" {
+		name = "json"
+	}
+	text, ok := inventoryTemplates[name]
+	if !ok {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read inventory template: %w", err)
+		}
+		text = string(data)
+	}
+
+	tmpl, err := template.New("inventory").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid inventory template: %w", err)
+	}
+	return tmpl, nil
+}
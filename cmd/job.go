@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/control"
+)
+
+// cancelPollInterval is how often a backup checks whether it was cancelled
+const cancelPollInterval = time.Second
+
+func runJob(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: job <pause|resume|cancel|status> [name|run-id]")
+	}
+
+	action := args[0]
+	fs := flag.NewFlagSet("job "+action, flag.ExitOnError)
+	controlDir := fs.String("control-dir", control.DefaultDir, "Directory holding job pause markers")
+	reason := fs.String("reason", "", "Why the job is paused (shown by status)")
+
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	dir := control.Open(*controlDir)
+
+	switch action {
+	case "pause", "resume":
+		if fs.NArg() != 1 {
+			fmt.Fprintf(os.Stderr, "Error: job %s requires a job name\n", action)
+			fs.Usage()
+			return fmt.Errorf("missing job name")
+		}
+		name := fs.Arg(0)
+		if action == "pause" {
+			if err := dir.Pause(name, *reason); err != nil {
+				return err
+			}
+			fmt.Printf("Job '%s' paused\n", name)
+			return nil
+		}
+		if err := dir.Resume(name); err != nil {
+			return err
+		}
+		fmt.Printf("Job '%s' resumed\n", name)
+		return nil
+
+	case "cancel":
+		if fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "Error: job cancel requires a run ID")
+			fs.Usage()
+			return fmt.Errorf("missing run ID")
+		}
+		run, err := dir.Cancel(fs.Arg(0), currentActor())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Run %s (%s) cancelled; it stops within a few seconds\n", run.ID, runName(run))
+		return nil
+
+	case "status":
+		runs, err := dir.Runs()
+		if err != nil {
+			return err
+		}
+		for _, r := range runs {
+			fmt.Printf("%s backing up %s since %s (pid %d)", r.ID, runName(r), r.StartedAt.Format(time.RFC3339), r.PID)
+			if r.CancelledBy != "" {
+				fmt.Printf(", cancelled by %s", r.CancelledBy)
+			}
+			fmt.Println()
+		}
+		pauses, err := dir.List()
+		if err != nil {
+			return err
+		}
+		if len(pauses) == 0 {
+			if len(runs) == 0 {
+				fmt.Println("No running or paused jobs")
+			}
+			return nil
+		}
+		for _, p := range pauses {
+			fmt.Printf("%s paused since %s", p.Job, p.PausedAt.Format(time.RFC3339))
+			if p.Reason != "" {
+				fmt.Printf(" (%s)", p.Reason)
+			}
+			fmt.Println()
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown job action %q (expected pause, resume, cancel, or status)", action)
+	}
+}
+
+// runName describes what run backs up, e.g. "mydb in prod-postgres"
+func runName(run control.Run) string {
+	name := run.Database
+	if name == "" {
+		name = "all databases"
+	}
+	if run.Container != "" {
+		name += " in " + run.Container
+	}
+	if len(run.Tags) > 0 {
+		name += " [" + strings.Join(run.Tags, ", ") + "]"
+	}
+	return name
+}
+
+// trackedRun is a backup registered in the control directory, so that
+// `job cancel` can stop it from another process
+type trackedRun struct {
+	ctl    *control.Dir
+	id     string
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// trackRun registers run in ctl. Its context is cancelled once the run is
+// cancelled, which kills the dump and aborts its uploads.
+func trackRun(ctl *control.Dir, run control.Run) (*trackedRun, error) {
+	run.PID = os.Getpid()
+	run.StartedAt = time.Now()
+	if err := ctl.StartRun(run); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &trackedRun{ctl: ctl, id: run.ID, ctx: ctx, cancel: cancel}
+	go func() {
+		ticker := time.NewTicker(cancelPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, ok := ctl.Cancelled(run.ID); ok {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return t, nil
+}
+
+// cancellation reports whether the run was cancelled, and by whom
+func (t *trackedRun) cancellation() (control.Cancellation, bool) {
+	if t.ctx.Err() == nil {
+		return control.Cancellation{}, false
+	}
+	return t.ctl.Cancelled(t.id)
+}
+
+// finish unregisters the run
+func (t *trackedRun) finish() {
+	t.cancel()
+	t.ctl.FinishRun(t.id)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/iostate/back-it-up/internal/schedule"
+)
+
+// k8sNamePattern is the DNS-1123 label format Kubernetes requires for CronJob names
+var k8sNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// k8sImageUID is the unprivileged user the Dockerfile's image runs as
+const k8sImageUID = 10001
+
+type k8sManifest struct {
+	Job       string
+	Namespace string
+	Schedule  string
+	Image     string
+	Args      []string
+	Secret    string
+	SecretKey string
+	Env       [][2]string
+	PVC       string
+	Storage   string
+	UID       int
+}
+
+var k8sTemplate = template.Must(template.New("k8s").Funcs(template.FuncMap{"quote": yamlQuote}).Parse(`{{- if .Storage}}apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: {{quote .PVC}}
+  namespace: {{quote .Namespace}}
+  labels:
+    app.kubernetes.io/name: back-it-up
+    app.kubernetes.io/instance: {{quote .Job}}
+spec:
+  accessModes: ["ReadWriteOnce"]
+  resources:
+    requests:
+      storage: {{quote .Storage}}
+---
+{{end -}}
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: {{quote .Job}}
+  namespace: {{quote .Namespace}}
+  labels:
+    app.kubernetes.io/name: back-it-up
+    app.kubernetes.io/instance: {{quote .Job}}
+spec:
+  schedule: {{quote .Schedule}}
+  concurrencyPolicy: Forbid
+  successfulJobsHistoryLimit: 3
+  failedJobsHistoryLimit: 3
+  jobTemplate:
+    spec:
+      backoffLimit: 1
+      template:
+        metadata:
+          labels:
+            app.kubernetes.io/name: back-it-up
+            app.kubernetes.io/instance: {{quote .Job}}
+        spec:
+          restartPolicy: Never
+          securityContext:
+            runAsNonRoot: true
+            runAsUser: {{.UID}}
+            fsGroup: {{.UID}}
+          containers:
+            - name: backup
+              image: {{quote .Image}}
+              args:
+{{- range .Args}}
+                - {{quote .}}
+{{- end}}
+              env:
+{{- if .Secret}}
+                - name: PGPASSWORD
+                  valueFrom:
+                    secretKeyRef:
+                      name: {{quote .Secret}}
+                      key: {{quote .SecretKey}}
+{{- end}}
+{{- range .Env}}
+                - name: {{quote (index . 0)}}
+                  value: {{quote (index . 1)}}
+{{- end}}
+              securityContext:
+                allowPrivilegeEscalation: false
+                readOnlyRootFilesystem: true
+                capabilities:
+                  drop: ["ALL"]
+              volumeMounts:
+                - name: backups
+                  mountPath: /backups
+                - name: tmp
+                  mountPath: /tmp
+          volumes:
+            - name: backups
+              persistentVolumeClaim:
+                claimName: {{quote .PVC}}
+            - name: tmp
+              emptyDir: {}
+`))
+
+func runK8s(args []string) error {
+	if len(args) < 1 || args[0] != "generate" {
+		return fmt.Errorf("usage: k8s generate --job <name> --image <image> --host <host> [flags]")
+	}
+
+	fs := flag.NewFlagSet("k8s generate", flag.ExitOnError)
+	job := fs.String("job", "", "CronJob name (required)")
+	namespace := fs.String("namespace", "default", "Namespace to deploy into")
+	cron := fs.String("schedule", "0 2 * * *", "Cron schedule for the backup")
+	image := fs.String("image", "", "Image with biu and the PostgreSQL client tools, built from the Dockerfile (required)")
+	host := fs.String("host", "", "PostgreSQL service host[:port] (required)")
+	dbName := fs.String("database", "postgres", "Database name")
+	fs.StringVar(dbName, "d", "postgres", "Database name (shorthand)")
+	dbUser := fs.String("user", "postgres", "Database user")
+	fs.StringVar(dbUser, "u", "postgres", "Database user (shorthand)")
+	secret := fs.String("secret", "", "Secret holding the database password")
+	secretKey := fs.String("secret-key", "password", "Key of the password in --secret")
+	pvc := fs.String("pvc", "", "PersistentVolumeClaim backups are written to (default \"<job>-backups\")")
+	storage := fs.String("storage", "", "Also create the claim with this size (e.g. 20Gi)")
+	var tags stringList
+	fs.Var(&tags, "tag", "Tag to attach to every backup (repeatable)")
+	var envVars stringList
+	fs.Var(&envVars, "env", "Extra environment variable as NAME=value, e.g. BACKITUP_BLACKOUT (repeatable)")
+	output := fs.String("output", "", "File to write the manifests to (default stdout)")
+	fs.StringVar(output, "o", "", "File to write the manifests to (shorthand)")
+
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+
+	if *job == "" || *image == "" || *host == "" {
+		fmt.Fprintln(os.Stderr, "Error: --job, --image, and --host flags are required")
+		fs.Usage()
+		return fmt.Errorf("missing required flags")
+	}
+	// CronJob names are limited to 52 characters so generated Job names fit
+	if len(*job) > 52 || !k8sNamePattern.MatchString(*job) {
+		return fmt.Errorf("invalid --job %q: must be a lowercase DNS label of at most 52 characters", *job)
+	}
+	if _, err := schedule.ParseCron(*cron); err != nil {
+		return err
+	}
+	if *pvc == "" {
+		*pvc = *job + "-backups"
+	}
+
+	m := k8sManifest{
+		Job:       *job,
+		Namespace: *namespace,
+		Schedule:  *cron,
+		Image:     *image,
+		Secret:    *secret,
+		SecretKey: *secretKey,
+		PVC:       *pvc,
+		Storage:   *storage,
+		UID:       k8sImageUID,
+		Args: []string{
+			"backup", "--host", *host, "-d", *dbName, "-u", *dbUser,
+			"-o", "/backups", "--catalog", "/backups/catalog.json", "--tag", *job,
+		},
+	}
+	for _, tag := range tags {
+		m.Args = append(m.Args, "--tag", tag)
+	}
+	for _, spec := range envVars {
+		name, value, ok := strings.Cut(spec, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("invalid --env %q: expected NAME=value", spec)
+		}
+		m.Env = append(m.Env, [2]string{name, value})
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := k8sTemplate.Execute(w, m); err != nil {
+		return fmt.Errorf("failed to render manifests: %w", err)
+	}
+	if *output != "" {
+		fmt.Printf("Manifests written to %s\n", *output)
+	}
+	return nil
+}
+
+// yamlQuote renders s as a double-quoted scalar; JSON strings are valid YAML
+func yamlQuote(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/runlog"
+)
+
+func runLogs(args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	logDir := fs.String("log-dir", runlog.DefaultDir, "Directory run logs are kept in")
+	asJSON := fs.Bool("json", false, "Print the log as stored, one JSON record per line")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	dir := runlog.Open(*logDir)
+
+	if fs.NArg() == 0 {
+		logs, err := dir.List()
+		if err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			fmt.Printf("No run logs in %s\n", *logDir)
+			return nil
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "RUN ID\tSTARTED\tSIZE")
+		for _, l := range logs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", l.ID, l.StartedAt.Local().Format("2006-01-02 15:04:05"), formatBytes(l.Size))
+		}
+		return tw.Flush()
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "Error: logs takes one run ID")
+		fs.Usage()
+		return fmt.Errorf("too many arguments")
+	}
+
+	id, err := dir.Resolve(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	records, err := dir.Read(id)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if *asJSON {
+			data, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			continue
+		}
+		line := r.Message
+		if r.Error != "" {
+			line += ": " + r.Error
+		}
+		fmt.Printf("%s %-6s %s\n", r.Time.Local().Format(time.RFC3339), r.Stream, line)
+	}
+	return nil
+}
+
+// logEvents records a backup's progress events in its run log
+type logEvents struct {
+	backup.NopEvents
+	log *runlog.Log
+}
+
+func (e logEvents) OnPhase(phase backup.Phase) {
+	e.log.Record(runlog.Record{Stream: runlog.StreamEvent, Message: "phase " + string(phase), Phase: string(phase)})
+}
+
+func (e logEvents) OnTableDone(table string) {
+	e.log.Record(runlog.Record{Stream: runlog.StreamEvent, Message: "table " + table + " done", Table: table})
+}
+
+func (e logEvents) OnError(err error) {
+	e.log.Record(runlog.Record{Stream: runlog.StreamEvent, Message: "error", Error: err.Error()})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/iostate/back-it-up/internal/backup"
+)
+
+// refreshMaterializedViews warns about materialized views a restore left
+// unpopulated, which fail every select until refreshed, and with refresh
+// refreshes them all, in dependency order
+func refreshMaterializedViews(backupSvc *backup.Service, containerName, dbName, dbUser string, refresh, concurrently bool) error {
+	views, err := backupSvc.MaterializedViews(containerName, dbName, dbUser)
+	if err != nil {
+		if refresh {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: couldn't check materialized views: %v\n", err)
+		return nil
+	}
+	if len(views) == 0 {
+		return nil
+	}
+
+	if !refresh {
+		unpopulated := 0
+		for _, v := range views {
+			if !v.Populated {
+				unpopulated++
+			}
+		}
+		if unpopulated > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %d of %d materialized view(s) are unpopulated and fail every select until refreshed; pass --refresh-matviews\n", unpopulated, len(views))
+		}
+		return nil
+	}
+
+	fmt.Printf("Refreshing %d materialized view(s)...\n", len(views))
+	if concurrently {
+		for _, v := range views {
+			switch {
+			case !v.Populated:
+				fmt.Printf("  %s is unpopulated, so it can't be refreshed CONCURRENTLY\n", v.Name)
+			case !v.Concurrent:
+				fmt.Printf("  %s has no unique index on plain columns, so it can't be refreshed CONCURRENTLY\n", v.Name)
+			}
+		}
+	}
+	if err := backupSvc.RefreshMaterializedViews(containerName, dbName, dbUser, views, concurrently); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Refreshed %d materialized view(s)\n", len(views))
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// startMetricsServer serves handler on addr/metrics in the background and
+// returns a function that shuts the server down
+func startMetricsServer(addr string, handler http.HandlerFunc) func() {
+	stop := serveMetrics(addr, handler, func(err error) {
+		fmt.Fprintf(os.Stderr, "Metrics server failed: %v\n", err)
+	})
+	fmt.Printf("Serving metrics on %s/metrics\n", addr)
+	return stop
+}
+
+// serveMetrics is startMetricsServer for callers that report on their own,
+// such as the daemon's structured log; failed is called if the server stops
+// with an error
+func serveMetrics(addr string, handler http.HandlerFunc, failed func(error)) func() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", handler)
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			failed(err)
+		}
+	}()
+
+	return func() { server.Close() }
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/storage"
+)
+
+func runMirrors(args []string) error {
+	fs := flag.NewFlagSet("mirrors", flag.ExitOnError)
+	outputDir := fs.String("output", "./backups", "Primary backup directory")
+	fs.StringVar(outputDir, "o", "./backups", "Primary backup directory (shorthand)")
+	dbName := fs.String("database", "postgres", "Database name")
+	fs.StringVar(dbName, "d", "postgres", "Database name (shorthand)")
+	maxLag := fs.Duration("max-lag", 0, "Maximum allowed lag behind the primary (0 disables the check)")
+	var mirrorDirs stringList
+	fs.Var(&mirrorDirs, "mirror", "Mirror directory or s3:// or sftp:// location to check (repeatable, required)")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if len(mirrorDirs) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: at least one --mirror flag is required")
+		fs.Usage()
+		return fmt.Errorf("missing required flag: --mirror")
+	}
+
+	statuses, err := backup.CheckMirrors(*outputDir, mirrorDirs, *dbName, time.Now())
+	if err != nil {
+		return fmt.Errorf("mirror check failed: %w", err)
+	}
+
+	unhealthy := 0
+	for _, status := range statuses {
+		if status.Healthy(*maxLag) {
+			fmt.Printf("✓ %s is up to date\n", status.Dir)
+			continue
+		}
+
+		unhealthy++
+		fmt.Printf("✗ %s is out of sync (lag %s)\n", status.Dir, status.Lag.Round(time.Second))
+		for _, name := range status.Missing {
+			fmt.Printf("    missing: %s\n", name)
+		}
+		mismatch := "size"
+		if storage.IsLocation(status.Dir) {
+			mismatch = "checksum"
+		}
+		for _, name := range status.Corrupt {
+			fmt.Printf("    %s mismatch: %s\n", mismatch, name)
+		}
+	}
+
+	if unhealthy > 0 {
+		return fmt.Errorf("%d of %d mirror(s) out of sync", unhealthy, len(statuses))
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"text/template"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/alert"
+	"github.com/iostate/back-it-up/internal/notify"
+)
+
+// Webhooks hear of every outcome, but not of starts, unless told otherwise
+const (
+	defaultWebhookTemplate = "json"
+	defaultWebhookEvents   = "success,failure,skip"
+)
+
+// notifyConfig is where a backup run's outcome is posted
+type notifyConfig struct {
+	slackWebhook string
+	on           string
+
+	webhook         string
+	webhookTemplate string
+	webhookHeaders  stringList
+	webhookEvents   string
+
+	healthcheck string
+
+	cooldown time.Duration
+	// alerts holds back failures repeated within cooldown; nil posts each
+	alerts *alert.Tracker
+
+	// Set by validate
+	template *template.Template
+	header   http.Header
+	events   []notify.Status
+}
+
+func addNotifyFlags(fs *flag.FlagSet) *notifyConfig {
+	c := &notifyConfig{}
+	fs.StringVar(&c.slackWebhook, "slack-webhook", "", "Slack incoming webhook URL to post the outcome of the run to")
+	fs.StringVar(&c.on, "notify-on", string(notify.Always), "Which runs to post: always or failure")
+	fs.StringVar(&c.webhook, "webhook", "", "URL to POST the run's start or outcome to, rendered by --webhook-template")
+	fs.StringVar(&c.webhookTemplate, "webhook-template", defaultWebhookTemplate, "Webhook payload: json, discord, teams, mattermost, or a template file")
+	fs.Var(&c.webhookHeaders, "webhook-header", "HTTP header sent to the webhook, as \"Name: value\" (repeatable)")
+	fs.StringVar(&c.webhookEvents, "webhook-events", defaultWebhookEvents, "Comma-separated events posted to the webhook: start, success, failure, skip")
+	fs.StringVar(&c.healthcheck, "healthcheck-url", "", "Dead man's switch to ping as the run starts (/start), succeeds, and fails (/fail), e.g. https://hc-ping.com/<uuid>")
+	fs.DurationVar(&c.cooldown, "notify-cooldown", 0, "Don't post a failure identical to the job's last one posted for this long")
+	return c
+}
+
+// validate checks the flags before the run starts, so a bad webhook isn't
+// first noticed when a failure should have been posted
+func (c *notifyConfig) validate() error {
+	if _, err := notify.ParseWhen(c.on); err != nil {
+		return fmt.Errorf("--notify-on: %w", err)
+	}
+	if c.cooldown < 0 {
+		return fmt.Errorf("--notify-cooldown can't be negative")
+	}
+	if c.slackWebhook != "" && !isHTTPURL(c.slackWebhook) {
+		return fmt.Errorf("--slack-webhook must be an http(s) URL")
+	}
+	if c.healthcheck != "" && !isHTTPURL(c.healthcheck) {
+		return fmt.Errorf("--healthcheck-url must be an http(s) URL")
+	}
+	if c.webhook == "" {
+		return nil
+	}
+	if !isHTTPURL(c.webhook) {
+		return fmt.Errorf("--webhook must be an http(s) URL")
+	}
+	var err error
+	if c.template, err = notify.LoadTemplate(c.webhookTemplate); err != nil {
+		return err
+	}
+	if c.header, err = parseHeaders("--webhook-header", c.webhookHeaders); err != nil {
+		return err
+	}
+	if c.events, err = notify.ParseStatuses(c.webhookEvents); err != nil {
+		return fmt.Errorf("--webhook-events: %w", err)
+	}
+	return nil
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+// track keeps the job's run of failures under dir, so --notify-cooldown
+// holds back repeats across runs
+func (c *notifyConfig) track(dir string) {
+	if c.cooldown > 0 {
+		c.alerts = alert.OpenTracker(dir, alert.Policy{Cooldown: c.cooldown})
+	}
+}
+
+// send posts e to every configured notifier that wants it. Failures are
+// reported as warnings: they don't change how the run went.
+func (c *notifyConfig) send(e notify.Event) {
+	if e.Name == "" {
+		e.Name = e.Container
+		if e.Database != "" {
+			e.Name = e.Database + "@" + e.Container
+		}
+	}
+
+	// A repeated failure still pings the healthcheck, which has to hear of
+	// every run, but isn't posted to Slack or the webhook again
+	post := true
+	if c.alerts != nil {
+		switch e.Status() {
+		case notify.StatusFailure:
+			decision := c.alerts.Failure(e.Name, e.Err.Error())
+			post = decision.Notify
+			if !post {
+				fmt.Printf("Not posting failure: identical to the last one posted, %d failure(s) in a row\n", decision.Consecutive)
+			} else if decision.Suppressed > 0 {
+				e.Err = fmt.Errorf("%w (%d identical failure(s) not posted)", e.Err, decision.Suppressed)
+			}
+		case notify.StatusSuccess:
+			c.alerts.Success(e.Name)
+		}
+	}
+
+	when, _ := notify.ParseWhen(c.on)
+	if c.slackWebhook != "" && post && when.Wants(e) {
+		if err := (notify.Slack{WebhookURL: c.slackWebhook}).Notify(e); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to notify Slack: %v\n", err)
+		} else {
+			fmt.Println("✓ Posted to Slack")
+		}
+	}
+
+	if c.healthcheck != "" {
+		if err := (notify.Healthcheck{URL: c.healthcheck}).Notify(e); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to ping healthcheck: %v\n", err)
+		} else if !e.Starting {
+			fmt.Println("✓ Pinged healthcheck")
+		}
+	}
+
+	if c.template != nil && post && slices.Contains(c.events, e.Status()) {
+		hook := notify.Webhook{URL: c.webhook, Template: c.template, Header: c.header}
+		if err := hook.Notify(e); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to post %s to webhook: %v\n", e.Status(), err)
+		} else if !e.Starting {
+			fmt.Println("✓ Posted to webhook")
+		}
+	}
+}
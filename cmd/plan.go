@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/audit"
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/catalog"
+	"github.com/iostate/back-it-up/internal/docker"
+)
+
+// backupPlan is what a backup bundles with its database dump so a whole app
+// can be restored coherently: volume archives, container config snapshots,
+// and the app containers to pause while they are taken
+type backupPlan struct {
+	volumes   []string
+	inspect   []string
+	quiesce   []string
+	artifacts []catalog.Entry
+}
+
+func (p *backupPlan) empty() bool {
+	return len(p.volumes) == 0 && len(p.inspect) == 0 && len(p.quiesce) == 0
+}
+
+// validate rejects plans that would deadlock or can't run in this mode
+func (p *backupPlan) validate(dbContainer string, host string, noDockerSocket bool) error {
+	if p.empty() {
+		return nil
+	}
+	if dockerSocketDisabled(noDockerSocket) {
+		return fmt.Errorf("--with-volume, --with-inspect, and --quiesce need docker, which --no-docker-socket disables")
+	}
+	if host == "" && slices.Contains(p.quiesce, dbContainer) {
+		return fmt.Errorf("--quiesce %s would pause the database being dumped", dbContainer)
+	}
+	return nil
+}
+
+// pause freezes the quiesced containers and returns a func that resumes
+// them; containers already paused are resumed on failure
+func (p *backupPlan) pause() (func(), error) {
+	svc := docker.NewService()
+	var paused []string
+	resume := func() {
+		for _, c := range paused {
+			if err := svc.Unpause(c); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+		paused = nil
+	}
+	for _, c := range p.quiesce {
+		fmt.Printf("Pausing container '%s'...\n", c)
+		if err := svc.Pause(c); err != nil {
+			resume()
+			return nil, err
+		}
+		paused = append(paused, c)
+	}
+	return resume, nil
+}
+
+// take archives the plan's volumes and snapshots its containers through the
+// local docker daemon, even when the dump itself went over --host. On
+// failure everything it wrote is removed.
+func (p *backupPlan) take(outputDir string, timestamp time.Time, tags []string, note string, meta map[string]string) error {
+	svc := backup.NewService(docker.NewService())
+	for _, v := range p.volumes {
+		fmt.Printf("Archiving volume '%s'...\n", v)
+		path, err := svc.BackupVolume(backup.VolumeConfig{Volume: v, OutputDir: outputDir, Timestamp: timestamp})
+		if err != nil {
+			p.discard()
+			return fmt.Errorf("volume backup failed: %w", err)
+		}
+		p.artifacts = append(p.artifacts, catalog.Entry{Kind: catalog.KindVolume, Path: path, Volume: v, CreatedAt: timestamp, Tags: tags, Note: note, Meta: meta})
+	}
+	for _, c := range p.inspect {
+		fmt.Printf("Snapshotting configuration of container '%s'...\n", c)
+		path, err := svc.SnapshotContainer(c, outputDir, timestamp)
+		if err != nil {
+			p.discard()
+			return fmt.Errorf("container snapshot failed: %w", err)
+		}
+		p.artifacts = append(p.artifacts, catalog.Entry{Kind: catalog.KindInspect, Path: path, ContainerName: c, CreatedAt: timestamp, Tags: tags, Note: note, Meta: meta})
+	}
+	return nil
+}
+
+// discard removes the artifacts taken so far
+func (p *backupPlan) discard() {
+	for _, a := range p.artifacts {
+		backup.RemoveBackup(a.Path)
+	}
+	p.artifacts = nil
+}
+
+// record catalogs the plan's artifacts under group
+func (p *backupPlan) record(cat *catalog.Catalog, group string) error {
+	for _, a := range p.artifacts {
+		a.Group = group
+		entry, err := recordBackup(cat, a)
+		if err != nil {
+			return fmt.Errorf("failed to record %s in catalog: %w", a.Path, err)
+		}
+		fmt.Printf("Catalog ID: %s (%s %s)\n", entry.ID, entry.Kind, a.Path)
+	}
+	return nil
+}
+
+// groupMembers splits a group's catalog entries into its database backup and
+// the rest. Streamed copies share the group; the local file is preferred.
+func groupMembers(cat *catalog.Catalog, group string) (catalog.Entry, []catalog.Entry, error) {
+	entries, err := cat.Find(catalog.Filter{Group: group})
+	if err != nil {
+		return catalog.Entry{}, nil, err
+	}
+	if len(entries) == 0 {
+		return catalog.Entry{}, nil, fmt.Errorf("no catalog entries in group %s", group)
+	}
+
+	var db *catalog.Entry
+	var rest []catalog.Entry
+	for i, e := range entries {
+		switch {
+		case e.Kind != catalog.KindBackup:
+			rest = append(rest, e)
+		case db == nil || isRemoteBackup(db.Path) && !isRemoteBackup(e.Path):
+			db = &entries[i]
+		}
+	}
+	if db == nil {
+		return catalog.Entry{}, nil, fmt.Errorf("group %s has no database backup", group)
+	}
+	return *db, rest, nil
+}
+
+// restoreGroupVolumes restores the volume archives of a group, clearing each
+// volume first if clearFirst is set, and points at its container snapshots
+func restoreGroupVolumes(members []catalog.Entry, clearFirst bool) error {
+	svc := backup.NewService(docker.NewService())
+	for _, e := range members {
+		switch e.Kind {
+		case catalog.KindVolume:
+			if err := verifyCatalogChecksum(e); err != nil {
+				return err
+			}
+			fmt.Printf("Restoring archive into volume '%s'...\n", e.Volume)
+			err := svc.RestoreVolume(backup.VolumeRestoreConfig{Volume: e.Volume, BackupPath: e.Path, Clear: clearFirst})
+			recordAccess(audit.ActionRestore, e.Path, e.ID, "volume:"+e.Volume, err)
+			if err != nil {
+				return fmt.Errorf("volume restore failed: %w", err)
+			}
+			fmt.Printf("✓ Volume '%s' restored\n", e.Volume)
+		case catalog.KindInspect:
+			fmt.Printf("Configuration of container '%s' at backup time: %s\n", e.ContainerName, e.Path)
+		}
+	}
+	return nil
+}
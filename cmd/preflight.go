@@ -0,0 +1,227 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/local"
+)
+
+// preflightCheck is one requirement of the selected mode and whether it holds
+type preflightCheck struct {
+	requirement string
+	detail      string
+	ok          bool
+	// advisory checks are reported but don't fail the preflight
+	advisory bool
+}
+
+// preflightReport collects checks in the order they are run
+type preflightReport []preflightCheck
+
+func (r *preflightReport) add(requirement string, ok bool, detail string) {
+	*r = append(*r, preflightCheck{requirement: requirement, ok: ok, detail: detail})
+}
+
+func (r *preflightReport) advise(requirement string, ok bool, detail string) {
+	*r = append(*r, preflightCheck{requirement: requirement, ok: ok, detail: detail, advisory: true})
+}
+
+// failures counts the required checks that didn't pass
+func (r preflightReport) failures() int {
+	n := 0
+	for _, c := range r {
+		if !c.ok && !c.advisory {
+			n++
+		}
+	}
+	return n
+}
+
+func runPreflight(args []string) error {
+	fs := flag.NewFlagSet("preflight", flag.ExitOnError)
+	containerName := fs.String("container", "", "Docker container to check access to")
+	fs.StringVar(containerName, "c", "", "Docker container to check access to (shorthand)")
+	host := fs.String("host", "", hostFlagUsage)
+	noDockerSocket := fs.Bool("no-docker-socket", false, noDockerSocketUsage)
+	dbName := fs.String("database", "postgres", "Database name")
+	fs.StringVar(dbName, "d", "postgres", "Database name (shorthand)")
+	dbUser := fs.String("user", "postgres", "Database user")
+	fs.StringVar(dbUser, "u", "postgres", "Database user (shorthand)")
+	outputDir := fs.String("output", "./backups", "Directory backups will be written to")
+	fs.StringVar(outputDir, "o", "./backups", "Directory backups will be written to (shorthand)")
+	restore := fs.Bool("restore", false, "Also check the privileges restores need")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	var report preflightReport
+	dockerSvc, err := newDatabaseService(*host, *noDockerSocket)
+	// Missing client tools are reported below rather than failing outright
+	if err != nil && (*host == "" || os.Getenv(clientImageEnvVar) != "") {
+		return err
+	}
+
+	target := *containerName
+	if image := os.Getenv(clientImageEnvVar); *host != "" && image != "" {
+		where := "the host's network"
+		if name := os.Getenv(helperNetworkEnvVar); name != "" {
+			where = "network " + name
+		}
+		fmt.Printf("Mode: client tools in helper container %s on %s connecting to %s\n", image, where, *host)
+		target = *host
+		path, err := exec.LookPath("docker")
+		report.add("docker CLI on PATH", err == nil, path)
+	} else if *host != "" {
+		fmt.Printf("Mode: local client tools connecting to %s (no docker socket)\n", *host)
+		target = *host
+		for _, tool := range local.RequiredTools {
+			path, err := exec.LookPath(tool)
+			report.add(tool+" on PATH", err == nil, path)
+		}
+		if strings.HasPrefix(*host, "/") {
+			report.add("socket directory "+*host+" mounted", isDir(*host), "")
+		}
+	} else {
+		fmt.Println("Mode: docker exec")
+		path, err := exec.LookPath("docker")
+		report.add("docker CLI on PATH", err == nil, path)
+		output, err := exec.Command("docker", "version", "--format", "{{.Server.Version}}").CombinedOutput()
+		version, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+		report.add("access to the Docker daemon ("+dockerEndpoint()+")", err == nil, version)
+	}
+
+	if target != "" && dockerSvc != nil {
+		err := dockerSvc.VerifyContainer(target)
+		report.add("database server reachable at '"+target+"'", err == nil, errorDetail(err))
+		if err == nil {
+			checkRolePrivileges(&report, backup.NewService(dockerSvc), target, *dbName, *dbUser, *restore)
+		}
+	}
+
+	report.add("output directory "+*outputDir+" writable", dirWritable(*outputDir), "")
+	report.advise("running without root", os.Geteuid() != 0, fmt.Sprintf("uid %d", os.Geteuid()))
+
+	for _, c := range report {
+		mark := "✓"
+		switch {
+		case !c.ok && c.advisory:
+			mark = "!"
+		case !c.ok:
+			mark = "✗"
+		}
+		line := fmt.Sprintf("  %s %s", mark, c.requirement)
+		if c.detail != "" {
+			line += " (" + c.detail + ")"
+		}
+		fmt.Println(line)
+	}
+
+	fmt.Println("\nPrivileges this mode requires:")
+	for _, p := range requiredPrivileges(*host != "", *restore) {
+		fmt.Printf("  - %s\n", p)
+	}
+
+	printThroughput(target)
+
+	if n := report.failures(); n > 0 {
+		if *host != "" && len(local.MissingTools()) > 0 && os.Getenv(clientImageEnvVar) == "" {
+			fmt.Println("\nRun back-it-up doctor --install-hints for how to install the client tools")
+		}
+		return fmt.Errorf("preflight failed: %d check(s) did not pass", n)
+	}
+	fmt.Println("\n✓ Preflight passed")
+	return nil
+}
+
+// checkRolePrivileges adds the database-level checks for dbUser
+func checkRolePrivileges(report *preflightReport, svc *backup.Service, target, dbName, dbUser string, restore bool) {
+	privs, err := svc.RolePrivileges(target, dbName, dbUser)
+	if err != nil {
+		report.add(fmt.Sprintf("role '%s' can connect to '%s'", dbUser, dbName), false, errorDetail(err))
+		return
+	}
+	report.add(fmt.Sprintf("role '%s' can connect to '%s'", dbUser, dbName), privs.Connect, "")
+
+	detail := ""
+	switch {
+	case privs.Superuser:
+		detail = "superuser"
+	case privs.ReadAllData:
+		detail = "member of pg_read_all_data"
+	case len(privs.UnreadableTables) > 0:
+		detail = "no SELECT on " + strings.Join(privs.UnreadableTables, ", ")
+	}
+	report.add("role can read every table", privs.CanDump(), detail)
+
+	if restore {
+		report.add("role can drop and create databases", privs.CanRecreate(), "")
+	}
+	report.advise("role is not a superuser", !privs.Superuser, "")
+}
+
+// requiredPrivileges lists, in plain words, what the selected mode needs from the host and the database
+func requiredPrivileges(local, restore bool) []string {
+	var privs []string
+	if local {
+		privs = append(privs,
+			"PostgreSQL client tools (pg_dump, psql, pg_isready) matching the server's major version",
+			"network access to the server, or read/write access to its socket directory",
+			"no docker socket and no root: the process can run as any unprivileged user",
+		)
+	} else {
+		privs = append(privs,
+			"the docker CLI and access to the Docker daemon socket",
+			"note: docker socket access is equivalent to root on the host; use --host to avoid it",
+			"permission to run docker exec in the target container",
+		)
+	}
+	privs = append(privs, "CONNECT on the database and SELECT on every table (or membership in pg_read_all_data)")
+	if restore {
+		privs = append(privs, "CREATEDB (or superuser) and ownership of the database being replaced")
+	}
+	privs = append(privs, "write access to the output directory and catalog file")
+	return privs
+}
+
+// dockerEndpoint names the daemon the docker CLI will talk to
+func dockerEndpoint() string {
+	if h := os.Getenv("DOCKER_HOST"); h != "" {
+		return h
+	}
+	return "/var/run/docker.sock"
+}
+
+// isDir reports whether path exists and is a directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// dirWritable reports whether files can be created in dir, creating it if needed
+func dirWritable(dir string) bool {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false
+	}
+	f, err := os.CreateTemp(dir, ".preflight-*")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
+
+// errorDetail flattens an error to a single line for the report
+func errorDetail(err error) string {
+	if err == nil {
+		return ""
+	}
+	msg, _, _ := strings.Cut(err.Error(), "\n")
+	return msg
+}
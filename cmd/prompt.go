@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// readLine prints a prompt to stderr and returns the trimmed line typed by the user
+func readLine(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	answer, err := stdinReader.ReadString('\n')
+	if err != nil && answer == "" {
+		return "", fmt.Errorf("failed to read confirmation: %w", err)
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// confirmDestructive describes what is about to be destroyed and asks the user
+// to confirm. It returns nil without prompting when assumeYes is set.
+func confirmDestructive(assumeYes bool, description ...string) error {
+	if assumeYes {
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr, "The following will be permanently destroyed:")
+	for _, line := range description {
+		fmt.Fprintf(os.Stderr, "  - %s\n", line)
+	}
+
+	answer, err := readLine("Continue? [y/N]: ")
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return nil
+	default:
+		return fmt.Errorf("aborted by user")
+	}
+}
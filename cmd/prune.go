@@ -0,0 +1,267 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/catalog"
+	"github.com/iostate/back-it-up/internal/retention"
+	"github.com/iostate/back-it-up/internal/storage"
+)
+
+func runPrune(args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	keep := addRetentionFlags(fs)
+	outputDir := fs.String("output", "", "Only prune backups in this directory")
+	fs.StringVar(outputDir, "o", "", "Only prune backups in this directory (shorthand)")
+	dest := fs.String("dest", "", "Only prune backups stored under this s3:// or sftp:// location")
+	dbName := fs.String("database", "", "Only prune backups of this database")
+	fs.StringVar(dbName, "d", "", "Only prune backups of this database (shorthand)")
+	containerName := fs.String("container", "", "Only prune backups taken from this container")
+	dryRun := fs.Bool("dry-run", false, "List what would be removed without removing it")
+	assumeYes := fs.Bool("yes", false, "Skip confirmation prompts")
+	fs.BoolVar(assumeYes, "y", false, "Skip confirmation prompts (shorthand)")
+	catalogPath := fs.String("catalog", catalog.DefaultPath, "Backup catalog file")
+	tlsOpts := addTLSFlags(fs)
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := tlsOpts.apply(); err != nil {
+		return err
+	}
+
+	policy, err := keep.policy()
+	if err != nil {
+		return err
+	}
+	if policy.Empty() {
+		fmt.Fprintln(os.Stderr, "Error: at least one of --keep-last, --keep-daily, --keep-weekly, --keep-monthly, --keep-yearly, --keep-within, or --max-total-size is required")
+		fs.Usage()
+		return fmt.Errorf("missing required flags")
+	}
+	if *outputDir != "" && *dest != "" {
+		return fmt.Errorf("--output and --dest can't be combined")
+	}
+	if *dest != "" && !storage.IsLocation(*dest) {
+		return fmt.Errorf("--dest must be an s3:// or sftp:// location")
+	}
+	inPlace, err := pruneScope(*outputDir, *dest)
+	if err != nil {
+		return err
+	}
+
+	cat := catalog.Open(*catalogPath)
+	entries, err := cat.Find(catalog.Filter{DatabaseName: *dbName})
+	if err != nil {
+		return fmt.Errorf("failed to read catalog: %w", err)
+	}
+	var scoped []catalog.Entry
+	for _, e := range entries {
+		if (*containerName == "" || e.ContainerName == *containerName) && inPlace(e.Path) {
+			scoped = append(scoped, e)
+		}
+	}
+
+	kept, expired := retention.Apply(policy, scoped)
+	warnOverBudget(policy, kept)
+	if len(expired) == 0 {
+		fmt.Printf("Nothing to prune; kept %d backup(s)\n", len(kept))
+		return nil
+	}
+	if !*dryRun {
+		descriptions := make([]string, len(expired))
+		for i, e := range expired {
+			descriptions[i] = fmt.Sprintf("%s (%s, taken %s)", e.Path, entryName(e), e.CreatedAt.Local().Format(time.DateTime))
+		}
+		if err := confirmDestructive(*assumeYes, descriptions...); err != nil {
+			return err
+		}
+	}
+	return pruneExpired(cat, expired, len(kept), *dryRun)
+}
+
+// retentionFlags are the flags of a retention policy
+type retentionFlags struct {
+	last, daily, weekly, monthly, yearly *int
+	within                               *longDuration
+	maxTotalSize                         *byteSize
+	tagged                               *stringList
+}
+
+// addRetentionFlags registers the --keep-*, --max-total-size, and
+// --keep-tagged flags on fs
+func addRetentionFlags(fs *flag.FlagSet) retentionFlags {
+	f := retentionFlags{
+		last:         fs.Int("keep-last", 0, "Keep the newest N backups of each database"),
+		daily:        fs.Int("keep-daily", 0, "Keep the newest backup of each of the last N days with one"),
+		weekly:       fs.Int("keep-weekly", 0, "Keep the newest backup of each of the last N weeks with one"),
+		monthly:      fs.Int("keep-monthly", 0, "Keep the newest backup of each of the last N months with one"),
+		yearly:       fs.Int("keep-yearly", 0, "Keep the newest backup of each of the last N years with one"),
+		within:       new(longDuration),
+		maxTotalSize: new(byteSize),
+		tagged:       new(stringList),
+	}
+	fs.Var(f.within, "keep-within", "Keep every backup taken within this long of the newest, e.g. 30d")
+	fs.Var(f.maxTotalSize, "max-total-size", "Remove the oldest backups until those in each place fit in this size, e.g. 500GB")
+	fs.Var(f.tagged, "keep-tagged", "Always keep backups with a tag matching this glob, e.g. release-* (repeatable)")
+	return f
+}
+
+// policy returns the retention policy the flags describe
+func (f retentionFlags) policy() (retention.Policy, error) {
+	p := retention.Policy{
+		KeepLast:     *f.last,
+		KeepDaily:    *f.daily,
+		KeepWeekly:   *f.weekly,
+		KeepMonthly:  *f.monthly,
+		KeepYearly:   *f.yearly,
+		KeepWithin:   time.Duration(*f.within),
+		MaxTotalSize: int64(*f.maxTotalSize),
+		KeepTagged:   *f.tagged,
+	}
+	return p, p.Validate()
+}
+
+// warnOverBudget reports the places the newest backups alone keep over
+// --max-total-size
+func warnOverBudget(policy retention.Policy, kept []catalog.Entry) {
+	for where, size := range policy.Over(kept) {
+		kept := "newest"
+		if len(policy.KeepTagged) > 0 {
+			kept = "newest and tagged"
+		}
+		fmt.Fprintf(os.Stderr, "Warning: the %s backups in %s alone take %s, over --max-total-size %s\n", kept, where, formatBytes(size), formatBytes(policy.MaxTotalSize))
+	}
+}
+
+// pruneExpired removes the expired backups and their entries, reporting
+// each. A backup that can't be removed keeps its entry and fails the run
+// once the rest are done. A file another entry still refers to, as
+// --name-by-hash backups of identical dumps share one, only loses the
+// expired entry; the catalog checks that as it removes each one, so a
+// backup recorded since the entries were read is seen.
+func pruneExpired(cat *catalog.Catalog, expired []catalog.Entry, kept int, dryRun bool) error {
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	// A dry run counts the entries referring to each file to tell what
+	// the catalog would decide
+	refs := make(map[string]int)
+	if dryRun {
+		all, err := cat.Entries()
+		if err != nil {
+			return fmt.Errorf("failed to read catalog: %w", err)
+		}
+		for _, e := range all {
+			refs[e.Path]++
+		}
+	}
+
+	removed := 0
+	var freed int64
+	failed := 0
+	for _, e := range expired {
+		globals := ""
+		var shared bool
+		if dryRun {
+			refs[e.Path]--
+			shared = refs[e.Path] > 0
+			if m, err := backup.ReadManifest(e.Path); !shared && err == nil && m != nil && m.Globals != "" {
+				globals = backup.GlobalsPath(e.Path)
+			}
+		} else {
+			var err error
+			shared, err = cat.Expire(e.ID, func(e catalog.Entry) error {
+				// The manifest names the globals file, so it is read first
+				if m, err := backup.ReadManifest(e.Path); err == nil && m != nil && m.Globals != "" {
+					globals = backup.GlobalsPath(e.Path)
+				}
+				if err := backup.RemoveBackup(e.Path); err != nil {
+					return err
+				}
+				if globals != "" {
+					backup.RemoveBackup(globals)
+				}
+				return nil
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to remove %s: %v\n", e.Path, err)
+				failed++
+				continue
+			}
+		}
+		removed++
+		if shared {
+			fmt.Printf("%s entry %s (%s, taken %s); %s is still used by another backup\n", verb, e.ID, entryName(e), e.CreatedAt.Local().Format(time.DateTime), e.Path)
+			continue
+		}
+		freed += e.Size
+		fmt.Printf("%s %s (%s, taken %s, %s, ID %s)\n", verb, e.Path, entryName(e), e.CreatedAt.Local().Format(time.DateTime), formatBytes(e.Size), e.ID)
+		if globals != "" {
+			fmt.Printf("%s %s (its roles and tablespaces)\n", verb, globals)
+		}
+	}
+
+	fmt.Printf("%s %d backup(s), %s; kept %d\n", verb, removed, formatBytes(freed), kept)
+	if failed > 0 {
+		return fmt.Errorf("failed to remove %d backup(s)", failed)
+	}
+	return nil
+}
+
+// pruneAfterBackup applies policy to the backups of the database entry
+// just recorded. A successful backup stands even if pruning fails.
+func pruneAfterBackup(cat *catalog.Catalog, policy retention.Policy, entry catalog.Entry) {
+	if policy.Empty() {
+		return
+	}
+	entries, err := cat.Find(catalog.Filter{DatabaseName: entry.DatabaseName})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: pruning skipped: failed to read catalog: %v\n", err)
+		return
+	}
+	var series []catalog.Entry
+	for _, e := range entries {
+		if e.ContainerName == entry.ContainerName {
+			series = append(series, e)
+		}
+	}
+	kept, expired := retention.Apply(policy, series)
+	warnOverBudget(policy, kept)
+	if len(expired) == 0 {
+		return
+	}
+	if err := pruneExpired(cat, expired, len(kept), false); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// pruneScope returns which backup paths prune may touch: those in dir or
+// under dest, or, with neither, every backup in the catalog
+func pruneScope(dir, dest string) (func(string) bool, error) {
+	switch {
+	case dest != "":
+		prefix := strings.TrimSuffix(dest, "/") + "/"
+		return func(p string) bool { return strings.HasPrefix(p, prefix) }, nil
+	case dir != "":
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --output: %w", err)
+		}
+		return func(p string) bool {
+			if storage.IsLocation(p) {
+				return false
+			}
+			rel, err := filepath.Rel(abs, retention.Where(p))
+			return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+		}, nil
+	}
+	return func(string) bool { return true }, nil
+}
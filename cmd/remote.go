@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/audit"
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/oci"
+	"github.com/iostate/back-it-up/internal/storage"
+	"github.com/iostate/back-it-up/internal/throughput"
+)
+
+// isRemoteBackup reports whether a backup location must be fetched before use
+func isRemoteBackup(location string) bool {
+	return backup.IsRemotePath(location) || oci.IsReference(location)
+}
+
+// fetchRemoteBackup downloads an http(s) or oci:// backup and returns the local
+// copy's path along with a func that removes it
+func fetchRemoteBackup(location string, headerSpecs []string, expectedSHA string) (string, func(), error) {
+	if oci.IsReference(location) {
+		path, cleanup, err := pullBackup(location)
+		recordAccess(audit.ActionDownload, location, "", "", err)
+		return path, cleanup, err
+	}
+
+	path, err := downloadBackup(location, headerSpecs, expectedSHA)
+	recordAccess(audit.ActionDownload, location, "", "", err)
+	if err != nil {
+		return "", nil, err
+	}
+	return path, func() { os.Remove(path) }, nil
+}
+
+// downloadBackup fetches a remote backup and returns the local copy's path
+func downloadBackup(url string, headerSpecs []string, expectedSHA string) (string, error) {
+	headers, err := parseHeaders("--header", headerSpecs)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Downloading %s...\n", url)
+	started := time.Now()
+	path, verified, err := backup.Download(backup.DownloadConfig{
+		URL:     url,
+		Headers: headers,
+		SHA256:  expectedSHA,
+	})
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(path); err == nil {
+		recordThroughput(throughput.OpDownload, remoteHost(url), localHost(), info.Size(), started)
+	}
+	if verified {
+		fmt.Println("✓ Download checksum verified")
+	} else {
+		fmt.Println("Warning: no checksum published for download, skipping verification (use --sha256)")
+	}
+	return path, nil
+}
+
+// withHeaderFile adds the "Name: value" lines of the file at path, if one
+// is given, to specs, so a token needn't be on the command line where ps
+// shows it. Blank lines and # comments are skipped.
+func withHeaderFile(specs []string, path string) ([]string, error) {
+	if path == "" {
+		return specs, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header file: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			specs = append(specs, line)
+		}
+	}
+	return specs, nil
+}
+
+// parseHeaders parses "Name: value" flag values
+func parseHeaders(flagName string, specs []string) (http.Header, error) {
+	headers := http.Header{}
+	for _, spec := range specs {
+		name, value, ok := strings.Cut(spec, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid %s %q: expected \"Name: value\"", flagName, spec)
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return headers, nil
+}
+
+// newTee returns a tee that streams a backup to an http(s) URL, s3:// or
+// sftp:// location, or oci:// reference while it is being written
+func newTee(location string, headers http.Header, dbName string) (backup.Tee, error) {
+	if storage.IsLocation(location) {
+		return backup.StoreTee(location)
+	}
+	if oci.IsReference(location) {
+		ref, err := oci.ParseReference(location)
+		if err != nil {
+			return backup.Tee{}, err
+		}
+		return backup.Tee{Location: location, Upload: func(name string, r io.Reader) (string, error) {
+			_, digest, err := oci.NewClient().PushStream(ref, name, r, map[string]string{
+				"io.github.iostate.back-it-up.database": dbName,
+			})
+			if err != nil {
+				return "", fmt.Errorf("push failed: %w", err)
+			}
+			return ref.WithDigest(digest).String(), nil
+		}}, nil
+	}
+	if backup.IsRemotePath(location) {
+		cfg := backup.UploadConfig{URL: location, Headers: headers}
+		return backup.Tee{Location: location, Upload: func(name string, r io.Reader) (string, error) {
+			return backup.Upload(cfg, name, r)
+		}}, nil
+	}
+	return backup.Tee{}, fmt.Errorf("invalid --tee %q: expected an http(s) URL, s3:// or sftp:// location, or oci:// reference", location)
+}
+
+// pullBackup downloads an OCI artifact into a temporary directory
+func pullBackup(location string) (string, func(), error) {
+	ref, err := oci.ParseReference(location)
+	if err != nil {
+		return "", nil, err
+	}
+
+	dir, err := backup.MkdirScratch("oci-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	fmt.Printf("Pulling %s...\n", ref)
+	started := time.Now()
+	path, err := oci.NewClient().Pull(ref, dir)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	if info, err := os.Stat(path); err == nil {
+		recordThroughput(throughput.OpDownload, registryHost(ref), localHost(), info.Size(), started)
+	}
+	fmt.Println("✓ Artifact digest verified")
+	return path, cleanup, nil
+}
+
+// pushBackup uploads a finished backup to an OCI registry and returns the
+// digest-pinned reference along with the layer descriptor
+func pushBackup(location, path, dbName string) (oci.Reference, oci.Descriptor, error) {
+	ref, err := oci.ParseReference(location)
+	if err != nil {
+		return oci.Reference{}, oci.Descriptor{}, err
+	}
+
+	fmt.Printf("Pushing backup to %s...\n", ref)
+	started := time.Now()
+	layer, digest, err := oci.NewClient().Push(ref, path, map[string]string{
+		"io.github.iostate.back-it-up.database": dbName,
+	})
+	if err != nil {
+		return oci.Reference{}, oci.Descriptor{}, fmt.Errorf("push failed: %w", err)
+	}
+	recordThroughput(throughput.OpUpload, localHost(), registryHost(ref), layer.Size, started)
+	pinned := ref.WithDigest(digest)
+	fmt.Printf("✓ Pushed %s\n", pinned)
+	return pinned, layer, nil
+}
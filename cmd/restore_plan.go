@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/catalog"
+	"github.com/iostate/back-it-up/internal/oci"
+	"github.com/iostate/back-it-up/internal/storage"
+	"github.com/iostate/back-it-up/internal/throughput"
+)
+
+// Actions of a restore plan step
+const (
+	planDownload = "download"
+	planStream   = "stream"
+	planGlobals  = "globals"
+	planRestore  = "restore"
+)
+
+// restorePlanStep is one artifact restore would fetch or apply, in order
+type restorePlanStep struct {
+	Action string `json:"action"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	// Estimate is zero when the route has no throughput history yet
+	Estimate time.Duration `json:"estimate,omitempty"`
+}
+
+// restorePlan is what restoring a job to a point in time would take
+type restorePlan struct {
+	Job        string            `json:"job"`
+	TargetTime time.Time         `json:"target_time"`
+	Backup     catalog.Entry     `json:"backup"`
+	Container  string            `json:"container"`
+	Steps      []restorePlanStep `json:"steps"`
+	// DownloadSize counts the bytes fetched from remote storage
+	DownloadSize int64         `json:"download_size"`
+	Estimate     time.Duration `json:"estimate"`
+	// EstimateIncomplete is set when a step had no throughput history
+	EstimateIncomplete bool   `json:"estimate_incomplete,omitempty"`
+	Command            string `json:"command"`
+}
+
+func runRestorePlan(args []string) error {
+	fs := flag.NewFlagSet("restore plan", flag.ExitOnError)
+	job := fs.String("job", "", "Database, container, or tag to restore (required)")
+	targetFlag := fs.String("target-time", "", "Restore the data as it was at this time, as RFC 3339, \"YYYY-MM-DD hh:mm\", or a date (default: now)")
+	containerName := fs.String("container", "", "Container the backup would be restored into (default: the one it was taken from)")
+	fs.StringVar(containerName, "c", "", "Container the backup would be restored into (shorthand)")
+	asJSON := fs.Bool("json", false, "Print the plan as JSON")
+	catalogPath := fs.String("catalog", catalog.DefaultPath, "Backup catalog file")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *job == "" {
+		fmt.Fprintln(os.Stderr, "Error: --job is required")
+		fs.Usage()
+		return fmt.Errorf("missing required flags")
+	}
+	target, err := parseTimeBound(*targetFlag)
+	if err != nil {
+		return fmt.Errorf("invalid --target-time %q: %w", *targetFlag, err)
+	}
+	if target.IsZero() {
+		target = time.Now()
+	}
+
+	entries, err := catalog.Open(*catalogPath).Entries()
+	if err != nil {
+		return fmt.Errorf("failed to read catalog: %w", err)
+	}
+	entry, err := planBackup(*job, entries, target)
+	if err != nil {
+		return err
+	}
+	if *containerName == "" {
+		*containerName = entry.ContainerName
+	}
+	plan := buildRestorePlan(*job, target, entry, *containerName)
+
+	if *asJSON {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode plan: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	printRestorePlan(plan)
+	return nil
+}
+
+// planBackup picks the backup of job that recovers the most recent data
+// as of target: the newest full backup taken at or before it. Among copies
+// of the same backup a local one is preferred, as restore --group does.
+func planBackup(job string, entries []catalog.Entry, target time.Time) (catalog.Entry, error) {
+	var candidates []catalog.Entry
+	for _, e := range entries {
+		if e.Kind != catalog.KindBackup || e.Content != "" || e.CreatedAt.After(target) {
+			continue
+		}
+		if e.DatabaseName != job && e.ContainerName != job && !e.HasTag(job) {
+			continue
+		}
+		candidates = append(candidates, e)
+	}
+	if len(candidates) == 0 {
+		return catalog.Entry{}, fmt.Errorf("no full backup of %s taken at or before %s", job, target.Local().Format(time.DateTime))
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return !isRemoteBackup(a.Path) && !storage.IsLocation(a.Path) && (isRemoteBackup(b.Path) || storage.IsLocation(b.Path))
+	})
+	return candidates[0], nil
+}
+
+// buildRestorePlan lists what restoring entry into container would fetch
+// and apply, estimating each step from the throughput seen on its route
+func buildRestorePlan(job string, target time.Time, entry catalog.Entry, container string) restorePlan {
+	plan := restorePlan{Job: job, TargetTime: target, Backup: entry, Container: container}
+	rates := throughput.Open(throughputPath())
+	estimate := func(op, source, destination string, size int64) time.Duration {
+		rate, ok, err := rates.Rate(op, source, destination)
+		if err != nil || !ok || size <= 0 {
+			plan.EstimateIncomplete = true
+			return 0
+		}
+		d := rate.Estimate(size)
+		plan.Estimate += d
+		return d
+	}
+
+	size := entry.Size
+	if size == 0 {
+		if s, err := backup.BackupSize(entry.Path); err == nil {
+			size = s
+		}
+	}
+	command := []string{"back-it-up", "restore", "--id", entry.ID, "-c", container}
+
+	switch {
+	case isRemoteBackup(entry.Path):
+		source := remoteHost(entry.Path)
+		if ref, err := oci.ParseReference(entry.Path); err == nil {
+			source = registryHost(ref)
+		}
+		plan.Steps = append(plan.Steps, restorePlanStep{
+			Action:   planDownload,
+			Path:     entry.Path,
+			Size:     size,
+			Estimate: estimate(throughput.OpDownload, source, localHost(), size),
+		})
+		plan.DownloadSize += size
+	case storage.IsLocation(entry.Path):
+		// Streamed into the restore as it downloads, so there's no step of its own
+		plan.DownloadSize += size
+	default:
+		// Restore only replays globals kept next to a local backup
+		if m, err := backup.ReadManifest(entry.Path); err == nil && m != nil && m.Globals != "" {
+			globals := backup.GlobalsPath(entry.Path)
+			if globalsSize, err := backup.BackupSize(globals); err == nil {
+				plan.Steps = append(plan.Steps, restorePlanStep{
+					Action:   planGlobals,
+					Path:     globals,
+					Size:     globalsSize,
+					Estimate: estimate(throughput.OpRestore, localHost(), container, globalsSize),
+				})
+				command = append(command, "--globals")
+			}
+		}
+	}
+
+	action := planRestore
+	if storage.IsLocation(entry.Path) {
+		action = planStream
+	}
+	plan.Steps = append(plan.Steps, restorePlanStep{
+		Action:   action,
+		Path:     entry.Path,
+		Size:     size,
+		Estimate: estimate(throughput.OpRestore, localHost(), container, size),
+	})
+	plan.Command = strings.Join(command, " ")
+	return plan
+}
+
+func printRestorePlan(plan restorePlan) {
+	taken := plan.Backup.CreatedAt
+	fmt.Printf("Restore plan for %s as of %s\n", plan.Job, plan.TargetTime.Local().Format(time.DateTime))
+	fmt.Printf("Recovers backup %s, taken %s (%s before the target time)\n\n",
+		plan.Backup.ID, taken.Local().Format(time.DateTime), formatAge(plan.TargetTime.Sub(taken)))
+
+	descriptions := map[string]string{
+		planDownload: "download",
+		planStream:   "download and restore",
+		planGlobals:  "replay roles and tablespaces",
+		planRestore:  "restore",
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tACTION\tARTIFACT\tSIZE\tESTIMATE")
+	for i, s := range plan.Steps {
+		estimate := "unknown"
+		if s.Estimate > 0 {
+			estimate = "~" + formatEstimate(s.Estimate)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", i+1, descriptions[s.Action], s.Path, formatBytes(s.Size), estimate)
+	}
+	w.Flush()
+
+	fmt.Println()
+	if plan.DownloadSize > 0 {
+		fmt.Printf("Total download: %s\n", formatBytes(plan.DownloadSize))
+	} else {
+		fmt.Println("Total download: none, the backup is on local disk")
+	}
+	switch {
+	case plan.Estimate == 0:
+		fmt.Printf("Estimated duration: unknown; estimates appear after the first restores into %s\n", plan.Container)
+	case plan.EstimateIncomplete:
+		fmt.Printf("Estimated duration: over ~%s (some steps have no throughput history)\n", formatEstimate(plan.Estimate))
+	default:
+		fmt.Printf("Estimated duration: ~%s\n", formatEstimate(plan.Estimate))
+	}
+	fmt.Printf("\nNothing was restored. To run this plan:\n  %s\n", plan.Command)
+}
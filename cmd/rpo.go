@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/catalog"
+)
+
+// rpoPoint is a backup, or a failed attempt at one, on the timeline
+type rpoPoint struct {
+	ID   string    `json:"id"`
+	At   time.Time `json:"at"`
+	Path string    `json:"path,omitempty"`
+	Note string    `json:"note,omitempty"`
+}
+
+// rpoWindow is a stretch of time restored from the same backup. Duration
+// runs from when Backup was taken, which may be before From, to To: the data
+// a failure at the end of the window loses. A window with no Backup isn't
+// recoverable at all.
+type rpoWindow struct {
+	From       time.Time     `json:"from"`
+	To         time.Time     `json:"to"`
+	Backup     string        `json:"backup,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	OverTarget bool          `json:"over_target"`
+}
+
+// rpoReport is the recovery point timeline of a job over a period
+type rpoReport struct {
+	Job      string        `json:"job"`
+	From     time.Time     `json:"from"`
+	Until    time.Time     `json:"until"`
+	Target   time.Duration `json:"target"`
+	Backups  []rpoPoint    `json:"backups"`
+	Failures []rpoPoint    `json:"failures"`
+	Windows  []rpoWindow   `json:"windows"`
+	// WorstRPO is the longest window: the most data a failure during the
+	// period could have lost
+	WorstRPO time.Duration `json:"worst_rpo"`
+	// CurrentRPO is how much would be lost by a failure at Until
+	CurrentRPO time.Duration `json:"current_rpo"`
+}
+
+func runReportRPO(args []string) error {
+	fs := flag.NewFlagSet("report rpo", flag.ExitOnError)
+	job := fs.String("job", "", "Database, container, or tag whose recovery points are reported (required)")
+	format := fs.String("format", "svg", "Output format: svg or json")
+	output := fs.String("output", "", "File to write the report to (default: standard output)")
+	fs.StringVar(output, "o", "", "File to write the report to (shorthand)")
+	sinceFlag := fs.String("since", "", "Start of the timeline, as an RFC 3339 time or a date (default: 30 days before --until)")
+	untilFlag := fs.String("until", "", "End of the timeline, as an RFC 3339 time or a date (default: now)")
+	target := fs.Duration("target", 24*time.Hour, "Recovery point objective; longer windows are flagged")
+	catalogPath := fs.String("catalog", catalog.DefaultPath, "Backup catalog file")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *job == "" {
+		fmt.Fprintln(os.Stderr, "Error: --job is required")
+		fs.Usage()
+		return fmt.Errorf("missing required flags")
+	}
+	if *format != "svg" && *format != "json" {
+		return fmt.Errorf("unknown --format %q (expected svg or json)", *format)
+	}
+	if *target <= 0 {
+		return fmt.Errorf("--target must be positive")
+	}
+	since, err := parseTimeBound(*sinceFlag)
+	if err != nil {
+		return fmt.Errorf("invalid --since %q: %w", *sinceFlag, err)
+	}
+	until, err := parseTimeBound(*untilFlag)
+	if err != nil {
+		return fmt.Errorf("invalid --until %q: %w", *untilFlag, err)
+	}
+	if until.IsZero() {
+		until = time.Now()
+	}
+	if since.IsZero() {
+		since = until.Add(-30 * 24 * time.Hour)
+	}
+	if !since.Before(until) {
+		return fmt.Errorf("--since must be before --until")
+	}
+
+	entries, err := catalog.Open(*catalogPath).Entries()
+	if err != nil {
+		return err
+	}
+	report := buildRPOReport(*job, entries, since, until, *target)
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create report: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode report: %w", err)
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+	_, err = io.WriteString(w, renderRPOSVG(report))
+	return err
+}
+
+// buildRPOReport lays the backups of job in entries out between since and
+// until. Without WAL archiving, a backup's own time is the only moment it
+// recovers, so each window runs from one backup to the next.
+func buildRPOReport(job string, entries []catalog.Entry, since, until time.Time, target time.Duration) rpoReport {
+	report := rpoReport{Job: job, From: since, Until: until, Target: target, Backups: []rpoPoint{}, Failures: []rpoPoint{}, Windows: []rpoWindow{}}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+
+	// The last backup before the period covers its start
+	var anchor *catalog.Entry
+	for i, e := range entries {
+		if e.DatabaseName != job && e.ContainerName != job && !e.HasTag(job) {
+			continue
+		}
+		if e.CreatedAt.After(until) {
+			break
+		}
+		switch e.Kind {
+		case catalog.KindBackup:
+			if e.CreatedAt.Before(since) {
+				anchor = &entries[i]
+				continue
+			}
+			report.Backups = append(report.Backups, rpoPoint{ID: e.ID, At: e.CreatedAt, Path: e.Path})
+		case catalog.KindFailed, catalog.KindCancelled:
+			if !e.CreatedAt.Before(since) {
+				report.Failures = append(report.Failures, rpoPoint{ID: e.ID, At: e.CreatedAt, Note: e.Note})
+			}
+		}
+	}
+
+	start, backup, taken := since, "", since
+	if anchor != nil {
+		backup, taken = anchor.ID, anchor.CreatedAt
+	}
+	for _, b := range report.Backups {
+		if b.At.After(start) {
+			report.addWindow(start, b.At, backup, taken)
+		}
+		start, backup, taken = b.At, b.ID, b.At
+	}
+	report.addWindow(start, until, backup, taken)
+
+	for _, window := range report.Windows {
+		if window.Backup != "" {
+			report.WorstRPO = max(report.WorstRPO, window.Duration)
+		}
+	}
+	if last := report.Windows[len(report.Windows)-1]; last.Backup != "" {
+		report.CurrentRPO = last.Duration
+	}
+	return report
+}
+
+// addWindow adds the window from from to to, restored from backup, which
+// was taken at taken
+func (r *rpoReport) addWindow(from, to time.Time, backup string, taken time.Time) {
+	window := rpoWindow{From: from, To: to, Backup: backup, Duration: to.Sub(taken)}
+	window.OverTarget = backup == "" || window.Duration > r.Target
+	r.Windows = append(r.Windows, window)
+}
+
+// Layout of the SVG timeline
+const (
+	rpoWidth     = 960
+	rpoMargin    = 40
+	rpoBarTop    = 70
+	rpoBarHeight = 30
+	rpoHeight    = 150
+)
+
+// renderRPOSVG draws the windows of r as a bar, green where the backups
+// kept within the target, red where they didn't, and grey where nothing
+// was recoverable, with a tick at each backup and a cross at each failure
+func renderRPOSVG(r rpoReport) string {
+	span := r.Until.Sub(r.From).Seconds()
+	x := func(t time.Time) float64 {
+		return rpoMargin + (rpoWidth-2*rpoMargin)*t.Sub(r.From).Seconds()/span
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		rpoWidth, rpoHeight, rpoWidth, rpoHeight)
+	b.WriteString(`<rect width="100%" height="100%" fill="white"/>` + "\n")
+	fmt.Fprintf(&b, `<text x="%d" y="24" font-size="15" font-weight="bold">Recovery points of %s</text>`+"\n", rpoMargin, html.EscapeString(r.Job))
+	summary := fmt.Sprintf("%d backup(s), %d failure(s); worst RPO %s, current %s (target %s)",
+		len(r.Backups), len(r.Failures), formatAge(r.WorstRPO), formatAge(r.CurrentRPO), formatAge(r.Target))
+	if r.Windows[len(r.Windows)-1].Backup == "" {
+		summary = fmt.Sprintf("%d failure(s); no backup to recover from (target %s)", len(r.Failures), formatAge(r.Target))
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="44">%s</text>`+"\n", rpoMargin, html.EscapeString(summary))
+
+	for _, w := range r.Windows {
+		fill := "#4caf50"
+		switch {
+		case w.Backup == "":
+			fill = "#bdbdbd"
+		case w.OverTarget:
+			fill = "#e53935"
+		}
+		title := fmt.Sprintf("%s to %s: ", w.From.Format(time.RFC3339), w.To.Format(time.RFC3339))
+		if w.Backup == "" {
+			title += "no backup to restore"
+		} else {
+			title += fmt.Sprintf("up to %s lost, restoring %s", formatAge(w.Duration), w.Backup)
+		}
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s"><title>%s</title></rect>`+"\n",
+			x(w.From), rpoBarTop, x(w.To)-x(w.From), rpoBarHeight, fill, html.EscapeString(title))
+	}
+	for _, p := range r.Backups {
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="black"><title>%s</title></line>`+"\n",
+			x(p.At), rpoBarTop-6, x(p.At), rpoBarTop+rpoBarHeight+6, html.EscapeString(p.At.Format(time.RFC3339)+" "+p.ID))
+	}
+	for _, p := range r.Failures {
+		cx, cy := x(p.At), float64(rpoBarTop-12)
+		fmt.Fprintf(&b, `<path d="M%.1f %.1fl8 8m0 -8l-8 8" stroke="#b71c1c" stroke-width="2"><title>%s</title></path>`+"\n",
+			cx-4, cy-4, html.EscapeString(p.At.Format(time.RFC3339)+" failed: "+p.Note))
+	}
+	axis := rpoBarTop + rpoBarHeight + 24
+	fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`+"\n", rpoMargin, axis, r.From.Format("2006-01-02 15:04"))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`+"\n", rpoWidth-rpoMargin, axis, r.Until.Format("2006-01-02 15:04"))
+	b.WriteString("</svg>\n")
+	return b.String()
+}
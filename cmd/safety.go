@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/iostate/back-it-up/internal/backup"
+)
+
+// protectEnvVar holds a comma-separated list of protected container patterns
+// that applies to every command
+const protectEnvVar = "BACKITUP_PROTECT"
+
+// protectedPatterns combines the globally configured patterns with any given on the command line
+func protectedPatterns(flagPatterns []string) []string {
+	var patterns []string
+	for _, p := range strings.Split(os.Getenv(protectEnvVar), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return append(patterns, flagPatterns...)
+}
+
+// matchProtected returns the first pattern that matches containerName
+func matchProtected(containerName string, patterns []string) (string, bool) {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, containerName); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// guardProtectedTarget refuses destructive operations against protected
+// containers unless the override flag is set and the user types the database name
+func guardProtectedTarget(containerName, dbName string, patterns []string, override bool) error {
+	pattern, ok := matchProtected(containerName, patterns)
+	if !ok {
+		return nil
+	}
+
+	if !override {
+		return fmt.Errorf("container '%s' is protected (matches %q); pass --i-know-what-im-doing to overwrite it", containerName, pattern)
+	}
+
+	fmt.Fprintf(os.Stderr, "WARNING: container '%s' is protected (matches %q).\n", containerName, pattern)
+	answer, err := readLine(fmt.Sprintf("This will overwrite database '%s'. Type the database name to continue: ", dbName))
+	if err != nil {
+		return err
+	}
+	if answer != dbName {
+		return fmt.Errorf("confirmation did not match database name, aborting")
+	}
+
+	return nil
+}
+
+// guardProtectedVolume refuses to restore into a protected volume unless the
+// override flag is set and the user types the volume's name
+func guardProtectedVolume(volume string, patterns []string, override bool) error {
+	pattern, ok := matchProtected(volume, patterns)
+	if !ok {
+		return nil
+	}
+
+	if !override {
+		return fmt.Errorf("volume '%s' is protected (matches %q); pass --i-know-what-im-doing to overwrite it", volume, pattern)
+	}
+
+	fmt.Fprintf(os.Stderr, "WARNING: volume '%s' is protected (matches %q).\n", volume, pattern)
+	answer, err := readLine(fmt.Sprintf("This will overwrite the files in volume '%s'. Type the volume name to continue: ", volume))
+	if err != nil {
+		return err
+	}
+	if answer != volume {
+		return fmt.Errorf("confirmation did not match volume name, aborting")
+	}
+
+	return nil
+}
+
+// guardNonEmptyTarget refuses to restore into a database that already holds
+// tables, whose rows the dump would duplicate or collide with, unless merge
+// is set. A data-only dump needs the tables, so only rows in them count.
+func guardNonEmptyTarget(backupSvc *backup.Service, containerName, dbName, dbUser string, dataOnly, merge bool) error {
+	if merge {
+		return nil
+	}
+	contents, err := backupSvc.Contents(containerName, dbName, dbUser)
+	if err != nil {
+		return fmt.Errorf("failed to check the target database: %w", err)
+	}
+	if contents == nil || len(contents.Filled) == 0 && (dataOnly || len(contents.Tables) == 0) {
+		return nil
+	}
+
+	held := fmt.Sprintf("%d table(s), %d with rows", len(contents.Tables), len(contents.Filled))
+	if dataOnly {
+		held = fmt.Sprintf("rows in %d table(s)", len(contents.Filled))
+	}
+	if examples := contents.Filled; len(examples) > 0 {
+		if len(examples) > 3 {
+			examples = append(examples[:3:3], "...")
+		}
+		held += " (" + strings.Join(examples, ", ") + ")"
+	}
+	return fmt.Errorf("database '%s' in container '%s' already holds %s; pass --drop to replace it, or --merge to restore into it anyway", dbName, containerName, held)
+}
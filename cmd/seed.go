@@ -0,0 +1,224 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/iostate/back-it-up/internal/audit"
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/subset"
+)
+
+// defaultSeedDir is where seeds are written and looked up by default
+const defaultSeedDir = "./seeds"
+
+func runSeed(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: seed <create|apply> [flags]")
+	}
+
+	switch args[0] {
+	case "create":
+		return runSeedCreate(args[1:])
+	case "apply":
+		return runSeedApply(args[1:])
+	default:
+		return fmt.Errorf("unknown seed action %q (expected create or apply)", args[0])
+	}
+}
+
+func runSeedCreate(args []string) error {
+	fs := flag.NewFlagSet("seed create", flag.ExitOnError)
+	containerName := fs.String("container", "", "Docker container name (required unless --host is set)")
+	fs.StringVar(containerName, "c", "", "Docker container name (shorthand)")
+	host := fs.String("host", "", hostFlagUsage)
+	noDockerSocket := fs.Bool("no-docker-socket", false, noDockerSocketUsage)
+	dbName := fs.String("database", "postgres", "Database name")
+	fs.StringVar(dbName, "d", "postgres", "Database name (shorthand)")
+	dbUser := fs.String("user", "postgres", "Database user")
+	fs.StringVar(dbUser, "u", "postgres", "Database user (shorthand)")
+	outputPath := fs.String("output", "", "Seed file to write (default \"./seeds/<database>.seed.sql.gz\")")
+	fs.StringVar(outputPath, "o", "", "Seed file to write (shorthand)")
+	rows := fs.Int("rows", 1000, "Rows sampled per table before following foreign keys")
+	var tableRows stringList
+	fs.Var(&tableRows, "table-rows", "Per-table row budget as table=N (repeatable)")
+	var masks stringList
+	fs.Var(&masks, "mask", "Mask a column as table.column=keep|hash|email|null (repeatable)")
+	noAutoMask := fs.Bool("no-auto-mask", false, "Don't mask columns that look like personal data")
+	var roots stringList
+	fs.Var(&roots, "root", "Start from \"table [WHERE ...] [ORDER BY ...] [LIMIT n]\" instead of sampling every table (repeatable)")
+	noChildren := fs.Bool("no-children", false, "With --root, don't include rows that reference the root rows")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *containerName == "" && *host == "" {
+		fmt.Fprintln(os.Stderr, "Error: --container or --host flag is required")
+		fs.Usage()
+		return fmt.Errorf("missing required flag: --container")
+	}
+	if *containerName == "" {
+		*containerName = *host
+	}
+	if *outputPath == "" {
+		*outputPath = filepath.Join(defaultSeedDir, *dbName+".seed.sql.gz")
+	}
+
+	opts := subset.Options{
+		Rows:      *rows,
+		TableRows: map[string]int{},
+		Masks:     map[string]string{},
+		AutoMask:  !*noAutoMask,
+	}
+	for _, spec := range roots {
+		root, err := subset.ParseRoot(spec)
+		if err != nil {
+			return err
+		}
+		opts.Roots = append(opts.Roots, root)
+	}
+	if len(opts.Roots) > 0 {
+		opts.Children = !*noChildren
+		// Roots replace the per-table sample unless it was asked for explicitly
+		if !flagWasSet(fs, "rows") {
+			opts.Rows = 0
+		}
+	}
+	for _, spec := range tableRows {
+		table, n, ok := strings.Cut(spec, "=")
+		count, err := strconv.Atoi(n)
+		if !ok || err != nil || count < 0 {
+			return fmt.Errorf("invalid --table-rows %q: expected table=N", spec)
+		}
+		opts.TableRows[subset.QualifiedName(table)] = count
+	}
+	for _, spec := range masks {
+		column, strategy, err := subset.ParseMask(spec)
+		if err != nil {
+			return err
+		}
+		opts.Masks[column] = strategy
+	}
+
+	dockerSvc, err := newDatabaseService(*host, *noDockerSocket)
+	if err != nil {
+		return err
+	}
+	backupSvc := backup.NewService(dockerSvc)
+
+	fmt.Printf("Sampling database '%s' in container '%s'...\n", *dbName, *containerName)
+	result, err := backupSvc.Seed(backup.SeedConfig{
+		ContainerName: *containerName,
+		DatabaseName:  *dbName,
+		DatabaseUser:  *dbUser,
+		OutputPath:    *outputPath,
+		Options:       opts,
+	})
+	if err != nil {
+		return fmt.Errorf("seed failed: %w", err)
+	}
+
+	total := int64(0)
+	for _, t := range result.Tables {
+		total += t.Rows
+	}
+	for _, m := range result.Masked {
+		fmt.Printf("  masked %s\n", m)
+	}
+	fmt.Printf("Seed written to %s (%d rows across %d tables)\n", result.Path, total, len(result.Tables))
+	return nil
+}
+
+func runSeedApply(args []string) error {
+	fs := flag.NewFlagSet("seed apply", flag.ExitOnError)
+	containerName := fs.String("container", "", "Docker container name (required unless --host is set)")
+	fs.StringVar(containerName, "c", "", "Docker container name (shorthand)")
+	host := fs.String("host", "", hostFlagUsage)
+	noDockerSocket := fs.Bool("no-docker-socket", false, noDockerSocketUsage)
+	dbName := fs.String("database", "postgres", "Database name")
+	fs.StringVar(dbName, "d", "postgres", "Database name (shorthand)")
+	dbUser := fs.String("user", "postgres", "Database user")
+	fs.StringVar(dbUser, "u", "postgres", "Database user (shorthand)")
+	seedPath := fs.String("file", "", "Seed file, http(s) URL, or oci:// reference (default \"./seeds/<database>.seed.sql.gz\")")
+	fs.StringVar(seedPath, "f", "", "Seed file, http(s) URL, or oci:// reference (shorthand)")
+	var headers stringList
+	fs.Var(&headers, "header", "HTTP header sent when --file is a URL, as \"Name: value\" (repeatable)")
+	headerFile := fs.String("header-file", "", "File of --header lines, kept off the command line")
+	expectedSHA := fs.String("sha256", "", "Expected SHA-256 of a downloaded seed")
+	var protect stringList
+	fs.Var(&protect, "protect", "Container name pattern to protect from restores (repeatable)")
+	override := fs.Bool("i-know-what-im-doing", false, "Allow applying a seed to a protected container")
+	assumeYes := fs.Bool("yes", false, "Skip confirmation prompts")
+	fs.BoolVar(assumeYes, "y", false, "Skip confirmation prompts (shorthand)")
+	tlsOpts := addTLSFlags(fs)
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := tlsOpts.apply(); err != nil {
+		return err
+	}
+
+	if *containerName == "" && *host == "" {
+		fmt.Fprintln(os.Stderr, "Error: --container or --host flag is required")
+		fs.Usage()
+		return fmt.Errorf("missing required flag: --container")
+	}
+	if *containerName == "" {
+		*containerName = *host
+	}
+	if *seedPath == "" {
+		*seedPath = filepath.Join(defaultSeedDir, *dbName+".seed.sql.gz")
+	}
+
+	if err := guardProtectedTarget(*containerName, *dbName, protectedPatterns(protect), *override); err != nil {
+		return err
+	}
+	if err := confirmDestructive(*assumeYes,
+		fmt.Sprintf("database '%s' in container '%s' will be dropped", *dbName, *containerName),
+		fmt.Sprintf("it will be replaced with the seed %s", *seedPath),
+	); err != nil {
+		return err
+	}
+
+	source := *seedPath
+	if isRemoteBackup(*seedPath) {
+		specs, err := withHeaderFile(headers, *headerFile)
+		if err != nil {
+			return err
+		}
+		localPath, cleanup, err := fetchRemoteBackup(*seedPath, specs, *expectedSHA)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		*seedPath = localPath
+	}
+
+	dockerSvc, err := newDatabaseService(*host, *noDockerSocket)
+	if err != nil {
+		return err
+	}
+	backupSvc := backup.NewService(dockerSvc)
+
+	fmt.Printf("Applying seed to container '%s'...\n", *containerName)
+	err = backupSvc.Restore(backup.RestoreConfig{
+		ContainerName: *containerName,
+		DatabaseName:  *dbName,
+		DatabaseUser:  *dbUser,
+		BackupPath:    *seedPath,
+		DropExisting:  true,
+	})
+	recordAccess(audit.ActionRestore, source, "", restoreTarget(*containerName, *dbName), err)
+	if err != nil {
+		return fmt.Errorf("seed apply failed: %w", err)
+	}
+
+	fmt.Println("Seed applied successfully")
+	return nil
+}
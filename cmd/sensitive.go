@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/catalog"
+	"github.com/iostate/back-it-up/internal/dump"
+)
+
+// scanSensitive samples a finished plain backup for unencrypted card
+// numbers and social security numbers and prints what it found
+func scanSensitive(path string, rows int) (*catalog.SensitiveScan, error) {
+	r, err := backup.OpenBackup(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	fmt.Printf("Scanning up to %d rows per table for unencrypted sensitive values...\n", rows)
+	findings, err := dump.ScanSensitive(r, rows)
+	if err != nil {
+		return nil, fmt.Errorf("sensitive data scan failed: %w", err)
+	}
+	if len(findings) == 0 {
+		fmt.Println("✓ No card numbers or social security numbers found in sampled rows")
+	} else {
+		fmt.Fprintf(os.Stderr, "⚠ %d finding(s) of what look like unencrypted sensitive values:\n", len(findings))
+		for _, f := range findings {
+			fmt.Fprintf(os.Stderr, "  %s.%s: %s in %d of %d sampled value(s)\n", f.Table, f.Column, f.Kind, f.Matches, f.Sampled)
+		}
+	}
+	return &catalog.SensitiveScan{Rows: rows, Findings: findings}, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/iostate/back-it-up/internal/backup"
+)
+
+// checkSequences warns about sequences a restore left behind the values in
+// their columns, which make the next insert fail with a duplicate key, and
+// with fix moves them past. A check that can't run only warns: the data is
+// restored either way.
+func checkSequences(backupSvc *backup.Service, containerName, dbName, dbUser string, fix bool) error {
+	sequences, err := backupSvc.Sequences(containerName, dbName, dbUser)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: couldn't check sequences: %v\n", err)
+		return nil
+	}
+	var behind []backup.Sequence
+	for _, q := range sequences {
+		if q.Behind() {
+			behind = append(behind, q)
+		}
+	}
+	if len(behind) == 0 {
+		if len(sequences) > 0 {
+			fmt.Printf("✓ %d sequence(s) ahead of their columns\n", len(sequences))
+		}
+		return nil
+	}
+
+	for _, q := range behind {
+		fmt.Fprintf(os.Stderr, "Warning: sequence %s would return %d next, but %s.%s already holds up to %d\n", q.Name, q.Next, q.Table, q.Column, q.Max)
+	}
+	if !fix {
+		fmt.Fprintf(os.Stderr, "Warning: inserts relying on them will fail with duplicate keys; pass --fix-sequences to restores, or fix them now with:\n")
+		for _, q := range behind {
+			fmt.Fprintf(os.Stderr, "  SELECT setval('%s', %d);\n", q.Name, q.Max)
+		}
+		return nil
+	}
+	if err := backupSvc.FixSequences(containerName, dbName, dbUser, behind); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Moved %d sequence(s) past their columns' largest values\n", len(behind))
+	return nil
+}
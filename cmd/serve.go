@@ -0,0 +1,603 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/access"
+	"github.com/iostate/back-it-up/internal/audit"
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/catalog"
+	"github.com/iostate/back-it-up/internal/control"
+	"github.com/iostate/back-it-up/internal/oidc"
+)
+
+func runServe(args []string) error {
+	if len(args) > 0 && args[0] == "token" {
+		return runServeToken(args[1:])
+	}
+
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "Address to listen on")
+	accessPath := fs.String("access", access.DefaultPath, "Token store created with \"serve token add\"")
+	catalogPath := fs.String("catalog", catalog.DefaultPath, "Backup catalog file")
+	controlDir := fs.String("control-dir", control.DefaultDir, "Directory holding job pause markers")
+	undoDir := fs.String("undo-dir", "./backups/undo", "Directory for undo backups taken before restores")
+	var protect stringList
+	fs.Var(&protect, "protect", "Container name pattern only admins may restore into (repeatable)")
+	noDockerSocket := fs.Bool("no-docker-socket", false, noDockerSocketUsage)
+	tlsCert := fs.String("tls-cert", "", "Serve HTTPS with this certificate (reloaded when the file changes)")
+	tlsKey := fs.String("tls-key", "", "Private key for --tls-cert")
+	clientCA := fs.String("client-ca", "", "Require client certificates signed by this CA bundle (mutual TLS)")
+	issuer := fs.String("oidc-issuer", "", "OIDC issuer URL; enables SSO for the dashboard and API")
+	clientID := fs.String("oidc-client-id", "", "OIDC client ID (secret read from $"+oidcSecretEnvVar+")")
+	redirectURL := fs.String("oidc-redirect-url", "", "Callback URL registered with the provider (e.g. https://biu.example.com/callback)")
+	groupsClaim := fs.String("oidc-groups-claim", "groups", "Claim listing the user's groups")
+	var grantSpecs stringList
+	fs.Var(&grantSpecs, "oidc-role", "Map a group, email:<address>, or domain:<hd> to a role as group=role[:job,...] (repeatable)")
+	scopes := stringList{"profile", "email"}
+	fs.Var(&scopes, "oidc-scope", "Extra scope to request at login (repeatable)")
+	tlsOpts := addTLSFlags(fs)
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := tlsOpts.apply(); err != nil {
+		return err
+	}
+
+	if (*tlsCert == "") != (*tlsKey == "") || (*clientCA != "" && *tlsCert == "") {
+		fmt.Fprintln(os.Stderr, "Error: --tls-cert and --tls-key must be given together, and --client-ca needs both")
+		fs.Usage()
+		return fmt.Errorf("missing required flags")
+	}
+
+	var sso *ssoConfig
+	if *issuer != "" {
+		if *clientID == "" || *redirectURL == "" {
+			fmt.Fprintln(os.Stderr, "Error: --oidc-client-id and --oidc-redirect-url are required with --oidc-issuer")
+			fs.Usage()
+			return fmt.Errorf("missing required flags")
+		}
+		var err error
+		if sso, err = newSSOConfig(oidc.Config{
+			Issuer:       *issuer,
+			ClientID:     *clientID,
+			ClientSecret: os.Getenv(oidcSecretEnvVar),
+			RedirectURL:  *redirectURL,
+			Scopes:       scopes,
+		}, *groupsClaim, grantSpecs); err != nil {
+			return err
+		}
+	}
+
+	store := access.Open(*accessPath)
+	tokens, err := store.Tokens()
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 && sso == nil {
+		return fmt.Errorf("no tokens in %s: create one with \"serve token add --name <name> --role admin\" or configure --oidc-issuer", *accessPath)
+	}
+
+	srv := &server{
+		tokens:         store,
+		catalog:        catalog.Open(*catalogPath),
+		control:        control.Open(*controlDir),
+		undoDir:        *undoDir,
+		protect:        protectedPatterns(protect),
+		noDockerSocket: *noDockerSocket,
+		sso:            sso,
+	}
+	if sso != nil {
+		fmt.Printf("Dashboard login through %s\n", *issuer)
+	}
+	httpServer := &http.Server{Addr: *addr, Handler: srv.routes()}
+	if *tlsCert == "" {
+		fmt.Printf("Serving the API on %s (%d token(s) from %s)\n", *addr, len(tokens), *accessPath)
+		return httpServer.ListenAndServe()
+	}
+
+	certs, err := newCertReloader(*tlsCert, *tlsKey, *clientCA)
+	if err != nil {
+		return err
+	}
+	httpServer.TLSConfig = certs.tlsConfig()
+	mode := "TLS"
+	if *clientCA != "" {
+		mode = "mutual TLS"
+	}
+	fmt.Printf("Serving the API on %s over %s (%d token(s) from %s)\n", *addr, mode, len(tokens), *accessPath)
+	return httpServer.ListenAndServeTLS("", "")
+}
+
+// server is the HTTP API behind `serve`. Every request is authenticated with
+// a bearer token whose role gates what it may do.
+type server struct {
+	tokens         *access.Store
+	catalog        *catalog.Catalog
+	control        *control.Dir
+	undoDir        string
+	protect        []string
+	noDockerSocket bool
+	// sso is set when users log in through an OIDC provider
+	sso *ssoConfig
+
+	// restoreMu serializes restores so two requests never race on a database
+	restoreMu sync.Mutex
+}
+
+// authedHandler handles a request made with tok
+type authedHandler func(w http.ResponseWriter, r *http.Request, tok access.Token)
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/backups", s.require(access.RoleViewer, s.handleBackups))
+	mux.Handle("GET /api/jobs", s.require(access.RoleViewer, s.handleJobs))
+	mux.Handle("POST /api/jobs/{name}/pause", s.require(access.RoleOperator, s.handlePause))
+	mux.Handle("POST /api/jobs/{name}/resume", s.require(access.RoleOperator, s.handleResume))
+	mux.Handle("POST /api/runs/{id}/cancel", s.require(access.RoleOperator, s.handleCancel))
+	mux.Handle("POST /api/restore", s.require(access.RoleOperator, s.handleRestore))
+	mux.Handle("GET /api/audit", s.require(access.RoleAdmin, s.handleAudit))
+	mux.Handle("GET /api/tokens", s.require(access.RoleAdmin, s.handleTokens))
+	mux.Handle("GET /{$}", s.require(access.RoleViewer, s.handleDashboard))
+	if s.sso != nil {
+		mux.HandleFunc("GET /login", s.sso.handleLogin)
+		mux.HandleFunc("GET /callback", s.sso.handleCallback)
+		mux.HandleFunc("GET /logout", s.sso.handleLogout)
+	}
+	return mux
+}
+
+// require authenticates the request and rejects tokens below role
+func (s *server) require(role access.Role, next authedHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || secret == "" {
+			// Dashboard sessions are read-only, so a forged cross-site
+			// request can never change anything
+			if s.sso != nil && r.Method == http.MethodGet {
+				if tok, ok := s.sso.sessionToken(r); ok {
+					s.authorize(w, r, tok, role, next)
+					return
+				}
+				if r.URL.Path == "/" {
+					http.Redirect(w, r, "/login", http.StatusFound)
+					return
+				}
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="back-it-up"`)
+			writeError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+		tok, ok, err := s.tokens.Authenticate(secret)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !ok && s.sso != nil && oidc.LooksLikeJWT(secret) {
+			claims, err := s.sso.provider.Verify(secret)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="back-it-up", error="invalid_token"`)
+				writeError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+			if tok, ok = s.sso.tokenFor(claims); !ok {
+				writeError(w, http.StatusForbidden, fmt.Sprintf("%s has no role mapped", identityName(claims)))
+				return
+			}
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="back-it-up", error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		s.authorize(w, r, tok, role, next)
+	})
+}
+
+// authorize runs next if tok carries at least role
+func (s *server) authorize(w http.ResponseWriter, r *http.Request, tok access.Token, role access.Role, next authedHandler) {
+	if !tok.Role.Allows(role) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("role %s required", role))
+		return
+	}
+	next(w, r, tok)
+}
+
+// entryScoped reports whether tok may see or act on a catalog entry
+func entryScoped(tok access.Token, e catalog.Entry) bool {
+	return tok.Scoped(append([]string{e.DatabaseName, e.ContainerName}, e.Tags...)...)
+}
+
+func (s *server) handleBackups(w http.ResponseWriter, r *http.Request, tok access.Token) {
+	q := r.URL.Query()
+	var meta metaFlag
+	for _, pair := range q["meta"] {
+		if err := meta.Set(pair); err != nil {
+			writeError(w, http.StatusBadRequest, "meta: "+err.Error())
+			return
+		}
+	}
+	since, err := parseTimeBound(q.Get("since"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "since: "+err.Error())
+		return
+	}
+	until, err := parseTimeBound(q.Get("until"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "until: "+err.Error())
+		return
+	}
+	entries, err := s.catalog.Find(catalog.Filter{
+		Kind:         q.Get("kind"),
+		DatabaseName: q.Get("database"),
+		Tag:          q.Get("tag"),
+		Meta:         meta,
+		Since:        since,
+		Until:        until,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	visible := []catalog.Entry{}
+	for _, e := range entries {
+		if entryScoped(tok, e) {
+			visible = append(visible, e)
+		}
+	}
+	writeJSON(w, http.StatusOK, visible)
+}
+
+func (s *server) handleJobs(w http.ResponseWriter, r *http.Request, tok access.Token) {
+	pauses, err := s.control.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	runs, err := s.control.Runs()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	visible := []control.Pause{}
+	for _, p := range pauses {
+		if tok.Scoped(p.Job) {
+			visible = append(visible, p)
+		}
+	}
+	running := []control.Run{}
+	for _, run := range runs {
+		if runScoped(tok, run) {
+			running = append(running, run)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"paused": visible, "running": running})
+}
+
+// runScoped reports whether tok may see or cancel a run
+// restoreScoped reports whether tok may restore into the database in
+// container: the target as container/database matches one of its patterns,
+// or the container and the database both do
+func restoreScoped(tok access.Token, container, database string) bool {
+	if database != "" && tok.Scoped(restoreTarget(container, database)) {
+		return true
+	}
+	return tok.ScopedAll(container, database)
+}
+
+func runScoped(tok access.Token, run control.Run) bool {
+	return tok.Scoped(append([]string{run.Database, run.Container}, run.Tags...)...)
+}
+
+func (s *server) handleCancel(w http.ResponseWriter, r *http.Request, tok access.Token) {
+	id := r.PathValue("id")
+	run, err := s.control.Run(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if !runScoped(tok, run) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("token is not scoped to run %s", id))
+		return
+	}
+	if _, err := s.control.Cancel(id, "token:"+tok.Name); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id": id, "status": "cancelled"})
+}
+
+func (s *server) handlePause(w http.ResponseWriter, r *http.Request, tok access.Token) {
+	name := r.PathValue("name")
+	if !tok.Scoped(name) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("token is not scoped to job %q", name))
+		return
+	}
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+	}
+	if body.Reason == "" {
+		body.Reason = "paused by " + tok.Name
+	}
+	if err := s.control.Pause(name, body.Reason); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"job": name, "status": "paused"})
+}
+
+func (s *server) handleResume(w http.ResponseWriter, r *http.Request, tok access.Token) {
+	name := r.PathValue("name")
+	if !tok.Scoped(name) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("token is not scoped to job %q", name))
+		return
+	}
+	if err := s.control.Resume(name); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"job": name, "status": "resumed"})
+}
+
+// restoreRequest is the body of POST /api/restore
+type restoreRequest struct {
+	ID        string `json:"id"`
+	Tag       string `json:"tag"`
+	Container string `json:"container"`
+	Host      string `json:"host"`
+	Database  string `json:"database"`
+	User      string `json:"user"`
+	Drop      bool   `json:"drop"`
+	NoUndo    bool   `json:"no_undo"`
+	// Merge restores into a database that already holds tables or rows
+	Merge bool `json:"merge"`
+}
+
+func (s *server) handleRestore(w http.ResponseWriter, r *http.Request, tok access.Token) {
+	var req restoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if (req.ID == "") == (req.Tag == "") || (req.Container == "" && req.Host == "") {
+		writeError(w, http.StatusBadRequest, "one of id or tag, and one of container or host, are required")
+		return
+	}
+	if req.Merge && req.Drop {
+		writeError(w, http.StatusBadRequest, "merge and drop can't be combined")
+		return
+	}
+	if req.Container == "" {
+		req.Container = req.Host
+	}
+	if req.User == "" {
+		req.User = "postgres"
+	}
+	// Scoped to the target as well as the backup, so a token for one job
+	// can't load its backups over another's database; checked first, so
+	// callers out of scope can't probe the catalog either
+	if !restoreScoped(tok, req.Container, req.Database) {
+		target := req.Container
+		if req.Database != "" {
+			target = restoreTarget(req.Container, req.Database)
+		}
+		writeError(w, http.StatusForbidden, fmt.Sprintf("token is not scoped to restore into %s", target))
+		return
+	}
+
+	entry, err := resolveCatalogBackup(s.catalog, req.ID, req.Tag)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if !entryScoped(tok, entry) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("token is not scoped to backup %s", entry.ID))
+		return
+	}
+	if req.Database == "" {
+		req.Database = entry.DatabaseName
+	}
+	if pattern, ok := matchProtected(req.Container, s.protect); ok && !tok.Role.Allows(access.RoleAdmin) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("container '%s' is protected (matches %q); role admin required", req.Container, pattern))
+		return
+	}
+
+	s.restoreMu.Lock()
+	defer s.restoreMu.Unlock()
+
+	err = s.restore(req, entry)
+	logAccess(audit.Event{
+		Action:    audit.ActionRestore,
+		Artifact:  entry.Path,
+		CatalogID: entry.ID,
+		Actor:     "token:" + tok.Name,
+		Remote:    clientAddress(r),
+		Target:    restoreTarget(req.Container, req.Database),
+	}, err)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"id":        entry.ID,
+		"container": req.Container,
+		"database":  req.Database,
+		"status":    "restored",
+	})
+}
+
+// restore loads entry into the requested database, taking an undo point first when dropping
+func (s *server) restore(req restoreRequest, entry catalog.Entry) error {
+	if err := verifyCatalogChecksum(entry); err != nil {
+		return err
+	}
+
+	dockerSvc, err := newDatabaseService(req.Host, s.noDockerSocket)
+	if err != nil {
+		return err
+	}
+	backupSvc := backup.NewService(dockerSvc)
+
+	if !req.Drop {
+		dataOnly := backup.DumpContent(entry.Path) == backup.ContentData
+		if err := guardNonEmptyTarget(backupSvc, req.Container, req.Database, req.User, dataOnly, req.Merge); err != nil {
+			return err
+		}
+	}
+	if req.Drop && !req.NoUndo {
+		if err := takeUndoPoint(backupSvc, s.catalog, req.Container, req.Database, req.User, s.undoDir); err != nil {
+			return fmt.Errorf("failed to take undo backup: %w", err)
+		}
+	}
+	return backupSvc.Restore(backup.RestoreConfig{
+		ContainerName: req.Container,
+		DatabaseName:  req.Database,
+		DatabaseUser:  req.User,
+		BackupPath:    entry.Path,
+		DropExisting:  req.Drop,
+	})
+}
+
+func (s *server) handleAudit(w http.ResponseWriter, r *http.Request, tok access.Token) {
+	events, err := audit.Open(auditLogPath()).Events()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := audit.Verify(events); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if events == nil {
+		events = []audit.Event{}
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+func (s *server) handleTokens(w http.ResponseWriter, r *http.Request, tok access.Token) {
+	tokens, err := s.tokens.Tokens()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for i := range tokens {
+		tokens[i].Hash = ""
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// clientAddress identifies the caller for the audit log: its IP, plus the
+// subject of its client certificate under mutual TLS
+func clientAddress(r *http.Request) string {
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		addr = r.RemoteAddr
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		addr += " (" + r.TLS.PeerCertificates[0].Subject.String() + ")"
+	}
+	return addr
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func runServeToken(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: serve token <add|list|revoke> [flags]")
+	}
+
+	action := args[0]
+	fs := flag.NewFlagSet("serve token "+action, flag.ExitOnError)
+	accessPath := fs.String("access", access.DefaultPath, "Token store")
+	name := fs.String("name", "", "Token name, recorded as the actor in the audit log")
+	role := fs.String("role", string(access.RoleViewer), "Role: viewer, operator, or admin")
+	var jobs stringList
+	fs.Var(&jobs, "job", "Job (database, container, or tag) pattern the token is limited to (repeatable)")
+
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	store := access.Open(*accessPath)
+
+	switch action {
+	case "add":
+		if *name == "" {
+			fmt.Fprintln(os.Stderr, "Error: --name flag is required")
+			fs.Usage()
+			return fmt.Errorf("missing required flag: --name")
+		}
+		r, err := access.ParseRole(*role)
+		if err != nil {
+			return err
+		}
+		secret, _, err := store.Add(*name, r, jobs)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Token '%s' (%s) created. It won't be shown again:\n%s\n", *name, r, secret)
+		return nil
+
+	case "list":
+		tokens, err := store.Tokens()
+		if err != nil {
+			return err
+		}
+		if len(tokens) == 0 {
+			fmt.Println("No tokens")
+			return nil
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tROLE\tJOBS\tCREATED")
+		for _, t := range tokens {
+			scope := "*"
+			if len(t.Jobs) > 0 {
+				scope = strings.Join(t.Jobs, ",")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", t.Name, t.Role, scope, t.CreatedAt.Format(time.RFC3339))
+		}
+		return tw.Flush()
+
+	case "revoke":
+		if *name == "" {
+			fmt.Fprintln(os.Stderr, "Error: --name flag is required")
+			fs.Usage()
+			return fmt.Errorf("missing required flag: --name")
+		}
+		if err := store.Revoke(*name); err != nil {
+			return err
+		}
+		fmt.Printf("Token '%s' revoked\n", *name)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown token action %q (expected add, list, or revoke)", action)
+	}
+}
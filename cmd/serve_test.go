@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/iostate/back-it-up/internal/access"
+)
+
+func TestRestoreScoped(t *testing.T) {
+	tests := []struct {
+		name      string
+		jobs      []string
+		container string
+		database  string
+		want      bool
+	}{
+		{"unscoped token", nil, "prod-pg", "app", true},
+		{"database scope only", []string{"app"}, "prod-pg", "app", false},
+		{"container scope only", []string{"prod-pg"}, "prod-pg", "billing", false},
+		{"both names", []string{"app", "prod-pg"}, "prod-pg", "app", true},
+		{"target pattern", []string{"prod-pg/*"}, "prod-pg", "app", true},
+		{"cross-container target", []string{"prod-pg/*"}, "other-pg", "app", false},
+		{"cross-container with database scope", []string{"app", "prod-pg"}, "other-pg", "app", false},
+		{"container restore", []string{"prod-pg"}, "prod-pg", "", true},
+		{"other container restore", []string{"prod-pg"}, "other-pg", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok := access.Token{Name: "t", Role: access.RoleOperator, Jobs: tt.jobs}
+			if got := restoreScoped(tok, tt.container, tt.database); got != tt.want {
+				t.Errorf("restoreScoped(%v, %q, %q) = %v, want %v", tt.jobs, tt.container, tt.database, got, tt.want)
+			}
+		})
+	}
+}
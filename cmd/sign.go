@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/storage"
+)
+
+// checkSignatures validates the detached signatures of a backup and of its
+// globals file, if there is one, as made by one of keys if any are given.
+// Unsigned files pass unless require is set.
+func checkSignatures(path, globalsPath string, require bool, keys []string) error {
+	paths := []string{path}
+	if globalsPath != "" {
+		paths = append(paths, globalsPath)
+	}
+	for _, p := range paths {
+		signer, err := backup.CheckSignature(p, require, keys)
+		if err != nil {
+			return err
+		}
+		if signer == "" {
+			continue
+		}
+		fmt.Printf("✓ Signature of %s verified (key %s)\n", p, signer)
+		if len(keys) == 0 {
+			fmt.Fprintf(os.Stderr, "Warning: no --verify-key was given, so a signature by any key in the keyring passes\n")
+		}
+	}
+	return nil
+}
+
+func runVerifyFile(args []string) error {
+	fs := flag.NewFlagSet("verify-file", flag.ExitOnError)
+	path := fs.String("file", "", "Backup file to verify (required)")
+	fs.StringVar(path, "f", "", "Backup file to verify (shorthand)")
+	allowUnsigned := fs.Bool("allow-unsigned", false, "Only check the file's integrity if it has no signature")
+	var verifyKeys stringList
+	fs.Var(&verifyKeys, "verify-key", "GPG key the signature must be made by: a fingerprint, key ID, or user ID (repeatable)")
+	var identities stringList
+	fs.Var(&identities, "identity-file", "age identity file to decrypt an encrypted backup with (repeatable; default $"+identityEnvVar+")")
+	tlsOpts := addTLSFlags(fs)
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := tlsOpts.apply(); err != nil {
+		return err
+	}
+	useIdentityFiles(identities)
+
+	if *path == "" {
+		fmt.Fprintln(os.Stderr, "Error: --file is required")
+		fs.Usage()
+		return fmt.Errorf("missing required flags")
+	}
+	if !backup.BackupExists(*path) {
+		return fmt.Errorf("failed to open backup file: %s not found", *path)
+	}
+
+	globalsPath := backup.GlobalsPath(*path)
+	if !backup.BackupExists(globalsPath) {
+		globalsPath = ""
+	}
+	if err := checkSignatures(*path, globalsPath, !*allowUnsigned, verifyKeys); err != nil {
+		return err
+	}
+
+	checked, err := backup.VerifyChecksumFile(*path)
+	if err != nil {
+		return fmt.Errorf("integrity check failed: %w", err)
+	} else if checked {
+		fmt.Printf("✓ Checksum matches %s\n", backup.ChecksumPath(*path))
+	}
+	// A stored backup is checked against its checksum file as it is read back
+	stored := storage.IsLocation(*path)
+	manifest, err := backup.CheckManifest(*path, !checked)
+	if err != nil {
+		return fmt.Errorf("integrity check failed: %w", err)
+	}
+	if manifest != nil && !stored {
+		if checked {
+			fmt.Printf("✓ Size matches %s\n", backup.ManifestPath(*path))
+		} else {
+			fmt.Printf("✓ Size and checksum match %s\n", backup.ManifestPath(*path))
+		}
+	}
+	if hashed, err := backup.VerifyContentAddress(*path); err != nil {
+		return fmt.Errorf("integrity check failed: %w", err)
+	} else if hashed {
+		fmt.Println("✓ Content hash matches file name")
+	}
+
+	n, err := backup.ReadBackup(*path)
+	if err != nil {
+		return fmt.Errorf("integrity check failed: %w", err)
+	}
+	// Directory dumps read back as the compressed tar, which isn't recorded
+	if manifest != nil && manifest.DumpFormat != backup.FormatDirectory && n != manifest.UncompressedSize {
+		return fmt.Errorf("integrity check failed: %s reads back as %d bytes, but its manifest recorded %d", *path, n, manifest.UncompressedSize)
+	}
+	if stored && backup.BackupExists(backup.ChecksumPath(*path)) {
+		fmt.Printf("✓ Checksum matches %s\n", backup.ChecksumPath(*path))
+	}
+	fmt.Printf("✓ %s reads back in full (%s)\n", *path, formatBytes(n))
+	return nil
+}
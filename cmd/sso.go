@@ -0,0 +1,305 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/access"
+	"github.com/iostate/back-it-up/internal/oidc"
+)
+
+// oidcSecretEnvVar holds the OIDC client secret so it stays out of process listings
+const oidcSecretEnvVar = "BACKITUP_OIDC_CLIENT_SECRET"
+
+// sessionKeyEnvVar holds the key dashboard sessions are signed with, so they survive restarts
+const sessionKeyEnvVar = "BACKITUP_SESSION_KEY"
+
+const (
+	sessionCookie   = "biu_session"
+	loginCookie     = "biu_login"
+	sessionTTL      = 8 * time.Hour
+	loginStateTTL   = 10 * time.Minute
+	oidcActorPrefix = "oidc:"
+)
+
+// Kinds of identity a grant matches, each in a namespace of its own so a
+// group can't be named like someone's email or domain
+const (
+	grantGroup  = "group:"
+	grantEmail  = "email:"
+	grantDomain = "domain:"
+)
+
+// roleGrant maps an identity provider group (or email, or hosted domain) to a
+// role, optionally limited to jobs
+type roleGrant struct {
+	// match is the identity with its kind prefix, e.g. "email:ana@example.com"
+	match string
+	role  access.Role
+	jobs  []string
+}
+
+// parseRoleGrant parses "group=role" or "group=role:job-pattern,job-pattern",
+// where group may instead be "email:<address>" or "domain:<hd>"; a bare
+// name, or one prefixed "group:", is a group
+func parseRoleGrant(spec string) (roleGrant, error) {
+	match, rest, ok := strings.Cut(spec, "=")
+	if !ok || match == "" {
+		return roleGrant{}, fmt.Errorf("invalid --oidc-role %q: expected group=role[:job,...]", spec)
+	}
+	if !strings.HasPrefix(match, grantGroup) && !strings.HasPrefix(match, grantEmail) && !strings.HasPrefix(match, grantDomain) {
+		match = grantGroup + match
+	}
+	if _, name, _ := strings.Cut(match, ":"); name == "" {
+		return roleGrant{}, fmt.Errorf("invalid --oidc-role %q: no group, email, or domain to match", spec)
+	}
+	roleName, jobs, _ := strings.Cut(rest, ":")
+	role, err := access.ParseRole(roleName)
+	if err != nil {
+		return roleGrant{}, fmt.Errorf("invalid --oidc-role %q: %w", spec, err)
+	}
+	g := roleGrant{match: match, role: role}
+	if jobs != "" {
+		g.jobs = strings.Split(jobs, ",")
+	}
+	return g, nil
+}
+
+// ssoConfig is the OIDC side of `serve`
+type ssoConfig struct {
+	provider    *oidc.Provider
+	groupsClaim string
+	grants      []roleGrant
+	sessionKey  []byte
+	secure      bool
+}
+
+// newSSOConfig discovers the provider and parses the role mappings
+func newSSOConfig(cfg oidc.Config, groupsClaim string, grantSpecs []string) (*ssoConfig, error) {
+	if len(grantSpecs) == 0 {
+		return nil, fmt.Errorf("--oidc-role is required with --oidc-issuer: map at least one group to a role")
+	}
+	c := &ssoConfig{groupsClaim: groupsClaim, secure: strings.HasPrefix(cfg.RedirectURL, "https://")}
+	for _, spec := range grantSpecs {
+		g, err := parseRoleGrant(spec)
+		if err != nil {
+			return nil, err
+		}
+		c.grants = append(c.grants, g)
+	}
+
+	var err error
+	if c.sessionKey, err = newSessionKey(); err != nil {
+		return nil, err
+	}
+	if c.provider, err = oidc.Discover(cfg); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// identities lists the values grants are matched against, each with its
+// kind prefix: the groups claim, the email if the provider says it is
+// verified, and the Google Workspace hosted domain
+func (c *ssoConfig) identities(claims oidc.Claims) []string {
+	var ids []string
+	for _, group := range claims.Strings(c.groupsClaim) {
+		ids = append(ids, grantGroup+group)
+	}
+	// A provider that leaves the claim out hasn't verified the address
+	if email := claims.String("email"); email != "" && claims["email_verified"] == true {
+		ids = append(ids, grantEmail+email)
+	}
+	if hd := claims.String("hd"); hd != "" {
+		ids = append(ids, grantDomain+hd)
+	}
+	return ids
+}
+
+// tokenFor turns verified claims into the token the request acts as. The
+// highest mapped role wins; its job scopes are merged, and any unscoped
+// grant of that role lifts the scope entirely.
+func (c *ssoConfig) tokenFor(claims oidc.Claims) (access.Token, bool) {
+	var best []roleGrant
+	for _, id := range c.identities(claims) {
+		for _, g := range c.grants {
+			if g.match != id {
+				continue
+			}
+			switch {
+			case len(best) == 0 || g.role.Allows(best[0].role) && g.role != best[0].role:
+				best = []roleGrant{g}
+			case g.role == best[0].role:
+				best = append(best, g)
+			}
+		}
+	}
+	if len(best) == 0 {
+		return access.Token{}, false
+	}
+
+	tok := access.Token{Name: oidcActorPrefix + identityName(claims), Role: best[0].role}
+	for _, g := range best {
+		if len(g.jobs) == 0 {
+			tok.Jobs = nil
+			break
+		}
+		tok.Jobs = append(tok.Jobs, g.jobs...)
+	}
+	return tok, true
+}
+
+// identityName picks the most readable name for the audit log
+func identityName(claims oidc.Claims) string {
+	for _, name := range []string{"email", "preferred_username", "upn", "sub"} {
+		if v := claims.String(name); v != "" {
+			return v
+		}
+	}
+	return "unknown"
+}
+
+// session is what the signed dashboard cookie carries
+type session struct {
+	Token   access.Token     `json:"token"`
+	Request oidc.AuthRequest `json:"request"`
+	Expires time.Time        `json:"expires"`
+}
+
+// newSessionKey returns the configured session key or a random one
+func newSessionKey() ([]byte, error) {
+	if k := os.Getenv(sessionKeyEnvVar); k != "" {
+		return []byte(k), nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate session key: %w", err)
+	}
+	return key, nil
+}
+
+func (c *ssoConfig) sign(v session) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, c.sessionKey)
+	mac.Write(data)
+	return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (c *ssoConfig) open(value string) (session, bool) {
+	payload, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return session{}, false
+	}
+	data, err1 := base64.RawURLEncoding.DecodeString(payload)
+	got, err2 := base64.RawURLEncoding.DecodeString(sig)
+	if err1 != nil || err2 != nil {
+		return session{}, false
+	}
+	mac := hmac.New(sha256.New, c.sessionKey)
+	mac.Write(data)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return session{}, false
+	}
+	var s session
+	if json.Unmarshal(data, &s) != nil || time.Now().After(s.Expires) {
+		return session{}, false
+	}
+	return s, true
+}
+
+func (c *ssoConfig) setCookie(w http.ResponseWriter, name string, v session) error {
+	value, err := c.sign(v)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  v.Expires,
+		HttpOnly: true,
+		Secure:   c.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{Name: name, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+}
+
+// sessionToken returns the token of a logged-in dashboard user
+func (c *ssoConfig) sessionToken(r *http.Request) (access.Token, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return access.Token{}, false
+	}
+	s, ok := c.open(cookie.Value)
+	if !ok || s.Token.Name == "" {
+		return access.Token{}, false
+	}
+	return s.Token, true
+}
+
+func (c *ssoConfig) handleLogin(w http.ResponseWriter, r *http.Request) {
+	req, err := oidc.NewAuthRequest()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := c.setCookie(w, loginCookie, session{Request: req, Expires: time.Now().Add(loginStateTTL)}); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, c.provider.AuthCodeURL(req), http.StatusFound)
+}
+
+func (c *ssoConfig) handleCallback(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(loginCookie)
+	if err != nil {
+		http.Error(w, "login expired, try again", http.StatusBadRequest)
+		return
+	}
+	login, ok := c.open(cookie.Value)
+	clearCookie(w, loginCookie)
+	if !ok || r.URL.Query().Get("state") != login.Request.State {
+		http.Error(w, "login state mismatch, try again", http.StatusBadRequest)
+		return
+	}
+	if msg := r.URL.Query().Get("error"); msg != "" {
+		http.Error(w, "login failed: "+msg+" "+r.URL.Query().Get("error_description"), http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := c.provider.Exchange(r.URL.Query().Get("code"), login.Request)
+	if err != nil {
+		http.Error(w, "login failed: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	tok, ok := c.tokenFor(claims)
+	if !ok {
+		http.Error(w, fmt.Sprintf("%s has no role here; ask an admin to map one of your groups with --oidc-role", identityName(claims)), http.StatusForbidden)
+		return
+	}
+	if err := c.setCookie(w, sessionCookie, session{Token: tok, Expires: time.Now().Add(sessionTTL)}); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (c *ssoConfig) handleLogout(w http.ResponseWriter, r *http.Request) {
+	clearCookie(w, sessionCookie)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/iostate/back-it-up/internal/access"
+	"github.com/iostate/back-it-up/internal/oidc"
+)
+
+func TestParseRoleGrant(t *testing.T) {
+	tests := []struct {
+		spec    string
+		match   string
+		role    access.Role
+		jobs    []string
+		wantErr bool
+	}{
+		{spec: "dba=admin", match: "group:dba", role: access.RoleAdmin},
+		{spec: "group:dba=viewer", match: "group:dba", role: access.RoleViewer},
+		{spec: "email:ana@example.com=operator:staging-*,qa", match: "email:ana@example.com", role: access.RoleOperator, jobs: []string{"staging-*", "qa"}},
+		{spec: "domain:example.com=viewer", match: "domain:example.com", role: access.RoleViewer},
+		{spec: "email:=admin", wantErr: true},
+		{spec: "dba", wantErr: true},
+		{spec: "dba=root", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			g, err := parseRoleGrant(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseRoleGrant(%q) = %+v, want an error", tt.spec, g)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRoleGrant(%q): %v", tt.spec, err)
+			}
+			if g.match != tt.match || g.role != tt.role || !slices.Equal(g.jobs, tt.jobs) {
+				t.Errorf("parseRoleGrant(%q) = %+v, want match %q role %s jobs %v", tt.spec, g, tt.match, tt.role, tt.jobs)
+			}
+		})
+	}
+}
+
+func TestTokenFor(t *testing.T) {
+	var grants []roleGrant
+	for _, spec := range []string{"dba=admin", "email:ana@example.com=operator:staging-*", "domain:example.com=viewer", "ops@example.com=admin"} {
+		g, err := parseRoleGrant(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		grants = append(grants, g)
+	}
+	c := &ssoConfig{groupsClaim: "groups", grants: grants}
+
+	tests := []struct {
+		name   string
+		claims oidc.Claims
+		role   access.Role
+		jobs   []string
+		ok     bool
+	}{
+		{"group", oidc.Claims{"groups": []any{"dba"}}, access.RoleAdmin, nil, true},
+		{"verified email", oidc.Claims{"email": "ana@example.com", "email_verified": true}, access.RoleOperator, []string{"staging-*"}, true},
+		{"missing email_verified", oidc.Claims{"email": "ana@example.com"}, "", nil, false},
+		{"string email_verified", oidc.Claims{"email": "ana@example.com", "email_verified": "true"}, "", nil, false},
+		{"unverified email", oidc.Claims{"email": "ana@example.com", "email_verified": false}, "", nil, false},
+		{"hosted domain", oidc.Claims{"hd": "example.com"}, access.RoleViewer, nil, true},
+		{"domain isn't a group", oidc.Claims{"groups": []any{"example.com"}}, "", nil, false},
+		{"group named like an email", oidc.Claims{"email": "ops@example.com", "email_verified": true}, "", nil, false},
+		{"highest role wins", oidc.Claims{"groups": []any{"dba"}, "hd": "example.com"}, access.RoleAdmin, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, ok := c.tokenFor(tt.claims)
+			if ok != tt.ok {
+				t.Fatalf("tokenFor(%v) ok = %v, want %v", tt.claims, ok, tt.ok)
+			}
+			if ok && (tok.Role != tt.role || !slices.Equal(tok.Jobs, tt.jobs)) {
+				t.Errorf("tokenFor(%v) = role %s jobs %v, want role %s jobs %v", tt.claims, tok.Role, tok.Jobs, tt.role, tt.jobs)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/audit"
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/catalog"
+	"github.com/iostate/back-it-up/internal/clock"
+	"github.com/iostate/back-it-up/internal/compose"
+	"github.com/iostate/back-it-up/internal/throughput"
+	"github.com/iostate/back-it-up/internal/usage"
+)
+
+func runStack(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: stack <backup|restore> [flags]")
+	}
+
+	switch args[0] {
+	case "backup":
+		return runStackBackup(args[1:])
+	case "restore":
+		return runStackRestore(args[1:])
+	default:
+		return fmt.Errorf("unknown stack action %q (expected backup or restore)", args[0])
+	}
+}
+
+// stackDump is a database service dumped by a stack backup
+type stackDump struct {
+	db        compose.Database
+	container string
+	path      string
+	catalogID string
+}
+
+func runStackBackup(args []string) error {
+	fs := flag.NewFlagSet("stack backup", flag.ExitOnError)
+	file := fs.String("file", "docker-compose.yml", "Compose file of the stack")
+	fs.StringVar(file, "f", "docker-compose.yml", "Compose file of the stack (shorthand)")
+	outputDir := fs.String("output", "./backups", "Output directory; the stack's artifacts go in a subdirectory named after the project")
+	fs.StringVar(outputDir, "o", "./backups", "Output directory (shorthand)")
+	quiesce := fs.Bool("quiesce", false, "Pause the stack's other containers while its databases and volumes are taken")
+	var tags stringList
+	fs.Var(&tags, "tag", "Tag to attach to every artifact (repeatable)")
+	note := fs.String("note", "", "Free-form note to attach to every artifact")
+	var meta metaFlag
+	fs.Var(&meta, "run-meta", "Annotate every artifact with key=value, e.g. a CI run's git_sha or pipeline_url (repeatable)")
+	catalogPath := fs.String("catalog", catalog.DefaultPath, "Backup catalog file")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	project, err := compose.Load(*file)
+	if err != nil {
+		return err
+	}
+	dockerSvc, err := newDatabaseService("", false)
+	if err != nil {
+		return err
+	}
+	backupSvc := backup.NewService(dockerSvc)
+
+	var dumps []stackDump
+	for _, db := range project.Databases() {
+		container, err := project.Container(db.Service)
+		if err != nil {
+			return err
+		}
+		dumps = append(dumps, stackDump{db: db, container: container})
+	}
+	plan := backupPlan{volumes: project.DataVolumes()}
+	if len(dumps) == 0 && len(plan.volumes) == 0 {
+		return fmt.Errorf("project %s has no databases or named volumes to back up", project.Name)
+	}
+	fmt.Printf("Stack '%s': %d database(s), %d volume(s)\n", project.Name, len(dumps), len(plan.volumes))
+
+	if *quiesce {
+		for _, s := range project.AppServices() {
+			// Stopped services have nothing to pause
+			if container, err := project.Container(s); err == nil {
+				plan.quiesce = append(plan.quiesce, container)
+			}
+		}
+	}
+	resume := func() {}
+	if len(plan.quiesce) > 0 {
+		if resume, err = plan.pause(); err != nil {
+			return err
+		}
+	}
+
+	dir := filepath.Join(*outputDir, project.Name)
+	timestamp := backupSvc.Now()
+	started := time.Now()
+	err = dumpStack(backupSvc, dumps, dir, timestamp)
+	if err == nil {
+		if err = plan.take(dir, timestamp, tags, *note, meta); err != nil {
+			removeDumps(dumps)
+		}
+	}
+	resume()
+	if err != nil {
+		return fmt.Errorf("stack backup failed: %w", err)
+	}
+
+	cat := catalog.Open(*catalogPath)
+	group := clock.UUIDv7Generator{}.NewID()
+	for _, d := range dumps {
+		entry, err := recordBackup(cat, catalog.Entry{
+			Path:          d.path,
+			ContainerName: d.container,
+			DatabaseName:  d.db.Name,
+			CreatedAt:     timestamp,
+			Duration:      time.Since(started),
+			Tags:          tags,
+			Note:          *note,
+			Meta:          meta,
+			Group:         group,
+			Stack:         project.Name,
+			Service:       d.db.Service,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record backup in catalog: %w", err)
+		}
+		fmt.Printf("Catalog ID: %s (%s %s)\n", entry.ID, entry.Kind, d.path)
+	}
+	for i := range plan.artifacts {
+		plan.artifacts[i].Stack = project.Name
+	}
+	if err := plan.record(cat, group); err != nil {
+		return err
+	}
+	fmt.Printf("Stack backup completed successfully (group ID: %s)\n", group)
+	return nil
+}
+
+// dumpStack dumps each database service into its own directory under dir, so
+// services with the same database name don't collide. On failure the dumps
+// already written are removed.
+func dumpStack(backupSvc *backup.Service, dumps []stackDump, dir string, timestamp time.Time) error {
+	for i := range dumps {
+		d := &dumps[i]
+		fmt.Printf("Dumping database '%s' of service '%s'...\n", d.db.Name, d.db.Service)
+		started := time.Now()
+		path, err := backupSvc.Backup(backup.Config{
+			ContainerName: d.container,
+			DatabaseName:  d.db.Name,
+			DatabaseUser:  d.db.User,
+			OutputDir:     filepath.Join(dir, d.db.Service),
+			Timestamp:     timestamp,
+		})
+		if err != nil {
+			removeDumps(dumps[:i])
+			return fmt.Errorf("service %s: %w", d.db.Service, err)
+		}
+		d.path = path
+		if info, err := os.Stat(path); err == nil {
+			recordThroughput(throughput.OpBackup, d.container, dir, info.Size(), started)
+			recordUsage(usage.OpBackup, info.Size(), false)
+		}
+	}
+	return nil
+}
+
+func removeDumps(dumps []stackDump) {
+	for _, d := range dumps {
+		if d.path != "" {
+			backup.RemoveBackup(d.path)
+		}
+	}
+}
+
+func runStackRestore(args []string) error {
+	fs := flag.NewFlagSet("stack restore", flag.ExitOnError)
+	file := fs.String("file", "docker-compose.yml", "Compose file of the stack")
+	fs.StringVar(file, "f", "docker-compose.yml", "Compose file of the stack (shorthand)")
+	group := fs.String("group", "", "Restore the stack backup with this group ID (default: the newest)")
+	override := fs.Bool("i-know-what-im-doing", false, "Allow restoring into a protected container")
+	assumeYes := fs.Bool("yes", false, "Skip confirmation prompts")
+	fs.BoolVar(assumeYes, "y", false, "Skip confirmation prompts (shorthand)")
+	noUndo := fs.Bool("no-undo", false, "Don't take undo backups of the databases before replacing them")
+	undoDir := fs.String("undo-dir", "./backups/undo", "Directory for undo backups")
+	catalogPath := fs.String("catalog", catalog.DefaultPath, "Backup catalog file")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	project, err := compose.Load(*file)
+	if err != nil {
+		return err
+	}
+	cat := catalog.Open(*catalogPath)
+	if *group == "" {
+		latest, ok, err := cat.Latest(func(e catalog.Entry) bool { return e.Stack == project.Name && e.Group != "" })
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("no stack backups of project %s in the catalog", project.Name)
+		}
+		*group = latest.Group
+	}
+	members, err := cat.Find(catalog.Filter{Group: *group})
+	if err != nil {
+		return err
+	}
+
+	var dumps []stackDump
+	var volumes []catalog.Entry
+	var descriptions []string
+	for _, e := range members {
+		if e.Stack != project.Name {
+			return fmt.Errorf("group %s was taken from stack %q, not %q", *group, e.Stack, project.Name)
+		}
+		switch e.Kind {
+		case catalog.KindBackup:
+			container, err := project.Container(e.Service)
+			if err != nil {
+				return fmt.Errorf("%w; start it with `docker compose -f %s up -d %s` first", err, *file, e.Service)
+			}
+			if err := guardProtectedTarget(container, e.DatabaseName, protectedPatterns(nil), *override); err != nil {
+				return err
+			}
+			if err := verifyCatalogChecksum(e); err != nil {
+				return err
+			}
+			dumps = append(dumps, stackDump{db: compose.Database{Service: e.Service, Name: e.DatabaseName}, container: container, path: e.Path, catalogID: e.ID})
+			descriptions = append(descriptions, fmt.Sprintf("database '%s' of service '%s' will be replaced with %s", e.DatabaseName, e.Service, e.Path))
+		case catalog.KindVolume:
+			volumes = append(volumes, e)
+			descriptions = append(descriptions, fmt.Sprintf("every file in volume '%s' will be replaced with %s", e.Volume, e.Path))
+		}
+	}
+	if len(dumps) == 0 && len(volumes) == 0 {
+		return fmt.Errorf("group %s has nothing to restore", *group)
+	}
+	if err := confirmDestructive(*assumeYes, descriptions...); err != nil {
+		return err
+	}
+
+	// Stop the app so nothing writes to the volumes or databases mid-restore
+	var running []string
+	for _, s := range project.AppServices() {
+		if _, err := project.Container(s); err == nil {
+			running = append(running, s)
+		}
+	}
+	fmt.Printf("Stopping services of stack '%s'...\n", project.Name)
+	if err := project.Stop(running...); err != nil {
+		return err
+	}
+	defer func() {
+		fmt.Printf("Starting services of stack '%s'...\n", project.Name)
+		if err := project.Start(running...); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}()
+
+	dockerSvc, err := newDatabaseService("", false)
+	if err != nil {
+		return err
+	}
+	backupSvc := backup.NewService(dockerSvc)
+	for _, d := range dumps {
+		user := dumpUser(project, d.db.Service)
+		if !*noUndo {
+			if err := takeUndoPoint(backupSvc, cat, d.container, d.db.Name, user, *undoDir); err != nil {
+				return fmt.Errorf("failed to take undo backup (use --no-undo to skip): %w", err)
+			}
+		}
+		fmt.Printf("Restoring database '%s' of service '%s'...\n", d.db.Name, d.db.Service)
+		err := backupSvc.Restore(backup.RestoreConfig{
+			ContainerName: d.container,
+			DatabaseName:  d.db.Name,
+			DatabaseUser:  user,
+			BackupPath:    d.path,
+			DropExisting:  true,
+		})
+		recordAccess(audit.ActionRestore, d.path, d.catalogID, restoreTarget(d.container, d.db.Name), err)
+		if err != nil {
+			return fmt.Errorf("restore of service %s failed: %w", d.db.Service, err)
+		}
+	}
+	if err := restoreGroupVolumes(volumes, true); err != nil {
+		return err
+	}
+	fmt.Println("Stack restore completed successfully")
+	return nil
+}
+
+// dumpUser is the user a database service is restored as, following the
+// current compose file
+func dumpUser(project *compose.Project, service string) string {
+	for _, db := range project.Databases() {
+		if db.Service == service {
+			return db.User
+		}
+	}
+	return "postgres"
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/audit"
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/control"
+	"github.com/iostate/back-it-up/internal/schedule"
+)
+
+func runStandby(args []string) error {
+	fs := flag.NewFlagSet("standby", flag.ExitOnError)
+	containerName := fs.String("container", "", "Standby container name (required unless --host is set)")
+	fs.StringVar(containerName, "c", "", "Standby container name (shorthand)")
+	host := fs.String("host", "", hostFlagUsage)
+	noDockerSocket := fs.Bool("no-docker-socket", false, noDockerSocketUsage)
+	backupDir := fs.String("backups", "./backups", "Directory to watch for new backups")
+	fs.StringVar(backupDir, "b", "./backups", "Directory to watch for new backups (shorthand)")
+	dbName := fs.String("database", "postgres", "Database name")
+	fs.StringVar(dbName, "d", "postgres", "Database name (shorthand)")
+	dbUser := fs.String("user", "postgres", "Database user")
+	fs.StringVar(dbUser, "u", "postgres", "Database user (shorthand)")
+	interval := fs.Duration("interval", time.Minute, "How often to check for new backups")
+	once := fs.Bool("once", false, "Restore the newest backup if it is new, then exit, as a daemon job does")
+	metricsAddr := fs.String("metrics-addr", "", "Address to serve Prometheus metrics on (e.g. :9187)")
+	var protect stringList
+	fs.Var(&protect, "protect", "Container name pattern to protect from restores (repeatable)")
+	override := fs.Bool("i-know-what-im-doing", false, "Allow restoring into a protected container")
+	jobName := fs.String("job-name", "", "Name used to pause/resume this job (default \"standby-<container>\")")
+	controlDir := fs.String("control-dir", control.DefaultDir, "Directory holding job pause markers")
+	var blackoutSpecs stringList
+	fs.Var(&blackoutSpecs, "blackout", "Blackout window as \"<cron> <duration>\" (repeatable)")
+	assumeYes := fs.Bool("yes", false, "Skip confirmation prompts")
+	fs.BoolVar(assumeYes, "y", false, "Skip confirmation prompts (shorthand)")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *containerName == "" && *host == "" {
+		fmt.Fprintln(os.Stderr, "Error: --container or --host flag is required")
+		fs.Usage()
+		return fmt.Errorf("missing required flag: --container")
+	}
+	if *containerName == "" {
+		*containerName = *host
+	}
+
+	blackouts, err := schedule.ParseBlackouts(blackoutSpecs)
+	if err != nil {
+		return err
+	}
+
+	if err := guardProtectedTarget(*containerName, *dbName, protectedPatterns(protect), *override); err != nil {
+		return err
+	}
+
+	if err := confirmDestructive(*assumeYes,
+		fmt.Sprintf("database '%s' in container '%s' will be dropped and replaced on every new backup", *dbName, *containerName),
+	); err != nil {
+		return err
+	}
+
+	// Initialize services
+	dockerSvc, err := newDatabaseService(*host, *noDockerSocket)
+	if err != nil {
+		return err
+	}
+	backupSvc := backup.NewService(dockerSvc)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	status := &backup.StandbyStatus{}
+	if *metricsAddr != "" {
+		stopMetrics := startMetricsServer(*metricsAddr, standbyMetricsHandler(*containerName, *dbName, status))
+		defer stopMetrics()
+	}
+
+	if *jobName == "" {
+		*jobName = "standby-" + *containerName
+	}
+	ctl := control.Open(*controlDir)
+
+	if *once {
+		fmt.Printf("Syncing container '%s' with backups in %s (job '%s')...\n", *containerName, *backupDir, *jobName)
+	} else {
+		fmt.Printf("Keeping container '%s' in sync with backups in %s (every %s, job '%s')...\n", *containerName, *backupDir, *interval, *jobName)
+	}
+	return backupSvc.Standby(ctx, backup.StandbyConfig{
+		ContainerName: *containerName,
+		DatabaseName:  *dbName,
+		DatabaseUser:  *dbUser,
+		BackupDir:     *backupDir,
+		Interval:      *interval,
+		Paused:        func() bool { return ctl.Paused(*jobName) },
+		Blackouts:     blackouts,
+		OnRestore: func(path string, err error) {
+			recordAccess(audit.ActionRestore, path, "", restoreTarget(*containerName, *dbName), err)
+		},
+		StatePath: filepath.Join(*controlDir, *jobName+".standby.json"),
+		Once:      *once,
+	}, status)
+}
+
+// standbyMetricsHandler exposes standby staleness in the Prometheus text format
+func standbyMetricsHandler(containerName, dbName string, status *backup.StandbyStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snap := status.Snapshot()
+		labels := fmt.Sprintf(`container=%q,database=%q`, containerName, dbName)
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if staleness, ok := status.Staleness(time.Now()); ok {
+			fmt.Fprintln(w, "# HELP backitup_standby_staleness_seconds Age of the backup currently restored on the standby.")
+			fmt.Fprintln(w, "# TYPE backitup_standby_staleness_seconds gauge")
+			fmt.Fprintf(w, "backitup_standby_staleness_seconds{%s} %.0f\n", labels, staleness.Seconds())
+			fmt.Fprintln(w, "# HELP backitup_standby_last_restore_timestamp_seconds Unix time of the last successful standby restore.")
+			fmt.Fprintln(w, "# TYPE backitup_standby_last_restore_timestamp_seconds gauge")
+			fmt.Fprintf(w, "backitup_standby_last_restore_timestamp_seconds{%s} %d\n", labels, snap.RestoredAt.Unix())
+		}
+		fmt.Fprintln(w, "# HELP backitup_standby_restores_total Successful standby restores.")
+		fmt.Fprintln(w, "# TYPE backitup_standby_restores_total counter")
+		fmt.Fprintf(w, "backitup_standby_restores_total{%s} %d\n", labels, snap.Restores)
+		fmt.Fprintln(w, "# HELP backitup_standby_failures_total Failed standby sync attempts.")
+		fmt.Fprintln(w, "# TYPE backitup_standby_failures_total counter")
+		fmt.Fprintf(w, "backitup_standby_failures_total{%s} %d\n", labels, snap.Failures)
+		blackout := 0
+		if snap.InBlackout {
+			blackout = 1
+		}
+		fmt.Fprintln(w, "# HELP backitup_standby_in_blackout Whether standby syncs are suspended by a blackout window.")
+		fmt.Fprintln(w, "# TYPE backitup_standby_in_blackout gauge")
+		fmt.Fprintf(w, "backitup_standby_in_blackout{%s} %d\n", labels, blackout)
+		fmt.Fprintln(w, "# HELP backitup_standby_blackout_skips_total Standby syncs skipped by blackout windows.")
+		fmt.Fprintln(w, "# TYPE backitup_standby_blackout_skips_total counter")
+		fmt.Fprintf(w, "backitup_standby_blackout_skips_total{%s} %d\n", labels, snap.Skipped)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/oci"
+	"github.com/iostate/back-it-up/internal/throughput"
+)
+
+// throughputEnvVar overrides where throughput observations are kept
+const throughputEnvVar = "BACKITUP_THROUGHPUT"
+
+// throughputPath returns the throughput history every command updates
+func throughputPath() string {
+	if p := os.Getenv(throughputEnvVar); p != "" {
+		return p
+	}
+	return throughput.DefaultPath
+}
+
+// recordThroughput stores how long moving size bytes took since started. A
+// failure to record is reported but doesn't fail the command.
+func recordThroughput(op, source, destination string, size int64, started time.Time) {
+	err := throughput.Open(throughputPath()).Record(throughput.Observation{
+		Op:          op,
+		Source:      source,
+		Destination: destination,
+		Bytes:       size,
+		Duration:    time.Since(started),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record throughput: %v\n", err)
+	}
+}
+
+// printEstimate prints how long op should take for size bytes, if this
+// route has been seen before
+func printEstimate(op, source, destination string, size int64) {
+	rate, ok, err := throughput.Open(throughputPath()).Rate(op, source, destination)
+	if err != nil || !ok || size <= 0 {
+		return
+	}
+	fmt.Printf("Estimated %s time: ~%s (%s at %s, from %d earlier run(s))\n",
+		op, formatEstimate(rate.Estimate(size)), formatBytes(size), formatRate(rate.BytesPerSecond), rate.Samples)
+}
+
+// printThroughput lists the throughput seen on routes to and from target and
+// this machine
+func printThroughput(target string) {
+	fmt.Println("\nObserved throughput:")
+	rates, err := throughput.Open(throughputPath()).Rates()
+	if err != nil {
+		fmt.Printf("  %v\n", err)
+		return
+	}
+	here, shown := localHost(), 0
+	for _, r := range rates {
+		if r.Source != target && r.Destination != target && r.Source != here && r.Destination != here {
+			continue
+		}
+		fmt.Printf("  %-9s%s → %s: %s (%d run(s), last %s ago)\n",
+			r.Op, r.Source, r.Destination, formatRate(r.BytesPerSecond), r.Samples, formatAge(time.Since(r.Last)))
+		shown++
+	}
+	if shown == 0 {
+		fmt.Println("  None recorded yet; estimates appear after the first backups and restores")
+	}
+}
+
+// remoteHost names the endpoint of a URL or registry reference for throughput routes
+func remoteHost(location string) string {
+	if u, err := url.Parse(location); err == nil && u.Host != "" {
+		return u.Scheme + "://" + u.Host
+	}
+	return location
+}
+
+// registryHost names the registry of ref for throughput routes
+func registryHost(ref oci.Reference) string {
+	return oci.Scheme + ref.Registry
+}
+
+// localHost names this machine as the end of a transfer
+func localHost() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "localhost"
+	}
+	return h
+}
+
+// formatEstimate renders an expected duration, to the second when it's short
+func formatEstimate(d time.Duration) string {
+	if d < time.Minute {
+		return max(d.Round(time.Second), time.Second).String()
+	}
+	return formatAge(d)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func formatRate(bytesPerSecond float64) string {
+	return formatBytes(int64(bytesPerSecond)) + "/s"
+}
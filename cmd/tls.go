@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader serves a certificate and client CA bundle from disk and picks
+// up rotated files on the next handshake, so certificates issued by
+// cert-manager or a short-lived CA can be renewed without a restart
+type certReloader struct {
+	certFile, keyFile, caFile string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	loadedAt map[string]time.Time
+}
+
+func newCertReloader(certFile, keyFile, caFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// changed reports whether any file was modified since it was last loaded
+func (r *certReloader) changed() bool {
+	for _, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		if f == "" {
+			continue
+		}
+		info, err := os.Stat(f)
+		if err != nil || !info.ModTime().Equal(r.loadedAt[f]) {
+			return true
+		}
+	}
+	return false
+}
+
+// reload reads every file; on error the previous certificate stays in use
+func (r *certReloader) reload() error {
+	loadedAt := map[string]time.Time{}
+	for _, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		if f == "" {
+			continue
+		}
+		info, err := os.Stat(f)
+		if err != nil {
+			return fmt.Errorf("failed to read TLS file: %w", err)
+		}
+		loadedAt[f] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA bundle: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA bundle %s", r.caFile)
+		}
+	}
+
+	r.cert, r.pool, r.loadedAt = &cert, pool, loadedAt
+	return nil
+}
+
+// config returns the TLS settings for the next handshake, reloading rotated files first
+func (r *certReloader) config(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.changed() {
+		if err := r.reload(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: keeping previous TLS certificate: %v\n", err)
+		} else {
+			fmt.Println("Reloaded rotated TLS certificates")
+		}
+	}
+
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*r.cert},
+	}
+	if r.pool != nil {
+		cfg.ClientCAs = r.pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// tlsConfig returns a server config that defers to the reloader on every handshake
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{MinVersion: tls.VersionTLS12, GetConfigForClient: r.config}
+}
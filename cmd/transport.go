@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/docker"
+	"github.com/iostate/back-it-up/internal/local"
+)
+
+// hostFlagUsage documents the --host flag shared by commands that can run without docker
+const hostFlagUsage = "Connect to host[:port] or a socket directory with local client tools instead of docker exec"
+
+// noDockerSocketUsage documents the --no-docker-socket flag
+const noDockerSocketUsage = "Refuse to use docker; only connect with --host (default $" + noDockerSocketEnvVar + ")"
+
+// noDockerSocketEnvVar disables docker access for every command when set to a true value
+const noDockerSocketEnvVar = "BACKITUP_NO_DOCKER_SOCKET"
+
+// clientImageEnvVar names an image, e.g. postgres:16, to run the client tools
+// in when --host is set but they aren't installed locally
+const clientImageEnvVar = "BACKITUP_CLIENT_IMAGE"
+
+// Environment variables attaching the $BACKITUP_CLIENT_IMAGE helper to a
+// docker network rather than the host's
+const (
+	helperNetworkEnvVar = "BACKITUP_HELPER_NETWORK"
+	// helperAliasEnvVar is a comma-separated list
+	helperAliasEnvVar = "BACKITUP_HELPER_NETWORK_ALIAS"
+	helperIPEnvVar    = "BACKITUP_HELPER_IP"
+	helperIPv6EnvVar  = "BACKITUP_HELPER_IPV6"
+)
+
+// dockerSocketDisabled reports whether docker access is disabled by the flag or the environment
+func dockerSocketDisabled(flagValue bool) bool {
+	if flagValue {
+		return true
+	}
+	disabled, _ := strconv.ParseBool(os.Getenv(noDockerSocketEnvVar))
+	return disabled
+}
+
+// newDatabaseService returns the transport commands run through: docker exec
+// by default, or the local PostgreSQL client tools when host is set. Without
+// the tools, $BACKITUP_CLIENT_IMAGE runs them in a helper container instead.
+// Docker is refused when noDockerSocket or the environment disables it.
+func newDatabaseService(host string, noDockerSocket bool) (backup.DockerService, error) {
+	if host != "" {
+		image := os.Getenv(clientImageEnvVar)
+		if image == "" {
+			if missing := local.MissingTools(); len(missing) > 0 {
+				return nil, fmt.Errorf("--host needs the PostgreSQL client tools, but %s not on PATH; run `back-it-up doctor --install-hints` for install commands, or set $%s (e.g. postgres:16) to run them in a helper container",
+					missingPhrase(missing), clientImageEnvVar)
+			}
+			return local.NewService(host), nil
+		}
+		if dockerSocketDisabled(noDockerSocket) {
+			return nil, fmt.Errorf("$%s runs the client tools with docker, which is disabled (--no-docker-socket or $%s)", clientImageEnvVar, noDockerSocketEnvVar)
+		}
+		network, err := helperNetwork()
+		if err != nil {
+			return nil, err
+		}
+		return local.NewHelperService(host, image, network), nil
+	}
+	if dockerSocketDisabled(noDockerSocket) {
+		return nil, fmt.Errorf("docker access is disabled (--no-docker-socket or $%s); pass --host to connect over TCP or a Unix socket", noDockerSocketEnvVar)
+	}
+	return docker.NewService(), nil
+}
+
+// helperNetwork returns the network the client helper joins, from the
+// environment
+func helperNetwork() (local.HelperNetwork, error) {
+	n := local.HelperNetwork{
+		Name: os.Getenv(helperNetworkEnvVar),
+		IPv4: os.Getenv(helperIPEnvVar),
+		IPv6: os.Getenv(helperIPv6EnvVar),
+	}
+	for _, alias := range strings.Split(os.Getenv(helperAliasEnvVar), ",") {
+		if alias = strings.TrimSpace(alias); alias != "" {
+			n.Aliases = append(n.Aliases, alias)
+		}
+	}
+	if n.Name == "" || n.Name == "host" {
+		if len(n.Aliases) > 0 || n.IPv4 != "" || n.IPv6 != "" {
+			return local.HelperNetwork{}, fmt.Errorf("$%s, $%s, and $%s need $%s set to a user-defined network", helperAliasEnvVar, helperIPEnvVar, helperIPv6EnvVar, helperNetworkEnvVar)
+		}
+		return local.HelperNetwork{}, nil
+	}
+	if n.IPv4 != "" {
+		if ip, err := netip.ParseAddr(n.IPv4); err != nil || !ip.Is4() {
+			return local.HelperNetwork{}, fmt.Errorf("invalid $%s %q: expected an IPv4 address", helperIPEnvVar, n.IPv4)
+		}
+	}
+	if n.IPv6 != "" {
+		if ip, err := netip.ParseAddr(n.IPv6); err != nil || !ip.Is6() || ip.Is4In6() {
+			return local.HelperNetwork{}, fmt.Errorf("invalid $%s %q: expected an IPv6 address", helperIPv6EnvVar, n.IPv6)
+		}
+	}
+	return n, nil
+}
+
+// withContext returns svc with its commands killed once ctx is done
+func withContext(svc backup.DockerService, ctx context.Context) backup.DockerService {
+	switch s := svc.(type) {
+	case *docker.Service:
+		return s.WithContext(ctx)
+	case *local.Service:
+		return s.WithContext(ctx)
+	}
+	return svc
+}
+
+// missingPhrase lists missing tools for an error message, e.g. "pg_dump and
+// psql are"
+func missingPhrase(tools []string) string {
+	switch len(tools) {
+	case 1:
+		return tools[0] + " is"
+	default:
+		return strings.Join(tools[:len(tools)-1], ", ") + " and " + tools[len(tools)-1] + " are"
+	}
+}
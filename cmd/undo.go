@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/catalog"
+)
+
+// takeUndoPoint backs up the current target database and records it in the
+// catalog so a bad restore can be rolled back with --undo-last
+func takeUndoPoint(backupSvc *backup.Service, cat *catalog.Catalog, containerName, dbName, dbUser, undoDir string) error {
+	exists, err := backupSvc.DatabaseExists(containerName, dbName, dbUser)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		fmt.Printf("Database '%s' does not exist yet, no undo point needed\n", dbName)
+		return nil
+	}
+
+	fmt.Printf("Taking undo backup of '%s'...\n", dbName)
+	now := backupSvc.Now()
+	path, err := backupSvc.Backup(backup.Config{
+		ContainerName: containerName,
+		DatabaseName:  dbName,
+		DatabaseUser:  dbUser,
+		OutputDir:     undoDir,
+		Timestamp:     now,
+	})
+	if err != nil {
+		return err
+	}
+
+	entry, err := recordBackup(cat, catalog.Entry{
+		Kind:          catalog.KindUndo,
+		Path:          path,
+		ContainerName: containerName,
+		DatabaseName:  dbName,
+		CreatedAt:     now,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Undo point %s saved to %s\n", entry.ID, path)
+	return nil
+}
+
+// latestUndoPoint finds the most recent undo point for a container's database
+func latestUndoPoint(cat *catalog.Catalog, containerName, dbName string) (catalog.Entry, error) {
+	point, ok, err := cat.Latest(func(e catalog.Entry) bool {
+		return e.Kind == catalog.KindUndo && e.ContainerName == containerName && e.DatabaseName == dbName
+	})
+	if err != nil {
+		return catalog.Entry{}, err
+	}
+	if !ok {
+		return catalog.Entry{}, fmt.Errorf("no undo point found for database '%s' in container '%s'", dbName, containerName)
+	}
+	return point, nil
+}
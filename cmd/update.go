@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/update"
+)
+
+// version and releaseKey are set by release builds with
+// -ldflags "-X main.version=... -X main.releaseKey=..."
+var (
+	version = "dev"
+	// releaseKey is the base64 Ed25519 public key release binaries are signed with
+	releaseKey = ""
+)
+
+func runVersion(args []string) error {
+	fmt.Printf("back-it-up %s (%s)\n", version, update.Platform())
+	return nil
+}
+
+func runSelfUpdate(args []string) error {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	metadataURL := fs.String("url", update.DefaultMetadataURL, "Release metadata to update from")
+	keyFile := fs.String("public-key", "", "Ed25519 public key (PEM or base64) to verify the binary with (default: the key built into this binary)")
+	check := fs.Bool("check", false, "Only report whether an update is available")
+	force := fs.Bool("force", false, "Install the release even if it isn't newer, or over a development build")
+	tlsOpts := addTLSFlags(fs)
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := tlsOpts.apply(); err != nil {
+		return err
+	}
+
+	keyText := releaseKey
+	if *keyFile != "" {
+		data, err := os.ReadFile(*keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read public key: %w", err)
+		}
+		keyText = string(data)
+	}
+	if keyText == "" && !*check {
+		return fmt.Errorf("this build has no release key to verify updates with; pass --public-key")
+	}
+
+	release, err := update.FetchRelease(*metadataURL)
+	if err != nil {
+		return err
+	}
+	// The version is only trusted once its signature checks out
+	var bin update.Binary
+	if keyText != "" {
+		key, err := update.ParsePublicKey(keyText)
+		if err != nil {
+			return err
+		}
+		if bin, err = release.Verify(update.Platform(), key); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Current version: %s\n", version)
+	if keyText == "" {
+		fmt.Printf("Latest version:  %s (unverified: no release key)\n", release.Version)
+	} else {
+		fmt.Printf("Latest version:  %s (signature verified)\n", release.Version)
+	}
+
+	switch {
+	case *force:
+	case version == "dev":
+		fmt.Println("This is a development build; pass --force to replace it with the release")
+		return nil
+	case !update.Newer(release.Version, version):
+		fmt.Println("✓ Already up to date")
+		return nil
+	}
+	if *check {
+		fmt.Println("Update available: run back-it-up self-update to install it")
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the running binary: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return fmt.Errorf("failed to locate the running binary: %w", err)
+	}
+
+	fmt.Printf("Downloading %s...\n", bin.URL)
+	path, _, err := backup.Download(backup.DownloadConfig{URL: bin.URL, SHA256: bin.SHA256})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	fmt.Println("✓ Download matches the signed checksum")
+
+	if err := update.Replace(exe, path); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Updated %s to %s\n", exe, release.Version)
+	return nil
+}
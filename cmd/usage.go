@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/throughput"
+	"github.com/iostate/back-it-up/internal/usage"
+)
+
+// usageEnvVar turns on usage statistics, naming the file they're kept in.
+// Nothing is recorded unless it is set, and nothing leaves the machine.
+const usageEnvVar = "BACKITUP_USAGE_STATS"
+
+// recordUsage adds a completed run to the usage statistics, if they're on.
+// A failure to record is reported but doesn't fail the command.
+func recordUsage(op string, size int64, duplicate bool) {
+	path := os.Getenv(usageEnvVar)
+	if path == "" {
+		return
+	}
+	if err := usage.Open(path).Record(usage.Event{Op: op, Bytes: size, Duplicate: duplicate}); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record usage statistics: %v\n", err)
+	}
+}
+
+func runReport(args []string) error {
+	if len(args) > 0 && args[0] == "rpo" {
+		return runReportRPO(args[1:])
+	}
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	showUsage := fs.Bool("usage", false, "Summarize the local usage statistics")
+	file := fs.String("file", "", "Usage statistics file to read (default: $"+usageEnvVar+")")
+	asJSON := fs.Bool("json", false, "Print the statistics as JSON")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if !*showUsage {
+		fmt.Fprintln(os.Stderr, "Error: --usage is required")
+		fs.Usage()
+		return fmt.Errorf("missing report type")
+	}
+
+	path := *file
+	if path == "" {
+		path = os.Getenv(usageEnvVar)
+	}
+	if path == "" {
+		fmt.Printf("Usage statistics are off. Set %s to a file to start collecting them, e.g.\n", usageEnvVar)
+		fmt.Printf("  export %s=./backups/usage.json\n", usageEnvVar)
+		return nil
+	}
+
+	stats, err := usage.Open(path).Load()
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		data, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode usage statistics: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	if len(stats.Ops) == 0 {
+		fmt.Printf("No runs recorded in %s yet\n", path)
+		return nil
+	}
+
+	fmt.Printf("Usage since %s (last run %s ago):\n", stats.Since.Local().Format("2006-01-02"), formatAge(time.Since(stats.Last)))
+	for _, name := range stats.OpNames() {
+		op := stats.Ops[name]
+		fmt.Printf("  %-9s%d run(s), %s\n", name, op.Runs, formatBytes(op.Bytes))
+	}
+
+	fmt.Println("\nDeduplication:")
+	if stats.DedupHits == 0 {
+		fmt.Println("  No backups matched a stored copy yet (see --name-by-hash)")
+		return nil
+	}
+	fmt.Printf("  %d backup(s) matched a stored copy; %s not stored again\n", stats.DedupHits, formatBytes(stats.DedupBytes))
+	if rate := uploadRate(); rate > 0 {
+		saved := throughput.Rate{BytesPerSecond: rate}.Estimate(stats.DedupBytes)
+		fmt.Printf("  Time saved: ~%s not spent shipping them, at the observed upload rate of %s\n", formatEstimate(saved), formatRate(rate))
+	} else {
+		fmt.Println("  Time saved: not estimated until an upload's throughput has been recorded")
+	}
+	return nil
+}
+
+// uploadRate averages the upload throughput seen on every route, weighted
+// by how many runs each has
+func uploadRate() float64 {
+	rates, err := throughput.Open(throughputPath()).Rates()
+	if err != nil {
+		return 0
+	}
+	var total float64
+	var samples int
+	for _, r := range rates {
+		if r.Op == throughput.OpUpload {
+			total += r.BytesPerSecond * float64(r.Samples)
+			samples += r.Samples
+		}
+	}
+	if samples == 0 {
+		return 0
+	}
+	return total / float64(samples)
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/alert"
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/catalog"
+	"github.com/iostate/back-it-up/internal/control"
+	"github.com/iostate/back-it-up/internal/schedule"
+)
+
+// runVerifyAll compares every database in both containers and prints a pass/fail matrix
+func runVerifyAll(backupSvc *backup.Service, cfg backup.VerifyAllConfig) error {
+	fmt.Printf("Verifying all databases between '%s' and '%s'...\n", cfg.SourceContainer, cfg.TargetContainer)
+	results, err := backupSvc.VerifyAll(cfg)
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATABASE\tSOURCE\tTARGET\tRESULT")
+	for _, r := range results {
+		result := "skipped"
+		switch {
+		case !r.Compared():
+		case r.Err != nil:
+			result = "error: " + r.Err.Error()
+			failed++
+		case r.Match:
+			result = "✓ match"
+		default:
+			result = "✗ mismatch"
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.DatabaseName, presence(r.InSource), presence(r.InTarget), result)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d database(s) failed verification", failed)
+	}
+	fmt.Println("✓ All shared databases match")
+	return nil
+}
+
+func presence(ok bool) string {
+	if ok {
+		return "yes"
+	}
+	return "no"
+}
+
+// printTableMismatches lists the tables that differ between source and target
+func printTableMismatches(tables []backup.TableMismatch) {
+	if len(tables) == 0 {
+		return
+	}
+
+	// Differing rows are only known when rows were diffed
+	diffed := slices.ContainsFunc(tables, func(t backup.TableMismatch) bool { return t.DifferingRows > 0 })
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if diffed {
+		fmt.Fprintln(w, "  TABLE\tSOURCE ROWS\tTARGET ROWS\tDIFFERING ROWS\tNOTE")
+	} else {
+		fmt.Fprintln(w, "  TABLE\tSOURCE ROWS\tTARGET ROWS\tNOTE")
+	}
+	for _, t := range tables {
+		note := ""
+		if t.Missing != "" {
+			note = "missing in " + t.Missing
+		}
+		if diffed {
+			fmt.Fprintf(w, "  %s\t%d\t%d\t%d\t%s\n", t.Table, t.SourceRows, t.TargetRows, t.DifferingRows, note)
+		} else {
+			fmt.Fprintf(w, "  %s\t%d\t%d\t%s\n", t.Table, t.SourceRows, t.TargetRows, note)
+		}
+	}
+	w.Flush()
+}
+
+// verifyDiff is the machine-readable outcome written by --diff-file
+type verifyDiff struct {
+	Source        string    `json:"source"`
+	Target        string    `json:"target"`
+	Database      string    `json:"database"`
+	Mode          string    `json:"mode"`
+	CheckedAt     time.Time `json:"checked_at"`
+	FailThreshold int64     `json:"fail_threshold"`
+	IgnoredTables []string  `json:"ignored_tables,omitempty"`
+	*backup.VerifyResult
+}
+
+// writeVerifyDiff writes a verification result to path as JSON, replacing
+// the file atomically so readers never see a partial diff
+func writeVerifyDiff(path string, cfg backup.VerifyConfig, result *backup.VerifyResult) error {
+	data, err := json.MarshalIndent(verifyDiff{
+		Source:        cfg.SourceContainer,
+		Target:        cfg.TargetContainer,
+		Database:      cfg.DatabaseName,
+		Mode:          cfg.Mode,
+		CheckedAt:     time.Now().UTC(),
+		FailThreshold: cfg.FailThreshold,
+		IgnoredTables: cfg.IgnoreTables,
+		VerifyResult:  result,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode diff: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write diff file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write diff file: %w", err)
+	}
+	return nil
+}
+
+// verifyWatchStatus tracks the outcome of repeated verifications
+type verifyWatchStatus struct {
+	mu            sync.Mutex
+	lastRun       time.Time
+	lastMatch     bool
+	lastErr       error
+	divergentRuns int
+	consecutive   int
+	mismatched    int
+	blackout      bool
+	skipped       int
+}
+
+func (st *verifyWatchStatus) setBlackout(active bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.blackout = active
+	if active {
+		st.skipped++
+	}
+}
+
+func (st *verifyWatchStatus) record(result *backup.VerifyResult, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.lastRun = time.Now()
+	st.lastErr = err
+	if err != nil {
+		return
+	}
+
+	st.lastMatch = result.Match
+	st.mismatched = len(result.Tables)
+	if result.Match {
+		st.consecutive = 0
+	} else {
+		st.divergentRuns++
+		st.consecutive++
+	}
+}
+
+// verifyWatchOptions controls the continuous verification loop
+type verifyWatchOptions struct {
+	interval    time.Duration
+	metricsAddr string
+	jobName     string
+	control     *control.Dir
+	blackouts   schedule.Blackouts
+	catalog     *catalog.Catalog
+	diffFile    string
+	alerts      *alert.Tracker
+	// escalateCommand is run when alerts escalates a failure
+	escalateCommand string
+}
+
+// runVerifyWatch verifies on an interval until interrupted, alerting on divergence
+func runVerifyWatch(backupSvc *backup.Service, cfg backup.VerifyConfig, opts verifyWatchOptions) error {
+	if opts.interval <= 0 {
+		return fmt.Errorf("verify interval must be positive")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	status := &verifyWatchStatus{}
+	if opts.metricsAddr != "" {
+		stopMetrics := startMetricsServer(opts.metricsAddr, verifyMetricsHandler(cfg, status))
+		defer stopMetrics()
+	}
+
+	fmt.Printf("Verifying '%s' against '%s' every %s (%s mode, job '%s')...\n", cfg.SourceContainer, cfg.TargetContainer, opts.interval, cfg.Mode, opts.jobName)
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+
+	wasPaused := false
+	lastRecorded := ""
+	for {
+		paused := opts.control.Paused(opts.jobName)
+		if paused != wasPaused {
+			if paused {
+				fmt.Println("Verification paused, skipping runs until resumed")
+			} else {
+				fmt.Println("Verification resumed")
+			}
+			wasPaused = paused
+		}
+
+		window, until, inBlackout := opts.blackouts.ActiveAt(time.Now())
+		status.setBlackout(inBlackout && !paused)
+		if inBlackout && !paused {
+			fmt.Printf("Blackout window %q active until %s, skipping verification\n", window.String(), until.Format(time.RFC3339))
+		}
+
+		if paused || inBlackout {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				continue
+			}
+		}
+
+		result, err := backupSvc.VerifyReport(cfg)
+		status.record(result, err)
+		// Only changes are recorded, so the catalog doesn't grow every interval
+		if s := verificationStatus(result, err); s != lastRecorded {
+			recordVerification(opts.catalog, cfg, result, err)
+			lastRecorded = s
+		}
+
+		if err == nil && opts.diffFile != "" {
+			if err := writeVerifyDiff(opts.diffFile, cfg, result); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+
+		now := time.Now().Format(time.RFC3339)
+		switch {
+		case err != nil:
+			opts.alert(now, fmt.Sprintf("verification error: %v", err), func() {})
+		case !result.Match:
+			opts.alert(now, fmt.Sprintf("ALERT: '%s' has diverged from '%s'", cfg.TargetContainer, cfg.SourceContainer), func() {
+				printTableMismatches(result.Tables)
+			})
+		default:
+			if failures := opts.alerts.Success(opts.jobName); failures > 0 {
+				fmt.Printf("%s recovered after %d failed run(s)\n", now, failures)
+			}
+			if len(result.Tables) > 0 {
+				fmt.Printf("%s ✓ databases differ by %d row(s), within the fail threshold\n", now, result.DifferingRows)
+			} else {
+				fmt.Printf("%s ✓ databases match\n", now)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// alert reports a failed run on stderr, with details, unless it repeats one
+// reported within the cool-down, and escalates it once the job has failed
+// often enough in a row
+func (opts verifyWatchOptions) alert(now, message string, details func()) {
+	d := opts.alerts.Failure(opts.jobName, message)
+	if d.Notify {
+		if d.Suppressed > 0 {
+			fmt.Fprintf(os.Stderr, "%s %s (%d identical alert(s) suppressed)\n", now, message, d.Suppressed)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s %s\n", now, message)
+		}
+		details()
+	}
+	if d.Escalate {
+		fmt.Fprintf(os.Stderr, "%s escalating: %d failed run(s) in a row\n", now, d.Consecutive)
+		a := alert.Alert{Job: opts.jobName, Message: message, Consecutive: d.Consecutive}
+		if err := alert.Exec(opts.escalateCommand, a); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+}
+
+// verifyMetricsHandler exposes continuous verification state in the Prometheus text format
+func verifyMetricsHandler(cfg backup.VerifyConfig, status *verifyWatchStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status.mu.Lock()
+		defer status.mu.Unlock()
+
+		labels := fmt.Sprintf(`source=%q,target=%q,database=%q`, cfg.SourceContainer, cfg.TargetContainer, cfg.DatabaseName)
+		divergent := 0
+		if !status.lastRun.IsZero() && status.lastErr == nil && !status.lastMatch {
+			divergent = 1
+		}
+		failing := 0
+		if status.lastErr != nil {
+			failing = 1
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintln(w, "# HELP backitup_verify_divergent Whether the last verification found the databases diverged.")
+		fmt.Fprintln(w, "# TYPE backitup_verify_divergent gauge")
+		fmt.Fprintf(w, "backitup_verify_divergent{%s} %d\n", labels, divergent)
+		fmt.Fprintln(w, "# HELP backitup_verify_error Whether the last verification failed to run.")
+		fmt.Fprintln(w, "# TYPE backitup_verify_error gauge")
+		fmt.Fprintf(w, "backitup_verify_error{%s} %d\n", labels, failing)
+		fmt.Fprintln(w, "# HELP backitup_verify_mismatched_tables Tables that differed in the last verification.")
+		fmt.Fprintln(w, "# TYPE backitup_verify_mismatched_tables gauge")
+		fmt.Fprintf(w, "backitup_verify_mismatched_tables{%s} %d\n", labels, status.mismatched)
+		fmt.Fprintln(w, "# HELP backitup_verify_consecutive_divergent_runs Consecutive verifications that found divergence.")
+		fmt.Fprintln(w, "# TYPE backitup_verify_consecutive_divergent_runs gauge")
+		fmt.Fprintf(w, "backitup_verify_consecutive_divergent_runs{%s} %d\n", labels, status.consecutive)
+		fmt.Fprintln(w, "# HELP backitup_verify_divergent_runs_total Verifications that found divergence.")
+		fmt.Fprintln(w, "# TYPE backitup_verify_divergent_runs_total counter")
+		fmt.Fprintf(w, "backitup_verify_divergent_runs_total{%s} %d\n", labels, status.divergentRuns)
+		blackout := 0
+		if status.blackout {
+			blackout = 1
+		}
+		fmt.Fprintln(w, "# HELP backitup_verify_in_blackout Whether verification is suspended by a blackout window.")
+		fmt.Fprintln(w, "# TYPE backitup_verify_in_blackout gauge")
+		fmt.Fprintf(w, "backitup_verify_in_blackout{%s} %d\n", labels, blackout)
+		fmt.Fprintln(w, "# HELP backitup_verify_blackout_skips_total Verification runs skipped by blackout windows.")
+		fmt.Fprintln(w, "# TYPE backitup_verify_blackout_skips_total counter")
+		fmt.Fprintf(w, "backitup_verify_blackout_skips_total{%s} %d\n", labels, status.skipped)
+		if !status.lastRun.IsZero() {
+			fmt.Fprintln(w, "# HELP backitup_verify_last_run_timestamp_seconds Unix time of the last verification.")
+			fmt.Fprintln(w, "# TYPE backitup_verify_last_run_timestamp_seconds gauge")
+			fmt.Fprintf(w, "backitup_verify_last_run_timestamp_seconds{%s} %d\n", labels, status.lastRun.Unix())
+		}
+	}
+}
+
+// verificationStatus maps a verification outcome to a catalog status
+func verificationStatus(result *backup.VerifyResult, err error) string {
+	switch {
+	case err != nil:
+		return catalog.StatusError
+	case result.Match:
+		return catalog.StatusMatch
+	default:
+		return catalog.StatusDivergent
+	}
+}
+
+// recordVerification adds a verification outcome to the catalog. Failing to
+// record it only warns, since the verification itself has already run.
+func recordVerification(cat *catalog.Catalog, cfg backup.VerifyConfig, result *backup.VerifyResult, verifyErr error) {
+	status := verificationStatus(result, verifyErr)
+	note := fmt.Sprintf("%s vs %s (%s)", status, cfg.SourceContainer, cfg.Mode)
+	if verifyErr != nil {
+		note += ": " + verifyErr.Error()
+	}
+	if _, err := cat.Add(catalog.Entry{
+		Kind:          catalog.KindVerify,
+		ContainerName: cfg.TargetContainer,
+		DatabaseName:  cfg.DatabaseName,
+		Status:        status,
+		Note:          note,
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record verification in catalog: %v\n", err)
+	}
+}
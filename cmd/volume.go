@@ -0,0 +1,180 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/audit"
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/catalog"
+	"github.com/iostate/back-it-up/internal/throughput"
+	"github.com/iostate/back-it-up/internal/usage"
+)
+
+func runVolume(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: volume <backup|restore> [flags]")
+	}
+
+	switch args[0] {
+	case "backup":
+		return runVolumeBackup(args[1:])
+	case "restore":
+		return runVolumeRestore(args[1:])
+	default:
+		return fmt.Errorf("unknown volume action %q (expected backup or restore)", args[0])
+	}
+}
+
+func runVolumeBackup(args []string) error {
+	fs := flag.NewFlagSet("volume backup", flag.ExitOnError)
+	volume := fs.String("volume", "", "Docker volume to archive (required)")
+	fs.StringVar(volume, "v", "", "Docker volume to archive (shorthand)")
+	outputDir := fs.String("output", "./backups", "Output directory for the archive")
+	fs.StringVar(outputDir, "o", "./backups", "Output directory for the archive (shorthand)")
+	image := fs.String("helper-image", backup.DefaultHelperImage, "Image the archiving helper container runs")
+	var tags stringList
+	fs.Var(&tags, "tag", "Tag to attach to the archive (repeatable)")
+	note := fs.String("note", "", "Free-form note to attach to the archive")
+	var meta metaFlag
+	fs.Var(&meta, "run-meta", "Annotate the archive with key=value, e.g. a CI run's git_sha or pipeline_url (repeatable)")
+	catalogPath := fs.String("catalog", catalog.DefaultPath, "Backup catalog file")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *volume == "" {
+		fmt.Fprintln(os.Stderr, "Error: --volume flag is required")
+		fs.Usage()
+		return fmt.Errorf("missing required flag: --volume")
+	}
+
+	dockerSvc, err := newDatabaseService("", false)
+	if err != nil {
+		return err
+	}
+	backupSvc := backup.NewService(dockerSvc)
+
+	fmt.Printf("Archiving volume '%s'...\n", *volume)
+	timestamp := backupSvc.Now()
+	started := time.Now()
+	outputPath, err := backupSvc.BackupVolume(backup.VolumeConfig{
+		Volume:      *volume,
+		OutputDir:   *outputDir,
+		Timestamp:   timestamp,
+		HelperImage: *image,
+	})
+	if err != nil {
+		return fmt.Errorf("volume backup failed: %w", err)
+	}
+	fmt.Printf("Volume backup completed successfully: %s\n", outputPath)
+
+	entry, err := recordBackup(catalog.Open(*catalogPath), catalog.Entry{
+		Kind:      catalog.KindVolume,
+		Path:      outputPath,
+		Volume:    *volume,
+		CreatedAt: timestamp,
+		Duration:  time.Since(started),
+		Tags:      tags,
+		Note:      *note,
+		Meta:      meta,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record volume backup in catalog: %w", err)
+	}
+	recordThroughput(throughput.OpBackup, "volume:"+*volume, *outputDir, entry.Size, started)
+	recordUsage(usage.OpBackup, entry.Size, false)
+	fmt.Printf("Catalog ID: %s\n", entry.ID)
+	return nil
+}
+
+func runVolumeRestore(args []string) error {
+	fs := flag.NewFlagSet("volume restore", flag.ExitOnError)
+	volume := fs.String("volume", "", "Docker volume to restore into; created if missing (default: the archived volume)")
+	fs.StringVar(volume, "v", "", "Docker volume to restore into (shorthand)")
+	backupPath := fs.String("file", "", "Volume archive path")
+	fs.StringVar(backupPath, "f", "", "Volume archive path (shorthand)")
+	backupID := fs.String("id", "", "Restore the volume archive with this catalog ID (or unique prefix)")
+	clearFirst := fs.Bool("clear", false, "Delete the volume's current contents before extracting")
+	image := fs.String("helper-image", backup.DefaultHelperImage, "Image the extracting helper container runs")
+	assumeYes := fs.Bool("yes", false, "Skip confirmation prompts")
+	fs.BoolVar(assumeYes, "y", false, "Skip confirmation prompts (shorthand)")
+	var protect stringList
+	fs.Var(&protect, "protect", "Volume name pattern to protect from restores (repeatable)")
+	override := fs.Bool("i-know-what-im-doing", false, "Allow restoring into a protected volume")
+	catalogPath := fs.String("catalog", catalog.DefaultPath, "Backup catalog file")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if (*backupPath == "") == (*backupID == "") {
+		fmt.Fprintln(os.Stderr, "Error: one of --file or --id is required")
+		fs.Usage()
+		return fmt.Errorf("missing required flags")
+	}
+
+	catalogID := ""
+	if *backupID != "" {
+		entry, err := catalog.Open(*catalogPath).Get(*backupID)
+		if err != nil {
+			return err
+		}
+		if entry.Kind != catalog.KindVolume {
+			return fmt.Errorf("catalog entry %s is a %s, not a volume archive", entry.ID, entry.Kind)
+		}
+		if err := verifyCatalogChecksum(entry); err != nil {
+			return err
+		}
+		if *volume == "" {
+			*volume = entry.Volume
+		}
+		catalogID = entry.ID
+		*backupPath = entry.Path
+	}
+	if *volume == "" {
+		fmt.Fprintln(os.Stderr, "Error: --volume flag is required with --file")
+		fs.Usage()
+		return fmt.Errorf("missing required flag: --volume")
+	}
+	if !backup.IsVolumeArchive(*backupPath) {
+		return fmt.Errorf("%s is not a volume archive (expected .tar.gz); use `restore` for database backups", *backupPath)
+	}
+
+	if err := guardProtectedVolume(*volume, protectedPatterns(protect), *override); err != nil {
+		return err
+	}
+	descriptions := []string{fmt.Sprintf("files in volume '%s' will be overwritten with those in %s", *volume, *backupPath)}
+	if *clearFirst {
+		descriptions = []string{
+			fmt.Sprintf("every file in volume '%s' will be deleted", *volume),
+			fmt.Sprintf("it will be replaced with the contents of %s", *backupPath),
+		}
+	}
+	if err := confirmDestructive(*assumeYes, descriptions...); err != nil {
+		return err
+	}
+
+	dockerSvc, err := newDatabaseService("", false)
+	if err != nil {
+		return err
+	}
+	backupSvc := backup.NewService(dockerSvc)
+
+	fmt.Printf("Restoring archive into volume '%s'...\n", *volume)
+	err = backupSvc.RestoreVolume(backup.VolumeRestoreConfig{
+		Volume:      *volume,
+		BackupPath:  *backupPath,
+		Clear:       *clearFirst,
+		HelperImage: *image,
+	})
+	recordAccess(audit.ActionRestore, *backupPath, catalogID, "volume:"+*volume, err)
+	if err != nil {
+		return fmt.Errorf("volume restore failed: %w", err)
+	}
+	fmt.Println("Volume restore completed successfully")
+	return nil
+}
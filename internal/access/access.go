@@ -0,0 +1,217 @@
+// Package access holds the API tokens `serve` accepts and the roles they
+// carry. Only SHA-256 hashes of tokens are stored; the secret itself is
+// shown once when the token is created.
+package access
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// DefaultPath is where tokens are stored unless overridden
+const DefaultPath = "./backups/access.json"
+
+// Role grants a set of permissions; each role includes the ones below it
+type Role string
+
+const (
+	// RoleViewer may view job status and the catalog
+	RoleViewer Role = "viewer"
+	// RoleOperator may additionally pause and resume jobs and trigger restores
+	RoleOperator Role = "operator"
+	// RoleAdmin may additionally restore into protected containers and read the audit log
+	RoleAdmin Role = "admin"
+)
+
+var roleRank = map[Role]int{RoleViewer: 1, RoleOperator: 2, RoleAdmin: 3}
+
+// ParseRole validates a role name
+func ParseRole(s string) (Role, error) {
+	r := Role(s)
+	if _, ok := roleRank[r]; !ok {
+		return "", fmt.Errorf("unknown role %q (expected viewer, operator, or admin)", s)
+	}
+	return r, nil
+}
+
+// Allows reports whether r includes the permissions of required
+func (r Role) Allows(required Role) bool {
+	return roleRank[r] >= roleRank[required] && roleRank[r] > 0
+}
+
+// Token is an API credential with a role, optionally scoped to jobs
+type Token struct {
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+	// Jobs are glob patterns of the job names (databases, containers, or tags)
+	// the token may act on; empty means every job
+	Jobs      []string  `json:"jobs,omitempty"`
+	Hash      string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Scoped reports whether the token may act on a job known by any of names
+func (t Token) Scoped(names ...string) bool {
+	if len(t.Jobs) == 0 {
+		return true
+	}
+	for _, pattern := range t.Jobs {
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok && name != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ScopedAll reports whether the token may act on every one of names; empty
+// names are skipped
+func (t Token) ScopedAll(names ...string) bool {
+	for _, name := range names {
+		if name != "" && !t.Scoped(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// Store is a JSON file of tokens
+type Store struct {
+	path string
+}
+
+type storeFile struct {
+	Tokens []Token `json:"tokens"`
+}
+
+// Open returns the token store at path. The file is created on first write.
+func Open(path string) *Store {
+	return &Store{path: path}
+}
+
+// Tokens returns every token in the store
+func (s *Store) Tokens() ([]Token, error) {
+	f, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return f.Tokens, nil
+}
+
+// Add creates a token and returns its secret, which isn't stored anywhere
+func (s *Store) Add(name string, role Role, jobs []string) (string, Token, error) {
+	if name == "" {
+		return "", Token{}, fmt.Errorf("token name is required")
+	}
+	for _, pattern := range jobs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return "", Token{}, fmt.Errorf("invalid job pattern %q: %w", pattern, err)
+		}
+	}
+
+	f, err := s.load()
+	if err != nil {
+		return "", Token{}, err
+	}
+	for _, t := range f.Tokens {
+		if t.Name == name {
+			return "", Token{}, fmt.Errorf("token %q already exists", name)
+		}
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", Token{}, fmt.Errorf("failed to generate token: %w", err)
+	}
+	secret := "biu_" + hex.EncodeToString(buf)
+	t := Token{Name: name, Role: role, Jobs: jobs, Hash: hashSecret(secret), CreatedAt: time.Now()}
+
+	f.Tokens = append(f.Tokens, t)
+	if err := s.save(f); err != nil {
+		return "", Token{}, err
+	}
+	return secret, t, nil
+}
+
+// Revoke removes the token called name
+func (s *Store) Revoke(name string) error {
+	f, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i, t := range f.Tokens {
+		if t.Name == name {
+			f.Tokens = append(f.Tokens[:i], f.Tokens[i+1:]...)
+			return s.save(f)
+		}
+	}
+	return fmt.Errorf("no token named %q", name)
+}
+
+// Authenticate returns the token whose secret is secret
+func (s *Store) Authenticate(secret string) (Token, bool, error) {
+	tokens, err := s.Tokens()
+	if err != nil {
+		return Token{}, false, err
+	}
+	hash := []byte(hashSecret(secret))
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(t.Hash)) == 1 {
+			return t, true, nil
+		}
+	}
+	return Token{}, false, nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Store) load() (storeFile, error) {
+	var f storeFile
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return f, fmt.Errorf("failed to read token store: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &f); err != nil {
+		return f, fmt.Errorf("failed to parse token store %s: %w", s.path, err)
+	}
+	return f, nil
+}
+
+// save writes the store atomically; it's readable by the owner only
+func (s *Store) save(f storeFile) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create token store directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode token store: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write token store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write token store: %w", err)
+	}
+	return nil
+}
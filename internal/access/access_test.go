@@ -0,0 +1,138 @@
+package access
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScoped(t *testing.T) {
+	tests := []struct {
+		name  string
+		jobs  []string
+		names []string
+		want  bool
+	}{
+		{"unscoped", nil, []string{"app"}, true},
+		{"unscoped without names", nil, nil, true},
+		{"exact name", []string{"app"}, []string{"app"}, true},
+		{"other name", []string{"app"}, []string{"billing"}, false},
+		{"glob", []string{"prod-*"}, []string{"prod-pg"}, true},
+		{"glob doesn't cross slashes", []string{"prod-*"}, []string{"prod-pg/app"}, false},
+		{"target pattern", []string{"prod-pg/*"}, []string{"prod-pg/app"}, true},
+		{"any of the names", []string{"nightly"}, []string{"app", "prod-pg", "nightly"}, true},
+		{"any of the patterns", []string{"app", "billing"}, []string{"billing"}, true},
+		{"empty name never matches", []string{"*"}, []string{""}, false},
+		{"character class", []string{"db[0-9]"}, []string{"db7"}, true},
+		{"bad pattern matches nothing", []string{"db["}, []string{"db["}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok := Token{Name: "t", Role: RoleOperator, Jobs: tt.jobs}
+			if got := tok.Scoped(tt.names...); got != tt.want {
+				t.Errorf("Scoped(%q) with jobs %q = %v, want %v", tt.names, tt.jobs, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopedAll(t *testing.T) {
+	tok := Token{Name: "t", Role: RoleOperator, Jobs: []string{"app", "prod-*"}}
+	tests := []struct {
+		names []string
+		want  bool
+	}{
+		{[]string{"app", "prod-pg"}, true},
+		{[]string{"app", "", "prod-pg"}, true},
+		{[]string{"app", "staging-pg"}, false},
+		{nil, true},
+	}
+	for _, tt := range tests {
+		if got := tok.ScopedAll(tt.names...); got != tt.want {
+			t.Errorf("ScopedAll(%q) = %v, want %v", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role, required Role
+		want           bool
+	}{
+		{RoleViewer, RoleViewer, true},
+		{RoleViewer, RoleOperator, false},
+		{RoleOperator, RoleViewer, true},
+		{RoleOperator, RoleAdmin, false},
+		{RoleAdmin, RoleOperator, true},
+		{Role("root"), RoleViewer, false},
+		{Role(""), Role(""), false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Allows(tt.required); got != tt.want {
+			t.Errorf("%q.Allows(%q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for _, s := range []string{"viewer", "operator", "admin"} {
+		if r, err := ParseRole(s); err != nil || string(r) != s {
+			t.Errorf("ParseRole(%q) = %q, %v", s, r, err)
+		}
+	}
+	for _, s := range []string{"", "Admin", "root"} {
+		if _, err := ParseRole(s); err == nil {
+			t.Errorf("ParseRole(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.json")
+	s := Open(path)
+
+	secret, tok, err := s.Add("ci", RoleOperator, []string{"app"})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if _, _, err := s.Add("ci", RoleViewer, nil); err == nil {
+		t.Error("Add of an existing name succeeded")
+	}
+	if _, _, err := s.Add("bad", RoleViewer, []string{"db["}); err == nil {
+		t.Error("Add with a bad job pattern succeeded")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), secret) {
+		t.Error("the store holds the token's secret")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("store mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	got, ok, err := s.Authenticate(secret)
+	if err != nil || !ok || got.Name != tok.Name || got.Role != RoleOperator {
+		t.Errorf("Authenticate = %+v, %v, %v; want token ci", got, ok, err)
+	}
+	if _, ok, _ := s.Authenticate(secret + "x"); ok {
+		t.Error("Authenticate accepted a wrong secret")
+	}
+
+	if err := s.Revoke("ci"); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, ok, _ := s.Authenticate(secret); ok {
+		t.Error("Authenticate accepted a revoked token")
+	}
+	if err := s.Revoke("ci"); err == nil {
+		t.Error("Revoke of a missing token succeeded")
+	}
+}
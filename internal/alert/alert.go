@@ -0,0 +1,184 @@
+// Package alert decides when a recurring failure is worth telling someone
+// about, so a job failing every few minutes overnight doesn't page anyone
+// every few minutes. A failure identical to the last one notified is
+// suppressed for a cool-down, and a job that keeps failing is escalated to
+// a second channel once.
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Policy says which failures are notified and when one is escalated
+type Policy struct {
+	// Cooldown suppresses a failure identical to the last one notified for
+	// a job until this long has passed; zero notifies every failure
+	Cooldown time.Duration
+	// EscalateAfter escalates a job once it has failed this many times in a
+	// row; zero never escalates
+	EscalateAfter int
+}
+
+// Decision is what to do about one failure
+type Decision struct {
+	Notify   bool
+	Escalate bool
+	// Suppressed counts the identical failures not notified since the last
+	// notification, reported with the next one
+	Suppressed int
+	// Consecutive counts the job's failures in a row, this one included
+	Consecutive int
+}
+
+// Tracker applies a policy to the failures and successes of jobs. It is
+// safe for concurrent use.
+type Tracker struct {
+	policy Policy
+	// dir keeps each job's streak in a file when set
+	dir string
+
+	mu   sync.Mutex
+	jobs map[string]*streak
+}
+
+// streak is a job's current run of failures
+type streak struct {
+	Failures   int       `json:"failures"`
+	Message    string    `json:"message"`
+	NotifiedAt time.Time `json:"notified_at"`
+	Suppressed int       `json:"suppressed,omitempty"`
+}
+
+// NewTracker returns a tracker applying p
+func NewTracker(p Policy) *Tracker {
+	return &Tracker{policy: p, jobs: make(map[string]*streak)}
+}
+
+// OpenTracker returns a tracker applying p that keeps each job's streak in
+// a file under dir, so processes run one after another, such as a
+// daemon's backups, share it. A streak that can't be read or written is
+// treated as new, so its failures are notified rather than lost.
+func OpenTracker(dir string, p Policy) *Tracker {
+	t := NewTracker(p)
+	t.dir = dir
+	return t
+}
+
+func (t *Tracker) streakPath(job string) string {
+	return filepath.Join(t.dir, url.PathEscape(job)+".json")
+}
+
+// load returns job's streak, or nil if it has none
+func (t *Tracker) load(job string) *streak {
+	if t.dir == "" {
+		return t.jobs[job]
+	}
+	data, err := os.ReadFile(t.streakPath(job))
+	if err != nil {
+		return nil
+	}
+	s := &streak{}
+	if json.Unmarshal(data, s) != nil {
+		return nil
+	}
+	return s
+}
+
+// store saves job's streak, removing it when s is nil
+func (t *Tracker) store(job string, s *streak) {
+	if t.dir == "" {
+		if s == nil {
+			delete(t.jobs, job)
+		} else {
+			t.jobs[job] = s
+		}
+		return
+	}
+	path := t.streakPath(job)
+	if s == nil {
+		os.Remove(path)
+		return
+	}
+	data, err := json.Marshal(s)
+	if err != nil || os.MkdirAll(t.dir, 0755) != nil {
+		return
+	}
+	// Written aside and renamed, so a process reading it never sees half
+	tmp := path + ".tmp"
+	if os.WriteFile(tmp, data, 0644) != nil {
+		return
+	}
+	if os.Rename(tmp, path) != nil {
+		os.Remove(tmp)
+	}
+}
+
+// Failure records that job failed with message and decides what to do
+// about it
+func (t *Tracker) Failure(job, message string) Decision {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.load(job)
+	if s == nil {
+		s = &streak{}
+	}
+	s.Failures++
+	now := time.Now()
+
+	d := Decision{Consecutive: s.Failures}
+	if message != s.Message || s.NotifiedAt.IsZero() || now.Sub(s.NotifiedAt) >= t.policy.Cooldown {
+		d.Notify, d.Suppressed = true, s.Suppressed
+		s.Message, s.NotifiedAt, s.Suppressed = message, now, 0
+	} else {
+		s.Suppressed++
+	}
+	d.Escalate = t.policy.EscalateAfter > 0 && s.Failures == t.policy.EscalateAfter
+	t.store(job, s)
+	return d
+}
+
+// Success records that job succeeded, ending its run of failures. It
+// returns how many failures in a row preceded it.
+func (t *Tracker) Success(job string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	failures := 0
+	if s := t.load(job); s != nil {
+		failures = s.Failures
+	}
+	t.store(job, nil)
+	return failures
+}
+
+// Alert is the failure an escalation reports
+type Alert struct {
+	Job         string
+	Message     string
+	Consecutive int
+}
+
+// Exec escalates a by running command through the shell, with the alert in
+// its environment as BACKITUP_ALERT_JOB, BACKITUP_ALERT_MESSAGE, and
+// BACKITUP_ALERT_FAILURES
+func Exec(command string, a Alert) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"BACKITUP_ALERT_JOB="+a.Job,
+		"BACKITUP_ALERT_MESSAGE="+a.Message,
+		"BACKITUP_ALERT_FAILURES="+strconv.Itoa(a.Consecutive),
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("escalation command failed: %w\nError output: %s", err, output)
+	}
+	return nil
+}
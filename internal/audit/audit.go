@@ -0,0 +1,240 @@
+// Package audit keeps an append-only log of who read, downloaded, or
+// restored backup artifacts. Each event carries the SHA-256 of the one
+// before it, so edits or deletions anywhere in the log are detectable.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/clock"
+	"github.com/iostate/back-it-up/internal/filelock"
+)
+
+// DefaultPath is where the audit log lives unless overridden
+const DefaultPath = "./backups/audit.log"
+
+// Actions recorded in Event.Action
+const (
+	// ActionRead records an artifact being opened for inspection, e.g. by diff or drift
+	ActionRead = "read"
+	// ActionDownload records an artifact fetched from remote storage
+	ActionDownload = "download"
+	// ActionRestore records an artifact loaded into a database
+	ActionRestore = "restore"
+)
+
+// Outcomes recorded in Event.Outcome
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event is a single artifact access
+type Event struct {
+	Seq      int       `json:"seq"`
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	Artifact string    `json:"artifact"`
+	// CatalogID is set when the artifact was resolved from the catalog
+	CatalogID string `json:"catalog_id,omitempty"`
+	Actor     string `json:"actor"`
+	Host      string `json:"host"`
+	// Remote is the client address when the access came through server mode
+	Remote string `json:"remote,omitempty"`
+	// Target names the container and database an artifact was restored into
+	Target   string `json:"target,omitempty"`
+	Outcome  string `json:"outcome"`
+	Error    string `json:"error,omitempty"`
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+}
+
+// digest hashes the event with its Hash field cleared
+func (e Event) digest() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log is an append-only audit log stored as JSON lines
+type Log struct {
+	path  string
+	clock clock.Clock
+}
+
+// Open returns the audit log at path. The file is created on first write.
+func Open(path string) *Log {
+	return &Log{path: path, clock: clock.System{}}
+}
+
+// SetClock replaces the clock used to timestamp new events
+func (l *Log) SetClock(clk clock.Clock) {
+	if clk == nil {
+		clk = clock.System{}
+	}
+	l.clock = clk
+}
+
+// recordMu serializes the writers in this process, so their goroutines
+// don't poll the lock file for each other
+var recordMu sync.Mutex
+
+// Record appends e to the log, filling in its sequence number, time, and
+// hashes. The log is locked from reading its last event to appending, so
+// concurrent writers, in this process or others, never fork the chain.
+func (l *Log) Record(e Event) (Event, error) {
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return Event{}, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	lockPath := l.path + ".lock"
+	unlock, err := filelock.Acquire(lockPath)
+	if errors.Is(err, filelock.ErrHeld) {
+		return Event{}, fmt.Errorf("audit log %s is locked by another writer; remove %s if none is running", l.path, lockPath)
+	}
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to lock audit log: %w", err)
+	}
+	defer unlock()
+
+	last, found, err := l.last()
+	if err != nil {
+		return Event{}, err
+	}
+	e.Seq = 1
+	e.PrevHash = ""
+	if found {
+		e.Seq = last.Seq + 1
+		e.PrevHash = last.Hash
+	}
+	if e.Time.IsZero() {
+		e.Time = l.clock.Now()
+	}
+	if e.Hash, err = e.digest(); err != nil {
+		return Event{}, fmt.Errorf("failed to encode audit event: %w", err)
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to encode audit event: %w", err)
+	}
+
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return Event{}, fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return e, nil
+}
+
+// last returns the newest event in the log, reading back from the end of
+// the file only as far as its line starts
+func (l *Log) last() (Event, bool, error) {
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Event{}, false, nil
+	}
+	if err != nil {
+		return Event{}, false, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return Event{}, false, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	size := info.Size()
+	for window := int64(4 << 10); ; window *= 2 {
+		window = min(window, size)
+		buf := make([]byte, window)
+		if _, err := f.ReadAt(buf, size-window); err != nil && err != io.EOF {
+			return Event{}, false, fmt.Errorf("failed to read audit log: %w", err)
+		}
+		buf = bytes.TrimRight(buf, "\n\r\t ")
+		start := bytes.LastIndexByte(buf, '\n')
+		if start < 0 && window < size {
+			// The last line goes on before the window
+			continue
+		}
+		line := buf[start+1:]
+		if len(line) == 0 {
+			return Event{}, false, nil
+		}
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			return Event{}, false, fmt.Errorf("failed to parse the last event of audit log %s: %w", l.path, err)
+		}
+		return e, true, nil
+	}
+}
+
+// Events returns every event in the log, oldest first
+func (l *Log) Events() ([]Event, error) {
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	var events []Event
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("failed to parse audit log %s line %d: %w", l.path, line, err)
+		}
+		events = append(events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return events, nil
+}
+
+// Verify checks the hash chain and returns an error naming the first event
+// that was altered, removed, or reordered
+func Verify(events []Event) error {
+	prev := ""
+	for i, e := range events {
+		if e.Seq != i+1 {
+			return fmt.Errorf("audit log broken at event %d: expected sequence number %d, found %d", i+1, i+1, e.Seq)
+		}
+		if e.PrevHash != prev {
+			return fmt.Errorf("audit log broken at event %d: previous hash does not match", e.Seq)
+		}
+		digest, err := e.digest()
+		if err != nil {
+			return err
+		}
+		if digest != e.Hash {
+			return fmt.Errorf("audit log broken at event %d: contents were modified", e.Seq)
+		}
+		prev = e.Hash
+	}
+	return nil
+}
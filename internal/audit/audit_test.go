@@ -0,0 +1,164 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/clock"
+)
+
+func TestRecordChainsEvents(t *testing.T) {
+	log := Open(filepath.Join(t.TempDir(), "audit.log"))
+	log.SetClock(clock.Fixed{Time: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)})
+
+	var recorded []Event
+	for _, action := range []string{ActionRead, ActionDownload, ActionRestore} {
+		e, err := log.Record(Event{Action: action, Artifact: "/backups/app.sql.gz", Actor: "ana", Outcome: OutcomeSuccess})
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorded = append(recorded, e)
+	}
+	for i, e := range recorded {
+		if e.Seq != i+1 {
+			t.Errorf("event %d has seq %d", i, e.Seq)
+		}
+		if i > 0 && e.PrevHash != recorded[i-1].Hash {
+			t.Errorf("event %d doesn't chain to the one before", e.Seq)
+		}
+	}
+
+	events, err := log.Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("read %d events, want 3", len(events))
+	}
+	if err := Verify(events); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestRecordConcurrent(t *testing.T) {
+	log := Open(filepath.Join(t.TempDir(), "audit.log"))
+
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// A log per writer, as each command opens its own
+			if _, err := Open(log.path).Record(Event{Action: ActionRead, Artifact: "a", Outcome: OutcomeSuccess}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	events, err := log.Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != writers {
+		t.Fatalf("read %d events, want %d", len(events), writers)
+	}
+	if err := Verify(events); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestRecordAfterLongLine(t *testing.T) {
+	log := Open(filepath.Join(t.TempDir(), "audit.log"))
+	// Longer than the first window the last event is looked for in
+	long := strings.Repeat("x", 10<<10)
+	if _, err := log.Record(Event{Action: ActionRead, Artifact: long, Outcome: OutcomeSuccess}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Record(Event{Action: ActionRead, Artifact: "short", Outcome: OutcomeSuccess}); err != nil {
+		t.Fatal(err)
+	}
+	events, err := log.Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(events); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log := Open(path)
+	for _, actor := range []string{"ana", "ben", "cho"} {
+		if _, err := log.Record(Event{Action: ActionDownload, Artifact: "a", Actor: actor, Outcome: OutcomeSuccess}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := log.Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		events func() []Event
+		want   string
+	}{
+		{"modified", func() []Event {
+			e := append([]Event(nil), events...)
+			e[1].Actor = "mallory"
+			return e
+		}, "event 2: contents were modified"},
+		{"removed", func() []Event {
+			return append([]Event{events[0]}, events[2:]...)
+		}, "expected sequence number 2, found 3"},
+		{"reordered", func() []Event {
+			e := append([]Event(nil), events...)
+			e[1], e[2] = e[2], e[1]
+			return e
+		}, "expected sequence number 2"},
+		{"rehashed", func() []Event {
+			e := append([]Event(nil), events...)
+			e[1].Actor = "mallory"
+			e[1].Hash, _ = e[1].digest()
+			return e
+		}, "event 3: previous hash does not match"},
+		{"first removed", func() []Event {
+			return events[1:]
+		}, "expected sequence number 1, found 2"},
+		{"first removed and renumbered", func() []Event {
+			e := append([]Event(nil), events[1:]...)
+			for i := range e {
+				e[i].Seq = i + 1
+			}
+			return e
+		}, "event 1: previous hash does not match"},
+	}
+	if err := Verify(events); err != nil {
+		t.Fatalf("Verify of the untouched log = %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.events())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Verify = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLastIgnoresMissingLog(t *testing.T) {
+	log := Open(filepath.Join(t.TempDir(), "missing", "audit.log"))
+	if _, found, err := log.last(); err != nil || found {
+		t.Errorf("last() = found %v, err %v; want nothing", found, err)
+	}
+	if _, err := os.Stat(log.path); !os.IsNotExist(err) {
+		t.Errorf("reading created the log")
+	}
+}
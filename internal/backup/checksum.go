@@ -0,0 +1,119 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iostate/back-it-up/internal/storage"
+)
+
+// checksumExtension marks the sidecar holding a backup's SHA-256, in the
+// format sha256sum writes and `sha256sum -c` reads
+const checksumExtension = ".sha256"
+
+// ChecksumPath returns where the checksum sidecar of the backup at path is
+// stored
+func ChecksumPath(path string) string {
+	return path + checksumExtension
+}
+
+// RemoveBackup deletes the backup at path along with its checksum file,
+// signature, and manifest, on disk or in an object store. It returns an
+// error only if the backup itself couldn't be removed; one already gone is
+// not an error, and the sidecars are removed on a best-effort basis.
+func RemoveBackup(path string) error {
+	if storage.IsLocation(path) {
+		store, key, err := storage.Open(path)
+		if err != nil {
+			return err
+		}
+		if err := store.Delete(key); err != nil {
+			return err
+		}
+		for _, k := range []string{ChecksumPath(key), ManifestPath(key)} {
+			store.Delete(k)
+		}
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	os.Remove(ChecksumPath(path))
+	os.Remove(SignaturePath(path))
+	os.Remove(ManifestPath(path))
+	return nil
+}
+
+// writeChecksumFile writes the checksum sidecar of the file at path. The
+// file is only read to checksum it if sum is empty.
+func writeChecksumFile(path, sum string) error {
+	if sum == "" {
+		var err error
+		if sum, err = FileChecksum(path); err != nil {
+			return fmt.Errorf("failed to checksum backup: %w", err)
+		}
+	}
+	if err := os.WriteFile(ChecksumPath(path), checksumLine(sum, filepath.Base(path)), 0644); err != nil {
+		return fmt.Errorf("failed to write checksum file: %w", err)
+	}
+	return nil
+}
+
+// checksumLine formats the checksum file of a backup named name
+func checksumLine(sum, name string) []byte {
+	return []byte(fmt.Sprintf("%s  %s\n", sum, name))
+}
+
+// parseChecksumLine returns the SHA-256 a checksum file holds
+func parseChecksumLine(data []byte) (string, bool) {
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+		return "", false
+	}
+	return strings.ToLower(fields[0]), true
+}
+
+// RecordedChecksum returns the SHA-256 of the file at path from its checksum
+// sidecar, written as the backup was taken, and only reads the whole file
+// if there is none
+func RecordedChecksum(path string) (string, error) {
+	if sum, err := storedChecksum(path); err == nil {
+		return sum, nil
+	}
+	return FileChecksum(path)
+}
+
+// VerifyChecksumFile checks the file at path against its checksum sidecar,
+// catching truncated and bit-rotted backups. It reports whether there was
+// a sidecar to check against; backups without one pass unchecked, as do
+// backups in an object store, which are checked as they are streamed.
+func VerifyChecksumFile(path string) (bool, error) {
+	if storage.IsLocation(path) {
+		return false, nil
+	}
+	sidecar := ChecksumPath(path)
+	data, err := os.ReadFile(sidecar)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return true, fmt.Errorf("failed to read checksum file: %w", err)
+	}
+	expected, ok := parseChecksumLine(data)
+	if !ok {
+		return true, fmt.Errorf("malformed checksum file %s", sidecar)
+	}
+
+	actual, err := FileChecksum(path)
+	if err != nil {
+		return true, fmt.Errorf("failed to checksum %s: %w", path, err)
+	}
+	if actual != expected {
+		return true, fmt.Errorf("checksum mismatch for %s: %s has %s, file has %s; the backup is truncated or corrupted", path, sidecar, expected, actual)
+	}
+	return true, nil
+}
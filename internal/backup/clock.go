@@ -0,0 +1,20 @@
+package backup
+
+import (
+	"time"
+
+	"github.com/iostate/back-it-up/internal/clock"
+)
+
+// SetClock replaces the clock used for backup timestamps and standby status
+func (s *Service) SetClock(c clock.Clock) {
+	if c == nil {
+		c = clock.System{}
+	}
+	s.clock = c
+}
+
+// Now returns the current time according to the service's clock
+func (s *Service) Now() time.Time {
+	return s.clock.Now()
+}
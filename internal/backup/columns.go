@@ -0,0 +1,170 @@
+package backup
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/iostate/back-it-up/internal/subset"
+)
+
+// ParseColumnExclusion normalizes a table.column or schema.table.column
+// spec to schema.table.column
+func ParseColumnExclusion(spec string) (string, error) {
+	parts := strings.Split(spec, ".")
+	if len(parts) < 2 || len(parts) > 3 || slices.Contains(parts, "") {
+		return "", fmt.Errorf("invalid column %q: expected table.column or schema.table.column", spec)
+	}
+	if len(parts) == 2 {
+		return "public." + spec, nil
+	}
+	return spec, nil
+}
+
+// dumpExcludingColumns writes a plain dump in which the tables with
+// excluded columns are copied with a SELECT list that leaves them out, so
+// their values never leave the database server. All parts of the dump read
+// the same exported snapshot, as a single pg_dump run would.
+func (s *Service) dumpExcludingColumns(cfg Config, w io.Writer) error {
+	tables, err := s.redactedTables(cfg)
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := s.exportSnapshot(cfg)
+	if err != nil {
+		return err
+	}
+	defer snapshot.release()
+
+	if err := s.pgDump(cfg, w, "--snapshot="+snapshot.id, "--section=pre-data"); err != nil {
+		return err
+	}
+	dataArgs := []string{"--snapshot=" + snapshot.id, "--section=data"}
+	for _, t := range tables {
+		dataArgs = append(dataArgs, "--exclude-table-data="+t.Ident())
+	}
+	if err := s.pgDump(cfg, w, dataArgs...); err != nil {
+		return err
+	}
+
+	for _, t := range tables {
+		if _, err := fmt.Fprintf(w, "\n%s\n", subset.CopyHeader(t)); err != nil {
+			return fmt.Errorf("failed to write backup: %w", err)
+		}
+		cols := make([]string, len(t.Columns))
+		for i, col := range t.Columns {
+			cols[i] = subset.QuoteIdent(col.Name)
+		}
+		err := s.stream(cfg.ContainerName, w, "psql",
+			"-X", "-q", "-v", "ON_ERROR_STOP=1", "-U", cfg.DatabaseUser, "-d", cfg.DatabaseName,
+			"-c", "BEGIN ISOLATION LEVEL REPEATABLE READ",
+			"-c", fmt.Sprintf("SET TRANSACTION SNAPSHOT '%s'", snapshot.id),
+			"-c", fmt.Sprintf("COPY (SELECT %s FROM %s) TO STDOUT", strings.Join(cols, ", "), t.Ident()))
+		if err != nil {
+			return fmt.Errorf("failed to copy %s: %w", t.Key(), err)
+		}
+		if _, err := io.WriteString(w, "\\.\n"); err != nil {
+			return fmt.Errorf("failed to write backup: %w", err)
+		}
+	}
+
+	return s.pgDump(cfg, w, "--snapshot="+snapshot.id, "--section=post-data")
+}
+
+// redactedTables returns the tables with excluded columns, holding only the
+// columns that are kept. Unknown columns are an error so a typo can't leak
+// the column it meant to exclude.
+func (s *Service) redactedTables(cfg Config) ([]subset.Table, error) {
+	output, err := s.dockerSvc.Exec(cfg.ContainerName, []string{
+		"psql", "-X", "-U", cfg.DatabaseUser, "-d", cfg.DatabaseName, "-tA", "-c", subset.SchemaQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w\nOutput: %s", err, string(output))
+	}
+	schema, err := subset.ParseSchema(output)
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := map[string][]string{}
+	for _, key := range cfg.ExcludeColumns {
+		i := strings.LastIndex(key, ".")
+		excluded[key[:i]] = append(excluded[key[:i]], key[i+1:])
+	}
+
+	var tables []subset.Table
+	for name, columns := range excluded {
+		t, ok := schema.Table(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown table %s", name)
+		}
+		var kept []subset.Column
+		for _, col := range t.Columns {
+			if !slices.Contains(columns, col.Name) {
+				kept = append(kept, col)
+			}
+		}
+		for _, c := range columns {
+			if !slices.ContainsFunc(t.Columns, func(col subset.Column) bool { return col.Name == c }) {
+				return nil, fmt.Errorf("unknown column %s.%s", name, c)
+			}
+		}
+		if len(kept) == 0 {
+			return nil, fmt.Errorf("every column of %s is excluded", name)
+		}
+		t.Columns = kept
+		tables = append(tables, t)
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Key() < tables[j].Key() })
+	return tables, nil
+}
+
+// exportedSnapshot is a transaction held open so other sessions can read
+// the snapshot it exported
+type exportedSnapshot struct {
+	id    string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+// exportSnapshot opens a repeatable-read transaction and exports its snapshot
+func (s *Service) exportSnapshot(cfg Config) (*exportedSnapshot, error) {
+	cmd := s.dockerSvc.Command(cfg.ContainerName, true,
+		"psql", "-X", "-q", "-tA", "-v", "ON_ERROR_STOP=1", "-U", cfg.DatabaseUser, "-d", cfg.DatabaseName)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start psql: %w", err)
+	}
+	snapshot := &exportedSnapshot{cmd: cmd, stdin: stdin}
+	if _, err := io.WriteString(stdin, "BEGIN ISOLATION LEVEL REPEATABLE READ;\nSELECT pg_export_snapshot();\n"); err == nil {
+		line, _ := bufio.NewReader(stdout).ReadString('\n')
+		snapshot.id = strings.TrimSpace(line)
+	}
+	if snapshot.id == "" {
+		snapshot.release()
+		return nil, fmt.Errorf("failed to export snapshot\nError output: %s", stderr.String())
+	}
+	return snapshot, nil
+}
+
+// release ends the exporting transaction
+func (e *exportedSnapshot) release() {
+	io.WriteString(e.stdin, "COMMIT;\n")
+	e.stdin.Close()
+	e.cmd.Wait()
+}
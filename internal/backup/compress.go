@@ -0,0 +1,273 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Compression algorithms of plain dumps
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+	CompressionLZ4  = "lz4"
+	CompressionXz   = "xz"
+	CompressionNone = "none"
+)
+
+// compressor is one way of compressing plain dumps. Those the standard
+// library lacks run the algorithm's command line tool.
+type compressor struct {
+	name      string
+	extension string
+	// magic starts every file the algorithm writes
+	magic []byte
+	tool  string
+	// maxLevel is the highest compression level; levels start at 1
+	maxLevel int
+	// threaded tools take -T<threads>
+	threaded bool
+}
+
+var compressors = []compressor{
+	{name: CompressionGzip, extension: plainExtension, magic: []byte{0x1f, 0x8b}, maxLevel: gzip.BestCompression},
+	{name: CompressionZstd, extension: ".sql.zst", magic: []byte{0x28, 0xb5, 0x2f, 0xfd}, tool: "zstd", maxLevel: 19, threaded: true},
+	{name: CompressionLZ4, extension: ".sql.lz4", magic: []byte{0x04, 0x22, 0x4d, 0x18}, tool: "lz4", maxLevel: 12},
+	{name: CompressionXz, extension: ".sql.xz", magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, tool: "xz", maxLevel: 9, threaded: true},
+	{name: CompressionNone, extension: ".sql"},
+}
+
+// lookupCompressor returns the compressor called name; empty means gzip
+func lookupCompressor(name string) (compressor, error) {
+	if name == "" {
+		name = CompressionGzip
+	}
+	for _, c := range compressors {
+		if c.name == name {
+			return c, nil
+		}
+	}
+	return compressor{}, fmt.Errorf("unknown compression %q (expected gzip, zstd, lz4, xz or none)", name)
+}
+
+// CheckCompression rejects an unknown compression, or a level it doesn't
+// have, for a plain dump
+func CheckCompression(name string, level int) error {
+	c, err := lookupCompressor(name)
+	if err != nil {
+		return err
+	}
+	return c.checkLevel(level)
+}
+
+// detectCompressor picks the compressor by the magic bytes a file starts
+// with; a file without any is taken as uncompressed SQL
+func detectCompressor(header []byte) compressor {
+	for _, c := range compressors {
+		if c.magic != nil && bytes.HasPrefix(header, c.magic) {
+			return c
+		}
+	}
+	c, _ := lookupCompressor(CompressionNone)
+	return c
+}
+
+// pgDumpMaxLevel is the highest level pg_dump -Z takes for the custom and
+// directory formats
+const pgDumpMaxLevel = 9
+
+// checkLevel rejects a compression level the algorithm doesn't have; 0
+// means its default
+func (c compressor) checkLevel(level int) error {
+	if level == 0 {
+		return nil
+	}
+	if c.maxLevel == 0 {
+		return fmt.Errorf("%s compression has no levels", c.name)
+	}
+	if level < 1 || level > c.maxLevel {
+		return fmt.Errorf("%s compression levels run from 1 to %d", c.name, c.maxLevel)
+	}
+	return nil
+}
+
+// toolPath finds the command line tool of a compressor
+func (c compressor) toolPath() (string, error) {
+	path, err := exec.LookPath(c.tool)
+	if err != nil {
+		return "", fmt.Errorf("%s not found on PATH; install it to use %s compression", c.tool, c.name)
+	}
+	return path, nil
+}
+
+// newWriter compresses what is written to the returned writer into w at
+// level, 0 being the default, on threads threads; 0 means one per CPU.
+// dictionary is a trained zstd dictionary, if any.
+func (c compressor) newWriter(w io.Writer, level, threads int, dictionary string) (io.WriteCloser, error) {
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	}
+	switch c.name {
+	case CompressionGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		if threads > 1 {
+			return newParallelGzipWriter(w, level, threads)
+		}
+		return gzip.NewWriterLevel(w, level)
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	}
+	tool, err := c.toolPath()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"-q", "-c"}
+	if level != 0 {
+		args = append(args, "-"+strconv.Itoa(level))
+	}
+	if c.threaded {
+		args = append(args, "-T"+strconv.Itoa(threads))
+	}
+	if dictionary != "" {
+		args = append(args, "-D", dictionary)
+	}
+	return startToolWriter(w, tool, args...)
+}
+
+// newReader decompresses r, read from the backup at path. header is the
+// start of r, which for zstd names the dictionary it needs.
+func (c compressor) newReader(r io.Reader, path string, header []byte) (io.ReadCloser, error) {
+	switch c.name {
+	case CompressionGzip:
+		gzReader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		return gzReader, nil
+	case CompressionNone:
+		return io.NopCloser(r), nil
+	}
+	tool, err := c.toolPath()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"-q", "-d", "-c"}
+	if c.name == CompressionZstd {
+		dictionary, err := zstdDictionaryFor(path, header)
+		if err != nil {
+			return nil, err
+		}
+		if dictionary != "" {
+			args = append(args, "-D", dictionary)
+		}
+	}
+	return startToolReader(r, tool, args...)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// toolWriter pipes what is written to it through a compression tool
+type toolWriter struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+	closed bool
+}
+
+func startToolWriter(w io.Writer, tool string, args ...string) (*toolWriter, error) {
+	t := &toolWriter{cmd: exec.CommandContext(context.Background(), tool, args...)}
+	t.cmd.Stdout = w
+	t.cmd.Stderr = &t.stderr
+	stdin, err := t.cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	t.stdin = stdin
+	if err := t.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", tool, err)
+	}
+	return t, nil
+}
+
+func (t *toolWriter) Write(p []byte) (int, error) {
+	return t.stdin.Write(p)
+}
+
+// Close flushes the compressed stream and waits for the tool to exit
+func (t *toolWriter) Close() error {
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	t.stdin.Close()
+	if err := t.cmd.Wait(); err != nil {
+		return fmt.Errorf("%s failed: %w\nError output: %s", t.cmd.Path, err, strings.TrimSpace(t.stderr.String()))
+	}
+	return nil
+}
+
+// toolReader reads the output of a decompression tool
+type toolReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr bytes.Buffer
+	done   bool
+}
+
+func startToolReader(r io.Reader, tool string, args ...string) (*toolReader, error) {
+	t := &toolReader{cmd: exec.CommandContext(context.Background(), tool, args...)}
+	t.cmd.Stdin = r
+	t.cmd.Stderr = &t.stderr
+	stdout, err := t.cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	t.ReadCloser = stdout
+	if err := t.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", tool, err)
+	}
+	return t, nil
+}
+
+// Read reports a failed decompression once the tool's output ends
+func (t *toolReader) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if err == io.EOF && !t.done {
+		t.done = true
+		if werr := t.cmd.Wait(); werr != nil {
+			return n, fmt.Errorf("%s failed: %w\nError output: %s", t.cmd.Path, werr, strings.TrimSpace(t.stderr.String()))
+		}
+	}
+	return n, err
+}
+
+func (t *toolReader) Close() error {
+	t.ReadCloser.Close()
+	if !t.done {
+		t.done = true
+		t.cmd.Wait()
+	}
+	return nil
+}
+
+// peekHeader returns a buffered reader over r and the first bytes it holds
+func peekHeader(r io.Reader) (*bufio.Reader, []byte) {
+	br := bufio.NewReader(r)
+	// Enough for any magic number, including age's armor line, and a zstd
+	// frame header's dictionary ID
+	header, _ := br.Peek(34)
+	return br, header
+}
@@ -1,13 +1,95 @@
 package backup
 
-import "time"
+import (
+	"time"
+
+	"github.com/iostate/back-it-up/internal/schedule"
+	"github.com/iostate/back-it-up/internal/subset"
+)
+
+// Dump formats
+const (
+	// FormatPlain is a plain SQL script, gzip-compressed (.sql.gz)
+	FormatPlain = "plain"
+	// FormatCustom is pg_dump's custom archive format (.dump), which
+	// pg_restore can restore selectively and in parallel
+	FormatCustom = "custom"
+	// FormatDirectory is pg_dump's directory format, dumped by parallel
+	// jobs and stored as a gzip-compressed tarball (.dir.tar.gz)
+	FormatDirectory = "directory"
+)
+
+// Dump contents, for dumps that hold only part of a database
+const (
+	// ContentSchema is a dump of the schema only (pg_dump --schema-only)
+	ContentSchema = "schema"
+	// ContentData is a dump of the data only (pg_dump --data-only), which
+	// restores into an existing schema
+	ContentData = "data"
+)
 
 type Config struct {
 	ContainerName string
 	DatabaseName  string
 	DatabaseUser  string
 	OutputDir     string
-	Timestamp     time.Time
+	// Destination, if set, is an object store location such as
+	// s3://bucket/prefix the backup and its sidecars are streamed to instead
+	// of OutputDir; nothing is written to local disk
+	Destination string
+	Timestamp   time.Time
+	// Format is FormatPlain (the default), FormatCustom or FormatDirectory
+	Format string
+	// Jobs is the number of tables FormatDirectory dumps in parallel
+	Jobs int
+	// Content is ContentSchema or ContentData to dump part of the database;
+	// empty dumps all of it. It is recorded in the filename.
+	Content string
+	// Tables and ExcludeTables are pg_dump -t and -T patterns limiting the
+	// tables dumped
+	Tables        []string
+	ExcludeTables []string
+	// ExcludeColumns lists schema.table.column keys whose values are left
+	// out of the dump
+	ExcludeColumns []string
+	// NameByHash stores the artifact under its SHA-256 instead of a timestamped name
+	NameByHash bool
+	// Compression is the algorithm plain dumps are compressed with:
+	// CompressionGzip (the default), CompressionZstd, CompressionLZ4,
+	// CompressionXz or CompressionNone
+	Compression string
+	// CompressionLevel trades CPU for size; 0 uses the algorithm's default.
+	// Custom and directory dumps pass it to pg_dump -Z.
+	CompressionLevel int
+	// CompressThreads is how many threads compress a plain dump (gzip, zstd
+	// and xz); 0 means one per CPU
+	CompressThreads int
+	// EncryptRecipients encrypts the dump with age for these recipients,
+	// each an age or SSH public key or a file listing them
+	EncryptRecipients []string
+	// GPGRecipients encrypts the dump with GPG instead, for these key IDs,
+	// fingerprints, or user IDs in the keyring
+	GPGRecipients []string
+	// SignKey, if set, is the GPG key a detached signature of the backup is
+	// made with, stored at SignaturePath of it
+	SignKey string
+	// Dictionary, if set, is a zstd dictionary the plain dump is compressed
+	// with, giving small similar dumps far better ratios. It implies
+	// CompressionZstd.
+	Dictionary string
+	// Globals also takes the server's roles and tablespaces, stored at
+	// GlobalsPath of the dump
+	Globals bool
+	// TableDigests records the row count and digest of every table of a
+	// plain dump in its manifest, computed while the dump is compressed
+	TableDigests bool
+	// Tees receive a copy of the compressed dump while it is written
+	Tees []Tee
+	// OnTee, if set, is called with the outcome of each tee once the dump ends
+	OnTee func(TeeResult)
+	// OnDuplicate, if set, is called with the stored backup when NameByHash
+	// finds the dump identical to it and discards the new copy
+	OnDuplicate func(existing string)
 }
 
 type RestoreConfig struct {
@@ -16,6 +98,27 @@ type RestoreConfig struct {
 	DatabaseUser  string
 	BackupPath    string
 	DropExisting  bool
+	// Format is the dump format of BackupPath; empty detects it from the
+	// file extension. Custom and directory dumps are restored with pg_restore.
+	Format string
+	// Jobs is the number of parallel pg_restore jobs for custom and
+	// directory dumps
+	Jobs int
+	// SchemaOnly restores the schema of the dump and none of its data
+	SchemaOnly bool
+	// Globals is a globals file replayed before the dump, if set
+	Globals string
+	// MaxConnections, if set, caps the connections the restore opens, and
+	// pg_restore jobs are further cut to the slots the server has free, so
+	// a restore beside a live workload doesn't crowd it out
+	MaxConnections int
+	// BytesPerSecond, if set, paces the dump fed to psql or pg_restore to
+	// this rate, spreading its I/O out
+	BytesPerSecond int64
+	// ValidateOnly loads the dump into a scratch database in a single
+	// transaction that stops at the first error, then drops it, leaving
+	// DatabaseName untouched. Globals are not replayed.
+	ValidateOnly bool
 }
 
 type VerifyConfig struct {
@@ -23,4 +126,77 @@ type VerifyConfig struct {
 	TargetContainer string
 	DatabaseName    string
 	DatabaseUser    string
+	// Mode selects how databases are compared (checksum, rowcount, or sampled)
+	Mode string
+	// SamplePercent is the share of rows compared in sampled mode
+	SamplePercent int
+	// IgnoreTables lists schema.table names left out of the comparison
+	IgnoreTables []string
+	// DiffRows compares the tables that differ row by row, counting the
+	// differing rows and sampling their keys
+	DiffRows bool
+	// FailThreshold is how many differing rows are tolerated before the
+	// databases count as diverged; setting it implies DiffRows
+	FailThreshold int64
+	// MaxDuration bounds a rowcount or sampled run. Tables are then compared
+	// one at a time and recorded in ProgressFile, so a later run with the
+	// same file picks up where this one stopped.
+	MaxDuration  time.Duration
+	ProgressFile string
+}
+
+type StandbyConfig struct {
+	ContainerName string
+	DatabaseName  string
+	DatabaseUser  string
+	BackupDir     string
+	Interval      time.Duration
+	// Paused, if set, is checked before each sync; syncs are skipped while it returns true
+	Paused func() bool
+	// Blackouts are windows during which syncs are skipped
+	Blackouts schedule.Blackouts
+	// OnRestore, if set, is called after every restore attempt with its outcome
+	OnRestore func(path string, err error)
+	// StatePath, if set, records the backup last restored, so a restarted
+	// standby doesn't restore it again
+	StatePath string
+	// Once syncs a single time and returns its error, for a standby run on
+	// a schedule rather than in a loop
+	Once bool
+}
+
+type VerifyAllConfig struct {
+	SourceContainer string
+	TargetContainer string
+	DatabaseUser    string
+	Parallelism     int
+	Mode            string
+	SamplePercent   int
+	// IgnoreTables lists schema.table names left out of every comparison
+	IgnoreTables []string
+}
+
+type ExportConfig struct {
+	ContainerName string
+	DatabaseName  string
+	DatabaseUser  string
+	OutputDir     string
+	// ChunkSize is the maximum size of each chunk file in bytes
+	ChunkSize int64
+}
+
+type SynthesizeConfig struct {
+	ContainerName string
+	DatabaseName  string
+	DatabaseUser  string
+	// Rows is the number of rows generated for each table
+	Rows int
+}
+
+type SeedConfig struct {
+	ContainerName string
+	DatabaseName  string
+	DatabaseUser  string
+	OutputPath    string
+	Options       subset.Options
 }
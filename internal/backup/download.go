@@ -0,0 +1,205 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/resume"
+)
+
+// defaultStallTimeout is how long a download may go without receiving a
+// byte before the attempt is dropped and resumed
+const defaultStallTimeout = 2 * time.Minute
+
+// IsRemotePath reports whether a backup path is an HTTP(S) URL
+func IsRemotePath(p string) bool {
+	return strings.HasPrefix(p, "http://") || strings.HasPrefix(p, "https://")
+}
+
+// DownloadConfig describes a remote artifact to fetch before restoring
+type DownloadConfig struct {
+	URL     string
+	Headers http.Header
+	// SHA256 is the expected hex digest. When empty the "<url>.sha256"
+	// sidecar is consulted; if that doesn't exist either, the download is
+	// not verified.
+	SHA256 string
+	// Dir is where the downloaded file is written (the run's scratch
+	// directory if empty)
+	Dir string
+	// Retries is how many times an interrupted transfer is resumed from
+	// the last byte received (resume.DefaultRetries if zero, none if negative)
+	Retries int
+	// StallTimeout is how long an attempt may receive nothing, waiting for
+	// the response or in the body, before it counts as interrupted
+	// (defaultStallTimeout if zero)
+	StallTimeout time.Duration
+}
+
+// Download fetches a remote backup to a local temporary file and verifies its
+// checksum. An interrupted transfer resumes from the last byte received; the
+// restore itself only starts once the whole file is here and verified, so it
+// never sees a partial stream. The caller is responsible for removing the
+// returned file.
+func Download(cfg DownloadConfig) (string, bool, error) {
+	expected := strings.ToLower(strings.TrimSpace(cfg.SHA256))
+	if expected == "" {
+		sidecar, err := fetchSidecarChecksum(&http.Client{Timeout: 30 * time.Second}, cfg.URL+".sha256", cfg.Headers)
+		if err != nil {
+			return "", false, err
+		}
+		expected = sidecar
+	}
+
+	req, err := http.NewRequest(http.MethodGet, cfg.URL, nil)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid backup URL: %w", err)
+	}
+
+	dir := cfg.Dir
+	if dir == "" {
+		if dir, err = runScratchDir(); err != nil {
+			return "", false, err
+		}
+	}
+	out, err := os.CreateTemp(dir, "download-*-"+path.Base(req.URL.Path))
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create download file: %w", err)
+	}
+
+	retries := cfg.Retries
+	if retries == 0 {
+		retries = resume.DefaultRetries
+	}
+	stall := cfg.StallTimeout
+	if stall == 0 {
+		stall = defaultStallTimeout
+	}
+	h := sha256.New()
+	_, err = resume.Fetch(func(header http.Header) (*http.Response, error) {
+		ctx, cancel := context.WithCancel(context.Background())
+		w := &stallWatch{timeout: stall, cancel: cancel}
+		w.timer = time.AfterFunc(stall, w.fire)
+		attempt := req.Clone(ctx)
+		attempt.Header = cfg.Headers.Clone()
+		if attempt.Header == nil {
+			attempt.Header = http.Header{}
+		}
+		for k, v := range header {
+			attempt.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(attempt)
+		if err != nil {
+			w.stop()
+			return nil, w.wrap(err)
+		}
+		resp.Body = &stallReader{ReadCloser: resp.Body, watch: w}
+		return resp, nil
+	}, out, h, max(retries, 0))
+	if err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", false, fmt.Errorf("failed to download backup: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return "", false, fmt.Errorf("failed to write download file: %w", err)
+	}
+
+	if expected == "" {
+		return out.Name(), false, nil
+	}
+	if actual := fmt.Sprintf("%x", h.Sum(nil)); actual != expected {
+		os.Remove(out.Name())
+		return "", false, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", cfg.URL, expected, actual)
+	}
+	return out.Name(), true, nil
+}
+
+// stallWatch cancels a download attempt that has received nothing for
+// timeout
+type stallWatch struct {
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+	stalled atomic.Bool
+}
+
+func (w *stallWatch) fire() {
+	w.stalled.Store(true)
+	w.cancel()
+}
+
+func (w *stallWatch) stop() {
+	w.timer.Stop()
+	w.cancel()
+}
+
+// wrap words the error of a cancelled attempt as the stall it was
+func (w *stallWatch) wrap(err error) error {
+	if err != nil && w.stalled.Load() {
+		return fmt.Errorf("nothing received for %s: %w", w.timeout, err)
+	}
+	return err
+}
+
+// stallReader restarts its watch with every byte read
+type stallReader struct {
+	io.ReadCloser
+	watch *stallWatch
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.watch.timer.Reset(r.watch.timeout)
+	}
+	return n, r.watch.wrap(err)
+}
+
+func (r *stallReader) Close() error {
+	r.watch.stop()
+	return r.ReadCloser.Close()
+}
+
+// fetchSidecarChecksum reads a "<digest>  <name>" checksum file, returning
+// an empty digest if it doesn't exist
+func fetchSidecarChecksum(client *http.Client, url string, headers http.Header) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header = headers.Clone()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch checksum: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusForbidden:
+		return "", nil
+	default:
+		return "", fmt.Errorf("failed to fetch checksum: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", fmt.Errorf("failed to read checksum: %w", err)
+	}
+	fields := strings.Fields(string(body))
+	if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+		return "", fmt.Errorf("malformed checksum file at %s", url)
+	}
+	return strings.ToLower(fields[0]), nil
+}
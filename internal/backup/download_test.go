@@ -0,0 +1,107 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloadResumesAStalledTransfer(t *testing.T) {
+	data := bytes.Repeat([]byte("backup "), 4096)
+	var attempts atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".sha256") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		if attempts.Add(1) == 1 {
+			// Half the body, then nothing until the client gives up
+			w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+			w.Write(data[:len(data)/2])
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+			return
+		}
+		http.ServeContent(w, r, "app.sql.gz", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	path, verified, err := Download(DownloadConfig{
+		URL:          srv.URL + "/app.sql.gz",
+		SHA256:       fmt.Sprintf("%x", sha256.Sum256(data)),
+		Dir:          t.TempDir(),
+		StallTimeout: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified {
+		t.Error("download wasn't verified against --sha256")
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("downloaded %d bytes, want %d", len(got), len(data))
+	}
+	if n := attempts.Load(); n != 2 {
+		t.Errorf("took %d attempts, want 2", n)
+	}
+}
+
+func TestDownloadGivesUpOnAServerThatNeverAnswers(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	_, _, err := Download(DownloadConfig{
+		URL:          srv.URL + "/app.sql.gz",
+		SHA256:       strings.Repeat("0", 64),
+		Dir:          t.TempDir(),
+		Retries:      -1,
+		StallTimeout: 100 * time.Millisecond,
+	})
+	if err == nil || !strings.Contains(err.Error(), "nothing received for 100ms") {
+		t.Errorf("Download error = %v, want a stall", err)
+	}
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".sha256") {
+			fmt.Fprintf(w, "%s  app.sql.gz\n", strings.Repeat("ab", 32))
+			return
+		}
+		w.Write([]byte("tampered"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	_, _, err := Download(DownloadConfig{URL: srv.URL + "/app.sql.gz", Dir: dir})
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Download error = %v, want a checksum mismatch", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("left %d files behind", len(entries))
+	}
+}
@@ -0,0 +1,31 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/iostate/back-it-up/internal/dump"
+)
+
+// SchemaSummary dumps the live schema of a database and summarizes it in
+// the same form as a backup, so the two can be compared with dump.Compare
+func (s *Service) SchemaSummary(containerName, dbName, dbUser string) (*dump.Summary, error) {
+	if err := s.dockerSvc.VerifyContainer(containerName); err != nil {
+		return nil, s.fail(fmt.Errorf("container verification failed: %w", err))
+	}
+
+	var schema bytes.Buffer
+	if err := s.pgDump(Config{
+		ContainerName: containerName,
+		DatabaseName:  dbName,
+		DatabaseUser:  dbUser,
+	}, &schema, "--schema-only"); err != nil {
+		return nil, s.fail(err)
+	}
+
+	sum, err := dump.Summarize(&schema)
+	if err != nil {
+		return nil, s.fail(fmt.Errorf("failed to read live schema: %w", err))
+	}
+	return sum, nil
+}
@@ -0,0 +1,111 @@
+package backup
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// Phase identifies a stage of a backup, restore, or verify run
+type Phase string
+
+const (
+	PhaseDump     Phase = "dump"
+	PhaseDrop     Phase = "drop"
+	PhaseCreate   Phase = "create"
+	PhaseRestore  Phase = "restore"
+	PhaseRefresh  Phase = "refresh"
+	PhaseChecksum Phase = "checksum"
+)
+
+// Events receives progress notifications from the Service so embedders can
+// drive their own UI and logging. Callbacks run on the goroutine doing the
+// work and should return quickly.
+type Events interface {
+	// OnPhase is called when a new phase starts
+	OnPhase(phase Phase)
+	// OnBytes is called as uncompressed SQL flows through a backup or restore
+	OnBytes(n int64)
+	// OnTableDone is called after the data of a table has been dumped or restored
+	OnTableDone(table string)
+	// OnError is called with any error before it is returned
+	OnError(err error)
+}
+
+// NopEvents ignores every event. Embed it to implement only some callbacks.
+type NopEvents struct{}
+
+func (NopEvents) OnPhase(Phase)      {}
+func (NopEvents) OnBytes(int64)      {}
+func (NopEvents) OnTableDone(string) {}
+func (NopEvents) OnError(error)      {}
+
+// SetEvents registers the receiver for progress events. Passing nil disables them.
+func (s *Service) SetEvents(events Events) {
+	if events == nil {
+		events = NopEvents{}
+	}
+	s.events = events
+}
+
+// fail reports err to the events receiver and returns it unchanged
+func (s *Service) fail(err error) error {
+	if err != nil {
+		s.events.OnError(err)
+	}
+	return err
+}
+
+// progressWriter reports the bytes written through it and the end of each
+// table's COPY data as the SQL stream passes by
+type progressWriter struct {
+	w       io.Writer
+	events  Events
+	partial []byte
+	table   string
+}
+
+func newProgressWriter(w io.Writer, events Events) *progressWriter {
+	return &progressWriter{w: w, events: events}
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	if n > 0 {
+		p.events.OnBytes(int64(n))
+		p.scan(b[:n])
+	}
+	return n, err
+}
+
+// scan tracks COPY blocks line by line, carrying partial lines between writes
+func (p *progressWriter) scan(b []byte) {
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			// Only the start of a line matters, so cap how much is buffered
+			p.partial = append(p.partial, b[:min(len(b), 256-len(p.partial))]...)
+			return
+		}
+
+		line := b[:i]
+		if len(p.partial) > 0 {
+			line = append(p.partial, line...)
+			p.partial = p.partial[:0]
+		}
+		p.line(string(line))
+		b = b[i+1:]
+	}
+}
+
+func (p *progressWriter) line(line string) {
+	switch {
+	case p.table != "" && line == `\.`:
+		p.events.OnTableDone(p.table)
+		p.table = ""
+	case p.table == "" && strings.HasPrefix(line, "COPY ") && strings.HasSuffix(line, "FROM stdin;"):
+		if fields := strings.Fields(line); len(fields) > 1 {
+			p.table = fields[1]
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package backup
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iostate/back-it-up/internal/fault"
+)
+
+// ExportManifestSuffix names the pointer manifest written next to export chunks
+const ExportManifestSuffix = ".manifest.json"
+
+// DefaultChunkSize keeps export chunks under common hosting file size limits
+const DefaultChunkSize = 50 << 20
+
+// ExportManifest describes an export: the chunks that make up the
+// compressed dump, in order, and their checksums. It carries no timestamps
+// so identical databases produce byte-identical exports.
+type ExportManifest struct {
+	Format   int           `json:"format"`
+	Database string        `json:"database"`
+	Size     int64         `json:"size"`
+	Checksum string        `json:"sha256"`
+	Chunks   []ExportChunk `json:"chunks"`
+}
+
+// ExportChunk is one piece of an exported dump
+type ExportChunk struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"sha256"`
+}
+
+// Export writes a reproducible, chunked dump of cfg.DatabaseName to
+// cfg.OutputDir as {database}.sql.gz.000, .001, ... plus a
+// {database}.manifest.json pointer file. Re-exporting an unchanged database
+// rewrites the same bytes, so the output can be committed to Git LFS or DVC.
+func (s *Service) Export(cfg ExportConfig) (string, *ExportManifest, error) {
+	manifestPath, manifest, err := s.export(cfg)
+	if err != nil {
+		return "", nil, s.fail(err)
+	}
+	return manifestPath, manifest, nil
+}
+
+func (s *Service) export(cfg ExportConfig) (string, *ExportManifest, error) {
+	if err := fault.Inject(fault.StageDump); err != nil {
+		return "", nil, err
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = DefaultChunkSize
+	}
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		return "", nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	args, err := s.reproducibleDumpArgs(cfg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	chunks := &chunkWriter{dir: cfg.OutputDir, prefix: cfg.DatabaseName + ".sql.gz.", limit: cfg.ChunkSize, total: sha256.New()}
+	defer chunks.abort()
+
+	// gzip.NewWriter leaves the header's name and mtime empty, so the
+	// compressed bytes only depend on the dump
+	gzWriter := gzip.NewWriter(chunks)
+	s.events.OnPhase(PhaseDump)
+	if err := s.pgDump(Config{
+		ContainerName: cfg.ContainerName,
+		DatabaseName:  cfg.DatabaseName,
+		DatabaseUser:  cfg.DatabaseUser,
+	}, gzWriter, args...); err != nil {
+		return "", nil, err
+	}
+	if err := gzWriter.Close(); err != nil {
+		return "", nil, fmt.Errorf("failed to write export: %w", err)
+	}
+	if err := chunks.finish(); err != nil {
+		return "", nil, err
+	}
+
+	manifest := &ExportManifest{
+		Format:   1,
+		Database: cfg.DatabaseName,
+		Size:     chunks.size,
+		Checksum: fmt.Sprintf("%x", chunks.total.Sum(nil)),
+		Chunks:   chunks.done,
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	manifestPath := filepath.Join(cfg.OutputDir, cfg.DatabaseName+ExportManifestSuffix)
+	tmp := manifestPath + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return "", nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := os.Rename(tmp, manifestPath); err != nil {
+		return "", nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err := removeStaleChunks(cfg.OutputDir, chunks.prefix, len(chunks.done)); err != nil {
+		return "", nil, err
+	}
+	return manifestPath, manifest, nil
+}
+
+// reproducibleDumpArgs pins pg_dump's \restrict key, which newer versions
+// otherwise randomize on every run
+func (s *Service) reproducibleDumpArgs(cfg ExportConfig) ([]string, error) {
+	output, err := s.dockerSvc.Exec(cfg.ContainerName, []string{"pg_dump", "--help"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to run pg_dump: %w\nOutput: %s", err, string(output))
+	}
+	if !strings.Contains(string(output), "--restrict-key") {
+		return nil, nil
+	}
+	key := sha256.Sum256([]byte("back-it-up export " + cfg.DatabaseName))
+	return []string{fmt.Sprintf("--restrict-key=%x", key[:16])}, nil
+}
+
+// chunkWriter splits a stream into fixed-size files. Chunks are written as
+// .partial files and only renamed into place by finish.
+type chunkWriter struct {
+	dir    string
+	prefix string
+	limit  int64
+	total  hash.Hash
+	size   int64
+
+	file    *os.File
+	written int64
+	hash    hash.Hash
+	done    []ExportChunk
+	partial []string
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if w.file == nil {
+			if err := w.open(); err != nil {
+				return n, err
+			}
+		}
+		part := p
+		if room := w.limit - w.written; int64(len(part)) > room {
+			part = part[:room]
+		}
+		m, err := io.MultiWriter(w.file, w.hash, w.total).Write(part)
+		n += m
+		w.written += int64(m)
+		w.size += int64(m)
+		if err != nil {
+			return n, fmt.Errorf("failed to write export chunk: %w", err)
+		}
+		p = p[m:]
+		if w.written == w.limit {
+			if err := w.closeChunk(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (w *chunkWriter) open() error {
+	name := fmt.Sprintf("%s%03d", w.prefix, len(w.done))
+	f, err := os.Create(filepath.Join(w.dir, name+".partial"))
+	if err != nil {
+		return fmt.Errorf("failed to create export chunk: %w", err)
+	}
+	w.file, w.written, w.hash = f, 0, sha256.New()
+	w.partial = append(w.partial, f.Name())
+	return nil
+}
+
+func (w *chunkWriter) closeChunk() error {
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("failed to write export chunk: %w", err)
+	}
+	w.done = append(w.done, ExportChunk{
+		Name:     strings.TrimSuffix(filepath.Base(w.file.Name()), ".partial"),
+		Size:     w.written,
+		Checksum: fmt.Sprintf("%x", w.hash.Sum(nil)),
+	})
+	w.file = nil
+	return nil
+}
+
+// finish closes the last chunk and moves every chunk into place
+func (w *chunkWriter) finish() error {
+	if w.file != nil {
+		if err := w.closeChunk(); err != nil {
+			return err
+		}
+	}
+	for _, partial := range w.partial {
+		if err := os.Rename(partial, strings.TrimSuffix(partial, ".partial")); err != nil {
+			return fmt.Errorf("failed to write export chunk: %w", err)
+		}
+	}
+	w.partial = nil
+	return nil
+}
+
+// abort removes chunks that were never moved into place
+func (w *chunkWriter) abort() {
+	if w.file != nil {
+		w.file.Close()
+	}
+	for _, partial := range w.partial {
+		os.Remove(partial)
+	}
+}
+
+// removeStaleChunks deletes chunks left over from a previous, larger export
+func removeStaleChunks(dir, prefix string, keep int) error {
+	matches, err := filepath.Glob(filepath.Join(dir, prefix+"[0-9][0-9][0-9]"))
+	if err != nil {
+		return err
+	}
+	for _, match := range matches {
+		var index int
+		if _, err := fmt.Sscanf(strings.TrimPrefix(filepath.Base(match), prefix), "%d", &index); err != nil || index < keep {
+			continue
+		}
+		if err := os.Remove(match); err != nil {
+			return fmt.Errorf("failed to remove stale chunk: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReadExportManifest loads an export manifest
+func ReadExportManifest(path string) (*ExportManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var manifest ExportManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	if manifest.Format != 1 {
+		return nil, fmt.Errorf("unsupported export manifest format %d", manifest.Format)
+	}
+	return &manifest, nil
+}
+
+// openExport verifies every chunk listed in a manifest and returns a reader
+// over the reassembled compressed dump
+func openExport(manifestPath string) (io.ReadCloser, error) {
+	manifest, err := ReadExportManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(manifestPath)
+	var files multiFile
+	var readers []io.Reader
+	for _, chunk := range manifest.Chunks {
+		path := filepath.Join(dir, filepath.Base(chunk.Name))
+		sum, err := FileChecksum(path)
+		if err != nil {
+			files.Close()
+			return nil, fmt.Errorf("failed to read export chunk: %w", err)
+		}
+		if sum != chunk.Checksum {
+			files.Close()
+			return nil, fmt.Errorf("export chunk %s is corrupt: expected sha256 %s, got %s (is it a Git LFS pointer that hasn't been pulled?)", chunk.Name, chunk.Checksum, sum)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			files.Close()
+			return nil, fmt.Errorf("failed to open export chunk: %w", err)
+		}
+		files = append(files, f)
+		readers = append(readers, f)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(readers...), files}, nil
+}
+
+type multiFile []*os.File
+
+func (m multiFile) Close() error {
+	var first error
+	for _, f := range m {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
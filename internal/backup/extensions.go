@@ -0,0 +1,84 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Extension is an extension installed in a database
+type Extension struct {
+	Name string
+	// Installed is the version the database runs, and Available the
+	// server's default version, which ALTER EXTENSION ... UPDATE moves it
+	// to; it's empty when the server no longer ships the extension
+	Installed, Available string
+}
+
+// Outdated reports whether the server ships a newer version than the
+// database runs
+func (e Extension) Outdated() bool {
+	return e.Available != "" && e.Installed != e.Available
+}
+
+const extensionsQuery = `SELECT e.extname, e.extversion, coalesce(a.default_version, '')
+  FROM pg_extension e
+  LEFT JOIN pg_available_extensions a ON a.name = e.extname
+ ORDER BY 1;`
+
+// Extensions returns the extensions installed in a database with the
+// versions the server could update them to
+func (s *Service) Extensions(containerName, dbName, dbUser string) ([]Extension, error) {
+	output, err := s.dockerSvc.Exec(containerName, []string{
+		"psql", "-U", dbUser, "-d", dbName, "-tA", "-F", "\t", "-c", extensionsQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list extensions: %w\nOutput: %s", err, string(output))
+	}
+	var extensions []Extension
+	// The last field is empty for extensions the server no longer ships, so
+	// only line ends are trimmed
+	for _, line := range strings.Split(strings.TrimRight(string(output), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("failed to list extensions: unexpected output %q", line)
+		}
+		extensions = append(extensions, Extension{Name: fields[0], Installed: fields[1], Available: fields[2]})
+	}
+	return extensions, nil
+}
+
+// extensionVersions returns the version of each extension in a database
+// for its backup's manifest, or nil if they can't be listed
+func (s *Service) extensionVersions(containerName, dbName, dbUser string) map[string]string {
+	extensions, err := s.Extensions(containerName, dbName, dbUser)
+	if err != nil || len(extensions) == 0 {
+		return nil
+	}
+	versions := make(map[string]string, len(extensions))
+	for _, e := range extensions {
+		versions[e.Name] = e.Installed
+	}
+	return versions
+}
+
+// UpdateExtensions runs ALTER EXTENSION ... UPDATE for each extension, in
+// one transaction, moving it to the server's default version
+func (s *Service) UpdateExtensions(containerName, dbName, dbUser string, extensions []Extension) error {
+	if len(extensions) == 0 {
+		return nil
+	}
+	statements := make([]string, len(extensions))
+	for i, e := range extensions {
+		statements[i] = fmt.Sprintf(`ALTER EXTENSION "%s" UPDATE;`, strings.ReplaceAll(e.Name, `"`, `""`))
+	}
+	output, err := s.dockerSvc.Exec(containerName, []string{
+		"psql", "-U", dbUser, "-d", dbName, "--set", "ON_ERROR_STOP=1", "-c", strings.Join(statements, " "),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update extensions: %w\nOutput: %s", err, string(output))
+	}
+	return nil
+}
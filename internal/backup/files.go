@@ -0,0 +1,339 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupTimestampLayout is the timestamp format embedded in backup filenames
+const backupTimestampLayout = "2006_01_02_15_04_05"
+
+// File extensions of the dump formats
+const (
+	plainExtension     = ".sql.gz"
+	customExtension    = ".dump"
+	directoryExtension = ".dir.tar.gz"
+)
+
+// formatExtension returns the file extension of a dump format
+func formatExtension(format string) (string, error) {
+	switch format {
+	case "", FormatPlain:
+		return plainExtension, nil
+	case FormatCustom:
+		return customExtension, nil
+	case FormatDirectory:
+		return directoryExtension, nil
+	default:
+		return "", fmt.Errorf("unknown dump format %q (expected %s, %s or %s)", format, FormatPlain, FormatCustom, FormatDirectory)
+	}
+}
+
+// DumpFormat returns the format of the dump at path, judged by its extension
+func DumpFormat(path string) string {
+	path = strings.TrimSuffix(strings.TrimSuffix(path, ageExtension), gpgExtension)
+	switch {
+	case strings.HasSuffix(path, customExtension):
+		return FormatCustom
+	case strings.HasSuffix(path, directoryExtension):
+		return FormatDirectory
+	default:
+		return FormatPlain
+	}
+}
+
+// contentExtension returns the infix marking a partial dump, e.g. the
+// ".schema" of "app_<timestamp>.schema.sql.gz"
+func contentExtension(content string) (string, error) {
+	switch content {
+	case "":
+		return "", nil
+	case ContentSchema, ContentData:
+		return "." + content, nil
+	default:
+		return "", fmt.Errorf("unknown dump content %q (expected %s or %s)", content, ContentSchema, ContentData)
+	}
+}
+
+// DumpContent returns ContentSchema or ContentData if the dump at path holds
+// only part of a database, judged by its filename, and "" otherwise
+func DumpContent(path string) string {
+	_, ext, _ := cutBackupExtension(filepath.Base(path))
+	for _, content := range []string{ContentSchema, ContentData} {
+		if strings.HasPrefix(ext, "."+content+".") {
+			return content
+		}
+	}
+	return ""
+}
+
+// backupExtensions lists the extensions of every dump format and
+// compression
+func backupExtensions() []string {
+	exts := []string{customExtension, directoryExtension}
+	for _, c := range compressors {
+		exts = append(exts, c.extension)
+	}
+	return exts
+}
+
+// cutBackupExtension strips a dump format's extension, along with any
+// content infix and encryption suffix, from filename
+func cutBackupExtension(filename string) (base, ext string, ok bool) {
+	for _, encryption := range []string{ageExtension, gpgExtension} {
+		if plain, encrypted := strings.CutSuffix(filename, encryption); encrypted {
+			if base, ext, ok := cutBackupExtension(plain); ok {
+				return base, ext + encryption, true
+			}
+			return filename, "", false
+		}
+	}
+	for _, ext := range backupExtensions() {
+		if base, ok := strings.CutSuffix(filename, ext); ok {
+			for _, content := range []string{ContentSchema, ContentData} {
+				if b, ok := strings.CutSuffix(base, "."+content); ok {
+					return b, "." + content + ext, true
+				}
+			}
+			return base, ext, true
+		}
+	}
+	return filename, "", false
+}
+
+// BackupFile describes a backup artifact found on disk
+type BackupFile struct {
+	Path         string
+	DatabaseName string
+	Timestamp    time.Time
+	Size         int64
+}
+
+// ListBackups returns the backups of dbName in dir, oldest first. An empty
+// dbName matches every database.
+func ListBackups(dir, dbName string) ([]BackupFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var backups []BackupFile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		name, ts, ok := ParseBackupFilename(path)
+		if !ok || (dbName != "" && name != dbName) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", entry.Name(), err)
+		}
+		backups = append(backups, BackupFile{
+			Path:         path,
+			DatabaseName: name,
+			Timestamp:    ts,
+			Size:         info.Size(),
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Timestamp.Before(backups[j].Timestamp)
+	})
+	return backups, nil
+}
+
+// LatestBackup returns the newest full backup of dbName in dir, judged by
+// the timestamp ParseBackupFilename finds. Schema-only and data-only dumps
+// are passed over.
+func LatestBackup(dir, dbName string) (string, time.Time, error) {
+	backups, err := ListBackups(dir, dbName)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	for i := len(backups) - 1; i >= 0; i-- {
+		if DumpContent(backups[i].Path) == "" {
+			return backups[i].Path, backups[i].Timestamp, nil
+		}
+	}
+	return "", time.Time{}, fmt.Errorf("no backups of database '%s' found in %s", dbName, dir)
+}
+
+// ParseBackupFilename returns the database and time of the backup at path,
+// from its {database}_{timestamp} name or, if hash-named, its manifest
+func ParseBackupFilename(path string) (string, time.Time, bool) {
+	base, _, ok := cutBackupExtension(filepath.Base(path))
+	if ok && isContentHash(base) {
+		return hashNamedBackup(path)
+	}
+	if !ok || len(base) < len(backupTimestampLayout)+2 {
+		return "", time.Time{}, false
+	}
+
+	split := len(base) - len(backupTimestampLayout)
+	if base[split-1] != '_' {
+		return "", time.Time{}, false
+	}
+
+	ts, err := time.ParseInLocation(backupTimestampLayout, base[split:], time.Local)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return base[:split-1], ts, true
+}
+
+// hashNamedBackup returns the database and time of a --name-by-hash backup
+// from its manifest, or its modification time for an unknown database if
+// the manifest is missing
+func hashNamedBackup(path string) (string, time.Time, bool) {
+	if m, err := ReadManifest(path); err == nil && m != nil {
+		return m.DatabaseName, m.StartedAt, true
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return "", info.ModTime(), true
+}
+
+// isContentHash reports whether name is the hex SHA-256 a --name-by-hash
+// backup is named with
+func isContentHash(name string) bool {
+	if len(name) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// FileChecksum returns the hex-encoded SHA-256 of a file, or of an object in
+// a store
+func FileChecksum(path string) (string, error) {
+	f, err := openRaw(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// OpenBackup opens a backup file, or an export manifest, and returns a reader
+// over its decrypted, decompressed SQL. Encryption and compression are
+// detected from the file's magic bytes.
+func OpenBackup(path string) (io.ReadCloser, error) {
+	if format := DumpFormat(path); format != FormatPlain {
+		return nil, fmt.Errorf("%s is a %s-format dump, not an SQL script", path, format)
+	}
+
+	if isBackupManifest(path) {
+		backupPath := strings.TrimSuffix(path, manifestExtension)
+		return nil, fmt.Errorf("%s is the manifest of %s; open the backup itself", path, backupPath)
+	}
+
+	var f io.ReadCloser
+	var err error
+	if strings.HasSuffix(path, ExportManifestSuffix) {
+		if f, err = openExport(path); err != nil {
+			return nil, fmt.Errorf("failed to open backup file: %w", err)
+		}
+	} else if f, err = openDecrypted(path); err != nil {
+		return nil, err
+	}
+
+	buffered, header := peekHeader(f)
+	decompressed, err := detectCompressor(header).newReader(buffered, path, header)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &backupReader{Reader: decompressed, closers: []io.Closer{decompressed, f}}, nil
+}
+
+// ReadBackup reads the backup at path to the end, decrypting it and, for
+// plain dumps, decompressing it, and returns how many bytes came out. It
+// fails on a truncated or corrupted file.
+func ReadBackup(path string) (int64, error) {
+	var r io.ReadCloser
+	var err error
+	if DumpFormat(path) == FormatPlain {
+		r, err = OpenBackup(path)
+	} else {
+		r, err = openDecrypted(path)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	n, err := io.Copy(io.Discard, r)
+	if err != nil {
+		return n, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return n, nil
+}
+
+// backupReader reads the innermost of a stack of streams over a file
+type backupReader struct {
+	io.Reader
+	// closers are closed outermost first, ending with the file
+	closers []io.Closer
+}
+
+func (r *backupReader) Close() error {
+	var err error
+	for _, c := range r.closers {
+		err = c.Close()
+	}
+	return err
+}
+
+// renameByHash moves a finished backup to a name derived from sum, its
+// content hash. If an identical artifact already exists, the new copy is
+// discarded and the existing path is returned, reported as a duplicate.
+func renameByHash(path, sum string) (string, bool, error) {
+	_, ext, _ := cutBackupExtension(path)
+	hashed := filepath.Join(filepath.Dir(path), sum+ext)
+	if _, err := os.Stat(hashed); err == nil {
+		fmt.Printf("Identical backup already stored as %s\n", hashed)
+		if err := os.Remove(path); err != nil {
+			return "", false, fmt.Errorf("failed to remove duplicate backup: %w", err)
+		}
+		return hashed, true, nil
+	}
+
+	if err := os.Rename(path, hashed); err != nil {
+		return "", false, fmt.Errorf("failed to rename backup: %w", err)
+	}
+	return hashed, false, nil
+}
+
+// VerifyContentAddress checks that a hash-named artifact still matches its
+// name. Artifacts that aren't hash-named are reported as not applicable.
+func VerifyContentAddress(path string) (applicable bool, err error) {
+	name, _, ok := cutBackupExtension(filepath.Base(path))
+	if !ok || !isContentHash(name) {
+		return false, nil
+	}
+
+	sum, err := FileChecksum(path)
+	if err != nil {
+		return true, fmt.Errorf("failed to checksum %s: %w", path, err)
+	}
+	if sum != name {
+		return true, fmt.Errorf("%s has been modified: content hash is %s", path, sum)
+	}
+	return true, nil
+}
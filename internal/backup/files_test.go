@@ -0,0 +1,89 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBackupFilename(t *testing.T) {
+	dir := t.TempDir()
+	hashed := strings.Repeat("ab", 32)
+	started := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.WriteFile(filepath.Join(dir, hashed+".sql.gz"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeManifest(filepath.Join(dir, hashed+".sql.gz"), &Manifest{DatabaseName: "app", StartedAt: started}); err != nil {
+		t.Fatal(err)
+	}
+	bare := strings.Repeat("cd", 32) + ".dump"
+	mtime := time.Date(2024, 6, 7, 8, 9, 10, 0, time.UTC)
+	if err := os.WriteFile(filepath.Join(dir, bare), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(dir, bare), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	local := time.Date(2025, 1, 2, 3, 4, 5, 0, time.Local)
+
+	tests := []struct {
+		name     string
+		file     string
+		database string
+		time     time.Time
+		ok       bool
+	}{
+		{"plain", "app_2025_01_02_03_04_05.sql.gz", "app", local, true},
+		{"underscores in the database", "my_app_2025_01_02_03_04_05.sql.gz", "my_app", local, true},
+		{"custom format", "app_2025_01_02_03_04_05.dump", "app", local, true},
+		{"directory format", "app_2025_01_02_03_04_05.dir.tar.gz", "app", local, true},
+		{"schema only", "app_2025_01_02_03_04_05.schema.sql.gz", "app", local, true},
+		{"encrypted", "app_2025_01_02_03_04_05.sql.gz.age", "app", local, true},
+		{"hash-named with a manifest", hashed + ".sql.gz", "app", started, true},
+		{"hash-named without one", bare, "", mtime, true},
+		{"checksum sidecar", "app_2025_01_02_03_04_05.sql.gz.sha256", "", time.Time{}, false},
+		{"manifest", hashed + ".sql.gz.manifest.json", "", time.Time{}, false},
+		{"no timestamp", "app.sql.gz", "", time.Time{}, false},
+		{"bad timestamp", "app_2025_13_02_03_04_05.sql.gz", "", time.Time{}, false},
+		{"not hex", strings.Repeat("zz", 32) + ".sql.gz", "", time.Time{}, false},
+		{"hash-named but missing", strings.Repeat("ef", 32) + ".sql.gz", "", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database, ts, ok := ParseBackupFilename(filepath.Join(dir, tt.file))
+			if ok != tt.ok || database != tt.database || !ts.Equal(tt.time) {
+				t.Errorf("ParseBackupFilename(%q) = %q, %v, %v; want %q, %v, %v", tt.file, database, ts, ok, tt.database, tt.time, tt.ok)
+			}
+		})
+	}
+}
+
+func TestListBackupsSeesHashNamedBackups(t *testing.T) {
+	dir := t.TempDir()
+	hashed := strings.Repeat("ab", 32) + ".sql.gz"
+	for _, name := range []string{"app_2025_01_01_00_00_00.sql.gz", hashed, "other_2025_01_03_00_00_00.sql.gz"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeManifest(filepath.Join(dir, hashed), &Manifest{DatabaseName: "app", StartedAt: time.Date(2025, 1, 2, 0, 0, 0, 0, time.Local)}); err != nil {
+		t.Fatal(err)
+	}
+
+	path, _, err := LatestBackup(dir, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(path) != hashed {
+		t.Errorf("LatestBackup = %s, want %s", path, hashed)
+	}
+	backups, err := ListBackups(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 3 {
+		t.Errorf("ListBackups found %d backups, want 3", len(backups))
+	}
+}
@@ -0,0 +1,116 @@
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/iostate/back-it-up/internal/subset"
+)
+
+// globalsExtension marks the roles and tablespaces taken alongside a dump
+const globalsExtension = ".globals.sql.gz"
+
+// GlobalsPath returns where the globals taken with the dump at path are
+// stored: next to it, e.g. app_<timestamp>.globals.sql.gz for
+// app_<timestamp>.sql.gz. The globals of an encrypted dump are encrypted too.
+func GlobalsPath(path string) string {
+	base, ext, _ := cutBackupExtension(filepath.Base(path))
+	globals := base + globalsExtension
+	for _, encrypted := range []string{ageExtension, gpgExtension} {
+		if strings.HasSuffix(ext, encrypted) {
+			globals += encrypted
+		}
+	}
+	// Replace just the name, keeping an s3:// location's double slash
+	return strings.TrimSuffix(path, filepath.Base(path)) + globals
+}
+
+// dumpGlobals writes the cluster's roles and tablespaces (pg_dumpall
+// --globals-only) next to the dump at dumpPath, encrypted like the dump; a
+// database restored into a fresh server needs them before its objects can
+// be owned and granted
+func (s *Service) dumpGlobals(cfg Config, dumpPath string) (string, error) {
+	path := GlobalsPath(dumpPath)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create globals file: %w", err)
+	}
+	defer f.Close()
+
+	var w io.WriteCloser = nopWriteCloser{f}
+	encryptor, err := newEncryptor(f, cfg)
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", err
+	}
+	if encryptor != nil {
+		w = encryptor
+		defer w.Close()
+	}
+	gzWriter := gzip.NewWriter(w)
+	err = s.stream(cfg.ContainerName, gzWriter, "pg_dumpall", "-U", cfg.DatabaseUser, "--globals-only")
+	if err == nil {
+		if err = gzWriter.Close(); err != nil {
+			err = fmt.Errorf("failed to write globals: %w", err)
+		}
+	}
+	if err == nil {
+		if err = w.Close(); err != nil {
+			err = fmt.Errorf("failed to encrypt globals: %w", err)
+		}
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// replayGlobals runs a globals file against the server. Roles that already
+// exist are reported by psql and left as they are; the rest of the file is
+// still applied. The role the restore connects as is skipped, so the
+// source's password for it doesn't replace the target's.
+func (s *Service) replayGlobals(containerName, dbUser, path string) error {
+	r, err := OpenBackup(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	script := withoutRole(r, dbUser)
+	defer script.Close()
+	return s.feed(containerName, script, "psql", "-U", dbUser, "-d", "template1")
+}
+
+// withoutRole drops the CREATE ROLE and ALTER ROLE lines pg_dumpall writes
+// for role
+func withoutRole(r io.Reader, role string) io.ReadCloser {
+	var prefixes []string
+	for _, name := range []string{role, subset.QuoteIdent(role)} {
+		prefixes = append(prefixes, "CREATE ROLE "+name+";", "ALTER ROLE "+name+" ")
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if slices.ContainsFunc(prefixes, func(p string) bool { return strings.HasPrefix(line, p) }) {
+				continue
+			}
+			if _, err := io.WriteString(pw, line+"\n"); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(scanner.Err())
+	}()
+	return pr
+}
@@ -0,0 +1,191 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// gpgExtension marks a backup encrypted with GPG, as in
+// app_<timestamp>.sql.gz.gpg
+const gpgExtension = ".gpg"
+
+// signatureExtension marks the detached GPG signature stored next to a
+// signed backup
+const signatureExtension = ".sig"
+
+// gpgArmorMagic starts an ASCII-armored OpenPGP message
+var gpgArmorMagic = []byte("-----BEGIN PGP MESSAGE-----")
+
+// isGPGEncrypted reports whether a file starting with header is an OpenPGP
+// message encrypted to a public key or a passphrase. Binary messages start
+// with the tag of their session key packet, in the old or new format.
+func isGPGEncrypted(header []byte) bool {
+	if bytes.HasPrefix(header, gpgArmorMagic) {
+		return true
+	}
+	if len(header) == 0 {
+		return false
+	}
+	switch header[0] {
+	case 0x84, 0x85, 0x86, 0xc1, 0x8c, 0x8d, 0xc3:
+		return true
+	}
+	return false
+}
+
+func gpgTool() (string, error) {
+	path, err := exec.LookPath("gpg")
+	if err != nil {
+		return "", fmt.Errorf("gpg not found on PATH; install GnuPG to encrypt, decrypt, or sign backups")
+	}
+	return path, nil
+}
+
+// newGPGWriter encrypts what is written to it into w for recipients, each a
+// key ID, fingerprint, or user ID in the keyring
+func newGPGWriter(w io.Writer, recipients []string) (io.WriteCloser, error) {
+	tool, err := gpgTool()
+	if err != nil {
+		return nil, err
+	}
+	// The recipients are named explicitly, so don't also ask for them to be
+	// certified in the web of trust, which batch mode can't prompt for
+	args := []string{"--batch", "--quiet", "--trust-model", "always", "--encrypt"}
+	for _, recipient := range recipients {
+		args = append(args, "--recipient", recipient)
+	}
+	encryptor, err := startToolWriter(w, tool, args...)
+	if err != nil {
+		return nil, err
+	}
+	return encryptor, nil
+}
+
+// newGPGReader decrypts r with the secret keys in the keyring, through
+// gpg-agent if they are protected
+func newGPGReader(r io.Reader) (io.ReadCloser, error) {
+	tool, err := gpgTool()
+	if err != nil {
+		return nil, err
+	}
+	decryptor, err := startToolReader(r, tool, "--batch", "--quiet", "--decrypt")
+	if err != nil {
+		return nil, err
+	}
+	return decryptor, nil
+}
+
+// SignaturePath returns where the detached signature of the backup at path
+// is stored
+func SignaturePath(path string) string {
+	return path + signatureExtension
+}
+
+// SignFile writes a detached GPG signature of the file at path, made with
+// key, to SignaturePath(path)
+func SignFile(path, key string) (string, error) {
+	tool, err := gpgTool()
+	if err != nil {
+		return "", err
+	}
+	sigPath := SignaturePath(path)
+	cmd := exec.Command(tool, "--batch", "--yes", "--quiet", "--local-user", key, "--detach-sign", "--output", sigPath, path)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(sigPath)
+		return "", fmt.Errorf("failed to sign %s: %w\nError output: %s", path, err, strings.TrimSpace(string(output)))
+	}
+	return sigPath, nil
+}
+
+// CheckSignature validates the detached signature of the backup at path
+// against the keyring, if there is one. With keys, each a fingerprint, key
+// ID, or user ID, the signature must be made by one of them; without, any
+// key in the keyring passes. It returns the signer's fingerprint, or "" for
+// an unsigned backup, which is an error only if require is set.
+func CheckSignature(path string, require bool, keys []string) (string, error) {
+	sigPath := SignaturePath(path)
+	if _, err := os.Stat(sigPath); err != nil {
+		if require {
+			return "", fmt.Errorf("%s has no signature (expected %s)", path, sigPath)
+		}
+		return "", nil
+	}
+	tool, err := gpgTool()
+	if err != nil {
+		return "", err
+	}
+	var status, stderr bytes.Buffer
+	cmd := exec.Command(tool, "--batch", "--quiet", "--status-fd", "1", "--verify", sigPath, path)
+	cmd.Stdout = &status
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("signature of %s doesn't validate: %w\nError output: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	signer, primary := validSignature(status.String())
+	if signer == "" {
+		return "", fmt.Errorf("signature of %s doesn't validate: gpg reported no valid signature", path)
+	}
+	if len(keys) == 0 {
+		return signer, nil
+	}
+	for _, key := range keys {
+		fingerprints, err := keyFingerprints(tool, key)
+		if err != nil {
+			return "", err
+		}
+		for _, fpr := range fingerprints {
+			if fpr == signer || fpr == primary {
+				return signer, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%s is signed by %s, which isn't %s", path, signer, strings.Join(keys, " or "))
+}
+
+// validSignature returns the fingerprints of the subkey that made a good
+// signature and of its primary key, from the VALIDSIG line gpg writes to
+// --status-fd, or "" if there is none
+func validSignature(status string) (signer, primary string) {
+	for _, line := range strings.Split(status, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "[GNUPG:]" || fields[1] != "VALIDSIG" {
+			continue
+		}
+		signer, primary = strings.ToUpper(fields[2]), strings.ToUpper(fields[2])
+		if len(fields) >= 12 {
+			primary = strings.ToUpper(fields[11])
+		}
+		return signer, primary
+	}
+	return "", ""
+}
+
+// keyFingerprints returns the fingerprints of key and its subkeys. A full
+// fingerprint is taken as given; anything else is looked up in the keyring.
+func keyFingerprints(tool, key string) ([]string, error) {
+	fpr := strings.ToUpper(strings.ReplaceAll(strings.TrimPrefix(key, "0x"), " ", ""))
+	if len(fpr) == 40 || len(fpr) == 64 {
+		if _, err := hex.DecodeString(fpr); err == nil {
+			return []string{fpr}, nil
+		}
+	}
+	output, err := exec.Command(tool, "--batch", "--with-colons", "--with-subkey-fingerprint", "--list-keys", "--", key).Output()
+	if err != nil {
+		return nil, fmt.Errorf("verify key %q isn't in the keyring", key)
+	}
+	var fingerprints []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if fields := strings.Split(line, ":"); len(fields) > 9 && fields[0] == "fpr" {
+			fingerprints = append(fingerprints, strings.ToUpper(fields[9]))
+		}
+	}
+	if len(fingerprints) == 0 {
+		return nil, fmt.Errorf("verify key %q isn't in the keyring", key)
+	}
+	return fingerprints, nil
+}
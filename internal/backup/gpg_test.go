@@ -0,0 +1,49 @@
+package backup
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidSignature(t *testing.T) {
+	const subkey = "ADD2DF9045D6B50F898F144D927B25AB5D6F485F"
+	const primary = "BD31DEE2B6919E5A510B8BFB56EAFE4B2575FF87"
+	tests := []struct {
+		name    string
+		status  string
+		signer  string
+		primary string
+	}{
+		{"good signature", "[GNUPG:] NEWSIG\n[GNUPG:] GOODSIG 927B25AB5D6F485F ops@example.com\n" +
+			"[GNUPG:] VALIDSIG " + subkey + " 2026-10-14 1791900000 0 4 0 22 10 00 " + primary + "\n", subkey, primary},
+		{"lowercase", "[GNUPG:] VALIDSIG add2df9045d6b50f898f144d927b25ab5d6f485f 2026-10-14 1791900000 0 4 0 22 10 00 " + primary, subkey, primary},
+		{"no primary field", "[GNUPG:] VALIDSIG " + subkey + " 2026-10-14", subkey, subkey},
+		{"bad signature", "[GNUPG:] NEWSIG\n[GNUPG:] BADSIG 927B25AB5D6F485F ops@example.com\n", "", ""},
+		{"not a status line", "VALIDSIG " + subkey, "", ""},
+		{"empty", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, primaryFpr := validSignature(tt.status)
+			if signer != tt.signer || primaryFpr != tt.primary {
+				t.Errorf("validSignature = %q, %q; want %q, %q", signer, primaryFpr, tt.signer, tt.primary)
+			}
+		})
+	}
+}
+
+func TestKeyFingerprintsTakesFingerprintsAsGiven(t *testing.T) {
+	for _, key := range []string{
+		"BD31DEE2B6919E5A510B8BFB56EAFE4B2575FF87",
+		"0xbd31dee2b6919e5a510b8bfb56eafe4b2575ff87",
+		"BD31 DEE2 B691 9E5A 510B  8BFB 56EA FE4B 2575 FF87",
+	} {
+		got, err := keyFingerprints("/nonexistent/gpg", key)
+		if err != nil {
+			t.Fatalf("keyFingerprints(%q): %v", key, err)
+		}
+		if want := []string{"BD31DEE2B6919E5A510B8BFB56EAFE4B2575FF87"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("keyFingerprints(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/dump"
+	"github.com/iostate/back-it-up/internal/storage"
+)
+
+// manifestExtension marks the sidecar describing how a backup was taken
+const manifestExtension = ".manifest.json"
+
+// manifestVersion is the layout of the manifests this version writes
+const manifestVersion = 1
+
+// toolVersion is the back-it-up version recorded in manifests
+var toolVersion = "dev"
+
+// SetToolVersion sets the back-it-up version recorded in backup manifests
+func SetToolVersion(version string) {
+	toolVersion = version
+}
+
+// Manifest describes a backup: where it came from, how it was made, and
+// what it should read back as
+type Manifest struct {
+	Version       int    `json:"manifest_version"`
+	Backup        string `json:"backup"`
+	ContainerName string `json:"container"`
+	DatabaseName  string `json:"database"`
+	// Volume is the docker volume a volume archive was made of
+	Volume        string `json:"volume,omitempty"`
+	DumpFormat    string `json:"format"`
+	Content       string `json:"content,omitempty"`
+	PgDumpVersion string `json:"pg_dump_version,omitempty"`
+	// UncompressedSize is what pg_dump produced before back-it-up compressed
+	// and encrypted it: the SQL of a plain dump, the archive of a custom one,
+	// or the tar of a directory one
+	UncompressedSize int64     `json:"uncompressed_size"`
+	Size             int64     `json:"size"`
+	Compression      string    `json:"compression"`
+	CompressionLevel int       `json:"compression_level,omitempty"`
+	Encryption       string    `json:"encryption,omitempty"`
+	Checksum         string    `json:"sha256"`
+	Globals          string    `json:"globals,omitempty"`
+	StartedAt        time.Time `json:"started_at"`
+	FinishedAt       time.Time `json:"finished_at"`
+	ToolVersion      string    `json:"tool_version"`
+	// Tables holds each table's digest, with Config.TableDigests
+	Tables map[string]TableDigest `json:"tables,omitempty"`
+	// Extensions maps each extension installed in the database to its
+	// version, so a restore can tell when the target runs another
+	Extensions map[string]string `json:"extensions,omitempty"`
+}
+
+// TableDigest is the row count and order-independent hash of a table's
+// rows, as diff computes them
+type TableDigest struct {
+	Rows   int64  `json:"rows"`
+	Digest string `json:"digest"`
+}
+
+// Duration is how long the backup took
+func (m *Manifest) Duration() time.Duration {
+	return m.FinishedAt.Sub(m.StartedAt)
+}
+
+// ManifestPath returns where the manifest of the backup at path is stored
+func ManifestPath(path string) string {
+	return path + manifestExtension
+}
+
+// isBackupManifest reports whether path is the manifest of a backup, rather
+// than an export's pointer manifest
+func isBackupManifest(path string) bool {
+	base, ok := strings.CutSuffix(filepath.Base(path), manifestExtension)
+	if !ok {
+		return false
+	}
+	_, _, ok = cutBackupExtension(base)
+	return ok
+}
+
+// ReadManifest reads the manifest of the backup at path. It returns nil if
+// the backup has none, as with those taken by older versions.
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := readSidecar(ManifestPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", ManifestPath(path), err)
+	}
+	return &m, nil
+}
+
+// writeManifest stores m next to the backup at path
+func writeManifest(path string, m *Manifest) error {
+	data, err := encodeManifest(m)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(ManifestPath(path), data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+func encodeManifest(m *Manifest) ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// CheckManifest compares the backup at path with the size and checksum its
+// manifest recorded. The checksum is only compared if verifyChecksum is
+// set, since it means reading the whole file. It returns the manifest, or
+// nil if the backup has none. A backup in an object store is only checked
+// as it is streamed, against its checksum file.
+func CheckManifest(path string, verifyChecksum bool) (*Manifest, error) {
+	m, err := ReadManifest(path)
+	if err != nil || m == nil || storage.IsLocation(path) {
+		return m, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return m, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if info.Size() != m.Size {
+		return m, fmt.Errorf("%s is %d bytes, but its manifest recorded %d; the backup is truncated or corrupted", path, info.Size(), m.Size)
+	}
+	if verifyChecksum && m.Checksum != "" {
+		actual, err := FileChecksum(path)
+		if err != nil {
+			return m, fmt.Errorf("failed to checksum %s: %w", path, err)
+		}
+		if actual != m.Checksum {
+			return m, fmt.Errorf("checksum mismatch for %s: its manifest recorded %s, file has %s; the backup is truncated or corrupted", path, m.Checksum, actual)
+		}
+	}
+	return m, nil
+}
+
+// pgMajorVersion returns the major version in the output of a PostgreSQL
+// client's --version, as in "pg_dump (PostgreSQL) 16.2", or 0 if there is
+// none
+func pgMajorVersion(version string) int {
+	for _, field := range strings.Fields(version) {
+		major, _, _ := strings.Cut(field, ".")
+		if n, err := strconv.Atoi(major); err == nil {
+			return n
+		}
+	}
+	return 0
+}
+
+// clientVersion asks a client tool in the container for its version. It
+// returns "" if the tool can't say.
+func (s *Service) clientVersion(containerName, tool string) string {
+	output, err := s.dockerSvc.Exec(containerName, []string{tool, "--version"})
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// reportManifest prints what m says about the backup being restored, and
+// warns if the tool restoring a dump of format in the container is
+// older than the pg_dump that took it, which pg_restore refuses and psql may
+// trip over
+func (s *Service) reportManifest(containerName, format string, m *Manifest) {
+	fmt.Printf("Backup of '%s' from %s, taken %s", m.DatabaseName, m.ContainerName, m.StartedAt.Format(time.RFC3339))
+	if m.PgDumpVersion != "" {
+		fmt.Printf(" with %s", m.PgDumpVersion)
+	}
+	fmt.Println()
+
+	tool := "psql"
+	if format != FormatPlain {
+		tool = "pg_restore"
+	}
+	dumped := pgMajorVersion(m.PgDumpVersion)
+	restoring := s.clientVersion(containerName, tool)
+	if major := pgMajorVersion(restoring); dumped > 0 && major > 0 && major < dumped {
+		fmt.Printf("Warning: the backup was taken with %s, but the container has %s; restore it with PostgreSQL %d or newer\n",
+			m.PgDumpVersion, restoring, dumped)
+	}
+}
+
+// tableScanner digests the tables of a plain dump written to it, in step
+// with the writer feeding it
+type tableScanner struct {
+	pipe    *io.PipeWriter
+	done    chan struct{}
+	summary *dump.Summary
+	err     error
+}
+
+func startTableScanner() *tableScanner {
+	pr, pw := io.Pipe()
+	s := &tableScanner{pipe: pw, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		s.summary, s.err = dump.Summarize(pr)
+		// Keep the dump flowing if the scan stopped early
+		io.Copy(io.Discard, pr)
+	}()
+	return s
+}
+
+func (s *tableScanner) Write(p []byte) (int, error) {
+	return s.pipe.Write(p)
+}
+
+// finish waits for the scan to read everything written and returns the
+// digest of each table. It may be called more than once.
+func (s *tableScanner) finish() (map[string]TableDigest, error) {
+	s.pipe.Close()
+	<-s.done
+	if s.err != nil {
+		return nil, s.err
+	}
+	tables := make(map[string]TableDigest, len(s.summary.Tables))
+	for name, t := range s.summary.Tables {
+		tables[name] = TableDigest{Rows: t.Rows, Digest: fmt.Sprintf("%016x", t.Digest)}
+	}
+	return tables, nil
+}
+
+// sizeWriter counts the bytes written through it
+type sizeWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *sizeWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
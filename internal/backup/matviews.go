@@ -0,0 +1,120 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaterializedView is a materialized view of a database
+type MaterializedView struct {
+	// Name is a quoted schema.name
+	Name string
+	// Populated is false for a view created WITH NO DATA, as data-less and
+	// schema-only restores leave them; selecting from it fails
+	Populated bool
+	// Concurrent reports whether it has a unique index on plain columns,
+	// which REFRESH ... CONCURRENTLY needs
+	Concurrent bool
+}
+
+// viewsQuery lists every view and materialized view with the views and
+// materialized views its query reads, so dependencies through plain views
+// are followed too
+const viewsQuery = `SELECT quote_ident(n.nspname) || '.' || quote_ident(c.relname),
+       c.relkind,
+       c.relispopulated,
+       EXISTS (SELECT 1 FROM pg_index i
+                WHERE i.indrelid = c.oid AND i.indisunique AND i.indpred IS NULL AND i.indexprs IS NULL),
+       coalesce((SELECT string_agg(DISTINCT quote_ident(rn.nspname) || '.' || quote_ident(rc.relname), ' ')
+                   FROM pg_rewrite r
+                   JOIN pg_depend d ON d.classid = 'pg_rewrite'::regclass AND d.objid = r.oid
+                                   AND d.refclassid = 'pg_class'::regclass
+                   JOIN pg_class rc ON rc.oid = d.refobjid AND rc.relkind IN ('v', 'm') AND rc.oid <> c.oid
+                   JOIN pg_namespace rn ON rn.oid = rc.relnamespace
+                  WHERE r.ev_class = c.oid), '')
+  FROM pg_class c
+  JOIN pg_namespace n ON n.oid = c.relnamespace
+ WHERE c.relkind IN ('v', 'm')
+   AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+ ORDER BY 1;`
+
+// MaterializedViews returns the materialized views of a database in
+// dependency order, each after the ones its query reads, so refreshing
+// them in turn never reads a stale or unpopulated one
+func (s *Service) MaterializedViews(containerName, dbName, dbUser string) ([]MaterializedView, error) {
+	output, err := s.dockerSvc.Exec(containerName, []string{
+		"psql", "-U", dbUser, "-d", dbName, "-tA", "-F", "\t", "-c", viewsQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list materialized views: %w\nOutput: %s", err, string(output))
+	}
+
+	type view struct {
+		matview MaterializedView
+		kind    string
+		reads   []string
+	}
+	views := make(map[string]*view)
+	var names []string
+	// The last field is empty for views reading only tables, so only line
+	// ends are trimmed
+	for _, line := range strings.Split(strings.TrimRight(string(output), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("failed to list materialized views: unexpected output %q", line)
+		}
+		views[fields[0]] = &view{
+			matview: MaterializedView{Name: fields[0], Populated: fields[2] == "t", Concurrent: fields[3] == "t"},
+			kind:    fields[1],
+			reads:   strings.Fields(fields[4]),
+		}
+		names = append(names, fields[0])
+	}
+
+	// Depth-first, so everything a view reads comes before it; PostgreSQL
+	// doesn't allow cycles between views
+	var ordered []MaterializedView
+	visited := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		v, ok := views[name]
+		if !ok || visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, dep := range v.reads {
+			visit(dep)
+		}
+		if v.kind == "m" {
+			ordered = append(ordered, v.matview)
+		}
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return ordered, nil
+}
+
+// RefreshMaterializedViews refreshes views in the order given. With
+// concurrently, views that allow it are refreshed without locking out
+// readers; the others, and unpopulated ones, are refreshed plainly.
+func (s *Service) RefreshMaterializedViews(containerName, dbName, dbUser string, views []MaterializedView, concurrently bool) error {
+	s.events.OnPhase(PhaseRefresh)
+	for _, v := range views {
+		statement := "REFRESH MATERIALIZED VIEW " + v.Name + ";"
+		if concurrently && v.Populated && v.Concurrent {
+			statement = "REFRESH MATERIALIZED VIEW CONCURRENTLY " + v.Name + ";"
+		}
+		output, err := s.dockerSvc.Exec(containerName, []string{
+			"psql", "-U", dbUser, "-d", dbName, "--set", "ON_ERROR_STOP=1", "-c", statement,
+		})
+		if err != nil {
+			return s.fail(fmt.Errorf("failed to refresh %s: %w\nOutput: %s", v.Name, err, string(output)))
+		}
+		s.events.OnTableDone(v.Name)
+	}
+	return nil
+}
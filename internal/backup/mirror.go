@@ -0,0 +1,275 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/fault"
+	"github.com/iostate/back-it-up/internal/storage"
+)
+
+// MirrorStatus reports how far a mirror destination trails the primary
+type MirrorStatus struct {
+	Dir        string
+	Missing    []string
+	Corrupt    []string
+	Lag        time.Duration
+	LatestTime time.Time
+}
+
+// Healthy reports whether the mirror holds every primary backup and is within maxLag
+func (m MirrorStatus) Healthy(maxLag time.Duration) bool {
+	return len(m.Missing) == 0 && len(m.Corrupt) == 0 && (maxLag <= 0 || m.Lag <= maxLag)
+}
+
+// Mirror copies a finished backup, with its checksum file, signature, and
+// manifest, into each mirror directory or object store location, such as
+// s3://bucket/prefix, and verifies that every copy matches the original
+// checksum
+func (s *Service) Mirror(backupPath string, mirrorDirs []string) error {
+	sourceSum, err := RecordedChecksum(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to checksum backup: %w", err)
+	}
+	var sidecars []string
+	for _, sidecar := range []string{ChecksumPath(backupPath), SignaturePath(backupPath), ManifestPath(backupPath)} {
+		if _, err := os.Stat(sidecar); err == nil {
+			sidecars = append(sidecars, sidecar)
+		}
+	}
+
+	for _, dir := range mirrorDirs {
+		mirror := mirrorToDir
+		if storage.IsLocation(dir) {
+			mirror = mirrorToStore
+		}
+		if err := mirror(backupPath, dir, sourceSum, sidecars); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mirrorToDir copies the backup at backupPath and its sidecars into dir
+func mirrorToDir(backupPath, dir, sourceSum string, sidecars []string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create mirror directory %s: %w", dir, err)
+	}
+
+	if err := fault.Inject(fault.StageUpload); err != nil {
+		return fmt.Errorf("failed to copy backup to %s: %w", dir, err)
+	}
+
+	target := filepath.Join(dir, filepath.Base(backupPath))
+	if err := copyFile(backupPath, target); err != nil {
+		return fmt.Errorf("failed to copy backup to %s: %w", dir, err)
+	}
+
+	targetSum, err := FileChecksum(target)
+	if err != nil {
+		return fmt.Errorf("failed to checksum mirror copy in %s: %w", dir, err)
+	}
+	if targetSum != sourceSum {
+		return fmt.Errorf("mirror copy in %s does not match the original backup", dir)
+	}
+	for _, sidecar := range sidecars {
+		if err := copyFile(sidecar, filepath.Join(dir, filepath.Base(sidecar))); err != nil {
+			return fmt.Errorf("failed to copy %s to %s: %w", filepath.Base(sidecar), dir, err)
+		}
+	}
+	return nil
+}
+
+// mirrorToStore stores the backup at backupPath and its sidecars under the
+// prefix location names, then reads the stored copy back to check it. The
+// checksum file is always stored, since CheckMirrors compares it against
+// the primary's.
+func mirrorToStore(backupPath, location, sourceSum string, sidecars []string) error {
+	store, prefix, err := storage.Open(location)
+	if err != nil {
+		return err
+	}
+
+	if err := fault.Inject(fault.StageUpload); err != nil {
+		return fmt.Errorf("failed to copy backup to %s: %w", location, err)
+	}
+
+	key := storage.Join(prefix, filepath.Base(backupPath))
+	if err := putFile(store, key, backupPath); err != nil {
+		return fmt.Errorf("failed to copy backup to %s: %w", location, err)
+	}
+
+	targetSum, err := objectChecksum(store, key)
+	if err != nil {
+		return fmt.Errorf("failed to checksum mirror copy in %s: %w", location, err)
+	}
+	if targetSum != sourceSum {
+		return fmt.Errorf("mirror copy in %s does not match the original backup", location)
+	}
+	if err := store.Put(ChecksumPath(key), bytes.NewReader(checksumLine(sourceSum, filepath.Base(backupPath)))); err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", filepath.Base(ChecksumPath(backupPath)), location, err)
+	}
+	for _, sidecar := range sidecars {
+		if sidecar == ChecksumPath(backupPath) {
+			continue
+		}
+		if err := putFile(store, storage.Join(prefix, filepath.Base(sidecar)), sidecar); err != nil {
+			return fmt.Errorf("failed to copy %s to %s: %w", filepath.Base(sidecar), location, err)
+		}
+	}
+	return nil
+}
+
+// putFile stores the file at path under key
+func putFile(store storage.Store, key, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return store.Put(key, f)
+}
+
+// objectChecksum returns the SHA-256 of the object stored under key
+func objectChecksum(store storage.Store, key string) (string, error) {
+	r, err := store.Get(key)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CheckMirrors compares the backups of dbName in primaryDir against each mirror
+// and reports which are missing, corrupt, or lagging as of now. A mirror in
+// an object store can't be listed, so each primary backup is looked up in
+// it by name and its checksum file compared against the primary's.
+func CheckMirrors(primaryDir string, mirrorDirs []string, dbName string, now time.Time) ([]MirrorStatus, error) {
+	primary, err := ListBackups(primaryDir, dbName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list primary backups: %w", err)
+	}
+
+	var statuses []MirrorStatus
+	for _, dir := range mirrorDirs {
+		if storage.IsLocation(dir) {
+			status, err := checkStoredMirror(primary, dir, now)
+			if err != nil {
+				return nil, err
+			}
+			statuses = append(statuses, status)
+			continue
+		}
+		status := MirrorStatus{Dir: dir}
+
+		mirrored, err := ListBackups(dir, dbName)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to list mirror backups in %s: %w", dir, err)
+		}
+
+		sizes := make(map[string]int64, len(mirrored))
+		for _, b := range mirrored {
+			sizes[filepath.Base(b.Path)] = b.Size
+		}
+		if len(mirrored) > 0 {
+			status.LatestTime = mirrored[len(mirrored)-1].Timestamp
+		}
+
+		for _, b := range primary {
+			name := filepath.Base(b.Path)
+			size, ok := sizes[name]
+			switch {
+			case !ok:
+				status.Missing = append(status.Missing, name)
+			case size != b.Size:
+				status.Corrupt = append(status.Corrupt, name)
+			}
+		}
+
+		status.setLag(primary, now)
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// checkStoredMirror looks up each of the primary backups in the object
+// store location
+func checkStoredMirror(primary []BackupFile, location string, now time.Time) (MirrorStatus, error) {
+	status := MirrorStatus{Dir: location}
+	for _, b := range primary {
+		name := filepath.Base(b.Path)
+		mirrored, err := storedChecksum(strings.TrimSuffix(location, "/") + "/" + name)
+		if errors.Is(err, fs.ErrNotExist) {
+			status.Missing = append(status.Missing, name)
+			continue
+		}
+		if err != nil {
+			return MirrorStatus{}, fmt.Errorf("failed to check mirror %s: %w", location, err)
+		}
+		sum, err := RecordedChecksum(b.Path)
+		if err != nil {
+			return MirrorStatus{}, fmt.Errorf("failed to checksum %s: %w", b.Path, err)
+		}
+		if mirrored != sum {
+			status.Corrupt = append(status.Corrupt, name)
+			continue
+		}
+		status.LatestTime = b.Timestamp
+	}
+	status.setLag(primary, now)
+	return status, nil
+}
+
+// setLag sets how far the mirror trails the newest of the primary backups
+func (m *MirrorStatus) setLag(primary []BackupFile, now time.Time) {
+	if len(primary) == 0 {
+		return
+	}
+	m.Lag = primary[len(primary)-1].Timestamp.Sub(m.LatestTime)
+	if m.LatestTime.IsZero() {
+		m.Lag = now.Sub(primary[0].Timestamp)
+	}
+}
+
+// copyFile copies src to dst, writing to a temporary file first so a partial
+// copy is never mistaken for a complete backup
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".partial"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, dst)
+}
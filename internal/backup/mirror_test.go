@@ -0,0 +1,116 @@
+package backup
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memS3 serves path-addressed S3 objects from memory
+type memS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *memS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m.objects[r.URL.Path] = data
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodGet:
+		data, ok := m.objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(m.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+	}
+}
+
+func newMemS3(t *testing.T) *memS3 {
+	t.Helper()
+	m := &memS3{objects: map[string][]byte{}}
+	srv := httptest.NewServer(m)
+	t.Cleanup(srv.Close)
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_ENDPOINT_URL_S3", srv.URL)
+	return m
+}
+
+func TestMirrorToStore(t *testing.T) {
+	store := newMemS3(t)
+	dir := t.TempDir()
+	backupPath := filepath.Join(dir, "app_2025_01_02_03_04_05.sql.gz")
+	if err := os.WriteFile(backupPath, []byte("dump"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeManifest(backupPath, &Manifest{DatabaseName: "app"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&Service{}).Mirror(backupPath, []string{"s3://dr/backups"}); err != nil {
+		t.Fatalf("Mirror: %v", err)
+	}
+	for _, key := range []string{"/dr/backups/app_2025_01_02_03_04_05.sql.gz", "/dr/backups/app_2025_01_02_03_04_05.sql.gz.sha256", "/dr/backups/app_2025_01_02_03_04_05.sql.gz.manifest.json"} {
+		if _, ok := store.objects[key]; !ok {
+			t.Errorf("%s was not stored", key)
+		}
+	}
+	if got := string(store.objects["/dr/backups/app_2025_01_02_03_04_05.sql.gz"]); got != "dump" {
+		t.Errorf("stored backup = %q, want %q", got, "dump")
+	}
+}
+
+func TestCheckStoredMirror(t *testing.T) {
+	store := newMemS3(t)
+	dir := t.TempDir()
+	names := []string{"app_2025_01_01_00_00_00.sql.gz", "app_2025_01_02_00_00_00.sql.gz", "app_2025_01_03_00_00_00.sql.gz"}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := (&Service{}).Mirror(filepath.Join(dir, names[0]), []string{"s3://dr"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Service{}).Mirror(filepath.Join(dir, names[1]), []string{"s3://dr"}); err != nil {
+		t.Fatal(err)
+	}
+	store.objects["/dr/"+names[1]+".sha256"] = checksumLine("0000000000000000000000000000000000000000000000000000000000000000", names[1])
+
+	statuses, err := CheckMirrors(dir, []string{"s3://dr"}, "app", time.Now())
+	if err != nil {
+		t.Fatalf("CheckMirrors: %v", err)
+	}
+	status := statuses[0]
+	if len(status.Missing) != 1 || status.Missing[0] != names[2] {
+		t.Errorf("Missing = %v, want [%s]", status.Missing, names[2])
+	}
+	if len(status.Corrupt) != 1 || status.Corrupt[0] != names[1] {
+		t.Errorf("Corrupt = %v, want [%s]", status.Corrupt, names[1])
+	}
+	if want := 2 * 24 * time.Hour; status.Lag != want {
+		t.Errorf("Lag = %s, want %s", status.Lag, want)
+	}
+	if status.Healthy(0) {
+		t.Error("mirror with missing and corrupt backups reported healthy")
+	}
+}
@@ -0,0 +1,82 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pacedReader limits how fast a restore stream is read, which in turn paces
+// the statements psql or pg_restore can execute from it
+type pacedReader struct {
+	r              io.Reader
+	bytesPerSecond int64
+	start          time.Time
+	read           int64
+}
+
+func newPacedReader(r io.Reader, bytesPerSecond int64) *pacedReader {
+	return &pacedReader{r: r, bytesPerSecond: bytesPerSecond}
+}
+
+func (p *pacedReader) Read(buf []byte) (int, error) {
+	if p.start.IsZero() {
+		p.start = time.Now()
+	}
+	// Read a tenth of a second's worth at a time so the pace stays even
+	if chunk := max(p.bytesPerSecond/10, 1); int64(len(buf)) > chunk {
+		buf = buf[:chunk]
+	}
+	n, err := p.r.Read(buf)
+	p.read += int64(n)
+	due := p.start.Add(time.Duration(float64(p.read) / float64(p.bytesPerSecond) * float64(time.Second)))
+	if wait := time.Until(due); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
+
+// restoreJobs returns how many pg_restore jobs to run: cfg.Jobs, capped at
+// cfg.MaxConnections and at the connection slots the server has free
+func (s *Service) restoreJobs(cfg RestoreConfig) (int, error) {
+	jobs := max(cfg.Jobs, 1)
+	if cfg.MaxConnections <= 0 {
+		return jobs, nil
+	}
+	if jobs > cfg.MaxConnections {
+		jobs = cfg.MaxConnections
+		fmt.Printf("Limiting the restore to %d connection(s)\n", jobs)
+	}
+
+	free, err := s.freeConnections(cfg.ContainerName, cfg.DatabaseUser)
+	if err != nil {
+		return 0, err
+	}
+	if free < 1 {
+		return 0, fmt.Errorf("the server has no connection slots free; try again when it is less busy")
+	}
+	if free < jobs {
+		fmt.Printf("Only %d connection slot(s) free on the server; restoring with %d job(s)\n", free, free)
+		jobs = free
+	}
+	return jobs, nil
+}
+
+// freeConnections returns how many more connections the server accepts
+// from ordinary roles
+func (s *Service) freeConnections(containerName, dbUser string) (int, error) {
+	output, err := s.dockerSvc.Exec(containerName, []string{
+		"psql", "-U", dbUser, "-d", "template1", "-tA", "-c",
+		"SELECT current_setting('max_connections')::int - current_setting('superuser_reserved_connections')::int - count(*) FROM pg_stat_activity WHERE backend_type = 'client backend';",
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count free connections: %w\nOutput: %s", err, string(output))
+	}
+	free, err := strconv.Atoi(strings.TrimSpace(string(output)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count free connections: unexpected output %q", strings.TrimSpace(string(output)))
+	}
+	return free, nil
+}
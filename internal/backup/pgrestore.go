@@ -0,0 +1,58 @@
+package backup
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// pgRestore restores a custom or directory-format archive read from r with
+// pg_restore. A custom archive is piped straight in unless cfg.Jobs asks for
+// a parallel restore, which pg_restore can only do from a file, so then it is
+// copied into the container first; a directory dump is always unpacked there.
+func (s *Service) pgRestore(cfg RestoreConfig, format string, r io.Reader) error {
+	args := []string{"-U", cfg.DatabaseUser, "-d", cfg.DatabaseName}
+	if cfg.SchemaOnly {
+		args = append(args, "--schema-only")
+	}
+	if cfg.ValidateOnly {
+		args = append(args, "--single-transaction", "--exit-on-error")
+	}
+	jobs, err := s.restoreJobs(cfg)
+	if err != nil {
+		return err
+	}
+	if format == FormatCustom && jobs <= 1 {
+		return s.feed(cfg.ContainerName, r, "pg_restore", args...)
+	}
+
+	dir := scratchDir(cfg.DatabaseName)
+	if output, err := s.dockerSvc.Exec(cfg.ContainerName, []string{"mkdir", "-p", dir}); err != nil {
+		return fmt.Errorf("failed to create %s: %w\nOutput: %s", dir, err, string(output))
+	}
+	defer s.dockerSvc.Exec(cfg.ContainerName, []string{"rm", "-rf", dir})
+
+	archive := dir
+	if format == FormatDirectory {
+		gzReader, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		defer gzReader.Close()
+		if err := s.feed(cfg.ContainerName, gzReader, "tar", "-C", dir, "-xf", "-"); err != nil {
+			return err
+		}
+	} else {
+		archive = dir + "/archive.dump"
+		if err := s.feed(cfg.ContainerName, r, "sh", "-c", `cat > "$0"`, archive); err != nil {
+			return err
+		}
+	}
+
+	args = append(args, "-j", strconv.Itoa(jobs), archive)
+	if output, err := s.dockerSvc.Exec(cfg.ContainerName, append([]string{"pg_restore"}, args...)); err != nil {
+		return fmt.Errorf("pg_restore failed: %w\nOutput: %s", err, string(output))
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package backup
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// parallelGzipBlockSize is how much input each goroutine compresses at a time
+const parallelGzipBlockSize = 1 << 20
+
+// flateWindow is how far back a deflate match can reach, so this much of
+// each block primes the next block's compressor
+const flateWindow = 32 << 10
+
+// gzipHeader is a minimal gzip member header: deflate, no name, no mtime
+var gzipHeader = []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 0xff}
+
+// parallelGzipWriter compresses blocks of its input on several goroutines,
+// the way pigz does. Each block is deflated with the end of the previous one
+// as its dictionary and ends in a sync flush, so the blocks concatenate
+// into one ordinary gzip member at nearly the ratio of a serial writer.
+type parallelGzipWriter struct {
+	w     io.Writer
+	level int
+	buf   []byte
+	dict  []byte
+	crc   uint32
+	size  uint32
+
+	// sem bounds the goroutines compressing at once, queue the blocks
+	// waiting to be written in order
+	sem    chan struct{}
+	queue  chan *gzipBlock
+	wrote  chan error
+	closed bool
+
+	mu  sync.Mutex
+	err error
+}
+
+type gzipBlock struct {
+	data  []byte
+	dict  []byte
+	final bool
+	out   bytes.Buffer
+	err   error
+	done  chan struct{}
+}
+
+func newParallelGzipWriter(w io.Writer, level, threads int) (*parallelGzipWriter, error) {
+	if _, err := flate.NewWriter(io.Discard, level); err != nil {
+		return nil, fmt.Errorf("failed to create gzip writer: %w", err)
+	}
+	if _, err := w.Write(gzipHeader); err != nil {
+		return nil, err
+	}
+	p := &parallelGzipWriter{
+		w:     w,
+		level: level,
+		buf:   make([]byte, 0, parallelGzipBlockSize),
+		sem:   make(chan struct{}, threads),
+		queue: make(chan *gzipBlock, threads),
+		wrote: make(chan error, 1),
+	}
+	go p.writeBlocks()
+	return p, nil
+}
+
+func (p *parallelGzipWriter) Write(data []byte) (int, error) {
+	if err := p.writeErr(); err != nil {
+		return 0, err
+	}
+	p.crc = crc32.Update(p.crc, crc32.IEEETable, data)
+	p.size += uint32(len(data))
+	n := len(data)
+	for len(data) > 0 {
+		k := copy(p.buf[len(p.buf):cap(p.buf)], data)
+		p.buf = p.buf[:len(p.buf)+k]
+		data = data[k:]
+		if len(p.buf) == cap(p.buf) {
+			p.dispatch(false)
+		}
+	}
+	return n, nil
+}
+
+// Close compresses what is left, waits for every block to be written and
+// appends the gzip trailer
+func (p *parallelGzipWriter) Close() error {
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	p.dispatch(true)
+	close(p.queue)
+	if err := <-p.wrote; err != nil {
+		return err
+	}
+	var trailer [8]byte
+	binary.LittleEndian.PutUint32(trailer[:4], p.crc)
+	binary.LittleEndian.PutUint32(trailer[4:], p.size)
+	_, err := p.w.Write(trailer[:])
+	return err
+}
+
+// dispatch starts compressing the buffered block and queues it for writing
+func (p *parallelGzipWriter) dispatch(final bool) {
+	b := &gzipBlock{data: p.buf, dict: p.dict, final: final, done: make(chan struct{})}
+	p.sem <- struct{}{}
+	go func() {
+		defer close(b.done)
+		defer func() { <-p.sem }()
+		b.err = b.compress(p.level)
+	}()
+	p.queue <- b
+
+	p.dict = b.data[max(len(b.data)-flateWindow, 0):]
+	p.buf = make([]byte, 0, parallelGzipBlockSize)
+}
+
+// writeBlocks writes the compressed blocks to w in input order
+func (p *parallelGzipWriter) writeBlocks() {
+	var err error
+	for b := range p.queue {
+		<-b.done
+		if err != nil {
+			continue
+		}
+		if err = b.err; err == nil {
+			_, err = p.w.Write(b.out.Bytes())
+		}
+		if err != nil {
+			p.mu.Lock()
+			p.err = err
+			p.mu.Unlock()
+		}
+	}
+	p.wrote <- err
+}
+
+func (p *parallelGzipWriter) writeErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (b *gzipBlock) compress(level int) error {
+	fw, err := flate.NewWriterDict(&b.out, level, b.dict)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(b.data); err != nil {
+		return err
+	}
+	// Only the last block ends the deflate stream; the others end in a sync
+	// flush so the next block's output can follow them
+	if b.final {
+		return fw.Close()
+	}
+	return fw.Flush()
+}
@@ -0,0 +1,73 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RolePrivileges describes what the connecting role may do in a database
+type RolePrivileges struct {
+	Superuser bool
+	CreateDB  bool
+	// ReadAllData reports membership in pg_read_all_data (PostgreSQL 14+)
+	ReadAllData bool
+	Connect     bool
+	// UnreadableTables lists user tables the role can't SELECT from
+	UnreadableTables []string
+}
+
+// CanDump reports whether pg_dump can read every table
+func (p *RolePrivileges) CanDump() bool {
+	return p.Connect && (p.Superuser || p.ReadAllData || len(p.UnreadableTables) == 0)
+}
+
+// CanRecreate reports whether the role may drop and create databases for restores
+func (p *RolePrivileges) CanRecreate() bool {
+	return p.Superuser || p.CreateDB
+}
+
+// roleQuery reports the attributes of the connecting role
+const roleQuery = `SELECT r.rolsuper, r.rolcreatedb,
+       EXISTS (SELECT 1 FROM pg_auth_members m JOIN pg_roles g ON g.oid = m.roleid
+                WHERE g.rolname = 'pg_read_all_data' AND m.member = r.oid),
+       has_database_privilege(current_database(), 'CONNECT')
+  FROM pg_roles r WHERE r.rolname = current_user;`
+
+// unreadableTablesQuery lists the user tables the connecting role can't read
+const unreadableTablesQuery = `SELECT quote_ident(schemaname) || '.' || quote_ident(tablename)
+  FROM pg_tables
+ WHERE schemaname NOT IN ('pg_catalog', 'information_schema')
+   AND NOT has_table_privilege(quote_ident(schemaname) || '.' || quote_ident(tablename), 'SELECT')
+ ORDER BY 1;`
+
+// RolePrivileges queries the privileges dbUser holds in dbName
+func (s *Service) RolePrivileges(containerName, dbName, dbUser string) (*RolePrivileges, error) {
+	output, err := s.dockerSvc.Exec(containerName, []string{
+		"psql", "-X", "-U", dbUser, "-d", dbName, "-tA", "-F", "|", "-c", roleQuery, "-c", unreadableTablesQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query role privileges: %w\nOutput: %s", err, string(output))
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if l := strings.TrimSpace(line); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("role %q not found", dbUser)
+	}
+
+	attrs := strings.Split(lines[0], "|")
+	if len(attrs) != 4 {
+		return nil, fmt.Errorf("unexpected privileges output: %q", lines[0])
+	}
+	return &RolePrivileges{
+		Superuser:        attrs[0] == "t",
+		CreateDB:         attrs[1] == "t",
+		ReadAllData:      attrs[2] == "t",
+		Connect:          attrs[3] == "t",
+		UnreadableTables: lines[1:],
+	}, nil
+}
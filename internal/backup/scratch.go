@@ -0,0 +1,160 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/clock"
+	"github.com/iostate/back-it-up/internal/control"
+)
+
+// partialExtension marks a file still being written, renamed once complete
+const partialExtension = ".partial"
+
+// scratchPIDFile, in a run's scratch directory, holds the process ID of the
+// run, so clean never removes the scratch files of one still going
+const scratchPIDFile = ".pid"
+
+// scratch is where this process keeps files it only needs while it runs:
+// staged downloads, registry pushes, globals on their way to a store. Each
+// run has a directory of its own, named after its run ID, under root.
+var scratch struct {
+	mu   sync.Mutex
+	root string
+	id   string
+	dir  string
+}
+
+// SetScratchRoot sets the directory each run's scratch directory is created
+// in (default: back-it-up under the system temp directory)
+func SetScratchRoot(dir string) {
+	scratch.mu.Lock()
+	defer scratch.mu.Unlock()
+	scratch.root = dir
+}
+
+// ScratchRoot returns the directory each run's scratch directory is created in
+func ScratchRoot() string {
+	scratch.mu.Lock()
+	defer scratch.mu.Unlock()
+	return scratchRoot()
+}
+
+func scratchRoot() string {
+	if scratch.root != "" {
+		return scratch.root
+	}
+	return filepath.Join(os.TempDir(), "back-it-up")
+}
+
+// SetRunID names this run's scratch directory after id. Runs that don't set
+// one get a fresh ID when they first need scratch space.
+func SetRunID(id string) {
+	scratch.mu.Lock()
+	defer scratch.mu.Unlock()
+	scratch.id = id
+}
+
+// runScratchDir returns this run's scratch directory, creating it on first use
+func runScratchDir() (string, error) {
+	scratch.mu.Lock()
+	defer scratch.mu.Unlock()
+	if scratch.dir != "" {
+		return scratch.dir, nil
+	}
+	if scratch.id == "" {
+		scratch.id = clock.UUIDv7Generator{}.NewID()
+	}
+	dir := filepath.Join(scratchRoot(), scratch.id)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create scratch directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, scratchPIDFile), []byte(strconv.Itoa(os.Getpid())), 0600); err != nil {
+		return "", fmt.Errorf("failed to create scratch directory: %w", err)
+	}
+	scratch.dir = dir
+	return dir, nil
+}
+
+// MkdirScratch creates a new directory in this run's scratch directory, as
+// os.MkdirTemp does
+func MkdirScratch(pattern string) (string, error) {
+	dir, err := runScratchDir()
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(dir, pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create scratch directory: %w", err)
+	}
+	return tmp, nil
+}
+
+// RemoveScratch removes this run's scratch directory and anything left in it
+func RemoveScratch() {
+	scratch.mu.Lock()
+	defer scratch.mu.Unlock()
+	if scratch.dir != "" {
+		os.RemoveAll(scratch.dir)
+		scratch.dir = ""
+	}
+}
+
+// ScratchRun is the scratch directory of a run, possibly one that crashed
+type ScratchRun struct {
+	ID      string
+	Path    string
+	Size    int64
+	ModTime time.Time
+	// Running is set while the process that created the directory is alive
+	Running bool
+}
+
+// ScratchRuns lists the runs' scratch directories under the scratch root.
+// ModTime is the newest modification of anything in a directory.
+func ScratchRuns() ([]ScratchRun, error) {
+	root := ScratchRoot()
+	entries, err := os.ReadDir(root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scratch directory: %w", err)
+	}
+
+	var runs []ScratchRun
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		run := ScratchRun{ID: e.Name(), Path: filepath.Join(root, e.Name())}
+		filepath.WalkDir(run.Path, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				if info.ModTime().After(run.ModTime) {
+					run.ModTime = info.ModTime()
+				}
+				if !d.IsDir() {
+					run.Size += info.Size()
+				}
+			}
+			return nil
+		})
+		if data, err := os.ReadFile(filepath.Join(run.Path, scratchPIDFile)); err == nil {
+			if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+				run.Running = control.Alive(pid)
+			}
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
@@ -0,0 +1,178 @@
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iostate/back-it-up/internal/fault"
+	"github.com/iostate/back-it-up/internal/subset"
+)
+
+// SeedTable reports how many rows of a table went into a seed
+type SeedTable struct {
+	Table string
+	Rows  int64
+}
+
+// SeedResult describes a finished seed artifact
+type SeedResult struct {
+	Path   string
+	Tables []SeedTable
+	// Masked lists masked columns as schema.table.column=strategy
+	Masked []string
+}
+
+// sequenceQuery emits a setval call for every sequence that has been used
+const sequenceQuery = `SELECT format('SELECT pg_catalog.setval(%L, %s, true);', format('%I.%I', schemaname, sequencename), last_value)
+FROM pg_sequences WHERE last_value IS NOT NULL ORDER BY schemaname, sequencename`
+
+// Seed writes a small, masked, referentially consistent sample of a
+// database to cfg.OutputPath. The result is a plain .sql.gz backup: the
+// full schema, the sampled rows, current sequence values, then indexes and
+// constraints, without ownership or privileges so it restores into any
+// local container.
+func (s *Service) Seed(cfg SeedConfig) (*SeedResult, error) {
+	result, err := s.seed(cfg)
+	if err != nil {
+		return nil, s.fail(err)
+	}
+	return result, nil
+}
+
+func (s *Service) seed(cfg SeedConfig) (*SeedResult, error) {
+	if err := fault.Inject(fault.StageDump); err != nil {
+		return nil, err
+	}
+	if err := s.dockerSvc.VerifyContainer(cfg.ContainerName); err != nil {
+		return nil, fmt.Errorf("container verification failed: %w", err)
+	}
+
+	output, err := s.dockerSvc.Exec(cfg.ContainerName, []string{
+		"psql", "-X", "-U", cfg.DatabaseUser, "-d", cfg.DatabaseName, "-tA", "-c", subset.SchemaQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w\nOutput: %s", err, string(output))
+	}
+	schema, err := subset.ParseSchema(output)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := subset.Build(schema, cfg.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cfg.OutputPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	partial := cfg.OutputPath + ".partial"
+	outFile, err := os.Create(partial)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer os.Remove(partial)
+	defer outFile.Close()
+
+	gzWriter := gzip.NewWriter(outFile)
+	dumpCfg := Config{ContainerName: cfg.ContainerName, DatabaseName: cfg.DatabaseName, DatabaseUser: cfg.DatabaseUser}
+
+	s.events.OnPhase(PhaseDump)
+	fmt.Fprintf(gzWriter, "--\n-- back-it-up seed of %s (%d tables)\n--\n\n", cfg.DatabaseName, len(plan.Tables))
+	if err := s.pgDump(dumpCfg, gzWriter, "--section=pre-data", "--no-owner", "--no-privileges"); err != nil {
+		return nil, err
+	}
+
+	tables, err := s.copySubset(cfg, plan, newProgressWriter(gzWriter, s.events))
+	if err != nil {
+		return nil, err
+	}
+
+	sequences, err := s.dockerSvc.Exec(cfg.ContainerName, []string{
+		"psql", "-X", "-U", cfg.DatabaseUser, "-d", cfg.DatabaseName, "-tA", "-c", sequenceQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sequences: %w\nOutput: %s", err, string(sequences))
+	}
+	if _, err := fmt.Fprintf(gzWriter, "\n%s\n", sequences); err != nil {
+		return nil, fmt.Errorf("failed to write seed: %w", err)
+	}
+
+	if err := s.pgDump(dumpCfg, gzWriter, "--section=post-data", "--no-owner", "--no-privileges"); err != nil {
+		return nil, err
+	}
+
+	if err := gzWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write seed: %w", err)
+	}
+	if err := outFile.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write seed: %w", err)
+	}
+	if err := os.Rename(partial, cfg.OutputPath); err != nil {
+		return nil, fmt.Errorf("failed to write seed: %w", err)
+	}
+
+	return &SeedResult{Path: cfg.OutputPath, Tables: tables, Masked: plan.Masked}, nil
+}
+
+// copySubset runs the subset script and rewrites its output as COPY blocks
+func (s *Service) copySubset(cfg SeedConfig, plan *subset.Plan, w io.Writer) ([]SeedTable, error) {
+	cmd := s.dockerSvc.Command(cfg.ContainerName, true,
+		"psql", "-X", "-q", "-tA", "-v", "ON_ERROR_STOP=1", "-U", cfg.DatabaseUser, "-d", cfg.DatabaseName)
+	cmd.Stdin = strings.NewReader(plan.Script)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start subset query: %w", err)
+	}
+
+	tables, copyErr := writeCopyBlocks(bufio.NewReader(stdout), plan.Tables, w)
+	if copyErr != nil {
+		io.Copy(io.Discard, stdout)
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("subset query failed: %w\nError output: %s", err, stderr.String())
+	}
+	if copyErr != nil {
+		return nil, copyErr
+	}
+	return tables, nil
+}
+
+// writeCopyBlocks frames each table's rows, which the subset script
+// terminates with a "\." line, as COPY ... FROM stdin blocks
+func writeCopyBlocks(r *bufio.Reader, tables []subset.Table, w io.Writer) ([]SeedTable, error) {
+	result := make([]SeedTable, 0, len(tables))
+	for _, t := range tables {
+		if _, err := fmt.Fprintf(w, "\n%s\n", subset.CopyHeader(t)); err != nil {
+			return nil, fmt.Errorf("failed to write seed: %w", err)
+		}
+
+		count := int64(0)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return nil, fmt.Errorf("subset output ended early in table %s: %w", t.Key(), err)
+			}
+			if _, err := io.WriteString(w, line); err != nil {
+				return nil, fmt.Errorf("failed to write seed: %w", err)
+			}
+			if line == "\\.\n" {
+				break
+			}
+			count++
+		}
+		result = append(result, SeedTable{Table: t.Key(), Rows: count})
+	}
+	return result, nil
+}
@@ -0,0 +1,123 @@
+package backup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Sequence is a sequence owned by an integer column, as by serial and
+// identity columns
+type Sequence struct {
+	// Name, Table, and Column are quoted identifiers
+	Name   string
+	Table  string
+	Column string
+	// Next is the value nextval will return, and Max the largest in the
+	// column (zero when it's empty)
+	Next, Max int64
+}
+
+// Behind reports whether the next value is one the column already holds,
+// so the next insert relying on the sequence fails with a duplicate key
+func (q Sequence) Behind() bool {
+	return q.Next <= q.Max
+}
+
+// ownedSequencesQuery lists ascending sequences owned by integer columns
+// with the value nextval will return, capped at the sequence's maximum;
+// pg_sequences has no last_value for a sequence that was never called
+const ownedSequencesQuery = `SELECT quote_ident(sn.nspname) || '.' || quote_ident(s.relname),
+       quote_ident(tn.nspname) || '.' || quote_ident(t.relname),
+       quote_ident(a.attname),
+       CASE WHEN ps.last_value IS NULL THEN ps.start_value
+            ELSE least(ps.last_value::numeric + ps.increment_by, ps.max_value)::bigint END
+  FROM pg_class s
+  JOIN pg_namespace sn ON sn.oid = s.relnamespace
+  JOIN pg_sequences ps ON ps.schemaname = sn.nspname AND ps.sequencename = s.relname
+  JOIN pg_depend d ON d.classid = 'pg_class'::regclass AND d.objid = s.oid
+                  AND d.refclassid = 'pg_class'::regclass AND d.deptype IN ('a', 'i')
+  JOIN pg_class t ON t.oid = d.refobjid
+  JOIN pg_namespace tn ON tn.oid = t.relnamespace
+  JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = d.refobjsubid
+ WHERE s.relkind = 'S' AND ps.increment_by > 0
+   AND a.atttypid IN ('smallint'::regtype, 'integer'::regtype, 'bigint'::regtype)
+ ORDER BY 1;`
+
+// Sequences returns the sequences of a database owned by its columns, with
+// how far each has got and the largest value in its column. A dump sets
+// each sequence with the data it was taken with, so a data-only restore, a
+// restore into tables that already had rows, or rows loaded by other means
+// can leave one behind.
+func (s *Service) Sequences(containerName, dbName, dbUser string) ([]Sequence, error) {
+	output, err := s.dockerSvc.Exec(containerName, []string{
+		"psql", "-U", dbUser, "-d", dbName, "-tA", "-F", "\t", "-c", ownedSequencesQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sequences: %w\nOutput: %s", err, string(output))
+	}
+	var sequences []Sequence
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("failed to list sequences: unexpected output %q", line)
+		}
+		next, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list sequences: unexpected output %q", line)
+		}
+		sequences = append(sequences, Sequence{Name: fields[0], Table: fields[1], Column: fields[2], Next: next})
+	}
+	if len(sequences) == 0 {
+		return nil, nil
+	}
+
+	// One query takes the largest value of every column at once
+	probes := make([]string, len(sequences))
+	for i, q := range sequences {
+		probes[i] = fmt.Sprintf("SELECT '%s', coalesce(max(%s), 0) FROM %s", strings.ReplaceAll(q.Name, "'", "''"), q.Column, q.Table)
+	}
+	output, err = s.dockerSvc.Exec(containerName, []string{
+		"psql", "-U", dbUser, "-d", dbName, "-tA", "-F", "\t", "-c", strings.Join(probes, " UNION ALL ") + ";",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the largest column values: %w\nOutput: %s", err, string(output))
+	}
+	largest := make(map[string]int64)
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		name, value, _ := strings.Cut(line, "\t")
+		if max, err := strconv.ParseInt(value, 10, 64); err == nil {
+			largest[name] = max
+		}
+	}
+	for i := range sequences {
+		max, ok := largest[sequences[i].Name]
+		if !ok {
+			return nil, fmt.Errorf("failed to read the largest value of %s.%s", sequences[i].Table, sequences[i].Column)
+		}
+		sequences[i].Max = max
+	}
+	return sequences, nil
+}
+
+// FixSequences moves each sequence past the largest value in its column, so
+// nextval returns the one after it
+func (s *Service) FixSequences(containerName, dbName, dbUser string, sequences []Sequence) error {
+	if len(sequences) == 0 {
+		return nil
+	}
+	statements := make([]string, len(sequences))
+	for i, q := range sequences {
+		statements[i] = fmt.Sprintf("SELECT setval('%s', %d);", strings.ReplaceAll(q.Name, "'", "''"), q.Max)
+	}
+	output, err := s.dockerSvc.Exec(containerName, []string{
+		"psql", "-U", dbUser, "-d", dbName, "-tA", "--set", "ON_ERROR_STOP=1", "-c", strings.Join(statements, " "),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set sequences: %w\nOutput: %s", err, string(output))
+	}
+	return nil
+}
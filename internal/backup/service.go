@@ -1,75 +1,426 @@
 package backup
 
 import (
-	"compress/gzip"
 	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/iostate/back-it-up/internal/clock"
+	"github.com/iostate/back-it-up/internal/fault"
+	"github.com/iostate/back-it-up/internal/subset"
 )
 
 type Service struct {
 	dockerSvc DockerService
+	events    Events
+	clock     clock.Clock
 }
 
 type DockerService interface {
 	VerifyContainer(containerName string) error
 	Exec(containerName string, command []string) ([]byte, error)
+	// Command prepares command to run against the container, with stdin
+	// attached if interactive
+	Command(containerName string, interactive bool, command ...string) *exec.Cmd
 }
 
 func NewService(dockerSvc DockerService) *Service {
 	return &Service{
 		dockerSvc: dockerSvc,
+		events:    NopEvents{},
+		clock:     clock.System{},
 	}
 }
 
 // Backup performs a PostgreSQL backup and compresses it to tar.gz
 func (s *Service) Backup(cfg Config) (string, error) {
-	// Create output directory if it doesn't exist
-	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create output directory: %w", err)
+	if cfg.Timestamp.IsZero() {
+		cfg.Timestamp = s.clock.Now()
+	}
+
+	manifest := &Manifest{
+		Version:       manifestVersion,
+		ContainerName: cfg.ContainerName,
+		DatabaseName:  cfg.DatabaseName,
+		DumpFormat:    cfg.Format,
+		Content:       cfg.Content,
+		PgDumpVersion: s.clientVersion(cfg.ContainerName, "pg_dump"),
+		Extensions:    s.extensionVersions(cfg.ContainerName, cfg.DatabaseName, cfg.DatabaseUser),
+		StartedAt:     s.clock.Now(),
+		ToolVersion:   toolVersion,
+	}
+	if manifest.DumpFormat == "" {
+		manifest.DumpFormat = FormatPlain
+	}
+
+	s.events.OnPhase(PhaseDump)
+	outputPath, err := s.dump(cfg, manifest)
+	if err != nil {
+		return "", s.fail(err)
+	}
+	if cfg.Destination != "" {
+		if err := s.finishInStore(cfg, manifest, outputPath); err != nil {
+			return "", s.fail(err)
+		}
+		return outputPath, nil
+	}
+
+	// A duplicate is the file of a backup already in the catalog, so
+	// nothing of it may be rewritten or removed
+	var duplicate bool
+	if cfg.NameByHash {
+		outputPath, duplicate, err = renameByHash(outputPath, manifest.Checksum)
+		if err != nil {
+			return "", s.fail(err)
+		}
+		if duplicate && cfg.OnDuplicate != nil {
+			cfg.OnDuplicate(outputPath)
+		}
+	}
+	// The earlier backup's globals, sidecars, and manifest describe the
+	// same dump and stay as they are
+	if duplicate {
+		if _, err := os.Stat(GlobalsPath(outputPath)); cfg.Globals && err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s was stored without --globals; this run's roles and tablespaces aren't kept\n", outputPath)
+		}
+		return outputPath, nil
+	}
+
+	if cfg.Globals {
+		if _, err := s.dumpGlobals(cfg, outputPath); err != nil {
+			os.Remove(outputPath)
+			return "", s.fail(fmt.Errorf("failed to dump globals: %w", err))
+		}
+	}
+
+	artifacts := []string{outputPath}
+	if cfg.Globals {
+		artifacts = append(artifacts, GlobalsPath(outputPath))
+	}
+	// The dump was hashed as it was written; only the globals are read back
+	sums := map[string]string{outputPath: manifest.Checksum}
+	err = writeSidecars(artifacts, sums, cfg.SignKey)
+	if err == nil {
+		err = s.finishManifest(manifest, outputPath, cfg.Globals)
+	}
+	if err != nil {
+		for _, path := range artifacts {
+			RemoveBackup(path)
+		}
+		return "", s.fail(err)
+	}
+	return outputPath, nil
+}
+
+// writeSidecars writes the checksum file of each artifact, using the
+// checksums already known in sums, and its detached signature if signKey is
+// set
+func writeSidecars(artifacts []string, sums map[string]string, signKey string) error {
+	for _, path := range artifacts {
+		if err := writeChecksumFile(path, sums[path]); err != nil {
+			return err
+		}
+		if signKey != "" {
+			if _, err := SignFile(path, signKey); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// finishManifest records the finished backup at path in m and writes m
+// next to it
+func (s *Service) finishManifest(m *Manifest, path string, globals bool) error {
+	m.Backup = filepath.Base(path)
+	if globals {
+		m.Globals = filepath.Base(GlobalsPath(path))
+	}
+	m.FinishedAt = s.clock.Now()
+	return writeManifest(path, m)
+}
+
+// dump runs pg_dump and writes the compressed output to a timestamped file,
+// or streams it to cfg.Destination, noting how it was compressed and
+// encrypted in m
+func (s *Service) dump(cfg Config, m *Manifest) (string, error) {
+	if err := fault.Inject(fault.StageDump); err != nil {
+		return "", err
+	}
+
+	if cfg.Destination != "" && (cfg.NameByHash || cfg.SignKey != "" || cfg.Dictionary != "") {
+		return "", fmt.Errorf("naming by hash, signing, and compression dictionaries need a local output directory, not %s", cfg.Destination)
+	}
+
+	ext, err := formatExtension(cfg.Format)
+	if err != nil {
+		return "", err
+	}
+	if len(cfg.ExcludeColumns) > 0 && ext != plainExtension {
+		return "", fmt.Errorf("excluding columns needs the plain dump format")
+	}
+	content, err := contentExtension(cfg.Content)
+	if err != nil {
+		return "", err
+	}
+	if len(cfg.ExcludeColumns) > 0 && (content != "" || len(cfg.Tables) > 0 || len(cfg.ExcludeTables) > 0) {
+		return "", fmt.Errorf("excluding columns needs a full dump")
+	}
+	if cfg.Jobs > 1 && cfg.Format != FormatDirectory {
+		return "", fmt.Errorf("parallel jobs need the directory dump format")
+	}
+	if cfg.TableDigests && ext != plainExtension {
+		return "", fmt.Errorf("table digests need the plain dump format")
+	}
+	compression := cfg.Compression
+	if cfg.Dictionary != "" && compression == "" {
+		compression = CompressionZstd
+	}
+	comp, err := lookupCompressor(compression)
+	if err != nil {
+		return "", err
+	}
+	var levelArgs []string
+	m.CompressionLevel = cfg.CompressionLevel
+	if ext == plainExtension {
+		ext = comp.extension
+		m.Compression = comp.name
+		if err := comp.checkLevel(cfg.CompressionLevel); err != nil {
+			return "", err
+		}
+	} else if compression != "" {
+		return "", fmt.Errorf("choosing a compression needs the plain dump format")
+	} else if cfg.CompressionLevel != 0 {
+		// Custom and directory dumps are compressed by pg_dump
+		if cfg.CompressionLevel < 1 || cfg.CompressionLevel > pgDumpMaxLevel {
+			return "", fmt.Errorf("%s dump compression levels run from 1 to %d", cfg.Format, pgDumpMaxLevel)
+		}
+		levelArgs = []string{"-Z", strconv.Itoa(cfg.CompressionLevel)}
+	}
+	if m.Compression == "" {
+		m.Compression = "pg_dump"
+	}
+	if len(cfg.EncryptRecipients) > 0 && len(cfg.GPGRecipients) > 0 {
+		return "", fmt.Errorf("encrypt with age or GPG, not both")
+	}
+	// Fail before pg_dump starts if age or gpg is missing
+	if len(cfg.EncryptRecipients) > 0 {
+		if _, err := ageTool(); err != nil {
+			return "", err
+		}
+		ext += ageExtension
+		m.Encryption = "age"
+	}
+	if len(cfg.GPGRecipients) > 0 || cfg.SignKey != "" {
+		if _, err := gpgTool(); err != nil {
+			return "", err
+		}
+	}
+	if len(cfg.GPGRecipients) > 0 {
+		ext += gpgExtension
+		m.Encryption = "gpg"
+	}
+	if cfg.Dictionary != "" {
+		if comp.name != CompressionZstd {
+			return "", fmt.Errorf("compression dictionaries need zstd compression")
+		}
+		if err := storeDictionary(cfg.OutputDir, cfg.Dictionary); err != nil {
+			return "", err
+		}
 	}
 
 	// Generate filename with timestamp
-	filename := fmt.Sprintf("%s_%s.sql.gz",
+	filename := fmt.Sprintf("%s_%s%s",
 		cfg.DatabaseName,
-		cfg.Timestamp.Format("2006_01_02_15_04_05"))
-	outputPath := filepath.Join(cfg.OutputDir, filename)
+		cfg.Timestamp.Format(backupTimestampLayout), content+ext)
+
+	// Hash the file as it is written rather than reading it back after, and
+	// tees get the same compressed, and encrypted, bytes
+	hash := sha256.New()
+	var outputPath string
+	var outFile *os.File
+	tees := cfg.Tees
+	primary := io.Writer(hash)
+	if cfg.Destination != "" {
+		// The store is the first tee, and the only copy
+		stored, err := StoreTee(cfg.Destination)
+		if err != nil {
+			return "", err
+		}
+		tees = append([]Tee{stored}, tees...)
+	} else {
+		// Create output directory if it doesn't exist
+		if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create output directory: %w", err)
+		}
+		outputPath = filepath.Join(cfg.OutputDir, filename)
+		// Written under a temporary name until complete, so not even a
+		// crash can leave a partial dump that passes for a backup
+		if outFile, err = os.Create(outputPath + partialExtension); err != nil {
+			return "", fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer outFile.Close()
+		primary = io.MultiWriter(outFile, hash)
+	}
+	size := &sizeWriter{w: primary}
+	tee := startTees(size, tees, filename)
+	var w io.Writer = tee
+	encryptor, err := newEncryptor(tee, cfg)
+	if encryptor != nil {
+		w = encryptor
+	}
+	if err == nil {
+		err = s.writeDump(cfg, w, comp, levelArgs, m)
+	}
+	if encryptor != nil {
+		if cerr := encryptor.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("failed to encrypt backup: %w", cerr)
+		}
+	}
+	results := tee.finish(err)
+	if cfg.Destination != "" {
+		if stored := results[0]; err == nil && stored.Err != nil {
+			err = fmt.Errorf("failed to store backup in %s: %w", cfg.Destination, stored.Err)
+		} else {
+			outputPath = stored.Path
+		}
+		results = results[1:]
+	}
+	for _, result := range results {
+		if cfg.OnTee != nil {
+			cfg.OnTee(result)
+		}
+	}
+	if outFile != nil {
+		if cerr := outFile.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("failed to write backup: %w", cerr)
+		}
+		if err == nil {
+			err = os.Rename(outFile.Name(), outputPath)
+		}
+		if err != nil {
+			os.Remove(outFile.Name())
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	m.Size = size.n
+	m.Checksum = hex.EncodeToString(hash.Sum(nil))
+	return outputPath, nil
+}
+
+// newEncryptor encrypts what is written to it into w with age or GPG, as
+// cfg asks. It returns nil if the backup isn't encrypted.
+func newEncryptor(w io.Writer, cfg Config) (io.WriteCloser, error) {
+	switch {
+	case len(cfg.EncryptRecipients) > 0:
+		return newAgeWriter(w, cfg.EncryptRecipients)
+	case len(cfg.GPGRecipients) > 0:
+		return newGPGWriter(w, cfg.GPGRecipients)
+	}
+	return nil, nil
+}
+
+// writeDump writes the dump cfg describes to w, compressed with comp unless
+// pg_dump compresses it itself, and notes its size before compression, and
+// its table digests if asked for, in m
+func (s *Service) writeDump(cfg Config, w io.Writer, comp compressor, levelArgs []string, m *Manifest) error {
+	var err error
+	switch cfg.Format {
+	case FormatCustom:
+		// Custom archives are compressed by pg_dump itself
+		counted := &sizeWriter{w: w}
+		err = s.pgDump(cfg, counted, append([]string{"-Fc"}, levelArgs...)...)
+		m.UncompressedSize = counted.n
+		return err
+	case FormatDirectory:
+		m.UncompressedSize, err = s.dumpDirectory(cfg, w, levelArgs...)
+		return err
+	}
 
-	// Create output file
-	outFile, err := os.Create(outputPath)
+	compressor, err := comp.newWriter(w, cfg.CompressionLevel, cfg.CompressThreads, cfg.Dictionary)
 	if err != nil {
-		return "", fmt.Errorf("failed to create output file: %w", err)
+		return err
 	}
-	defer outFile.Close()
+	defer compressor.Close()
+
+	counted := &sizeWriter{w: compressor}
+	var out io.Writer = counted
+	var scanner *tableScanner
+	if cfg.TableDigests {
+		// Tables are digested from the SQL on its way to the compressor
+		scanner = startTableScanner()
+		defer scanner.finish()
+		out = io.MultiWriter(counted, scanner)
+	}
+	if len(cfg.ExcludeColumns) > 0 {
+		err = s.dumpExcludingColumns(cfg, out)
+	} else {
+		err = s.pgDump(cfg, out)
+	}
+	if err != nil {
+		return err
+	}
+	if err := compressor.Close(); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	m.UncompressedSize = counted.n
+	if scanner != nil {
+		if m.Tables, err = scanner.finish(); err != nil {
+			return fmt.Errorf("failed to digest tables: %w", err)
+		}
+	}
+	return nil
+}
 
-	// Create gzip writer
-	gzWriter := gzip.NewWriter(outFile)
-	defer gzWriter.Close()
+// pgDump streams pg_dump output for cfg into w
+func (s *Service) pgDump(cfg Config, w io.Writer, extraArgs ...string) error {
+	args := []string{"-U", cfg.DatabaseUser}
+	switch cfg.Content {
+	case ContentSchema:
+		args = append(args, "--schema-only")
+	case ContentData:
+		args = append(args, "--data-only")
+	}
+	for _, pattern := range cfg.Tables {
+		args = append(args, "-t", pattern)
+	}
+	for _, pattern := range cfg.ExcludeTables {
+		args = append(args, "-T", pattern)
+	}
+	args = append(args, extraArgs...)
+	return s.stream(cfg.ContainerName, w, "pg_dump", append(args, cfg.DatabaseName)...)
+}
 
-	// Execute pg_dump via docker exec
-	cmd := exec.Command("docker", "exec", cfg.ContainerName,
-		"pg_dump", "-U", cfg.DatabaseUser, cfg.DatabaseName)
+// stream runs a client tool in the container and copies its output into w
+func (s *Service) stream(containerName string, w io.Writer, name string, args ...string) error {
+	cmd := s.dockerSvc.Command(containerName, false, append([]string{name}, args...)...)
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return "", fmt.Errorf("failed to create stdout pipe: %w", err)
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
 	}
 
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		return "", fmt.Errorf("failed to create stderr pipe: %w", err)
+		return fmt.Errorf("failed to create stderr pipe: %w", err)
 	}
 
 	if err := cmd.Start(); err != nil {
-		return "", fmt.Errorf("failed to start pg_dump: %w", err)
+		return fmt.Errorf("failed to start %s: %w", name, err)
 	}
 
 	// Copy and compress the output
-	if _, err := io.Copy(gzWriter, stdout); err != nil {
-		return "", fmt.Errorf("failed to write backup: %w", err)
+	if _, err := io.Copy(newProgressWriter(w, s.events), stdout); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
 	}
 
 	// Read any error output
@@ -77,38 +428,112 @@ func (s *Service) Backup(cfg Config) (string, error) {
 
 	if err := cmd.Wait(); err != nil {
 		if len(stderrOutput) > 0 {
-			return "", fmt.Errorf("pg_dump failed: %w\nError output: %s", err, string(stderrOutput))
+			return fmt.Errorf("%s failed: %w\nError output: %s", name, err, string(stderrOutput))
 		}
-		return "", fmt.Errorf("pg_dump failed: %w", err)
+		return fmt.Errorf("%s failed: %w", name, err)
 	}
 
-	return outputPath, nil
+	return nil
 }
 
 // Restore restores a PostgreSQL backup from a compressed file
 func (s *Service) Restore(cfg RestoreConfig) error {
+	return s.fail(s.restore(cfg))
+}
+
+func (s *Service) restore(cfg RestoreConfig) error {
+	if err := fault.Inject(fault.StageRestore); err != nil {
+		return err
+	}
+
+	// A truncated file would otherwise restore a partial database
+	var checked bool
+	for _, path := range []string{cfg.BackupPath, cfg.Globals} {
+		if path == "" {
+			continue
+		}
+		ok, err := VerifyChecksumFile(path)
+		if err != nil {
+			return err
+		}
+		if ok {
+			fmt.Printf("✓ %s matches %s\n", path, ChecksumPath(path))
+		}
+		checked = checked || (ok && path == cfg.BackupPath)
+	}
+	manifest, err := CheckManifest(cfg.BackupPath, !checked)
+	if err != nil {
+		return err
+	}
+
 	// Verify container exists
 	if err := s.dockerSvc.VerifyContainer(cfg.ContainerName); err != nil {
 		return fmt.Errorf("container verification failed: %w", err)
 	}
 
-	// Open backup file
-	backupFile, err := os.Open(cfg.BackupPath)
-	if err != nil {
-		return fmt.Errorf("failed to open backup file: %w", err)
+	format := cfg.Format
+	if format == "" {
+		format = DumpFormat(cfg.BackupPath)
+	}
+	if manifest != nil {
+		s.reportManifest(cfg.ContainerName, format, manifest)
 	}
-	defer backupFile.Close()
 
-	// Create gzip reader
-	gzReader, err := gzip.NewReader(backupFile)
-	if err != nil {
-		return fmt.Errorf("failed to create gzip reader: %w", err)
+	// Open the backup, decompressing plain dumps
+	var script io.Reader
+	switch format {
+	case FormatPlain:
+		if cfg.Jobs > 1 {
+			return fmt.Errorf("parallel restore jobs need a custom or directory-format dump")
+		}
+		gzReader, err := OpenBackup(cfg.BackupPath)
+		if err != nil {
+			return err
+		}
+		defer gzReader.Close()
+		script = gzReader
+		if cfg.SchemaOnly {
+			schema := schemaOnly(gzReader)
+			defer schema.Close()
+			script = schema
+		}
+	case FormatCustom, FormatDirectory:
+		f, err := openDecrypted(cfg.BackupPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		script = f
+	default:
+		return fmt.Errorf("unknown dump format %q", format)
+	}
+
+	dataOnly := DumpContent(cfg.BackupPath) == ContentData
+	if dataOnly && cfg.SchemaOnly {
+		return fmt.Errorf("%s is a data-only dump and has no schema to restore", cfg.BackupPath)
+	}
+	if dataOnly && cfg.DropExisting {
+		return fmt.Errorf("%s is a data-only dump, which needs the database's existing schema; restore it without dropping the database", cfg.BackupPath)
+	}
+
+	if cfg.ValidateOnly {
+		if dataOnly {
+			return fmt.Errorf("%s is a data-only dump, which needs a database's existing schema to load into; it can't be validated on its own", cfg.BackupPath)
+		}
+		return s.validate(cfg, format, script)
+	}
+
+	// Roles and tablespaces go first so the dump's owners and grants resolve
+	if cfg.Globals != "" {
+		if err := s.replayGlobals(cfg.ContainerName, cfg.DatabaseUser, cfg.Globals); err != nil {
+			return fmt.Errorf("failed to restore globals: %w", err)
+		}
 	}
-	defer gzReader.Close()
 
 	// Drop existing database if requested
 	if cfg.DropExisting {
-		dropCmd := exec.Command("docker", "exec", cfg.ContainerName,
+		s.events.OnPhase(PhaseDrop)
+		dropCmd := s.dockerSvc.Command(cfg.ContainerName, false,
 			"psql", "-U", cfg.DatabaseUser, "-d", "template1", "-c",
 			fmt.Sprintf("DROP DATABASE IF EXISTS %s;", cfg.DatabaseName))
 		if output, err := dropCmd.CombinedOutput(); err != nil {
@@ -116,39 +541,63 @@ func (s *Service) Restore(cfg RestoreConfig) error {
 		}
 	}
 
-	// Create database
-	createCmd := exec.Command("docker", "exec", cfg.ContainerName,
-		"psql", "-U", cfg.DatabaseUser, "-d", "template1", "-c",
-		fmt.Sprintf("CREATE DATABASE %s;", cfg.DatabaseName))
-	if output, err := createCmd.CombinedOutput(); err != nil {
-		// Ignore error if database already exists
-		if !cfg.DropExisting {
-			fmt.Printf("Warning: Database may already exist: %s\n", string(output))
-		} else {
-			return fmt.Errorf("failed to create database: %w\nOutput: %s", err, string(output))
+	// Create database; a data-only dump loads into the one that exists
+	if dataOnly {
+		exists, err := s.DatabaseExists(cfg.ContainerName, cfg.DatabaseName, cfg.DatabaseUser)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%s is a data-only dump, but database '%s' doesn't exist; restore its schema first", cfg.BackupPath, cfg.DatabaseName)
+		}
+	} else {
+		s.events.OnPhase(PhaseCreate)
+		createCmd := s.dockerSvc.Command(cfg.ContainerName, false,
+			"psql", "-U", cfg.DatabaseUser, "-d", "template1", "-c",
+			fmt.Sprintf("CREATE DATABASE %s;", cfg.DatabaseName))
+		if output, err := createCmd.CombinedOutput(); err != nil {
+			// Ignore error if database already exists
+			if !cfg.DropExisting {
+				fmt.Printf("Warning: Database may already exist: %s\n", string(output))
+			} else {
+				return fmt.Errorf("failed to create database: %w\nOutput: %s", err, string(output))
+			}
 		}
 	}
 
+	if cfg.BytesPerSecond > 0 {
+		script = newPacedReader(script, cfg.BytesPerSecond)
+	}
+
+	s.events.OnPhase(PhaseRestore)
+	if format != FormatPlain {
+		return s.pgRestore(cfg, format, script)
+	}
+
 	// Restore via psql
-	restoreCmd := exec.Command("docker", "exec", "-i", cfg.ContainerName,
-		"psql", "-U", cfg.DatabaseUser, "-d", cfg.DatabaseName)
+	return s.feed(cfg.ContainerName, script, "psql", "-U", cfg.DatabaseUser, "-d", cfg.DatabaseName)
+}
 
-	stdin, err := restoreCmd.StdinPipe()
+// feed runs a command in the container with r on its standard input
+func (s *Service) feed(containerName string, r io.Reader, name string, args ...string) error {
+	cmd := s.dockerSvc.Command(containerName, true, append([]string{name}, args...)...)
+
+	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return fmt.Errorf("failed to create stdin pipe: %w", err)
 	}
 
-	stderr, err := restoreCmd.StderrPipe()
+	stderr, err := cmd.StderrPipe()
 	if err != nil {
 		return fmt.Errorf("failed to create stderr pipe: %w", err)
 	}
 
-	if err := restoreCmd.Start(); err != nil {
-		return fmt.Errorf("failed to start restore: %w", err)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", name, err)
 	}
 
-	// Copy decompressed backup to psql
-	if _, err := io.Copy(stdin, gzReader); err != nil {
+	// Copy decompressed backup to the command
+	if _, err := io.Copy(newProgressWriter(stdin, s.events), r); err != nil {
 		return fmt.Errorf("failed to restore backup: %w", err)
 	}
 	stdin.Close()
@@ -156,44 +605,110 @@ func (s *Service) Restore(cfg RestoreConfig) error {
 	// Read any error output
 	stderrOutput, _ := io.ReadAll(stderr)
 
-	if err := restoreCmd.Wait(); err != nil {
+	if err := cmd.Wait(); err != nil {
 		if len(stderrOutput) > 0 {
-			return fmt.Errorf("restore failed: %w\nError output: %s", err, string(stderrOutput))
+			return fmt.Errorf("%s failed: %w\nError output: %s", name, err, string(stderrOutput))
 		}
-		return fmt.Errorf("restore failed: %w", err)
+		return fmt.Errorf("%s failed: %w", name, err)
 	}
 
 	return nil
 }
 
+// DatabaseExists reports whether dbName exists in the container
+func (s *Service) DatabaseExists(containerName, dbName, dbUser string) (bool, error) {
+	output, err := s.dockerSvc.Exec(containerName, []string{
+		"psql", "-U", dbUser, "-d", "template1", "-tA", "-c",
+		fmt.Sprintf("SELECT 1 FROM pg_database WHERE datname = '%s';", strings.ReplaceAll(dbName, "'", "''")),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to query databases: %w\nOutput: %s", err, string(output))
+	}
+	return strings.TrimSpace(string(output)) == "1", nil
+}
+
+// DatabaseContents is what a database holds before a restore into it
+type DatabaseContents struct {
+	// Tables are its user tables, as quoted schema.table names
+	Tables []string
+	// Filled are the tables with at least one row
+	Filled []string
+}
+
+// Contents returns the user tables of dbName and which of them have rows,
+// or nil if the database doesn't exist
+func (s *Service) Contents(containerName, dbName, dbUser string) (*DatabaseContents, error) {
+	if err := s.dockerSvc.VerifyContainer(containerName); err != nil {
+		return nil, fmt.Errorf("container verification failed: %w", err)
+	}
+	exists, err := s.DatabaseExists(containerName, dbName, dbUser)
+	if err != nil || !exists {
+		return nil, err
+	}
+	tables, err := s.listTables(containerName, dbName, dbUser, nil)
+	if err != nil {
+		return nil, err
+	}
+	contents := &DatabaseContents{Tables: tables}
+	if len(tables) == 0 {
+		return contents, nil
+	}
+
+	// One probe per table stops at its first row, however big the table is
+	probes := make([]string, len(tables))
+	for i, t := range tables {
+		probes[i] = fmt.Sprintf("SELECT '%s' WHERE EXISTS (SELECT 1 FROM %s)", strings.ReplaceAll(t, "'", "''"), t)
+	}
+	output, err := s.dockerSvc.Exec(containerName, []string{
+		"psql", "-U", dbUser, "-d", dbName, "-tA", "-c", strings.Join(probes, " UNION ALL ") + ";",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check tables for rows: %w\nOutput: %s", err, string(output))
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if t := strings.TrimSpace(line); t != "" {
+			contents.Filled = append(contents.Filled, t)
+		}
+	}
+	return contents, nil
+}
+
 // Verify compares two databases to ensure they contain the same data
 func (s *Service) Verify(cfg VerifyConfig) (bool, error) {
+	result, err := s.VerifyReport(cfg)
+	if err != nil {
+		return false, err
+	}
+	return result.Match, nil
+}
+
+// VerifyReport compares two databases and reports which tables differ
+func (s *Service) VerifyReport(cfg VerifyConfig) (*VerifyResult, error) {
 	// Verify both containers exist
 	if err := s.dockerSvc.VerifyContainer(cfg.SourceContainer); err != nil {
-		return false, fmt.Errorf("source container verification failed: %w", err)
+		return nil, s.fail(fmt.Errorf("source container verification failed: %w", err))
 	}
 	if err := s.dockerSvc.VerifyContainer(cfg.TargetContainer); err != nil {
-		return false, fmt.Errorf("target container verification failed: %w", err)
+		return nil, s.fail(fmt.Errorf("target container verification failed: %w", err))
 	}
 
-	// Get checksums of both databases
-	sourceChecksum, err := s.getDatabaseChecksum(cfg.SourceContainer, cfg.DatabaseName, cfg.DatabaseUser)
+	s.events.OnPhase(PhaseChecksum)
+	result, err := s.compareDatabase(cfg)
 	if err != nil {
-		return false, fmt.Errorf("failed to get source checksum: %w", err)
+		return nil, s.fail(err)
 	}
-
-	targetChecksum, err := s.getDatabaseChecksum(cfg.TargetContainer, cfg.DatabaseName, cfg.DatabaseUser)
-	if err != nil {
-		return false, fmt.Errorf("failed to get target checksum: %w", err)
-	}
-
-	return sourceChecksum == targetChecksum, nil
+	return result, nil
 }
 
-// getDatabaseChecksum generates a checksum of the database contents
-func (s *Service) getDatabaseChecksum(containerName, dbName, dbUser string) (string, error) {
-	cmd := exec.Command("docker", "exec", containerName,
-		"pg_dump", "-U", dbUser, "--data-only", "--inserts", dbName)
+// getDatabaseChecksum generates a checksum of the database contents,
+// leaving out the data of the ignored schema.table names
+func (s *Service) getDatabaseChecksum(containerName, dbName, dbUser string, ignore []string) (string, error) {
+	args := []string{"pg_dump", "-U", dbUser, "--data-only", "--inserts"}
+	for _, name := range ignore {
+		schema, table, _ := strings.Cut(name, ".")
+		args = append(args, "--exclude-table-data="+subset.QuoteIdent(schema)+"."+subset.QuoteIdent(table))
+	}
+	cmd := s.dockerSvc.Command(containerName, false, append(args, dbName)...)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -0,0 +1,243 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// StandbyStatus tracks the state of a warm standby so it can be reported while the loop runs
+type StandbyStatus struct {
+	mu         sync.Mutex
+	lastBackup string
+	backupTime time.Time
+	restoredAt time.Time
+	lastErr    error
+	restores   int
+	failures   int
+	blackout   bool
+	skipped    int
+}
+
+// StandbySnapshot is a point-in-time copy of a StandbyStatus
+type StandbySnapshot struct {
+	LastBackup string
+	BackupTime time.Time
+	RestoredAt time.Time
+	LastError  error
+	Restores   int
+	Failures   int
+	// InBlackout reports whether syncs are currently suspended by a blackout window
+	InBlackout bool
+	// Skipped counts sync attempts skipped by blackout windows
+	Skipped int
+}
+
+// Snapshot returns a copy of the current standby state
+func (st *StandbyStatus) Snapshot() StandbySnapshot {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return StandbySnapshot{
+		LastBackup: st.lastBackup,
+		BackupTime: st.backupTime,
+		RestoredAt: st.restoredAt,
+		LastError:  st.lastErr,
+		Restores:   st.restores,
+		Failures:   st.failures,
+		InBlackout: st.blackout,
+		Skipped:    st.skipped,
+	}
+}
+
+// Staleness returns how far behind the standby is, measured from the timestamp
+// of the backup it currently holds. It returns false if nothing was restored yet.
+func (st *StandbyStatus) Staleness(now time.Time) (time.Duration, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.backupTime.IsZero() {
+		return 0, false
+	}
+	return now.Sub(st.backupTime), true
+}
+
+func (st *StandbyStatus) recordRestore(path string, backupTime, restoredAt time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.lastBackup = path
+	st.backupTime = backupTime
+	st.restoredAt = restoredAt
+	st.lastErr = nil
+	st.restores++
+}
+
+func (st *StandbyStatus) recordBlackout(active bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.blackout = active
+	if active {
+		st.skipped++
+	}
+}
+
+func (st *StandbyStatus) recordFailure(err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.lastErr = err
+	st.failures++
+}
+
+// standbyState is what a standby records of the backup it last restored
+type standbyState struct {
+	Backup     string    `json:"backup"`
+	BackupTime time.Time `json:"backup_time"`
+	RestoredAt time.Time `json:"restored_at"`
+}
+
+// loadStandbyState picks status up from the state file at path, if there
+// is one
+func loadStandbyState(path string, status *StandbyStatus) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read standby state: %w", err)
+	}
+	var st standbyState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return fmt.Errorf("failed to parse standby state %s: %w", path, err)
+	}
+	status.mu.Lock()
+	defer status.mu.Unlock()
+	status.lastBackup, status.backupTime, status.restoredAt = st.Backup, st.BackupTime, st.RestoredAt
+	return nil
+}
+
+func saveStandbyState(path string, snap StandbySnapshot) error {
+	data, err := json.Marshal(standbyState{Backup: snap.LastBackup, BackupTime: snap.BackupTime, RestoredAt: snap.RestoredAt})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create standby state directory: %w", err)
+	}
+	if err := os.WriteFile(path+partialExtension, data, 0644); err != nil {
+		return fmt.Errorf("failed to write standby state: %w", err)
+	}
+	return os.Rename(path+partialExtension, path)
+}
+
+// Standby keeps a standby container in sync by restoring every new backup
+// that appears in cfg.BackupDir. It blocks until ctx is cancelled, unless
+// cfg.Once is set.
+func (s *Service) Standby(ctx context.Context, cfg StandbyConfig, status *StandbyStatus) error {
+	if cfg.Interval <= 0 && !cfg.Once {
+		return fmt.Errorf("standby interval must be positive")
+	}
+	if status == nil {
+		status = &StandbyStatus{}
+	}
+	if cfg.StatePath != "" {
+		if err := loadStandbyState(cfg.StatePath, status); err != nil {
+			return err
+		}
+	}
+	if cfg.Once {
+		return s.standbyOnce(cfg, status)
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	wasPaused := false
+	for {
+		paused := cfg.Paused != nil && cfg.Paused()
+		switch {
+		case paused && !wasPaused:
+			fmt.Println("Standby paused, skipping syncs until resumed")
+		case !paused && wasPaused:
+			fmt.Println("Standby resumed")
+		}
+		wasPaused = paused
+
+		window, until, inBlackout := cfg.Blackouts.ActiveAt(s.clock.Now())
+		if !paused {
+			status.recordBlackout(inBlackout)
+			if inBlackout {
+				fmt.Printf("Blackout window %q active until %s, skipping sync\n", window.String(), until.Format(time.RFC3339))
+			}
+		}
+
+		if !paused && !inBlackout {
+			if err := s.syncStandby(cfg, status); err != nil {
+				status.recordFailure(err)
+				fmt.Fprintf(os.Stderr, "Standby sync failed: %v\n", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// standbyOnce is one pass of the loop, its sync's error returned rather
+// than counted
+func (s *Service) standbyOnce(cfg StandbyConfig, status *StandbyStatus) error {
+	if cfg.Paused != nil && cfg.Paused() {
+		fmt.Println("Standby paused, skipping sync")
+		return nil
+	}
+	if window, until, inBlackout := cfg.Blackouts.ActiveAt(s.clock.Now()); inBlackout {
+		fmt.Printf("Blackout window %q active until %s, skipping sync\n", window.String(), until.Format(time.RFC3339))
+		return nil
+	}
+	return s.syncStandby(cfg, status)
+}
+
+// syncStandby restores the newest backup if it hasn't been restored already
+func (s *Service) syncStandby(cfg StandbyConfig, status *StandbyStatus) error {
+	path, backupTime, err := LatestBackup(cfg.BackupDir, cfg.DatabaseName)
+	if err != nil {
+		return err
+	}
+
+	current := status.Snapshot()
+	if path == current.LastBackup || !backupTime.After(current.BackupTime) {
+		if cfg.Once {
+			fmt.Printf("Standby is already at %s\n", current.BackupTime.Format(time.RFC3339))
+		}
+		return nil
+	}
+
+	fmt.Printf("Restoring %s into standby container '%s'...\n", path, cfg.ContainerName)
+	err = s.Restore(RestoreConfig{
+		ContainerName: cfg.ContainerName,
+		DatabaseName:  cfg.DatabaseName,
+		DatabaseUser:  cfg.DatabaseUser,
+		BackupPath:    path,
+		DropExisting:  true,
+	})
+	if cfg.OnRestore != nil {
+		cfg.OnRestore(path, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %w", path, err)
+	}
+
+	status.recordRestore(path, backupTime, s.clock.Now())
+	fmt.Printf("Standby is now at %s\n", backupTime.Format(time.RFC3339))
+	if cfg.StatePath != "" {
+		if err := saveStandbyState(cfg.StatePath, status.Snapshot()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
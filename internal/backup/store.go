@@ -0,0 +1,226 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/iostate/back-it-up/internal/storage"
+)
+
+// maxSidecarSize bounds how much of a stored sidecar is read
+const maxSidecarSize = 16 << 20
+
+// StoreTee returns a tee that streams a backup into the object store at
+// location, such as s3://bucket/prefix, while it is being written
+func StoreTee(location string) (Tee, error) {
+	store, prefix, err := storage.Open(location)
+	if err != nil {
+		return Tee{}, err
+	}
+	return Tee{Location: location, Upload: func(name string, r io.Reader) (string, error) {
+		key := storage.Join(prefix, name)
+		if err := store.Put(key, r); err != nil {
+			return "", err
+		}
+		return store.Location(key), nil
+	}}, nil
+}
+
+// finishInStore stores the globals, checksum, and manifest of the backup
+// streamed to location. If any of them fails, the backup is deleted, as a
+// local one would be.
+func (s *Service) finishInStore(cfg Config, m *Manifest, location string) error {
+	store, key, err := storage.Open(location)
+	if err != nil {
+		return err
+	}
+	stored := []string{key}
+	err = s.storeGlobals(cfg, store, key, &stored)
+	if err == nil {
+		m.Backup = path.Base(key)
+		if cfg.Globals {
+			m.Globals = path.Base(GlobalsPath(key))
+		}
+		m.FinishedAt = s.clock.Now()
+		err = putSidecars(store, key, m.Checksum, m, &stored)
+	}
+	if err != nil {
+		for _, k := range stored {
+			store.Delete(k)
+		}
+		return err
+	}
+	return nil
+}
+
+// storeGlobals takes the globals of a backup stored as key through a
+// temporary file, since pg_dumpall runs after the dump has been uploaded,
+// and stores them with their checksum. stored collects the keys written.
+func (s *Service) storeGlobals(cfg Config, store storage.Store, key string, stored *[]string) error {
+	if !cfg.Globals {
+		return nil
+	}
+	dir, err := MkdirScratch("globals-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	local, err := s.dumpGlobals(cfg, filepath.Join(dir, path.Base(key)))
+	if err != nil {
+		return fmt.Errorf("failed to dump globals: %w", err)
+	}
+	sum, err := FileChecksum(local)
+	if err != nil {
+		return fmt.Errorf("failed to checksum globals: %w", err)
+	}
+	f, err := os.Open(local)
+	if err != nil {
+		return fmt.Errorf("failed to open globals file: %w", err)
+	}
+	defer f.Close()
+
+	globalsKey := GlobalsPath(key)
+	*stored = append(*stored, globalsKey)
+	if err := store.Put(globalsKey, f); err != nil {
+		return fmt.Errorf("failed to store globals: %w", err)
+	}
+	return putSidecars(store, globalsKey, sum, nil, stored)
+}
+
+// putSidecars stores the checksum file of the object stored as key and, if
+// m is set, its manifest. stored collects the keys written.
+func putSidecars(store storage.Store, key, sum string, m *Manifest, stored *[]string) error {
+	sidecars := map[string][]byte{ChecksumPath(key): checksumLine(sum, path.Base(key))}
+	if m != nil {
+		data, err := encodeManifest(m)
+		if err != nil {
+			return err
+		}
+		sidecars[ManifestPath(key)] = data
+	}
+	for k, data := range sidecars {
+		*stored = append(*stored, k)
+		if err := store.Put(k, bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("failed to store %s: %w", store.Location(k), err)
+		}
+	}
+	return nil
+}
+
+// openRaw opens the backup at path as it is stored, without decrypting or
+// decompressing it. A backup in an object store is streamed from it and,
+// if it has a checksum file, checked against it as it is read.
+func openRaw(path string) (io.ReadCloser, error) {
+	if !storage.IsLocation(path) {
+		return os.Open(path)
+	}
+	store, key, err := storage.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := storedChecksum(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	r, err := store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if sum == "" {
+		return r, nil
+	}
+	return &verifyingReader{ReadCloser: r, path: path, expected: sum, hash: sha256.New()}, nil
+}
+
+// readSidecar reads the sidecar at path, next to a local backup or in the
+// store of a stored one. A missing sidecar is reported as fs.ErrNotExist.
+func readSidecar(path string) ([]byte, error) {
+	if !storage.IsLocation(path) {
+		return os.ReadFile(path)
+	}
+	store, key, err := storage.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(io.LimitReader(r, maxSidecarSize))
+}
+
+// storedChecksum returns the SHA-256 recorded in the checksum file of the
+// backup at path
+func storedChecksum(path string) (string, error) {
+	data, err := readSidecar(ChecksumPath(path))
+	if err != nil {
+		return "", err
+	}
+	sum, ok := parseChecksumLine(data)
+	if !ok {
+		return "", fmt.Errorf("malformed checksum file %s", ChecksumPath(path))
+	}
+	return sum, nil
+}
+
+// BackupSize returns the size of the backup at path: the file's, or for a
+// stored backup, the one its manifest recorded
+func BackupSize(path string) (int64, error) {
+	if !storage.IsLocation(path) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	m, err := ReadManifest(path)
+	if err != nil {
+		return 0, err
+	}
+	if m == nil {
+		return 0, fmt.Errorf("%s has no manifest: %w", path, fs.ErrNotExist)
+	}
+	return m.Size, nil
+}
+
+// BackupExists reports whether there is a backup at path, on disk or in an
+// object store
+func BackupExists(path string) bool {
+	r, err := openRaw(path)
+	if err != nil {
+		return false
+	}
+	r.Close()
+	return true
+}
+
+// verifyingReader checks a stored backup against its recorded checksum once
+// it has been read to the end
+type verifyingReader struct {
+	io.ReadCloser
+	path     string
+	expected string
+	hash     hash.Hash
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF {
+		if actual := hex.EncodeToString(r.hash.Sum(nil)); actual != r.expected {
+			return n, fmt.Errorf("checksum mismatch for %s: %s has %s, download has %s; the backup is truncated or corrupted",
+				r.path, ChecksumPath(r.path), r.expected, actual)
+		}
+	}
+	return n, err
+}
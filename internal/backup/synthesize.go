@@ -0,0 +1,91 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/iostate/back-it-up/internal/dump"
+	"github.com/iostate/back-it-up/internal/subset"
+	"github.com/iostate/back-it-up/internal/synth"
+)
+
+// SynthesizeResult reports what Synthesize generated
+type SynthesizeResult struct {
+	Tables []SeedTable
+	// Failed lists tables whose generated rows were rejected, with the error
+	Failed []string
+	// Skipped lists tables that weren't filled, with the reason
+	Skipped []string
+}
+
+// Synthesize fills every table of a database with generated rows, parents
+// before children, so load tests run against realistic volumes without any
+// real data. A table whose constraints reject the generated rows is
+// reported and left empty; the rest are still filled.
+func (s *Service) Synthesize(cfg SynthesizeConfig) (*SynthesizeResult, error) {
+	result, err := s.synthesize(cfg)
+	if err != nil {
+		return nil, s.fail(err)
+	}
+	return result, nil
+}
+
+func (s *Service) synthesize(cfg SynthesizeConfig) (*SynthesizeResult, error) {
+	psql := []string{"psql", "-X", "-v", "ON_ERROR_STOP=1", "-U", cfg.DatabaseUser, "-d", cfg.DatabaseName}
+
+	output, err := s.dockerSvc.Exec(cfg.ContainerName, append(psql, "-tA", "-c", subset.SchemaQuery))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w\nOutput: %s", err, string(output))
+	}
+	schema, err := subset.ParseSchema(output)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := synth.Build(schema, cfg.Rows)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SynthesizeResult{Skipped: plan.Skipped}
+	s.events.OnPhase(PhaseRestore)
+	for _, insert := range plan.Inserts {
+		output, err := s.dockerSvc.Exec(cfg.ContainerName, append(psql, "-c", insert.SQL))
+		if err != nil {
+			result.Failed = append(result.Failed, fmt.Sprintf("%s: %s", insert.Table, strings.TrimSpace(string(output))))
+			continue
+		}
+		// psql reports "INSERT 0 <rows>"
+		var rows int64
+		if fields := strings.Fields(string(output)); len(fields) > 0 {
+			rows, _ = strconv.ParseInt(fields[len(fields)-1], 10, 64)
+		}
+		result.Tables = append(result.Tables, SeedTable{Table: insert.Table, Rows: rows})
+	}
+	for _, stmt := range plan.Sequences {
+		if output, err := s.dockerSvc.Exec(cfg.ContainerName, append(psql, "-q", "-c", stmt)); err != nil {
+			return nil, fmt.Errorf("failed to advance sequence: %w\nOutput: %s", err, string(output))
+		}
+	}
+	return result, nil
+}
+
+// schemaOnly filters a plain dump down to its schema statements, dropping
+// COPY data, INSERT rows, and sequence positions. Closing the result stops
+// the filter early.
+func schemaOnly(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(dump.Scan(r, dump.Handler{
+			Statement: func(stmt string) error {
+				if strings.HasPrefix(stmt, "SELECT pg_catalog.setval(") {
+					return nil
+				}
+				_, err := io.WriteString(pw, stmt+"\n\n")
+				return err
+			},
+		}))
+	}()
+	return pr
+}
@@ -0,0 +1,111 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// Tee is an extra destination the compressed dump is streamed to while the
+// local file is written, so a remote copy needs neither a second pg_dump nor
+// an upload afterwards
+type Tee struct {
+	// Location names the destination in messages
+	Location string
+	// Upload stores everything read from r, up to EOF, under name and
+	// returns where the copy landed. r fails instead of reaching EOF if
+	// the dump fails, and Upload must not commit anything then.
+	Upload func(name string, r io.Reader) (string, error)
+}
+
+// TeeResult is the outcome of one Tee, tracked independently of the local
+// file and of the other tees
+type TeeResult struct {
+	Location string
+	Path     string
+	Size     int64
+	SHA256   string
+	Err      error
+}
+
+// teeSink feeds one Tee through a pipe from its own goroutine
+type teeSink struct {
+	tee  Tee
+	pipe *io.PipeWriter
+	hash hash.Hash
+	size int64
+	// failed is set on the writer side once the upload stops reading
+	failed error
+
+	path string
+	err  error
+	done chan struct{}
+}
+
+// teeWriter writes to the local file and to every sink still accepting data.
+// A sink that fails is dropped without affecting the local file or the
+// others, though a slow one does hold the dump back to its pace.
+type teeWriter struct {
+	primary io.Writer
+	sinks   []*teeSink
+}
+
+// startTees begins the uploads for a dump named name
+func startTees(primary io.Writer, tees []Tee, name string) *teeWriter {
+	w := &teeWriter{primary: primary}
+	for _, t := range tees {
+		pr, pw := io.Pipe()
+		sink := &teeSink{tee: t, pipe: pw, hash: sha256.New(), done: make(chan struct{})}
+		go func() {
+			defer close(sink.done)
+			sink.path, sink.err = t.Upload(name, pr)
+			// Unblock the writer if the upload returned without draining the pipe
+			pr.CloseWithError(fmt.Errorf("upload stopped reading"))
+		}()
+		w.sinks = append(w.sinks, sink)
+	}
+	return w
+}
+
+func (w *teeWriter) Write(p []byte) (int, error) {
+	n, err := w.primary.Write(p)
+	for _, sink := range w.sinks {
+		if sink.failed != nil || n == 0 {
+			continue
+		}
+		if _, werr := sink.pipe.Write(p[:n]); werr != nil {
+			sink.failed = werr
+			continue
+		}
+		sink.hash.Write(p[:n])
+		sink.size += int64(n)
+	}
+	return n, err
+}
+
+// finish ends every upload, aborting them if dumpErr is set, and waits for
+// their outcomes
+func (w *teeWriter) finish(dumpErr error) []TeeResult {
+	results := make([]TeeResult, 0, len(w.sinks))
+	for _, sink := range w.sinks {
+		if dumpErr != nil {
+			sink.pipe.CloseWithError(dumpErr)
+		} else {
+			sink.pipe.Close()
+		}
+		<-sink.done
+
+		result := TeeResult{Location: sink.tee.Location, Path: sink.path, Size: sink.size, SHA256: fmt.Sprintf("%x", sink.hash.Sum(nil))}
+		switch {
+		case dumpErr != nil:
+			result.Err = fmt.Errorf("dump failed: %w", dumpErr)
+		case sink.err != nil:
+			result.Err = sink.err
+		case sink.failed != nil:
+			result.Err = fmt.Errorf("upload ended early: %w", sink.failed)
+		}
+		results = append(results, result)
+	}
+	return results
+}
@@ -0,0 +1,65 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/iostate/back-it-up/internal/fault"
+)
+
+// UploadConfig describes where to PUT a backup over HTTP(S)
+type UploadConfig struct {
+	// URL is the destination; one ending in "/" is a directory and the
+	// backup's file name is appended
+	URL     string
+	Headers http.Header
+}
+
+// Upload streams r to cfg.URL with a chunked PUT and then publishes a
+// "<url>.sha256" sidecar, the file Download verifies against. It returns
+// the URL the backup was stored at.
+func Upload(cfg UploadConfig, name string, r io.Reader) (string, error) {
+	target := cfg.URL
+	if strings.HasSuffix(target, "/") {
+		target += path.Base(name)
+	}
+
+	h := sha256.New()
+	if err := put(target, cfg.Headers, io.TeeReader(r, h)); err != nil {
+		return "", fmt.Errorf("failed to upload backup: %w", err)
+	}
+	sidecar := fmt.Sprintf("%x  %s\n", h.Sum(nil), path.Base(target))
+	if err := put(target+".sha256", cfg.Headers, strings.NewReader(sidecar)); err != nil {
+		return "", fmt.Errorf("failed to upload checksum: %w", err)
+	}
+	return target, nil
+}
+
+func put(url string, headers http.Header, body io.Reader) error {
+	if err := fault.Inject(fault.StageUpload); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header = headers.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
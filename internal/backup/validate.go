@@ -0,0 +1,40 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+)
+
+// validate loads the dump read from r into a scratch database, in one
+// transaction that stops at the first error, and drops the database after,
+// so the dump is known to restore without touching cfg.DatabaseName
+func (s *Service) validate(cfg RestoreConfig, format string, r io.Reader) error {
+	scratch := fmt.Sprintf("%s_validate_%d", cfg.DatabaseName, s.clock.Now().Unix())
+
+	s.events.OnPhase(PhaseCreate)
+	createCmd := s.dockerSvc.Command(cfg.ContainerName, false,
+		"psql", "-U", cfg.DatabaseUser, "-d", "template1", "-c",
+		fmt.Sprintf("CREATE DATABASE %s;", scratch))
+	if output, err := createCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create scratch database: %w\nOutput: %s", err, string(output))
+	}
+	defer func() {
+		dropCmd := s.dockerSvc.Command(cfg.ContainerName, false,
+			"psql", "-U", cfg.DatabaseUser, "-d", "template1", "-c",
+			fmt.Sprintf("DROP DATABASE IF EXISTS %s;", scratch))
+		if output, err := dropCmd.CombinedOutput(); err != nil {
+			fmt.Printf("Warning: failed to drop scratch database '%s': %v\nOutput: %s\n", scratch, err, string(output))
+		}
+	}()
+
+	fmt.Printf("Loading into scratch database '%s'...\n", scratch)
+	s.events.OnPhase(PhaseRestore)
+	if format != FormatPlain {
+		cfg.DatabaseName = scratch
+		// pg_restore can't run parallel jobs in a single transaction
+		cfg.Jobs = 1
+		return s.pgRestore(cfg, format, r)
+	}
+	return s.feed(cfg.ContainerName, r, "psql", "-U", cfg.DatabaseUser, "-d", scratch,
+		"--single-transaction", "--set", "ON_ERROR_STOP=1", "-f", "-")
+}
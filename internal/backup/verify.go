@@ -0,0 +1,225 @@
+package backup
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iostate/back-it-up/internal/fault"
+)
+
+// Verification modes
+const (
+	// VerifyModeChecksum compares a full data-only dump of both databases
+	VerifyModeChecksum = "checksum"
+	// VerifyModeRowCount compares exact per-table row counts
+	VerifyModeRowCount = "rowcount"
+	// VerifyModeSampled compares per-table digests over a deterministic sample of rows
+	VerifyModeSampled = "sampled"
+)
+
+// VerifyResult is the outcome of comparing two databases
+type VerifyResult struct {
+	// Match is also set when the differences stay within the fail threshold
+	Match bool `json:"match"`
+	// Tables lists the tables that differ. It is empty in checksum mode,
+	// which only knows whether the whole database matches.
+	Tables []TableMismatch `json:"tables"`
+	// DifferingRows totals the tables' differing rows when rows were diffed
+	DifferingRows int64 `json:"differing_rows"`
+	// Incomplete is set when a time-bounded run stopped with RemainingTables
+	// still to compare; Match is false and Tables holds the mismatches so far
+	Incomplete      bool `json:"incomplete,omitempty"`
+	RemainingTables int  `json:"remaining_tables,omitempty"`
+}
+
+// TableMismatch describes one table that differs between source and target
+type TableMismatch struct {
+	Table      string `json:"table"`
+	SourceRows int64  `json:"source_rows"`
+	TargetRows int64  `json:"target_rows"`
+	// Missing is "source" or "target" when the table exists on one side only
+	Missing string `json:"missing,omitempty"`
+	// DifferingRows and SampleKeys are filled in when rows are diffed
+	DifferingRows int64       `json:"differing_rows"`
+	SampleKeys    []SampleKey `json:"sample_keys,omitempty"`
+}
+
+// tableFingerprint is the per-table state compared in rowcount and sampled mode
+type tableFingerprint struct {
+	rows   int64
+	digest string
+}
+
+// compareDatabase compares one database on both sides using cfg.Mode
+func (s *Service) compareDatabase(cfg VerifyConfig) (*VerifyResult, error) {
+	if err := fault.Inject(fault.StageVerify); err != nil {
+		return nil, err
+	}
+
+	diffRows := cfg.DiffRows || cfg.FailThreshold > 0
+	switch cfg.Mode {
+	case "", VerifyModeChecksum:
+		if diffRows {
+			return nil, fmt.Errorf("row diffs need rowcount or sampled mode")
+		}
+		if cfg.MaxDuration > 0 {
+			return nil, fmt.Errorf("time-bounded verification needs rowcount or sampled mode")
+		}
+		sourceChecksum, err := s.getDatabaseChecksum(cfg.SourceContainer, cfg.DatabaseName, cfg.DatabaseUser, cfg.IgnoreTables)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get source checksum: %w", err)
+		}
+
+		targetChecksum, err := s.getDatabaseChecksum(cfg.TargetContainer, cfg.DatabaseName, cfg.DatabaseUser, cfg.IgnoreTables)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get target checksum: %w", err)
+		}
+
+		return &VerifyResult{Match: sourceChecksum == targetChecksum}, nil
+
+	case VerifyModeRowCount, VerifyModeSampled:
+		if cfg.Mode == VerifyModeSampled && (cfg.SamplePercent < 1 || cfg.SamplePercent > 100) {
+			return nil, fmt.Errorf("sample percent must be between 1 and 100")
+		}
+
+		var result *VerifyResult
+		if cfg.MaxDuration > 0 {
+			var err error
+			if result, err = s.compareResumable(cfg); err != nil {
+				return nil, err
+			}
+			if result.Incomplete {
+				return result, nil
+			}
+		} else {
+			source, err := s.tableFingerprints(cfg.SourceContainer, cfg)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fingerprint source: %w", err)
+			}
+			target, err := s.tableFingerprints(cfg.TargetContainer, cfg)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fingerprint target: %w", err)
+			}
+			result = compareFingerprints(source, target)
+		}
+		if diffRows {
+			if err := s.diffTables(cfg, result); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+
+	default:
+		return nil, fmt.Errorf("unknown verify mode %q", cfg.Mode)
+	}
+}
+
+// listTables returns the user tables of a database as quoted schema.table
+// names, leaving out the ignored ones
+func (s *Service) listTables(containerName, dbName, dbUser string, ignore []string) ([]string, error) {
+	filter := ""
+	if len(ignore) > 0 {
+		literals := make([]string, len(ignore))
+		for i, name := range ignore {
+			literals[i] = "'" + strings.ReplaceAll(name, "'", "''") + "'"
+		}
+		filter = fmt.Sprintf(" AND table_schema || '.' || table_name NOT IN (%s)", strings.Join(literals, ", "))
+	}
+	output, err := s.dockerSvc.Exec(containerName, []string{
+		"psql", "-U", dbUser, "-d", dbName, "-tA", "-c",
+		`SELECT quote_ident(table_schema) || '.' || quote_ident(table_name)
+		   FROM information_schema.tables
+		  WHERE table_type = 'BASE TABLE'
+		    AND table_schema NOT IN ('pg_catalog', 'information_schema')` + filter + `
+		  ORDER BY 1;`,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w\nOutput: %s", err, string(output))
+	}
+
+	var tables []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if t := strings.TrimSpace(line); t != "" {
+			tables = append(tables, t)
+		}
+	}
+	return tables, nil
+}
+
+// tableFingerprints counts (and in sampled mode digests) every table in one query
+func (s *Service) tableFingerprints(containerName string, cfg VerifyConfig) (map[string]tableFingerprint, error) {
+	tables, err := s.listTables(containerName, cfg.DatabaseName, cfg.DatabaseUser, cfg.IgnoreTables)
+	if err != nil {
+		return nil, err
+	}
+	return s.fingerprintTables(containerName, cfg, tables)
+}
+
+// fingerprintTables fingerprints the given tables in one query
+func (s *Service) fingerprintTables(containerName string, cfg VerifyConfig, tables []string) (map[string]tableFingerprint, error) {
+	fingerprints := make(map[string]tableFingerprint, len(tables))
+	if len(tables) == 0 {
+		return fingerprints, nil
+	}
+
+	parts := make([]string, len(tables))
+	for i, t := range tables {
+		literal := "'" + strings.ReplaceAll(t, "'", "''") + "'"
+		if cfg.Mode == VerifyModeSampled {
+			// hashtext() is deterministic, so both sides pick the same rows.
+			// Masking the sign bit rather than taking abs() keeps a hash of
+			// -2^31 from failing the query with integer out of range.
+			parts[i] = fmt.Sprintf(
+				"SELECT %s, count(*), coalesce(md5(string_agg(md5(t::text), '' ORDER BY md5(t::text))), '') FROM %s t WHERE (hashtext(t::text) & 2147483647) %% 100 < %d",
+				literal, t, cfg.SamplePercent)
+		} else {
+			parts[i] = fmt.Sprintf("SELECT %s, count(*), '' FROM %s", literal, t)
+		}
+	}
+
+	output, err := s.dockerSvc.Exec(containerName, []string{
+		"psql", "-U", cfg.DatabaseUser, "-d", cfg.DatabaseName, "-tA", "-F", "\t", "-c",
+		strings.Join(parts, " UNION ALL ") + ";",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count rows: %w\nOutput: %s", err, string(output))
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		rows, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected row count %q for %s", fields[1], fields[0])
+		}
+		fingerprints[fields[0]] = tableFingerprint{rows: rows, digest: fields[2]}
+	}
+	return fingerprints, nil
+}
+
+func compareFingerprints(source, target map[string]tableFingerprint) *VerifyResult {
+	result := &VerifyResult{}
+
+	for table, sf := range source {
+		tf, ok := target[table]
+		switch {
+		case !ok:
+			result.Tables = append(result.Tables, TableMismatch{Table: table, SourceRows: sf.rows, Missing: "target"})
+		case sf != tf:
+			result.Tables = append(result.Tables, TableMismatch{Table: table, SourceRows: sf.rows, TargetRows: tf.rows})
+		}
+	}
+	for table, tf := range target {
+		if _, ok := source[table]; !ok {
+			result.Tables = append(result.Tables, TableMismatch{Table: table, TargetRows: tf.rows, Missing: "source"})
+		}
+	}
+
+	sort.Slice(result.Tables, func(i, j int) bool { return result.Tables[i].Table < result.Tables[j].Table })
+	result.Match = len(result.Tables) == 0
+	return result
+}
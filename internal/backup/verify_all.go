@@ -0,0 +1,118 @@
+package backup
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DatabaseResult is the verification outcome for one database
+type DatabaseResult struct {
+	DatabaseName string
+	// InSource and InTarget report where the database exists; only databases
+	// present in both are compared
+	InSource bool
+	InTarget bool
+	Match    bool
+	Err      error
+}
+
+// Compared reports whether the database existed on both sides and was checked
+func (r DatabaseResult) Compared() bool {
+	return r.InSource && r.InTarget
+}
+
+// ListDatabases returns the non-template databases in a container
+func (s *Service) ListDatabases(containerName, dbUser string) ([]string, error) {
+	output, err := s.dockerSvc.Exec(containerName, []string{
+		"psql", "-U", dbUser, "-d", "template1", "-tA", "-c",
+		"SELECT datname FROM pg_database WHERE NOT datistemplate ORDER BY datname;",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w\nOutput: %s", err, string(output))
+	}
+
+	var names []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if name := strings.TrimSpace(line); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// VerifyAll compares every database present in both containers concurrently
+func (s *Service) VerifyAll(cfg VerifyAllConfig) ([]DatabaseResult, error) {
+	if err := s.dockerSvc.VerifyContainer(cfg.SourceContainer); err != nil {
+		return nil, s.fail(fmt.Errorf("source container verification failed: %w", err))
+	}
+	if err := s.dockerSvc.VerifyContainer(cfg.TargetContainer); err != nil {
+		return nil, s.fail(fmt.Errorf("target container verification failed: %w", err))
+	}
+
+	sourceDBs, err := s.ListDatabases(cfg.SourceContainer, cfg.DatabaseUser)
+	if err != nil {
+		return nil, s.fail(fmt.Errorf("source: %w", err))
+	}
+	targetDBs, err := s.ListDatabases(cfg.TargetContainer, cfg.DatabaseUser)
+	if err != nil {
+		return nil, s.fail(fmt.Errorf("target: %w", err))
+	}
+
+	byName := make(map[string]*DatabaseResult)
+	for _, name := range sourceDBs {
+		byName[name] = &DatabaseResult{DatabaseName: name, InSource: true}
+	}
+	for _, name := range targetDBs {
+		if r, ok := byName[name]; ok {
+			r.InTarget = true
+		} else {
+			byName[name] = &DatabaseResult{DatabaseName: name, InTarget: true}
+		}
+	}
+
+	results := make([]DatabaseResult, 0, len(byName))
+	for _, r := range byName {
+		results = append(results, *r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].DatabaseName < results[j].DatabaseName })
+
+	parallelism := cfg.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	s.events.OnPhase(PhaseChecksum)
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+
+	for i := range results {
+		if !results[i].Compared() {
+			continue
+		}
+		wg.Add(1)
+		go func(r *DatabaseResult) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			result, err := s.compareDatabase(VerifyConfig{
+				SourceContainer: cfg.SourceContainer,
+				TargetContainer: cfg.TargetContainer,
+				DatabaseName:    r.DatabaseName,
+				DatabaseUser:    cfg.DatabaseUser,
+				Mode:            cfg.Mode,
+				SamplePercent:   cfg.SamplePercent,
+				IgnoreTables:    cfg.IgnoreTables,
+			})
+			if err != nil {
+				r.Err = s.fail(err)
+				return
+			}
+			r.Match = result.Match
+		}(&results[i])
+	}
+	wg.Wait()
+
+	return results, nil
+}
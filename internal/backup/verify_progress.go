@@ -0,0 +1,141 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// verifyProgress is the state a time-bounded verification leaves behind
+type verifyProgress struct {
+	// Key identifies the comparison; progress recorded for another one is discarded
+	Key        string          `json:"key"`
+	StartedAt  time.Time       `json:"started_at"`
+	Matched    []string        `json:"matched"`
+	Mismatched []TableMismatch `json:"mismatched"`
+}
+
+func progressKey(cfg VerifyConfig) string {
+	return strings.Join([]string{cfg.SourceContainer, cfg.TargetContainer, cfg.DatabaseName, cfg.Mode,
+		fmt.Sprint(cfg.SamplePercent), strings.Join(cfg.IgnoreTables, ",")}, "|")
+}
+
+func (p *verifyProgress) done(table string) bool {
+	return slices.Contains(p.Matched, table) ||
+		slices.ContainsFunc(p.Mismatched, func(m TableMismatch) bool { return m.Table == table })
+}
+
+func loadProgress(path, key string) (*verifyProgress, error) {
+	fresh := &verifyProgress{Key: key, StartedAt: time.Now().UTC()}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fresh, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read verify progress: %w", err)
+	}
+	var p verifyProgress
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse verify progress %s: %w", path, err)
+	}
+	if p.Key != key {
+		return fresh, nil
+	}
+	return &p, nil
+}
+
+func (p *verifyProgress) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create progress directory: %w", err)
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode verify progress: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write verify progress: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write verify progress: %w", err)
+	}
+	return nil
+}
+
+// compareResumable fingerprints one table at a time until cfg.MaxDuration
+// runs out, recording each finished table in cfg.ProgressFile. The deadline
+// is checked between tables, so a run can overrun it by one table. Once every
+// table has been compared the progress file is removed, and the next run
+// starts over.
+func (s *Service) compareResumable(cfg VerifyConfig) (*VerifyResult, error) {
+	if cfg.ProgressFile == "" {
+		return nil, fmt.Errorf("time-bounded verification needs a progress file")
+	}
+	deadline := time.Now().Add(cfg.MaxDuration)
+
+	progress, err := loadProgress(cfg.ProgressFile, progressKey(cfg))
+	if err != nil {
+		return nil, err
+	}
+	sourceTables, err := s.listTables(cfg.SourceContainer, cfg.DatabaseName, cfg.DatabaseUser, cfg.IgnoreTables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fingerprint source: %w", err)
+	}
+	targetTables, err := s.listTables(cfg.TargetContainer, cfg.DatabaseName, cfg.DatabaseUser, cfg.IgnoreTables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fingerprint target: %w", err)
+	}
+	tables := slices.Compact(slices.Sorted(slices.Values(append(slices.Clone(sourceTables), targetTables...))))
+
+	result := &VerifyResult{}
+	for _, table := range tables {
+		if progress.done(table) {
+			continue
+		}
+		if time.Now().After(deadline) {
+			result.RemainingTables++
+			continue
+		}
+
+		source, target := map[string]tableFingerprint{}, map[string]tableFingerprint{}
+		if slices.Contains(sourceTables, table) {
+			if source, err = s.fingerprintTables(cfg.SourceContainer, cfg, []string{table}); err != nil {
+				return nil, fmt.Errorf("failed to fingerprint source: %w", err)
+			}
+		}
+		if slices.Contains(targetTables, table) {
+			if target, err = s.fingerprintTables(cfg.TargetContainer, cfg, []string{table}); err != nil {
+				return nil, fmt.Errorf("failed to fingerprint target: %w", err)
+			}
+		}
+		if compared := compareFingerprints(source, target); compared.Match {
+			progress.Matched = append(progress.Matched, table)
+		} else {
+			progress.Mismatched = append(progress.Mismatched, compared.Tables...)
+		}
+		if err := progress.save(cfg.ProgressFile); err != nil {
+			return nil, err
+		}
+	}
+
+	// Tables dropped since an earlier run no longer count
+	for _, m := range progress.Mismatched {
+		if slices.Contains(tables, m.Table) {
+			result.Tables = append(result.Tables, m)
+		}
+	}
+	if result.RemainingTables > 0 {
+		result.Incomplete = true
+		return result, nil
+	}
+	if err := os.Remove(cfg.ProgressFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove verify progress: %w", err)
+	}
+	result.Match = len(result.Tables) == 0
+	return result, nil
+}
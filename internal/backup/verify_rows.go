@@ -0,0 +1,193 @@
+package backup
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// maxSampleKeys is how many divergent keys are kept per table
+const maxSampleKeys = 10
+
+// SampleKey is one row that differs between source and target
+type SampleKey struct {
+	// Key is the row's primary key, or the md5 of the whole row for tables
+	// without one
+	Key string `json:"key"`
+	// Missing is "source" or "target" when the row exists on one side only;
+	// otherwise both sides have the row with different values
+	Missing string `json:"missing,omitempty"`
+}
+
+// diffTables diffs every mismatched table of result row by row. With a fail
+// threshold, a result whose differing rows stay within it matches, unless a
+// table is missing on one side.
+func (s *Service) diffTables(cfg VerifyConfig, result *VerifyResult) error {
+	missingTable := false
+	for i := range result.Tables {
+		t := &result.Tables[i]
+		if err := s.diffTable(cfg, t); err != nil {
+			return fmt.Errorf("failed to diff %s: %w", t.Table, err)
+		}
+		result.DifferingRows += t.DifferingRows
+		missingTable = missingTable || t.Missing != ""
+	}
+	if cfg.FailThreshold > 0 && !missingTable && result.DifferingRows <= cfg.FailThreshold {
+		result.Match = true
+	}
+	return nil
+}
+
+// diffTable streams (digest, key) pairs of a table from both sides, ordered
+// by key, and merges them to count the rows that differ
+func (s *Service) diffTable(cfg VerifyConfig, t *TableMismatch) error {
+	// Keys come from whichever side has the table
+	keySide := cfg.SourceContainer
+	if t.Missing == "source" {
+		keySide = cfg.TargetContainer
+	}
+	key, err := s.rowKey(keySide, cfg, t.Table)
+	if err != nil {
+		return err
+	}
+	sample := ""
+	if cfg.Mode == VerifyModeSampled {
+		// The same sample the fingerprints were taken over
+		sample = fmt.Sprintf(" WHERE (hashtext(t::text) & 2147483647) %% 100 < %d", cfg.SamplePercent)
+	}
+	query := fmt.Sprintf(`SELECT md5(t::text), replace(replace(%s, E'\\', E'\\\\'), E'\n', E'\\n') FROM %s t%s ORDER BY 2 COLLATE "C";`,
+		key, t.Table, sample)
+
+	source, target := &rowCursor{}, &rowCursor{}
+	if t.Missing != "source" {
+		if source, err = s.openRows(cfg.SourceContainer, cfg, query); err != nil {
+			return err
+		}
+	}
+	if t.Missing != "target" {
+		if target, err = s.openRows(cfg.TargetContainer, cfg, query); err != nil {
+			source.close()
+			return err
+		}
+	}
+
+	source.next()
+	target.next()
+	for source.ok || target.ok {
+		diff := SampleKey{}
+		switch {
+		case !target.ok || (source.ok && source.key < target.key):
+			diff = SampleKey{Key: source.key, Missing: "target"}
+			source.next()
+		case !source.ok || target.key < source.key:
+			diff = SampleKey{Key: target.key, Missing: "source"}
+			target.next()
+		default:
+			same := source.digest == target.digest
+			diff.Key = source.key
+			source.next()
+			target.next()
+			if same {
+				continue
+			}
+		}
+		t.DifferingRows++
+		if len(t.SampleKeys) < maxSampleKeys {
+			t.SampleKeys = append(t.SampleKeys, diff)
+		}
+	}
+
+	sourceErr, targetErr := source.close(), target.close()
+	if sourceErr != nil {
+		return fmt.Errorf("source: %w", sourceErr)
+	}
+	if targetErr != nil {
+		return fmt.Errorf("target: %w", targetErr)
+	}
+	return nil
+}
+
+// rowKey returns the SQL text of a table's primary key for a row t, or the
+// row's md5 if the table has no primary key
+func (s *Service) rowKey(containerName string, cfg VerifyConfig, table string) (string, error) {
+	literal := "'" + strings.ReplaceAll(table, "'", "''") + "'"
+	output, err := s.dockerSvc.Exec(containerName, []string{
+		"psql", "-U", cfg.DatabaseUser, "-d", cfg.DatabaseName, "-tA", "-c",
+		fmt.Sprintf(`SELECT string_agg('t.' || quote_ident(a.attname), ',' ORDER BY array_position(i.indkey::int2[], a.attnum))
+		   FROM pg_index i
+		   JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+		  WHERE i.indrelid = %s::regclass AND i.indisprimary;`, literal),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read primary key: %w\nOutput: %s", err, string(output))
+	}
+	switch columns := strings.TrimSpace(string(output)); {
+	case columns == "":
+		return "md5(t::text)", nil
+	case strings.Contains(columns, ","):
+		return "ROW(" + columns + ")::text", nil
+	default:
+		return columns + "::text", nil
+	}
+}
+
+// rowCursor reads the rows of one side of a table diff. The zero value is an
+// empty side.
+type rowCursor struct {
+	cmd         *exec.Cmd
+	stdout      io.ReadCloser
+	scanner     *bufio.Scanner
+	stderr      strings.Builder
+	key, digest string
+	ok          bool
+}
+
+func (s *Service) openRows(containerName string, cfg VerifyConfig, query string) (*rowCursor, error) {
+	cmd := s.dockerSvc.Command(containerName, false,
+		"psql", "-U", cfg.DatabaseUser, "-d", cfg.DatabaseName, "-tA", "-F", "\t", "-c", query)
+	c := &rowCursor{cmd: cmd}
+	cmd.Stderr = &c.stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start psql: %w", err)
+	}
+	c.stdout = stdout
+	c.scanner = bufio.NewScanner(stdout)
+	c.scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return c, nil
+}
+
+// next advances to the next row, clearing ok at the end
+func (c *rowCursor) next() {
+	c.ok = false
+	if c.scanner == nil {
+		return
+	}
+	for c.scanner.Scan() {
+		digest, key, found := strings.Cut(c.scanner.Text(), "\t")
+		if found {
+			c.digest, c.key, c.ok = digest, key, true
+			return
+		}
+	}
+}
+
+func (c *rowCursor) close() error {
+	if c.cmd == nil {
+		return nil
+	}
+	scanErr := c.scanner.Err()
+	io.Copy(io.Discard, c.stdout)
+	if err := c.cmd.Wait(); err != nil {
+		return fmt.Errorf("failed to read rows: %w\nError output: %s", err, c.stderr.String())
+	}
+	if scanErr != nil {
+		return fmt.Errorf("failed to read rows: %w", scanErr)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultHelperImage is the image volume archives are made with; it only
+// needs tar and a shell
+const DefaultHelperImage = "alpine:3"
+
+// InspectSnapshotSuffix ends the file names of container config snapshots
+const InspectSnapshotSuffix = ".inspect.json"
+
+// volumeMount is where helper containers see the volume
+const volumeMount = "/volume"
+
+// VolumeRunner starts throwaway containers with docker volumes attached.
+// Only the docker transport implements it.
+type VolumeRunner interface {
+	VerifyVolume(name string) error
+	Helper(image string, mounts []string, interactive bool, command ...string) *exec.Cmd
+}
+
+// ContainerInspector reads a container's configuration. Only the docker
+// transport implements it.
+type ContainerInspector interface {
+	Inspect(containerName string) ([]byte, error)
+}
+
+type VolumeConfig struct {
+	Volume    string
+	OutputDir string
+	Timestamp time.Time
+	// HelperImage is the image tar runs in (DefaultHelperImage if empty)
+	HelperImage string
+}
+
+type VolumeRestoreConfig struct {
+	Volume     string
+	BackupPath string
+	// Clear empties the volume before extracting, so files removed since
+	// the backup don't linger
+	Clear       bool
+	HelperImage string
+}
+
+// IsVolumeArchive reports whether path names a volume archive rather than a SQL dump
+func IsVolumeArchive(path string) bool {
+	return strings.HasSuffix(path, ".tar.gz") && !strings.HasSuffix(path, directoryExtension)
+}
+
+func (s *Service) volumeRunner() (VolumeRunner, error) {
+	runner, ok := s.dockerSvc.(VolumeRunner)
+	if !ok {
+		return nil, fmt.Errorf("volume backups need docker; they aren't available with --host")
+	}
+	return runner, nil
+}
+
+func helperImage(image string) string {
+	if image == "" {
+		return DefaultHelperImage
+	}
+	return image
+}
+
+// BackupVolume archives a docker volume to <volume>_<timestamp>.tar.gz,
+// reading it through a helper container that mounts it read-only, with a
+// checksum file and manifest beside it
+func (s *Service) BackupVolume(cfg VolumeConfig) (string, error) {
+	path, err := s.backupVolume(cfg)
+	return path, s.fail(err)
+}
+
+func (s *Service) backupVolume(cfg VolumeConfig) (string, error) {
+	runner, err := s.volumeRunner()
+	if err != nil {
+		return "", err
+	}
+	if err := runner.VerifyVolume(cfg.Volume); err != nil {
+		return "", err
+	}
+	if cfg.Timestamp.IsZero() {
+		cfg.Timestamp = s.clock.Now()
+	}
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	m := &Manifest{
+		Version:     manifestVersion,
+		Volume:      cfg.Volume,
+		DumpFormat:  "tar",
+		Compression: "gzip",
+		StartedAt:   s.clock.Now(),
+		ToolVersion: toolVersion,
+	}
+	outputPath := filepath.Join(cfg.OutputDir, fmt.Sprintf("%s_%s.tar.gz",
+		cfg.Volume, cfg.Timestamp.Format(backupTimestampLayout)))
+	// Written under a temporary name until complete, like a dump
+	outFile, err := os.Create(outputPath + partialExtension)
+	if err != nil {
+		return "", fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outFile.Close()
+	hash := sha256.New()
+	size := &sizeWriter{w: io.MultiWriter(outFile, hash)}
+	gzWriter := gzip.NewWriter(size)
+	tar := &sizeWriter{w: gzWriter}
+
+	s.events.OnPhase(PhaseDump)
+	cmd := runner.Helper(helperImage(cfg.HelperImage), []string{cfg.Volume + ":" + volumeMount + ":ro"}, false,
+		"tar", "-C", volumeMount, "-cf", "-", ".")
+	var stderr bytes.Buffer
+	cmd.Stdout = &countingWriter{w: tar, events: s.events}
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		err = fmt.Errorf("failed to archive volume: %w\nOutput: %s", err, stderr.String())
+	} else if cerr := gzWriter.Close(); cerr != nil {
+		err = fmt.Errorf("failed to write archive: %w", cerr)
+	} else if cerr := outFile.Close(); cerr != nil {
+		err = fmt.Errorf("failed to write archive: %w", cerr)
+	} else {
+		err = os.Rename(outFile.Name(), outputPath)
+	}
+	if err != nil {
+		os.Remove(outFile.Name())
+		return "", err
+	}
+
+	m.Size, m.UncompressedSize = size.n, tar.n
+	m.Checksum = hex.EncodeToString(hash.Sum(nil))
+	err = writeChecksumFile(outputPath, m.Checksum)
+	if err == nil {
+		err = s.finishManifest(m, outputPath, false)
+	}
+	if err != nil {
+		RemoveBackup(outputPath)
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// RestoreVolume extracts an archive made by BackupVolume into a volume,
+// creating the volume if it doesn't exist
+func (s *Service) RestoreVolume(cfg VolumeRestoreConfig) error {
+	return s.fail(s.restoreVolume(cfg))
+}
+
+func (s *Service) restoreVolume(cfg VolumeRestoreConfig) error {
+	runner, err := s.volumeRunner()
+	if err != nil {
+		return err
+	}
+	// A truncated archive would otherwise restore part of the volume
+	checked, err := VerifyChecksumFile(cfg.BackupPath)
+	if err != nil {
+		return err
+	}
+	if checked {
+		fmt.Printf("✓ %s matches %s\n", cfg.BackupPath, ChecksumPath(cfg.BackupPath))
+	}
+	if _, err := CheckManifest(cfg.BackupPath, !checked); err != nil {
+		return err
+	}
+	gzReader, err := OpenBackup(cfg.BackupPath)
+	if err != nil {
+		return err
+	}
+	defer gzReader.Close()
+
+	script := "tar -C " + volumeMount + " -xf -"
+	if cfg.Clear {
+		script = "find " + volumeMount + " -mindepth 1 -delete && " + script
+	}
+	s.events.OnPhase(PhaseRestore)
+	cmd := runner.Helper(helperImage(cfg.HelperImage), []string{cfg.Volume + ":" + volumeMount}, true, "sh", "-c", script)
+	var stderr bytes.Buffer
+	cmd.Stdin = io.TeeReader(gzReader, &countingWriter{w: io.Discard, events: s.events})
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to extract archive into volume: %w\nOutput: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// SnapshotContainer saves the `docker inspect` output of a container to
+// <container>_<timestamp>.inspect.json, so its image, environment, mounts,
+// and ports are on record next to its data
+func (s *Service) SnapshotContainer(containerName, outputDir string, timestamp time.Time) (string, error) {
+	inspector, ok := s.dockerSvc.(ContainerInspector)
+	if !ok {
+		return "", s.fail(fmt.Errorf("container snapshots need docker; they aren't available with --host"))
+	}
+	data, err := inspector.Inspect(containerName)
+	if err != nil {
+		return "", s.fail(err)
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", s.fail(fmt.Errorf("failed to create output directory: %w", err))
+	}
+	path := filepath.Join(outputDir, fmt.Sprintf("%s_%s%s", containerName, timestamp.Format(backupTimestampLayout), InspectSnapshotSuffix))
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", s.fail(fmt.Errorf("failed to write container snapshot: %w", err))
+	}
+	return path, nil
+}
+
+// countingWriter reports the bytes written through it
+type countingWriter struct {
+	w      io.Writer
+	events Events
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if n > 0 {
+		c.events.OnBytes(int64(n))
+	}
+	return n, err
+}
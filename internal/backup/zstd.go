@@ -0,0 +1,178 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// DictionaryDir is where zstd dictionaries live, relative to the backups
+// they compress; OpenBackup looks there for the one a .sql.zst file needs
+const DictionaryDir = "dictionaries"
+
+// DefaultDictionarySize is zstd's own default dictionary size
+const DefaultDictionarySize = 112640
+
+// Little-endian magic numbers of zstd frames and dictionaries
+const (
+	zstdFrameMagic      = 0xFD2FB528
+	zstdDictionaryMagic = 0xEC30A437
+)
+
+// DictionaryPath is where a dictionary trained on the backups of name in
+// dir at t is written
+func DictionaryPath(dir, name string, t time.Time) string {
+	return filepath.Join(dir, DictionaryDir, fmt.Sprintf("%s_%s.zdict", name, t.Format(backupTimestampLayout)))
+}
+
+// TrainDictionary trains a zstd dictionary of at most size bytes on the
+// decompressed contents of samples, plain backups of similar databases, and
+// writes it to out. Each dump is split into 128 KiB blocks so a handful of
+// artifacts still gives zstd enough samples. It returns the dictionary ID.
+func TrainDictionary(samples []string, out string, size int) (uint32, error) {
+	c, _ := lookupCompressor(CompressionZstd)
+	zstd, err := c.toolPath()
+	if err != nil {
+		return 0, err
+	}
+	scratch, err := MkdirScratch("dict-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(scratch)
+
+	args := []string{"--train", "-q", "-B131072", fmt.Sprintf("--maxdict=%d", size), "-o", out}
+	for i, path := range samples {
+		sample := filepath.Join(scratch, fmt.Sprintf("%d.sql", i))
+		if err := decompressTo(path, sample); err != nil {
+			return 0, err
+		}
+		args = append(args, sample)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create dictionary directory: %w", err)
+	}
+	output, err := exec.CommandContext(context.Background(), zstd, args...).CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("failed to train dictionary: %w\nOutput: %s", err, string(output))
+	}
+	return DictionaryID(out)
+}
+
+func decompressTo(path, out string) error {
+	r, err := OpenBackup(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("failed to create sample: %w", err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("failed to decompress %s: %w", path, err)
+	}
+	return nil
+}
+
+// DictionaryID reads the ID from a zstd dictionary's header
+func DictionaryID(path string) (uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open dictionary: %w", err)
+	}
+	defer f.Close()
+	var header [8]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil || binary.LittleEndian.Uint32(header[:4]) != zstdDictionaryMagic {
+		return 0, fmt.Errorf("%s is not a zstd dictionary", path)
+	}
+	return binary.LittleEndian.Uint32(header[4:]), nil
+}
+
+// frameDictionaryID reads the ID of the dictionary the first zstd frame of r
+// was compressed with; 0 means none
+func frameDictionaryID(r io.Reader) (uint32, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil || binary.LittleEndian.Uint32(header[:4]) != zstdFrameMagic {
+		return 0, fmt.Errorf("not a zstd file")
+	}
+	descriptor := header[4]
+	// The window descriptor is left out of single-segment frames
+	skip := 1
+	if descriptor&0x20 != 0 {
+		skip = 0
+	}
+	size := []int{0, 1, 2, 4}[descriptor&0x03]
+	var field [5]byte
+	if _, err := io.ReadFull(r, field[:skip+size]); err != nil {
+		return 0, fmt.Errorf("truncated zstd header")
+	}
+	var id [4]byte
+	copy(id[:], field[skip:skip+size])
+	return binary.LittleEndian.Uint32(id[:]), nil
+}
+
+// findDictionary returns the dictionary in dir whose ID is id, or "" if
+// there is none
+func findDictionary(dir string, id uint32) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read dictionary directory: %w", err)
+	}
+	for _, entry := range entries {
+		candidate := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			continue
+		}
+		if got, err := DictionaryID(candidate); err == nil && got == id {
+			return candidate, nil
+		}
+	}
+	return "", nil
+}
+
+// storeDictionary copies dictionary into the DictionaryDir of outputDir,
+// unless it is there already, so the dumps it compresses can be opened
+func storeDictionary(outputDir, dictionary string) error {
+	id, err := DictionaryID(dictionary)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(outputDir, DictionaryDir)
+	if stored, err := findDictionary(dir, id); err != nil || stored != "" {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create dictionary directory: %w", err)
+	}
+	if err := copyFile(dictionary, filepath.Join(dir, filepath.Base(dictionary))); err != nil {
+		return fmt.Errorf("failed to store dictionary: %w", err)
+	}
+	return nil
+}
+
+// zstdDictionaryFor returns the dictionary a zstd backup at path, starting
+// with header, was compressed with, or "" if it needs none
+func zstdDictionaryFor(path string, header []byte) (string, error) {
+	id, err := frameDictionaryID(bytes.NewReader(header))
+	if err != nil || id == 0 {
+		return "", err
+	}
+	dir := filepath.Join(filepath.Dir(path), DictionaryDir)
+	dictionary, err := findDictionary(dir, id)
+	if err != nil {
+		return "", err
+	}
+	if dictionary == "" {
+		return "", fmt.Errorf("%s needs zstd dictionary %d, which isn't in %s", path, id, dir)
+	}
+	return dictionary, nil
+}
@@ -0,0 +1,365 @@
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/clock"
+	"github.com/iostate/back-it-up/internal/dump"
+)
+
+// DefaultPath is where the catalog lives unless overridden
+const DefaultPath = "./backups/catalog.json"
+
+// Entry kinds
+const (
+	KindBackup = "backup"
+	KindUndo   = "undo"
+	// KindSkipped records a backup that didn't run, e.g. during a blackout window
+	KindSkipped = "skipped"
+	// KindFailed records a backup that ran but failed, with the error as its note
+	KindFailed = "failed"
+	// KindCancelled records a backup stopped by `job cancel`, with who
+	// cancelled it as its note
+	KindCancelled = "cancelled"
+	// KindVerify records the outcome of a verification run
+	KindVerify = "verify"
+	// KindVolume records an archive of a docker volume
+	KindVolume = "volume"
+	// KindInspect records a snapshot of a container's configuration
+	KindInspect = "inspect"
+)
+
+// Verification outcomes stored in Entry.Status
+const (
+	StatusMatch     = "match"
+	StatusDivergent = "divergent"
+	StatusError     = "error"
+)
+
+// Entry records a single backup artifact
+type Entry struct {
+	ID            string `json:"id"`
+	Kind          string `json:"kind"`
+	Path          string `json:"path"`
+	ContainerName string `json:"container"`
+	DatabaseName  string `json:"database"`
+	// Volume is the docker volume a KindVolume entry archives
+	Volume string `json:"volume,omitempty"`
+	// Content is "schema" or "data" for a backup holding only that part
+	Content   string    `json:"content,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// Duration is how long the run that took the artifact lasted
+	Duration time.Duration `json:"duration,omitempty"`
+	Size     int64         `json:"size"`
+	Checksum string        `json:"sha256,omitempty"`
+	Tags     []string      `json:"tags,omitempty"`
+	Note     string        `json:"note,omitempty"`
+	// Meta annotates the run that took the artifact, e.g. with the git SHA
+	// and pipeline URL of the deploy that triggered it
+	Meta map[string]string `json:"meta,omitempty"`
+	// Status is the outcome of a verification entry
+	Status string `json:"status,omitempty"`
+	// Group ties together the artifacts taken in one multi-resource run
+	Group string `json:"group,omitempty"`
+	// Stack and Service name the compose project and service a stack backup
+	// took the artifact from
+	Stack   string `json:"stack,omitempty"`
+	Service string `json:"service,omitempty"`
+	// SensitiveScan is the outcome of backup --scan-sensitive
+	SensitiveScan *SensitiveScan `json:"sensitive_scan,omitempty"`
+}
+
+// SensitiveScan records which columns of a backup held what look like
+// unencrypted card numbers or social security numbers
+type SensitiveScan struct {
+	// Rows is the number of rows sampled per table
+	Rows     int            `json:"rows"`
+	Findings []dump.Finding `json:"findings,omitempty"`
+}
+
+// HasTag reports whether the entry carries tag
+func (e Entry) HasTag(tag string) bool {
+	for _, t := range e.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter selects catalog entries. Zero-valued fields match everything.
+type Filter struct {
+	Kind         string
+	DatabaseName string
+	Tag          string
+	Group        string
+	// Meta matches entries carrying every one of these annotations
+	Meta map[string]string
+	// Since and Until bound when entries were created: at or after Since,
+	// and before Until
+	Since time.Time
+	Until time.Time
+}
+
+// Match reports whether e satisfies the filter
+func (f Filter) Match(e Entry) bool {
+	if f.Kind != "" && e.Kind != f.Kind {
+		return false
+	}
+	if f.DatabaseName != "" && e.DatabaseName != f.DatabaseName {
+		return false
+	}
+	if f.Tag != "" && !e.HasTag(f.Tag) {
+		return false
+	}
+	if f.Group != "" && e.Group != f.Group {
+		return false
+	}
+	if !f.Since.IsZero() && e.CreatedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.CreatedAt.Before(f.Until) {
+		return false
+	}
+	for key, value := range f.Meta {
+		if got, ok := e.Meta[key]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Catalog is a JSON index of backups stored in a single file
+type Catalog struct {
+	path  string
+	clock clock.Clock
+	ids   clock.IDGenerator
+}
+
+type catalogFile struct {
+	Entries []Entry `json:"entries"`
+}
+
+// Open returns a catalog backed by the file at path. The file is created on first write.
+func Open(path string) *Catalog {
+	return &Catalog{
+		path:  path,
+		clock: clock.System{},
+		ids:   clock.UUIDv7Generator{},
+	}
+}
+
+// SetClock replaces the clock used to timestamp new entries
+func (c *Catalog) SetClock(clk clock.Clock) {
+	if clk == nil {
+		clk = clock.System{}
+	}
+	c.clock = clk
+}
+
+// SetIDGenerator replaces the generator used to assign entry IDs
+func (c *Catalog) SetIDGenerator(ids clock.IDGenerator) {
+	if ids == nil {
+		ids = clock.UUIDv7Generator{}
+	}
+	c.ids = ids
+}
+
+// Entries returns every entry in the catalog, oldest first
+func (c *Catalog) Entries() ([]Entry, error) {
+	f, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	return f.Entries, nil
+}
+
+// Find returns the entries that satisfy f, oldest first
+func (c *Catalog) Find(f Filter) ([]Entry, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []Entry
+	for _, e := range entries {
+		if f.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+	return matched, nil
+}
+
+// Get returns the entry whose ID equals or starts with id. A prefix that
+// matches more than one entry is an error.
+func (c *Catalog) Get(id string) (Entry, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	var matches []Entry
+	for _, e := range entries {
+		if e.ID == id {
+			return e, nil
+		}
+		if id != "" && strings.HasPrefix(e.ID, id) {
+			matches = append(matches, e)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return Entry{}, fmt.Errorf("no catalog entry with ID %s", id)
+	case 1:
+		return matches[0], nil
+	default:
+		return Entry{}, fmt.Errorf("catalog ID prefix %s is ambiguous (%d matches)", id, len(matches))
+	}
+}
+
+// Add records a new entry, assigning an ID if it doesn't have one. The
+// catalog is locked from reading to writing, so concurrent writers, even
+// on other hosts sharing the file, never lose each other's entries.
+func (c *Catalog) Add(e Entry) (Entry, error) {
+	unlock, err := c.lock()
+	if err != nil {
+		return Entry{}, err
+	}
+	defer unlock()
+
+	f, err := c.load()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	if e.ID == "" {
+		e.ID = c.ids.NewID()
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = c.clock.Now()
+	}
+
+	f.Entries = append(f.Entries, e)
+	if err := c.save(f); err != nil {
+		return Entry{}, err
+	}
+	return e, nil
+}
+
+// Latest returns the most recent entry accepted by match
+func (c *Catalog) Latest(match func(Entry) bool) (Entry, bool, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	var latest Entry
+	found := false
+	for _, e := range entries {
+		if match(e) && (!found || !e.CreatedAt.Before(latest.CreatedAt)) {
+			latest = e
+			found = true
+		}
+	}
+	return latest, found, nil
+}
+
+// Expire removes the entry with the given ID along with what it backs up.
+// With the catalog locked, it checks again whether another entry refers to
+// the same path, as --name-by-hash backups of identical dumps share a file,
+// and calls remove only if none does; otherwise only the entry goes, and
+// shared is true. If remove fails, the entry is kept. An ID not in the
+// catalog is ignored.
+func (c *Catalog) Expire(id string, remove func(Entry) error) (shared bool, err error) {
+	unlock, err := c.lock()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	f, err := c.load()
+	if err != nil {
+		return false, err
+	}
+	index := -1
+	for i, e := range f.Entries {
+		if e.ID == id {
+			index = i
+		}
+	}
+	if index < 0 {
+		return false, nil
+	}
+	entry := f.Entries[index]
+	for i, e := range f.Entries {
+		if i != index && e.Path == entry.Path {
+			shared = true
+		}
+	}
+	if !shared {
+		if err := remove(entry); err != nil {
+			return false, err
+		}
+	}
+	f.Entries = slices.Delete(f.Entries, index, index+1)
+	return shared, c.save(f)
+}
+
+func (c *Catalog) load() (catalogFile, error) {
+	var f catalogFile
+
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return f, fmt.Errorf("failed to read catalog: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &f); err != nil {
+		return f, fmt.Errorf("failed to parse catalog %s: %w", c.path, err)
+	}
+	return f, nil
+}
+
+// save writes the catalog to a temporary file and renames it into place so a
+// crash never leaves a half-written catalog behind, and readers never see one
+func (c *Catalog) save(f catalogFile) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode catalog: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write catalog: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write catalog: %w", err)
+	}
+	// The rename must not land before the data does
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write catalog: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write catalog: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write catalog: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to write catalog: %w", err)
+	}
+	return nil
+}
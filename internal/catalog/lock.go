@@ -0,0 +1,29 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/iostate/back-it-up/internal/filelock"
+)
+
+// lock takes the catalog's write lock, a file next to the catalog, so
+// processes on different hosts sharing the catalog exclude each other too.
+// An expiry holds it for as long as removing one backup takes.
+func (c *Catalog) lock() (unlock func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create catalog directory: %w", err)
+	}
+
+	path := c.path + ".lock"
+	unlock, err = filelock.Acquire(path)
+	if errors.Is(err, filelock.ErrHeld) {
+		return nil, fmt.Errorf("catalog %s is locked by another writer; remove %s if none is running", c.path, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock catalog: %w", err)
+	}
+	return unlock, nil
+}
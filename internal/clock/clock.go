@@ -0,0 +1,74 @@
+// Package clock supplies the time and unique IDs the other packages take,
+// so tests can make filenames, timestamps, and catalog IDs reproducible.
+package clock
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Clock supplies the current time. Replace it to make filenames and
+// catalog timestamps deterministic.
+type Clock interface {
+	Now() time.Time
+}
+
+// IDGenerator supplies unique identifiers for catalog entries
+type IDGenerator interface {
+	NewID() string
+}
+
+// System reads the wall clock
+type System struct{}
+
+func (System) Now() time.Time { return time.Now() }
+
+// Fixed always returns the same instant
+type Fixed struct {
+	Time time.Time
+}
+
+func (c Fixed) Now() time.Time { return c.Time }
+
+// UUIDv7Generator produces time-ordered UUIDv7 strings using Clock for the
+// timestamp portion (the system clock if nil)
+type UUIDv7Generator struct {
+	Clock Clock
+}
+
+func (g UUIDv7Generator) NewID() string {
+	clock := g.Clock
+	if clock == nil {
+		clock = System{}
+	}
+
+	var b [16]byte
+	rand.Read(b[:])
+
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(clock.Now().UnixMilli()))
+	copy(b[:6], ts[2:])
+	b[6] = (b[6] & 0x0f) | 0x70
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// SequenceIDGenerator returns Prefix followed by an increasing counter
+// ("test-1", "test-2", ...). It is safe for concurrent use.
+type SequenceIDGenerator struct {
+	Prefix string
+
+	mu sync.Mutex
+	n  int
+}
+
+func (g *SequenceIDGenerator) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.n++
+	return fmt.Sprintf("%s%d", g.Prefix, g.n)
+}
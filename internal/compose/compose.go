@@ -0,0 +1,259 @@
+package compose
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// Labels that steer what a stack backup takes
+const (
+	// LabelDatabase names the database to dump from a service, and marks
+	// services whose image isn't recognised as PostgreSQL
+	LabelDatabase = "back-it-up.database"
+	// LabelUser overrides the user the dump connects as
+	LabelUser = "back-it-up.user"
+	// LabelSkip set to "true" leaves a service or volume out
+	LabelSkip = "back-it-up.skip"
+)
+
+// Project is the part of a normalized compose configuration a stack backup needs
+type Project struct {
+	Name     string
+	File     string
+	Services []Service
+	// Volumes maps the project's volume keys to their docker volume names
+	Volumes map[string]string
+
+	skipVolumes map[string]bool
+}
+
+// Service is one service of a project
+type Service struct {
+	Name        string
+	Image       string
+	Labels      map[string]string
+	Environment map[string]string
+	// Volumes are the docker names of the named volumes the service mounts
+	Volumes []string
+}
+
+// Database is a PostgreSQL service whose data is dumped rather than archived
+type Database struct {
+	Service string
+	Name    string
+	User    string
+}
+
+type configFile struct {
+	Name     string `json:"name"`
+	Services map[string]struct {
+		Image       string             `json:"image"`
+		Labels      map[string]string  `json:"labels"`
+		Environment map[string]*string `json:"environment"`
+		Volumes     []struct {
+			Type   string `json:"type"`
+			Source string `json:"source"`
+		} `json:"volumes"`
+	} `json:"services"`
+	Volumes map[string]struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+	} `json:"volumes"`
+}
+
+// Load reads the compose file through `docker compose config`, so every
+// compose feature (overrides, interpolation, profiles) resolves as it would
+// for `docker compose up`
+func Load(file string) (*Project, error) {
+	cmd := exec.CommandContext(context.Background(), "docker", "compose", "-f", file, "config", "--format", "json")
+	output, err := cmd.Output()
+	if err != nil {
+		msg := ""
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			msg = string(exitErr.Stderr)
+		}
+		return nil, fmt.Errorf("failed to read compose file %s: %w\nOutput: %s", file, err, msg)
+	}
+	p, err := Parse(output)
+	if err != nil {
+		return nil, err
+	}
+	p.File = file
+	return p, nil
+}
+
+// Parse decodes the JSON printed by `docker compose config --format json`
+func Parse(data []byte) (*Project, error) {
+	var f configFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse compose configuration: %w", err)
+	}
+	if f.Name == "" {
+		return nil, fmt.Errorf("compose configuration has no project name")
+	}
+
+	p := &Project{Name: f.Name, Volumes: map[string]string{}, skipVolumes: map[string]bool{}}
+	for key, v := range f.Volumes {
+		name := v.Name
+		if name == "" {
+			name = f.Name + "_" + key
+		}
+		p.Volumes[key] = name
+		if isTrue(v.Labels[LabelSkip]) {
+			p.skipVolumes[name] = true
+		}
+	}
+
+	for name, s := range f.Services {
+		svc := Service{Name: name, Image: s.Image, Labels: s.Labels, Environment: map[string]string{}}
+		for k, v := range s.Environment {
+			if v != nil {
+				svc.Environment[k] = *v
+			}
+		}
+		for _, m := range s.Volumes {
+			if m.Type != "volume" || m.Source == "" {
+				continue
+			}
+			if volume, ok := p.Volumes[m.Source]; ok && !slices.Contains(svc.Volumes, volume) {
+				svc.Volumes = append(svc.Volumes, volume)
+			}
+		}
+		p.Services = append(p.Services, svc)
+	}
+	slices.SortFunc(p.Services, func(a, b Service) int { return strings.Compare(a.Name, b.Name) })
+	return p, nil
+}
+
+// Databases returns the services to dump: those running a PostgreSQL image
+// or labelled with LabelDatabase, unless skipped
+func (p *Project) Databases() []Database {
+	var dbs []Database
+	for _, s := range p.Services {
+		if db, ok := s.database(); ok {
+			dbs = append(dbs, db)
+		}
+	}
+	return dbs
+}
+
+// DataVolumes returns the volumes to archive: every named volume a service
+// mounts, except skipped ones and those holding a dumped database's data
+// directory, sorted by name
+func (p *Project) DataVolumes() []string {
+	dumped := map[string]bool{}
+	for _, s := range p.Services {
+		if _, ok := s.database(); ok {
+			for _, v := range s.Volumes {
+				dumped[v] = true
+			}
+		}
+	}
+
+	var volumes []string
+	for _, s := range p.Services {
+		if isTrue(s.Labels[LabelSkip]) {
+			continue
+		}
+		for _, v := range s.Volumes {
+			if !dumped[v] && !p.skipVolumes[v] && !slices.Contains(volumes, v) {
+				volumes = append(volumes, v)
+			}
+		}
+	}
+	slices.Sort(volumes)
+	return volumes
+}
+
+// AppServices returns the services that aren't dumped databases
+func (p *Project) AppServices() []string {
+	var names []string
+	for _, s := range p.Services {
+		if _, ok := s.database(); !ok {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+func (s Service) database() (Database, bool) {
+	if isTrue(s.Labels[LabelSkip]) {
+		return Database{}, false
+	}
+	name, labelled := s.Labels[LabelDatabase]
+	if !labelled && !isPostgresImage(s.Image) {
+		return Database{}, false
+	}
+
+	// Mirror how the official image initializes itself
+	user := firstNonEmpty(s.Labels[LabelUser], s.Environment["POSTGRES_USER"], "postgres")
+	if name == "" {
+		name = firstNonEmpty(s.Environment["POSTGRES_DB"], s.Environment["POSTGRES_USER"], "postgres")
+	}
+	return Database{Service: s.Name, Name: name, User: user}, true
+}
+
+// Container returns the name of the running container of service
+func (p *Project) Container(service string) (string, error) {
+	cmd := exec.CommandContext(context.Background(), "docker", "ps",
+		"--filter", "label=com.docker.compose.project="+p.Name,
+		"--filter", "label=com.docker.compose.service="+service,
+		"--format", "{{.Names}}")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to list containers of service %s: %w\nOutput: %s", service, err, string(output))
+	}
+	names := strings.Fields(string(output))
+	if len(names) == 0 {
+		return "", fmt.Errorf("service %s of project %s has no running container", service, p.Name)
+	}
+	return names[0], nil
+}
+
+// Stop stops the given services, leaving their containers in place
+func (p *Project) Stop(services ...string) error {
+	return p.run("stop", services)
+}
+
+// Start starts the given services again after Stop
+func (p *Project) Start(services ...string) error {
+	return p.run("start", services)
+}
+
+func (p *Project) run(action string, services []string) error {
+	if len(services) == 0 {
+		return nil
+	}
+	args := append([]string{"compose", "-f", p.File, "-p", p.Name, action}, services...)
+	output, err := exec.CommandContext(context.Background(), "docker", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to %s services %s: %w\nOutput: %s", action, strings.Join(services, ", "), err, string(output))
+	}
+	return nil
+}
+
+func isPostgresImage(image string) bool {
+	// Strip the registry/namespace and tag: "docker.io/library/postgres:16" → "postgres"
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.IndexAny(name, ":@"); i >= 0 {
+		name = name[:i]
+	}
+	return name == "postgres" || name == "postgis" || strings.HasPrefix(name, "postgres-") || strings.HasPrefix(name, "postgresql")
+}
+
+func isTrue(s string) bool {
+	return s == "true" || s == "1" || s == "yes"
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,355 @@
+// Package config reads the back-it-up.yaml file of named jobs, so a backup
+// that takes eight flags can be run as backup --job prod-db, and the daemon
+// knows what to run when.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/schedule"
+)
+
+// DefaultPath is where the config file is looked for unless overridden
+const DefaultPath = "back-it-up.yaml"
+
+// File is a config file
+type File struct {
+	// MaxConcurrent caps the daemon's runs in progress across all jobs;
+	// zero means no limit
+	MaxConcurrent int `json:"max_concurrent,omitempty"`
+	// Blackouts are windows, as "<cron> <duration>", in which the daemon
+	// starts no job
+	Blackouts []string       `json:"blackouts,omitempty"`
+	Jobs      map[string]Job `json:"jobs"`
+}
+
+// Job is a named backup, or another command, and when the daemon runs it
+type Job struct {
+	Container        string    `json:"container,omitempty"`
+	Host             string    `json:"host,omitempty"`
+	Database         string    `json:"database,omitempty"`
+	User             string    `json:"user,omitempty"`
+	Output           string    `json:"output,omitempty"`
+	Destination      string    `json:"destination,omitempty"`
+	Format           string    `json:"format,omitempty"`
+	Compression      string    `json:"compression,omitempty"`
+	CompressionLevel int       `json:"compression_level,omitempty"`
+	Tags             []string  `json:"tags,omitempty"`
+	Retention        Retention `json:"retention,omitempty"`
+	Notify           Notify    `json:"notify,omitempty"`
+
+	// Command runs a command other than backup, such as prune; its flags
+	// are given in Args. Args of a backup are added to the flags above.
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+
+	// Schedule is the cron expression the daemon runs the job on; jobs
+	// without one only run when asked
+	Schedule string `json:"schedule,omitempty"`
+	// Jitter delays each scheduled run by a random duration up to this
+	// long, so jobs sharing a schedule don't all start at once
+	Jitter string `json:"jitter,omitempty"`
+	// MaxConcurrent is how many runs of the job may overlap (default 1); a
+	// run due past it is skipped
+	MaxConcurrent int `json:"max_concurrent,omitempty"`
+	// RPO is the longest the job's database may go without a backup. When
+	// runs wait for a slot, the one whose RPO runs out first goes first,
+	// and a backup already past it when the daemon starts runs right away.
+	RPO string `json:"rpo,omitempty"`
+	// Priority orders waiting runs with the same deadline; higher goes first
+	Priority int `json:"priority,omitempty"`
+	// Blackouts are windows in which the daemon doesn't start the job, on
+	// top of the file's own
+	Blackouts []string `json:"blackouts,omitempty"`
+}
+
+// Retention is a job's retention policy, as the --keep-*,
+// --max-total-size, and --keep-tagged flags take it
+type Retention struct {
+	KeepLast     int      `json:"keep_last,omitempty"`
+	KeepDaily    int      `json:"keep_daily,omitempty"`
+	KeepWeekly   int      `json:"keep_weekly,omitempty"`
+	KeepMonthly  int      `json:"keep_monthly,omitempty"`
+	KeepYearly   int      `json:"keep_yearly,omitempty"`
+	KeepWithin   string   `json:"keep_within,omitempty"`
+	MaxTotalSize string   `json:"max_total_size,omitempty"`
+	KeepTagged   []string `json:"keep_tagged,omitempty"`
+}
+
+// IsZero reports whether r has no rules
+func (r Retention) IsZero() bool {
+	return r.KeepLast == 0 && r.KeepDaily == 0 && r.KeepWeekly == 0 && r.KeepMonthly == 0 && r.KeepYearly == 0 &&
+		r.KeepWithin == "" && r.MaxTotalSize == "" && len(r.KeepTagged) == 0
+}
+
+// Notify is where a job's runs are posted, as the --slack-webhook,
+// --notify-on, --webhook, and --healthcheck-url flags take it
+type Notify struct {
+	SlackWebhook string `json:"slack_webhook,omitempty"`
+	// On is always or failure
+	On      string  `json:"on,omitempty"`
+	Webhook Webhook `json:"webhook,omitempty"`
+	// Healthcheck is a dead man's switch pinged as runs start and end
+	Healthcheck string `json:"healthcheck,omitempty"`
+}
+
+// Webhook is a generic HTTP webhook a job's runs are posted to
+type Webhook struct {
+	URL string `json:"url,omitempty"`
+	// Template is json, discord, teams, mattermost, or a template file
+	Template string   `json:"template,omitempty"`
+	Headers  []string `json:"headers,omitempty"`
+	// Events are start, success, failure, and skip
+	Events []string `json:"events,omitempty"`
+}
+
+// IsZero reports whether n posts nowhere
+func (n Notify) IsZero() bool {
+	return n.SlackWebhook == "" && n.On == "" && n.Healthcheck == "" && n.Webhook.URL == "" && n.Webhook.Template == "" &&
+		len(n.Webhook.Headers) == 0 && len(n.Webhook.Events) == 0
+}
+
+// Flag is a command-line flag and the value a job gives it
+type Flag struct {
+	Name  string
+	Value string
+}
+
+// Load reads and checks the config file at path. It is YAML unless its
+// name ends in .json. Unknown keys are rejected, so a misspelled one isn't
+// silently ignored.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no config file %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	f, err := Parse(data, strings.EqualFold(filepath.Ext(path), ".json"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Parse decodes and checks a config file, as JSON or YAML
+func Parse(data []byte, isJSON bool) (*File, error) {
+	if !isJSON {
+		doc, err := parseYAML(data, reflect.TypeOf(File{}))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, err
+		}
+	}
+	var f File
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, decodeError(err)
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// decodeError words a decoding error in the file's terms
+func decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Errorf("%s must be %s, not %s", typeErr.Field, article(typeErr.Type.String()), typeErr.Value)
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return fmt.Errorf("unknown key %s", field)
+	}
+	return err
+}
+
+func article(kind string) string {
+	switch {
+	case kind == "int":
+		return "a whole number"
+	case strings.HasPrefix(kind, "[]"):
+		return "a list"
+	case strings.HasPrefix(kind, "map["), strings.HasPrefix(kind, "config."):
+		return "a mapping"
+	}
+	return "a " + kind
+}
+
+// Validate checks what can be checked without running anything: names,
+// cron expressions, blackout windows, jitter, RPOs, and concurrency limits
+func (f *File) Validate() error {
+	if f.MaxConcurrent < 0 {
+		return fmt.Errorf("max_concurrent can't be negative")
+	}
+	for _, spec := range f.Blackouts {
+		if _, err := schedule.ParseWindow(spec); err != nil {
+			return fmt.Errorf("blackouts: %w", err)
+		}
+	}
+	for _, name := range f.Names() {
+		job := f.Jobs[name]
+		if strings.ContainsAny(name, " \t/\\") {
+			return fmt.Errorf("job %q: names can't contain spaces or slashes", name)
+		}
+		if job.Command == "daemon" {
+			return fmt.Errorf("job %q can't run the daemon", name)
+		}
+		if job.Command != "" && job.Command != "backup" && job.backupFlagsSet() {
+			return fmt.Errorf("job %q runs %s, so its flags go in args", name, job.Command)
+		}
+		if job.Schedule != "" {
+			if _, err := schedule.ParseCron(job.Schedule); err != nil {
+				return fmt.Errorf("job %q: %w", name, err)
+			}
+		}
+		for _, spec := range job.Blackouts {
+			if _, err := schedule.ParseWindow(spec); err != nil {
+				return fmt.Errorf("job %q: %w", name, err)
+			}
+		}
+		if _, err := job.JitterDuration(); err != nil {
+			return fmt.Errorf("job %q: %w", name, err)
+		}
+		if job.MaxConcurrent < 0 {
+			return fmt.Errorf("job %q: max_concurrent can't be negative", name)
+		}
+		if _, err := job.RPODuration(); err != nil {
+			return fmt.Errorf("job %q: %w", name, err)
+		}
+		if job.RPO != "" && !job.RunsBackup() {
+			return fmt.Errorf("job %q runs %s, so it has no rpo", name, job.Command)
+		}
+		if job.Command == "standby" && job.Schedule != "" && !slices.ContainsFunc(job.Args, isYesFlag) {
+			return fmt.Errorf("job %q runs standby on a schedule, so its args need --yes to accept the database being replaced on every new backup", name)
+		}
+	}
+	return nil
+}
+
+// isYesFlag reports whether arg skips a command's confirmation
+func isYesFlag(arg string) bool {
+	switch arg {
+	case "--yes", "-yes", "-y", "--y", "--yes=true", "-y=true":
+		return true
+	}
+	return false
+}
+
+// Names returns the names of the jobs, sorted
+func (f *File) Names() []string {
+	names := make([]string, 0, len(f.Jobs))
+	for name := range f.Jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Job returns the job called name
+func (f *File) Job(name string) (Job, error) {
+	job, ok := f.Jobs[name]
+	if !ok {
+		if len(f.Jobs) == 0 {
+			return Job{}, fmt.Errorf("no job %q; the config file defines none", name)
+		}
+		return Job{}, fmt.Errorf("no job %q (the config file defines %s)", name, strings.Join(f.Names(), ", "))
+	}
+	return job, nil
+}
+
+// RunsBackup reports whether the job is a backup
+func (j Job) RunsBackup() bool {
+	return j.Command == "" || j.Command == "backup"
+}
+
+// JitterDuration returns the job's jitter
+func (j Job) JitterDuration() (time.Duration, error) {
+	if j.Jitter == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(j.Jitter)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid jitter %q", j.Jitter)
+	}
+	return d, nil
+}
+
+// RPODuration returns the job's recovery point objective, or 0 without one
+func (j Job) RPODuration() (time.Duration, error) {
+	if j.RPO == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(j.RPO)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid rpo %q", j.RPO)
+	}
+	return d, nil
+}
+
+// BackupFlags returns the backup flags the job sets, in a fixed order
+func (j Job) BackupFlags() []Flag {
+	var flags []Flag
+	add := func(name, value string) {
+		if value != "" {
+			flags = append(flags, Flag{Name: name, Value: value})
+		}
+	}
+	addInt := func(name string, value int) {
+		if value != 0 {
+			add(name, strconv.Itoa(value))
+		}
+	}
+	add("container", j.Container)
+	add("host", j.Host)
+	add("database", j.Database)
+	add("user", j.User)
+	add("output", j.Output)
+	add("dest", j.Destination)
+	add("format", j.Format)
+	add("compression", j.Compression)
+	addInt("compression-level", j.CompressionLevel)
+	for _, tag := range j.Tags {
+		add("tag", tag)
+	}
+	addInt("keep-last", j.Retention.KeepLast)
+	addInt("keep-daily", j.Retention.KeepDaily)
+	addInt("keep-weekly", j.Retention.KeepWeekly)
+	addInt("keep-monthly", j.Retention.KeepMonthly)
+	addInt("keep-yearly", j.Retention.KeepYearly)
+	add("keep-within", j.Retention.KeepWithin)
+	add("max-total-size", j.Retention.MaxTotalSize)
+	for _, pattern := range j.Retention.KeepTagged {
+		add("keep-tagged", pattern)
+	}
+	add("slack-webhook", j.Notify.SlackWebhook)
+	add("notify-on", j.Notify.On)
+	add("webhook", j.Notify.Webhook.URL)
+	add("webhook-template", j.Notify.Webhook.Template)
+	for _, header := range j.Notify.Webhook.Headers {
+		add("webhook-header", header)
+	}
+	add("webhook-events", strings.Join(j.Notify.Webhook.Events, ","))
+	add("healthcheck-url", j.Notify.Healthcheck)
+	return flags
+}
+
+func (j Job) backupFlagsSet() bool {
+	return len(j.BackupFlags()) > 0
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{"backup job", "jobs:\n  db:\n    database: app\n    schedule: \"0 3 * * *\"\n    rpo: 26h\n", ""},
+		{"standby job", "jobs:\n  sb:\n    command: standby\n    args: [-c, standby, --yes]\n    schedule: \"*/5 * * * *\"\n", ""},
+		{"unscheduled standby job", "jobs:\n  sb:\n    command: standby\n    args: [-c, standby]\n", ""},
+		{"scheduled standby without --yes", "jobs:\n  sb:\n    command: standby\n    args: [-c, standby]\n    schedule: \"@hourly\"\n", "its args need --yes"},
+		{"daemon job", "jobs:\n  d:\n    command: daemon\n", "can't run the daemon"},
+		{"backup flags on another command", "jobs:\n  p:\n    command: prune\n    database: app\n", "so its flags go in args"},
+		{"slash in a name", "jobs:\n  a/b:\n    database: app\n", "names can't contain spaces or slashes"},
+		{"bad schedule", "jobs:\n  db:\n    schedule: \"61 * * * *\"\n", "job \"db\""},
+		{"bad jitter", "jobs:\n  db:\n    jitter: soon\n", "invalid jitter"},
+		{"negative max_concurrent", "max_concurrent: -1\njobs: {}\n", "max_concurrent can't be negative"},
+		{"rpo on another command", "jobs:\n  p:\n    command: prune\n    rpo: 1h\n", "so it has no rpo"},
+		{"blackouts", "blackouts: [\"0 1 * * sun 4h\"]\njobs:\n  db:\n    blackouts:\n      - \"0 9 * * mon-fri 8h\"\n", ""},
+		{"bad file blackout", "blackouts: [\"0 1 * * sun\"]\njobs: {}\n", "blackouts: invalid blackout window"},
+		{"bad job blackout", "jobs:\n  db:\n    blackouts: [\"0 1 * * sun forever\"]\n", "job \"db\": invalid blackout window"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.doc), false)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Parse: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Starter returns a config file with a backup job of database in container
+// and a prune job, commented to be edited from
+func Starter(container, database string) []byte {
+	return fmt.Appendf(nil, `# back-it-up config: named jobs for "back-it-up backup --job <name>",
+# run on their schedules by "back-it-up daemon".
+# Check it with "back-it-up config validate --check-connectivity".
+
+# Runs of all jobs the daemon has in progress at once (0: no limit)
+max_concurrent: 2
+
+jobs:
+  %[1]s:
+    container: %[2]s
+    database: %[3]s
+    user: postgres
+    output: ./backups
+    # destination: s3://my-bucket/backups   # instead of output
+    compression: zstd
+    tags: [nightly]
+    retention:
+      keep_daily: 7
+      keep_weekly: 4
+      keep_monthly: 12
+    # Post each run to Slack; the URL can also come from $BACKITUP_SLACK_WEBHOOK
+    # notify:
+    #   slack_webhook: https://hooks.slack.com/services/...
+    #   on: failure   # or always (the default)
+    #   healthcheck: https://hc-ping.com/<uuid>   # alerts when a run is missed
+    # Other backup flags, e.g. [--globals, --encrypt-recipient, age1...]
+    # args: []
+    schedule: "0 3 * * *"   # minute hour day-of-month month day-of-week
+    jitter: 10m
+
+  %[1]s-prune:
+    command: prune
+    args: [--keep-daily, "7", --keep-weekly, "4", --keep-monthly, "12", -d, %[3]s, --yes]
+    schedule: "@weekly"
+`, database, strconv.Quote(container), strconv.Quote(database))
+}
@@ -0,0 +1,493 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// The YAML this package reads is the subset config files need: block
+// mappings and sequences, flow sequences and mappings on one line, plain
+// and quoted scalars, and comments. Anchors, tags, multi-line scalars, and
+// multiple documents are rejected rather than misread.
+
+// yamlLine is a line of a YAML document with its comment stripped
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// plainScalar is an unquoted scalar that reads as a number or bool, kept
+// with its text until the schema says which it is
+type plainScalar struct {
+	text  string
+	value any
+}
+
+// parseYAML decodes a YAML document into maps, slices, strings, bools,
+// numbers, and nils, as encoding/json would decode the same data. A plain
+// scalar that reads as a number or bool stays a string where schema, the
+// type the document is decoded into, has one.
+func parseYAML(data []byte, schema reflect.Type) (any, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		number := i + 1
+		text := stripComment(raw)
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.TrimSpace(trimmed) == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", number)
+		}
+		if text == "---" && len(p.lines) == 0 {
+			continue
+		}
+		if text == "---" || text == "..." {
+			return nil, fmt.Errorf("line %d: only one document is supported", number)
+		}
+		p.lines = append(p.lines, yamlLine{number: number, indent: len(text) - len(trimmed), text: strings.TrimRight(trimmed, " \t")})
+	}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+	v, err := p.block(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		return nil, fmt.Errorf("line %d: unexpected indentation", l.number)
+	}
+	return typed(v, schema), nil
+}
+
+// typed resolves the plain scalars in v by the type t it decodes into, nil
+// where the schema doesn't say
+func typed(v any, t reflect.Type) any {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch v := v.(type) {
+	case plainScalar:
+		if t != nil && t.Kind() == reflect.String {
+			return v.text
+		}
+		return v.value
+	case []any:
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		for i := range v {
+			v[i] = typed(v[i], elem)
+		}
+	case map[string]any:
+		for key, x := range v {
+			v[key] = typed(x, fieldType(t, key))
+		}
+	}
+	return v
+}
+
+// fieldType returns the type of the value under key in t, matching struct
+// fields the way encoding/json does
+func fieldType(t reflect.Type, key string) reflect.Type {
+	switch {
+	case t == nil:
+		return nil
+	case t.Kind() == reflect.Map:
+		return t.Elem()
+	case t.Kind() != reflect.Struct:
+		return nil
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		if field.IsExported() && strings.EqualFold(name, key) {
+			return field.Type
+		}
+	}
+	return nil
+}
+
+// stripComment removes a # comment that isn't inside a quoted scalar
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && opensScalar(line[:i]):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// opensScalar reports whether a scalar starts after before: at the start of
+// the line, after "key: " or "- ", or at a flow entry. A quote anywhere else,
+// as in it's, is part of a plain scalar.
+func opensScalar(before string) bool {
+	trimmed := strings.TrimRight(before, " ")
+	if trimmed == "" {
+		return true
+	}
+	spaced := len(trimmed) < len(before)
+	switch last := trimmed[len(trimmed)-1]; last {
+	case '[', '{', ',':
+		return true
+	case ':':
+		return spaced
+	case '-':
+		return spaced && opensScalar(trimmed[:len(trimmed)-1])
+	}
+	return false
+}
+
+// block parses the mapping or sequence starting at the current line
+func (p *yamlParser) block(indent int) (any, error) {
+	if isSequenceItem(p.lines[p.pos].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) mapping(indent int) (any, error) {
+	m := make(map[string]any)
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", l.number)
+		}
+		if isSequenceItem(l.text) {
+			return nil, fmt.Errorf("line %d: expected a key, found a sequence item", l.number)
+		}
+		key, rest, err := splitKey(l)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("line %d: key %q is defined twice", l.number, key)
+		}
+		p.pos++
+		if rest != "" {
+			if m[key], err = inlineValue(rest, l.number); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		m[key], err = p.nested(indent, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// nested parses the block under a key or sequence item with nothing after
+// it on its line. A sequence may sit at the key's own indentation.
+func (p *yamlParser) nested(indent int, sequenceAtIndent bool) (any, error) {
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	if next.indent > indent || (sequenceAtIndent && next.indent == indent && isSequenceItem(next.text)) {
+		return p.block(next.indent)
+	}
+	return nil, nil
+}
+
+func (p *yamlParser) sequence(indent int) (any, error) {
+	s := []any{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent || (l.indent == indent && !isSequenceItem(l.text)) {
+			break
+		}
+		if l.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", l.number)
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		if rest == "" {
+			p.pos++
+			v, err := p.nested(indent, false)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, v)
+			continue
+		}
+		if _, _, err := splitKey(yamlLine{text: rest}); err == nil && !strings.HasPrefix(rest, "[") && !strings.HasPrefix(rest, "{") {
+			// A mapping starting on the item's line continues at the
+			// indentation of its first key
+			p.lines[p.pos] = yamlLine{number: l.number, indent: l.indent + len(l.text) - len(rest), text: rest}
+			v, err := p.mapping(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, v)
+			continue
+		}
+		p.pos++
+		v, err := inlineValue(rest, l.number)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, v)
+	}
+	return s, nil
+}
+
+// splitKey splits "key: value" into the key and the value's text
+func splitKey(l yamlLine) (string, string, error) {
+	text := l.text
+	if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") {
+		end := quotedEnd(text)
+		if end < 0 {
+			return "", "", fmt.Errorf("line %d: unterminated quoted key", l.number)
+		}
+		key, err := unquote(text[:end+1], l.number)
+		if err != nil {
+			return "", "", err
+		}
+		rest := text[end+1:]
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", fmt.Errorf("line %d: expected \":\" after key", l.number)
+		}
+		return key, strings.TrimSpace(rest[1:]), nil
+	}
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", fmt.Errorf("line %d: expected \"key: value\"", l.number)
+		}
+		i = len(text) - 1
+	}
+	key := strings.TrimSpace(text[:i])
+	if key == "" {
+		return "", "", fmt.Errorf("line %d: empty key", l.number)
+	}
+	return key, strings.TrimSpace(text[i+1:]), nil
+}
+
+// quotedEnd returns the index of the quote closing the scalar text starts
+// with, or -1
+func quotedEnd(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case quote == '\'' && text[i] == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+func unquote(text string, line int) (string, error) {
+	if text[0] == '\'' {
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+	s, err := strconv.Unquote(text)
+	if err != nil {
+		return "", fmt.Errorf("line %d: invalid quoted string %s", line, text)
+	}
+	return s, nil
+}
+
+// inlineValue parses the value written on a key's or item's own line
+func inlineValue(text string, line int) (any, error) {
+	switch text[0] {
+	case '|', '>':
+		return nil, fmt.Errorf("line %d: multi-line scalars are not supported", line)
+	case '&', '*', '!':
+		return nil, fmt.Errorf("line %d: anchors, aliases, and tags are not supported", line)
+	}
+	f := &flowParser{text: text, line: line}
+	v, err := f.value()
+	if err != nil {
+		return nil, err
+	}
+	if f.skipSpace(); f.pos < len(f.text) {
+		return nil, fmt.Errorf("line %d: unexpected %q after value", line, f.text[f.pos:])
+	}
+	return v, nil
+}
+
+// flowParser parses a scalar or a one-line [sequence] or {mapping}
+type flowParser struct {
+	text   string
+	pos    int
+	line   int
+	inFlow int
+}
+
+func (f *flowParser) skipSpace() {
+	for f.pos < len(f.text) && f.text[f.pos] == ' ' {
+		f.pos++
+	}
+}
+
+func (f *flowParser) value() (any, error) {
+	f.skipSpace()
+	if f.pos >= len(f.text) {
+		return nil, nil
+	}
+	switch f.text[f.pos] {
+	case '[':
+		return f.flowSequence()
+	case '{':
+		return f.flowMapping()
+	case '"', '\'':
+		end := quotedEnd(f.text[f.pos:])
+		if end < 0 {
+			return nil, fmt.Errorf("line %d: unterminated quoted string", f.line)
+		}
+		s, err := unquote(f.text[f.pos:f.pos+end+1], f.line)
+		f.pos += end + 1
+		return s, err
+	}
+	start := f.pos
+	for f.pos < len(f.text) {
+		c := f.text[f.pos]
+		if f.inFlow > 0 && (c == ',' || c == ']' || c == '}' || (c == ':' && f.pos+1 < len(f.text) && f.text[f.pos+1] == ' ')) {
+			break
+		}
+		f.pos++
+	}
+	text := strings.TrimSpace(f.text[start:f.pos])
+	switch v := resolvePlain(text).(type) {
+	case bool, int64, float64:
+		return plainScalar{text: text, value: v}, nil
+	default:
+		return v, nil
+	}
+}
+
+func (f *flowParser) flowSequence() (any, error) {
+	f.pos++
+	f.inFlow++
+	defer func() { f.inFlow-- }()
+	s := []any{}
+	for {
+		f.skipSpace()
+		if f.pos < len(f.text) && f.text[f.pos] == ']' {
+			f.pos++
+			return s, nil
+		}
+		v, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, v)
+		if err := f.separator(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *flowParser) flowMapping() (any, error) {
+	f.pos++
+	f.inFlow++
+	defer func() { f.inFlow-- }()
+	m := make(map[string]any)
+	for {
+		f.skipSpace()
+		if f.pos < len(f.text) && f.text[f.pos] == '}' {
+			f.pos++
+			return m, nil
+		}
+		k, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if p, plain := k.(plainScalar); plain {
+			key = p.text
+		} else if !ok {
+			key = fmt.Sprint(k)
+		}
+		f.skipSpace()
+		if f.pos >= len(f.text) || f.text[f.pos] != ':' {
+			return nil, fmt.Errorf("line %d: expected \":\" after key %q", f.line, key)
+		}
+		f.pos++
+		v, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("line %d: key %q is defined twice", f.line, key)
+		}
+		m[key] = v
+		if err := f.separator('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// separator consumes the comma after a flow entry, leaving a closing
+// bracket to the caller
+func (f *flowParser) separator(closing byte) error {
+	f.skipSpace()
+	if f.pos >= len(f.text) {
+		return fmt.Errorf("line %d: missing %q", f.line, closing)
+	}
+	switch f.text[f.pos] {
+	case ',':
+		f.pos++
+		return nil
+	case closing:
+		return nil
+	}
+	return fmt.Errorf("line %d: expected \",\" or %q", f.line, closing)
+}
+
+// resolvePlain gives an unquoted scalar its type, by YAML 1.2's core schema
+func resolvePlain(s string) any {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if strings.ContainsAny(s, ".eE") && !strings.ContainsAny(s, "_") {
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n
+		}
+	}
+	return s
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStripComment(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"key: value # comment", "key: value "},
+		{"# whole line", ""},
+		{"note: it's fine # comment", "note: it's fine "},
+		{"note: say \"hi\" # comment", "note: say \"hi\" "},
+		{"url: 'http://host/#anchor' # comment", "url: 'http://host/#anchor' "},
+		{"url: \"a \\\" # b\" # comment", "url: \"a \\\" # b\" "},
+		{"- 'a # b' # comment", "- 'a # b' "},
+		{"  - - \"a # b\"", "  - - \"a # b\""},
+		{"args: ['a # b', c] # comment", "args: ['a # b', c] "},
+		{"args: {k: \"#v\"}", "args: {k: \"#v\"}"},
+		{"'it''s': x # comment", "'it''s': x "},
+		{"color: #fff", "color: "},
+		{"tag: a#b", "tag: a#b"},
+		{"list: a -'b' # comment", "list: a -'b' "},
+	}
+	for _, tt := range tests {
+		if got := stripComment(tt.line); got != tt.want {
+			t.Errorf("stripComment(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want any
+	}{
+		{"empty", "# nothing\n", nil},
+		{"scalars", "s: text\nq: 'it''s'\ndq: \"a\\tb\"\nn: 3\nf: 1.5\nb: true\nnull: ~\nempty:\n",
+			map[string]any{"s": "text", "q": "it's", "dq": "a\tb", "n": int64(3), "f": 1.5, "b": true, "null": nil, "empty": nil}},
+		{"apostrophe in a plain scalar", "note: it's fine # comment\n", map[string]any{"note": "it's fine"}},
+		{"versions stay strings", "v: 1.2.3\nu: 1_000\n", map[string]any{"v": "1.2.3", "u": "1_000"}},
+		{"block sequence", "xs:\n  - a\n  - 2\n", map[string]any{"xs": []any{"a", int64(2)}}},
+		{"sequence at the key's indentation", "xs:\n- a\n- b\n", map[string]any{"xs": []any{"a", "b"}}},
+		{"mapping in a sequence", "- name: a\n  n: 1\n- name: b\n",
+			[]any{map[string]any{"name": "a", "n": int64(1)}, map[string]any{"name": "b"}}},
+		{"nested sequence", "-\n  - a\n  - b\n", []any{[]any{"a", "b"}}},
+		{"flow collections", "xs: [a, 'b, c', 3]\nm: {k: v, n: 1}\n",
+			map[string]any{"xs": []any{"a", "b, c", int64(3)}, "m": map[string]any{"k": "v", "n": int64(1)}}},
+		{"document marker", "---\na: b\n", map[string]any{"a": "b"}},
+		{"quoted key", "\"a: b\": c\n", map[string]any{"a: b": "c"}},
+		{"windows line endings", "a: b\r\nc: d\r\n", map[string]any{"a": "b", "c": "d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.doc), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseYAML(%q) = %#v, want %#v", tt.doc, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{"literal block scalar", "script: |\n  echo hi\n", "multi-line scalars are not supported"},
+		{"folded block scalar", "script: >\n  echo hi\n", "multi-line scalars are not supported"},
+		{"anchor", "a: &x 1\n", "anchors, aliases, and tags are not supported"},
+		{"alias", "a: *x\n", "anchors, aliases, and tags are not supported"},
+		{"tag", "a: !!str 1\n", "anchors, aliases, and tags are not supported"},
+		{"tab indent", "a:\n\tb: c\n", "line 2: indent with spaces, not tabs"},
+		{"second document", "a: b\n---\nc: d\n", "line 2: only one document is supported"},
+		{"duplicate key", "a: 1\na: 2\n", "line 2: key \"a\" is defined twice"},
+		{"bad indentation", "a: 1\n  b: 2\n", "line 2: unexpected indentation"},
+		{"sequence in a mapping", "a: 1\n- b\n", "line 2: expected a key, found a sequence item"},
+		{"missing colon", "a\n", "line 1: expected \"key: value\""},
+		{"unterminated quote", "a: 'b\n", "line 1: unterminated quoted string"},
+		{"unclosed flow sequence", "a: [b, c\n", "line 1: missing ']'"},
+		{"trailing text", "a: 'b' c\n", "line 1: unexpected \"c\" after value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAML([]byte(tt.doc), nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseYAML(%q) error = %v, want %q", tt.doc, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLSchemaStrings(t *testing.T) {
+	doc := `
+jobs:
+  nightly:
+    database: 2024
+    tags: [1, true, prod]
+    compression_level: 9
+    retention:
+      keep_last: 7
+      keep_tagged:
+        - 2024
+  vacuum:
+    command: exec
+    args:
+      - 3
+      - 1.50
+      - false
+`
+	f, err := Parse([]byte(doc), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nightly := f.Jobs["nightly"]
+	if nightly.Database != "2024" || nightly.CompressionLevel != 9 || nightly.Retention.KeepLast != 7 {
+		t.Errorf("nightly = %+v", nightly)
+	}
+	if want := []string{"1", "true", "prod"}; !reflect.DeepEqual(nightly.Tags, want) {
+		t.Errorf("tags = %q, want %q", nightly.Tags, want)
+	}
+	if want := []string{"2024"}; !reflect.DeepEqual(nightly.Retention.KeepTagged, want) {
+		t.Errorf("keep_tagged = %q, want %q", nightly.Retention.KeepTagged, want)
+	}
+	// Numbers keep the text they were written with
+	if want := []string{"3", "1.50", "false"}; !reflect.DeepEqual(f.Jobs["vacuum"].Args, want) {
+		t.Errorf("args = %q, want %q", f.Jobs["vacuum"].Args, want)
+	}
+}
+
+func TestParseRejectsMistypedValues(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{"text for a number", "jobs:\n  a:\n    compression_level: high\n", "compression_level must be a whole number, not string"},
+		{"scalar for a list", "jobs:\n  a:\n    tags: prod\n", "tags must be a list, not string"},
+		{"unknown key", "jobs:\n  a:\n    databse: app\n", "unknown key \"databse\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.doc), false)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
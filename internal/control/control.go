@@ -0,0 +1,104 @@
+// Package control lets operators pause and resume long-running jobs by
+// name, and cancel backups in progress. State lives in a directory of
+// marker files so it works across processes without a daemon API.
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultDir is where pause markers are kept unless overridden
+const DefaultDir = "./backups/.control"
+
+// Pause describes a paused job
+type Pause struct {
+	Job      string    `json:"job"`
+	Reason   string    `json:"reason,omitempty"`
+	PausedAt time.Time `json:"paused_at"`
+}
+
+// Dir is a control directory
+type Dir struct {
+	path string
+}
+
+// Open returns the control directory at path. It is created on first use.
+func Open(path string) *Dir {
+	return &Dir{path: path}
+}
+
+func (d *Dir) markerPath(job string) (string, error) {
+	if job == "" || strings.ContainsAny(job, `/\`) || job == "." || job == ".." {
+		return "", fmt.Errorf("invalid job name %q", job)
+	}
+	return filepath.Join(d.path, job+".paused"), nil
+}
+
+// Pause marks job as paused
+func (d *Dir) Pause(job, reason string) error {
+	path, err := d.markerPath(job)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(d.path, 0755); err != nil {
+		return fmt.Errorf("failed to create control directory: %w", err)
+	}
+
+	data, err := json.Marshal(Pause{Job: job, Reason: reason, PausedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to pause job: %w", err)
+	}
+	return nil
+}
+
+// Resume clears a job's pause marker. Resuming a running job is not an error.
+func (d *Dir) Resume(job string) error {
+	path, err := d.markerPath(job)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to resume job: %w", err)
+	}
+	return nil
+}
+
+// Paused reports whether job is currently paused
+func (d *Dir) Paused(job string) bool {
+	path, err := d.markerPath(job)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// List returns every paused job, sorted by name
+func (d *Dir) List() ([]Pause, error) {
+	matches, err := filepath.Glob(filepath.Join(d.path, "*.paused"))
+	if err != nil {
+		return nil, err
+	}
+
+	var pauses []Pause
+	for _, path := range matches {
+		p := Pause{Job: strings.TrimSuffix(filepath.Base(path), ".paused")}
+		if data, err := os.ReadFile(path); err == nil {
+			json.Unmarshal(data, &p)
+		}
+		pauses = append(pauses, p)
+	}
+
+	sort.Slice(pauses, func(i, j int) bool { return pauses[i].Job < pauses[j].Job })
+	return pauses, nil
+}
@@ -0,0 +1,160 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Run is a backup in progress, registered so another process can cancel it
+type Run struct {
+	ID        string    `json:"id"`
+	Container string    `json:"container,omitempty"`
+	Database  string    `json:"database,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"started_at"`
+	// CancelledBy is set once the run has been asked to stop
+	CancelledBy string `json:"cancelled_by,omitempty"`
+}
+
+// Cancellation asks a run to stop
+type Cancellation struct {
+	By string    `json:"by"`
+	At time.Time `json:"at"`
+}
+
+func (d *Dir) runPath(id, ext string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return "", fmt.Errorf("invalid run ID %q", id)
+	}
+	return filepath.Join(d.path, id+ext), nil
+}
+
+// StartRun registers run until FinishRun is called
+func (d *Dir) StartRun(run Run) error {
+	path, err := d.runPath(run.ID, ".run")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(d.path, 0755); err != nil {
+		return fmt.Errorf("failed to create control directory: %w", err)
+	}
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to register run: %w", err)
+	}
+	return nil
+}
+
+// FinishRun clears a run's registration and any cancellation of it
+func (d *Dir) FinishRun(id string) {
+	for _, ext := range []string{".run", ".cancel"} {
+		if path, err := d.runPath(id, ext); err == nil {
+			os.Remove(path)
+		}
+	}
+}
+
+// Run returns the registered run with id. A run whose process has died
+// without finishing is cleared and reported as not found.
+func (d *Dir) Run(id string) (Run, error) {
+	path, err := d.runPath(id, ".run")
+	if err != nil {
+		return Run{}, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Run{}, fmt.Errorf("no run %q in progress", id)
+	}
+	if err != nil {
+		return Run{}, fmt.Errorf("failed to read run: %w", err)
+	}
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return Run{}, fmt.Errorf("malformed run file %s: %w", path, err)
+	}
+	if !Alive(run.PID) {
+		d.FinishRun(id)
+		return Run{}, fmt.Errorf("no run %q in progress", id)
+	}
+	if c, ok := d.Cancelled(id); ok {
+		run.CancelledBy = c.By
+	}
+	return run, nil
+}
+
+// Runs returns every run in progress, oldest first
+func (d *Dir) Runs() ([]Run, error) {
+	matches, err := filepath.Glob(filepath.Join(d.path, "*.run"))
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []Run
+	for _, path := range matches {
+		if run, err := d.Run(strings.TrimSuffix(filepath.Base(path), ".run")); err == nil {
+			runs = append(runs, run)
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].StartedAt.Before(runs[j].StartedAt) })
+	return runs, nil
+}
+
+// Cancel asks the run with id to stop. The run notices within a few
+// seconds; cancelling it again is not an error.
+func (d *Dir) Cancel(id, by string) (Run, error) {
+	run, err := d.Run(id)
+	if err != nil {
+		return Run{}, err
+	}
+	path, err := d.runPath(id, ".cancel")
+	if err != nil {
+		return Run{}, err
+	}
+	data, err := json.Marshal(Cancellation{By: by, At: time.Now()})
+	if err != nil {
+		return Run{}, err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return Run{}, fmt.Errorf("failed to cancel run: %w", err)
+	}
+	run.CancelledBy = by
+	return run, nil
+}
+
+// Cancelled reports whether the run with id has been asked to stop, and by
+// whom
+func (d *Dir) Cancelled(id string) (Cancellation, bool) {
+	path, err := d.runPath(id, ".cancel")
+	if err != nil {
+		return Cancellation{}, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Cancellation{}, false
+	}
+	var c Cancellation
+	json.Unmarshal(data, &c)
+	return c, true
+}
+
+// Alive reports whether the process with pid is still running
+func Alive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	// Another user's process can't be signalled, but is still running
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
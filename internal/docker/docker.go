@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os/exec"
 	"strings"
+	"time"
 )
 
 type Service struct {
@@ -17,6 +18,13 @@ func NewService() *Service {
 	}
 }
 
+// WithContext returns a copy of s whose commands are killed once ctx is done
+func (s *Service) WithContext(ctx context.Context) *Service {
+	c := *s
+	c.ctx = ctx
+	return &c
+}
+
 // VerifyContainer checks if a Docker container exists and is running
 func (s *Service) VerifyContainer(containerName string) error {
 	cmd := exec.CommandContext(s.ctx, "docker", "inspect", "--format={{.State.Running}}", containerName)
@@ -33,9 +41,140 @@ func (s *Service) VerifyContainer(containerName string) error {
 	return nil
 }
 
+// Command prepares a command to run in the specified container via docker
+// exec, keeping stdin open if interactive
+func (s *Service) Command(containerName string, interactive bool, command ...string) *exec.Cmd {
+	args := []string{"exec"}
+	if interactive {
+		args = append(args, "-i")
+	}
+	args = append(args, containerName)
+	return exec.CommandContext(s.ctx, "docker", append(args, command...)...)
+}
+
 // Exec executes a command in the specified container
 func (s *Service) Exec(containerName string, command []string) ([]byte, error) {
 	args := append([]string{"exec", containerName}, command...)
 	cmd := exec.CommandContext(s.ctx, "docker", args...)
 	return cmd.CombinedOutput()
 }
+
+// PostgresSpec describes a fresh PostgreSQL container to create
+type PostgresSpec struct {
+	Name     string
+	Image    string
+	User     string
+	Password string
+	// Publish lists host:container port mappings, as for `docker run -p`
+	Publish []string
+	// Volume is the named volume holding the data directory
+	Volume string
+}
+
+// CreatePostgres pulls spec.Image and starts a container from it with its
+// data directory on spec.Volume
+func (s *Service) CreatePostgres(spec PostgresSpec) error {
+	if output, err := exec.CommandContext(s.ctx, "docker", "pull", spec.Image).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to pull %s: %w\nOutput: %s", spec.Image, err, string(output))
+	}
+	if output, err := exec.CommandContext(s.ctx, "docker", "volume", "create", spec.Volume).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create volume %s: %w\nOutput: %s", spec.Volume, err, string(output))
+	}
+
+	// A subdirectory for PGDATA keeps initdb happy whatever the volume root contains
+	args := []string{"run", "-d", "--name", spec.Name,
+		"-v", spec.Volume + ":/var/lib/postgresql/data",
+		"-e", "PGDATA=/var/lib/postgresql/data/pgdata",
+		"-e", "POSTGRES_USER=" + spec.User,
+		"-e", "POSTGRES_DB=postgres",
+		"-e", "POSTGRES_PASSWORD=" + spec.Password,
+	}
+	for _, p := range spec.Publish {
+		args = append(args, "-p", p)
+	}
+	args = append(args, spec.Image)
+	if output, err := exec.CommandContext(s.ctx, "docker", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to start container %s: %w\nOutput: %s", spec.Name, err, string(output))
+	}
+	return nil
+}
+
+// RemoveContainer force-removes a container and, if volume is set, its volume
+func (s *Service) RemoveContainer(containerName, volume string) error {
+	if output, err := exec.CommandContext(s.ctx, "docker", "rm", "-f", containerName).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to remove container %s: %w\nOutput: %s", containerName, err, string(output))
+	}
+	if volume == "" {
+		return nil
+	}
+	if output, err := exec.CommandContext(s.ctx, "docker", "volume", "rm", volume).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to remove volume %s: %w\nOutput: %s", volume, err, string(output))
+	}
+	return nil
+}
+
+// WaitReady blocks until the server in containerName accepts queries from
+// user. pg_isready alone isn't enough because the image's entrypoint
+// restarts the server once initialization is done.
+func (s *Service) WaitReady(containerName, user string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		output, err := exec.CommandContext(s.ctx, "docker", "exec", containerName,
+			"psql", "-U", user, "-d", "postgres", "-h", "127.0.0.1", "-tAc", "SELECT 1").CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("container '%s' not ready after %s: %w\nOutput: %s", containerName, timeout, err, string(output))
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// VerifyVolume checks that a named volume exists
+func (s *Service) VerifyVolume(name string) error {
+	output, err := exec.CommandContext(s.ctx, "docker", "volume", "inspect", "--format={{.Name}}", name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("volume '%s' not found: %w\nOutput: %s", name, err, string(output))
+	}
+	return nil
+}
+
+// Helper prepares a command to run in a throwaway container of image with
+// mounts ("volume:/path[:ro]") attached, keeping stdin open if interactive
+func (s *Service) Helper(image string, mounts []string, interactive bool, command ...string) *exec.Cmd {
+	args := []string{"run", "--rm"}
+	if interactive {
+		args = append(args, "-i")
+	}
+	for _, m := range mounts {
+		args = append(args, "-v", m)
+	}
+	args = append(args, image)
+	return exec.CommandContext(s.ctx, "docker", append(args, command...)...)
+}
+
+// Inspect returns the `docker inspect` JSON of a container
+func (s *Service) Inspect(containerName string) ([]byte, error) {
+	output, err := exec.CommandContext(s.ctx, "docker", "inspect", containerName).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container '%s': %w", containerName, err)
+	}
+	return output, nil
+}
+
+// Pause freezes every process in a container
+func (s *Service) Pause(containerName string) error {
+	if output, err := exec.CommandContext(s.ctx, "docker", "pause", containerName).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to pause container '%s': %w\nOutput: %s", containerName, err, string(output))
+	}
+	return nil
+}
+
+// Unpause resumes a paused container
+func (s *Service) Unpause(containerName string) error {
+	if output, err := exec.CommandContext(s.ctx, "docker", "unpause", containerName).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to unpause container '%s': %w\nOutput: %s", containerName, err, string(output))
+	}
+	return nil
+}
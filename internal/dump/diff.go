@@ -0,0 +1,67 @@
+package dump
+
+import "sort"
+
+// TableChange describes how a table's data differs between two summaries
+type TableChange struct {
+	Table   string
+	OldRows int64
+	NewRows int64
+	// Status is one of "added", "removed", or "changed"
+	Status string
+}
+
+// Diff lists the differences between two dump summaries
+type Diff struct {
+	AddedObjects   []string
+	RemovedObjects []string
+	ChangedObjects []string
+	Tables         []TableChange
+}
+
+// Empty reports whether the two summaries were identical
+func (d Diff) Empty() bool {
+	return len(d.AddedObjects) == 0 && len(d.RemovedObjects) == 0 &&
+		len(d.ChangedObjects) == 0 && len(d.Tables) == 0
+}
+
+// Compare computes the differences going from the from summary to the to summary
+func Compare(from, to *Summary) Diff {
+	var d Diff
+
+	for key, def := range to.Objects {
+		oldDef, ok := from.Objects[key]
+		switch {
+		case !ok:
+			d.AddedObjects = append(d.AddedObjects, key)
+		case oldDef != def:
+			d.ChangedObjects = append(d.ChangedObjects, key)
+		}
+	}
+	for key := range from.Objects {
+		if _, ok := to.Objects[key]; !ok {
+			d.RemovedObjects = append(d.RemovedObjects, key)
+		}
+	}
+
+	for table, nt := range to.Tables {
+		ot, ok := from.Tables[table]
+		switch {
+		case !ok:
+			d.Tables = append(d.Tables, TableChange{Table: table, NewRows: nt.Rows, Status: "added"})
+		case ot.Rows != nt.Rows || ot.Digest != nt.Digest:
+			d.Tables = append(d.Tables, TableChange{Table: table, OldRows: ot.Rows, NewRows: nt.Rows, Status: "changed"})
+		}
+	}
+	for table, ot := range from.Tables {
+		if _, ok := to.Tables[table]; !ok {
+			d.Tables = append(d.Tables, TableChange{Table: table, OldRows: ot.Rows, Status: "removed"})
+		}
+	}
+
+	sort.Strings(d.AddedObjects)
+	sort.Strings(d.RemovedObjects)
+	sort.Strings(d.ChangedObjects)
+	sort.Slice(d.Tables, func(i, j int) bool { return d.Tables[i].Table < d.Tables[j].Table })
+	return d
+}
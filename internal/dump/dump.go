@@ -0,0 +1,260 @@
+package dump
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// TableData summarizes the rows of one table in a dump
+type TableData struct {
+	Rows int64
+	// Digest is an order-independent hash of the table's rows
+	Digest uint64
+}
+
+// Summary describes the schema objects and table data found in a plain SQL dump
+type Summary struct {
+	// Objects maps an object key (e.g. "TABLE public.users") to its normalized definition
+	Objects map[string]string
+	Tables  map[string]*TableData
+}
+
+// Summarize reads a plain-format pg_dump stream and builds its Summary
+func Summarize(r io.Reader) (*Summary, error) {
+	sum := &Summary{
+		Objects: make(map[string]string),
+		Tables:  make(map[string]*TableData),
+	}
+
+	err := Scan(r, Handler{
+		Statement: func(stmt string) error {
+			sum.addObject(stmt)
+			return nil
+		},
+		Copy: func(table string, columns []string) error {
+			sum.table(table)
+			return nil
+		},
+		Row: func(table, row string) error {
+			sum.addRow(table, row)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
+
+// Handler receives the contents of a dump as it is scanned. Either callback may be nil.
+type Handler struct {
+	// Statement is called with every complete SQL statement outside COPY data
+	Statement func(stmt string) error
+	// Copy is called when a COPY block for table begins, with the columns it
+	// lists (nil if it lists none)
+	Copy func(table string, columns []string) error
+	// Row is called with every row of COPY data or INSERT statement
+	Row func(table, row string) error
+}
+
+var (
+	copyRe   = regexp.MustCompile(`^COPY\s+(\S+)\s+(?:\((.*)\)\s+)?FROM stdin;$`)
+	insertRe = regexp.MustCompile(`^INSERT INTO\s+(\S+)\s+(?:\([^)]*\)\s+)?VALUES\s+(.*);$`)
+)
+
+// Scan walks a plain-format dump, splitting it into statements and table rows
+func Scan(r io.Reader, h Handler) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 256*1024*1024)
+
+	var stmt strings.Builder
+	copyTable := ""
+	dollarTag := ""
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if copyTable != "" {
+			if line == `\.` {
+				copyTable = ""
+				continue
+			}
+			if h.Row != nil {
+				if err := h.Row(copyTable, line); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if stmt.Len() == 0 && (strings.HasPrefix(line, "--") || strings.TrimSpace(line) == "") {
+			continue
+		}
+
+		if stmt.Len() > 0 {
+			stmt.WriteByte('\n')
+		}
+		stmt.WriteString(line)
+		dollarTag = trackDollarQuote(line, dollarTag)
+
+		if dollarTag != "" || !strings.HasSuffix(strings.TrimSpace(line), ";") {
+			continue
+		}
+
+		text := strings.TrimSpace(stmt.String())
+		stmt.Reset()
+
+		if m := copyRe.FindStringSubmatch(text); m != nil {
+			copyTable = m[1]
+			if h.Copy != nil {
+				if err := h.Copy(copyTable, splitColumns(m[2])); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if m := insertRe.FindStringSubmatch(text); m != nil {
+			if h.Row != nil {
+				if err := h.Row(m[1], m[2]); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if h.Statement != nil {
+			if err := h.Statement(text); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read dump: %w", err)
+	}
+	return nil
+}
+
+// splitColumns parses the column list of a COPY statement, unquoting
+// quoted identifiers
+func splitColumns(list string) []string {
+	if strings.TrimSpace(list) == "" {
+		return nil
+	}
+	var columns []string
+	var col strings.Builder
+	quoted := false
+	for i := 0; i < len(list); i++ {
+		c := list[i]
+		switch {
+		case c == '"' && quoted && i+1 < len(list) && list[i+1] == '"':
+			col.WriteByte('"')
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			columns = append(columns, col.String())
+			col.Reset()
+		case c == ' ' && !quoted:
+		default:
+			col.WriteByte(c)
+		}
+	}
+	return append(columns, col.String())
+}
+
+var dollarTagRe = regexp.MustCompile(`\$[A-Za-z_]*\$`)
+
+// trackDollarQuote returns the dollar-quote tag that is still open at the end
+// of line, given the tag open at its start
+func trackDollarQuote(line, open string) string {
+	for _, tag := range dollarTagRe.FindAllString(line, -1) {
+		switch {
+		case open == "":
+			open = tag
+		case tag == open:
+			open = ""
+		}
+	}
+	return open
+}
+
+func (s *Summary) table(name string) *TableData {
+	td, ok := s.Tables[name]
+	if !ok {
+		td = &TableData{}
+		s.Tables[name] = td
+	}
+	return td
+}
+
+func (s *Summary) addRow(table, row string) {
+	td := s.table(table)
+	h := sha256.Sum256([]byte(row))
+	td.Rows++
+	td.Digest += binary.BigEndian.Uint64(h[:8])
+}
+
+func (s *Summary) addObject(stmt string) {
+	key := ObjectKey(stmt)
+	if key == "" {
+		return
+	}
+
+	// Several statements can share a key (e.g. two GRANTs); keep them all
+	unique := key
+	for i := 2; ; i++ {
+		if _, exists := s.Objects[unique]; !exists {
+			break
+		}
+		unique = fmt.Sprintf("%s #%d", key, i)
+	}
+	s.Objects[unique] = normalize(stmt)
+}
+
+var objectPatterns = []struct {
+	re   *regexp.Regexp
+	kind string
+}{
+	{regexp.MustCompile(`^CREATE (?:UNLOGGED )?TABLE (\S+)`), "TABLE"},
+	{regexp.MustCompile(`^CREATE (?:UNIQUE )?INDEX (\S+)`), "INDEX"},
+	{regexp.MustCompile(`^CREATE SEQUENCE (\S+)`), "SEQUENCE"},
+	{regexp.MustCompile(`^CREATE (?:OR REPLACE )?VIEW (\S+)`), "VIEW"},
+	{regexp.MustCompile(`^CREATE MATERIALIZED VIEW (\S+)`), "MATERIALIZED VIEW"},
+	{regexp.MustCompile(`^CREATE (?:OR REPLACE )?FUNCTION ([^(]+\([^)]*\))`), "FUNCTION"},
+	{regexp.MustCompile(`^CREATE (?:OR REPLACE )?PROCEDURE ([^(]+\([^)]*\))`), "PROCEDURE"},
+	{regexp.MustCompile(`^CREATE (?:CONSTRAINT )?TRIGGER (\S+)`), "TRIGGER"},
+	{regexp.MustCompile(`^CREATE TYPE (\S+)`), "TYPE"},
+	{regexp.MustCompile(`^CREATE DOMAIN (\S+)`), "DOMAIN"},
+	{regexp.MustCompile(`^CREATE SCHEMA (\S+)`), "SCHEMA"},
+	{regexp.MustCompile(`^CREATE EXTENSION (?:IF NOT EXISTS )?(\S+)`), "EXTENSION"},
+	{regexp.MustCompile(`^ALTER TABLE (?:ONLY )?(\S+)\s+ADD CONSTRAINT (\S+)`), "CONSTRAINT"},
+}
+
+// ObjectKey derives a stable identifier for a schema statement, such as
+// "TABLE public.users". Session settings return an empty key; statements
+// that aren't recognized are keyed by their own text.
+func ObjectKey(stmt string) string {
+	if strings.HasPrefix(stmt, "SET ") || strings.HasPrefix(stmt, "SELECT pg_catalog.set_config") {
+		return ""
+	}
+
+	flat := strings.Join(strings.Fields(stmt), " ")
+	for _, p := range objectPatterns {
+		m := p.re.FindStringSubmatch(flat)
+		if m == nil {
+			continue
+		}
+		return p.kind + " " + strings.Join(m[1:], ".")
+	}
+	return flat
+}
+
+// normalize collapses whitespace so formatting differences aren't reported as changes
+func normalize(stmt string) string {
+	return strings.Join(strings.Fields(stmt), " ")
+}
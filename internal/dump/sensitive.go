@@ -0,0 +1,129 @@
+package dump
+
+import (
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Kinds of sensitive values ScanSensitive looks for
+const (
+	SensitiveCard = "credit_card"
+	SensitiveSSN  = "ssn"
+)
+
+// Finding is a column whose sampled values include what look like
+// unencrypted card numbers or social security numbers
+type Finding struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Kind   string `json:"kind"`
+	// Matches of the Sampled non-null values look like Kind
+	Matches int `json:"matches"`
+	Sampled int `json:"sampled"`
+}
+
+var (
+	cardRe = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	// Visa, Mastercard, American Express, Discover, JCB, Diners Club
+	cardPrefixRe = regexp.MustCompile(`^(?:4|5[1-5]|2[2-7]|3[47]|6[05]|35|3[068])`)
+	ssnRe        = regexp.MustCompile(`\b(\d{3})-(\d{2})-(\d{4})\b`)
+)
+
+// ScanSensitive checks the first rows rows of every table's COPY data in a
+// plain dump for card numbers (which must pass the Luhn check) and US social
+// security numbers. Values an application encrypted before storing them
+// don't match, so a finding points at data sitting in the dump in the clear.
+func ScanSensitive(r io.Reader, rows int) ([]Finding, error) {
+	type column struct {
+		sampled int
+		matches map[string]int
+	}
+	tables := map[string][]*column{}
+	names := map[string][]string{}
+	seen := map[string]int{}
+
+	err := Scan(r, Handler{
+		Copy: func(table string, columns []string) error {
+			names[table] = columns
+			tables[table] = make([]*column, len(columns))
+			for i := range columns {
+				tables[table][i] = &column{matches: map[string]int{}}
+			}
+			return nil
+		},
+		Row: func(table, row string) error {
+			cols, ok := tables[table]
+			if !ok || seen[table] >= rows {
+				return nil
+			}
+			seen[table]++
+			for i, value := range strings.Split(row, "\t") {
+				if i >= len(cols) || value == `\N` {
+					continue
+				}
+				cols[i].sampled++
+				for _, kind := range sensitiveKinds(value) {
+					cols[i].matches[kind]++
+				}
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for table, cols := range tables {
+		for i, c := range cols {
+			for kind, n := range c.matches {
+				findings = append(findings, Finding{Table: table, Column: names[table][i], Kind: kind, Matches: n, Sampled: c.sampled})
+			}
+		}
+	}
+	slices.SortFunc(findings, func(a, b Finding) int {
+		return strings.Compare(a.Table+"."+a.Column+" "+a.Kind, b.Table+"."+b.Column+" "+b.Kind)
+	})
+	return findings, nil
+}
+
+// sensitiveKinds returns the kinds of sensitive value found in value
+func sensitiveKinds(value string) []string {
+	var kinds []string
+	for _, m := range cardRe.FindAllString(value, -1) {
+		if cardPrefixRe.MatchString(m) && luhn(m) {
+			kinds = append(kinds, SensitiveCard)
+			break
+		}
+	}
+	for _, m := range ssnRe.FindAllStringSubmatch(value, -1) {
+		if m[1] != "000" && m[1] != "666" && m[1][0] != '9' && m[2] != "00" && m[3] != "0000" {
+			kinds = append(kinds, SensitiveSSN)
+			break
+		}
+	}
+	return kinds
+}
+
+// luhn reports whether the digits of s, ignoring separators, pass the Luhn
+// checksum that card numbers carry
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+		d := int(s[i] - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
@@ -0,0 +1,125 @@
+// Package fault injects failures and latency into pipeline stages so
+// operators can rehearse alerting and retry behavior. It is configured
+// solely through the BACKITUP_FAULT environment variable, e.g.
+//
+//	BACKITUP_FAULT=upload-fail:0.2,slow-dump:5s
+//
+// "<stage>-fail:<probability>" fails the stage with the given probability and
+// "slow-<stage>:<duration>" delays it before it starts.
+package fault
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EnvVar is the environment variable holding the fault specification
+const EnvVar = "BACKITUP_FAULT"
+
+// Pipeline stages that accept faults
+const (
+	StageDump    = "dump"
+	StageRestore = "restore"
+	StageVerify  = "verify"
+	StageUpload  = "upload"
+)
+
+var stages = map[string]bool{
+	StageDump:    true,
+	StageRestore: true,
+	StageVerify:  true,
+	StageUpload:  true,
+}
+
+type spec struct {
+	failRate map[string]float64
+	delay    map[string]time.Duration
+}
+
+var (
+	loadOnce sync.Once
+	loaded   *spec
+	loadErr  error
+)
+
+// Inject applies any faults configured for stage: it sleeps for the
+// configured delay, then returns an error with the configured probability
+func Inject(stage string) error {
+	loadOnce.Do(func() {
+		raw := os.Getenv(EnvVar)
+		if raw == "" {
+			return
+		}
+		loaded, loadErr = parse(raw)
+		if loadErr == nil {
+			fmt.Fprintf(os.Stderr, "WARNING: fault injection enabled (%s=%s)\n", EnvVar, raw)
+		}
+	})
+
+	if loadErr != nil {
+		return loadErr
+	}
+	if loaded == nil {
+		return nil
+	}
+
+	if d := loaded.delay[stage]; d > 0 {
+		time.Sleep(d)
+	}
+	if rate := loaded.failRate[stage]; rate > 0 && rand.Float64() < rate {
+		return fmt.Errorf("injected fault: %s failed (%s)", stage, EnvVar)
+	}
+	return nil
+}
+
+func parse(raw string) (*spec, error) {
+	s := &spec{
+		failRate: make(map[string]float64),
+		delay:    make(map[string]time.Duration),
+	}
+
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid %s entry %q: expected key:value", EnvVar, item)
+		}
+
+		if stage, ok := strings.CutSuffix(key, "-fail"); ok {
+			if !stages[stage] {
+				return nil, fmt.Errorf("invalid %s entry %q: unknown stage %q", EnvVar, item, stage)
+			}
+			rate, err := strconv.ParseFloat(value, 64)
+			if err != nil || rate < 0 || rate > 1 {
+				return nil, fmt.Errorf("invalid %s entry %q: probability must be between 0 and 1", EnvVar, item)
+			}
+			s.failRate[stage] = rate
+			continue
+		}
+
+		if stage, ok := strings.CutPrefix(key, "slow-"); ok {
+			if !stages[stage] {
+				return nil, fmt.Errorf("invalid %s entry %q: unknown stage %q", EnvVar, item, stage)
+			}
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid %s entry %q: bad duration", EnvVar, item)
+			}
+			s.delay[stage] = d
+			continue
+		}
+
+		return nil, fmt.Errorf("invalid %s entry %q: expected <stage>-fail or slow-<stage>", EnvVar, item)
+	}
+
+	return s, nil
+}
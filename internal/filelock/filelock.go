@@ -0,0 +1,79 @@
+// Package filelock is the write lock files that share a directory across
+// processes and hosts use: a file created with O_EXCL, which is atomic on
+// local filesystems and on NFSv3 and later.
+package filelock
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"time"
+)
+
+const (
+	// timeout is how long a writer waits for another to finish
+	timeout = 30 * time.Second
+	// staleAge is how old a lock gets before it is taken to belong to a
+	// writer that crashed; writers hold it for well under that
+	staleAge = 2 * time.Minute
+)
+
+// ErrHeld is returned when the lock stays taken for longer than a writer
+// waits
+var ErrHeld = errors.New("locked by another writer")
+
+// Acquire takes the lock at path, waiting for another holder to release it.
+// The file names its holder, so a lock is only ever removed by whoever
+// judged it, and only while it still says the same.
+func Acquire(path string) (release func(), err error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			// Say who holds it, for anyone inspecting a lock left behind
+			host, _ := os.Hostname()
+			holder := fmt.Sprintf("%s %d %s\n", host, os.Getpid(), time.Now().UTC().Format(time.RFC3339Nano))
+			_, err = f.WriteString(holder)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			// A writer held up past staleAge may have lost the lock to
+			// another, whose lock must not be removed
+			return func() { remove(path, holder) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		holder, rerr := os.ReadFile(path)
+		if info, err := os.Stat(path); rerr == nil && err == nil && time.Since(info.ModTime()) > staleAge {
+			remove(path, string(holder))
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrHeld
+		}
+		// Jitter keeps waiting writers from retrying in lockstep
+		time.Sleep(20*time.Millisecond + rand.N(30*time.Millisecond))
+	}
+}
+
+// remove removes the lock at path if it still names holder. It is renamed
+// aside first, and rename is atomic, so of several writers breaking the same
+// stale lock only one takes it, and a lock taken by someone else in the
+// meantime is linked back into place rather than removed.
+func remove(path, holder string) {
+	aside := fmt.Sprintf("%s.%d-%d", path, os.Getpid(), rand.Int64())
+	if os.Rename(path, aside) != nil {
+		return
+	}
+	if data, err := os.ReadFile(aside); err != nil || string(data) != holder {
+		os.Link(aside, path)
+	}
+	os.Remove(aside)
+}
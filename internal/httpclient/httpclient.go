@@ -0,0 +1,56 @@
+// Package httpclient configures the transport behind every HTTP client of
+// the process, for S3, URL downloads and --tee uploads, registries,
+// inventory webhooks, SSO, and self-update, so all of them trust the same
+// certificates and go through the same proxy.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// Options is how the process's HTTP clients verify servers
+type Options struct {
+	// CACerts are PEM files of certificates to trust besides the system's,
+	// such as a TLS-intercepting proxy's CA
+	CACerts []string
+	// InsecureSkipVerify accepts any server certificate
+	InsecureSkipVerify bool
+}
+
+// Configure replaces http.DefaultTransport, which every client without a
+// transport of its own uses, with one applying opts. Proxies are taken from
+// $HTTPS_PROXY, $HTTP_PROXY, and $NO_PROXY as before.
+func Configure(opts Options) error {
+	base, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("unexpected default HTTP transport %T", http.DefaultTransport)
+	}
+	t := base.Clone()
+	t.Proxy = http.ProxyFromEnvironment
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	if len(opts.CACerts) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, path := range opts.CACerts {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read CA certificate: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(data) {
+				return fmt.Errorf("no PEM certificates in %s", path)
+			}
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+	t.TLSClientConfig.InsecureSkipVerify = opts.InsecureSkipVerify
+	http.DefaultTransport = t
+	return nil
+}
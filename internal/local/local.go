@@ -0,0 +1,164 @@
+// Package local runs the PostgreSQL client binaries on this machine against
+// a server reached over TCP or a Unix socket, instead of inside a container
+// via docker exec. It's used wherever the tool has no access to the docker
+// socket, e.g. in a Kubernetes CronJob.
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// RequiredTools are the client binaries every --host command runs
+var RequiredTools = []string{"pg_dump", "psql", "pg_isready"}
+
+// MissingTools returns the RequiredTools that aren't on PATH
+func MissingTools() []string {
+	var missing []string
+	for _, tool := range RequiredTools {
+		if _, err := exec.LookPath(tool); err != nil {
+			missing = append(missing, tool)
+		}
+	}
+	return missing
+}
+
+// Service implements backup.DockerService with local client binaries. The
+// container name passed to its methods is ignored; libpq's PG* environment
+// variables (PGPASSWORD, PGSSLMODE, ...) apply as usual.
+type Service struct {
+	ctx  context.Context
+	host string
+	port string
+	// image, if set, runs the client binaries in a throwaway container
+	// attached as network says
+	image   string
+	network HelperNetwork
+}
+
+// HelperNetwork is how a helper container is attached. The zero value
+// shares this machine's network.
+type HelperNetwork struct {
+	// Name is a docker network to join instead, such as the user-defined
+	// network the database is on, so its container name resolves
+	Name string
+	// Aliases are extra names the helper is known by on the network
+	Aliases []string
+	// IPv4 and IPv6 are fixed addresses for the helper on the network, for
+	// pg_hba.conf rules that only admit known clients
+	IPv4, IPv6 string
+}
+
+// NewService returns a service connecting to host, which is a hostname,
+// host:port, an IP address (IPv6 in brackets to give a port, as
+// [fd00::5]:5432), or a socket directory such as /var/run/postgresql
+func NewService(host string) *Service {
+	s := &Service{ctx: context.Background(), host: host}
+	switch {
+	case strings.HasPrefix(host, "/"):
+	case strings.HasPrefix(host, "["):
+		if h, p, err := net.SplitHostPort(host); err == nil {
+			s.host, s.port = h, p
+		} else {
+			s.host = strings.Trim(host, "[]")
+		}
+	case strings.Count(host, ":") == 1:
+		s.host, s.port, _ = strings.Cut(host, ":")
+	}
+	return s
+}
+
+// WithContext returns a copy of s whose commands are killed once ctx is done
+func (s *Service) WithContext(ctx context.Context) *Service {
+	c := *s
+	c.ctx = ctx
+	return &c
+}
+
+// NewHelperService returns a service that runs the client binaries in a
+// throwaway container of image, e.g. postgres:16, for machines that don't
+// have them installed. Unless network names one to join, the container
+// shares this machine's network, so host is resolved as it would be here.
+func NewHelperService(host, image string, network HelperNetwork) *Service {
+	s := NewService(host)
+	s.image = image
+	s.network = network
+	return s
+}
+
+// VerifyContainer checks that the server accepts connections
+func (s *Service) VerifyContainer(string) error {
+	output, err := s.Command("", false, "pg_isready").CombinedOutput()
+	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("pg_isready not found: install the PostgreSQL client tools (see doctor --install-hints)")
+		}
+		return fmt.Errorf("server at %s is not accepting connections: %w\nOutput: %s", s.host, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Command prepares a client command with the connection settings in its environment
+func (s *Service) Command(_ string, interactive bool, command ...string) *exec.Cmd {
+	env := append(os.Environ(), "PGHOST="+s.host)
+	if s.port != "" {
+		env = append(env, "PGPORT="+s.port)
+	}
+	if s.image != "" {
+		command = s.helperCommand(env, interactive, command)
+	}
+	cmd := exec.CommandContext(s.ctx, command[0], command[1:]...)
+	cmd.Env = env
+	return cmd
+}
+
+// helperCommand wraps command in a docker run of the helper image, passing
+// the PG* variables of env through. /tmp is shared so the scratch directories
+// of directory-format dumps outlive each container.
+func (s *Service) helperCommand(env []string, interactive bool, command []string) []string {
+	args := []string{"docker", "run", "--rm", "-v", "/tmp:/tmp"}
+	if s.network.Name == "" {
+		args = append(args, "--network", "host")
+	} else {
+		args = append(args, "--network", s.network.Name)
+		for _, alias := range s.network.Aliases {
+			args = append(args, "--network-alias", alias)
+		}
+		if s.network.IPv4 != "" {
+			args = append(args, "--ip", s.network.IPv4)
+		}
+		if s.network.IPv6 != "" {
+			args = append(args, "--ip6", s.network.IPv6)
+		}
+	}
+	if interactive {
+		args = append(args, "-i")
+	}
+	if strings.HasPrefix(s.host, "/") {
+		args = append(args, "-v", s.host+":"+s.host)
+	}
+	seen := map[string]bool{}
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, "PG") && !seen[name] {
+			seen[name] = true
+			args = append(args, "-e", name)
+		}
+	}
+	args = append(args, s.image)
+	return append(args, command...)
+}
+
+// Exec runs a client command and returns its combined output
+func (s *Service) Exec(containerName string, command []string) ([]byte, error) {
+	return s.Command(containerName, false, command...).CombinedOutput()
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, exec.ErrNotFound)
+}
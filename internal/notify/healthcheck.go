@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Healthcheck pings a dead man's switch such as healthchecks.io: URL/start
+// as a run starts, URL when it succeeds or is skipped, and URL/fail when it
+// fails. A run that never pings at all, because cron or the host died, is
+// noticed by the service when the ping is overdue.
+type Healthcheck struct {
+	URL string
+}
+
+// Notify pings the endpoint for e's status, with its summary or error as
+// the body so it shows in the service's event log
+func (h Healthcheck) Notify(e Event) error {
+	u, err := url.Parse(h.URL)
+	if err != nil {
+		return fmt.Errorf("invalid healthcheck URL")
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	switch e.Status() {
+	case StatusStart:
+		u.Path += "/start"
+	case StatusFailure:
+		u.Path += "/fail"
+	}
+	if e.RunID != "" {
+		// Pairs each start with its outcome, so run times are measured
+		// even when runs overlap
+		q := u.Query()
+		q.Set("rid", e.RunID)
+		u.RawQuery = q.Encode()
+	}
+
+	body := summary(e)
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(u.String(), "text/plain; charset=utf-8", strings.NewReader(body))
+	if err != nil {
+		// Ping URLs are their own credentials
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("healthcheck returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Package notify tells someone how each backup run went, so a job that
+// starts failing under cron doesn't go unnoticed until a restore needs it.
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// When says which runs are notified
+type When string
+
+const (
+	// Always notifies every run
+	Always When = "always"
+	// OnFailure notifies failed runs only
+	OnFailure When = "failure"
+)
+
+// ParseWhen parses always or failure
+func ParseWhen(s string) (When, error) {
+	switch When(s) {
+	case Always, OnFailure:
+		return When(s), nil
+	}
+	return "", fmt.Errorf("invalid notify setting %q (expected always or failure)", s)
+}
+
+// Status is the point of a run an event reports
+type Status string
+
+const (
+	StatusStart   Status = "start"
+	StatusSuccess Status = "success"
+	StatusFailure Status = "failure"
+	// StatusSkip is a run that took no backup, e.g. in a blackout window
+	StatusSkip Status = "skip"
+)
+
+// ParseStatuses parses a comma-separated list of statuses
+func ParseStatuses(list string) ([]Status, error) {
+	var statuses []Status
+	for _, s := range strings.Split(list, ",") {
+		switch status := Status(strings.TrimSpace(s)); status {
+		case StatusStart, StatusSuccess, StatusFailure, StatusSkip:
+			statuses = append(statuses, status)
+		default:
+			return nil, fmt.Errorf("invalid event %q (expected start, success, failure, or skip)", s)
+		}
+	}
+	return statuses, nil
+}
+
+// Event is how one backup run went, or that it started
+type Event struct {
+	// Starting marks the event sent as the run begins, before anything
+	// below the run ID is known
+	Starting bool
+	// Name is the job's name, or database@container for a run without one
+	Name      string
+	Container string
+	Database  string
+	RunID     string
+	// Backup is the artifact written, if the run got that far
+	Backup   string
+	Size     int64
+	Duration time.Duration
+	// Skipped is why the run took no backup, e.g. a blackout window
+	Skipped string
+	// Err is why the run failed; nil if it succeeded
+	Err error
+}
+
+// Notifier delivers events somewhere people look
+type Notifier interface {
+	Notify(Event) error
+}
+
+// Status returns the point of the run e reports
+func (e Event) Status() Status {
+	switch {
+	case e.Starting:
+		return StatusStart
+	case e.Err != nil:
+		return StatusFailure
+	case e.Skipped != "":
+		return StatusSkip
+	}
+	return StatusSuccess
+}
+
+// Wants reports whether w notifies e; the start of a run never is
+func (w When) Wants(e Event) bool {
+	return !e.Starting && (e.Err != nil || w == Always)
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Slack posts events to a Slack incoming webhook
+type Slack struct {
+	WebhookURL string
+}
+
+// slackMessage is the incoming webhook payload: a headline, with the
+// details in a colored attachment
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Fields []slackField `json:"fields"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// Notify posts e to the webhook
+func (s Slack) Notify(e Event) error {
+	body, err := json.Marshal(slackPayload(e))
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(s.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The webhook URL is its credential, so it stays out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("slack webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func slackPayload(e Event) slackMessage {
+	var text, color string
+	switch {
+	case e.Err != nil:
+		text, color = fmt.Sprintf(":x: Backup *%s* failed", e.Name), "danger"
+	case e.Skipped != "":
+		text, color = fmt.Sprintf(":warning: Backup *%s* skipped", e.Name), "warning"
+	default:
+		text, color = fmt.Sprintf(":white_check_mark: Backup *%s* succeeded", e.Name), "good"
+	}
+
+	var fields []slackField
+	add := func(title, value string, short bool) {
+		if value != "" {
+			fields = append(fields, slackField{Title: title, Value: value, Short: short})
+		}
+	}
+	add("Database", e.Database, true)
+	add("Container", e.Container, true)
+	if e.Duration > 0 {
+		precision := time.Second
+		if e.Duration < time.Minute {
+			precision = 100 * time.Millisecond
+		}
+		add("Duration", e.Duration.Round(precision).String(), true)
+	}
+	if e.Size > 0 {
+		add("Size", formatSize(e.Size), true)
+	}
+	add("Backup", e.Backup, false)
+	add("Skipped", e.Skipped, false)
+	if e.Err != nil {
+		add("Error", "```"+e.Err.Error()+"```", false)
+	}
+	add("Run ID", e.RunID, true)
+	if host, err := os.Hostname(); err == nil {
+		add("Host", host, true)
+	}
+	return slackMessage{Text: text, Attachments: []slackAttachment{{Color: color, Fields: fields}}}
+}
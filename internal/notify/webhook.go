@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"text/template"
+	"time"
+)
+
+// WebhookTemplates are the built-in payload formats. Anything else passed
+// to LoadTemplate is read as a text/template file.
+var WebhookTemplates = map[string]string{
+	"json":       `{{json .}}`,
+	"discord":    `{"content": {{json .Summary}}}`,
+	"mattermost": `{"text": {{json .Summary}}}`,
+	"teams": `{
+  "@type": "MessageCard",
+  "@context": "https://schema.org/extensions",
+  "summary": {{json .Summary}},
+  "themeColor": "{{if eq .Status "failure"}}A30200{{else if eq .Status "start"}}439FE0{{else if eq .Status "skip"}}DAA038{{else}}2EB886{{end}}",
+  "title": {{json .Summary}},
+  "sections": [{"facts": [
+    {"name": "Database", "value": {{json .Database}}},
+    {"name": "Container", "value": {{json .Container}}},
+    {"name": "Run ID", "value": {{json .RunID}}},
+    {"name": "Host", "value": {{json .Host}}}{{if .Backup}},
+    {"name": "Backup", "value": {{json .Backup}}}{{end}}
+  ]}]
+}`,
+}
+
+// Record is an event as webhook templates see it
+type Record struct {
+	Status string `json:"status"`
+	// Summary is a one-line description, such as "Backup prod-db
+	// succeeded: 1.2 GiB in 4m10s"
+	Summary   string `json:"summary"`
+	Name      string `json:"name"`
+	Container string `json:"container"`
+	Database  string `json:"database,omitempty"`
+	RunID     string `json:"run_id,omitempty"`
+	Backup    string `json:"backup,omitempty"`
+	Size      int64  `json:"size_bytes,omitempty"`
+	// Duration is rendered by templates as e.g. 4m10s; JSON gets seconds
+	Duration        time.Duration `json:"-"`
+	DurationSeconds float64       `json:"duration_seconds,omitempty"`
+	Skipped         string        `json:"skipped,omitempty"`
+	Error           string        `json:"error,omitempty"`
+	Host            string        `json:"host"`
+	Time            time.Time     `json:"time"`
+}
+
+// NewRecord flattens e for a template
+func NewRecord(e Event) Record {
+	r := Record{
+		Status:          string(e.Status()),
+		Summary:         summary(e),
+		Name:            e.Name,
+		Container:       e.Container,
+		Database:        e.Database,
+		RunID:           e.RunID,
+		Backup:          e.Backup,
+		Size:            e.Size,
+		Duration:        e.Duration.Round(100 * time.Millisecond),
+		DurationSeconds: e.Duration.Seconds(),
+		Skipped:         e.Skipped,
+		Time:            time.Now(),
+	}
+	if e.Err != nil {
+		r.Error = e.Err.Error()
+	}
+	r.Host, _ = os.Hostname()
+	return r
+}
+
+func summary(e Event) string {
+	took := e.Duration.Round(100 * time.Millisecond).String()
+	switch e.Status() {
+	case StatusStart:
+		return fmt.Sprintf("Backup %s started", e.Name)
+	case StatusFailure:
+		return fmt.Sprintf("Backup %s failed after %s: %v", e.Name, took, e.Err)
+	case StatusSkip:
+		return fmt.Sprintf("Backup %s skipped: %s", e.Name, e.Skipped)
+	}
+	if e.Size > 0 {
+		return fmt.Sprintf("Backup %s succeeded: %s in %s", e.Name, formatSize(e.Size), took)
+	}
+	return fmt.Sprintf("Backup %s succeeded in %s", e.Name, took)
+}
+
+// LoadTemplate resolves a built-in template name or a template file. Besides
+// the record, templates get a json function for quoting values and size for
+// rendering byte counts.
+func LoadTemplate(name string) (*template.Template, error) {
+	text, ok := WebhookTemplates[name]
+	if !ok {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read webhook template: %w", err)
+		}
+		text = string(data)
+	}
+
+	tmpl, err := template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"size": formatSize,
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// Webhook posts events to an HTTP endpoint, rendered by a template
+type Webhook struct {
+	URL      string
+	Template *template.Template
+	// Header is sent with each request; Content-Type defaults to
+	// application/json
+	Header http.Header
+}
+
+// Notify renders e and posts it to the webhook
+func (w Webhook) Notify(e Event) error {
+	var body bytes.Buffer
+	if err := w.Template.Execute(&body, NewRecord(e)); err != nil {
+		return fmt.Errorf("failed to render webhook template: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, &body)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range w.Header {
+		req.Header[name] = values
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		// Chat webhook URLs are their own credentials
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
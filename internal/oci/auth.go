@@ -0,0 +1,106 @@
+package oci
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// credentials are registry credentials taken from the docker CLI config
+type credentials struct {
+	Username string
+	Secret   string
+}
+
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth          string `json:"auth"`
+		IdentityToken string `json:"identitytoken"`
+	} `json:"auths"`
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// dockerCredentials looks up credentials for registry the same way `docker
+// login` stored them: a per-registry credential helper, the default
+// credential store, or an inline auth entry in config.json.
+func dockerCredentials(registry string) (credentials, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return credentials{}, nil
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if os.IsNotExist(err) {
+		return credentials{}, nil
+	}
+	if err != nil {
+		return credentials{}, fmt.Errorf("failed to read docker config: %w", err)
+	}
+
+	var cfg dockerConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return credentials{}, fmt.Errorf("failed to parse docker config: %w", err)
+	}
+
+	keys := []string{registry, "https://" + registry}
+	if registry == "docker.io" || registry == "registry-1.docker.io" {
+		keys = append(keys, "https://index.docker.io/v1/")
+	}
+
+	for _, key := range keys {
+		if helper, ok := cfg.CredHelpers[key]; ok {
+			return credentialHelper(helper, key)
+		}
+	}
+	for _, key := range keys {
+		if auth, ok := cfg.Auths[key]; ok {
+			if auth.IdentityToken != "" {
+				return credentials{Secret: auth.IdentityToken}, nil
+			}
+			if auth.Auth != "" {
+				decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+				if err != nil {
+					return credentials{}, fmt.Errorf("invalid auth for %s in docker config: %w", key, err)
+				}
+				user, secret, _ := strings.Cut(string(decoded), ":")
+				return credentials{Username: user, Secret: secret}, nil
+			}
+			if cfg.CredsStore != "" {
+				return credentialHelper(cfg.CredsStore, key)
+			}
+		}
+	}
+	return credentials{}, nil
+}
+
+// credentialHelper runs docker-credential-<helper> get for serverURL
+func credentialHelper(helper, serverURL string) (credentials, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		// Helpers exit non-zero when they have no credentials for the server
+		if strings.Contains(string(output)+stderr.String(), "credentials not found") {
+			return credentials{}, nil
+		}
+		return credentials{}, fmt.Errorf("credential helper %s failed: %w\nOutput: %s", helper, err, stderr.String())
+	}
+
+	var creds credentials
+	if err := json.Unmarshal(output, &creds); err != nil {
+		return credentials{}, fmt.Errorf("credential helper %s returned invalid output: %w", helper, err)
+	}
+	return creds, nil
+}
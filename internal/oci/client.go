@@ -0,0 +1,468 @@
+package oci
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/fault"
+	"github.com/iostate/back-it-up/internal/resume"
+)
+
+// Media types used for backup artifacts
+const (
+	ManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ArtifactType      = "application/vnd.backitup.backup.v1"
+	LayerMediaType    = "application/vnd.backitup.backup.sql.gz"
+	emptyMediaType    = "application/vnd.oci.empty.v1+json"
+)
+
+// emptyConfig is the OCI "empty descriptor" blob
+var emptyConfig = []byte("{}")
+
+// Descriptor references a blob in a registry
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Manifest is an OCI image manifest carrying a single backup layer
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// Client pushes and pulls backup artifacts using the OCI distribution API
+type Client struct {
+	http  *http.Client
+	token string
+}
+
+// NewClient returns a registry client that authenticates with credentials
+// from the docker CLI config
+func NewClient() *Client {
+	return &Client{http: &http.Client{}}
+}
+
+// Push uploads the backup at path and tags it as ref. It returns the layer
+// descriptor and the manifest digest.
+func (c *Client) Push(ref Reference, path string, annotations map[string]string) (Descriptor, string, error) {
+	layer, err := fileDescriptor(path)
+	if err != nil {
+		return Descriptor{}, "", err
+	}
+	layer.Annotations = map[string]string{"org.opencontainers.image.title": filepath.Base(path)}
+
+	config, err := c.pushConfig(ref)
+	if err != nil {
+		return Descriptor{}, "", err
+	}
+	if err := c.pushBlob(ref, layer, func() (io.ReadCloser, error) { return os.Open(path) }); err != nil {
+		return Descriptor{}, "", err
+	}
+	digest, err := c.pushManifest(ref, config, layer, annotations)
+	if err != nil {
+		return Descriptor{}, "", err
+	}
+	return layer, digest, nil
+}
+
+// PushStream uploads a backup read from r as it is produced, naming it name,
+// and tags it as ref. The size and digest don't need to be known up front:
+// the layer goes up as a chunked upload and is committed with the digest
+// computed on the way through. Nothing is tagged if r fails.
+func (c *Client) PushStream(ref Reference, name string, r io.Reader, annotations map[string]string) (Descriptor, string, error) {
+	config, err := c.pushConfig(ref)
+	if err != nil {
+		return Descriptor{}, "", err
+	}
+	layer, err := c.uploadStream(ref, r)
+	if err != nil {
+		return Descriptor{}, "", err
+	}
+	layer.Annotations = map[string]string{"org.opencontainers.image.title": name}
+	digest, err := c.pushManifest(ref, config, layer, annotations)
+	if err != nil {
+		return Descriptor{}, "", err
+	}
+	return layer, digest, nil
+}
+
+// pushConfig uploads the empty config blob every artifact manifest points at
+func (c *Client) pushConfig(ref Reference) (Descriptor, error) {
+	config := Descriptor{MediaType: emptyMediaType, Digest: digestOf(emptyConfig), Size: int64(len(emptyConfig))}
+	if err := c.pushBlob(ref, config, bytesBody(emptyConfig)); err != nil {
+		return Descriptor{}, err
+	}
+	return config, nil
+}
+
+// pushManifest tags ref with a manifest for layer and returns its digest
+func (c *Client) pushManifest(ref Reference, config, layer Descriptor, annotations map[string]string) (string, error) {
+	manifest := Manifest{
+		SchemaVersion: 2,
+		MediaType:     ManifestMediaType,
+		ArtifactType:  ArtifactType,
+		Config:        config,
+		Layers:        []Descriptor{layer},
+		Annotations:   map[string]string{"org.opencontainers.image.created": time.Now().UTC().Format(time.RFC3339)},
+	}
+	for k, v := range annotations {
+		manifest.Annotations[k] = v
+	}
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	resp, err := c.do(ref, "push", http.MethodPut, ref.baseURL()+ref.Repository+"/manifests/"+ref.Tag,
+		http.Header{"Content-Type": {ManifestMediaType}, "Content-Length": {fmt.Sprint(len(body))}}, bytesBody(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to push manifest: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("failed to push manifest: %s", resp.Status)
+	}
+	return digestOf(body), nil
+}
+
+// Pull downloads the backup tagged ref into dir, verifying its digest, and
+// returns the local path
+func (c *Client) Pull(ref Reference, dir string) (string, error) {
+	resp, err := c.do(ref, "pull", http.MethodGet, ref.baseURL()+ref.Repository+"/manifests/"+ref.Tag,
+		http.Header{"Accept": {ManifestMediaType}}, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch manifest for %s: %s", ref, resp.Status)
+	}
+
+	var manifest Manifest
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&manifest); err != nil {
+		return "", fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	var layer *Descriptor
+	for i := range manifest.Layers {
+		if manifest.Layers[i].MediaType == LayerMediaType {
+			layer = &manifest.Layers[i]
+			break
+		}
+	}
+	if layer == nil {
+		return "", fmt.Errorf("%s is not a back-it-up artifact", ref)
+	}
+
+	name := filepath.Base(layer.Annotations["org.opencontainers.image.title"])
+	if name == "." || name == "/" || name == "" {
+		name = strings.TrimPrefix(layer.Digest, "sha256:") + ".sql.gz"
+	}
+
+	outPath := filepath.Join(dir, name)
+	out, err := os.Create(outPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create download file: %w", err)
+	}
+	h := sha256.New()
+	_, err = resume.Fetch(func(header http.Header) (*http.Response, error) {
+		return c.do(ref, "pull", http.MethodGet, ref.baseURL()+ref.Repository+"/blobs/"+layer.Digest, header, nil)
+	}, out, h, resume.DefaultRetries)
+	if err != nil {
+		out.Close()
+		os.Remove(outPath)
+		return "", fmt.Errorf("failed to download blob %s: %w", layer.Digest, err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(outPath)
+		return "", fmt.Errorf("failed to write download file: %w", err)
+	}
+	if actual := fmt.Sprintf("sha256:%x", h.Sum(nil)); actual != layer.Digest {
+		os.Remove(outPath)
+		return "", fmt.Errorf("digest mismatch for %s: expected %s, got %s", ref, layer.Digest, actual)
+	}
+	return outPath, nil
+}
+
+// pushBlob uploads a blob unless the registry already has it
+func (c *Client) pushBlob(ref Reference, desc Descriptor, open func() (io.ReadCloser, error)) error {
+	base := ref.baseURL() + ref.Repository + "/blobs/"
+	resp, err := c.do(ref, "push", http.MethodHead, base+desc.Digest, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to check blob: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	resp, err = c.do(ref, "push", http.MethodPost, base+"uploads/", nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start blob upload: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("failed to start blob upload: %s", resp.Status)
+	}
+
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("registry returned invalid upload location: %w", err)
+	}
+	query := location.Query()
+	query.Set("digest", desc.Digest)
+	location.RawQuery = query.Encode()
+
+	if err := fault.Inject(fault.StageUpload); err != nil {
+		return fmt.Errorf("failed to upload blob: %w", err)
+	}
+	resp, err = c.do(ref, "push", http.MethodPut, location.String(), http.Header{
+		"Content-Type":   {"application/octet-stream"},
+		"Content-Length": {fmt.Sprint(desc.Size)},
+	}, open)
+	if err != nil {
+		return fmt.Errorf("failed to upload blob: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to upload blob %s: %s", desc.Digest, resp.Status)
+	}
+	return nil
+}
+
+// uploadStream sends r as a single streamed PATCH and commits it under the
+// digest of what was read
+func (c *Client) uploadStream(ref Reference, r io.Reader) (Descriptor, error) {
+	resp, err := c.do(ref, "push", http.MethodPost, ref.baseURL()+ref.Repository+"/blobs/uploads/", nil, nil)
+	if err != nil {
+		return Descriptor{}, fmt.Errorf("failed to start blob upload: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return Descriptor{}, fmt.Errorf("failed to start blob upload: %s", resp.Status)
+	}
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return Descriptor{}, fmt.Errorf("registry returned invalid upload location: %w", err)
+	}
+
+	// The stream can only be read once, so the auth retry in do must not replay it
+	h := sha256.New()
+	counter := &countingReader{r: io.TeeReader(r, h)}
+	sent := false
+	resp, err = c.do(ref, "push", http.MethodPatch, location.String(), http.Header{
+		"Content-Type": {"application/octet-stream"},
+	}, func() (io.ReadCloser, error) {
+		if sent {
+			return nil, fmt.Errorf("registry rejected credentials during a streamed upload")
+		}
+		sent = true
+		return io.NopCloser(counter), nil
+	})
+	if err != nil {
+		return Descriptor{}, fmt.Errorf("failed to upload blob: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return Descriptor{}, fmt.Errorf("failed to upload blob: %s", resp.Status)
+	}
+
+	desc := Descriptor{MediaType: LayerMediaType, Digest: fmt.Sprintf("sha256:%x", h.Sum(nil)), Size: counter.n}
+	if location, err = resp.Request.URL.Parse(resp.Header.Get("Location")); err != nil {
+		return Descriptor{}, fmt.Errorf("registry returned invalid upload location: %w", err)
+	}
+	query := location.Query()
+	query.Set("digest", desc.Digest)
+	location.RawQuery = query.Encode()
+
+	// Once the stream has been sent, so a failure leaves the upload uncommitted
+	if err := fault.Inject(fault.StageUpload); err != nil {
+		return Descriptor{}, fmt.Errorf("failed to commit blob: %w", err)
+	}
+	resp, err = c.do(ref, "push", http.MethodPut, location.String(), http.Header{"Content-Length": {"0"}}, nil)
+	if err != nil {
+		return Descriptor{}, fmt.Errorf("failed to commit blob: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return Descriptor{}, fmt.Errorf("failed to commit blob %s: %s", desc.Digest, resp.Status)
+	}
+	return desc, nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// do sends a request, answering a registry auth challenge once if needed
+func (c *Client) do(ref Reference, action, method, rawURL string, header http.Header, body func() (io.ReadCloser, error)) (*http.Response, error) {
+	send := func() (*http.Response, error) {
+		req, err := http.NewRequest(method, rawURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if n := header.Get("Content-Length"); n != "" {
+			fmt.Sscan(n, &req.ContentLength)
+		}
+		if body != nil {
+			rc, err := body()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = rc
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", c.token)
+		}
+		return c.http.Do(req)
+	}
+
+	resp, err := send()
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	if err := c.authenticate(ref, action, challenge); err != nil {
+		return nil, err
+	}
+	return send()
+}
+
+// authenticate answers a Basic or Bearer WWW-Authenticate challenge
+func (c *Client) authenticate(ref Reference, action, challenge string) error {
+	creds, err := dockerCredentials(ref.Registry)
+	if err != nil {
+		return err
+	}
+
+	scheme, params := parseChallenge(challenge)
+	switch scheme {
+	case "basic":
+		if creds.Secret == "" {
+			return fmt.Errorf("registry %s requires authentication: run `docker login %s`", ref.Registry, ref.Registry)
+		}
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(creds.Username, creds.Secret)
+		c.token = req.Header.Get("Authorization")
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("registry %s sent unsupported auth challenge %q", ref.Registry, challenge)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Scheme == "" {
+		return fmt.Errorf("registry %s sent invalid token realm %q", ref.Registry, params["realm"])
+	}
+	scope := "repository:" + ref.Repository + ":pull"
+	if action == "push" {
+		scope += ",push"
+	}
+	query := realm.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if creds.Secret != "" {
+		req.SetBasicAuth(creds.Username, creds.Secret)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch registry token from %s: %s", realm.Host, resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("failed to decode registry token: %w", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	c.token = "Bearer " + token.Token
+	return nil
+}
+
+// parseChallenge splits `Bearer realm="...",service="..."` into its scheme and parameters
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := map[string]string{}
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, ", "), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key != "" {
+			params[strings.ToLower(strings.TrimSpace(key))] = value
+		}
+	}
+	return strings.ToLower(scheme), params
+}
+
+// fileDescriptor computes the layer descriptor for a backup file
+func fileDescriptor(path string) (Descriptor, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Descriptor{}, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return Descriptor{}, fmt.Errorf("failed to hash backup file: %w", err)
+	}
+	return Descriptor{MediaType: LayerMediaType, Digest: fmt.Sprintf("sha256:%x", h.Sum(nil)), Size: n}, nil
+}
+
+func digestOf(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+func bytesBody(data []byte) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(string(data))), nil
+	}
+}
@@ -0,0 +1,78 @@
+package oci
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Scheme prefixes backup locations stored in an OCI registry
+const Scheme = "oci://"
+
+// Reference identifies a backup artifact in a registry, e.g.
+// oci://registry.example.com/backups/mydb:2025-01-02
+type Reference struct {
+	Registry   string
+	Repository string
+	// Tag or digest ("sha256:...") of the manifest
+	Tag string
+}
+
+// IsReference reports whether s uses the oci:// scheme
+func IsReference(s string) bool {
+	return strings.HasPrefix(s, Scheme)
+}
+
+// ParseReference parses an oci:// reference. The tag defaults to "latest".
+func ParseReference(s string) (Reference, error) {
+	rest, ok := strings.CutPrefix(s, Scheme)
+	if !ok {
+		return Reference{}, fmt.Errorf("invalid OCI reference %q: missing %s prefix", s, Scheme)
+	}
+
+	registry, repo, ok := strings.Cut(rest, "/")
+	if !ok || registry == "" || repo == "" {
+		return Reference{}, fmt.Errorf("invalid OCI reference %q: expected %sregistry/repository[:tag]", s, Scheme)
+	}
+
+	ref := Reference{Registry: registry, Repository: repo, Tag: "latest"}
+	if name, digest, ok := strings.Cut(repo, "@"); ok {
+		ref.Repository, ref.Tag = name, digest
+	} else if i := strings.LastIndex(repo, ":"); i >= 0 {
+		ref.Repository, ref.Tag = repo[:i], repo[i+1:]
+	}
+	if ref.Repository == "" || ref.Tag == "" {
+		return Reference{}, fmt.Errorf("invalid OCI reference %q", s)
+	}
+	if ref.Repository != strings.ToLower(ref.Repository) {
+		return Reference{}, fmt.Errorf("invalid OCI reference %q: repository must be lowercase", s)
+	}
+	return ref, nil
+}
+
+// String formats the reference back into oci:// form
+func (r Reference) String() string {
+	sep := ":"
+	if strings.HasPrefix(r.Tag, "sha256:") {
+		sep = "@"
+	}
+	return Scheme + r.Registry + "/" + r.Repository + sep + r.Tag
+}
+
+// WithDigest returns the reference pinned to a manifest digest
+func (r Reference) WithDigest(digest string) Reference {
+	r.Tag = digest
+	return r
+}
+
+// baseURL is the registry API root. Like docker, plain HTTP is only used for
+// registries on the local machine.
+func (r Reference) baseURL() string {
+	host := r.Registry
+	if h, _, ok := strings.Cut(host, ":"); ok {
+		host = h
+	}
+	if host == "localhost" || host == "127.0.0.1" || host == "[::1]" {
+		return "http://" + r.Registry + "/v2/"
+	}
+	return "https://" + r.Registry + "/v2/"
+}
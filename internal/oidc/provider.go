@@ -0,0 +1,186 @@
+// Package oidc implements the parts of OpenID Connect `serve` needs to log
+// users in through an identity provider (Keycloak, Google, Entra ID, ...):
+// discovery, the authorization code flow with PKCE, and ID/access token
+// verification against the provider's published keys.
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config describes a client registered with the identity provider
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback the provider sends users back to
+	RedirectURL string
+	// Scopes requested in addition to "openid"
+	Scopes []string
+}
+
+// discovery is the subset of the provider metadata document used here
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is a discovered identity provider
+type Provider struct {
+	cfg  Config
+	meta discovery
+	http *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]any
+	fetchedAt time.Time
+}
+
+// Discover reads the provider metadata from <issuer>/.well-known/openid-configuration
+func Discover(cfg Config) (*Provider, error) {
+	p := &Provider{cfg: cfg, http: &http.Client{Timeout: 30 * time.Second}}
+	issuer := strings.TrimSuffix(cfg.Issuer, "/")
+
+	resp, err := p.http.Get(issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to discover OIDC provider: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&p.meta); err != nil {
+		return nil, fmt.Errorf("failed to parse OIDC provider metadata: %w", err)
+	}
+	// The issuer in tokens must match the configured one exactly
+	if strings.TrimSuffix(p.meta.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("OIDC provider reports issuer %q, expected %q", p.meta.Issuer, cfg.Issuer)
+	}
+	if p.meta.AuthorizationEndpoint == "" || p.meta.TokenEndpoint == "" || p.meta.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC provider metadata is missing endpoints")
+	}
+	return p, nil
+}
+
+// AuthRequest holds the per-login secrets that must survive the redirect
+type AuthRequest struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// NewAuthRequest generates fresh state, nonce, and PKCE verifier values
+func NewAuthRequest() (AuthRequest, error) {
+	var values [3]string
+	for i := range values {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return AuthRequest{}, fmt.Errorf("failed to generate login state: %w", err)
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(buf)
+	}
+	return AuthRequest{State: values[0], Nonce: values[1], Verifier: values[2]}, nil
+}
+
+// AuthCodeURL returns where to send the user to log in
+func (p *Provider) AuthCodeURL(req AuthRequest) string {
+	challenge := sha256.Sum256([]byte(req.Verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.cfg.Scopes...), " ")},
+		"state":                 {req.State},
+		"nonce":                 {req.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.meta.AuthorizationEndpoint + sep + q.Encode()
+}
+
+// Exchange trades an authorization code for tokens and returns the verified
+// claims of the ID token
+func (p *Provider) Exchange(code string, req AuthRequest) (Claims, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {req.Verifier},
+	}
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+
+	resp, err := p.http.PostForm(p.meta.TokenEndpoint, form)
+	if err != nil {
+		return nil, fmt.Errorf("token exchange failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token exchange failed: %s\nOutput: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil || tokens.IDToken == "" {
+		return nil, fmt.Errorf("token response has no id_token")
+	}
+
+	claims, err := p.Verify(tokens.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.String("nonce") != req.Nonce {
+		return nil, fmt.Errorf("ID token nonce does not match the login request")
+	}
+	return claims, nil
+}
+
+// keysFor returns the provider's signing keys, refetching them when kid is
+// unknown so key rotation is picked up without a restart
+func (p *Provider) keysFor(kid string) (map[string]any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.keys[kid]; ok {
+		return p.keys, nil
+	}
+	// Don't let tokens with made-up key IDs hammer the provider
+	if p.keys != nil && time.Since(p.fetchedAt) < time.Minute {
+		return p.keys, nil
+	}
+
+	resp, err := p.http.Get(p.meta.JWKSURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch OIDC signing keys: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch OIDC signing keys: %s", resp.Status)
+	}
+	keys, err := parseJWKS(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	p.keys, p.fetchedAt = keys, time.Now()
+	return keys, nil
+}
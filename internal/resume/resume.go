@@ -0,0 +1,135 @@
+// Package resume downloads over HTTP, picking an interrupted transfer up
+// from the last byte received with a Range request instead of starting over.
+package resume
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultRetries is how many times an interrupted download is resumed
+const DefaultRetries = 5
+
+// maxBackoff caps the wait between attempts
+const maxBackoff = 30 * time.Second
+
+// Sender issues the GET for the download; header carries the Range and
+// If-Range values of a resumed attempt and is empty for the first one
+type Sender func(header http.Header) (*http.Response, error)
+
+// Fetch writes the body send returns to out, hashing it into h as it goes.
+// A network error or a 5xx mid-transfer is retried up to retries times
+// from the current offset. If the server ignores the range, or the object
+// changed since the first attempt (If-Range mismatch), the file and hash
+// are reset and the download starts from the beginning. It returns the
+// number of bytes written.
+func Fetch(send Sender, out *os.File, h hash.Hash, retries int) (int64, error) {
+	var offset int64
+	var validator string
+	backoff := time.Second
+
+	for attempt := 0; ; attempt++ {
+		header := http.Header{}
+		if offset > 0 {
+			header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			if validator != "" {
+				header.Set("If-Range", validator)
+			}
+		}
+
+		n, err := fetchOnce(send, header, out, h, &offset, &validator)
+		if err == nil {
+			return n, nil
+		}
+		if !retryable(err) || attempt >= retries {
+			return offset, err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: download interrupted at %d bytes (%v), resuming in %s...\n", offset, err, backoff)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// permanentError marks failures that resuming can't fix
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+func retryable(err error) bool {
+	_, permanent := err.(permanentError)
+	return !permanent
+}
+
+// fetchOnce runs one attempt, advancing offset by what it wrote
+func fetchOnce(send Sender, header http.Header, out *os.File, h hash.Hash, offset *int64, validator *string) (int64, error) {
+	resp, err := send(header)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		if *offset > 0 {
+			// Range ignored or object replaced: what we have is no good
+			if err := restart(out, h); err != nil {
+				return 0, permanentError{err}
+			}
+			*offset = 0
+		}
+		*validator = rangeValidator(resp.Header)
+	case resp.StatusCode == http.StatusPartialContent && *offset > 0:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", *offset)) {
+			return 0, permanentError{fmt.Errorf("server resumed at the wrong offset: %s", resp.Header.Get("Content-Range"))}
+		}
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return 0, fmt.Errorf("%s", resp.Status)
+	default:
+		return 0, permanentError{fmt.Errorf("%s", resp.Status)}
+	}
+
+	n, err := io.Copy(io.MultiWriter(fileWriter{out}, h), resp.Body)
+	*offset += n
+	if err != nil {
+		return 0, err
+	}
+	return *offset, nil
+}
+
+// rangeValidator picks the value If-Range can use to detect a changed
+// object; weak ETags aren't allowed there, so Last-Modified is the fallback
+func rangeValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
+
+// fileWriter marks local write failures (a full disk) as permanent so only
+// network errors are retried
+type fileWriter struct{ f *os.File }
+
+func (w fileWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	if err != nil {
+		return n, permanentError{fmt.Errorf("failed to write download file: %w", err)}
+	}
+	return n, nil
+}
+
+func restart(out *os.File, h hash.Hash) error {
+	if err := out.Truncate(0); err != nil {
+		return fmt.Errorf("failed to reset download file: %w", err)
+	}
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to reset download file: %w", err)
+	}
+	h.Reset()
+	return nil
+}
@@ -0,0 +1,275 @@
+// Package retention decides which catalogued backups a retention policy
+// keeps and which have expired. Policies apply to each series of backups
+// separately: the backups of one database, volume, or container's
+// configuration, kept in one place.
+package retention
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/catalog"
+	"github.com/iostate/back-it-up/internal/storage"
+)
+
+// Policy says which backups of a series to keep. A backup is kept if any
+// of the rules keeps it.
+type Policy struct {
+	// KeepLast keeps the newest KeepLast backups
+	KeepLast int
+	// KeepDaily, KeepWeekly, KeepMonthly, and KeepYearly keep the newest
+	// backup of each of that many days, ISO weeks, months, and years in
+	// local time, counting back from the newest that has a backup. Periods
+	// without one don't count.
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	KeepYearly  int
+	// KeepWithin keeps every backup taken within this long of the newest
+	// of its series
+	KeepWithin time.Duration
+	// MaxTotalSize caps the total size of the backups kept in each place,
+	// whatever the other rules keep: the oldest are removed until the rest
+	// fit. The newest backup of each series always stays, so a place can
+	// still end up over the cap. Without other rules, everything else is
+	// kept while it fits.
+	MaxTotalSize int64
+	// KeepTagged are glob patterns of tags whose backups are always kept,
+	// by the other rules and MaxTotalSize alike. It isn't a rule of its
+	// own: on its own it keeps nothing else.
+	KeepTagged []string
+}
+
+// Empty reports whether p has no rules, and so would keep nothing
+func (p Policy) Empty() bool {
+	return !p.hasKeepRules() && p.MaxTotalSize == 0
+}
+
+// hasKeepRules reports whether p has rules other than MaxTotalSize
+func (p Policy) hasKeepRules() bool {
+	return p.KeepLast != 0 || p.KeepDaily != 0 || p.KeepWeekly != 0 || p.KeepMonthly != 0 || p.KeepYearly != 0 || p.KeepWithin != 0
+}
+
+// tagged reports whether e has a tag matching one of KeepTagged
+func (p Policy) tagged(e catalog.Entry) bool {
+	for _, pattern := range p.KeepTagged {
+		for _, tag := range e.Tags {
+			if ok, _ := path.Match(pattern, tag); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Validate checks that no rule of p is negative
+func (p Policy) Validate() error {
+	for _, n := range []int{p.KeepLast, p.KeepDaily, p.KeepWeekly, p.KeepMonthly, p.KeepYearly} {
+		if n < 0 {
+			return fmt.Errorf("retention counts can't be negative")
+		}
+	}
+	if p.KeepWithin < 0 || p.MaxTotalSize < 0 {
+		return fmt.Errorf("retention limits can't be negative")
+	}
+	for _, pattern := range p.KeepTagged {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid tag pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// period is a calendar rule of a policy: how many periods it keeps, and
+// which period a time falls in
+type period struct {
+	keep int
+	key  func(time.Time) string
+}
+
+func (p Policy) periods() []period {
+	return []period{
+		{p.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{p.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{p.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{p.KeepYearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+}
+
+// seriesState tracks what a policy has kept of one series so far
+type seriesState struct {
+	// newest is when the newest backup of the series was taken
+	newest time.Time
+	last   int
+	// kept and lastKey count, per calendar rule, the periods kept and the
+	// last of them
+	kept    []int
+	lastKey []string
+}
+
+// keeps reports whether p keeps a backup taken at t, given the newer ones
+// of its series already seen
+func (p Policy) keeps(s *seriesState, periods []period, t time.Time) bool {
+	if !p.hasKeepRules() {
+		return true
+	}
+	keep := p.KeepWithin > 0 && s.newest.Sub(t) <= p.KeepWithin
+	if s.last < p.KeepLast {
+		s.last++
+		keep = true
+	}
+	t = t.Local()
+	for i, rule := range periods {
+		if s.kept[i] >= rule.keep {
+			continue
+		}
+		// Sorted newest first, so the first backup seen in a period is its newest
+		if key := rule.key(t); key != s.lastKey[i] {
+			s.kept[i]++
+			s.lastKey[i] = key
+			keep = true
+		}
+	}
+	return keep
+}
+
+// Prunable reports whether e is an artifact retention applies to. Records
+// of runs that left nothing behind, verifications, and undo points taken
+// before a restore are never pruned, and neither are copies pushed to a
+// registry or an HTTP endpoint, whose own retention applies to them.
+func Prunable(e catalog.Entry) bool {
+	if strings.Contains(e.Path, "://") && !storage.IsLocation(e.Path) {
+		return false
+	}
+	switch e.Kind {
+	case catalog.KindBackup, catalog.KindVolume, catalog.KindInspect:
+		return true
+	}
+	return false
+}
+
+// Series names the series e belongs to. Copies of one backup stored in
+// different places, as by --tee, are in different series, as
+// are schema-only and data-only backups of a database.
+func Series(e catalog.Entry) string {
+	return strings.Join([]string{e.Kind, e.ContainerName, e.DatabaseName, e.Volume, e.Content, Where(e.Path)}, "\x00")
+}
+
+// Where returns the directory or store prefix the backup at p is kept in
+func Where(p string) string {
+	if storage.IsLocation(p) {
+		return p[:strings.LastIndex(p, "/")]
+	}
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	return filepath.Dir(p)
+}
+
+// Apply splits the prunable entries into those p keeps and those that have
+// expired, both newest first. Entries retention doesn't apply to are in
+// neither.
+func Apply(p Policy, entries []catalog.Entry) (keep, expired []catalog.Entry) {
+	var candidates []catalog.Entry
+	for _, e := range entries {
+		if Prunable(e) {
+			candidates = append(candidates, e)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].CreatedAt.After(candidates[j].CreatedAt)
+	})
+
+	periods := p.periods()
+	states := make(map[string]*seriesState)
+	for _, e := range candidates {
+		series := Series(e)
+		s := states[series]
+		if s == nil {
+			s = &seriesState{newest: e.CreatedAt, kept: make([]int, len(periods)), lastKey: make([]string, len(periods))}
+			states[series] = s
+		}
+		// Tagged backups still count towards the rules, so they don't keep
+		// an extra untagged one in their stead
+		if p.keeps(s, periods, e.CreatedAt) || p.tagged(e) {
+			keep = append(keep, e)
+			continue
+		}
+		expired = append(expired, e)
+	}
+	if p.MaxTotalSize > 0 {
+		keep, expired = p.fit(keep, expired)
+	}
+	return keep, expired
+}
+
+// fit removes the oldest of the kept entries until those in each place add
+// up to at most MaxTotalSize, sparing the newest of each series and tagged
+// ones
+func (p Policy) fit(keep, expired []catalog.Entry) ([]catalog.Entry, []catalog.Entry) {
+	total := make(map[string]int64)
+	spared := make(map[int]bool)
+	seen := make(map[string]bool)
+	for i, e := range keep {
+		total[Where(e.Path)] += e.Size
+		// keep is newest first, so the first of each series is its newest
+		if series := Series(e); !seen[series] {
+			seen[series] = true
+			spared[i] = true
+		}
+		if p.tagged(e) {
+			spared[i] = true
+		}
+	}
+
+	removed := make(map[int]bool)
+	for i := len(keep) - 1; i >= 0; i-- {
+		where := Where(keep[i].Path)
+		if !spared[i] && total[where] > p.MaxTotalSize {
+			removed[i] = true
+			total[where] -= keep[i].Size
+		}
+	}
+	if len(removed) == 0 {
+		return keep, expired
+	}
+
+	var fitted []catalog.Entry
+	for i, e := range keep {
+		if removed[i] {
+			expired = append(expired, e)
+			continue
+		}
+		fitted = append(fitted, e)
+	}
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].CreatedAt.After(expired[j].CreatedAt)
+	})
+	return fitted, expired
+}
+
+// Over returns the total size of the kept entries in each place still over
+// MaxTotalSize, which only the newest backups of its series and tagged ones
+// can be
+func (p Policy) Over(keep []catalog.Entry) map[string]int64 {
+	if p.MaxTotalSize <= 0 {
+		return nil
+	}
+	total := make(map[string]int64)
+	for _, e := range keep {
+		total[Where(e.Path)] += e.Size
+	}
+	for where, size := range total {
+		if size <= p.MaxTotalSize {
+			delete(total, where)
+		}
+	}
+	return total
+}
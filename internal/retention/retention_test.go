@@ -0,0 +1,167 @@
+package retention
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/catalog"
+)
+
+// newest is a Sunday, so its ISO week started on 2025-06-09
+var newest = time.Date(2025, 6, 15, 12, 0, 0, 0, time.Local)
+
+// daily returns a backup of app a day for n days up to newest, newest first
+func daily(n int) []catalog.Entry {
+	var entries []catalog.Entry
+	for i := range n {
+		entries = append(entries, entry(newest.AddDate(0, 0, -i)))
+	}
+	return entries
+}
+
+func entry(t time.Time) catalog.Entry {
+	return catalog.Entry{
+		ID:            t.Format("2006-01-02T15"),
+		Kind:          catalog.KindBackup,
+		Path:          "/backups/app_" + t.Format("2006_01_02_15_04_05") + ".sql.gz",
+		ContainerName: "pg",
+		DatabaseName:  "app",
+		CreatedAt:     t,
+		Size:          100,
+	}
+}
+
+func ids(entries []catalog.Entry) []string {
+	out := []string{}
+	for _, e := range entries {
+		out = append(out, e.ID)
+	}
+	return out
+}
+
+func TestApply(t *testing.T) {
+	tagged := daily(5)
+	tagged[3].Tags = []string{"release-1.2"}
+	taggedNewest := daily(3)
+	taggedNewest[0].Tags = []string{"release-1.3"}
+	sparse := []catalog.Entry{entry(newest), entry(newest.AddDate(0, 0, -5)), entry(newest.AddDate(0, 0, -14))}
+	twiceADay := []catalog.Entry{entry(newest), entry(newest.Add(-4 * time.Hour)), entry(newest.AddDate(0, 0, -1)), entry(newest.AddDate(0, 0, -2))}
+	otherDB := daily(2)
+	for i := range otherDB {
+		otherDB[i].DatabaseName = "billing"
+		otherDB[i].ID = "billing-" + otherDB[i].ID
+	}
+	nonPrunable := append(daily(2),
+		catalog.Entry{ID: "verify", Kind: catalog.KindVerify, CreatedAt: newest.AddDate(0, 0, -3)},
+		catalog.Entry{ID: "pushed", Kind: catalog.KindBackup, Path: "https://example.com/app.sql.gz", CreatedAt: newest.AddDate(0, 0, -4)},
+	)
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		entries []catalog.Entry
+		keep    []string
+		expired []string
+	}{
+		{"keep last", Policy{KeepLast: 3}, daily(5),
+			[]string{"2025-06-15T12", "2025-06-14T12", "2025-06-13T12"}, []string{"2025-06-12T12", "2025-06-11T12"}},
+		{"keep daily takes each day's newest", Policy{KeepDaily: 2}, twiceADay,
+			[]string{"2025-06-15T12", "2025-06-14T12"}, []string{"2025-06-15T08", "2025-06-13T12"}},
+		{"days without a backup don't count", Policy{KeepDaily: 2}, sparse,
+			[]string{"2025-06-15T12", "2025-06-10T12"}, []string{"2025-06-01T12"}},
+		{"keep weekly", Policy{KeepWeekly: 2}, daily(14),
+			[]string{"2025-06-15T12", "2025-06-08T12"}, ids(slices.Concat(daily(14)[1:7], daily(14)[8:]))},
+		{"keep monthly", Policy{KeepMonthly: 2}, daily(60),
+			[]string{"2025-06-15T12", "2025-05-31T12"}, nil},
+		{"keep yearly", Policy{KeepYearly: 2}, daily(400),
+			[]string{"2025-06-15T12", "2024-12-31T12"}, nil},
+		{"keep within includes the boundary", Policy{KeepWithin: 48 * time.Hour}, daily(5),
+			[]string{"2025-06-15T12", "2025-06-14T12", "2025-06-13T12"}, []string{"2025-06-12T12", "2025-06-11T12"}},
+		{"rules add up", Policy{KeepLast: 1, KeepWeekly: 2}, daily(10),
+			[]string{"2025-06-15T12", "2025-06-08T12"}, nil},
+		{"tagged backups are kept", Policy{KeepLast: 1, KeepTagged: []string{"release-*"}}, tagged,
+			[]string{"2025-06-15T12", "2025-06-12T12"}, []string{"2025-06-14T12", "2025-06-13T12", "2025-06-11T12"}},
+		{"tagged backups count towards the rules", Policy{KeepLast: 2, KeepTagged: []string{"release-*"}}, taggedNewest,
+			[]string{"2025-06-15T12", "2025-06-14T12"}, []string{"2025-06-13T12"}},
+		{"size budget alone", Policy{MaxTotalSize: 250}, daily(5),
+			[]string{"2025-06-15T12", "2025-06-14T12"}, []string{"2025-06-13T12", "2025-06-12T12", "2025-06-11T12"}},
+		{"size budget over the other rules", Policy{KeepLast: 4, MaxTotalSize: 300}, daily(5),
+			[]string{"2025-06-15T12", "2025-06-14T12", "2025-06-13T12"}, []string{"2025-06-12T12", "2025-06-11T12"}},
+		{"size budget spares the newest", Policy{MaxTotalSize: 50}, daily(3),
+			[]string{"2025-06-15T12"}, []string{"2025-06-14T12", "2025-06-13T12"}},
+		{"size budget spares tagged backups", Policy{MaxTotalSize: 250, KeepTagged: []string{"release-*"}}, tagged,
+			[]string{"2025-06-15T12", "2025-06-12T12"}, []string{"2025-06-14T12", "2025-06-13T12", "2025-06-11T12"}},
+		{"series are separate", Policy{KeepLast: 1}, slices.Concat(daily(2), otherDB),
+			[]string{"2025-06-15T12", "billing-2025-06-15T12"}, []string{"2025-06-14T12", "billing-2025-06-14T12"}},
+		{"entries retention doesn't apply to", Policy{KeepLast: 1}, nonPrunable,
+			[]string{"2025-06-15T12"}, []string{"2025-06-14T12"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep, expired := Apply(tt.policy, tt.entries)
+			if got := ids(keep); !slices.Equal(got, tt.keep) {
+				t.Errorf("keep = %v, want %v", got, tt.keep)
+			}
+			if tt.expired == nil {
+				if want := len(tt.entries) - len(tt.keep); len(expired) != want {
+					t.Errorf("%d expired, want %d", len(expired), want)
+				}
+				return
+			}
+			if got := ids(expired); !slices.Equal(got, tt.expired) {
+				t.Errorf("expired = %v, want %v", got, tt.expired)
+			}
+		})
+	}
+}
+
+func TestOver(t *testing.T) {
+	p := Policy{MaxTotalSize: 150}
+	keep := daily(1)
+	keep[0].Size = 200
+	if over := p.Over(keep); over["/backups"] != 200 || len(over) != 1 {
+		t.Errorf("Over = %v, want map[/backups:200]", over)
+	}
+	if over := p.Over(daily(1)); len(over) != 0 {
+		t.Errorf("Over = %v for a place within the budget, want none", over)
+	}
+	if over := (Policy{}).Over(keep); over != nil {
+		t.Errorf("Over = %v without a budget, want nil", over)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		ok     bool
+	}{
+		{"empty", Policy{}, true},
+		{"every rule", Policy{KeepLast: 1, KeepDaily: 7, KeepWeekly: 4, KeepMonthly: 12, KeepYearly: 3, KeepWithin: time.Hour, MaxTotalSize: 1 << 30, KeepTagged: []string{"release-*"}}, true},
+		{"negative count", Policy{KeepWeekly: -1}, false},
+		{"negative within", Policy{KeepWithin: -time.Hour}, false},
+		{"negative size", Policy{MaxTotalSize: -1}, false},
+		{"bad tag pattern", Policy{KeepTagged: []string{"release-["}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); (err == nil) != tt.ok {
+				t.Errorf("Validate() = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestWhere(t *testing.T) {
+	tests := []struct{ path, want string }{
+		{"/backups/app.sql.gz", "/backups"},
+		{"s3://bucket/prefix/app.sql.gz", "s3://bucket/prefix"},
+		{"sftp://backup@host/srv/app.sql.gz", "sftp://backup@host/srv"},
+	}
+	for _, tt := range tests {
+		if got := Where(tt.path); got != tt.want {
+			t.Errorf("Where(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Package runlog keeps the log of every backup run, keyed by its run ID, so
+// a post-mortem can read what a run printed long after it scrolled by.
+// Each log is a file of JSON lines: everything the run wrote to standard
+// output and standard error, and the progress events of the backup.
+package runlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDir is where run logs are kept unless overridden
+const DefaultDir = "./backups/logs"
+
+// Streams recorded in Record.Stream
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+	// StreamEvent records a progress event, or the start or end of the run
+	StreamEvent = "event"
+)
+
+// Record is one line of a run log
+type Record struct {
+	Time    time.Time `json:"time"`
+	Stream  string    `json:"stream"`
+	Message string    `json:"message,omitempty"`
+	Phase   string    `json:"phase,omitempty"`
+	Table   string    `json:"table,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Dir is a directory of run logs
+type Dir struct {
+	path string
+}
+
+// Open returns the log directory at path. It is created on first use.
+func Open(path string) *Dir {
+	return &Dir{path: path}
+}
+
+func (d *Dir) logPath(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return "", fmt.Errorf("invalid run ID %q", id)
+	}
+	return filepath.Join(d.path, id+".jsonl"), nil
+}
+
+// Log is the log of a run in progress
+type Log struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+
+	// stdout and stderr are the streams Capture replaced
+	stdout, stderr *os.File
+	pipes          []*os.File
+	copying        sync.WaitGroup
+}
+
+// Create starts the log of the run with id
+func (d *Dir) Create(id string) (*Log, error) {
+	path, err := d.logPath(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(d.path, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create run log: %w", err)
+	}
+	l := &Log{file: f, enc: json.NewEncoder(f)}
+	l.Record(Record{Stream: StreamEvent, Message: "run started"})
+	return l, nil
+}
+
+// Record appends r to the log, stamped with the current time if it has none
+func (l *Log) Record(r Record) {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enc.Encode(r)
+}
+
+// Capture copies everything written to os.Stdout and os.Stderr into the log
+// as well, line by line, until Close
+func (l *Log) Capture() error {
+	l.stdout, l.stderr = os.Stdout, os.Stderr
+	for _, stream := range []struct {
+		name string
+		dst  **os.File
+	}{{StreamStdout, &os.Stdout}, {StreamStderr, &os.Stderr}} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			l.restore()
+			return fmt.Errorf("failed to capture %s: %w", stream.name, err)
+		}
+		original := *stream.dst
+		*stream.dst = w
+		l.pipes = append(l.pipes, w)
+		l.copying.Add(1)
+		go l.copyLines(stream.name, r, original)
+	}
+	return nil
+}
+
+// copyLines passes what is read from r on to original and logs each line
+func (l *Log) copyLines(stream string, r *os.File, original io.Writer) {
+	defer l.copying.Done()
+	defer r.Close()
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			io.WriteString(original, line)
+			l.Record(Record{Stream: stream, Message: strings.TrimSuffix(line, "\n")})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// restore puts back the streams Capture replaced
+func (l *Log) restore() {
+	if l.stdout != nil {
+		os.Stdout, os.Stderr = l.stdout, l.stderr
+	}
+	for _, w := range l.pipes {
+		w.Close()
+	}
+	l.pipes = nil
+	l.copying.Wait()
+}
+
+// Close stops capturing and finishes the log with how the run ended
+func (l *Log) Close(runErr error) error {
+	l.restore()
+	end := Record{Stream: StreamEvent, Message: "run finished"}
+	if runErr != nil {
+		end.Message, end.Error = "run failed", runErr.Error()
+	}
+	l.Record(end)
+	return l.file.Close()
+}
+
+// Summary describes a stored run log
+type Summary struct {
+	ID        string
+	StartedAt time.Time
+	Size      int64
+}
+
+// List returns every stored run log, oldest first
+func (d *Dir) List() ([]Summary, error) {
+	matches, err := filepath.Glob(filepath.Join(d.path, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	var logs []Summary
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		s := Summary{ID: strings.TrimSuffix(filepath.Base(path), ".jsonl"), Size: info.Size(), StartedAt: info.ModTime()}
+		if f, err := os.Open(path); err == nil {
+			var first Record
+			if json.NewDecoder(f).Decode(&first) == nil {
+				s.StartedAt = first.Time
+			}
+			f.Close()
+		}
+		logs = append(logs, s)
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].StartedAt.Before(logs[j].StartedAt) })
+	return logs, nil
+}
+
+// Resolve returns the ID of the one stored run log whose ID is or starts
+// with prefix
+func (d *Dir) Resolve(prefix string) (string, error) {
+	if path, err := d.logPath(prefix); err != nil {
+		return "", err
+	} else if _, err := os.Stat(path); err == nil {
+		return prefix, nil
+	}
+	logs, err := d.List()
+	if err != nil {
+		return "", err
+	}
+	var found []string
+	for _, s := range logs {
+		if strings.HasPrefix(s.ID, prefix) {
+			found = append(found, s.ID)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("no log for run %q in %s", prefix, d.path)
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("run ID prefix %q is ambiguous (%d logs match)", prefix, len(found))
+}
+
+// Read returns the records of the run log with id
+func (d *Dir) Read(id string) ([]Record, error) {
+	path, err := d.logPath(id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no log for run %q in %s", id, d.path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open run log: %w", err)
+	}
+	defer f.Close()
+
+	var records []Record
+	dec := json.NewDecoder(f)
+	for {
+		var r Record
+		// Past the end, or at the torn last line of a run killed mid-write
+		if err := dec.Decode(&r); err != nil {
+			return records, nil
+		}
+		records = append(records, r)
+	}
+}
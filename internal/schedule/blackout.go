@@ -0,0 +1,92 @@
+package schedule
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// BlackoutEnvVar holds semicolon-separated blackout windows that apply to every command
+const BlackoutEnvVar = "BACKITUP_BLACKOUT"
+
+// Window is a recurring period during which scheduled work must not run.
+// It starts at every minute matched by Start and lasts Duration.
+type Window struct {
+	Start    *Cron
+	Duration time.Duration
+}
+
+// ParseWindow parses a cron expression followed by a duration, for example
+// "0 1 * * sun 4h" (Sundays from 01:00 to 05:00)
+func ParseWindow(spec string) (Window, error) {
+	spec = strings.TrimSpace(spec)
+	i := strings.LastIndexAny(spec, " \t")
+	if i < 0 {
+		return Window{}, fmt.Errorf("invalid blackout window %q: expected \"<cron> <duration>\"", spec)
+	}
+
+	d, err := time.ParseDuration(spec[i+1:])
+	if err != nil || d <= 0 {
+		return Window{}, fmt.Errorf("invalid blackout window %q: bad duration %q", spec, spec[i+1:])
+	}
+	start, err := ParseCron(spec[:i])
+	if err != nil {
+		return Window{}, fmt.Errorf("invalid blackout window %q: %w", spec, err)
+	}
+
+	return Window{Start: start, Duration: d}, nil
+}
+
+// String formats the window the way ParseWindow accepts it
+func (w Window) String() string {
+	return fmt.Sprintf("%s %s", w.Start, w.Duration)
+}
+
+// ActiveAt reports whether t falls inside the window and, if so, when the
+// current occurrence ends
+func (w Window) ActiveAt(t time.Time) (bool, time.Time) {
+	t = t.Truncate(time.Minute)
+	start := w.Start.Prev(t, t.Add(-w.Duration))
+	if start.IsZero() {
+		return false, time.Time{}
+	}
+	return true, start.Add(w.Duration)
+}
+
+// Blackouts is a set of windows
+type Blackouts []Window
+
+// ParseBlackouts parses the windows from BACKITUP_BLACKOUT followed by specs
+func ParseBlackouts(specs []string) (Blackouts, error) {
+	var all []string
+	for _, s := range strings.Split(os.Getenv(BlackoutEnvVar), ";") {
+		if s = strings.TrimSpace(s); s != "" {
+			all = append(all, s)
+		}
+	}
+	all = append(all, specs...)
+
+	var windows Blackouts
+	for _, s := range all {
+		w, err := ParseWindow(s)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// ActiveAt returns the window covering t with the latest end, if any
+func (b Blackouts) ActiveAt(t time.Time) (Window, time.Time, bool) {
+	var found Window
+	var until time.Time
+	ok := false
+	for _, w := range b {
+		if active, end := w.ActiveAt(t); active && end.After(until) {
+			found, until, ok = w, end, true
+		}
+	}
+	return found, until, ok
+}
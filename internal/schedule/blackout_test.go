@@ -0,0 +1,88 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowActiveAt(t *testing.T) {
+	at := func(s string) time.Time {
+		ts, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	tests := []struct {
+		window string
+		at     string
+		active bool
+		until  string
+	}{
+		{"0 1 * * sun 4h", "2025-01-05 00:59", false, ""},
+		{"0 1 * * sun 4h", "2025-01-05 01:00", true, "2025-01-05 05:00"},
+		{"0 1 * * sun 4h", "2025-01-05 04:59", true, "2025-01-05 05:00"},
+		{"0 1 * * sun 4h", "2025-01-05 05:00", false, ""},
+		{"0 1 * * sun 4h", "2025-01-06 02:00", false, ""},
+		{"0 23 * * * 2h", "2025-01-06 00:30", true, "2025-01-06 01:00"},
+		{"0 23 31 12 * 48h", "2026-01-01 12:00", true, "2026-01-02 23:00"},
+		{"*/15 * * * * 5m", "2025-01-05 10:36", false, ""},
+		{"*/15 * * * * 5m", "2025-01-05 10:47", true, "2025-01-05 10:50"},
+		// Overlapping occurrences: the latest start decides the end
+		{"* * * * * 10m", "2025-01-05 10:00", true, "2025-01-05 10:10"},
+		// A yearly window looked up late in its year
+		{"@yearly 8760h", "2025-12-30 23:59", true, "2026-01-01 00:00"},
+		{"0 0 1 jan * 24h", "2025-07-01 00:00", false, ""},
+		{"0 0 29 feb * 24h", "2025-03-01 00:00", false, ""},
+		{"0 0 29 feb * 24h", "2024-02-29 10:00", true, "2024-03-01 00:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.window+" at "+tt.at, func(t *testing.T) {
+			w, err := ParseWindow(tt.window)
+			if err != nil {
+				t.Fatal(err)
+			}
+			active, until := w.ActiveAt(at(tt.at))
+			if active != tt.active {
+				t.Fatalf("ActiveAt(%s) active = %v, want %v", tt.at, active, tt.active)
+			}
+			if tt.active && !until.Equal(at(tt.until)) {
+				t.Errorf("ActiveAt(%s) until = %s, want %s", tt.at, until, tt.until)
+			}
+		})
+	}
+}
+
+// TestWindowActiveAtMatchesScan checks ActiveAt against scanning back
+// minute by minute for a match
+func TestWindowActiveAtMatchesScan(t *testing.T) {
+	windows := []string{"0 1 * * sun 4h", "30 */6 * * * 90m", "0 0 1,15 * * 36h", "0 9 * * mon-fri 8h", "0 0 1 * 5 30h"}
+	start := time.Date(2025, 2, 25, 0, 0, 0, 0, time.UTC)
+	for _, spec := range windows {
+		w, err := ParseWindow(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for ts := start; ts.Before(start.AddDate(0, 0, 14)); ts = ts.Add(17 * time.Minute) {
+			wantActive, wantUntil := false, time.Time{}
+			for s := ts; ts.Sub(s) < w.Duration; s = s.Add(-time.Minute) {
+				if w.Start.Matches(s) {
+					wantActive, wantUntil = true, s.Add(w.Duration)
+					break
+				}
+			}
+			active, until := w.ActiveAt(ts)
+			if active != wantActive || !until.Equal(wantUntil) {
+				t.Fatalf("%q ActiveAt(%s) = %v, %s; want %v, %s", spec, ts, active, until, wantActive, wantUntil)
+			}
+		}
+	}
+}
+
+func TestParseWindowErrors(t *testing.T) {
+	for _, spec := range []string{"", "4h", "0 1 * * sun", "0 1 * * sun -4h", "0 1 * * sun 0s", "0 25 * * * 1h"} {
+		if _, err := ParseWindow(spec); err == nil {
+			t.Errorf("ParseWindow(%q) succeeded, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"", "expected 5 fields, got 0"},
+		{"* * * *", "expected 5 fields, got 4"},
+		{"* * * * * *", "expected 5 fields, got 6"},
+		{"60 * * * *", "invalid cron minute"},
+		{"* 24 * * *", "invalid cron hour"},
+		{"* * 0 * *", "invalid cron day of month"},
+		{"* * 32 * *", "invalid cron day of month"},
+		{"* * * 13 * ", "invalid cron month"},
+		{"* * * foo *", "invalid cron month"},
+		{"* * * * 8", "invalid cron day of week"},
+		{"*/0 * * * *", "bad step"},
+		{"*/x * * * *", "bad step"},
+		{"5-1 * * * *", "value out of range"},
+		{"1,,2 * * * *", "bad value"},
+		{"@sometimes", "expected 5 fields"},
+	}
+	for _, tt := range tests {
+		_, err := ParseCron(tt.expr)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseCron(%q) error = %v, want %q", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestCronMatches(t *testing.T) {
+	// 2025-01-06 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		expr string
+		at   time.Time
+		want bool
+	}{
+		{"* * * * *", at(6, 13, 37), true},
+		{"30 2 * * *", at(6, 2, 30), true},
+		{"30 2 * * *", at(6, 2, 31), false},
+		{"*/15 * * * *", at(6, 9, 45), true},
+		{"*/15 * * * *", at(6, 9, 50), false},
+		{"5/20 * * * *", at(6, 9, 25), true},
+		{"0 9-17 * * *", at(6, 17, 0), true},
+		{"0 9-17 * * *", at(6, 18, 0), false},
+		{"0 0 1,15 * *", at(15, 0, 0), true},
+		{"0 0 * * mon-fri", at(6, 0, 0), true},
+		{"0 0 * * mon-fri", at(5, 0, 0), false},
+		{"0 0 * * sun", at(5, 0, 0), true},
+		{"0 0 * * 7", at(5, 0, 0), true},
+		{"0 0 * jan *", at(6, 0, 0), true},
+		{"0 0 * FEB *", at(6, 0, 0), false},
+		// Both day fields restricted: either may match
+		{"0 0 13 * mon", at(6, 0, 0), true},
+		{"0 0 13 * mon", at(13, 0, 0), true},
+		{"0 0 13 * mon", at(14, 0, 0), false},
+		// A stepped day field counts as unrestricted
+		{"0 0 */2 * mon", at(7, 0, 0), false},
+		{"0 0 */2 * mon", at(13, 0, 0), true},
+		{"@daily", at(6, 0, 0), true},
+		{"@hourly", at(6, 7, 0), true},
+		{"@weekly", at(5, 0, 0), true},
+		{"@monthly", at(1, 0, 0), true},
+		{"@YEARLY", at(1, 0, 0), true},
+		{"@yearly", at(2, 0, 0), false},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+		}
+		if got := c.Matches(tt.at); got != tt.want {
+			t.Errorf("%q.Matches(%s) = %v, want %v", tt.expr, tt.at.Format("Mon 2006-01-02 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestCronNextAndPrev(t *testing.T) {
+	from := time.Date(2025, 1, 6, 10, 30, 20, 0, time.UTC)
+	tests := []struct {
+		expr string
+		next string
+		prev string
+	}{
+		{"* * * * *", "2025-01-06 10:31", "2025-01-06 10:30"},
+		{"0 * * * *", "2025-01-06 11:00", "2025-01-06 10:00"},
+		{"30 10 * * *", "2025-01-07 10:30", "2025-01-06 10:30"},
+		{"0 0 1 * *", "2025-02-01 00:00", "2025-01-01 00:00"},
+		{"0 0 * * fri", "2025-01-10 00:00", "2025-01-03 00:00"},
+		{"0 12 31 * *", "2025-01-31 12:00", "2024-12-31 12:00"},
+		{"0 0 29 2 *", "2028-02-29 00:00", "2024-02-29 00:00"},
+		{"@yearly", "2026-01-01 00:00", "2025-01-01 00:00"},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+		}
+		if got := c.Next(from).Format("2006-01-02 15:04"); got != tt.next {
+			t.Errorf("%q.Next = %s, want %s", tt.expr, got, tt.next)
+		}
+		if got := c.Prev(from, from.AddDate(-5, 0, 0)).Format("2006-01-02 15:04"); got != tt.prev {
+			t.Errorf("%q.Prev = %s, want %s", tt.expr, got, tt.prev)
+		}
+	}
+}
+
+func TestCronNeverMatches(t *testing.T) {
+	c, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	if next := c.Next(from); !next.IsZero() {
+		t.Errorf("Next = %s, want the zero time", next)
+	}
+	if prev := c.Prev(from, from.AddDate(-5, 0, 0)); !prev.IsZero() {
+		t.Errorf("Prev = %s, want the zero time", prev)
+	}
+}
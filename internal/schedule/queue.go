@@ -0,0 +1,85 @@
+package schedule
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Task is a unit of scheduled work competing for limited concurrency
+type Task struct {
+	Name string
+	// Priority breaks ties between tasks with the same deadline; higher runs first
+	Priority int
+	// RPO is the recovery point objective: the longest the task's data may go
+	// without a successful run
+	RPO time.Duration
+	// LastSuccess is when the task last completed; zero if it never has
+	LastSuccess time.Time
+}
+
+// Deadline is the time by which the task must run to stay within its RPO.
+// Tasks without an RPO have no deadline and sort after every task that does.
+// Tasks that never succeeded are due immediately.
+func (t Task) Deadline() time.Time {
+	if t.RPO <= 0 {
+		return time.Time{}
+	}
+	if t.LastSuccess.IsZero() {
+		return time.Unix(0, 0)
+	}
+	return t.LastSuccess.Add(t.RPO)
+}
+
+// Queue orders tasks by earliest deadline, then by priority, then by name, so
+// critical databases run first when a backlog builds up
+type Queue struct {
+	h taskHeap
+}
+
+// Push adds a task to the queue
+func (q *Queue) Push(t Task) {
+	heap.Push(&q.h, t)
+}
+
+// Pop removes and returns the most urgent task
+func (q *Queue) Pop() (Task, bool) {
+	if q.h.Len() == 0 {
+		return Task{}, false
+	}
+	return heap.Pop(&q.h).(Task), true
+}
+
+// Len returns the number of queued tasks
+func (q *Queue) Len() int {
+	return q.h.Len()
+}
+
+type taskHeap []Task
+
+func (h taskHeap) Len() int { return len(h) }
+
+func (h taskHeap) Less(i, j int) bool {
+	di, dj := h[i].Deadline(), h[j].Deadline()
+	switch {
+	case di.IsZero() != dj.IsZero():
+		return !di.IsZero()
+	case !di.Equal(dj):
+		return di.Before(dj)
+	case h[i].Priority != h[j].Priority:
+		return h[i].Priority > h[j].Priority
+	default:
+		return h[i].Name < h[j].Name
+	}
+}
+
+func (h taskHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *taskHeap) Push(x any) { *h = append(*h, x.(Task)) }
+
+func (h *taskHeap) Pop() any {
+	old := *h
+	n := len(old)
+	t := old[n-1]
+	*h = old[:n-1]
+	return t
+}
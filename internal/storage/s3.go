@@ -0,0 +1,528 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/fault"
+)
+
+// Environment variables S3 is configured from, as the AWS CLI reads them
+const (
+	accessKeyEnvVar    = "AWS_ACCESS_KEY_ID"
+	secretKeyEnvVar    = "AWS_SECRET_ACCESS_KEY"
+	sessionTokenEnvVar = "AWS_SESSION_TOKEN"
+	regionEnvVar       = "AWS_REGION"
+	defaultRegionEnv   = "AWS_DEFAULT_REGION"
+	// The endpoint of an S3-compatible server such as MinIO; buckets on it
+	// are addressed by path
+	endpointS3EnvVar = "AWS_ENDPOINT_URL_S3"
+	endpointEnvVar   = "AWS_ENDPOINT_URL"
+)
+
+const (
+	// minPartSize is the size of the first parts of a multipart upload. It
+	// doubles every partsPerSize parts, so a dump of unknown size never hits
+	// S3's limit of maxParts parts.
+	minPartSize  = 16 << 20
+	partsPerSize = 1000
+	maxParts     = 10000
+	// partsInFlight is how many parts are uploaded at once while the next
+	// one fills, to begin with; partLimiter adjusts it as the upload goes
+	partsInFlight = 4
+)
+
+// emptyPayloadHash is the SHA-256 of an empty request body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3 stores objects in an S3 bucket, or in one on an S3-compatible server
+type S3 struct {
+	bucket string
+	region string
+	// endpoint is set for S3-compatible servers; nil means AWS
+	endpoint *url.URL
+	creds    s3Credentials
+	// role, when set, supplies the credentials in place of creds
+	role *assumedRole
+	http *http.Client
+	now  func() time.Time
+}
+
+type s3Credentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// NewS3 returns a store for bucket, with credentials, region, and endpoint
+// taken from the AWS_* environment variables. With $AWS_ROLE_ARN set, it
+// works as that role, which those credentials or a web identity token
+// assume.
+func NewS3(bucket string) (*S3, error) {
+	creds := s3Credentials{
+		accessKey:    os.Getenv(accessKeyEnvVar),
+		secretKey:    os.Getenv(secretKeyEnvVar),
+		sessionToken: os.Getenv(sessionTokenEnvVar),
+	}
+	region := os.Getenv(regionEnvVar)
+	if region == "" {
+		region = os.Getenv(defaultRegionEnv)
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	s := &S3{bucket: bucket, region: region, creds: creds, http: &http.Client{}, now: time.Now}
+	role, err := newAssumedRole(creds, region, s.http, s.now)
+	if err != nil {
+		return nil, err
+	}
+	s.role = role
+	if role == nil && (creds.accessKey == "" || creds.secretKey == "") {
+		return nil, fmt.Errorf("S3 needs credentials; set $%s and $%s", accessKeyEnvVar, secretKeyEnvVar)
+	}
+	endpoint := os.Getenv(endpointS3EnvVar)
+	if endpoint == "" {
+		endpoint = os.Getenv(endpointEnvVar)
+	}
+	if endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+		}
+		s.endpoint = u
+	}
+	return s, nil
+}
+
+// Location returns the s3:// URL of key
+func (s *S3) Location(key string) string {
+	return "s3://" + s.bucket + "/" + key
+}
+
+// Put uploads everything read from r as key: in one request if it fits in
+// a part, otherwise as a multipart upload that is aborted if r fails
+func (s *S3) Put(key string, r io.Reader) error {
+	partSize := minPartSize
+	first, last, err := readPart(r, partSize)
+	if err != nil {
+		return err
+	}
+	if last {
+		return s.putObject(key, first)
+	}
+
+	uploadID, err := s.createMultipartUpload(key)
+	if err != nil {
+		return err
+	}
+	parts, err := s.uploadParts(key, uploadID, r, first, partSize)
+	if err == nil {
+		err = s.completeMultipartUpload(key, uploadID, parts)
+	}
+	if err != nil {
+		s.abortMultipartUpload(key, uploadID)
+		return err
+	}
+	return nil
+}
+
+// readPart reads up to size bytes of r, reporting whether r ended
+func readPart(r io.Reader, size int) ([]byte, bool, error) {
+	buf := make([]byte, size)
+	n, err := io.ReadFull(r, buf)
+	switch err {
+	case nil:
+		return buf, false, nil
+	case io.EOF, io.ErrUnexpectedEOF:
+		return buf[:n], true, nil
+	}
+	return nil, false, err
+}
+
+// uploadParts uploads first and the rest of r as the parts of uploadID,
+// several at a time, and returns them in order. A throttled part is retried
+// after a backoff, and fewer parts are sent at once from then on.
+func (s *S3) uploadParts(key, uploadID string, r io.Reader, first []byte, partSize int) ([]completedPart, error) {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		parts    []completedPart
+		firstErr error
+	)
+	limiter := newPartLimiter(partsInFlight)
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	part, last := first, false
+	for number := 1; ; number++ {
+		if number > maxParts {
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = fmt.Errorf("upload of %s exceeds %d parts", s.Location(key), maxParts)
+			}
+			mu.Unlock()
+			break
+		}
+		generation := limiter.acquire()
+		if failed() {
+			limiter.release(generation, 0, false)
+			break
+		}
+		mu.Lock()
+		parts = append(parts, completedPart{})
+		mu.Unlock()
+		wg.Add(1)
+		go func(number int, part []byte, generation int) {
+			defer wg.Done()
+			var completed completedPart
+			var err error
+			for attempt := 1; ; attempt++ {
+				completed, err = s.uploadPart(key, uploadID, number, part)
+				throttled := errors.Is(err, errThrottled)
+				sent := int64(0)
+				if err == nil {
+					sent = int64(len(part))
+				}
+				limiter.release(generation, sent, throttled)
+				if !throttled || attempt == maxPartAttempts || failed() {
+					break
+				}
+				time.Sleep(backoff(attempt))
+				generation = limiter.acquire()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			parts[number-1] = completed
+		}(number, part, generation)
+
+		if last {
+			break
+		}
+		if number%partsPerSize == 0 {
+			partSize *= 2
+		}
+		var err error
+		if part, last, err = readPart(r, partSize); err != nil {
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
+			break
+		}
+		// A dump that ends on a part boundary leaves nothing for a last part
+		if last && len(part) == 0 {
+			break
+		}
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return parts, nil
+}
+
+func (s *S3) putObject(key string, body []byte) error {
+	if err := fault.Inject(fault.StageUpload); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", s.Location(key), err)
+	}
+	resp, err := s.do(http.MethodPut, key, nil, nil, body)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", s.Location(key), err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) createMultipartUpload(key string) (string, error) {
+	// Each part then carries its SHA-256 too, and S3 keeps them all
+	header := http.Header{"x-amz-checksum-algorithm": {"SHA256"}}
+	resp, err := s.do(http.MethodPost, key, url.Values{"uploads": {""}}, header, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to start upload of %s: %w", s.Location(key), err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil || result.UploadID == "" {
+		return "", fmt.Errorf("failed to start upload of %s: no upload ID in the response", s.Location(key))
+	}
+	return result.UploadID, nil
+}
+
+func (s *S3) uploadPart(key, uploadID string, number int, body []byte) (completedPart, error) {
+	if err := fault.Inject(fault.StageUpload); err != nil {
+		return completedPart{}, fmt.Errorf("failed to upload part %d of %s: %w", number, s.Location(key), err)
+	}
+	query := url.Values{"partNumber": {fmt.Sprint(number)}, "uploadId": {uploadID}}
+	resp, err := s.do(http.MethodPut, key, query, nil, body)
+	if err != nil {
+		return completedPart{}, fmt.Errorf("failed to upload part %d of %s: %w", number, s.Location(key), err)
+	}
+	resp.Body.Close()
+	return completedPart{PartNumber: number, ETag: resp.Header.Get("ETag"), ChecksumSHA256: checksumSHA256(body)}, nil
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+type completedPart struct {
+	PartNumber     int    `xml:"PartNumber"`
+	ETag           string `xml:"ETag"`
+	ChecksumSHA256 string `xml:"ChecksumSHA256"`
+}
+
+func (s *S3) completeMultipartUpload(key, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(completeMultipartUpload{Parts: parts})
+	if err != nil {
+		return fmt.Errorf("failed to encode upload completion: %w", err)
+	}
+	resp, err := s.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, body)
+	if err != nil {
+		return fmt.Errorf("failed to complete upload of %s: %w", s.Location(key), err)
+	}
+	defer resp.Body.Close()
+	// A completion can fail after the 200 status has been sent
+	data, _ := io.ReadAll(resp.Body)
+	if err := parseError(data); err != nil {
+		return fmt.Errorf("failed to complete upload of %s: %w", s.Location(key), err)
+	}
+	return nil
+}
+
+func (s *S3) abortMultipartUpload(key, uploadID string) {
+	if resp, err := s.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// Get streams the object stored as key. If S3 kept its SHA-256, the
+// stream is checked against it, and reading fails on a mismatch.
+func (s *S3) Get(key string) (io.ReadCloser, error) {
+	header := http.Header{"x-amz-checksum-mode": {"ENABLED"}}
+	resp, err := s.do(http.MethodGet, key, nil, header, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", s.Location(key), err)
+	}
+	return s.verifyChecksum(key, resp)
+}
+
+// Delete removes the object stored as key
+func (s *S3) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", s.Location(key), err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a signed request for key, with header added, and fails on an
+// error status
+func (s *S3) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := s.objectURL(key)
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	// S3 checks an object or part against its SHA-256 before storing it,
+	// and keeps it for downloads to be checked against
+	if method == http.MethodPut && len(body) > 0 {
+		req.Header.Set("x-amz-checksum-sha256", checksumSHA256(body))
+	}
+	// Go drops the body of a GET or DELETE with no content, which is what
+	// was signed
+	req.ContentLength = int64(len(body))
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	creds := s.creds
+	if s.role != nil {
+		if creds, err = s.role.credentials(); err != nil {
+			return nil, err
+		}
+	}
+	signV4(req, payloadHash, creds, s.region, "s3", s.now())
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	// S3 sends SlowDown as a 503
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if err := parseError(data); err != nil {
+			return nil, fmt.Errorf("%w: %v", errThrottled, err)
+		}
+		return nil, fmt.Errorf("%w: %s", errThrottled, resp.Status)
+	}
+	if err := parseError(data); err != nil {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %v", fs.ErrNotExist, err)
+		}
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", fs.ErrNotExist, resp.Status)
+	}
+	return nil, fmt.Errorf("unexpected response: %s", resp.Status)
+}
+
+// parseError returns the error an S3 response body describes, if it is one
+func parseError(data []byte) error {
+	var e struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(data, &e) != nil || e.XMLName.Local != "Error" {
+		return nil
+	}
+	return fmt.Errorf("%s: %s", e.Code, e.Message)
+}
+
+// objectURL addresses key in the bucket: by virtual host on AWS, and by
+// path on other servers and for bucket names TLS can't cover as a host
+func (s *S3) objectURL(key string) *url.URL {
+	escaped := "/" + uriEncode(key, false)
+	if s.endpoint != nil {
+		u := *s.endpoint
+		base := strings.TrimSuffix(u.Path, "/")
+		u.Path = base + "/" + s.bucket + "/" + key
+		u.RawPath = uriEncode(base, false) + "/" + uriEncode(s.bucket, false) + escaped
+		return &u
+	}
+	host := s.bucket + ".s3." + s.region + ".amazonaws.com"
+	path, rawPath := "/"+key, escaped
+	if strings.Contains(s.bucket, ".") {
+		host = "s3." + s.region + ".amazonaws.com"
+		path, rawPath = "/"+s.bucket+path, "/"+uriEncode(s.bucket, false)+rawPath
+	}
+	return &url.URL{Scheme: "https", Host: host, Path: path, RawPath: rawPath}
+}
+
+// signV4 adds AWS Signature Version 4 headers to req, whose body hashes to
+// payloadHash, signing it with creds for service in region
+func signV4(req *http.Request, payloadHash string, creds s3Credentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if creds.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", creds.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query sorted by key, as signing requires
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but unreserved characters, and
+// slashes unless encodeSlash is set
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
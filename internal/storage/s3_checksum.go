@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// checksumSHA256 is the SHA-256 of data as S3's checksum headers carry it
+func checksumSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// objectPart is a stretch of an object with a checksum of its own: a part
+// of a multipart upload, or, with size -1, the whole object
+type objectPart struct {
+	size     int64
+	checksum string
+}
+
+// verifyChecksum returns the body of resp, a download of key, checked
+// against the SHA-256 S3 kept for it. An object uploaded in parts has a
+// checksum of its parts' checksums, so each part is checked on its own as
+// it arrives. Objects stored without a checksum are returned unchecked.
+func (s *S3) verifyChecksum(key string, resp *http.Response) (io.ReadCloser, error) {
+	checksum := resp.Header.Get("x-amz-checksum-sha256")
+	if checksum == "" {
+		return resp.Body, nil
+	}
+	r := &checksumReader{ReadCloser: resp.Body, location: s.Location(key), hash: sha256.New()}
+	composite, count, ok := strings.Cut(checksum, "-")
+	if !ok {
+		r.parts = []objectPart{{size: -1, checksum: checksum}}
+		return r, nil
+	}
+
+	parts, err := s.objectParts(key)
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download %s: %w", s.Location(key), err)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n != len(parts) {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download %s: its checksum covers %s part(s), but S3 lists %d", s.Location(key), count, len(parts))
+	}
+	// Parts stored without checksums, by a server that keeps only the
+	// object's, can't be checked
+	combined := sha256.New()
+	for _, p := range parts {
+		sum, err := base64.StdEncoding.DecodeString(p.checksum)
+		if err != nil || p.checksum == "" {
+			return resp.Body, nil
+		}
+		combined.Write(sum)
+	}
+	if actual := base64.StdEncoding.EncodeToString(combined.Sum(nil)); actual != composite {
+		resp.Body.Close()
+		return nil, fmt.Errorf("checksum mismatch for %s: S3 has %s, its parts' checksums combine to %s", s.Location(key), checksum, actual)
+	}
+	r.parts = parts
+	return r, nil
+}
+
+// objectParts lists the parts of the multipart object key, with their
+// sizes and checksums
+func (s *S3) objectParts(key string) ([]objectPart, error) {
+	var parts []objectPart
+	marker := 0
+	for {
+		header := http.Header{
+			"x-amz-object-attributes":  {"ObjectParts"},
+			"x-amz-max-parts":          {"1000"},
+			"x-amz-part-number-marker": {strconv.Itoa(marker)},
+		}
+		resp, err := s.do(http.MethodGet, key, url.Values{"attributes": {""}}, header, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list parts: %w", err)
+		}
+		var result struct {
+			ObjectParts struct {
+				IsTruncated          bool `xml:"IsTruncated"`
+				NextPartNumberMarker int  `xml:"NextPartNumberMarker"`
+				Parts                []struct {
+					Size           int64  `xml:"Size"`
+					ChecksumSHA256 string `xml:"ChecksumSHA256"`
+				} `xml:"Part"`
+			} `xml:"ObjectParts"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list parts: %w", err)
+		}
+		for _, p := range result.ObjectParts.Parts {
+			parts = append(parts, objectPart{size: p.Size, checksum: p.ChecksumSHA256})
+		}
+		if !result.ObjectParts.IsTruncated || result.ObjectParts.NextPartNumberMarker <= marker {
+			return parts, nil
+		}
+		marker = result.ObjectParts.NextPartNumberMarker
+	}
+}
+
+// checksumReader checks a download part by part against the checksums S3
+// kept, failing the read that completes a part that doesn't match
+type checksumReader struct {
+	io.ReadCloser
+	location string
+	parts    []objectPart
+	// part is the index of the part being read, and read how much of it
+	part int
+	read int64
+	hash hash.Hash
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	if r.part >= len(r.parts) {
+		// Anything past the last part isn't covered by the checksums
+		n, err := r.ReadCloser.Read(p)
+		if n > 0 {
+			return 0, fmt.Errorf("checksum mismatch for %s: the download is longer than its %d part(s)", r.location, len(r.parts))
+		}
+		return n, err
+	}
+	current := r.parts[r.part]
+	if current.size >= 0 && int64(len(p)) > current.size-r.read {
+		p = p[:current.size-r.read]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+	r.read += int64(n)
+
+	if current.size >= 0 && r.read == current.size {
+		if err := r.check(current); err != nil {
+			return n, err
+		}
+		r.part++
+		r.read = 0
+		r.hash.Reset()
+		if err == io.EOF && r.part < len(r.parts) {
+			return n, fmt.Errorf("checksum mismatch for %s: the download ended after part %d of %d", r.location, r.part, len(r.parts))
+		}
+		return n, err
+	}
+	if err == io.EOF {
+		if current.size < 0 {
+			if err := r.check(current); err != nil {
+				return n, err
+			}
+			r.part++
+			return n, io.EOF
+		}
+		return n, fmt.Errorf("checksum mismatch for %s: the download ended inside part %d of %d", r.location, r.part+1, len(r.parts))
+	}
+	return n, err
+}
+
+// check compares what was read of part to its checksum
+func (r *checksumReader) check(part objectPart) error {
+	actual := base64.StdEncoding.EncodeToString(r.hash.Sum(nil))
+	if actual == part.checksum {
+		return nil
+	}
+	if part.size < 0 {
+		return fmt.Errorf("checksum mismatch for %s: S3 has SHA-256 %s, download has %s; the object is corrupted", r.location, part.checksum, actual)
+	}
+	return fmt.Errorf("checksum mismatch for %s: S3 has SHA-256 %s for part %d of %d, download has %s; the object is corrupted",
+		r.location, part.checksum, r.part+1, len(r.parts), actual)
+}
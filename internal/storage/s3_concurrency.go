@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+const (
+	// maxPartsInFlight bounds how far a fast link grows the parts uploaded at
+	// once, and so the memory they hold
+	maxPartsInFlight = 8
+	// maxPartAttempts is how many times a throttled part is sent before the
+	// upload fails
+	maxPartAttempts = 5
+	// throttleBackoff is the wait before a throttled part's first retry; it
+	// doubles with each one
+	throttleBackoff = 250 * time.Millisecond
+	// growthMargin is how much faster a round of parts has to go than the
+	// one before it for another part to be added
+	growthMargin = 1.05
+)
+
+// errThrottled marks a response asking the client to slow down: 429, 503,
+// or a SlowDown error
+var errThrottled = errors.New("throttled")
+
+// partLimiter sets how many parts are uploaded at once, additive increase,
+// multiplicative decrease: the limit halves when S3 throttles a part and
+// grows by one after a round of as many parts as the limit went faster than
+// the round before it
+type partLimiter struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	inFlight int
+	// generation changes with the limit, so a burst of throttled parts
+	// started under one limit halves it only once
+	generation int
+
+	// The current round: parts finished, bytes sent, and when it began
+	done       int
+	sent       int64
+	roundStart time.Time
+	// lastRate is the throughput of the previous round, in bytes a second
+	lastRate float64
+}
+
+func newPartLimiter(limit int) *partLimiter {
+	l := &partLimiter{limit: limit, roundStart: time.Now()}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire waits for a free slot and returns the generation it was taken in
+func (l *partLimiter) acquire() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.inFlight >= l.limit {
+		l.cond.Wait()
+	}
+	l.inFlight++
+	return l.generation
+}
+
+// release frees a slot taken in generation after a part of size bytes was
+// sent, or throttled
+func (l *partLimiter) release(generation int, size int64, throttled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer l.cond.Broadcast()
+	l.inFlight--
+
+	if throttled {
+		if generation == l.generation {
+			l.setLimit(max(1, l.limit/2))
+			l.lastRate = 0
+		}
+		return
+	}
+	l.done++
+	l.sent += size
+	if l.done < l.limit {
+		return
+	}
+	rate := float64(l.sent) / time.Since(l.roundStart).Seconds()
+	grow := rate > l.lastRate*growthMargin && l.limit < maxPartsInFlight
+	l.lastRate = rate
+	if grow {
+		l.setLimit(l.limit + 1)
+	} else {
+		l.done, l.sent, l.roundStart = 0, 0, time.Now()
+	}
+}
+
+func (l *partLimiter) setLimit(limit int) {
+	l.limit = limit
+	l.generation++
+	l.done, l.sent, l.roundStart = 0, 0, time.Now()
+}
+
+// backoff returns the wait before retrying a part throttled attempt times,
+// jittered so parts throttled together don't retry together
+func backoff(attempt int) time.Duration {
+	d := throttleBackoff << (attempt - 1)
+	return d/2 + rand.N(d/2+1)
+}
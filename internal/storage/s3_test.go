@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is enough of S3's multipart API for Put. throttle says whether to
+// refuse an attempt at a part with 503 SlowDown.
+type fakeS3 struct {
+	throttle func(part, attempt int) bool
+
+	mu        sync.Mutex
+	parts     map[int][]byte
+	attempts  map[int]int
+	completed []completedPart
+	objects   map[string][]byte
+}
+
+func newFakeS3(t *testing.T, throttle func(part, attempt int) bool) (*fakeS3, *S3) {
+	f := &fakeS3{throttle: throttle, parts: map[int][]byte{}, attempts: map[int]int{}, objects: map[string][]byte{}}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(srv.Close)
+	endpoint, _ := url.Parse(srv.URL)
+	s := &S3{bucket: "bucket", region: "us-east-1", endpoint: endpoint,
+		creds: s3Credentials{accessKey: "AKID", secretKey: "secret"}, http: srv.Client(), now: time.Now}
+	return f, s
+}
+
+func (f *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	q := r.URL.Query()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		io.WriteString(w, "<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>")
+	case r.Method == http.MethodPut && q.Has("partNumber"):
+		number, _ := strconv.Atoi(q.Get("partNumber"))
+		f.attempts[number]++
+		if f.throttle != nil && f.throttle(number, f.attempts[number]) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, "<Error><Code>SlowDown</Code><Message>Please reduce your request rate.</Message></Error>")
+			return
+		}
+		f.parts[number] = body
+		w.Header().Set("ETag", `"etag-`+strconv.Itoa(number)+`"`)
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		var done completeMultipartUpload
+		xml.Unmarshal(body, &done)
+		f.completed = done.Parts
+		io.WriteString(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodPut:
+		f.objects[r.URL.Path] = body
+	case r.Method == http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestPutMultipart(t *testing.T) {
+	f, s := newFakeS3(t, nil)
+	data := bytes.Repeat([]byte("0123456789abcdef"), (3*minPartSize+1024)/16)
+	if err := s.Put("backups/app.sql.gz", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.completed) != 4 {
+		t.Fatalf("completed %d parts, want 4", len(f.completed))
+	}
+	var joined []byte
+	for i, p := range f.completed {
+		if p.PartNumber != i+1 || p.ETag != `"etag-`+strconv.Itoa(i+1)+`"` {
+			t.Errorf("part %d completed as %+v", i+1, p)
+		}
+		if p.ChecksumSHA256 != checksumSHA256(f.parts[i+1]) {
+			t.Errorf("part %d has the wrong checksum", i+1)
+		}
+		joined = append(joined, f.parts[i+1]...)
+	}
+	if !bytes.Equal(joined, data) {
+		t.Error("parts don't add up to what was put")
+	}
+}
+
+func TestPutRetriesThrottledParts(t *testing.T) {
+	f, s := newFakeS3(t, func(part, attempt int) bool { return part == 2 && attempt < 3 })
+	data := bytes.Repeat([]byte{7}, 2*minPartSize+1)
+	if err := s.Put("backups/app.sql.gz", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if f.attempts[2] != 3 {
+		t.Errorf("part 2 was sent %d times, want 3", f.attempts[2])
+	}
+	if len(f.completed) != 3 {
+		t.Errorf("completed %d parts, want 3", len(f.completed))
+	}
+}
+
+func TestPutFailsWhenThrottledTooOften(t *testing.T) {
+	f, s := newFakeS3(t, func(part, attempt int) bool { return part == 1 })
+	data := bytes.Repeat([]byte{7}, minPartSize+1)
+	if err := s.Put("backups/app.sql.gz", bytes.NewReader(data)); err == nil {
+		t.Fatal("Put succeeded though every attempt at part 1 was throttled")
+	}
+	if f.attempts[1] != maxPartAttempts {
+		t.Errorf("part 1 was sent %d times, want %d", f.attempts[1], maxPartAttempts)
+	}
+	if f.completed != nil {
+		t.Error("a failed upload was completed")
+	}
+}
+
+func TestPutSmallObject(t *testing.T) {
+	f, s := newFakeS3(t, nil)
+	if err := s.Put("backups/app.sql.gz.sha256", bytes.NewReader([]byte("sum  app.sql.gz\n"))); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(f.objects["/bucket/backups/app.sql.gz.sha256"]); got != "sum  app.sql.gz\n" {
+		t.Errorf("stored %q", got)
+	}
+}
+
+func TestPartLimiter(t *testing.T) {
+	l := newPartLimiter(4)
+	// A throttled part halves the limit once per generation
+	g := l.acquire()
+	g2 := l.acquire()
+	l.release(g, 0, true)
+	l.release(g2, 0, true)
+	if l.limit != 2 {
+		t.Fatalf("limit after a burst of throttling = %d, want 2", l.limit)
+	}
+	for l.limit > 1 {
+		l.release(l.acquire(), 0, true)
+	}
+	l.release(l.acquire(), 0, true)
+	if l.limit != 1 {
+		t.Fatalf("limit fell to %d, want it to stay at 1", l.limit)
+	}
+}
@@ -0,0 +1,641 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/iostate/back-it-up/internal/fault"
+)
+
+// Environment variables SFTP is configured from
+const (
+	// sftpPasswordEnvVar is the password to log in with when the server
+	// doesn't accept any of the SSH keys
+	sftpPasswordEnvVar = "BACKITUP_SFTP_PASSWORD"
+	// sftpIdentityEnvVar is a private key file to log in with, on top of the
+	// ones ssh and its agent try by default
+	sftpIdentityEnvVar = "BACKITUP_SFTP_IDENTITY"
+	// askpassEnvVar marks a process started by ssh to read the password
+	askpassEnvVar = "BACKITUP_SSH_ASKPASS"
+)
+
+// SFTP packet types (draft-ietf-secsh-filexfer-02, version 3)
+const (
+	sftpInit     = 1
+	sftpVersion  = 2
+	sftpOpen     = 3
+	sftpClose    = 4
+	sftpRead     = 5
+	sftpWrite    = 6
+	sftpRemove   = 13
+	sftpMkdir    = 14
+	sftpRename   = 18
+	sftpStatus   = 101
+	sftpHandle   = 102
+	sftpData     = 103
+	sftpExtended = 200
+)
+
+// SFTP open flags and status codes
+const (
+	sftpFlagRead   = 0x01
+	sftpFlagWrite  = 0x02
+	sftpFlagCreate = 0x08
+	sftpFlagTrunc  = 0x10
+
+	sftpOK         = 0
+	sftpEOF        = 1
+	sftpNoSuchFile = 2
+)
+
+const (
+	// sftpChunkSize is how much each read or write request carries; every
+	// server accepts 32KiB
+	sftpChunkSize = 32 << 10
+	// sftpInFlight is how many requests are sent ahead of their replies, so
+	// a transfer isn't held to one chunk per round trip
+	sftpInFlight = 64
+	// posixRename replaces the target of a rename, which plain SFTP v3
+	// refuses to
+	posixRename = "posix-rename@openssh.com"
+)
+
+// SFTP stores objects as files on an SSH server, through the system's ssh
+// client and the server's sftp subsystem. Keys are paths: absolute, or
+// relative to the login directory when they start with ~/.
+type SFTP struct {
+	user string
+	host string
+	port string
+}
+
+// NewSFTP returns a store on the server u names, as in sftp://user@host:port.
+// It logs in with ssh's own keys and agent, the key in
+// $BACKITUP_SFTP_IDENTITY, or the password in $BACKITUP_SFTP_PASSWORD.
+func NewSFTP(u *url.URL) (*SFTP, error) {
+	if _, ok := u.User.Password(); ok {
+		return nil, fmt.Errorf("sftp:// locations don't take a password, which would be recorded with every backup; set $%s instead", sftpPasswordEnvVar)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid storage location %q: no host", u.Redacted())
+	}
+	// ssh would take either as an option, such as -oProxyCommand
+	if strings.HasPrefix(u.Hostname(), "-") || strings.HasPrefix(u.User.Username(), "-") {
+		return nil, fmt.Errorf("invalid storage location %q: host and user can't start with -", u.Redacted())
+	}
+	return &SFTP{user: u.User.Username(), host: u.Hostname(), port: u.Port()}, nil
+}
+
+// Location returns the sftp:// URL of key
+func (s *SFTP) Location(key string) string {
+	host := s.host
+	if s.port != "" {
+		host += ":" + s.port
+	}
+	if s.user != "" {
+		host = s.user + "@" + host
+	}
+	return "sftp://" + host + "/" + key
+}
+
+// remotePath is the path key names on the server
+func remotePath(key string) string {
+	if rest, ok := strings.CutPrefix(key, "~/"); ok {
+		return rest
+	}
+	return "/" + key
+}
+
+// Put writes everything read from r to a temporary file next to key and
+// renames it into place once r ends, so a failed dump leaves nothing behind
+func (s *SFTP) Put(key string, r io.Reader) error {
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	target := remotePath(key)
+	c.mkdirAll(path.Dir(target))
+	partial := target + ".partial"
+	handle, err := c.open(partial, sftpFlagWrite|sftpFlagCreate|sftpFlagTrunc)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", s.Location(key), err)
+	}
+	err = c.writeAll(handle, r)
+	if err == nil {
+		// After the write, so a failure exercises the partial file's cleanup
+		err = fault.Inject(fault.StageUpload)
+	}
+	if cerr := c.closeHandle(handle); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = c.rename(partial, target)
+	}
+	if err != nil {
+		c.remove(partial)
+		return fmt.Errorf("failed to upload %s: %w", s.Location(key), err)
+	}
+	return nil
+}
+
+// Get streams the file stored as key
+func (s *SFTP) Get(key string) (io.ReadCloser, error) {
+	c, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	handle, err := c.open(remotePath(key), sftpFlagRead)
+	if err != nil {
+		c.close()
+		return nil, fmt.Errorf("failed to download %s: %w", s.Location(key), err)
+	}
+	return &sftpReader{conn: c, handle: handle}, nil
+}
+
+// Delete removes the file stored as key
+func (s *SFTP) Delete(key string) error {
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	if err := c.remove(remotePath(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %w", s.Location(key), err)
+	}
+	return nil
+}
+
+// sftpConn is an sftp session over an ssh process. Replies are read by
+// one goroutine and handed to the request with the same ID.
+type sftpConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	stderr stderrBuffer
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  uint32
+	pending map[uint32]chan sftpPacket
+	err     error
+
+	extensions map[string]bool
+}
+
+// stderrBuffer collects ssh's error output, which exec copies in from a
+// goroutine of its own while the session reads it for error messages
+type stderrBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *stderrBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *stderrBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+type sftpPacket struct {
+	typ  byte
+	data []byte
+}
+
+func (s *SFTP) connect() (*sftpConn, error) {
+	tool, err := exec.LookPath("ssh")
+	if err != nil {
+		return nil, fmt.Errorf("ssh not found on PATH; install OpenSSH to use sftp:// locations")
+	}
+	args := []string{"-T", "-s"}
+	if s.port != "" {
+		args = append(args, "-p", s.port)
+	}
+	if identity := os.Getenv(sftpIdentityEnvVar); identity != "" {
+		args = append(args, "-i", identity)
+	}
+	cmd := exec.Command(tool)
+	if os.Getenv(sftpPasswordEnvVar) != "" {
+		// ssh reads the password from an askpass program: this one, started
+		// again with askpassEnvVar set
+		self, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the askpass program: %w", err)
+		}
+		cmd.Env = append(os.Environ(), "SSH_ASKPASS="+self, "SSH_ASKPASS_REQUIRE=force", askpassEnvVar+"=1")
+	} else {
+		// Fail rather than wait for a prompt nobody answers
+		args = append(args, "-o", "BatchMode=yes")
+	}
+	destination := s.host
+	if s.user != "" {
+		destination = s.user + "@" + s.host
+	}
+	// "--" ends the options, so a destination can never be read as one
+	cmd.Args = append([]string{tool}, append(args, "--", destination, "sftp")...)
+
+	c := &sftpConn{cmd: cmd, pending: map[uint32]chan sftpPacket{}, extensions: map[string]bool{}}
+	cmd.Stderr = &c.stderr
+	if c.stdin, err = cmd.StdinPipe(); err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	c.stdout = bufio.NewReaderSize(stdout, 64<<10)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start ssh: %w", err)
+	}
+
+	if err := c.handshake(); err != nil {
+		c.close()
+		return nil, fmt.Errorf("failed to open an sftp session on %s: %w\nError output: %s", destination, err, strings.TrimSpace(c.stderr.String()))
+	}
+	go c.readReplies()
+	return c, nil
+}
+
+// handshake negotiates version 3 and notes the server's extensions
+func (c *sftpConn) handshake() error {
+	if err := c.writePacket(sftpInit, appendUint32(nil, 3)); err != nil {
+		return err
+	}
+	p, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if p.typ != sftpVersion {
+		return fmt.Errorf("unexpected sftp packet %d", p.typ)
+	}
+	data := p.data[min(4, len(p.data)):]
+	for len(data) > 0 {
+		var name []byte
+		var ok bool
+		if name, data, ok = cutString(data); !ok {
+			break
+		}
+		if _, data, ok = cutString(data); !ok {
+			break
+		}
+		c.extensions[string(name)] = true
+	}
+	return nil
+}
+
+func (c *sftpConn) close() {
+	c.stdin.Close()
+	c.cmd.Wait()
+}
+
+func (c *sftpConn) writePacket(typ byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	header := appendUint32(nil, uint32(len(payload)+1))
+	header = append(header, typ)
+	if _, err := c.stdin.Write(append(header, payload...)); err != nil {
+		return fmt.Errorf("ssh connection lost: %w", err)
+	}
+	return nil
+}
+
+func (c *sftpConn) readPacket() (sftpPacket, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.stdout, header[:]); err != nil {
+		return sftpPacket{}, fmt.Errorf("ssh connection lost: %w", err)
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < 1 || length > 1<<20 {
+		return sftpPacket{}, fmt.Errorf("malformed sftp packet of %d bytes", length)
+	}
+	data := make([]byte, length-1)
+	if _, err := io.ReadFull(c.stdout, data); err != nil {
+		return sftpPacket{}, fmt.Errorf("ssh connection lost: %w", err)
+	}
+	return sftpPacket{typ: header[4], data: data}, nil
+}
+
+// readReplies hands each reply to the request waiting for it, and fails
+// every waiting request once the connection ends
+func (c *sftpConn) readReplies() {
+	for {
+		p, err := c.readPacket()
+		if err == nil && len(p.data) < 4 {
+			err = fmt.Errorf("malformed sftp packet")
+		}
+		c.mu.Lock()
+		if err != nil {
+			c.err = err
+			for id, ch := range c.pending {
+				close(ch)
+				delete(c.pending, id)
+			}
+			c.mu.Unlock()
+			return
+		}
+		id := binary.BigEndian.Uint32(p.data)
+		if ch, ok := c.pending[id]; ok {
+			delete(c.pending, id)
+			ch <- sftpPacket{typ: p.typ, data: p.data[4:]}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// send issues a request and returns where its reply will arrive
+func (c *sftpConn) send(typ byte, payload []byte) (<-chan sftpPacket, error) {
+	ch := make(chan sftpPacket, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+	if err := c.writePacket(typ, append(appendUint32(nil, id), payload...)); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// wait returns the reply on ch, or why none came
+func (c *sftpConn) wait(ch <-chan sftpPacket) (sftpPacket, error) {
+	p, ok := <-ch
+	if !ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return p, fmt.Errorf("%w\nError output: %s", c.err, strings.TrimSpace(c.stderr.String()))
+	}
+	return p, nil
+}
+
+func (c *sftpConn) call(typ byte, payload []byte) (sftpPacket, error) {
+	ch, err := c.send(typ, payload)
+	if err != nil {
+		return sftpPacket{}, err
+	}
+	return c.wait(ch)
+}
+
+// status turns a reply expected to be a status into an error
+func status(p sftpPacket) error {
+	if p.typ != sftpStatus || len(p.data) < 4 {
+		return fmt.Errorf("unexpected sftp packet %d", p.typ)
+	}
+	code := binary.BigEndian.Uint32(p.data)
+	if code == sftpOK {
+		return nil
+	}
+	message, _, _ := cutString(p.data[4:])
+	err := fmt.Errorf("sftp error %d: %s", code, message)
+	switch code {
+	case sftpEOF:
+		return io.EOF
+	case sftpNoSuchFile:
+		return fmt.Errorf("%w: %v", fs.ErrNotExist, err)
+	}
+	return err
+}
+
+func (c *sftpConn) open(name string, flags uint32) ([]byte, error) {
+	payload := appendString(nil, name)
+	payload = appendUint32(payload, flags)
+	payload = appendUint32(payload, 0) // no attributes
+	p, err := c.call(sftpOpen, payload)
+	if err != nil {
+		return nil, err
+	}
+	if p.typ != sftpHandle {
+		return nil, status(p)
+	}
+	handle, _, ok := cutString(p.data)
+	if !ok {
+		return nil, fmt.Errorf("malformed sftp handle")
+	}
+	return handle, nil
+}
+
+func (c *sftpConn) closeHandle(handle []byte) error {
+	p, err := c.call(sftpClose, appendString(nil, string(handle)))
+	if err != nil {
+		return err
+	}
+	return status(p)
+}
+
+// writeAll writes r to handle, keeping up to sftpInFlight writes unanswered
+func (c *sftpConn) writeAll(handle []byte, r io.Reader) error {
+	var inFlight []<-chan sftpPacket
+	waitOldest := func() error {
+		p, err := c.wait(inFlight[0])
+		inFlight = inFlight[1:]
+		if err != nil {
+			return err
+		}
+		return status(p)
+	}
+
+	buf := make([]byte, sftpChunkSize)
+	var offset uint64
+	for {
+		n, rerr := io.ReadFull(r, buf)
+		if n > 0 {
+			payload := appendString(nil, string(handle))
+			payload = binary.BigEndian.AppendUint64(payload, offset)
+			payload = appendString(payload, string(buf[:n]))
+			ch, err := c.send(sftpWrite, payload)
+			if err != nil {
+				return err
+			}
+			inFlight = append(inFlight, ch)
+			offset += uint64(n)
+			if len(inFlight) >= sftpInFlight {
+				if err := waitOldest(); err != nil {
+					return err
+				}
+			}
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+	for len(inFlight) > 0 {
+		if err := waitOldest(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rename moves from to to, replacing to
+func (c *sftpConn) rename(from, to string) error {
+	payload := appendString(nil, from)
+	payload = appendString(payload, to)
+	var p sftpPacket
+	var err error
+	if c.extensions[posixRename] {
+		p, err = c.call(sftpExtended, append(appendString(nil, posixRename), payload...))
+	} else {
+		c.remove(to)
+		p, err = c.call(sftpRename, payload)
+	}
+	if err != nil {
+		return err
+	}
+	return status(p)
+}
+
+func (c *sftpConn) remove(name string) error {
+	p, err := c.call(sftpRemove, appendString(nil, name))
+	if err != nil {
+		return err
+	}
+	return status(p)
+}
+
+// mkdirAll creates dir and its parents. Failures are ignored: most mean a
+// directory exists, and the rest surface when the file is opened.
+func (c *sftpConn) mkdirAll(dir string) {
+	var parts []string
+	for d := dir; d != "." && d != "/" && d != ""; d = path.Dir(d) {
+		parts = append(parts, d)
+	}
+	for i := len(parts) - 1; i >= 0; i-- {
+		c.call(sftpMkdir, appendUint32(appendString(nil, parts[i]), 0))
+	}
+}
+
+// sftpReader streams a remote file, keeping reads ahead of the consumer
+type sftpReader struct {
+	conn     *sftpConn
+	handle   []byte
+	offset   uint64
+	inFlight []sftpReadRequest
+	buf      []byte
+	err      error
+}
+
+type sftpReadRequest struct {
+	offset uint64
+	reply  <-chan sftpPacket
+}
+
+func (r *sftpReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.fill()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// fill tops up the reads in flight and takes the oldest reply into buf
+func (r *sftpReader) fill() {
+	for len(r.inFlight) < sftpInFlight {
+		payload := appendString(nil, string(r.handle))
+		payload = binary.BigEndian.AppendUint64(payload, r.offset)
+		payload = appendUint32(payload, sftpChunkSize)
+		ch, err := r.conn.send(sftpRead, payload)
+		if err != nil {
+			r.err = err
+			return
+		}
+		r.inFlight = append(r.inFlight, sftpReadRequest{offset: r.offset, reply: ch})
+		r.offset += sftpChunkSize
+	}
+
+	req := r.inFlight[0]
+	r.inFlight = r.inFlight[1:]
+	p, err := r.conn.wait(req.reply)
+	if err != nil {
+		r.err = err
+		return
+	}
+	if p.typ != sftpData {
+		r.err = status(p)
+		return
+	}
+	data, _, ok := cutString(p.data)
+	if !ok {
+		r.err = fmt.Errorf("malformed sftp data")
+		return
+	}
+	r.buf = data
+	if len(data) < sftpChunkSize {
+		// A short read: whatever is in flight past it asked for the wrong
+		// offsets, so start again from where it ended
+		r.discardInFlight()
+		r.offset = req.offset + uint64(len(data))
+	}
+}
+
+func (r *sftpReader) discardInFlight() {
+	for _, req := range r.inFlight {
+		r.conn.wait(req.reply)
+	}
+	r.inFlight = nil
+}
+
+func (r *sftpReader) Close() error {
+	r.discardInFlight()
+	err := r.conn.closeHandle(r.handle)
+	r.conn.close()
+	return err
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return binary.BigEndian.AppendUint32(b, v)
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(appendUint32(b, uint32(len(s))), s...)
+}
+
+// cutString splits the length-prefixed string at the start of b from the
+// rest
+func cutString(b []byte) ([]byte, []byte, bool) {
+	if len(b) < 4 {
+		return nil, b, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint32(len(b)-4) < n {
+		return nil, b, false
+	}
+	return b[4 : 4+n], b[4+n:], true
+}
+
+// ServeAskpass answers ssh's password prompt with $BACKITUP_SFTP_PASSWORD
+// when this process was started by ssh as its askpass program, and reports
+// whether it was
+func ServeAskpass() bool {
+	if os.Getenv(askpassEnvVar) == "" {
+		return false
+	}
+	fmt.Println(os.Getenv(sftpPasswordEnvVar))
+	return true
+}
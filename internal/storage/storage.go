@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Store keeps backups as objects under keys, in a bucket or the like
+type Store interface {
+	// Put stores everything read from r, up to EOF, under key. If r fails
+	// instead of reaching EOF, nothing is stored.
+	Put(key string, r io.Reader) error
+	// Get opens the object stored under key. A missing object is reported
+	// as an error wrapping fs.ErrNotExist.
+	Get(key string) (io.ReadCloser, error)
+	// Delete removes the object stored under key
+	Delete(key string) error
+	// Location returns the URL the object under key is known by
+	Location(key string) string
+}
+
+// IsLocation reports whether location names an object in a store, such as
+// s3://bucket/key or sftp://host/path, rather than a local path
+func IsLocation(location string) bool {
+	return strings.HasPrefix(location, "s3://") || strings.HasPrefix(location, "sftp://")
+}
+
+// Open returns the store location is in and the key it names there. A
+// location naming a prefix, as in s3://bucket/backups, returns the prefix
+// as the key.
+func Open(location string) (Store, string, error) {
+	if strings.HasPrefix(location, "sftp://") {
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid storage location: %w", err)
+		}
+		store, err := NewSFTP(u)
+		if err != nil {
+			return nil, "", err
+		}
+		return store, strings.TrimPrefix(u.Path, "/"), nil
+	}
+	rest, ok := strings.CutPrefix(location, "s3://")
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported storage location %q (expected s3://bucket/key or sftp://user@host/path)", location)
+	}
+	bucket, key, _ := strings.Cut(rest, "/")
+	if bucket == "" {
+		return nil, "", fmt.Errorf("invalid storage location %q: no bucket", location)
+	}
+	store, err := NewS3(bucket)
+	if err != nil {
+		return nil, "", err
+	}
+	return store, key, nil
+}
+
+// Join returns the key of name under prefix
+func Join(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return path.Join(prefix, name)
+}
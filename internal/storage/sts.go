@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables a role to assume is configured from, as the AWS
+// CLI reads them
+const (
+	roleARNEnvVar          = "AWS_ROLE_ARN"
+	roleSessionNameEnvVar  = "AWS_ROLE_SESSION_NAME"
+	webIdentityTokenEnvVar = "AWS_WEB_IDENTITY_TOKEN_FILE"
+	endpointSTSEnvVar      = "AWS_ENDPOINT_URL_STS"
+	// The AWS CLI only takes an external ID from its config file
+	externalIDEnvVar = "BACKITUP_S3_EXTERNAL_ID"
+)
+
+const (
+	defaultRoleSessionName = "back-it-up"
+	// roleDuration is how long assumed credentials are asked to last
+	roleDuration = time.Hour
+	// roleRefreshMargin is how long before they expire they are replaced,
+	// so a request signed with them doesn't outlive them
+	roleRefreshMargin = 5 * time.Minute
+)
+
+// assumedRole hands out temporary credentials for a role, taken with
+// AssumeRole, or AssumeRoleWithWebIdentity when a token file is set, and
+// renewed as they near expiry
+type assumedRole struct {
+	arn         string
+	sessionName string
+	externalID  string
+	tokenFile   string
+	// base signs AssumeRole; a web identity token needs no credentials
+	base     s3Credentials
+	region   string
+	endpoint *url.URL
+	http     *http.Client
+	now      func() time.Time
+
+	mu      sync.Mutex
+	creds   s3Credentials
+	expires time.Time
+}
+
+// assumedRoles are the roles assumed so far, by configuration, so that the
+// stores a command opens share one set of credentials
+var assumedRoles = struct {
+	sync.Mutex
+	m map[string]*assumedRole
+}{m: map[string]*assumedRole{}}
+
+// newAssumedRole returns the role $AWS_ROLE_ARN names, or nil if it is
+// unset
+func newAssumedRole(base s3Credentials, region string, client *http.Client, now func() time.Time) (*assumedRole, error) {
+	arn := os.Getenv(roleARNEnvVar)
+	if arn == "" {
+		if os.Getenv(externalIDEnvVar) != "" {
+			return nil, fmt.Errorf("$%s needs $%s", externalIDEnvVar, roleARNEnvVar)
+		}
+		return nil, nil
+	}
+	r := &assumedRole{
+		arn:         arn,
+		sessionName: os.Getenv(roleSessionNameEnvVar),
+		externalID:  os.Getenv(externalIDEnvVar),
+		tokenFile:   os.Getenv(webIdentityTokenEnvVar),
+		base:        base,
+		region:      region,
+		http:        client,
+		now:         now,
+	}
+	if r.sessionName == "" {
+		r.sessionName = defaultRoleSessionName
+	}
+	if r.tokenFile == "" && (base.accessKey == "" || base.secretKey == "") {
+		return nil, fmt.Errorf("assuming role %s needs credentials; set $%s and $%s, or $%s", arn, accessKeyEnvVar, secretKeyEnvVar, webIdentityTokenEnvVar)
+	}
+	if r.tokenFile != "" && r.externalID != "" {
+		return nil, fmt.Errorf("$%s can't be combined with $%s", externalIDEnvVar, webIdentityTokenEnvVar)
+	}
+
+	endpoint := os.Getenv(endpointSTSEnvVar)
+	if endpoint == "" {
+		endpoint = os.Getenv(endpointEnvVar)
+	}
+	if endpoint == "" {
+		endpoint = "https://sts." + region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid STS endpoint %q", endpoint)
+	}
+	// The path is signed, and an empty one is sent as /
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	r.endpoint = u
+
+	config := strings.Join([]string{r.arn, r.sessionName, r.externalID, r.tokenFile, base.accessKey, region, u.String()}, "\x00")
+	assumedRoles.Lock()
+	defer assumedRoles.Unlock()
+	if existing, ok := assumedRoles.m[config]; ok {
+		return existing, nil
+	}
+	assumedRoles.m[config] = r
+	return r, nil
+}
+
+// credentials returns the role's current credentials, assuming it again
+// once they are close to expiring
+func (r *assumedRole) credentials() (s3Credentials, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.creds.accessKey != "" && r.now().Add(roleRefreshMargin).Before(r.expires) {
+		return r.creds, nil
+	}
+	creds, expires, err := r.assume()
+	if err != nil {
+		return s3Credentials{}, fmt.Errorf("failed to assume role %s: %w", r.arn, err)
+	}
+	r.creds, r.expires = creds, expires
+	return creds, nil
+}
+
+// assume asks STS for a fresh set of the role's credentials
+func (r *assumedRole) assume() (s3Credentials, time.Time, error) {
+	form := url.Values{
+		"RoleArn":         {r.arn},
+		"RoleSessionName": {r.sessionName},
+		"DurationSeconds": {fmt.Sprint(int(roleDuration.Seconds()))},
+		"Version":         {"2011-06-15"},
+	}
+	if r.tokenFile != "" {
+		token, err := os.ReadFile(r.tokenFile)
+		if err != nil {
+			return s3Credentials{}, time.Time{}, fmt.Errorf("failed to read web identity token: %w", err)
+		}
+		form.Set("Action", "AssumeRoleWithWebIdentity")
+		form.Set("WebIdentityToken", strings.TrimSpace(string(token)))
+	} else {
+		form.Set("Action", "AssumeRole")
+		if r.externalID != "" {
+			form.Set("ExternalId", r.externalID)
+		}
+	}
+
+	body := canonicalQuery(form)
+	req, err := http.NewRequest(http.MethodPost, r.endpoint.String(), strings.NewReader(body))
+	if err != nil {
+		return s3Credentials{}, time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// AssumeRoleWithWebIdentity is authorized by its token alone
+	if r.tokenFile == "" {
+		sum := sha256.Sum256([]byte(body))
+		signV4(req, hex.EncodeToString(sum[:]), r.base, r.region, "sts", r.now())
+	}
+
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return s3Credentials{}, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		if err := parseSTSError(data); err != nil {
+			return s3Credentials{}, time.Time{}, err
+		}
+		return s3Credentials{}, time.Time{}, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	type stsCredentials struct {
+		AccessKeyID     string    `xml:"AccessKeyId"`
+		SecretAccessKey string    `xml:"SecretAccessKey"`
+		SessionToken    string    `xml:"SessionToken"`
+		Expiration      time.Time `xml:"Expiration"`
+	}
+	var result struct {
+		Role        stsCredentials `xml:"AssumeRoleResult>Credentials"`
+		WebIdentity stsCredentials `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal(data, &result); err != nil {
+		return s3Credentials{}, time.Time{}, fmt.Errorf("invalid STS response: %w", err)
+	}
+	c := result.Role
+	if r.tokenFile != "" {
+		c = result.WebIdentity
+	}
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return s3Credentials{}, time.Time{}, fmt.Errorf("STS response has no credentials")
+	}
+	return s3Credentials{accessKey: c.AccessKeyID, secretKey: c.SecretAccessKey, sessionToken: c.SessionToken}, c.Expiration, nil
+}
+
+// parseSTSError returns the error an STS response body describes, if it is
+// one
+func parseSTSError(data []byte) error {
+	var e struct {
+		XMLName xml.Name
+		Code    string `xml:"Error>Code"`
+		Message string `xml:"Error>Message"`
+	}
+	if xml.Unmarshal(data, &e) != nil || e.XMLName.Local != "ErrorResponse" {
+		return nil
+	}
+	return fmt.Errorf("%s: %s", e.Code, e.Message)
+}
@@ -0,0 +1,86 @@
+package subset
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Masking strategies
+const (
+	MaskKeep  = "keep"
+	MaskHash  = "hash"
+	MaskEmail = "email"
+	MaskNull  = "null"
+)
+
+// autoMaskPatterns maps column name fragments to the strategy applied when
+// automatic masking is on
+var autoMaskPatterns = []struct {
+	fragment string
+	strategy string
+}{
+	{"email", MaskEmail},
+	{"phone", MaskHash},
+	{"first_name", MaskHash},
+	{"last_name", MaskHash},
+	{"full_name", MaskHash},
+	{"address", MaskHash},
+	{"ssn", MaskHash},
+	{"password", MaskHash},
+	{"token", MaskHash},
+	{"secret", MaskHash},
+}
+
+// ParseMask parses a "schema.table.column=strategy" flag value
+func ParseMask(spec string) (string, string, error) {
+	column, strategy, ok := strings.Cut(spec, "=")
+	if !ok || strings.Count(column, ".") < 1 {
+		return "", "", fmt.Errorf("invalid mask %q: expected table.column=strategy", spec)
+	}
+	switch strategy {
+	case MaskKeep, MaskHash, MaskEmail, MaskNull:
+	default:
+		return "", "", fmt.Errorf("invalid mask %q: strategy must be keep, hash, email, or null", spec)
+	}
+	if strings.Count(column, ".") == 1 {
+		column = "public." + column
+	}
+	return column, strategy, nil
+}
+
+// autoMask picks a strategy for a column from its name
+func autoMask(col Column) string {
+	if !col.Text {
+		return MaskKeep
+	}
+	name := strings.ToLower(col.Name)
+	for _, p := range autoMaskPatterns {
+		if strings.Contains(name, p.fragment) {
+			return p.strategy
+		}
+	}
+	return MaskKeep
+}
+
+// maskExpr returns the select-list expression that produces a masked column.
+// Hashing is deterministic, so unique values stay unique and equal values
+// stay equal.
+func maskExpr(col Column, strategy string) (string, error) {
+	ident := QuoteIdent(col.Name)
+	switch strategy {
+	case MaskKeep:
+		return ident, nil
+	case MaskNull:
+		return fmt.Sprintf("NULL::%s", col.Type), nil
+	}
+
+	if !col.Text {
+		return "", fmt.Errorf("column %s has type %s: only text columns can be hashed", col.Name, col.Type)
+	}
+	switch strategy {
+	case MaskEmail:
+		return fmt.Sprintf("CAST('user_' || left(md5(%s::text), 12) || '@example.com' AS %s)", ident, col.Type), nil
+	default:
+		return fmt.Sprintf("CAST(md5(%s::text) AS %s)", ident, col.Type), nil
+	}
+}
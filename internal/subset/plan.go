@@ -0,0 +1,216 @@
+package subset
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Root selects the rows a subset starts from
+type Root struct {
+	// Table is the qualified table name
+	Table string
+	// Filter is an optional WHERE/ORDER BY/LIMIT tail, e.g.
+	// "WHERE created_at > now() - interval '30 days' ORDER BY id DESC LIMIT 1000"
+	Filter string
+}
+
+// ParseRoot parses a "table [WHERE ...] [ORDER BY ...] [LIMIT n]" flag value
+func ParseRoot(spec string) (Root, error) {
+	spec = strings.TrimSpace(spec)
+	table, filter, _ := strings.Cut(spec, " ")
+	filter = strings.TrimSpace(filter)
+	if table == "" {
+		return Root{}, fmt.Errorf("invalid root %q: missing table", spec)
+	}
+	if strings.Contains(filter, ";") {
+		return Root{}, fmt.Errorf("invalid root %q: filter must be a single clause", spec)
+	}
+	if filter != "" {
+		head := strings.ToUpper(strings.Fields(filter)[0])
+		if head != "WHERE" && head != "ORDER" && head != "LIMIT" {
+			return Root{}, fmt.Errorf("invalid root %q: filter must start with WHERE, ORDER BY, or LIMIT", spec)
+		}
+	}
+	return Root{Table: QualifiedName(table), Filter: filter}, nil
+}
+
+// Options controls which rows a subset contains and how they are masked
+type Options struct {
+	// Roots are filtered selections the subset starts from
+	Roots []Root
+	// Children follows foreign keys from the starting rows to the rows that
+	// reference them (transitively) before parent rows are added
+	Children bool
+	// Rows is the number of rows sampled from each table before foreign
+	// keys are followed
+	Rows int
+	// TableRows overrides Rows for individual tables, keyed by qualified name
+	TableRows map[string]int
+	// Masks sets the masking strategy for columns, keyed by
+	// schema.table.column
+	Masks map[string]string
+	// AutoMask masks text columns whose names look like personal data
+	AutoMask bool
+}
+
+// Plan is a subsetting script plus the tables it emits, in output order
+type Plan struct {
+	Script string
+	Tables []Table
+	// Masked lists the columns that are masked, as schema.table.column=strategy
+	Masked []string
+}
+
+// Build generates a psql script that selects the root rows and a sample of
+// every table, optionally adds the rows referencing them, then adds the
+// parent rows everything selected references until every foreign key is
+// satisfied, and finally copies the selected rows to stdout. Each table's
+// rows are followed by a "\." line, in the order of Plan.Tables. The script
+// runs in a single rolled-back transaction and only creates temporary
+// tables.
+func Build(schema *Schema, opts Options) (*Plan, error) {
+	for _, root := range opts.Roots {
+		if _, ok := schema.Table(root.Table); !ok {
+			return nil, fmt.Errorf("unknown root table %s", root.Table)
+		}
+	}
+	for key := range opts.TableRows {
+		if _, ok := schema.Table(key); !ok {
+			return nil, fmt.Errorf("unknown table %s", key)
+		}
+	}
+	for key := range opts.Masks {
+		i := strings.LastIndex(key, ".")
+		t, ok := schema.Table(key[:i])
+		if !ok || !hasColumn(t, key[i+1:]) {
+			return nil, fmt.Errorf("unknown column %s", key)
+		}
+	}
+
+	selected := make(map[string]string, len(schema.Tables))
+	for i, t := range schema.Tables {
+		selected[t.Key()] = QuoteIdent(fmt.Sprintf("_subset_%d", i))
+	}
+
+	var b strings.Builder
+	b.WriteString("BEGIN ISOLATION LEVEL REPEATABLE READ;\n")
+	for _, t := range schema.Tables {
+		fmt.Fprintf(&b, "CREATE TEMP TABLE %s (row_id tid PRIMARY KEY);\n", selected[t.Key()])
+	}
+
+	for _, root := range opts.Roots {
+		t, _ := schema.Table(root.Table)
+		fmt.Fprintf(&b, "INSERT INTO %s SELECT ctid FROM %s %s ON CONFLICT DO NOTHING;\n", selected[t.Key()], t.Ident(), root.Filter)
+	}
+
+	for _, t := range schema.Tables {
+		rows := opts.Rows
+		if n, ok := opts.TableRows[t.Key()]; ok {
+			rows = n
+		}
+		if rows > 0 {
+			fmt.Fprintf(&b, "INSERT INTO %s SELECT ctid FROM %s LIMIT %d ON CONFLICT DO NOTHING;\n", selected[t.Key()], t.Ident(), rows)
+		}
+	}
+
+	// Children are only collected from the starting rows; parents added
+	// afterwards don't pull in their other children, which keeps the
+	// subset bounded
+	if opts.Children {
+		writeClosure(&b, schema, selected, true)
+	}
+	writeClosure(&b, schema, selected, false)
+
+	plan := &Plan{}
+	fkColumns := schema.foreignKeyColumns()
+	for _, t := range schema.Tables {
+		if len(t.Columns) == 0 {
+			continue
+		}
+		exprs := make([]string, len(t.Columns))
+		for i, col := range t.Columns {
+			key := t.Key() + "." + col.Name
+			strategy, explicit := opts.Masks[key]
+			if !explicit {
+				strategy = MaskKeep
+				// Masking key columns would break the references between sampled rows
+				if opts.AutoMask && !fkColumns[key] {
+					strategy = autoMask(col)
+				}
+			}
+			expr, err := maskExpr(col, strategy)
+			if err != nil {
+				return nil, fmt.Errorf("cannot mask %s: %w", key, err)
+			}
+			if strategy != MaskKeep {
+				plan.Masked = append(plan.Masked, key+"="+strategy)
+			}
+			exprs[i] = expr
+		}
+		plan.Tables = append(plan.Tables, t)
+		fmt.Fprintf(&b, "COPY (SELECT %s FROM %s WHERE ctid IN (SELECT row_id FROM %s)) TO STDOUT;\n",
+			strings.Join(exprs, ", "), t.Ident(), selected[t.Key()])
+		b.WriteString("SELECT '\\.';\n")
+	}
+	b.WriteString("ROLLBACK;\n")
+
+	sort.Strings(plan.Masked)
+	plan.Script = b.String()
+	return plan, nil
+}
+
+// writeClosure emits a loop that follows every foreign key, towards the
+// referencing rows if children is set and towards the referenced rows
+// otherwise, until nothing new is added. It terminates on cycles and
+// self-references too.
+func writeClosure(b *strings.Builder, schema *Schema, selected map[string]string, children bool) {
+	if len(schema.ForeignKeys) == 0 {
+		return
+	}
+
+	b.WriteString("DO $subset$\nDECLARE n bigint; added bigint;\nBEGIN\n  LOOP\n    added := 0;\n")
+	for _, fk := range schema.ForeignKeys {
+		parent, _ := schema.Table(fk.ParentKey())
+		child, _ := schema.Table(fk.ChildKey())
+		if children {
+			fmt.Fprintf(b, "    INSERT INTO %s SELECT c.ctid FROM %s c WHERE (%s) IN (SELECT %s FROM %s p WHERE p.ctid IN (SELECT row_id FROM %s)) ON CONFLICT DO NOTHING;\n",
+				selected[child.Key()], child.Ident(),
+				qualifiedColumns("c", fk.ChildColumns),
+				qualifiedColumns("p", fk.ParentColumns), parent.Ident(), selected[parent.Key()])
+		} else {
+			fmt.Fprintf(b, "    INSERT INTO %s SELECT p.ctid FROM %s p WHERE (%s) IN (SELECT %s FROM %s c WHERE c.ctid IN (SELECT row_id FROM %s)) ON CONFLICT DO NOTHING;\n",
+				selected[parent.Key()], parent.Ident(),
+				qualifiedColumns("p", fk.ParentColumns),
+				qualifiedColumns("c", fk.ChildColumns), child.Ident(), selected[child.Key()])
+		}
+		b.WriteString("    GET DIAGNOSTICS n = ROW_COUNT; added := added + n;\n")
+	}
+	b.WriteString("    EXIT WHEN added = 0;\n  END LOOP;\nEND\n$subset$;\n")
+}
+
+// CopyHeader returns the COPY ... FROM stdin statement that loads t's rows
+func CopyHeader(t Table) string {
+	cols := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		cols[i] = QuoteIdent(col.Name)
+	}
+	return fmt.Sprintf("COPY %s (%s) FROM stdin;", t.Ident(), strings.Join(cols, ", "))
+}
+
+func hasColumn(t Table, name string) bool {
+	for _, col := range t.Columns {
+		if col.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func qualifiedColumns(alias string, cols []string) string {
+	quoted := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = alias + "." + QuoteIdent(col)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,165 @@
+package subset
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Column is a copyable (non-generated) table column
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Text reports whether the column has a string type and can be masked
+	Text bool `json:"text"`
+	// Nullable reports whether the column accepts NULL
+	Nullable bool `json:"nullable"`
+	// Base is the underlying type of a domain column, or Type otherwise
+	Base string `json:"base"`
+	// Enum reports whether Base is an enum type
+	Enum bool `json:"enum"`
+	// Sequence is the sequence behind a serial or identity column
+	Sequence string `json:"sequence,omitempty"`
+}
+
+// Table is an ordinary table with its columns in attribute order
+type Table struct {
+	Schema  string   `json:"schema"`
+	Name    string   `json:"name"`
+	Columns []Column `json:"columns"`
+}
+
+// Key returns the table's schema-qualified name, e.g. public.users
+func (t Table) Key() string {
+	return t.Schema + "." + t.Name
+}
+
+// Ident returns the quoted, schema-qualified identifier
+func (t Table) Ident() string {
+	return QuoteIdent(t.Schema) + "." + QuoteIdent(t.Name)
+}
+
+// ForeignKey is a foreign key constraint from Child to Parent
+type ForeignKey struct {
+	ChildSchema   string   `json:"child_schema"`
+	Child         string   `json:"child"`
+	ParentSchema  string   `json:"parent_schema"`
+	Parent        string   `json:"parent"`
+	ChildColumns  []string `json:"child_columns"`
+	ParentColumns []string `json:"parent_columns"`
+}
+
+// ChildKey returns the referencing table's qualified name
+func (fk ForeignKey) ChildKey() string { return fk.ChildSchema + "." + fk.Child }
+
+// ParentKey returns the referenced table's qualified name
+func (fk ForeignKey) ParentKey() string { return fk.ParentSchema + "." + fk.Parent }
+
+// Schema is the part of a database's catalog the subsetter needs
+type Schema struct {
+	Tables      []Table      `json:"tables"`
+	ForeignKeys []ForeignKey `json:"foreign_keys"`
+}
+
+// SchemaQuery returns the schema as a single JSON document. Partitioned
+// parents and extension-owned tables are left out.
+const SchemaQuery = `SELECT json_build_object(
+  'tables', (SELECT coalesce(json_agg(json_build_object(
+      'schema', n.nspname,
+      'name', c.relname,
+      'columns', (SELECT coalesce(json_agg(json_build_object(
+            'name', a.attname,
+            'type', format_type(a.atttypid, a.atttypmod),
+            'text', t.typcategory = 'S',
+            'nullable', NOT a.attnotnull,
+            'base', CASE WHEN t.typtype = 'd' THEN format_type(t.typbasetype, t.typtypmod) ELSE format_type(a.atttypid, a.atttypmod) END,
+            'enum', coalesce(bt.typtype, t.typtype) = 'e',
+            'sequence', pg_get_serial_sequence(format('%I.%I', n.nspname, c.relname), a.attname)) ORDER BY a.attnum), '[]')
+          FROM pg_attribute a JOIN pg_type t ON t.oid = a.atttypid
+          LEFT JOIN pg_type bt ON bt.oid = nullif(t.typbasetype, 0)
+          WHERE a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped AND a.attgenerated = ''))
+      ORDER BY n.nspname, c.relname), '[]')
+    FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+    WHERE c.relkind = 'r'
+      AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+      AND n.nspname NOT LIKE 'pg\_toast%' AND n.nspname NOT LIKE 'pg\_temp%'
+      AND NOT EXISTS (SELECT 1 FROM pg_depend d
+        WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'e')),
+  'foreign_keys', (SELECT coalesce(json_agg(json_build_object(
+      'child_schema', cn.nspname,
+      'child', cc.relname,
+      'parent_schema', pn.nspname,
+      'parent', pc.relname,
+      'child_columns', (SELECT json_agg(a.attname ORDER BY k.ord)
+          FROM unnest(con.conkey) WITH ORDINALITY k(attnum, ord)
+          JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum),
+      'parent_columns', (SELECT json_agg(a.attname ORDER BY k.ord)
+          FROM unnest(con.confkey) WITH ORDINALITY k(attnum, ord)
+          JOIN pg_attribute a ON a.attrelid = con.confrelid AND a.attnum = k.attnum))
+      ORDER BY con.conname), '[]')
+    FROM pg_constraint con
+    JOIN pg_class cc ON cc.oid = con.conrelid JOIN pg_namespace cn ON cn.oid = cc.relnamespace
+    JOIN pg_class pc ON pc.oid = con.confrelid JOIN pg_namespace pn ON pn.oid = pc.relnamespace
+    WHERE con.contype = 'f'))`
+
+// ParseSchema decodes the output of SchemaQuery. Foreign keys between
+// tables outside the schema (e.g. partitioned parents) are dropped.
+func ParseSchema(output []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal([]byte(strings.TrimSpace(string(output))), &s); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+
+	known := make(map[string]bool, len(s.Tables))
+	for _, t := range s.Tables {
+		known[t.Key()] = true
+	}
+	fks := s.ForeignKeys[:0]
+	for _, fk := range s.ForeignKeys {
+		if known[fk.ChildKey()] && known[fk.ParentKey()] {
+			fks = append(fks, fk)
+		}
+	}
+	s.ForeignKeys = fks
+	return &s, nil
+}
+
+// Table looks up a table by qualified name. Unqualified names are
+// resolved in the public schema.
+func (s *Schema) Table(name string) (Table, bool) {
+	key := QualifiedName(name)
+	for _, t := range s.Tables {
+		if t.Key() == key {
+			return t, true
+		}
+	}
+	return Table{}, false
+}
+
+// foreignKeyColumns returns the columns of each table that take part in a
+// foreign key, on either side
+func (s *Schema) foreignKeyColumns() map[string]bool {
+	cols := map[string]bool{}
+	for _, fk := range s.ForeignKeys {
+		for _, c := range fk.ChildColumns {
+			cols[fk.ChildKey()+"."+c] = true
+		}
+		for _, c := range fk.ParentColumns {
+			cols[fk.ParentKey()+"."+c] = true
+		}
+	}
+	return cols
+}
+
+// QualifiedName adds the public schema to an unqualified table name
+func QualifiedName(name string) string {
+	if strings.Contains(name, ".") {
+		return name
+	}
+	return "public." + name
+}
+
+// QuoteIdent quotes a SQL identifier
+func QuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,280 @@
+package synth
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iostate/back-it-up/internal/subset"
+)
+
+// TableInsert is the statement that fills one table
+type TableInsert struct {
+	Table string
+	SQL   string
+}
+
+// Plan fills every table of a schema with generated rows
+type Plan struct {
+	// Inserts are in foreign key order: parents before children
+	Inserts []TableInsert
+	// Sequences moves serial and identity sequences past the generated values
+	Sequences []string
+	// Skipped lists tables that can't be filled, with the reason
+	Skipped []string
+}
+
+// Build generates an INSERT ... SELECT over generate_series for every
+// table. Row i of each table gets values derived from i, so keys are unique
+// and a foreign key column can reproduce the referenced key of parent row
+// ((i - 1) % rows) + 1 without reading it back. Foreign keys that close a
+// cycle are left NULL; tables in a cycle of NOT NULL keys are skipped.
+func Build(schema *subset.Schema, rows int) (*Plan, error) {
+	if rows < 1 {
+		return nil, fmt.Errorf("rows must be at least 1")
+	}
+
+	tables := make(map[string]subset.Table, len(schema.Tables))
+	for _, t := range schema.Tables {
+		tables[t.Key()] = t
+	}
+	g := &generator{tables: tables, refs: map[string]map[string]colRef{}, rows: rows}
+
+	order, broken, skipped := sortTables(schema)
+	nulled := map[string]bool{}
+	for i, fk := range schema.ForeignKeys {
+		if broken[i] {
+			for _, c := range fk.ChildColumns {
+				nulled[fk.ChildKey()+"."+c] = true
+			}
+			continue
+		}
+		for j, c := range fk.ChildColumns {
+			if g.refs[fk.ChildKey()] == nil {
+				g.refs[fk.ChildKey()] = map[string]colRef{}
+			}
+			g.refs[fk.ChildKey()][c] = colRef{table: fk.ParentKey(), column: fk.ParentColumns[j]}
+		}
+	}
+
+	plan := &Plan{Skipped: skipped}
+	for _, key := range order {
+		t := tables[key]
+		if len(t.Columns) == 0 {
+			plan.Skipped = append(plan.Skipped, key+": no insertable columns")
+			continue
+		}
+		cols := make([]string, len(t.Columns))
+		exprs := make([]string, len(t.Columns))
+		for i, col := range t.Columns {
+			cols[i] = subset.QuoteIdent(col.Name)
+			if _, ok := g.refs[key][col.Name]; !ok && nulled[key+"."+col.Name] {
+				exprs[i] = "NULL"
+				continue
+			}
+			exprs[i] = g.expr(key, col, "i", 0)
+		}
+		plan.Inserts = append(plan.Inserts, TableInsert{
+			Table: key,
+			SQL: fmt.Sprintf("INSERT INTO %s (%s) OVERRIDING SYSTEM VALUE SELECT %s FROM generate_series(1, %d) AS g(i) ON CONFLICT DO NOTHING",
+				t.Ident(), strings.Join(cols, ", "), strings.Join(exprs, ", "), rows),
+		})
+		for _, col := range t.Columns {
+			if col.Sequence != "" {
+				plan.Sequences = append(plan.Sequences, fmt.Sprintf("SELECT setval(%s, coalesce(max(%s), 0) + 1, false) FROM %s",
+					quoteLiteral(col.Sequence), subset.QuoteIdent(col.Name), t.Ident()))
+			}
+		}
+	}
+	return plan, nil
+}
+
+type colRef struct {
+	table, column string
+}
+
+type generator struct {
+	tables map[string]subset.Table
+	refs   map[string]map[string]colRef
+	rows   int
+}
+
+// expr returns the value of col in row i of table. A foreign key column
+// takes the value its referenced column has in the matching parent row.
+func (g *generator) expr(table string, col subset.Column, i string, depth int) string {
+	if ref, ok := g.refs[table][col.Name]; ok && depth < 8 {
+		if parent, ok := g.column(ref.table, ref.column); ok {
+			j := fmt.Sprintf("((%s - 1) %% %d + 1)", i, g.rows)
+			return fmt.Sprintf("(%s)::%s", g.expr(ref.table, parent, j, depth+1), col.Type)
+		}
+	}
+	return fmt.Sprintf("(%s)::%s", value(col, i), col.Type)
+}
+
+func (g *generator) column(table, name string) (subset.Column, bool) {
+	for _, c := range g.tables[table].Columns {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return subset.Column{}, false
+}
+
+var numericRe = regexp.MustCompile(`^numeric\((\d+),(\d+)\)$`)
+
+// value generates a column's value for row i from its base type
+func value(col subset.Column, i string) string {
+	base := strings.ToLower(col.Base)
+	name := strings.ToLower(col.Name)
+	switch {
+	case col.Enum:
+		return fmt.Sprintf("(enum_range(NULL::%[1]s))[1 + %[2]s %% array_length(enum_range(NULL::%[1]s), 1)]", col.Base, i)
+	case strings.HasSuffix(base, "[]"):
+		return "'{}'"
+	case base == "smallint":
+		return fmt.Sprintf("%s %% 32767", i)
+	case base == "integer" || base == "bigint":
+		return i
+	case numericRe.MatchString(base):
+		m := numericRe.FindStringSubmatch(base)
+		precision, _ := strconv.Atoi(m[1])
+		scale, _ := strconv.Atoi(m[2])
+		digits := min(precision-scale, 9)
+		if digits <= 0 {
+			return "0"
+		}
+		return fmt.Sprintf("%s %% %d", i, pow10(digits))
+	case base == "numeric" || base == "real" || base == "double precision":
+		return fmt.Sprintf("%s * 1.5", i)
+	case base == "money":
+		return fmt.Sprintf("(%s %% 10000)::numeric", i)
+	case base == "boolean":
+		return fmt.Sprintf("%s %% 2 = 0", i)
+	case base == "uuid":
+		return fmt.Sprintf("md5(%s || %s)::uuid", i, quoteLiteral("-"+col.Name))
+	case base == "date":
+		return fmt.Sprintf("date '2020-01-01' + %s %% 3650", i)
+	case strings.HasPrefix(base, "timestamp"):
+		return fmt.Sprintf("timestamp '2020-01-01' + %s * interval '1 minute'", i)
+	case strings.HasPrefix(base, "time"):
+		return fmt.Sprintf("time '00:00' + %s %% 86400 * interval '1 second'", i)
+	case strings.HasPrefix(base, "interval"):
+		return fmt.Sprintf("%s * interval '1 minute'", i)
+	case base == "json":
+		return fmt.Sprintf("json_build_object('id', %s)", i)
+	case base == "jsonb":
+		return fmt.Sprintf("jsonb_build_object('id', %s)", i)
+	case base == "bytea":
+		return fmt.Sprintf("decode(md5(%s::text), 'hex')", i)
+	case base == "inet" || base == "cidr":
+		return fmt.Sprintf("'10.0.0.0'::inet + %s", i)
+	case col.Text && strings.Contains(name, "email"):
+		return fmt.Sprintf("'user' || %s || '@example.com'", i)
+	case col.Text:
+		// The row number goes first so truncation to varchar(n) keeps values distinct
+		return fmt.Sprintf("%s || %s", i, quoteLiteral("-"+col.Name))
+	case col.Nullable:
+		return "NULL"
+	default:
+		return i + "::text"
+	}
+}
+
+// sortTables orders tables parents first. A foreign key that closes a cycle
+// is broken, by index into schema.ForeignKeys, if its columns are nullable;
+// the tables of a cycle that can't be broken are skipped.
+func sortTables(schema *subset.Schema) (order []string, broken map[int]bool, skipped []string) {
+	broken = map[int]bool{}
+	parents := map[string][]int{}
+	for i, fk := range schema.ForeignKeys {
+		if fk.ChildKey() != fk.ParentKey() {
+			parents[fk.ChildKey()] = append(parents[fk.ChildKey()], i)
+		}
+	}
+	tables := make(map[string]subset.Table, len(schema.Tables))
+	var keys []string
+	for _, t := range schema.Tables {
+		tables[t.Key()] = t
+		keys = append(keys, t.Key())
+	}
+	sort.Strings(keys)
+
+	placed := map[string]bool{}
+	for len(placed) < len(keys) {
+		progress := false
+		for _, key := range keys {
+			if placed[key] || !ready(schema, parents[key], placed, broken) {
+				continue
+			}
+			order = append(order, key)
+			placed[key] = true
+			progress = true
+		}
+		if progress {
+			continue
+		}
+
+		// Every remaining table waits on another: break a nullable key
+		if !breakCycle(schema, keys, tables, parents, placed, broken) {
+			for _, key := range keys {
+				if !placed[key] {
+					skipped = append(skipped, key+": in a cycle of NOT NULL foreign keys")
+					placed[key] = true
+				}
+			}
+		}
+	}
+	return order, broken, skipped
+}
+
+func ready(schema *subset.Schema, fks []int, placed map[string]bool, broken map[int]bool) bool {
+	for _, i := range fks {
+		if !placed[schema.ForeignKeys[i].ParentKey()] && !broken[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// breakCycle marks the first nullable foreign key between unplaced tables
+// as broken, reporting whether there was one
+func breakCycle(schema *subset.Schema, keys []string, tables map[string]subset.Table, parents map[string][]int, placed map[string]bool, broken map[int]bool) bool {
+	for _, key := range keys {
+		if placed[key] {
+			continue
+		}
+		for _, i := range parents[key] {
+			fk := schema.ForeignKeys[i]
+			if !placed[fk.ParentKey()] && !broken[i] && nullable(tables[key], fk.ChildColumns) {
+				broken[i] = true
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func nullable(t subset.Table, columns []string) bool {
+	for _, c := range t.Columns {
+		for _, name := range columns {
+			if c.Name == name && !c.Nullable {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func pow10(n int) int {
+	p := 1
+	for range n {
+		p *= 10
+	}
+	return p
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
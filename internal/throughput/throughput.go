@@ -0,0 +1,215 @@
+// Package throughput remembers how fast backups, restores, and transfers ran
+// between a given source and destination, so duration estimates are based
+// on what this environment actually achieves rather than a guess.
+package throughput
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DefaultPath is where observations are kept unless overridden
+const DefaultPath = "./backups/throughput.json"
+
+// maxSamples is how many recent observations are kept per route; older ones
+// stop describing the environment once hardware or links change
+const maxSamples = 20
+
+// minDuration filters out runs too short to say anything about throughput
+const minDuration = time.Second
+
+// Operations recorded in Observation.Op
+const (
+	OpBackup   = "backup"
+	OpRestore  = "restore"
+	OpDownload = "download"
+	OpUpload   = "upload"
+)
+
+// Observation is one completed transfer. Bytes is the size of the backup
+// artifact, so estimates can be made from a file size before starting.
+type Observation struct {
+	Op          string        `json:"op"`
+	Source      string        `json:"source"`
+	Destination string        `json:"destination"`
+	Bytes       int64         `json:"bytes"`
+	Duration    time.Duration `json:"duration"`
+	At          time.Time     `json:"at"`
+}
+
+// Rate summarizes the observations for one route
+type Rate struct {
+	Op          string
+	Source      string
+	Destination string
+	// BytesPerSecond is weighted towards recent runs
+	BytesPerSecond float64
+	Samples        int
+	Last           time.Time
+}
+
+// Estimate returns how long transferring size bytes should take
+func (r Rate) Estimate(size int64) time.Duration {
+	if r.BytesPerSecond <= 0 {
+		return 0
+	}
+	return time.Duration(float64(size) / r.BytesPerSecond * float64(time.Second))
+}
+
+// Store is a throughput history file
+type Store struct {
+	path string
+}
+
+type storeFile struct {
+	Observations []Observation `json:"observations"`
+}
+
+// Open returns the store at path. The file is created on first write.
+func Open(path string) *Store {
+	return &Store{path: path}
+}
+
+// Record adds an observation, dropping the oldest for its route beyond
+// maxSamples. Runs shorter than a second are ignored.
+func (s *Store) Record(o Observation) error {
+	if o.Duration < minDuration || o.Bytes <= 0 {
+		return nil
+	}
+	if o.At.IsZero() {
+		o.At = time.Now()
+	}
+
+	f, err := s.load()
+	if err != nil {
+		return err
+	}
+	f.Observations = append(f.Observations, o)
+
+	kept := make([]Observation, 0, len(f.Observations))
+	count := map[[3]string]int{}
+	for i := len(f.Observations) - 1; i >= 0; i-- {
+		obs := f.Observations[i]
+		key := [3]string{obs.Op, obs.Source, obs.Destination}
+		if count[key] < maxSamples {
+			kept = append(kept, obs)
+		}
+		count[key]++
+	}
+	// kept is newest first; store oldest first
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	f.Observations = kept
+	return s.save(f)
+}
+
+// Rate returns the throughput seen for op between source and destination
+func (s *Store) Rate(op, source, destination string) (Rate, bool, error) {
+	rates, err := s.Rates()
+	if err != nil {
+		return Rate{}, false, err
+	}
+	for _, r := range rates {
+		if r.Op == op && r.Source == source && r.Destination == destination {
+			return r, true, nil
+		}
+	}
+	return Rate{}, false, nil
+}
+
+// Rates summarizes every route, sorted by operation, source, and destination
+func (s *Store) Rates() ([]Rate, error) {
+	f, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	type acc struct {
+		rate           Rate
+		bytes, seconds float64
+	}
+	routes := map[[3]string]*acc{}
+	var keys [][3]string
+	for i, o := range f.Observations {
+		key := [3]string{o.Op, o.Source, o.Destination}
+		a, ok := routes[key]
+		if !ok {
+			a = &acc{rate: Rate{Op: o.Op, Source: o.Source, Destination: o.Destination}}
+			routes[key] = a
+			keys = append(keys, key)
+		}
+		// Newer observations count more, halving every maxSamples/2 runs
+		// back, so the estimate follows changes without jumping on one outlier
+		age := float64(len(f.Observations) - 1 - i)
+		weight := math.Pow(0.5, age/(maxSamples/2))
+		a.bytes += weight * float64(o.Bytes)
+		a.seconds += weight * o.Duration.Seconds()
+		a.rate.Samples++
+		if o.At.After(a.rate.Last) {
+			a.rate.Last = o.At
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		for k := range keys[i] {
+			if keys[i][k] != keys[j][k] {
+				return keys[i][k] < keys[j][k]
+			}
+		}
+		return false
+	})
+	rates := make([]Rate, 0, len(keys))
+	for _, key := range keys {
+		a := routes[key]
+		if a.seconds > 0 {
+			a.rate.BytesPerSecond = a.bytes / a.seconds
+		}
+		rates = append(rates, a.rate)
+	}
+	return rates, nil
+}
+
+func (s *Store) load() (storeFile, error) {
+	var f storeFile
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return f, fmt.Errorf("failed to read throughput history: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &f); err != nil {
+		return f, fmt.Errorf("failed to parse throughput history %s: %w", s.path, err)
+	}
+	return f, nil
+}
+
+// save writes the store atomically
+func (s *Store) save(f storeFile) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create throughput history directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode throughput history: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write throughput history: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write throughput history: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+// Package update replaces the running binary with a signed release. A
+// release is described by a JSON metadata file listing one binary per
+// platform with its SHA-256 and an Ed25519 signature binding that checksum
+// to the release's version and the platform.
+package update
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// DefaultMetadataURL is where the latest release's metadata is published
+const DefaultMetadataURL = "https://github.com/iostate/back-it-up/releases/latest/download/release.json"
+
+// Release is the metadata of one release
+type Release struct {
+	Version string `json:"version"`
+	// Binaries is keyed by "<os>/<arch>", e.g. "linux/amd64"
+	Binaries map[string]Binary `json:"binaries"`
+}
+
+// Binary is one platform's build of a release
+type Binary struct {
+	// URL may be relative to the metadata file
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+	// Signature is the base64 Ed25519 signature of the binary's Statement
+	Signature string `json:"signature"`
+}
+
+// Statement is what a binary's signature covers: the release's version,
+// the platform, and the binary's SHA-256. Signing the checksum rather than
+// the binary alone means whoever serves the metadata can't pass off an
+// older signed binary as a newer version, or one platform's as another's.
+func Statement(version, platform, sha256 string) []byte {
+	return []byte("back-it-up " + version + " " + platform + " " + sha256 + "\n")
+}
+
+// Platform returns the release key of the running binary's platform
+func Platform() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// FetchRelease downloads and parses the release metadata at metadataURL,
+// resolving the binaries' URLs against it
+func FetchRelease(metadataURL string) (*Release, error) {
+	base, err := url.Parse(metadataURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid release metadata URL: %w", err)
+	}
+	resp, err := http.Get(metadataURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch release metadata: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch release metadata: %s", resp.Status)
+	}
+
+	var release Release
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&release); err != nil {
+		return nil, fmt.Errorf("failed to parse release metadata: %w", err)
+	}
+	if release.Version == "" {
+		return nil, fmt.Errorf("release metadata at %s has no version", metadataURL)
+	}
+	for platform, bin := range release.Binaries {
+		ref, err := url.Parse(bin.URL)
+		if err != nil || bin.URL == "" {
+			return nil, fmt.Errorf("release metadata has an invalid URL for %s", platform)
+		}
+		bin.URL = base.ResolveReference(ref).String()
+		release.Binaries[platform] = bin
+	}
+	return &release, nil
+}
+
+// Newer reports whether version a is later than b. Versions are dotted
+// numbers with an optional "v" prefix; a pre-release suffix after "-" sorts
+// before the release itself.
+func Newer(a, b string) bool {
+	aNums, aPre := splitVersion(a)
+	bNums, bPre := splitVersion(b)
+	for i := range max(len(aNums), len(bNums)) {
+		var x, y int
+		if i < len(aNums) {
+			x = aNums[i]
+		}
+		if i < len(bNums) {
+			y = bNums[i]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return false
+	case aPre == "":
+		return true
+	case bPre == "":
+		return false
+	default:
+		return aPre > bPre
+	}
+}
+
+func splitVersion(v string) ([]int, string) {
+	v, pre, _ := strings.Cut(strings.TrimPrefix(v, "v"), "-")
+	var nums []int
+	for _, part := range strings.Split(v, ".") {
+		n, _ := strconv.Atoi(part)
+		nums = append(nums, n)
+	}
+	return nums, pre
+}
+
+// ParsePublicKey reads an Ed25519 public key, either base64 of the raw 32
+// bytes or a PEM "PUBLIC KEY" block as openssl writes it
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	s = strings.TrimSpace(s)
+	if block, _ := pem.Decode([]byte(s)); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		edKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key is not an Ed25519 key")
+		}
+		return edKey, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key is neither PEM nor a base64 Ed25519 key")
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// Verify returns the release's binary for platform once its signature
+// checks out against key, so its version, platform, and checksum can be
+// trusted. The binary itself is then checked against the checksum as it's
+// downloaded.
+func (r *Release) Verify(platform string, key ed25519.PublicKey) (Binary, error) {
+	bin, ok := r.Binaries[platform]
+	if !ok {
+		return Binary{}, fmt.Errorf("release %s has no binary for %s", r.Version, platform)
+	}
+	if bin.SHA256 == "" || bin.Signature == "" {
+		return Binary{}, fmt.Errorf("release %s doesn't publish a checksum and signature for %s", r.Version, platform)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(bin.Signature))
+	if err != nil {
+		return Binary{}, fmt.Errorf("malformed signature: %w", err)
+	}
+	if !ed25519.Verify(key, Statement(r.Version, platform, strings.ToLower(bin.SHA256)), sig) {
+		return Binary{}, fmt.Errorf("signature verification failed: release %s for %s wasn't signed by the release key", r.Version, platform)
+	}
+	return bin, nil
+}
+
+// Replace atomically swaps the executable at exe for the file at path. The
+// new binary is copied next to exe and renamed over it, so a crash leaves
+// either the old binary or the new one, never a partial file.
+func Replace(exe, path string) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", exe, err)
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open downloaded binary: %w", err)
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(exe), "."+filepath.Base(exe)+".update-*")
+	if err != nil {
+		return fmt.Errorf("failed to write next to %s: %w", exe, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to copy new binary: %w", err)
+	}
+	if err := tmp.Chmod(info.Mode().Perm() | 0111); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to make new binary executable: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to flush new binary: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write new binary: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", exe, err)
+	}
+	return nil
+}
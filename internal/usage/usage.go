@@ -0,0 +1,133 @@
+// Package usage keeps opt-in, local-only statistics on how much work the
+// tool has done: runs, bytes dumped and restored, and what deduplication
+// saved. Nothing is ever sent anywhere; the file is for admins who want to
+// show what the tooling is worth.
+package usage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Operations counted in Stats.Ops
+const (
+	OpBackup  = "backup"
+	OpRestore = "restore"
+	OpExport  = "export"
+)
+
+// Event is one completed run
+type Event struct {
+	Op string
+	// Bytes is the size of the artifact written or read
+	Bytes int64
+	// Duplicate is set when the artifact matched one already stored and
+	// was discarded, so Bytes didn't take up more space
+	Duplicate bool
+}
+
+// Stats are the totals collected so far
+type Stats struct {
+	Since time.Time     `json:"since"`
+	Last  time.Time     `json:"last"`
+	Ops   map[string]Op `json:"ops"`
+	// DedupHits counts backups discarded for matching a stored one, and
+	// DedupBytes their total size
+	DedupHits  int   `json:"dedup_hits"`
+	DedupBytes int64 `json:"dedup_bytes"`
+}
+
+// Op totals the runs of one operation
+type Op struct {
+	Runs  int   `json:"runs"`
+	Bytes int64 `json:"bytes"`
+}
+
+// OpNames returns the operations recorded, sorted
+func (s Stats) OpNames() []string {
+	names := make([]string, 0, len(s.Ops))
+	for name := range s.Ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Store is a usage statistics file
+type Store struct {
+	path string
+}
+
+// Open returns the store at path. The file is created on first write.
+func Open(path string) *Store {
+	return &Store{path: path}
+}
+
+// Record adds a completed run to the totals
+func (s *Store) Record(e Event) error {
+	stats, err := s.Load()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	if stats.Since.IsZero() {
+		stats.Since = now
+	}
+	stats.Last = now
+	if stats.Ops == nil {
+		stats.Ops = map[string]Op{}
+	}
+	op := stats.Ops[e.Op]
+	op.Runs++
+	op.Bytes += e.Bytes
+	stats.Ops[e.Op] = op
+	if e.Duplicate {
+		stats.DedupHits++
+		stats.DedupBytes += e.Bytes
+	}
+	return s.save(stats)
+}
+
+// Load returns the totals, which are empty if nothing was recorded yet
+func (s *Store) Load() (Stats, error) {
+	var stats Stats
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, fmt.Errorf("failed to read usage statistics: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return stats, fmt.Errorf("failed to parse usage statistics %s: %w", s.path, err)
+	}
+	return stats, nil
+}
+
+// save writes the store atomically
+func (s *Store) save(stats Stats) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create usage statistics directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode usage statistics: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write usage statistics: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write usage statistics: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+// Package backituptest starts disposable PostgreSQL containers and runs
+// backup → restore → verify cycles against them, so code embedding
+// back-it-up can write end-to-end tests. It talks to Docker through the
+// docker CLI and skips the test when Docker isn't available.
+package backituptest
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/docker"
+)
+
+// DefaultImage is the PostgreSQL image started when no other is given
+const DefaultImage = "postgres:16-alpine"
+
+// DefaultSeed creates a small table with a few rows in the test database
+const DefaultSeed = `
+CREATE TABLE customers (id serial PRIMARY KEY, name text NOT NULL, created_at timestamptz DEFAULT now());
+INSERT INTO customers (name) SELECT 'customer ' || g FROM generate_series(1, 100) g;
+`
+
+// Postgres is a running PostgreSQL container
+type Postgres struct {
+	Container string
+	Database  string
+	User      string
+	Password  string
+}
+
+type options struct {
+	image    string
+	database string
+	user     string
+	seed     string
+	timeout  time.Duration
+	events   Events
+	clock    Clock
+}
+
+// Option customizes the containers started by StartPostgres and StartPair
+type Option func(*options)
+
+// WithImage selects the PostgreSQL image
+func WithImage(image string) Option {
+	return func(o *options) { o.image = image }
+}
+
+// WithDatabase sets the database created in each container
+func WithDatabase(name string) Option {
+	return func(o *options) { o.database = name }
+}
+
+// WithUser sets the superuser created in each container
+func WithUser(user string) Option {
+	return func(o *options) { o.user = user }
+}
+
+// WithSeed replaces DefaultSeed with custom SQL run against the source database
+func WithSeed(sql string) Option {
+	return func(o *options) { o.seed = sql }
+}
+
+// WithStartupTimeout bounds how long to wait for PostgreSQL to accept connections
+func WithStartupTimeout(d time.Duration) Option {
+	return func(o *options) { o.timeout = d }
+}
+
+// WithEvents has RunCycle report its progress to events
+func WithEvents(events Events) Option {
+	return func(o *options) { o.events = events }
+}
+
+// WithClock has RunCycle take the backup's timestamp, and so its file name,
+// from clock
+func WithClock(clock Clock) Option {
+	return func(o *options) { o.clock = clock }
+}
+
+func buildOptions(opts []Option) options {
+	o := options{
+		image:    DefaultImage,
+		database: "app",
+		user:     "postgres",
+		seed:     DefaultSeed,
+		timeout:  60 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// StartPostgres starts an empty PostgreSQL container that is removed when the test ends
+func StartPostgres(t testing.TB, opts ...Option) *Postgres {
+	t.Helper()
+	return startPostgres(t, buildOptions(opts))
+}
+
+func startPostgres(t testing.TB, o options) *Postgres {
+	t.Helper()
+	requireDocker(t)
+
+	pg := &Postgres{
+		Container: fmt.Sprintf("backituptest-%d", time.Now().UnixNano()),
+		Database:  o.database,
+		User:      o.user,
+		Password:  "backituptest",
+	}
+
+	output, err := exec.Command("docker", "run", "-d", "--rm",
+		"--name", pg.Container,
+		"-e", "POSTGRES_USER="+pg.User,
+		"-e", "POSTGRES_PASSWORD="+pg.Password,
+		"-e", "POSTGRES_DB="+pg.Database,
+		o.image).CombinedOutput()
+	if err != nil {
+		t.Fatalf("backituptest: failed to start %s: %v\n%s", o.image, err, output)
+	}
+	t.Cleanup(func() {
+		exec.Command("docker", "rm", "-f", pg.Container).Run()
+	})
+
+	pg.waitReady(t, o.timeout)
+	return pg
+}
+
+// waitReady blocks until the server accepts queries. pg_isready alone isn't
+// enough because the entrypoint restarts the server after initialization.
+func (p *Postgres) waitReady(t testing.TB, timeout time.Duration) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := exec.Command("docker", "exec", p.Container,
+			"psql", "-U", p.User, "-d", p.Database, "-h", "127.0.0.1", "-tAc", "SELECT 1").Run()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("backituptest: %s not ready after %s: %v", p.Container, timeout, err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// Exec runs SQL against the container's database and fails the test on error
+func (p *Postgres) Exec(t testing.TB, sql string) string {
+	t.Helper()
+
+	cmd := exec.Command("docker", "exec", "-i", p.Container,
+		"psql", "-U", p.User, "-d", p.Database, "-v", "ON_ERROR_STOP=1", "-tA")
+	cmd.Stdin = strings.NewReader(sql)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("backituptest: SQL failed in %s: %v\n%s", p.Container, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// Pair is a seeded source container and an empty target container
+type Pair struct {
+	Source *Postgres
+	Target *Postgres
+
+	options options
+}
+
+// StartPair starts a source container seeded with data and an empty target
+func StartPair(t testing.TB, opts ...Option) *Pair {
+	t.Helper()
+
+	o := buildOptions(opts)
+	pair := &Pair{
+		Source:  startPostgres(t, o),
+		Target:  startPostgres(t, o),
+		options: o,
+	}
+	if o.seed != "" {
+		pair.Source.Exec(t, o.seed)
+	}
+	return pair
+}
+
+// CycleResult reports the outcome of RunCycle
+type CycleResult struct {
+	BackupPath string
+	Match      bool
+}
+
+// RunCycle backs up the source, restores it into the target with --drop
+// semantics, and verifies the two match. Backups are written to a
+// temporary directory owned by the test.
+func (p *Pair) RunCycle(t testing.TB) CycleResult {
+	t.Helper()
+
+	svc := backup.NewService(docker.NewService())
+	svc.SetEvents(p.options.events)
+	svc.SetClock(p.options.clock)
+
+	path, err := svc.Backup(backup.Config{
+		ContainerName: p.Source.Container,
+		DatabaseName:  p.Source.Database,
+		DatabaseUser:  p.Source.User,
+		OutputDir:     t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("backituptest: backup failed: %v", err)
+	}
+
+	if err := svc.Restore(backup.RestoreConfig{
+		ContainerName: p.Target.Container,
+		DatabaseName:  p.Target.Database,
+		DatabaseUser:  p.Target.User,
+		BackupPath:    path,
+		DropExisting:  true,
+	}); err != nil {
+		t.Fatalf("backituptest: restore failed: %v", err)
+	}
+
+	match, err := svc.Verify(backup.VerifyConfig{
+		SourceContainer: p.Source.Container,
+		TargetContainer: p.Target.Container,
+		DatabaseName:    p.Source.Database,
+		DatabaseUser:    p.Source.User,
+	})
+	if err != nil {
+		t.Fatalf("backituptest: verify failed: %v", err)
+	}
+
+	return CycleResult{BackupPath: path, Match: match}
+}
+
+// requireDocker skips the test when the docker CLI or daemon is unavailable
+func requireDocker(t testing.TB) {
+	t.Helper()
+
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("backituptest: docker CLI not found")
+	}
+	if err := exec.Command("docker", "info").Run(); err != nil {
+		t.Skip("backituptest: docker daemon not reachable")
+	}
+}
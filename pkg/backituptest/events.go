@@ -0,0 +1,33 @@
+package backituptest
+
+import (
+	"github.com/iostate/back-it-up/internal/backup"
+	"github.com/iostate/back-it-up/internal/clock"
+)
+
+// Events receives a cycle's progress, as WithEvents sets it. Embed
+// NopEvents to implement only some callbacks.
+type (
+	Events    = backup.Events
+	NopEvents = backup.NopEvents
+	Phase     = backup.Phase
+)
+
+// Phases reported to Events.OnPhase
+const (
+	PhaseDump     = backup.PhaseDump
+	PhaseDrop     = backup.PhaseDrop
+	PhaseCreate   = backup.PhaseCreate
+	PhaseRestore  = backup.PhaseRestore
+	PhaseRefresh  = backup.PhaseRefresh
+	PhaseChecksum = backup.PhaseChecksum
+)
+
+// Clock and IDGenerator are where back-it-up takes the time and catalog
+// IDs from; FixedClock and SequenceIDGenerator make both reproducible
+type (
+	Clock               = clock.Clock
+	FixedClock          = clock.Fixed
+	IDGenerator         = clock.IDGenerator
+	SequenceIDGenerator = clock.SequenceIDGenerator
+)
@@ -0,0 +1,47 @@
+#!/bin/sh
+# Builds static release binaries for every platform, signs each one's
+# version, platform, and SHA-256 with an Ed25519 key, and writes the
+# release.json that `self-update` reads.
+#
+#   scripts/release.sh <version> <signing-key.pem> [out-dir]
+#
+# Make a signing key with: openssl genpkey -algorithm ed25519 -out release.pem
+set -eu
+
+VERSION=${1:?usage: release.sh <version> <signing-key.pem> [out-dir]}
+KEY=${2:?usage: release.sh <version> <signing-key.pem> [out-dir]}
+OUT=${3:-dist}
+PLATFORMS="linux/amd64 linux/arm64 darwin/amd64 darwin/arm64"
+
+# The raw public key is the last 32 bytes of its DER encoding
+PUBKEY=$(openssl pkey -in "$KEY" -pubout -outform DER | tail -c 32 | base64)
+
+mkdir -p "$OUT"
+entries=""
+for platform in $PLATFORMS; do
+	os=${platform%/*}
+	arch=${platform#*/}
+	bin="biu-$os-$arch"
+	CGO_ENABLED=0 GOOS=$os GOARCH=$arch go build -trimpath \
+		-ldflags "-s -w -X main.version=$VERSION -X main.releaseKey=$PUBKEY" \
+		-o "$OUT/$bin" ./cmd
+	sum=$(sha256sum "$OUT/$bin" | cut -d' ' -f1)
+	# Signs the version and platform along with the checksum, as
+	# update.Statement builds it
+	statement=$(mktemp)
+	printf 'back-it-up %s %s %s\n' "$VERSION" "$platform" "$sum" > "$statement"
+	sig=$(openssl pkeyutl -sign -inkey "$KEY" -rawin -in "$statement" | base64 | tr -d '\n')
+	rm -f "$statement"
+	echo "$sum  $bin" > "$OUT/$bin.sha256"
+	entries="$entries${entries:+,}
+    \"$platform\": {\"url\": \"$bin\", \"sha256\": \"$sum\", \"signature\": \"$sig\"}"
+done
+
+cat > "$OUT/release.json" <<JSON
+{
+  "version": "$VERSION",
+  "binaries": {$entries
+  }
+}
+JSON
+echo "Wrote $OUT/release.json; publish it alongside the binaries"